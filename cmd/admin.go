@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"reddit-clone/internal/handlers"
+	"reddit-clone/internal/store"
+)
+
+// Admin runs the account tasks that otherwise need an admin signed in to
+// the site: "create-user", "ban-user" and "unban-user", each given a
+// username.
+func Admin(cfg Config, args []string) error {
+	if len(args) != 2 {
+		return errors.New("want create-user, ban-user or unban-user and a username")
+	}
+	if cfg.DB.Driver == "memory" {
+		return errors.New("the memory store does not outlive this command")
+	}
+	if err := OpenStore(cfg); err != nil {
+		return err
+	}
+	defer handlers.Store.Close()
+	handlers.Admins = cfg.Admins
+	c, action, username := context.Background(), args[0], args[1]
+	switch action {
+	case "create-user":
+		// Read from stdin so the password stays out of shell history and
+		// can be piped in by scripts.
+		fmt.Fprint(os.Stderr, "password: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return err
+		}
+		user, err := handlers.CreateUser(c, username, strings.TrimRight(password, "\r\n"))
+		if err != nil {
+			return err
+		}
+		slog.Info("created user", "username", user.Username, "id", user.ID)
+		return nil
+	case "ban-user", "unban-user":
+		user, err := handlers.UserByName(c, username)
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("no user is named %q", username)
+		} else if err != nil {
+			return err
+		}
+		ban := action == "ban-user"
+		if ban && handlers.IsAdmin(user) {
+			return handlers.ErrBanAdmin
+		}
+		if err := handlers.SetBanned(c, user, ban); err != nil {
+			return err
+		}
+		slog.Info("updated user", "username", user.Username, "banned", ban)
+		return nil
+	}
+	return fmt.Errorf("unknown action %q, want create-user, ban-user or unban-user", action)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/handlers"
+)
+
+// TestAdmin creates, bans and unbans a user through the admin command.
+func TestAdmin(t *testing.T) {
+	saved, admins := handlers.Store, handlers.Admins
+	t.Cleanup(func() { handlers.Store, handlers.Admins = saved, admins })
+	cfg := DefaultConfig()
+	cfg.DB.DSN = filepath.Join(t.TempDir(), "test.db")
+	cfg.Admins = []string{"root"}
+	stdin := os.Stdin
+	t.Cleanup(func() { os.Stdin = stdin })
+	createUser := func(username, password string) error {
+		t.Helper()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteString(password + "\n")
+		w.Close()
+		os.Stdin = r
+		return Admin(cfg, []string{"create-user", username})
+	}
+	for _, username := range []string{"alice", "root"} {
+		if err := createUser(username, "hunter22"); err != nil {
+			t.Fatalf("create %s: %v", username, err)
+		}
+	}
+	if err := createUser("alice", "again"); err == nil {
+		t.Error("created alice twice")
+	}
+	banned := func() bool {
+		t.Helper()
+		if err := OpenStore(cfg); err != nil {
+			t.Fatal(err)
+		}
+		defer handlers.Store.Close()
+		user, err := handlers.UserByName(context.Background(), "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := handlers.Authenticate(context.Background(), "alice", "hunter22"); err != nil && !errors.Is(err, handlers.ErrBanned) {
+			t.Errorf("log in with the password from stdin: %v", err)
+		}
+		return user.Banned
+	}
+	if err := Admin(cfg, []string{"ban-user", "alice"}); err != nil || !banned() {
+		t.Errorf("ban alice: %v", err)
+	}
+	if err := Admin(cfg, []string{"unban-user", "alice"}); err != nil || banned() {
+		t.Errorf("unban alice: %v", err)
+	}
+	if err := Admin(cfg, []string{"ban-user", "root"}); !errors.Is(err, handlers.ErrBanAdmin) {
+		t.Errorf("ban an admin: got %v", err)
+	}
+	for _, args := range [][]string{{"ban-user", "nobody"}, {"promote", "alice"}, {"ban-user"}} {
+		if err := Admin(cfg, args); err == nil {
+			t.Errorf("admin %v succeeded", args)
+		}
+	}
+	cfg.DB.Driver = "memory"
+	if err := Admin(cfg, []string{"ban-user", "alice"}); err == nil {
+		t.Error("ran against the memory store")
+	}
+}
+
+// TestUsage runs the binary with an unknown command.
+func TestUsage(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "SERVER_ARGS=frobnicate")
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 2 || !strings.HasPrefix(string(out), "usage: reddit-clone") {
+		t.Errorf("an unknown command: got %v: %s", err, out)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"reddit-clone/internal/handlers"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+	"reddit-clone/internal/tracing"
+)
+
+type Config struct {
+	Addr            string                          `yaml:"addr"`
+	BaseURL         string                          `yaml:"baseURL"`
+	Templates       string                          `yaml:"templates"`
+	Static          string                          `yaml:"static"`
+	LogFormat       string                          `yaml:"logFormat"`
+	Dev             bool                            `yaml:"dev"`
+	SecureCookies   bool                            `yaml:"secureCookies"`
+	JWTSecret       string                          `yaml:"jwtSecret"`
+	ShutdownTimeout time.Duration                   `yaml:"shutdownTimeout"`
+	DB              DBConfig                        `yaml:"db"`
+	OAuth           map[string]handlers.OAuthClient `yaml:"oauth"`
+	Features        handlers.FeatureConfig          `yaml:"features"`
+	RateLimit       handlers.RateLimitConfig        `yaml:"rateLimit"`
+	Admins          []string                        `yaml:"admins"`
+	TrustedProxies  []string                        `yaml:"trustedProxies"`
+	EditGrace       time.Duration                   `yaml:"editGrace"`
+	MaxPinnedPosts  int                             `yaml:"maxPinnedPosts"`
+	TitleRules      models.TitleNormalization       `yaml:"titleRules"`
+	ScoreDecay      models.ScoreDecay               `yaml:"scoreDecay"`
+	Purge           handlers.PurgeConfig            `yaml:"purge"`
+	ReportArchive   handlers.ReportArchiveConfig    `yaml:"reportArchive"`
+	Trending        handlers.TrendingConfig         `yaml:"trending"`
+	Views           handlers.ViewsConfig            `yaml:"views"`
+	Sitemap         handlers.SitemapConfig          `yaml:"sitemap"`
+	TopicHealth     handlers.TopicHealthConfig      `yaml:"topicHealth"`
+	Previews        handlers.PreviewConfig          `yaml:"previews"`
+	Media           handlers.MediaConfig            `yaml:"media"`
+	Tracing         tracing.Config                  `yaml:"tracing"`
+	RedisURL        string                          `yaml:"redisURL"`
+}
+type DBConfig struct {
+	Driver      string            `yaml:"driver"`
+	DSN         string            `yaml:"dsn"`
+	SlowQuery   time.Duration     `yaml:"slowQuery"`
+	AutoMigrate bool              `yaml:"autoMigrate"`
+	Cache       store.CacheConfig `yaml:"cache"`
+	Options     store.Options     `yaml:",inline"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Addr:            "127.0.0.1:9001",
+		BaseURL:         "http://127.0.0.1:9001",
+		ShutdownTimeout: 10 * time.Second,
+		EditGrace:       5 * time.Minute,
+		MaxPinnedPosts:  handlers.MaxPinnedPosts,
+		TitleRules:      models.TitleRules,
+		SecureCookies:   true,
+		Purge:           handlers.PurgeConfig{Retention: 30 * 24 * time.Hour, Interval: time.Hour},
+		ReportArchive:   handlers.ReportArchiveConfig{Age: 90 * 24 * time.Hour, Interval: time.Hour},
+		Trending:        handlers.TrendingConfig{Interval: 10 * time.Minute},
+		Views:           handlers.ViewsConfig{Window: 30 * time.Minute, Interval: time.Minute},
+		Sitemap:         handlers.Sitemap,
+		TopicHealth:     handlers.TopicHealth,
+		Previews:        handlers.Previews,
+		Media:           handlers.Media,
+		Tracing:         tracing.Config{ServiceName: "reddit-clone"},
+		LogFormat:       "text",
+		DB: DBConfig{Driver: "sqlite", SlowQuery: 200 * time.Millisecond, AutoMigrate: true, Cache: store.CacheConfig{Size: 512, TTL: 30 * time.Second}, Options: store.Options{
+			SQLite: store.SQLiteConfig{JournalMode: "WAL", BusyTimeout: 5 * time.Second, ForeignKeys: true},
+			Pool:   store.PoolConfig{MaxOpenConns: 16, MaxIdleConns: 16, ConnMaxLifetime: 30 * time.Minute},
+		}},
+		OAuth:    map[string]handlers.OAuthClient{},
+		Features: handlers.FeatureConfig{Search: true, Signup: true, Metrics: true},
+		RateLimit: handlers.RateLimitConfig{
+			Enabled:  true,
+			Reads:    handlers.RateBudget{Burst: 120, Per: time.Minute},
+			Writes:   handlers.RateBudget{Burst: 20, Per: time.Minute},
+			Votes:    handlers.RateBudget{Burst: 60, Per: time.Minute},
+			Exports:  handlers.RateBudget{Burst: 2, Per: time.Hour},
+			Backoff:  handlers.Backoff{Base: 5 * time.Second, Max: 10 * time.Minute, Window: 10 * time.Minute},
+			Brigades: handlers.Brigades{Window: 10 * time.Minute, Threshold: 300, Comments: handlers.RateBudget{Burst: 1, Per: 2 * time.Minute}},
+		},
+	}
+}
+
+// LoadConfig layers the defaults, an optional YAML file, environment
+// variables and command line flags, each overriding the previous one.
+func LoadConfig(args []string) (Config, error) {
+	cfg := DefaultConfig()
+	var flags Config
+	fs := flag.NewFlagSet("reddit-clone", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	fs.StringVar(&flags.Addr, "addr", "", "address to listen on")
+	fs.StringVar(&flags.BaseURL, "base-url", "", "public URL used for OAuth callbacks")
+	fs.StringVar(&flags.Templates, "templates", "", "glob of HTML templates to load from disk instead of the embedded ones")
+	fs.BoolVar(&flags.Dev, "dev", false, "reload templates and static files from web/ on every request")
+	fs.StringVar(&flags.Static, "static", "", "directory of static files to serve from disk instead of the embedded ones")
+	fs.StringVar(&flags.DB.Driver, "db-driver", "", "database driver: sqlite, postgres, mysql or memory")
+	fs.StringVar(&flags.DB.DSN, "db-dsn", "", "database connection string")
+	fs.StringVar(&flags.RedisURL, "redis-url", "", "redis:// URL replicas share live events, rate limits and cache invalidations through")
+	fs.DurationVar(&flags.ShutdownTimeout, "shutdown-timeout", 0, "how long to wait for in-flight requests on shutdown")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return cfg, err
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("%s: %w", *path, err)
+		}
+	}
+	override(&cfg.Addr, os.Getenv("ADDR"))
+	override(&cfg.BaseURL, os.Getenv("BASE_URL"))
+	override(&cfg.Templates, os.Getenv("TEMPLATES"))
+	override(&cfg.Static, os.Getenv("STATIC"))
+	override(&cfg.LogFormat, os.Getenv("LOG_FORMAT"))
+	override(&cfg.JWTSecret, os.Getenv("JWT_SECRET"))
+	override(&cfg.DB.Driver, os.Getenv("DB_DRIVER"))
+	override(&cfg.DB.DSN, os.Getenv("DB_DSN"))
+	override(&cfg.DB.Options.SQLite.JournalMode, os.Getenv("SQLITE_JOURNAL_MODE"))
+	override(&cfg.RedisURL, os.Getenv("REDIS_URL"))
+	override(&cfg.Media.Backend, os.Getenv("MEDIA_BACKEND"))
+	override(&cfg.Media.Root, os.Getenv("MEDIA_ROOT"))
+	override(&cfg.Media.S3.Endpoint, os.Getenv("MEDIA_S3_ENDPOINT"))
+	override(&cfg.Media.S3.Region, os.Getenv("MEDIA_S3_REGION"))
+	override(&cfg.Media.S3.Bucket, os.Getenv("MEDIA_S3_BUCKET"))
+	override(&cfg.Media.S3.AccessKey, os.Getenv("MEDIA_S3_ACCESS_KEY"))
+	override(&cfg.Media.S3.SecretKey, os.Getenv("MEDIA_S3_SECRET_KEY"))
+	override(&cfg.Media.S3.PublicURL, os.Getenv("MEDIA_S3_PUBLIC_URL"))
+	override(&cfg.Tracing.Endpoint, os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	override(&cfg.Tracing.ServiceName, os.Getenv("OTEL_SERVICE_NAME"))
+	if v := os.Getenv("ADMINS"); v != "" {
+		cfg.Admins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		cfg.TrustedProxies = strings.Split(v, ",")
+	}
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("SHUTDOWN_TIMEOUT: %w", err)
+		}
+		cfg.ShutdownTimeout = timeout
+	}
+	for env, duration := range map[string]*time.Duration{"EDIT_GRACE": &cfg.EditGrace, "PURGE_RETENTION": &cfg.Purge.Retention, "PURGE_INTERVAL": &cfg.Purge.Interval, "REPORT_ARCHIVE_AGE": &cfg.ReportArchive.Age, "REPORT_ARCHIVE_INTERVAL": &cfg.ReportArchive.Interval, "TRENDING_INTERVAL": &cfg.Trending.Interval, "VIEW_WINDOW": &cfg.Views.Window, "VIEW_FLUSH_INTERVAL": &cfg.Views.Interval, "SITEMAP_MAX_AGE": &cfg.Sitemap.MaxAge, "TOPIC_HEALTH_WINDOW": &cfg.TopicHealth.Window, "TOPIC_HEALTH_MAX_AGE": &cfg.TopicHealth.MaxAge, "PREVIEW_TIMEOUT": &cfg.Previews.Timeout, "DB_SLOW_QUERY": &cfg.DB.SlowQuery, "DB_CACHE_TTL": &cfg.DB.Cache.TTL, "DB_CONN_MAX_LIFETIME": &cfg.DB.Options.Pool.ConnMaxLifetime, "SQLITE_BUSY_TIMEOUT": &cfg.DB.Options.SQLite.BusyTimeout, "SCORE_DECAY_HALF_LIFE": &cfg.ScoreDecay.HalfLife, "RATE_LIMIT_BACKOFF_BASE": &cfg.RateLimit.Backoff.Base, "RATE_LIMIT_BACKOFF_MAX": &cfg.RateLimit.Backoff.Max, "RATE_LIMIT_BACKOFF_WINDOW": &cfg.RateLimit.Backoff.Window, "RATE_LIMIT_BRIGADE_WINDOW": &cfg.RateLimit.Brigades.Window} {
+		if v := os.Getenv(env); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %w", env, err)
+			}
+			*duration = parsed
+		}
+	}
+	for env, n := range map[string]*int{"SITEMAP_SIZE": &cfg.Sitemap.Size, "TOPIC_HEALTH_TARGET": &cfg.TopicHealth.Target, "RATE_LIMIT_BRIGADE_THRESHOLD": &cfg.RateLimit.Brigades.Threshold, "PREVIEW_MAX_BYTES": &cfg.Previews.MaxBytes, "MEDIA_MAX_BYTES": &cfg.Media.MaxBytes, "MEDIA_THUMBNAIL_SIZE": &cfg.Media.ThumbnailSize, "DB_CACHE_SIZE": &cfg.DB.Cache.Size, "DB_MAX_OPEN_CONNS": &cfg.DB.Options.Pool.MaxOpenConns, "DB_MAX_IDLE_CONNS": &cfg.DB.Options.Pool.MaxIdleConns} {
+		if v := os.Getenv(env); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %w", env, err)
+			}
+			*n = parsed
+		}
+	}
+	if cfg.OAuth == nil {
+		cfg.OAuth = map[string]handlers.OAuthClient{}
+	}
+	for name := range handlers.OAuthSpecs {
+		prefix := strings.ToUpper(name)
+		client := cfg.OAuth[name]
+		override(&client.ClientID, os.Getenv(prefix+"_CLIENT_ID"))
+		override(&client.ClientSecret, os.Getenv(prefix+"_CLIENT_SECRET"))
+		cfg.OAuth[name] = client
+	}
+	for env, toggle := range map[string]*bool{"FEATURE_SEARCH": &cfg.Features.Search, "FEATURE_SIGNUP": &cfg.Features.Signup, "FEATURE_METRICS": &cfg.Features.Metrics, "FEATURE_FUZZ_VOTES": &cfg.Features.FuzzVotes, "FEATURE_SHADOW_REMOVE_EVADERS": &cfg.Features.ShadowRemoveEvaders, "RATE_LIMIT": &cfg.RateLimit.Enabled, "DB_AUTO_MIGRATE": &cfg.DB.AutoMigrate, "PURGE_DRY_RUN": &cfg.Purge.DryRun, "LINK_PREVIEWS": &cfg.Previews.Enabled, "PREVIEW_ALLOW_PRIVATE": &cfg.Previews.AllowPrivate, "MEDIA_S3_PATH_STYLE": &cfg.Media.S3.PathStyle, "DEV": &cfg.Dev, "SECURE_COOKIES": &cfg.SecureCookies, "SQLITE_FOREIGN_KEYS": &cfg.DB.Options.SQLite.ForeignKeys, "TITLE_LOWERCASE": &cfg.TitleRules.Lowercase, "TITLE_STRIP_PUNCTUATION": &cfg.TitleRules.StripPunctuation, "TITLE_COLLAPSE_WHITESPACE": &cfg.TitleRules.CollapseWhitespace, "SCORE_DECAY_TOPICS": &cfg.ScoreDecay.Topics} {
+		if v := os.Getenv(env); v != "" {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %w", env, err)
+			}
+			*toggle = enabled
+		}
+	}
+	override(&cfg.Addr, flags.Addr)
+	override(&cfg.BaseURL, flags.BaseURL)
+	override(&cfg.Templates, flags.Templates)
+	override(&cfg.Static, flags.Static)
+	override(&cfg.DB.Driver, flags.DB.Driver)
+	override(&cfg.DB.DSN, flags.DB.DSN)
+	override(&cfg.RedisURL, flags.RedisURL)
+	if flags.ShutdownTimeout > 0 {
+		cfg.ShutdownTimeout = flags.ShutdownTimeout
+	}
+	cfg.Dev = cfg.Dev || flags.Dev
+	if cfg.Dev && cfg.Templates == "" {
+		cfg.Templates = "web/views/*.html"
+	}
+	if cfg.Dev && cfg.Static == "" {
+		cfg.Static = "web/static"
+	}
+	// The dev server is reached over plain HTTP, where browsers drop
+	// Secure cookies.
+	if cfg.Dev {
+		cfg.SecureCookies = false
+	}
+	if cfg.DB.Driver == "sqlite" && cfg.DB.DSN == "" {
+		cfg.DB.DSN = "tmp/test.db"
+	}
+	return cfg, nil
+}
+func override(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/handlers"
+	"reddit-clone/internal/media"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+	"reddit-clone/internal/tracing"
+)
+
+// TestLoadConfig layers a config file, the environment and flags, and
+// checks each overrides the one before.
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != "127.0.0.1:9001" || cfg.DB.Driver != "sqlite" || cfg.DB.DSN != "tmp/test.db" || cfg.DB.SlowQuery != 200*time.Millisecond || cfg.LogFormat != "text" || cfg.Templates != "" || cfg.Static != "" || cfg.Dev || !cfg.SecureCookies || cfg.DB.Cache != (store.CacheConfig{Size: 512, TTL: 30 * time.Second}) || cfg.DB.Options.Pool.MaxOpenConns != 16 || !cfg.DB.Options.SQLite.ForeignKeys || !cfg.DB.AutoMigrate || !cfg.Features.Signup || !cfg.Features.Metrics || cfg.Features.FuzzVotes || cfg.Features.ShadowRemoveEvaders || cfg.ShutdownTimeout != 10*time.Second || cfg.EditGrace != 5*time.Minute || cfg.MaxPinnedPosts != 2 || cfg.TitleRules != models.TitleRules || cfg.ScoreDecay != (models.ScoreDecay{}) || cfg.Purge.Retention != 30*24*time.Hour || cfg.ReportArchive != (handlers.ReportArchiveConfig{Age: 90 * 24 * time.Hour, Interval: time.Hour}) || cfg.Trending.Interval != 10*time.Minute || cfg.Views != (handlers.ViewsConfig{Window: 30 * time.Minute, Interval: time.Minute}) || cfg.Sitemap != (handlers.SitemapConfig{MaxAge: time.Hour, Size: 50000}) || cfg.TopicHealth != handlers.TopicHealth || cfg.Previews != (handlers.PreviewConfig{Enabled: true, Timeout: 5 * time.Second, MaxBytes: 1 << 20}) || cfg.Media != (handlers.MediaConfig{Backend: "local", Root: "media", MaxBytes: 10 << 20, ThumbnailSize: 320}) || !cfg.RateLimit.Enabled || cfg.RateLimit.Exports != (handlers.RateBudget{Burst: 2, Per: time.Hour}) || cfg.RateLimit.Brigades != (handlers.Brigades{Window: 10 * time.Minute, Threshold: 300, Comments: handlers.RateBudget{Burst: 1, Per: 2 * time.Minute}}) {
+		t.Errorf("defaults: got %+v", cfg)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "addr: 127.0.0.1:8000\nshutdownTimeout: 30s\nbaseURL: https://example.com\ndb:\n  dsn: app.db\n  sqlite:\n    busyTimeout: 10s\n  pool:\n    maxIdleConns: 2\noauth:\n  github:\n    clientID: id\n    clientSecret: secret\nfeatures:\n  signup: false\nrateLimit:\n  reads:\n    burst: 5\n    per: 1s\n  backoff:\n    max: 1h\nadmins: [alice]\neditGrace: 1m\nmaxPinnedPosts: 3\ntitleRules:\n  stripPunctuation: false\nscoreDecay:\n  halfLife: 48h\npurge:\n  retention: 48h\n  dryRun: true\ntopicHealth:\n  weights:\n    growth: 0\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err = LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != "127.0.0.1:8000" || cfg.BaseURL != "https://example.com" || cfg.DB.DSN != "app.db" || cfg.Features.Signup || !cfg.Features.Search || cfg.ShutdownTimeout != 30*time.Second || cfg.EditGrace != time.Minute || cfg.MaxPinnedPosts != 3 || cfg.TitleRules != (models.TitleNormalization{Lowercase: true, CollapseWhitespace: true}) {
+		t.Errorf("from the file: got %+v", cfg)
+	}
+	if cfg.DB.Options.SQLite.BusyTimeout != 10*time.Second || cfg.DB.Options.SQLite.JournalMode != "WAL" || cfg.DB.Options.Pool.MaxIdleConns != 2 {
+		t.Errorf("database options from the file: got %+v", cfg.DB.Options)
+	}
+	if cfg.RateLimit.Reads != (handlers.RateBudget{Burst: 5, Per: time.Second}) || cfg.RateLimit.Writes.Burst != 20 || !cfg.RateLimit.Enabled || cfg.RateLimit.Backoff != (handlers.Backoff{Base: 5 * time.Second, Max: time.Hour, Window: 10 * time.Minute}) {
+		t.Errorf("rate limits from the file: got %+v", cfg.RateLimit)
+	}
+	if cfg.Purge != (handlers.PurgeConfig{Retention: 48 * time.Hour, Interval: time.Hour, DryRun: true}) {
+		t.Errorf("purge from the file: got %+v", cfg.Purge)
+	}
+	if cfg.ScoreDecay != (models.ScoreDecay{HalfLife: 48 * time.Hour}) {
+		t.Errorf("score decay from the file: got %+v", cfg.ScoreDecay)
+	}
+	if cfg.TopicHealth.Weights != (handlers.HealthWeights{Activity: 40, Reports: 20, Removals: 20}) {
+		t.Errorf("topic health weights from the file: got %+v", cfg.TopicHealth.Weights)
+	}
+	if fmt.Sprint(cfg.Admins) != "[alice]" {
+		t.Errorf("admins from the file: got %v", cfg.Admins)
+	}
+	if cfg.OAuth["github"].ClientID != "id" || cfg.OAuth["github"].ClientSecret != "secret" {
+		t.Errorf("github client from the file: got %+v", cfg.OAuth["github"])
+	}
+
+	t.Setenv("ADDR", "127.0.0.1:8001")
+	t.Setenv("FEATURE_SIGNUP", "true")
+	t.Setenv("GITHUB_CLIENT_SECRET", "env secret")
+	t.Setenv("SHUTDOWN_TIMEOUT", "1m")
+	t.Setenv("RATE_LIMIT", "false")
+	t.Setenv("RATE_LIMIT_BACKOFF_BASE", "0")
+	t.Setenv("RATE_LIMIT_BRIGADE_THRESHOLD", "50")
+	t.Setenv("RATE_LIMIT_BRIGADE_WINDOW", "5m")
+	t.Setenv("ADMINS", "alice,bob")
+	t.Setenv("TITLE_LOWERCASE", "false")
+	t.Setenv("SCORE_DECAY_TOPICS", "true")
+	t.Setenv("SCORE_DECAY_HALF_LIFE", "12h")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,192.168.0.1/32")
+	t.Setenv("EDIT_GRACE", "30s")
+	t.Setenv("PURGE_INTERVAL", "10m")
+	t.Setenv("REPORT_ARCHIVE_AGE", "0")
+	t.Setenv("TRENDING_INTERVAL", "0")
+	t.Setenv("VIEW_WINDOW", "1h")
+	t.Setenv("VIEW_FLUSH_INTERVAL", "5m")
+	t.Setenv("SITEMAP_MAX_AGE", "15m")
+	t.Setenv("SITEMAP_SIZE", "1000")
+	t.Setenv("TOPIC_HEALTH_WINDOW", "72h")
+	t.Setenv("TOPIC_HEALTH_TARGET", "20")
+	t.Setenv("LINK_PREVIEWS", "false")
+	t.Setenv("PREVIEW_TIMEOUT", "2s")
+	t.Setenv("PREVIEW_MAX_BYTES", "65536")
+	t.Setenv("PREVIEW_ALLOW_PRIVATE", "true")
+	t.Setenv("MEDIA_ROOT", "/srv/media")
+	t.Setenv("MEDIA_MAX_BYTES", "1048576")
+	t.Setenv("MEDIA_THUMBNAIL_SIZE", "200")
+	t.Setenv("MEDIA_BACKEND", "s3")
+	t.Setenv("MEDIA_S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("MEDIA_S3_REGION", "eu-west-1")
+	t.Setenv("MEDIA_S3_BUCKET", "uploads")
+	t.Setenv("MEDIA_S3_ACCESS_KEY", "access")
+	t.Setenv("MEDIA_S3_SECRET_KEY", "secret")
+	t.Setenv("MEDIA_S3_PATH_STYLE", "true")
+	t.Setenv("MEDIA_S3_PUBLIC_URL", "https://cdn.example.com")
+	t.Setenv("PURGE_DRY_RUN", "false")
+	t.Setenv("FEATURE_METRICS", "false")
+	t.Setenv("FEATURE_FUZZ_VOTES", "true")
+	t.Setenv("FEATURE_SHADOW_REMOVE_EVADERS", "true")
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("DB_SLOW_QUERY", "1s")
+	t.Setenv("DB_AUTO_MIGRATE", "false")
+	t.Setenv("STATIC", "web/static")
+	t.Setenv("DB_CACHE_SIZE", "0")
+	t.Setenv("DB_CACHE_TTL", "1m")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	t.Setenv("REDIS_URL", "redis://localhost:6379")
+	t.Setenv("SQLITE_JOURNAL_MODE", "DELETE")
+	t.Setenv("SQLITE_BUSY_TIMEOUT", "2s")
+	t.Setenv("SQLITE_FOREIGN_KEYS", "false")
+	t.Setenv("DB_MAX_OPEN_CONNS", "4")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "1h")
+	cfg, err = LoadConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Purge != (handlers.PurgeConfig{Retention: 48 * time.Hour, Interval: 10 * time.Minute}) {
+		t.Errorf("purge from the environment: got %+v", cfg.Purge)
+	}
+	if cfg.ReportArchive != (handlers.ReportArchiveConfig{Interval: time.Hour}) {
+		t.Errorf("report archive from the environment: got %+v", cfg.ReportArchive)
+	}
+	if cfg.Trending.Interval != 0 {
+		t.Errorf("trending from the environment: got %+v", cfg.Trending)
+	}
+	if cfg.Views != (handlers.ViewsConfig{Window: time.Hour, Interval: 5 * time.Minute}) {
+		t.Errorf("views from the environment: got %+v", cfg.Views)
+	}
+	if cfg.Sitemap != (handlers.SitemapConfig{MaxAge: 15 * time.Minute, Size: 1000}) {
+		t.Errorf("sitemap from the environment: got %+v", cfg.Sitemap)
+	}
+	if cfg.TopicHealth.Window != 72*time.Hour || cfg.TopicHealth.Target != 20 || cfg.TopicHealth.MaxAge != 10*time.Minute {
+		t.Errorf("topic health from the environment: got %+v", cfg.TopicHealth)
+	}
+	if cfg.Previews != (handlers.PreviewConfig{Timeout: 2 * time.Second, MaxBytes: 65536, AllowPrivate: true}) {
+		t.Errorf("previews from the environment: got %+v", cfg.Previews)
+	}
+	if cfg.Media != (handlers.MediaConfig{Backend: "s3", Root: "/srv/media", S3: media.S3Config{Endpoint: "http://localhost:9000", Region: "eu-west-1", Bucket: "uploads", AccessKey: "access", SecretKey: "secret", PathStyle: true, PublicURL: "https://cdn.example.com"}, MaxBytes: 1 << 20, ThumbnailSize: 200}) {
+		t.Errorf("media from the environment: got %+v", cfg.Media)
+	}
+	if cfg.LogFormat != "json" || cfg.DB.SlowQuery != time.Second {
+		t.Errorf("logging from the environment: got %q and %v", cfg.LogFormat, cfg.DB.SlowQuery)
+	}
+	if cfg.DB.Cache != (store.CacheConfig{TTL: time.Minute}) {
+		t.Errorf("cache from the environment: got %+v", cfg.DB.Cache)
+	}
+	if cfg.Static != "web/static" {
+		t.Errorf("static from the environment: got %q", cfg.Static)
+	}
+	if cfg.DB.AutoMigrate {
+		t.Error("DB_AUTO_MIGRATE=false left auto migration on")
+	}
+	if cfg.DB.Options != (store.Options{SQLite: store.SQLiteConfig{JournalMode: "DELETE", BusyTimeout: 2 * time.Second}, Pool: store.PoolConfig{MaxOpenConns: 4, MaxIdleConns: 2, ConnMaxLifetime: time.Hour}}) {
+		t.Errorf("database options from the environment: got %+v", cfg.DB.Options)
+	}
+	if cfg.RedisURL != "redis://localhost:6379" {
+		t.Errorf("redis from the environment: got %q", cfg.RedisURL)
+	}
+	if cfg.Tracing != (tracing.Config{Endpoint: "http://localhost:4318", ServiceName: "reddit-clone"}) {
+		t.Errorf("tracing from the environment: got %+v", cfg.Tracing)
+	}
+	if fmt.Sprint(cfg.Admins) != "[alice bob]" {
+		t.Errorf("admins from the environment: got %v", cfg.Admins)
+	}
+	if cfg.TitleRules != (models.TitleNormalization{CollapseWhitespace: true}) {
+		t.Errorf("title rules from the environment: got %+v", cfg.TitleRules)
+	}
+	if cfg.ScoreDecay != (models.ScoreDecay{HalfLife: 12 * time.Hour, Topics: true}) {
+		t.Errorf("score decay from the environment: got %+v", cfg.ScoreDecay)
+	}
+	if cfg.RateLimit.Backoff != (handlers.Backoff{Max: time.Hour, Window: 10 * time.Minute}) {
+		t.Errorf("backoff from the environment: got %+v", cfg.RateLimit.Backoff)
+	}
+	if cfg.RateLimit.Brigades.Threshold != 50 || cfg.RateLimit.Brigades.Window != 5*time.Minute {
+		t.Errorf("brigades from the environment: got %+v", cfg.RateLimit.Brigades)
+	}
+	if fmt.Sprint(cfg.TrustedProxies) != "[10.0.0.0/8 192.168.0.1/32]" {
+		t.Errorf("trusted proxies from the environment: got %v", cfg.TrustedProxies)
+	}
+	if cfg.Addr != "127.0.0.1:8001" || !cfg.Features.Signup || cfg.Features.Metrics || !cfg.Features.FuzzVotes || !cfg.Features.ShadowRemoveEvaders || cfg.OAuth["github"].ClientSecret != "env secret" || cfg.OAuth["github"].ClientID != "id" || cfg.ShutdownTimeout != time.Minute || cfg.EditGrace != 30*time.Second || cfg.RateLimit.Enabled {
+		t.Errorf("from the environment: got %+v", cfg)
+	}
+
+	cfg, err = LoadConfig([]string{"-addr", "127.0.0.1:8002", "-db-driver", "postgres", "-db-dsn", "postgres://localhost/app", "-shutdown-timeout", "5s", "-static", "/srv/static", "-templates", "/srv/views/*.html", "-redis-url", "redis://cache/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != "127.0.0.1:8002" || cfg.DB.Driver != "postgres" || cfg.DB.DSN != "postgres://localhost/app" || cfg.ShutdownTimeout != 5*time.Second || cfg.Static != "/srv/static" || cfg.Templates != "/srv/views/*.html" || cfg.RedisURL != "redis://cache/1" {
+		t.Errorf("from flags: got %+v", cfg)
+	}
+
+	t.Setenv("FEATURE_SEARCH", "maybe")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("loaded a FEATURE_SEARCH that is not a boolean")
+	}
+	t.Setenv("FEATURE_SEARCH", "")
+	t.Setenv("SHUTDOWN_TIMEOUT", "soon")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("loaded a SHUTDOWN_TIMEOUT that is not a duration")
+	}
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+	t.Setenv("EDIT_GRACE", "a while")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("loaded an EDIT_GRACE that is not a duration")
+	}
+	t.Setenv("EDIT_GRACE", "")
+	t.Setenv("DB_CACHE_SIZE", "lots")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("loaded a DB_CACHE_SIZE that is not a number")
+	}
+	t.Setenv("DB_CACHE_SIZE", "")
+	t.Setenv("DB_MAX_IDLE_CONNS", "few")
+	if _, err := LoadConfig(nil); err == nil {
+		t.Error("loaded a DB_MAX_IDLE_CONNS that is not a number")
+	}
+	t.Setenv("DB_MAX_IDLE_CONNS", "")
+	t.Setenv("STATIC", "")
+	t.Setenv("DEV", "true")
+	cfg, err = LoadConfig([]string{"-templates", "views/*.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Dev || cfg.Templates != "views/*.html" || cfg.Static != "web/static" || cfg.SecureCookies {
+		t.Errorf("dev from the environment: got %v, %q, %q and secure cookies %v", cfg.Dev, cfg.Templates, cfg.Static, cfg.SecureCookies)
+	}
+	t.Setenv("DEV", "")
+	t.Setenv("SECURE_COOKIES", "false")
+	if cfg, err = LoadConfig(nil); err != nil || cfg.SecureCookies {
+		t.Errorf("SECURE_COOKIES=false: got %v, %v", cfg.SecureCookies, err)
+	}
+	t.Setenv("SECURE_COOKIES", "")
+	if cfg, err = LoadConfig([]string{"-dev"}); err != nil || !cfg.Dev || cfg.Templates != "web/views/*.html" {
+		t.Errorf("-dev: got %+v, %v", cfg, err)
+	}
+	if _, err := LoadConfig([]string{"-bogus"}); err == nil {
+		t.Error("loaded with an unknown flag")
+	}
+	if _, err := LoadConfig([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Error("loaded a missing config file")
+	}
+}
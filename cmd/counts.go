@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"reddit-clone/internal/handlers"
+)
+
+// Counts runs "counts check", the default, which lists the posts and
+// comments whose stored vote or comment counts have drifted from the rows
+// they count, or "counts fix", which also corrects them.
+func Counts(cfg Config, args []string) error {
+	if cfg.DB.Driver == "memory" {
+		return errors.New("the memory store does not outlive this command")
+	}
+	action := "check"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if action != "check" && action != "fix" {
+		return fmt.Errorf("unknown action %q, want check or fix", action)
+	}
+	if err := OpenStore(cfg); err != nil {
+		return err
+	}
+	defer handlers.Store.Close()
+	mismatches, err := handlers.CheckCounts(context.Background(), action == "fix")
+	for _, m := range mismatches {
+		target := m.TopicID + "/" + m.PostID
+		if m.CommentID != "" {
+			target += "/" + m.CommentID
+		}
+		fmt.Printf("%s\t%s\tstored %d\tactual %d\n", target, m.Column, m.Stored, m.Actual)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("checked counts", "mismatches", len(mismatches), "fixed", action == "fix")
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/handlers"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestCounts checks and fixes the counts of a seeded database after one
+// post's comment count is corrupted.
+func TestCounts(t *testing.T) {
+	saved := handlers.Store
+	t.Cleanup(func() { handlers.Store = saved })
+	cfg := DefaultConfig()
+	cfg.DB.DSN = filepath.Join(t.TempDir(), "test.db")
+	if err := Seed(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	counts := func(action string) string {
+		t.Helper()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		err = Counts(cfg, []string{action})
+		os.Stdout = stdout
+		w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := io.ReadAll(r)
+		return string(out)
+	}
+	if got := counts("check"); got != "" {
+		t.Errorf("check a freshly seeded database: got %q", got)
+	}
+
+	if err := OpenStore(cfg); err != nil {
+		t.Fatal(err)
+	}
+	posts, err := store.Find(context.Background(), handlers.Store, models.Post{TopicID: "golang"}, store.OrderBy("id"))
+	if err == nil && len(posts) > 0 {
+		err = handlers.Store.Update(context.Background(), &posts[0], map[string]any{"comment_count": posts[0].CommentCount + 7})
+	}
+	handlers.Store.Close()
+	if err != nil || len(posts) == 0 {
+		t.Fatalf("corrupt a post: %v", err)
+	}
+	want := "golang/" + posts[0].ID + "\tcomment_count\tstored "
+	if got := counts("check"); !strings.HasPrefix(got, want) || strings.Count(got, "\n") != 1 {
+		t.Errorf("check: got %q, want a line starting %q", got, want)
+	}
+	if got := counts("fix"); !strings.HasPrefix(got, want) {
+		t.Errorf("fix: got %q", got)
+	}
+	if got := counts("check"); got != "" {
+		t.Errorf("check after the fix: got %q", got)
+	}
+
+	if err := Counts(cfg, []string{"recount"}); err == nil {
+		t.Error("ran an unknown action")
+	}
+	cfg.DB.Driver = "memory"
+	if err := Counts(cfg, nil); err == nil {
+		t.Error("checked the memory store")
+	}
+}
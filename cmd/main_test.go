@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain runs main instead of the tests when a test starts the binary as
+// a server, with the arguments in SERVER_ARGS.
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("SERVER_ARGS"); ok {
+		os.Args = append(os.Args[:1], strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// startServer runs main in a child process with args and waits until it
+// accepts connections on the address it returns.
+func startServer(t *testing.T, args ...string) (*exec.Cmd, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	args = append(args, "-addr", addr, "-db-dsn", filepath.Join(t.TempDir(), "test.db"))
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "SERVER_ARGS="+strings.Join(args, " "))
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill() })
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return cmd, addr
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the server did not start on %s", addr)
+		}
+	}
+}
+
+// TestServeEmbedded serves pages and the stylesheet from the files embedded
+// in the binary, with no web directory in the working directory.
+func TestServeEmbedded(t *testing.T) {
+	_, addr := startServer(t)
+	for path, want := range map[string]string{"/login": `href="/static/style.css"`, "/static/style.css": "body"} {
+		res, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("%s: got %d, missing %s", path, res.StatusCode, want)
+		}
+	}
+}
+
+// TestShutdown sends SIGTERM while a request is still uploading its body,
+// and checks the server finishes it within the timeout and gives up on it
+// past the timeout.
+func TestShutdown(t *testing.T) {
+	body := `{"username":"alice","password":"password"}`
+	startRequest := func(t *testing.T, addr string) net.Conn {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		fmt.Fprintf(conn, "POST /v1/token HTTP/1.1\r\nHost: %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", addr, len(body), body[:10])
+		time.Sleep(100 * time.Millisecond)
+		return conn
+	}
+	exited := func(cmd *exec.Cmd) chan error {
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		return done
+	}
+
+	t.Run("drains", func(t *testing.T) {
+		cmd, addr := startServer(t, "-shutdown-timeout", "30s")
+		conn := startRequest(t, addr)
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+		done := exited(cmd)
+		time.Sleep(300 * time.Millisecond)
+		select {
+		case err := <-done:
+			t.Fatalf("exited with a request in flight: %v", err)
+		default:
+		}
+		fmt.Fprint(conn, body[10:])
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("the request in flight was dropped: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("the request in flight: got %d, want 401", res.StatusCode)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("exit: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("did not exit once the request finished")
+		}
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		cmd, addr := startServer(t, "-shutdown-timeout", "200ms")
+		startRequest(t, addr)
+		start := time.Now()
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-exited(cmd):
+			if err != nil {
+				t.Errorf("exit: %v", err)
+			}
+			if d := time.Since(start); d < 200*time.Millisecond {
+				t.Errorf("exited after %v, before the timeout", d)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("did not exit after the timeout")
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"reddit-clone/internal/store"
+)
+
+// Migrate runs "migrate up", the default, "migrate down" or "migrate status"
+// against the configured database.
+func Migrate(cfg Config, args []string) error {
+	if cfg.DB.Driver == "memory" {
+		return errors.New("the memory store has no schema to migrate")
+	}
+	s, err := store.Open(cfg.DB.Driver, cfg.DB.DSN, cfg.DB.Options)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "up":
+		return s.Migrate()
+	case "down":
+		return s.Rollback()
+	case "status":
+		states, err := s.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", state.Version, state.Name, applied)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown action %q, want up, down or status", action)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/store/migrations"
+)
+
+// TestMigrate runs the migrate command's actions against a new database.
+func TestMigrate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DB.DSN = filepath.Join(t.TempDir(), "test.db")
+	status := func() string {
+		t.Helper()
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		err = Migrate(cfg, []string{"status"})
+		os.Stdout = stdout
+		w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := io.ReadAll(r)
+		return string(out)
+	}
+	var pending strings.Builder
+	for _, m := range migrations.All {
+		fmt.Fprintf(&pending, "%04d_%s\tpending\n", m.Version, m.Name)
+	}
+	if got := status(); got != pending.String() {
+		t.Errorf("status of a new database: got %q", got)
+	}
+	if err := Migrate(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); !strings.HasPrefix(got, "0001_initial\tapplied ") {
+		t.Errorf("status after migrating: got %q", got)
+	}
+	for range migrations.All {
+		if err := Migrate(cfg, []string{"down"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Migrate(cfg, []string{"down"}); err == nil {
+		t.Error("rolled back with nothing applied")
+	}
+	if err := Migrate(cfg, []string{"sideways"}); err == nil {
+		t.Error("ran an unknown action")
+	}
+	cfg.DB.Driver = "memory"
+	if err := Migrate(cfg, nil); err == nil {
+		t.Error("migrated the memory store")
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+
+	"reddit-clone/internal/handlers"
+)
+
+// Seed fills the database with sample data. The memory store only lives as
+// long as the process, so with it the seeded site is served rather than
+// thrown away.
+func Seed(cfg Config, _ []string) error {
+	if err := OpenStore(cfg); err != nil {
+		return err
+	}
+	if err := handlers.Seed(context.Background()); err != nil {
+		return err
+	}
+	if cfg.DB.Driver == "memory" {
+		return serve(cfg)
+	}
+	return handlers.Store.Close()
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+
+	"reddit-clone/internal/events"
+	"reddit-clone/internal/handlers"
+	"reddit-clone/internal/store"
+	"reddit-clone/internal/tracing"
+	"reddit-clone/web"
+)
+
+// RedisPrefix namespaces the keys and channels replicas share in Redis.
+const RedisPrefix = "reddit-clone:"
+
+// CacheChannel is where replicas announce writes that empty their caches.
+const CacheChannel = "store:cache"
+
+// Serve serves the site until it is interrupted.
+func Serve(cfg Config, _ []string) error {
+	if err := OpenStore(cfg); err != nil {
+		return err
+	}
+	return serve(cfg)
+}
+
+// OpenStore opens the configured store as handlers.Store, migrating it
+// unless that is turned off.
+func OpenStore(cfg Config) error {
+	if cfg.DB.Driver == "memory" {
+		slog.Warn("using the in-memory store, data will not survive a restart")
+		handlers.Store = store.NewMemoryStore()
+		return nil
+	}
+	s, err := store.Open(cfg.DB.Driver, cfg.DB.DSN, cfg.DB.Options)
+	if err != nil {
+		return err
+	}
+	migrated := true
+	if !cfg.DB.AutoMigrate {
+		if err := s.Migrated(context.Background()); err != nil {
+			slog.Warn("the database schema is out of date, run the migrate command", "error", err)
+			migrated = false
+		}
+	} else if err := s.Migrate(); err != nil {
+		return err
+	}
+	if !cfg.Features.Search {
+		slog.Info("full-text search disabled by config")
+	} else if err := s.SetupSearch(); err != nil {
+		slog.Warn("full-text search disabled", "error", err)
+	}
+	handlers.Store = s
+	if !migrated {
+		return nil
+	}
+	// Posts written under other title rules would not be found as
+	// duplicates of those submitted under these.
+	if n, err := handlers.RekeyTitles(context.Background()); err != nil {
+		return fmt.Errorf("rekey titles: %w", err)
+	} else if n > 0 {
+		slog.Info("remade duplicate keys for the new title rules", "posts", n)
+	}
+	// Feeds would rank posts scored under another half-life apart from
+	// those scored under this one.
+	if n, err := handlers.RescoreDecay(context.Background()); err != nil {
+		return fmt.Errorf("rescore decay: %w", err)
+	} else if n > 0 {
+		slog.Info("recomputed decayed scores for the new half-life", "posts", n)
+	}
+	return nil
+}
+
+// loadTemplates parses the embedded templates, which are what the binary
+// was built with, or those matching the templates glob.
+func loadTemplates(cfg Config) (*template.Template, error) {
+	templates := template.New("").Funcs(handlers.TemplateFuncs)
+	if cfg.Templates != "" {
+		return templates.ParseGlob(cfg.Templates)
+	}
+	return templates.ParseFS(web.FS, "views/*.html")
+}
+
+// openRedis connects to the Redis replicas share live events, rate limits
+// and cache invalidations through.
+func openRedis(url string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), client.Options().DialTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	return client, nil
+}
+
+// shareCache has a write on any replica empty the caches of all of them.
+func shareCache(cached *store.CachedStore) {
+	writes, _ := handlers.Events.Subscribe(CacheChannel)
+	cached.Changed = func() { handlers.Events.Publish(CacheChannel, events.Event{Type: "write"}) }
+	go func() {
+		for range writes {
+			cached.Invalidate()
+		}
+	}()
+}
+
+// serve serves the site from handlers.Store, closing it on the way out.
+func serve(cfg Config) error {
+	if cfg.DB.Cache.Size > 0 && cfg.DB.Cache.TTL > 0 {
+		handlers.Store = store.NewCachedStore(handlers.Store, cfg.DB.Cache)
+	}
+	handlers.Features = cfg.Features
+	handlers.BaseURL = cfg.BaseURL
+	handlers.SecureCookies = cfg.SecureCookies
+	handlers.Admins = cfg.Admins
+	handlers.EditGrace = cfg.EditGrace
+	handlers.MaxPinnedPosts = cfg.MaxPinnedPosts
+	handlers.Sitemap = cfg.Sitemap
+	handlers.TopicHealth = cfg.TopicHealth
+	handlers.Previews = cfg.Previews
+	handlers.Media = cfg.Media
+	mediaStore, err := cfg.Media.Store()
+	if err != nil {
+		return err
+	}
+	handlers.MediaStore = mediaStore
+	if handlers.ClientIP, err = handlers.TrustProxies(cfg.TrustedProxies); err != nil {
+		return err
+	}
+	handlers.Events = events.NewHub()
+	if cfg.RedisURL != "" {
+		client, err := openRedis(cfg.RedisURL)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		handlers.Redis = client
+		handlers.Events = events.NewRedisBroker(client, RedisPrefix)
+		if cached, ok := handlers.Store.(*store.CachedStore); ok {
+			shareCache(cached)
+		}
+	}
+	handlers.RateLimits = cfg.RateLimit
+	if cfg.RateLimit.Enabled && handlers.Redis != nil {
+		handlers.RateLimiter = handlers.NewRedisLimiter(handlers.Redis, RedisPrefix)
+	} else if cfg.RateLimit.Enabled {
+		handlers.RateLimiter = handlers.NewMemoryLimiter()
+	}
+	if cfg.JWTSecret != "" {
+		handlers.JWTSecret = []byte(cfg.JWTSecret)
+	} else {
+		handlers.JWTSecret = make([]byte, 32)
+		if _, err := rand.Read(handlers.JWTSecret); err != nil {
+			return err
+		}
+		slog.Warn("JWT_SECRET is not set, issued tokens will not survive a restart")
+	}
+	handlers.ConfigureOAuth(cfg.BaseURL, cfg.OAuth)
+	stopTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.Endpoint != "" {
+		if stopTracing, err = tracing.Setup(context.Background(), cfg.Tracing); err != nil {
+			return err
+		}
+	}
+	templates, err := loadTemplates(cfg)
+	if err != nil {
+		return err
+	}
+	t := &handlers.Template{Templates: templates}
+	if cfg.Dev {
+		slog.Warn("development mode, templates are parsed on every render")
+		t.Reload = func() (*template.Template, error) { return loadTemplates(cfg) }
+	}
+	handlers.Static, err = fs.Sub(web.FS, "static")
+	if cfg.Static != "" {
+		handlers.Static, err = os.DirFS(cfg.Static), nil
+	}
+	if err != nil {
+		return err
+	}
+	e := echo.New()
+	e.Renderer = t
+	e.Use(middleware.Recover())
+	handlers.Register(e)
+	e.Server.RegisterOnShutdown(handlers.Events.Close)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go handlers.RunPurger(ctx, cfg.Purge)
+	go handlers.RunReportArchiver(ctx, cfg.ReportArchive)
+	go handlers.RunTrending(ctx, cfg.Trending)
+	handlers.Views = handlers.NewViewCounter(cfg.Views.Window)
+	go handlers.RunViewFlusher(ctx, cfg.Views)
+	go func() {
+		if err := e.Start(cfg.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", cfg.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Error("failed to drain connections", "error", err)
+	}
+	if err := handlers.Views.Flush(ctx, time.Now()); err != nil {
+		slog.Error("failed to write the remaining post views", "error", err)
+	}
+	if err := handlers.Store.Close(); err != nil {
+		slog.Error("failed to close the database", "error", err)
+	}
+	if err := stopTracing(ctx); err != nil {
+		slog.Error("failed to export the remaining spans", "error", err)
+	}
+	return nil
+}
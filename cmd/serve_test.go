@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/handlers"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestOpenStoreRekeysTitles opens a seeded database under other title rules
+// and checks the posts' duplicate keys were remade for them.
+func TestOpenStoreRekeysTitles(t *testing.T) {
+	saved, rules := handlers.Store, models.TitleRules
+	t.Cleanup(func() { handlers.Store, models.TitleRules = saved, rules })
+	cfg := DefaultConfig()
+	cfg.DB.DSN = filepath.Join(t.TempDir(), "test.db")
+	if err := Seed(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	models.TitleRules = models.TitleNormalization{CollapseWhitespace: true}
+	if err := OpenStore(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer handlers.Store.Close()
+	posts, err := store.Find(context.Background(), handlers.Store, models.Post{}, store.Unscoped())
+	if err != nil || len(posts) == 0 {
+		t.Fatalf("seeded posts: got %d, %v", len(posts), err)
+	}
+	for _, post := range posts {
+		if want := strings.Join(strings.Fields(post.Title), " "); post.NormalizedTitle != want {
+			t.Errorf("key of %s: got %q, want %q", post.ID, post.NormalizedTitle, want)
+		}
+	}
+}
+
+// TestOpenStoreRescoresDecay opens a seeded database with a half-life
+// configured and checks the posts were scored for it.
+func TestOpenStoreRescoresDecay(t *testing.T) {
+	saved, decay := handlers.Store, models.Decay
+	t.Cleanup(func() { handlers.Store, models.Decay = saved, decay })
+	cfg := DefaultConfig()
+	cfg.DB.DSN = filepath.Join(t.TempDir(), "test.db")
+	if err := Seed(cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	models.Decay = models.ScoreDecay{HalfLife: 6 * time.Hour}
+	if err := OpenStore(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer handlers.Store.Close()
+	posts, err := store.Find(context.Background(), handlers.Store, models.Post{}, store.Unscoped())
+	if err != nil || len(posts) == 0 {
+		t.Fatalf("seeded posts: got %d, %v", len(posts), err)
+	}
+	for _, post := range posts {
+		if want := models.Decayed(post.Votes, post.CreatedAt, 6*time.Hour); post.DecayedScore != want {
+			t.Errorf("score of %s: got %v, want %v", post.ID, post.DecayedScore, want)
+		}
+	}
+}
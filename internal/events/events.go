@@ -0,0 +1,77 @@
+package events
+
+import "sync"
+
+// SubscriberBuffer is how many events a subscriber may fall behind before
+// further events to it are dropped.
+const SubscriberBuffer = 16
+
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// Broker fans events out to the subscribers of a channel. Subscribe returns
+// the events and a function that ends the subscription; Close ends every
+// subscription so long-lived streams return.
+type Broker interface {
+	Publish(channel string, event Event)
+	Subscribe(channel string) (<-chan Event, func())
+	Close()
+}
+
+// Hub is an in-process Broker.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan Event]struct{}
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[string]map[chan Event]struct{}{}}
+}
+func (h *Hub) Publish(channel string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[channel] {
+		select {
+		case sub <- event:
+		default:
+		}
+	}
+}
+func (h *Hub) Subscribe(channel string) (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := make(chan Event, SubscriberBuffer)
+	if h.closed {
+		close(sub)
+		return sub, func() {}
+	}
+	if h.subs[channel] == nil {
+		h.subs[channel] = map[chan Event]struct{}{}
+	}
+	h.subs[channel][sub] = struct{}{}
+	return sub, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[channel][sub]; ok {
+			delete(h.subs[channel], sub)
+			if len(h.subs[channel]) == 0 {
+				delete(h.subs, channel)
+			}
+			close(sub)
+		}
+	}
+}
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for sub := range subs {
+			close(sub)
+		}
+	}
+	h.subs = map[string]map[chan Event]struct{}{}
+	h.closed = true
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"testing"
+)
+
+// TestHub subscribes to a channel and checks events reach only its
+// subscribers, a slow subscriber loses the overflow, and cancelling or
+// closing ends the subscriptions.
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	golang, cancelGolang := hub.Subscribe("post:golang/p1")
+	rust, cancelRust := hub.Subscribe("post:rust/p1")
+	defer cancelRust()
+
+	hub.Publish("post:golang/p1", Event{Type: "comment", Data: "c1"})
+	if event := <-golang; event.Type != "comment" || event.Data != "c1" {
+		t.Errorf("got %+v", event)
+	}
+	select {
+	case event := <-rust:
+		t.Errorf("another channel's subscriber got %+v", event)
+	default:
+	}
+
+	for i := range SubscriberBuffer + 5 {
+		hub.Publish("post:golang/p1", Event{Type: "comment", Data: i})
+	}
+	if len(golang) != SubscriberBuffer {
+		t.Errorf("a subscriber that fell behind holds %d events, want %d", len(golang), SubscriberBuffer)
+	}
+	cancelGolang()
+	cancelGolang()
+	for range golang {
+	}
+	hub.Publish("post:golang/p1", Event{Type: "comment"})
+
+	hub.Close()
+	if _, ok := <-rust; ok {
+		t.Error("Close left a subscription open")
+	}
+	late, cancel := hub.Subscribe("post:rust/p1")
+	defer cancel()
+	if _, ok := <-late; ok {
+		t.Error("subscribed to a closed hub")
+	}
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PublishTimeout bounds how long publishing an event may hold up the
+// request that caused it.
+const PublishTimeout = 5 * time.Second
+
+// RedisBroker is a Broker shared by every replica publishing to the same
+// Redis. Events go out through Redis, this replica's own included, and
+// arrive from it into a local Hub that subscribers read from. Their Data
+// arrives as json.RawMessage. The client subscribes again by itself after
+// losing its connection; events published meanwhile are lost, as live
+// updates are best effort.
+type RedisBroker struct {
+	client *redis.Client
+	prefix string
+	hub    *Hub
+	sub    *redis.PubSub
+}
+
+func NewRedisBroker(client *redis.Client, prefix string) *RedisBroker {
+	b := &RedisBroker{client: client, prefix: prefix, hub: NewHub(), sub: client.PSubscribe(context.Background(), prefix+"*")}
+	go b.run()
+	return b
+}
+func (b *RedisBroker) Publish(channel string, event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("failed to encode an event", "channel", channel, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), PublishTimeout)
+	defer cancel()
+	if err := b.client.Publish(ctx, b.prefix+channel, data).Err(); err != nil {
+		slog.Warn("failed to publish an event to redis", "channel", channel, "error", err)
+	}
+}
+func (b *RedisBroker) Subscribe(channel string) (<-chan Event, func()) {
+	return b.hub.Subscribe(channel)
+}
+func (b *RedisBroker) Close() {
+	b.sub.Close()
+	b.hub.Close()
+}
+
+// run hands the events arriving from Redis to the local Hub until the
+// subscription is closed.
+func (b *RedisBroker) run() {
+	for msg := range b.sub.Channel() {
+		var event struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			continue
+		}
+		b.hub.Publish(strings.TrimPrefix(msg.Channel, b.prefix), Event{Type: event.Type, Data: event.Data})
+	}
+}
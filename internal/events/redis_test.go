@@ -0,0 +1,45 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// TestRedisBroker publishes through one broker and receives through
+// another, as two replicas sharing a Redis would.
+func TestRedisBroker(t *testing.T) {
+	server := miniredis.RunT(t)
+	broker := func() *RedisBroker {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		b := NewRedisBroker(client, "test:")
+		t.Cleanup(func() {
+			b.Close()
+			client.Close()
+		})
+		return b
+	}
+	publisher, subscriber := broker(), broker()
+	events, cancel := subscriber.Subscribe("topic:golang")
+	defer cancel()
+	// Wait for both pattern subscriptions to be in place.
+	for deadline := time.Now().Add(5 * time.Second); server.PubSubNumPat() < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the brokers did not subscribe")
+		}
+	}
+	publisher.Publish("topic:books", Event{Type: "post", Data: map[string]string{"id": "p0"}})
+	publisher.Publish("topic:golang", Event{Type: "post", Data: map[string]string{"id": "p1"}})
+	select {
+	case event := <-events:
+		data, _ := event.Data.(json.RawMessage)
+		if event.Type != "post" || string(data) != `{"id":"p1"}` {
+			t.Errorf("got %s %s", event.Type, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event arrived")
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrBanAdmin = NewError(Forbidden, "ban_admin", "site admins cannot be banned")
+
+type BanRequest struct {
+	Username string `param:"username"`
+}
+type AdminUsersRequest struct {
+	models.PageRequest
+	Query string `query:"q"`
+}
+
+// SiteStats counts what the site holds, and what was added in the last day.
+type SiteStats struct {
+	Users         int64           `json:"users"`
+	Topics        int64           `json:"topics"`
+	Posts         int64           `json:"posts"`
+	Comments      int64           `json:"comments"`
+	OpenReports   int64           `json:"openReports"`
+	BannedUsers   int64           `json:"bannedUsers"`
+	NewUsers      int64           `json:"newUsers"`
+	NewPosts      int64           `json:"newPosts"`
+	NewComments   int64           `json:"newComments"`
+	RecentReports []models.Report `json:"-"`
+}
+
+func Stats(c context.Context, _ struct{}) (*SiteStats, error) {
+	if err := Administer(c); err != nil {
+		return nil, err
+	}
+	day := store.Where("created_at", ">", time.Now().Add(-24*time.Hour))
+	stats := &SiteStats{}
+	for _, count := range []struct {
+		dest  *int64
+		model any
+		id    any
+		scope store.Scope
+	}{
+		{&stats.Users, &models.User{}, nil, nil},
+		{&stats.Topics, &models.Topic{}, nil, nil},
+		{&stats.Posts, &models.Post{}, nil, nil},
+		{&stats.Comments, &models.Comment{}, nil, nil},
+		{&stats.OpenReports, &models.Report{}, &models.Report{Status: models.ReportOpen}, nil},
+		{&stats.BannedUsers, &models.User{}, &models.User{Banned: true}, nil},
+		{&stats.NewUsers, &models.User{}, nil, day},
+		{&stats.NewPosts, &models.Post{}, nil, day},
+		{&stats.NewComments, &models.Comment{}, nil, day},
+	} {
+		var scopes []store.Scope
+		if count.scope != nil {
+			scopes = append(scopes, count.scope)
+		}
+		var err error
+		if *count.dest, err = Store.Count(c, count.model, count.id, scopes...); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// AdminUsers lists every user, newest first, or those whose name starts
+// with the query.
+func AdminUsers(c context.Context, req AdminUsersRequest) (*models.ListResponse[models.User], error) {
+	if err := Administer(c); err != nil {
+		return nil, err
+	}
+	scopes := []store.Scope{store.OrderBy("created_at DESC")}
+	if req.Query != "" {
+		// Usernames only use characters that sort before '~'.
+		scopes = append(scopes, store.Where("username", ">=", req.Query), store.Where("username", "<", req.Query+"~"))
+	}
+	return store.List(c, Store, models.User{}, req.PageRequest, scopes...)
+}
+
+// RecentReports lists the open reports of every topic, newest first, with
+// the reported content.
+func RecentReports(c context.Context, req models.PageRequest) (*models.ListResponse[models.Report], error) {
+	if err := Administer(c); err != nil {
+		return nil, err
+	}
+	list, err := store.List(c, Store, models.Report{Status: models.ReportOpen}, req, store.Preload("Reporter"), store.OrderBy("created_at DESC"))
+	if err != nil {
+		return nil, err
+	}
+	return list, reportTargets(c, list.Items)
+}
+
+// Ban bans or unbans a user. Banned users are logged out everywhere and
+// cannot log in again; their content stays up.
+func Ban(ban bool) func(context.Context, BanRequest) (*models.User, error) {
+	return func(c context.Context, req BanRequest) (*models.User, error) {
+		if err := Administer(c); err != nil {
+			return nil, err
+		}
+		user, err := UserByName(c, req.Username)
+		if err != nil {
+			return nil, err
+		} else if ban && IsAdmin(user) {
+			return nil, ErrBanAdmin
+		}
+		return nil, SetBanned(c, user, ban)
+	}
+}
+
+// SetBanned bans or unbans user without checking who asked, for callers
+// that have already done so, like the admin command.
+func SetBanned(c context.Context, user *models.User, ban bool) error {
+	return Store.Transaction(c, func(tx store.Store) error {
+		if err := tx.Update(c, user, map[string]any{"banned": ban}); err != nil {
+			return err
+		}
+		if !ban {
+			return nil
+		}
+		_, err := store.Delete(c, tx, models.Session{UserID: user.ID})
+		return err
+	})
+}
+func HandleAdmin(c echo.Context) error {
+	stats, err := Stats(c.Request().Context(), struct{}{})
+	if err != nil {
+		return Fail(c, err)
+	}
+	reports, err := RecentReports(c.Request().Context(), models.PageRequest{Limit: 10})
+	if err != nil {
+		return Fail(c, err)
+	}
+	stats.RecentReports = reports.Items
+	return c.Render(http.StatusOK, "admin", stats)
+}
+func HandleAdminUsers(c echo.Context) error {
+	var req AdminUsersRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := AdminUsers(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "adminusers", list)
+}
+func HandleAdminTopics(c echo.Context) error {
+	if err := Administer(c.Request().Context()); err != nil {
+		return Fail(c, err)
+	}
+	var req models.PageRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := store.List(c.Request().Context(), Store, models.Topic{}, req, store.OrderBy("created_at DESC"))
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "admintopics", list)
+}
+func HandleAdminReports(c echo.Context) error {
+	var req models.PageRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := RecentReports(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "adminreports", list)
+}
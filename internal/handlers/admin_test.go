@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestAdmin reads the dashboard's stats, users and reports, and bans and
+// unbans a user.
+func TestAdmin(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"alice"}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	bobby, _ := newUser(t, "bobby")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Spam"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "More spam"},
+		&models.Report{Model: models.Model{ID: "r1"}, TopicID: "golang", PostID: "p1", ReporterID: bobby.ID, Reason: "spam", Status: models.ReportOpen},
+		&models.Report{Model: models.Model{ID: "r2"}, TopicID: "golang", PostID: "p1", ReporterID: alice.ID, Reason: "old", Status: models.ReportApproved},
+	)
+
+	for _, path := range []string{"/v1/admin/stats", "/v1/admin/users", "/v1/admin/reports"} {
+		if rec := call(t, e, http.MethodGet, path, "", nil, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s signed out: got %d", path, rec.Code)
+		}
+		if rec := call(t, e, http.MethodGet, path, bobToken, nil, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("%s as a non-admin: got %d", path, rec.Code)
+		}
+	}
+	stats := func() SiteStats {
+		t.Helper()
+		var stats SiteStats
+		if rec := call(t, e, http.MethodGet, "/v1/admin/stats", aliceToken, nil, &stats); rec.Code != http.StatusOK {
+			t.Fatalf("stats: %d", rec.Code)
+		}
+		return stats
+	}
+	if got := stats(); fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", SiteStats{Users: 3, Topics: 1, Posts: 1, Comments: 1, OpenReports: 1, NewUsers: 3, NewPosts: 1, NewComments: 1}) {
+		t.Errorf("stats: got %+v", got)
+	}
+	usernames := func(query string) string {
+		t.Helper()
+		var users models.ListResponse[models.User]
+		call(t, e, http.MethodGet, "/v1/admin/users"+query, aliceToken, nil, &users)
+		var names []string
+		for _, user := range users.Items {
+			names = append(names, user.Username)
+		}
+		return fmt.Sprint(names)
+	}
+	if got := usernames(""); got != "[bobby bob alice]" {
+		t.Errorf("users: got %s", got)
+	}
+	if got := usernames("?q=bo"); got != "[bobby bob]" {
+		t.Errorf("users starting with bo: got %s", got)
+	}
+	var reports models.ListResponse[models.Report]
+	call(t, e, http.MethodGet, "/v1/admin/reports", aliceToken, nil, &reports)
+	if len(reports.Items) != 1 || reports.Items[0].Post == nil || reports.Items[0].Post.Title != "Spam" {
+		t.Errorf("open reports: got %+v", reports.Items)
+	}
+
+	bobCookie := login(t, bob)
+	if rec := call(t, e, http.MethodPut, "/v1/users/bob/ban", bobToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("ban as a non-admin: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodPut, "/v1/users/alice/ban", aliceToken, nil, nil); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "ban_admin") {
+		t.Errorf("ban an admin: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodPut, "/v1/users/nobody/ban", aliceToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("ban an unknown user: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodPut, "/v1/users/bob/ban", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("ban bob: got %d %s", rec.Code, rec.Body)
+	}
+	post := map[string]any{"model": map[string]any{"title": "Banned"}}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, post, nil); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"banned"`) {
+		t.Errorf("post with a banned user's token: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/token", "", LoginRequest{Username: "bob", Password: "password"}, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("token for a banned user: got %d", rec.Code)
+	}
+	if rec := postForm(e, "/login", url.Values{"username": {"bob"}, "password": {"password"}}); rec.Code != http.StatusForbidden {
+		t.Errorf("log in as a banned user: got %d", rec.Code)
+	}
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Banned"}}, bobCookie); rec.Code != http.StatusUnauthorized {
+		t.Errorf("post with a banned user's session: got %d", rec.Code)
+	}
+	if got := stats(); got.BannedUsers != 1 {
+		t.Errorf("banned users: got %d", got.BannedUsers)
+	}
+	if rec := call(t, e, http.MethodDelete, "/v1/users/bob/ban", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("unban bob: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, post, nil); rec.Code != http.StatusCreated {
+		t.Errorf("post after the unban: got %d %s", rec.Code, rec.Body)
+	}
+
+	page := func(path string, user *models.User) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(login(t, user))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	for path, want := range map[string]string{
+		"/admin":           `<td>Open reports</td><td>1</td>`,
+		"/admin/users?q=b": `data-url="/admin/users/bobby/ban"`,
+		"/admin/topics":    `data-url="/admin/topics/golang/delete"`,
+		"/admin/reports":   `data-url="/topics/golang/modqueue/r1/approve"`,
+	} {
+		if rec := page(path, alice); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: got %d, missing %s: %s", path, rec.Code, want, rec.Body)
+		}
+		if rec := page(path, bob); rec.Code != http.StatusForbidden {
+			t.Errorf("%s as a non-admin: got %d", path, rec.Code)
+		}
+	}
+	if !strings.Contains(page("/", alice).Body.String(), `href="/admin"`) || strings.Contains(page("/", bob).Body.String(), `href="/admin"`) {
+		t.Error("the nav should link the dashboard for admins only")
+	}
+	if rec := postForm(e, "/admin/users/bobby/ban", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("ban through the page: got %d", rec.Code)
+	}
+	if rec := postForm(e, "/admin/topics/golang/delete", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("remove a topic through the page: got %d", rec.Code)
+	}
+	if got := stats(); got.Topics != 0 || got.BannedUsers != 1 {
+		t.Errorf("stats after the page actions: got %+v", got)
+	}
+}
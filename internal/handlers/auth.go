@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/crypto/bcrypt"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const (
+	MinPasswordLength = 8
+	SessionCookie     = "session"
+	CSRFCookie        = "_csrf"
+	SessionLifetime   = 30 * 24 * time.Hour
+	TokenLifetime     = 24 * time.Hour
+)
+
+type userKey struct{}
+
+type SignupRequest struct {
+	Username string `form:"username"`
+	Password string `form:"password"`
+}
+type LoginRequest struct {
+	Username string `form:"username" json:"username"`
+	Password string `form:"password" json:"password"`
+}
+type TokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+var ErrNotLoggedIn = NewError(Unauthorized, "not_logged_in", "you must be logged in")
+var ErrInvalidCredentials = NewError(Unauthorized, "invalid_credentials", "invalid username or password")
+var ErrInvalidToken = NewError(Unauthorized, "invalid_token", "invalid or expired token")
+var ErrForbidden = NewError(Forbidden, "forbidden", "only the author, the topic's moderators or site admins can change this")
+var ErrInvalidUsername = NewError(BadRequest, "invalid_username", "username must be 3-20 letters, digits, '-' or '_'")
+var ErrPasswordTooShort = NewError(BadRequest, "password_too_short", fmt.Sprintf("password must be at least %d characters", MinPasswordLength))
+var ErrUsernameTaken = NewError(Conflict, "username_taken", "username is already taken")
+var ErrBanned = NewError(Forbidden, "banned", "this account has been banned")
+var ErrInvalidCSRF = NewError(Forbidden, "invalid_csrf", "missing or invalid csrf token, reload the page and try again")
+var JWTSecret []byte
+
+// SecureCookies marks the session and OAuth state cookies Secure, so
+// browsers only send them over HTTPS. Serving over plain HTTP in
+// development needs it off.
+var SecureCookies = true
+
+// dummyHash is what a login for an unknown username is checked against, so
+// it takes as long as one with a wrong password and does not tell which
+// usernames exist.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not anyone's password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func ValidUsername(username string) bool {
+	return validName(username, 3, 20)
+}
+func CreateUser(c context.Context, username string, password string) (*models.User, error) {
+	if !ValidUsername(username) {
+		return nil, ErrInvalidUsername
+	}
+	if len(password) < MinPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return store.Create(c, Store, models.User{Model: models.Model{ID: uuid.NewString()}, Username: username, PasswordHash: hash})
+}
+func HandleSignup(c echo.Context) error {
+	var req SignupRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	user, err := CreateUser(c.Request().Context(), req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, store.ErrDuplicatedKey) {
+			return Fail(c, ErrUsernameTaken)
+		}
+		return Fail(c, err)
+	}
+	if err := StartSession(c, user); err != nil {
+		return Fail(c, err)
+	}
+	return c.JSON(http.StatusOK, user)
+}
+func CurrentUser(c context.Context) *models.User {
+	user, _ := c.Value(userKey{}).(*models.User)
+	return user
+}
+func WithUser(c context.Context, user *models.User) context.Context {
+	return context.WithValue(c, userKey{}, user)
+}
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+func CreateSession(c context.Context, user *models.User) (string, *models.Session, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	session, err := store.Create(c, Store, models.Session{Model: models.Model{ID: hashToken(token)}, UserID: user.ID, ExpiresAt: time.Now().Add(SessionLifetime)})
+	return token, session, err
+}
+func Authenticate(c context.Context, username string, password string) (*models.User, error) {
+	if username == "" {
+		return nil, ErrInvalidCredentials
+	}
+	user, err := store.Get(c, Store, models.User{Username: username})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	} else if user.Banned {
+		return nil, ErrBanned
+	}
+	return user, nil
+}
+func Sessions(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cookie, err := c.Cookie(SessionCookie)
+		if err != nil || cookie.Value == "" {
+			return next(c)
+		}
+		session, err := store.Get(c.Request().Context(), Store, models.Session{Model: models.Model{ID: hashToken(cookie.Value)}}, "User")
+		if err == nil && session.User != nil && !session.User.Banned && session.ExpiresAt.After(time.Now()) {
+			c.SetRequest(c.Request().WithContext(WithUser(c.Request().Context(), session.User)))
+		}
+		return next(c)
+	}
+}
+
+// CSRF guards the cookie authenticated routes. Pages read the token from
+// their csrf-token meta tag and send it as X-CSRF-Token or a _csrf field;
+// the v1 API authenticates with bearer tokens and is left out.
+var CSRF = middleware.CSRFWithConfig(middleware.CSRFConfig{
+	Skipper:        func(c echo.Context) bool { return strings.HasPrefix(c.Path(), "/v1/") },
+	TokenLookup:    "header:" + echo.HeaderXCSRFToken + ",form:" + CSRFCookie,
+	CookieName:     CSRFCookie,
+	CookiePath:     "/",
+	CookieHTTPOnly: true,
+	CookieSameSite: http.SameSiteLaxMode,
+	ErrorHandler: func(err error, c echo.Context) error {
+		return Fail(c, ErrInvalidCSRF)
+	},
+})
+
+func StartSession(c echo.Context, user *models.User) error {
+	if user.Banned {
+		return ErrBanned
+	}
+	if err := CheckEvasion(c.Request().Context(), user, c.RealIP()); err != nil {
+		logging.FromContext(c.Request().Context()).Error("failed to check for ban evasion", "user", user.ID, "error", err)
+	}
+	token, session, err := CreateSession(c.Request().Context(), user)
+	if err != nil {
+		return err
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+func HandleLogin(c echo.Context) error {
+	var req LoginRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	user, err := Authenticate(c.Request().Context(), req.Username, req.Password)
+	if err != nil {
+		return Fail(c, err)
+	}
+	if err := StartSession(c, user); err != nil {
+		return Fail(c, err)
+	}
+	return c.JSON(http.StatusOK, user)
+}
+func HandleLogout(c echo.Context) error {
+	if cookie, err := c.Cookie(SessionCookie); err == nil {
+		if _, err := store.Delete(c.Request().Context(), Store, models.Session{Model: models.Model{ID: hashToken(cookie.Value)}}); err != nil {
+			return Fail(c, err)
+		}
+	}
+	c.SetCookie(&http.Cookie{Name: SessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: SecureCookies, SameSite: http.SameSiteLaxMode})
+	return c.JSON(http.StatusOK, map[string]string{})
+}
+func IssueToken(user *models.User) (*TokenResponse, error) {
+	expiresAt := time.Now().Add(TokenLifetime)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   user.ID,
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString(JWTSecret)
+	return &TokenResponse{Token: token, ExpiresAt: expiresAt}, err
+}
+func ParseToken(c context.Context, token string) (*models.User, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	user, err := store.Get(c, Store, models.User{Model: models.Model{ID: claims.Subject}})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	} else if user.Banned {
+		return nil, ErrBanned
+	}
+	return user, nil
+}
+func JWTAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := WithUser(c.Request().Context(), nil)
+		if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				return Fail(c, ErrInvalidToken)
+			}
+			user, err := ParseToken(ctx, token)
+			if err != nil {
+				return Fail(c, err)
+			}
+			ctx = WithUser(ctx, user)
+		}
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
+
+// AdminOnly lets site admins through, signed in with a session or, for
+// tools like curl, a bearer token.
+func AdminOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	check := func(c echo.Context) error {
+		if err := Administer(c.Request().Context()); err != nil {
+			return Fail(c, err)
+		}
+		return next(c)
+	}
+	return func(c echo.Context) error {
+		if c.Request().Header.Get(echo.HeaderAuthorization) != "" {
+			return JWTAuth(check)(c)
+		}
+		return check(c)
+	}
+}
+func HandleToken(c echo.Context) error {
+	var req LoginRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	user, err := Authenticate(c.Request().Context(), req.Username, req.Password)
+	if err != nil {
+		return Fail(c, err)
+	}
+	if err := CheckEvasion(c.Request().Context(), user, c.RealIP()); err != nil {
+		logging.FromContext(c.Request().Context()).Error("failed to check for ban evasion", "user", user.ID, "error", err)
+	}
+	token, err := IssueToken(user)
+	if err != nil {
+		return Fail(c, err)
+	}
+	return c.JSON(http.StatusOK, token)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const MaxRuleNameLength = 100
+
+// AutomodSeverity ranks rule actions, so that when several rules match new
+// content the strongest one wins.
+var AutomodSeverity = map[string]int{models.AutomodFlag: 1, models.AutomodHold: 2, models.AutomodRemove: 3}
+
+type RuleRequest struct {
+	models.IDs
+	RuleID string `param:"ruleid"`
+}
+type UpdateRuleRequest struct {
+	RuleRequest
+	Mask models.AutomodRule `json:"updateMask"`
+}
+
+func (r UpdateRuleRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.Model("updateMask.", r.Mask, true)
+	return errs.Err()
+}
+func (e FieldErrors) AutomodRule(prefix string, rule models.AutomodRule, partial bool) {
+	e.Text(prefix+"name", rule.Name, MaxRuleNameLength, partial)
+	if !slices.Contains([]string{"", "post", "comment"}, rule.Applies) {
+		e[prefix+"applies"] = "must be post or comment, or empty for both"
+	}
+	if !slices.Contains([]string{"", "title", "content", "author"}, rule.Field) {
+		e[prefix+"field"] = "must be title, content or author"
+	}
+	if _, ok := AutomodSeverity[rule.Action]; !ok && (!partial || rule.Action != "") {
+		e[prefix+"action"] = "must be remove, hold or flag"
+	}
+	if _, err := regexp.Compile(rule.Pattern); err != nil {
+		e[prefix+"pattern"] = "must be a valid regular expression"
+	}
+	if rule.MinAccountDays < 0 {
+		e[prefix+"minAccountDays"] = "must not be negative"
+	}
+	if partial {
+		return
+	}
+	if rule.Field != "" && rule.Pattern == "" && len(rule.Keywords) == 0 {
+		e[prefix+"pattern"] = "or keywords are required to match a field"
+	} else if rule.Field == "" && rule.MinAccountDays == 0 && rule.MinKarma == nil {
+		e[prefix+"field"] = "or an account age or karma threshold is required"
+	}
+}
+
+// AutomodMatches reports whether a new post or comment meets every condition
+// of the rule. Keywords match whole words, ignoring case.
+func AutomodMatches(rule models.AutomodRule, kind string, title string, content string, author *models.User) bool {
+	if rule.Applies != "" && rule.Applies != kind {
+		return false
+	}
+	if rule.Field != "" {
+		text := map[string]string{"title": title, "content": content, "author": author.Username}[rule.Field]
+		matched := false
+		if re, err := regexp.Compile(rule.Pattern); err == nil && rule.Pattern != "" {
+			matched = re.MatchString(text)
+		}
+		if len(rule.Keywords) > 0 && !matched {
+			matched = keywordPattern(rule.Keywords).MatchString(text)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if rule.MinAccountDays > 0 && time.Since(author.CreatedAt) >= time.Duration(rule.MinAccountDays)*24*time.Hour {
+		return false
+	}
+	if rule.MinKarma != nil && author.PostKarma+author.CommentKarma >= *rule.MinKarma {
+		return false
+	}
+	return true
+}
+
+// keywordPattern matches any of the keywords as a whole word, ignoring case.
+func keywordPattern(keywords []string) *regexp.Regexp {
+	quoted := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		quoted[i] = regexp.QuoteMeta(keyword)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// Removed reports whether a post or comment was created already removed.
+func Removed(obj any) bool {
+	switch obj := obj.(type) {
+	case *models.Post:
+		return obj.DeletedAt.Valid
+	case *models.Comment:
+		return obj.DeletedAt.Valid
+	}
+	return false
+}
+
+// Submit creates a new post or comment, checking its topic exists and it
+// against blocks and the word and link filters, and running its topic's
+// AutoModerator rules in the same transaction. Removed and held content is created soft-deleted, and held or
+// flagged content is reported to the mod queue.
+func Submit(c context.Context, obj any, author *models.User) error {
+	var id models.IDs
+	var kind, title, content, link string
+	var deletedAt *gorm.DeletedAt
+	switch obj := obj.(type) {
+	case *models.Post:
+		id, kind, title, content, deletedAt = models.IDs{TopicID: obj.TopicID, PostID: obj.ID}, "post", obj.Title, obj.Content, &obj.DeletedAt
+		link = obj.URL
+		obj.Shadowbanned = author.Shadowbanned
+	case *models.Comment:
+		id, kind, content, deletedAt = models.IDs{TopicID: obj.TopicID, PostID: obj.PostID, CommentID: obj.ID}, "comment", obj.Content, &obj.DeletedAt
+		obj.Shadowbanned = author.Shadowbanned
+	default:
+		return Store.Create(c, obj)
+	}
+	return Store.Transaction(c, func(tx store.Store) error {
+		if comment, ok := obj.(*models.Comment); ok {
+			if err := CheckReply(c, tx, comment, author); err != nil {
+				return err
+			}
+			if err := CheckLocked(c, tx, comment.TopicID, comment.PostID); err != nil {
+				return err
+			}
+			if err := ThrottleBrigade(c, tx, comment, author); err != nil {
+				return err
+			}
+		}
+		if post, ok := obj.(*models.Post); ok {
+			if _, err := store.Get(c, tx, models.Topic{Model: models.Model{ID: post.TopicID}}); err != nil {
+				return err
+			}
+			if err := CheckMedia(c, tx, post, author); err != nil {
+				return err
+			}
+			if err := CheckFlair(c, tx, post); err != nil {
+				return err
+			}
+		}
+		filter, err := Filtered(c, tx, id.TopicID, title+"\n"+link+"\n"+content)
+		if err != nil {
+			return err
+		} else if filter != nil && filter.Action == models.FilterReject {
+			return ErrFiltered
+		}
+		rules, err := store.Find(c, tx, models.AutomodRule{TopicID: id.TopicID})
+		if err != nil {
+			return err
+		}
+		var rule *models.AutomodRule
+		for i := range rules {
+			if (rule == nil || AutomodSeverity[rules[i].Action] > AutomodSeverity[rule.Action]) && AutomodMatches(rules[i], kind, title, content, author) {
+				rule = &rules[i]
+			}
+		}
+		var action, reason string
+		if rule != nil {
+			action, reason = rule.Action, "AutoModerator: "+rule.Name
+		}
+		if filter != nil && AutomodSeverity[models.AutomodHold] > AutomodSeverity[action] {
+			action, reason = models.AutomodHold, "Filter: banned "+filter.Kind+" "+filter.Value
+		}
+		if action == models.AutomodRemove || action == models.AutomodHold {
+			*deletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		}
+		if err := tx.Create(c, obj); err != nil {
+			return err
+		}
+		if post, ok := obj.(*models.Post); ok {
+			if err := CreatePoll(c, tx, post); err != nil {
+				return err
+			}
+		}
+		if comment, ok := obj.(*models.Comment); ok {
+			if err := RecountComments(c, tx, comment.TopicID, comment.PostID); err != nil {
+				return err
+			}
+		}
+		if action == "" {
+			return nil
+		}
+		if action == models.AutomodRemove {
+			return tx.Create(c, &models.ModAction{Model: models.Model{ID: uuid.NewString()}, TopicID: id.TopicID, Action: models.ModRemove, TargetUserID: author.ID, PostID: id.PostID, CommentID: id.CommentID, Details: reason})
+		}
+		return tx.Create(c, &models.Report{Model: models.Model{ID: uuid.NewString()}, TopicID: id.TopicID, PostID: id.PostID, CommentID: id.CommentID, Reason: reason, Status: models.ReportOpen, Held: action == models.AutomodHold})
+	})
+}
+func AutomodRules(c context.Context, req ListRequest) (*models.ListResponse[models.AutomodRule], error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	return store.List(c, Store, models.AutomodRule{TopicID: req.TopicID}, req.PageRequest)
+}
+func CreateAutomodRule(c context.Context, req CreateRequest[models.AutomodRule]) (*models.AutomodRule, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	rule := req.Model
+	rule.Model, rule.TopicID = models.Model{ID: uuid.NewString()}, req.TopicID
+	return &rule, Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditAutomod, Details: "created rule " + rule.Name}, func(tx store.Store) error {
+		return tx.Create(c, &rule)
+	})
+}
+func UpdateAutomodRule(c context.Context, req UpdateRuleRequest) (*models.AutomodRule, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	rule, err := store.Get(c, Store, models.AutomodRule{Model: models.Model{ID: req.RuleID}, TopicID: req.TopicID})
+	if err != nil {
+		return nil, err
+	}
+	mask := req.Mask
+	mask.Model, mask.TopicID = models.Model{}, ""
+	updated := mergeRule(*rule, mask)
+	errs := FieldErrors{}
+	errs.AutomodRule("updateMask.", updated, false)
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	err = Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditAutomod, Details: "updated rule " + updated.Name}, func(tx store.Store) error {
+		return tx.Update(c, rule, mask)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(c, Store, models.AutomodRule{Model: models.Model{ID: req.RuleID}, TopicID: req.TopicID})
+}
+
+// mergeRule applies an update mask the way the store will, skipping zero
+// fields, so the rule can be validated as a whole first.
+func mergeRule(rule models.AutomodRule, mask models.AutomodRule) models.AutomodRule {
+	rule.Name = cmp.Or(mask.Name, rule.Name)
+	rule.Applies = cmp.Or(mask.Applies, rule.Applies)
+	rule.Field = cmp.Or(mask.Field, rule.Field)
+	rule.Pattern = cmp.Or(mask.Pattern, rule.Pattern)
+	rule.Action = cmp.Or(mask.Action, rule.Action)
+	rule.MinAccountDays = cmp.Or(mask.MinAccountDays, rule.MinAccountDays)
+	if mask.Keywords != nil {
+		rule.Keywords = mask.Keywords
+	}
+	if mask.MinKarma != nil {
+		rule.MinKarma = mask.MinKarma
+	}
+	return rule
+}
+func DeleteAutomodRule(c context.Context, req RuleRequest) (*models.AutomodRule, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	rule, err := store.Get(c, Store, models.AutomodRule{Model: models.Model{ID: req.RuleID}, TopicID: req.TopicID})
+	if err != nil {
+		return nil, err
+	}
+	return nil, Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditAutomod, Details: "deleted rule " + rule.Name}, func(tx store.Store) error {
+		_, err := store.Delete(c, tx, models.AutomodRule{Model: models.Model{ID: rule.ID}, TopicID: rule.TopicID})
+		return err
+	})
+}
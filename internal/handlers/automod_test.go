@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestAutomodMatches checks each rule condition on its own.
+func TestAutomodMatches(t *testing.T) {
+	low := 10
+	author := &models.User{Model: models.Model{CreatedAt: time.Now().Add(-48 * time.Hour)}, Username: "spambot", PostKarma: 3, CommentKarma: 4}
+	for _, tc := range []struct {
+		what  string
+		rule  models.AutomodRule
+		kind  string
+		title string
+		want  bool
+	}{
+		{"keyword", models.AutomodRule{Field: "title", Keywords: []string{"spam"}}, "post", "Buy SPAM now", true},
+		{"keyword inside a word", models.AutomodRule{Field: "title", Keywords: []string{"spam"}}, "post", "spammers", false},
+		{"keyword with regex characters", models.AutomodRule{Field: "title", Keywords: []string{"go.dev"}}, "post", "see go.dev", true},
+		{"keyword quoted", models.AutomodRule{Field: "title", Keywords: []string{"go.dev"}}, "post", "see goxdev", false},
+		{"pattern", models.AutomodRule{Field: "title", Pattern: `^\d+$`}, "post", "12345", true},
+		{"author", models.AutomodRule{Field: "author", Pattern: "bot$"}, "post", "", true},
+		{"wrong kind", models.AutomodRule{Applies: "comment", Field: "author", Pattern: "bot$"}, "post", "", false},
+		{"young account", models.AutomodRule{MinAccountDays: 3}, "post", "", true},
+		{"old enough account", models.AutomodRule{MinAccountDays: 2}, "post", "", false},
+		{"low karma", models.AutomodRule{MinKarma: &low}, "comment", "", true},
+		{"every condition must hold", models.AutomodRule{MinKarma: &low, Field: "title", Keywords: []string{"spam"}}, "post", "hello", false},
+	} {
+		if got := AutomodMatches(tc.rule, tc.kind, tc.title, "", author); got != tc.want {
+			t.Errorf("%s: got %v", tc.what, got)
+		}
+	}
+}
+
+// TestAutomod manages rules over v1 and submits posts and comments that
+// trip each action.
+func TestAutomod(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Welcome"},
+	)
+	rule := func(token string, r map[string]any, want int) models.AutomodRule {
+		t.Helper()
+		var created models.AutomodRule
+		if rec := call(t, e, http.MethodPost, "/v1/topics/golang/automod", token, map[string]any{"model": r}, &created); rec.Code != want {
+			t.Fatalf("create rule %v: got %d, want %d: %s", r["name"], rec.Code, want, rec.Body)
+		}
+		return created
+	}
+	rule(bobToken, map[string]any{"name": "mine", "minAccountDays": 1, "action": "flag"}, http.StatusForbidden)
+	rule(aliceToken, map[string]any{"name": "bad", "field": "title", "pattern": "(", "action": "flag"}, http.StatusBadRequest)
+	rule(aliceToken, map[string]any{"name": "bad", "field": "title", "action": "flag"}, http.StatusBadRequest)
+	rule(aliceToken, map[string]any{"name": "bad", "minAccountDays": 1, "action": "ban"}, http.StatusBadRequest)
+	spam := rule(aliceToken, map[string]any{"name": "spam", "applies": "post", "field": "title", "keywords": []string{"spam"}, "action": "remove"}, http.StatusCreated)
+	rule(aliceToken, map[string]any{"name": "links", "field": "content", "pattern": `https?://`, "action": "flag"}, http.StatusCreated)
+	rule(aliceToken, map[string]any{"name": "new accounts", "applies": "comment", "minAccountDays": 1, "action": "hold"}, http.StatusCreated)
+	var rules models.ListResponse[models.AutomodRule]
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/automod", aliceToken, nil, &rules); rec.Code != http.StatusOK || rules.Total != 3 {
+		t.Errorf("rules: got %d, %d rules", rec.Code, rules.Total)
+	}
+
+	post := func(title, content string) models.Post {
+		t.Helper()
+		var p models.Post
+		if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, map[string]any{"model": map[string]any{"title": title, "content": content}}, &p); rec.Code != http.StatusCreated {
+			t.Fatalf("post %q: %d", title, rec.Code)
+		}
+		return p
+	}
+	visible := func(path string) bool {
+		t.Helper()
+		return call(t, e, http.MethodGet, path, "", nil, nil).Code == http.StatusOK
+	}
+	queue := func() []models.Report {
+		t.Helper()
+		var list ModQueueList
+		call(t, e, http.MethodGet, "/v1/topics/golang/reports", aliceToken, nil, &list)
+		return list.Items
+	}
+
+	removed := post("Buy spam", "cheap https://example.com")
+	if visible("/v1/topics/golang/posts/" + removed.ID) {
+		t.Error("a post matching a remove rule is visible")
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	if len(log.Items) == 0 || log.Items[0].Action != models.ModRemove || log.Items[0].ModeratorID != "" || log.Items[0].TargetUserID != bob.ID || log.Items[0].Details != "AutoModerator: spam" {
+		t.Errorf("the removal in the modlog: got %+v", log.Items)
+	}
+	if reports := queue(); len(reports) != 0 {
+		t.Errorf("removing also reported the post, the strongest action should win: %+v", reports)
+	}
+
+	flagged := post("Read this", "at https://example.com")
+	if reports := queue(); !visible("/v1/topics/golang/posts/"+flagged.ID) || len(reports) != 1 || reports[0].Held || reports[0].Reason != "AutoModerator: links" || reports[0].ReporterID != "" {
+		t.Errorf("a flagged post: got %+v", reports)
+	}
+
+	var held models.Comment
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments", bobToken, map[string]any{"model": map[string]any{"content": "first"}}, &held); rec.Code != http.StatusCreated {
+		t.Fatalf("comment: %d", rec.Code)
+	}
+	var comments models.ListResponse[models.Comment]
+	call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1/comments", "", nil, &comments)
+	if len(comments.Items) != 0 {
+		t.Errorf("a held comment is visible: %+v", comments.Items)
+	}
+	var notifications NotificationList
+	call(t, e, http.MethodGet, "/v1/notifications", aliceToken, nil, &notifications)
+	if notifications.Unread != 0 {
+		t.Errorf("notified about a held comment: %+v", notifications.Items)
+	}
+	var report models.Report
+	for _, r := range queue() {
+		if r.Held {
+			report = r
+		}
+	}
+	if report.Comment == nil || report.Comment.ID != held.ID || report.Reason != "AutoModerator: new accounts" {
+		t.Fatalf("the held comment in the queue: got %+v", report)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/reports/"+report.ID+"/approve", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("approve the held comment: %d", rec.Code)
+	}
+	call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1/comments", "", nil, &comments)
+	if len(comments.Items) != 1 || comments.Items[0].ID != held.ID {
+		t.Errorf("the approved comment: got %+v", comments.Items)
+	}
+	call(t, e, http.MethodGet, "/v1/notifications", aliceToken, nil, &notifications)
+	if notifications.Unread != 1 {
+		t.Errorf("notifications once the comment is approved: got %d", notifications.Unread)
+	}
+
+	path := "/v1/topics/golang/automod/" + spam.ID
+	if rec := call(t, e, http.MethodPut, path, aliceToken, map[string]any{"updateMask": map[string]any{"action": "ban"}}, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("update a rule to an unknown action: got %d", rec.Code)
+	}
+	var updated models.AutomodRule
+	if rec := call(t, e, http.MethodPut, path, aliceToken, map[string]any{"updateMask": map[string]any{"action": "flag"}}, &updated); rec.Code != http.StatusOK || updated.Action != "flag" || updated.Name != "spam" || len(updated.Keywords) != 1 {
+		t.Errorf("update a rule: got %d, %+v", rec.Code, updated)
+	}
+	if rec := call(t, e, http.MethodDelete, path, bobToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("delete a rule as a non-moderator: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodDelete, path, aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete a rule: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodDelete, path, aliceToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("delete a deleted rule: got %d", rec.Code)
+	}
+	if p := post("More spam", ""); !visible("/v1/topics/golang/posts/" + p.ID) {
+		t.Error("a deleted rule still removes posts")
+	}
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	if log.Items[0].Details != "deleted rule spam" || log.Items[1].Details != "updated rule spam" {
+		t.Errorf("rule changes in the modlog: got %+v", log.Items[:2])
+	}
+
+	rule(aliceToken, map[string]any{"name": "spam", "applies": "post", "field": "title", "keywords": []string{"spam"}, "action": "remove"}, http.StatusCreated)
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Form spam"}}, login(t, bob)); rec.Code != http.StatusOK {
+		t.Fatalf("post through the form: %d", rec.Code)
+	}
+	posts, err := store.Find(context.Background(), Store, models.Post{TopicID: "golang", Title: "Form spam"}, store.Unscoped())
+	if err != nil || len(posts) != 1 || !posts[0].DeletedAt.Valid {
+		t.Errorf("a spam post through the form: got %+v, %v", posts, err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type AutoPinRequest struct {
+	models.IDs
+	Votes  int `json:"votes"`
+	Margin int `json:"margin"`
+}
+
+func (r AutoPinRequest) Validate() error {
+	if r.Votes < 0 || r.Margin < 0 {
+		return NewError(BadRequest, "invalid_auto_pin", "votes and margin cannot be negative")
+	} else if r.Votes > 0 && r.Margin == 0 {
+		return NewError(BadRequest, "invalid_auto_pin", "auto-pinning needs a margin of at least one vote")
+	}
+	return nil
+}
+
+// SetAutoPin changes when the top comments of a topic's posts are pinned,
+// or turns it off with zero votes. Only the topic's moderators may, and it
+// is logged. Posts pick up the change the next time their comments are
+// voted on.
+func SetAutoPin(c context.Context, req AutoPinRequest) (*models.Topic, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	topic := models.Topic{Model: models.Model{ID: req.TopicID}}
+	details := "off"
+	if req.Votes > 0 {
+		details = fmt.Sprintf("%d votes, %d ahead", req.Votes, req.Margin)
+	}
+	err := Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditAutoPin, Details: details}, func(tx store.Store) error {
+		return tx.Update(c, &topic, map[string]any{"auto_pin_votes": req.Votes, "auto_pin_margin": req.Margin})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(c, Store, topic)
+}
+
+// AutoPin pins the top-level comment of a post that its topic's setting
+// picks, in place of the one it pinned before. A comment is pinned once it
+// has the topic's AutoPinVotes and leads every other by AutoPinMargin. To
+// keep comments near the threshold from taking turns, the pinned one stays
+// until another leads it by the margin or it falls the margin below the
+// threshold.
+func AutoPin(c context.Context, s store.Store, topicID string, postID string) error {
+	topic, err := store.Get(c, s, models.Topic{Model: models.Model{ID: topicID}})
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Deleted comments are unpinned too, so they come back unpinned.
+	pinned, err := store.Find(c, s, models.Comment{TopicID: topicID, PostID: postID, AutoPinned: true}, store.Unscoped())
+	if err != nil {
+		return err
+	}
+	var pick *models.Comment
+	if topic.AutoPinVotes > 0 {
+		top, err := store.Find(c, s, models.Comment{TopicID: topicID, PostID: postID}, store.Where("parent_comment_id", "=", ""), store.Where("shadowbanned", "=", false), store.OrderBy("votes DESC", "created_at"), store.Page(models.PageRequest{Limit: 2}))
+		if err != nil {
+			return err
+		}
+		pick = pickAutoPin(topic, top, pinned)
+	}
+	return s.Transaction(c, func(tx store.Store) error {
+		for _, comment := range pinned {
+			if pick != nil && comment.ID == pick.ID {
+				pick = nil
+				continue
+			}
+			if err := tx.UpdateColumns(c, &models.Comment{}, &models.Comment{Model: models.Model{ID: comment.ID}, TopicID: topicID, PostID: postID}, map[string]any{"auto_pinned": false}, store.Unscoped()); err != nil {
+				return err
+			}
+		}
+		if pick == nil {
+			return nil
+		}
+		return tx.UpdateColumns(c, &models.Comment{}, &models.Comment{Model: models.Model{ID: pick.ID}, TopicID: topicID, PostID: postID}, map[string]any{"auto_pinned": true})
+	})
+}
+
+// pickAutoPin picks the comment to pin from the post's top two comments by
+// votes and the ones pinned now, or nil for none.
+func pickAutoPin(topic *models.Topic, top []models.Comment, pinned []models.Comment) *models.Comment {
+	if len(top) == 0 {
+		return nil
+	}
+	runnerUp := 0
+	if len(top) > 1 {
+		runnerUp = top[1].Votes
+	}
+	if top[0].Votes >= topic.AutoPinVotes && top[0].Votes-runnerUp >= topic.AutoPinMargin {
+		return &top[0]
+	}
+	for _, comment := range pinned {
+		if comment.DeletedAt.Valid || comment.Shadowbanned || comment.Votes < topic.AutoPinVotes-topic.AutoPinMargin {
+			continue
+		}
+		best := top[0].Votes
+		if top[0].ID == comment.ID {
+			best = runnerUp
+		}
+		if best-comment.Votes < topic.AutoPinMargin {
+			return &comment
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestAutoPin moves comments' votes around the threshold on each store and
+// checks which one is pinned after each change.
+func TestAutoPin(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testAutoPin(t, s)
+		})
+	}
+}
+
+func testAutoPin(t *testing.T, s store.Store) {
+	c := context.Background()
+	now := time.Now()
+	for _, obj := range []any{
+		&models.User{Model: models.Model{ID: "u1"}, Username: "alice"},
+		&models.Topic{Model: models.Model{ID: "golang"}, AutoPinVotes: 5, AutoPinMargin: 2},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: "u1", Title: "Post"},
+		&models.Comment{Model: models.Model{ID: "a", CreatedAt: now.Add(-time.Hour)}, TopicID: "golang", PostID: "p1", AuthorID: "u1"},
+		&models.Comment{Model: models.Model{ID: "b", CreatedAt: now.Add(-time.Minute)}, TopicID: "golang", PostID: "p1", AuthorID: "u1"},
+		&models.Comment{Model: models.Model{ID: "reply"}, TopicID: "golang", PostID: "p1", AuthorID: "u1", ParentCommentID: "a", Votes: 50},
+	} {
+		if err := s.Create(c, obj); err != nil {
+			t.Fatalf("create %T: %v", obj, err)
+		}
+	}
+	pinned := func() string {
+		t.Helper()
+		comments, err := store.Find(c, s, models.Comment{TopicID: "golang", PostID: "p1", AutoPinned: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, comment := range comments {
+			ids = append(ids, comment.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	for _, tc := range []struct {
+		what   string
+		a, b   int
+		topic  int
+		pinned string
+	}{
+		{"below the threshold", 4, 0, 5, "[]"},
+		{"at the threshold but not far enough ahead", 5, 4, 5, "[]"},
+		{"clearly on top", 6, 4, 5, "[a]"},
+		{"tied", 6, 6, 5, "[a]"},
+		{"overtaken by less than the margin", 6, 7, 5, "[a]"},
+		{"overtaken by the margin", 6, 8, 5, "[b]"},
+		{"at the threshold less the margin", 0, 3, 5, "[b]"},
+		{"below the threshold less the margin", 0, 2, 5, "[]"},
+		{"back near the threshold", 0, 4, 5, "[]"},
+		{"clearly on top again", 0, 5, 5, "[b]"},
+		{"turned off", 0, 10, 0, "[]"},
+	} {
+		for id, votes := range map[string]int{"a": tc.a, "b": tc.b} {
+			if err := s.UpdateColumns(c, &models.Comment{}, &models.Comment{Model: models.Model{ID: id}, TopicID: "golang", PostID: "p1"}, map[string]any{"votes": votes}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.UpdateColumns(c, &models.Topic{}, &models.Topic{Model: models.Model{ID: "golang"}}, map[string]any{"auto_pin_votes": tc.topic}); err != nil {
+			t.Fatal(err)
+		}
+		if err := AutoPin(c, s, "golang", "p1"); err != nil {
+			t.Fatal(err)
+		}
+		if got := pinned(); got != tc.pinned {
+			t.Errorf("%s (a %d, b %d): got %s pinned, want %s", tc.what, tc.a, tc.b, got, tc.pinned)
+		}
+	}
+}
+
+// TestAutoPinVotes turns auto-pinning on for a topic and votes a comment
+// past the threshold, which pins it above the post's other comments on the
+// post page.
+func TestAutoPinVotes(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Post"},
+		&models.Comment{Model: models.Model{ID: "c1", CreatedAt: time.Now().Add(-time.Hour)}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "First"},
+		&models.Comment{Model: models.Model{ID: "c2"}, TopicID: "golang", PostID: "p1", AuthorID: alice.ID, Content: "Best"},
+	)
+	for _, tc := range []struct {
+		what, token   string
+		votes, margin int
+		want          int
+	}{
+		{"as a non-moderator", bobToken, 2, 2, http.StatusForbidden},
+		{"without a margin", aliceToken, 2, 0, http.StatusBadRequest},
+		{"with negative votes", aliceToken, -1, 2, http.StatusBadRequest},
+		{"at two votes, two ahead", aliceToken, 2, 2, http.StatusOK},
+	} {
+		var topic models.Topic
+		rec := call(t, e, http.MethodPut, "/v1/topics/golang/auto-pin", tc.token, map[string]int{"votes": tc.votes, "margin": tc.margin}, &topic)
+		if rec.Code != tc.want {
+			t.Errorf("auto-pin %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		} else if rec.Code == http.StatusOK && (topic.AutoPinVotes != 2 || topic.AutoPinMargin != 2) {
+			t.Errorf("auto-pin %s: got %+v", tc.what, topic)
+		}
+	}
+
+	// Oldest first, so only pinning puts c2 first.
+	comments := func() string {
+		t.Helper()
+		post := models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}
+		if err := PreparePost(context.Background(), &post, ListRequest{SortRequest: models.SortRequest{Sort: "old"}}); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, comment := range post.Comments {
+			got = append(got, fmt.Sprintf("%s:%v", comment.ID, comment.AutoPinned))
+		}
+		return fmt.Sprint(got)
+	}
+	if got := comments(); got != "[c1:false c2:false]" {
+		t.Errorf("comments before the votes: got %s", got)
+	}
+	for i, user := range []*models.User{alice, bob} {
+		if rec := postForm(e, "/topics/golang/posts/p1/comments/c2/upvote", nil, login(t, user)); rec.Code != http.StatusOK {
+			t.Fatalf("vote %d: %d %s", i+1, rec.Code, rec.Body)
+		}
+	}
+	if got := comments(); got != "[c2:true c1:false]" {
+		t.Errorf("comments once c2 is voted past the threshold: got %s", got)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	if len(log.Items) != 1 || log.Items[0].Action != models.ModEditAutoPin || log.Items[0].Details != "2 votes, 2 ahead" {
+		t.Errorf("the mod log: got %+v", log.Items)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrBlocked = NewError(Forbidden, "blocked", "this user has blocked you")
+
+type BlockRequest struct {
+	Username string `param:"username"`
+}
+
+// HasBlocked reports whether the user has blocked the other.
+func HasBlocked(c context.Context, s store.Store, userID string, otherID string) (bool, error) {
+	count, err := s.Count(c, &models.Block{}, &models.Block{UserID: userID, BlockedID: otherID})
+	return count > 0, err
+}
+
+// CheckReply stops a blocked user from commenting on the posts, or replying
+// to the comments, of whoever blocked them.
+func CheckReply(c context.Context, s store.Store, comment *models.Comment, author *models.User) error {
+	var repliedTo string
+	if comment.ParentCommentID != "" {
+		parent, err := store.Get(c, s, models.Comment{Model: models.Model{ID: comment.ParentCommentID}, TopicID: comment.TopicID, PostID: comment.PostID})
+		if err != nil {
+			return err
+		}
+		repliedTo = parent.AuthorID
+	} else {
+		post, err := store.Get(c, s, models.Post{Model: models.Model{ID: comment.PostID}, TopicID: comment.TopicID})
+		if err != nil {
+			return err
+		}
+		repliedTo = post.AuthorID
+	}
+	if blocked, err := HasBlocked(c, s, repliedTo, author.ID); err != nil {
+		return err
+	} else if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+func Blocks(c context.Context, req models.PageRequest) (*models.ListResponse[models.Block], error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	return store.List(c, Store, models.Block{UserID: user.ID}, req, store.Preload("Blocked"), store.OrderBy("created_at DESC"))
+}
+
+// BlockUser blocks a user, doing nothing if they already are.
+func BlockUser(c context.Context, req BlockRequest) (*models.Block, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	other, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, err
+	} else if other.ID == user.ID {
+		return nil, FieldErrors{"username": "must be someone else"}
+	}
+	block := &models.Block{UserID: user.ID, BlockedID: other.ID}
+	if blocked, err := HasBlocked(c, Store, user.ID, other.ID); err != nil || blocked {
+		return nil, err
+	}
+	return nil, Store.Create(c, block)
+}
+func UnblockUser(c context.Context, req BlockRequest) (*models.Block, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	other, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	_, err = store.Delete(c, Store, models.Block{UserID: user.ID, BlockedID: other.ID})
+	return nil, err
+}
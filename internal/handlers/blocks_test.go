@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestBlockUser blocks and unblocks over v1 and the profile form, and checks
+// what the blocked user can no longer see or do.
+func TestBlockUser(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	_, carolToken := newUser(t, "carol")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "pa"}, TopicID: "golang", AuthorID: alice.ID, Title: "Alice's"},
+		&models.Post{Model: models.Model{ID: "pb"}, TopicID: "golang", AuthorID: bob.ID, Title: "Bob's"},
+		&models.Comment{Model: models.Model{ID: "ca"}, TopicID: "golang", PostID: "pb", AuthorID: alice.ID, Content: "Alice's"},
+		&models.Comment{Model: models.Model{ID: "cb"}, TopicID: "golang", PostID: "pb", AuthorID: bob.ID, Content: "Bob's"},
+	)
+	for _, tc := range []struct {
+		what, token, username string
+		want                  int
+	}{
+		{"signed out", "", "bob", http.StatusUnauthorized},
+		{"an unknown user", aliceToken, "nobody", http.StatusNotFound},
+		{"yourself", aliceToken, "alice", http.StatusBadRequest},
+		{"bob", aliceToken, "bob", http.StatusNoContent},
+		{"bob again", aliceToken, "bob", http.StatusNoContent},
+	} {
+		if rec := call(t, e, http.MethodPut, "/v1/users/"+tc.username+"/block", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("block %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	var blocks models.ListResponse[models.Block]
+	call(t, e, http.MethodGet, "/v1/blocks", aliceToken, nil, &blocks)
+	if len(blocks.Items) != 1 || blocks.Items[0].Blocked == nil || blocks.Items[0].Blocked.Username != "bob" {
+		t.Errorf("alice's blocks: got %+v", blocks.Items)
+	}
+
+	counts := func(token string) (posts, comments int64) {
+		t.Helper()
+		var p models.ListResponse[models.Post]
+		call(t, e, http.MethodGet, "/v1/topics/golang/posts", token, nil, &p)
+		var c models.ListResponse[models.Comment]
+		call(t, e, http.MethodGet, "/v1/topics/golang/posts/pb/comments", token, nil, &c)
+		return p.Total, c.Total
+	}
+	if posts, comments := counts(aliceToken); posts != 1 || comments != 1 {
+		t.Errorf("alice sees %d posts and %d comments, want bob's hidden", posts, comments)
+	}
+	if posts, comments := counts(carolToken); posts != 2 || comments != 2 {
+		t.Errorf("carol sees %d posts and %d comments, want everything", posts, comments)
+	}
+
+	for _, tc := range []struct {
+		what, path string
+		body       any
+		want       int
+	}{
+		{"comment on alice's post", "/v1/topics/golang/posts/pa/comments", map[string]any{"model": map[string]string{"content": "hi"}}, http.StatusForbidden},
+		{"reply to alice's comment", "/v1/topics/golang/posts/pb/comments", map[string]any{"model": map[string]string{"content": "hi", "parentCommentID": "ca"}}, http.StatusForbidden},
+		{"message alice", "/v1/messages", map[string]string{"to": "alice", "content": "hi"}, http.StatusForbidden},
+		{"comment on his own post", "/v1/topics/golang/posts/pb/comments", map[string]any{"model": map[string]string{"content": "hi"}}, http.StatusCreated},
+	} {
+		if rec := call(t, e, http.MethodPost, tc.path, bobToken, tc.body, nil); rec.Code != tc.want {
+			t.Errorf("bob tries to %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	if rec := postForm(e, "/topics/golang/posts/pa/comments", url.Values{"content": {"hi"}}, login(t, bob)); rec.Code != http.StatusForbidden {
+		t.Errorf("bob comments on alice's post through the form: got %d", rec.Code)
+	}
+
+	profile := func() string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/u/bob", nil)
+		req.AddCookie(login(t, alice))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	if !strings.Contains(profile(), `data-url="/u/bob/unblock"`) {
+		t.Error("bob's profile has no unblock button for alice")
+	}
+	if rec := postForm(e, "/u/bob/unblock", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("unblock through the form: got %d", rec.Code)
+	}
+	if !strings.Contains(profile(), `data-url="/u/bob/block"`) {
+		t.Error("bob's profile has no block button for alice once unblocked")
+	}
+	if posts, comments := counts(aliceToken); posts != 2 || comments != 3 {
+		t.Errorf("alice sees %d posts and %d comments after unblocking", posts, comments)
+	}
+	if rec := call(t, e, http.MethodDelete, "/v1/users/bob/block", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("unblock someone not blocked: got %d", rec.Code)
+	}
+}
+
+// TestBlocks has alice block bob and checks his content and mentions no
+// longer reach her, while carol still sees them.
+func TestBlocks(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	carol, carolToken := newUser(t, "carol")
+	c := context.Background()
+	if rec := call(t, e, http.MethodPost, "/v1/topics", carolToken, map[string]any{"model": map[string]any{"id": "golang"}}, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("create topic: %d %s", rec.Code, rec.Body)
+	}
+	var carolPost, bobPost models.Post
+	call(t, e, http.MethodPost, "/v1/topics/golang/posts", carolToken, map[string]any{"model": map[string]any{"title": "Carol's post"}}, &carolPost)
+	call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, map[string]any{"model": map[string]any{"title": "Bob's post"}}, &bobPost)
+	if rec := call(t, e, http.MethodPut, "/v1/users/bob/block", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("block: %d %s", rec.Code, rec.Body)
+	}
+
+	token, _, err := CreateSession(c, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(e)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/topics/golang/posts/"+carolPost.ID+"/stream", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var bobComment, carolComment models.Comment
+	call(t, e, http.MethodPost, "/v1/topics/golang/posts/"+carolPost.ID+"/comments", bobToken, map[string]any{"model": map[string]any{"content": "Hi @alice and @carol"}}, &bobComment)
+	call(t, e, http.MethodPost, "/v1/topics/golang/posts/"+carolPost.ID+"/comments", carolToken, map[string]any{"model": map[string]any{"content": "Hi @alice"}}, &carolComment)
+	lines := bufio.NewScanner(res.Body)
+	for lines.Scan() {
+		if strings.Contains(lines.Text(), bobComment.ID) {
+			t.Error("alice's stream carried a comment by bob")
+		}
+		if strings.Contains(lines.Text(), carolComment.ID) {
+			break
+		}
+	}
+	cancel()
+
+	for _, tc := range []struct {
+		user    *models.User
+		comment string
+		want    int
+	}{{alice, bobComment.ID, 0}, {alice, carolComment.ID, 1}, {carol, bobComment.ID, 1}} {
+		notifications, err := store.Find(c, Store, models.Notification{UserID: tc.user.ID, CommentID: tc.comment})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(notifications) != tc.want {
+			t.Errorf("%s: got %d notifications of comment %s, want %d", tc.user.Username, len(notifications), tc.comment, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		path, token string
+		want        int
+	}{
+		{"/v1/topics/golang/posts/" + bobPost.ID, aliceToken, http.StatusNotFound},
+		{"/v1/topics/golang/posts/" + bobPost.ID, carolToken, http.StatusOK},
+		{"/v1/topics/golang/posts/" + bobPost.ID, "", http.StatusOK},
+		{"/v1/topics/golang/posts/" + carolPost.ID + "/comments/" + bobComment.ID, aliceToken, http.StatusNotFound},
+		{"/v1/topics/golang/posts/" + carolPost.ID + "/comments/" + bobComment.ID, carolToken, http.StatusOK},
+		{"/v1/topics/golang/posts/" + carolPost.ID + "/comments/" + carolComment.ID, aliceToken, http.StatusOK},
+	} {
+		if rec := call(t, e, http.MethodGet, tc.path, tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("GET %s as %q: got %d, want %d", tc.path, tc.token[:min(len(tc.token), 8)], rec.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// Brigades tightens commenting on a post that got Threshold or more votes
+// and comments over the last Window, to Comments per user until its
+// activity falls back under the threshold. A zero Threshold or Window
+// leaves posts to the site-wide budgets alone.
+type Brigades struct {
+	Window    time.Duration `yaml:"window"`
+	Threshold int           `yaml:"threshold"`
+	Comments  RateBudget    `yaml:"comments"`
+}
+
+func (b Brigades) enabled() bool {
+	return b.Threshold > 0 && b.Window > 0
+}
+
+// ThrottleBrigade spends a token from author's comment budget on the post
+// comment is on when the post is being brigaded, and returns a 429 saying
+// so when the budget is spent. The post's moderators are not throttled.
+func ThrottleBrigade(c context.Context, s store.Store, comment *models.Comment, author *models.User) error {
+	brigades := RateLimits.Brigades
+	if RateLimiter == nil || !RateLimits.Enabled || !brigades.enabled() {
+		return nil
+	}
+	since := store.Where("created_at", ">=", time.Now().Add(-brigades.Window))
+	// Comments removed since count too, as the pile-on they were part of.
+	comments, err := s.Count(c, &models.Comment{}, &models.Comment{TopicID: comment.TopicID, PostID: comment.PostID}, since, store.Unscoped())
+	if err != nil {
+		return err
+	}
+	votes, err := s.Count(c, &models.Vote{}, &models.Vote{TopicID: comment.TopicID, PostID: comment.PostID}, since)
+	if err != nil {
+		return err
+	}
+	if comments+votes < int64(brigades.Threshold) || Moderate(c, comment.TopicID) == nil {
+		return nil
+	}
+	wait, err := RateLimiter.Allow("brigade:"+comment.PostID+":user:"+author.ID, brigades.Comments)
+	if err != nil {
+		logging.FromContext(c).Error("rate limiter failed", "error", err)
+		return nil
+	} else if wait > 0 {
+		return NewError(TooManyRequests, "post_throttled", fmt.Sprintf("this post is getting an unusual amount of votes and comments, so commenting on it is slowed down for now; retry in %d seconds", int(math.Ceil(wait.Seconds()))))
+	}
+	return nil
+}
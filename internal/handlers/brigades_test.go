@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestBrigades piles votes onto one post and checks commenting on it is
+// throttled, on another post is not, and on the first is again once the
+// votes are older than the window.
+func TestBrigades(t *testing.T) {
+	e := newServer(t)
+	RateLimiter = NewMemoryLimiter()
+	RateLimits = RateLimitConfig{Enabled: true, Brigades: Brigades{Window: 10 * time.Minute, Threshold: 5, Comments: RateBudget{Burst: 1, Per: time.Hour}}}
+	_, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: bob.ID},
+		&models.Post{Model: models.Model{ID: "hot"}, TopicID: "golang", AuthorID: bob.ID, Title: "Hot"},
+		&models.Post{Model: models.Model{ID: "calm"}, TopicID: "golang", AuthorID: bob.ID, Title: "Calm"},
+	)
+	for i := range 5 {
+		create(t, &models.Vote{UserID: fmt.Sprint("voter", i), TopicID: "golang", PostID: "hot", Value: 1})
+	}
+	comment := func(post, token string) (int, string) {
+		t.Helper()
+		rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/"+post+"/comments", token, map[string]any{"model": map[string]string{"content": "me too"}}, nil)
+		return rec.Code, rec.Body.String()
+	}
+
+	for i, want := range []int{http.StatusCreated, http.StatusTooManyRequests} {
+		if code, problem := comment("hot", aliceToken); code != want || (code == http.StatusTooManyRequests && !strings.Contains(problem, `"code":"post_throttled"`)) {
+			t.Errorf("comment %d on the brigaded post: got %d %s, want %d", i+1, code, problem, want)
+		}
+	}
+	for i := range 3 {
+		if code, _ := comment("calm", aliceToken); code != http.StatusCreated {
+			t.Errorf("comment %d on the calm post: got %d", i+1, code)
+		}
+		if code, _ := comment("hot", bobToken); code != http.StatusCreated {
+			t.Errorf("comment %d on the brigaded post as its moderator: got %d", i+1, code)
+		}
+	}
+
+	old := map[string]any{"created_at": time.Now().Add(-time.Hour)}
+	if err := Store.UpdateColumns(context.Background(), &models.Vote{}, &models.Vote{PostID: "hot"}, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := Store.UpdateColumns(context.Background(), &models.Comment{}, &models.Comment{PostID: "hot"}, old); err != nil {
+		t.Fatal(err)
+	}
+	if code, problem := comment("hot", aliceToken); code != http.StatusCreated {
+		t.Errorf("comment on the post once it calmed down: got %d %s", code, problem)
+	}
+}
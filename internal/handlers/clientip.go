@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ClientIP finds the address a request came from, for rate limits, view
+// counts and logs. It is the peer's address unless TrustProxies says which
+// proxies in front of the site to take X-Forwarded-For from.
+var ClientIP = echo.ExtractIPDirect()
+
+// TrustProxies has ClientIP read X-Forwarded-For, trusting only the proxies
+// in the given CIDR ranges to have written it. Without any, the header is
+// ignored, since clients can send it themselves.
+func TrustProxies(ranges []string) (echo.IPExtractor, error) {
+	if len(ranges) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, cidr := range ranges {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
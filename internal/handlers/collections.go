@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type CollectionRequest struct {
+	ListRequest
+	Name string `param:"collection"`
+}
+type UpdateCollectionRequest struct {
+	CollectionRequest
+	Mask models.Collection `json:"updateMask"`
+}
+
+// CollectionFeed is a collection along with a page of its posts.
+type CollectionFeed struct {
+	Collection *models.Collection                `json:"collection"`
+	Posts      *models.ListResponse[models.Post] `json:"posts"`
+}
+
+func (r UpdateCollectionRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.Model("updateMask.", r.Mask, true)
+	return errs.Err()
+}
+func (e FieldErrors) Collection(prefix string, collection models.Collection, partial bool) {
+	if (!partial || collection.Name != "") && !validName(collection.Name, 3, 21) {
+		e[prefix+"name"] = "must be 3-21 letters, digits, '-' or '_'"
+	}
+	if collection.Topics == nil && partial {
+		return
+	}
+	if len(collection.Topics) == 0 || len(collection.Topics) > MaxCollectionTopics {
+		e[prefix+"topics"] = fmt.Sprintf("must list 1-%d topics", MaxCollectionTopics)
+	}
+	for _, topic := range collection.Topics {
+		if !ValidTopicID(topic) {
+			e[prefix+"topics"] = "must be topic IDs"
+		}
+	}
+}
+
+// collectionTopics dedupes a collection's topics, checking they all exist.
+func collectionTopics(c context.Context, field string, topics []string) ([]string, error) {
+	topics = slices.Clone(topics)
+	slices.Sort(topics)
+	topics = slices.Compact(topics)
+	for _, topic := range topics {
+		if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: topic}}); errors.Is(err, store.ErrNotFound) {
+			return nil, FieldErrors{field: topic + " is not a topic"}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return topics, nil
+}
+
+// UserCollection looks up one of the current user's collections by name.
+func UserCollection(c context.Context, name string) (*models.Collection, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	collections, err := store.Find(c, Store, models.Collection{OwnerID: user.ID, Name: name})
+	if err != nil {
+		return nil, err
+	} else if len(collections) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return &collections[0], nil
+}
+func Collections(c context.Context, req models.PageRequest) (*models.ListResponse[models.Collection], error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	return store.List(c, Store, models.Collection{OwnerID: user.ID}, req, store.OrderBy("name"))
+}
+func CreateCollection(c context.Context, req CreateRequest[models.Collection]) (*models.Collection, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	if _, err := UserCollection(c, req.Model.Name); err == nil {
+		return nil, store.ErrDuplicatedKey
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	topics, err := collectionTopics(c, "model.topics", req.Model.Topics)
+	if err != nil {
+		return nil, err
+	}
+	return store.Create(c, Store, models.Collection{Model: models.Model{ID: uuid.NewString()}, OwnerID: user.ID, Name: req.Model.Name, Topics: topics})
+}
+func GetCollection(c context.Context, req CollectionRequest) (*models.Collection, error) {
+	return UserCollection(c, req.Name)
+}
+
+// UpdateCollection renames a collection or replaces its topics.
+func UpdateCollection(c context.Context, req UpdateCollectionRequest) (*models.Collection, error) {
+	collection, err := UserCollection(c, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	mask := models.Collection{Name: req.Mask.Name}
+	if mask.Name != "" && mask.Name != collection.Name {
+		if _, err := UserCollection(c, mask.Name); err == nil {
+			return nil, store.ErrDuplicatedKey
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+	}
+	if req.Mask.Topics != nil {
+		if mask.Topics, err = collectionTopics(c, "updateMask.topics", req.Mask.Topics); err != nil {
+			return nil, err
+		}
+	}
+	return store.Update(c, Store, models.Collection{Model: models.Model{ID: collection.ID}}, mask)
+}
+func DeleteCollection(c context.Context, req CollectionRequest) (*models.Collection, error) {
+	collection, err := UserCollection(c, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	_, err = store.Delete(c, Store, models.Collection{Model: models.Model{ID: collection.ID}})
+	return nil, err
+}
+func CollectionPosts(c context.Context, req CollectionRequest) (*models.ListResponse[models.Post], error) {
+	collection, err := UserCollection(c, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return TopicsFeed(c, collection.Topics, req.ListRequest)
+}
+func HandleCollections(c echo.Context) error {
+	if CurrentUser(c.Request().Context()) == nil {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	var req models.PageRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := Collections(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "collections", list)
+}
+func HandleCollection(c echo.Context) error {
+	if CurrentUser(c.Request().Context()) == nil {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	var req CollectionRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	collection, err := UserCollection(c.Request().Context(), req.Name)
+	if err != nil {
+		return Fail(c, err)
+	}
+	req.IncludeNSFW = true
+	posts, err := TopicsFeed(c.Request().Context(), collection.Topics, req.ListRequest)
+	if err != nil {
+		return Fail(c, err)
+	}
+	posts.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "collection", CollectionFeed{Collection: collection, Posts: posts})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// TestCollections manages collections over v1 and the pages, and reads
+// their merged feeds.
+func TestCollections(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	now := time.Now()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.Topic{Model: models.Model{ID: "java"}},
+		&models.Post{Model: models.Model{ID: "g1", CreatedAt: now.Add(-time.Hour)}, TopicID: "golang", Title: "Go post"},
+		&models.Post{Model: models.Model{ID: "r1", CreatedAt: now}, TopicID: "rust", Title: "Rust post"},
+		&models.Post{Model: models.Model{ID: "j1", CreatedAt: now}, TopicID: "java", Title: "Java post"},
+	)
+	collection := func(name string, topics ...string) map[string]any {
+		return map[string]any{"model": map[string]any{"name": name, "topics": topics}}
+	}
+	for _, tc := range []struct {
+		what, token string
+		body        any
+		want        int
+	}{
+		{"signed out", "", collection("systems", "golang"), http.StatusUnauthorized},
+		{"with a bad name", aliceToken, collection("a b", "golang"), http.StatusBadRequest},
+		{"without topics", aliceToken, collection("systems"), http.StatusBadRequest},
+		{"with an unknown topic", aliceToken, collection("systems", "golang", "python"), http.StatusBadRequest},
+		{"systems", aliceToken, collection("systems", "rust", "golang", "rust"), http.StatusCreated},
+		{"systems again", aliceToken, collection("systems", "java"), http.StatusConflict},
+		{"systems as bob", bobToken, collection("systems", "java"), http.StatusCreated},
+	} {
+		if rec := call(t, e, http.MethodPost, "/v1/collections", tc.token, tc.body, nil); rec.Code != tc.want {
+			t.Errorf("create %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+
+	var got models.Collection
+	if rec := call(t, e, http.MethodGet, "/v1/collections/systems", aliceToken, nil, &got); rec.Code != http.StatusOK || fmt.Sprint(got.Topics) != "[golang rust]" || got.OwnerID != alice.ID {
+		t.Errorf("alice's systems: got %d, %+v", rec.Code, got)
+	}
+	feed := func(token, path string) string {
+		t.Helper()
+		var posts models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, path, token, nil, &posts); rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d", path, rec.Code)
+		}
+		var ids []string
+		for _, post := range posts.Items {
+			ids = append(ids, post.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	if got := feed(aliceToken, "/v1/collections/systems/posts?sort=new"); got != "[r1 g1]" {
+		t.Errorf("alice's systems feed: got %s", got)
+	}
+	if got := feed(bobToken, "/v1/collections/systems/posts"); got != "[j1]" {
+		t.Errorf("bob's systems feed: got %s", got)
+	}
+
+	for _, tc := range []struct {
+		what string
+		mask map[string]any
+		want int
+	}{
+		{"rename", map[string]any{"name": "langs"}, http.StatusOK},
+		{"with an unknown topic", map[string]any{"topics": []string{"python"}}, http.StatusBadRequest},
+		{"with no topics", map[string]any{"topics": []string{}}, http.StatusBadRequest},
+	} {
+		path := "/v1/collections/systems"
+		if tc.want != http.StatusOK {
+			path = "/v1/collections/langs"
+		}
+		if rec := call(t, e, http.MethodPut, path, aliceToken, map[string]any{"updateMask": tc.mask}, nil); rec.Code != tc.want {
+			t.Errorf("update %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+	if rec := call(t, e, http.MethodPut, "/v1/collections/langs", aliceToken, map[string]any{"updateMask": map[string]any{"topics": []string{"java", "golang"}}}, &got); rec.Code != http.StatusOK || got.Name != "langs" || fmt.Sprint(got.Topics) != "[golang java]" {
+		t.Errorf("replace the topics: got %d, %+v", rec.Code, got)
+	}
+	call(t, e, http.MethodPost, "/v1/collections", aliceToken, collection("other", "rust"), nil)
+	if rec := call(t, e, http.MethodPut, "/v1/collections/other", aliceToken, map[string]any{"updateMask": map[string]any{"name": "langs"}}, nil); rec.Code != http.StatusConflict {
+		t.Errorf("rename onto another collection: got %d", rec.Code)
+	}
+	var list models.ListResponse[models.Collection]
+	call(t, e, http.MethodGet, "/v1/collections", aliceToken, nil, &list)
+	if len(list.Items) != 2 || list.Items[0].Name != "langs" || list.Items[1].Name != "other" {
+		t.Errorf("alice's collections: got %+v", list.Items)
+	}
+
+	page := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXCSRFToken, csrfToken)
+		req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: csrfToken})
+		req.AddCookie(login(t, alice))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := page(http.MethodPost, "/m", `{"model":{"name":"jvm","topics":["java"]}}`); rec.Code != http.StatusCreated {
+		t.Errorf("create through the page: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := page(http.MethodGet, "/m/jvm", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Java post") {
+		t.Errorf("the jvm page: got %d", rec.Code)
+	}
+	if rec := page(http.MethodGet, "/m", ""); !strings.Contains(rec.Body.String(), `href="/m/jvm"`) {
+		t.Errorf("the collections page does not link jvm: %s", rec.Body)
+	}
+	if rec := page(http.MethodPost, "/m/jvm/delete", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete through the page: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/collections/jvm", aliceToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("the deleted collection: got %d", rec.Code)
+	}
+	if rec := get(e, "/m"); rec.Code != http.StatusFound {
+		t.Errorf("the collections page signed out: got %d, want a redirect", rec.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// CountMismatch is a post or comment whose stored count disagrees with the
+// rows it counts.
+type CountMismatch struct {
+	TopicID   string
+	PostID    string
+	CommentID string
+	Column    string
+	Stored    int
+	Actual    int
+}
+
+// RecountComments sets a post's comment count to the comments on it that
+// are neither deleted nor shadowbanned. Writes that add, remove or hide
+// comments run it in their transaction.
+func RecountComments(c context.Context, s store.Store, topicID string, postID string) error {
+	count, err := s.Count(c, &models.Comment{}, &models.Comment{TopicID: topicID, PostID: postID}, store.Where("shadowbanned", "=", false))
+	if err != nil {
+		return err
+	}
+	return s.Update(c, &models.Post{Model: models.Model{ID: postID}, TopicID: topicID}, map[string]any{"comment_count": int(count)})
+}
+
+// CheckCounts compares the votes, upvotes, downvotes and comment count
+// stored on every post, and the votes on every comment, with the rows they
+// count. With fix set it stores the actual counts too, and the scores that
+// follow from them.
+func CheckCounts(c context.Context, fix bool) ([]CountMismatch, error) {
+	var mismatches []CountMismatch
+	check := func(found []CountMismatch, model any, mask map[string]any) error {
+		wrong := false
+		for _, mismatch := range found {
+			if mismatch.Stored != mismatch.Actual {
+				mismatches = append(mismatches, mismatch)
+				wrong = true
+			}
+		}
+		if !wrong || !fix {
+			return nil
+		}
+		if scored, ok := model.(models.Scored); ok {
+			for column, score := range scored.Scores() {
+				mask[column] = score
+			}
+		}
+		return Store.Update(c, model, mask)
+	}
+	posts, err := store.Find(c, Store, models.Post{}, store.Select("id", "topic_id", "votes", "ups", "downs", "comment_count", "created_at"))
+	if err != nil {
+		return nil, err
+	}
+	postUps, postDowns, err := voteTallies(c, "post_id")
+	if err != nil {
+		return nil, err
+	}
+	comments, err := Store.CountBy(c, &models.Comment{}, nil, "post_id", store.Where("shadowbanned", "=", false))
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		ups, downs := postUps[post.ID], postDowns[post.ID]
+		key := &models.Post{Model: models.Model{ID: post.ID, CreatedAt: post.CreatedAt}, TopicID: post.TopicID, Votes: ups - downs}
+		mismatch := CountMismatch{TopicID: post.TopicID, PostID: post.ID}
+		if err := check(tallies(mismatch, post.Votes, post.Ups, post.Downs, ups, downs), key,
+			map[string]any{"votes": ups - downs, "ups": ups, "downs": downs}); err != nil {
+			return mismatches, err
+		}
+		mismatch.Column, mismatch.Stored, mismatch.Actual = "comment_count", post.CommentCount, int(comments[post.ID])
+		if err := check([]CountMismatch{mismatch}, key, map[string]any{"comment_count": int(comments[post.ID])}); err != nil {
+			return mismatches, err
+		}
+	}
+	replies, err := store.Find(c, Store, models.Comment{}, store.Select("id", "topic_id", "post_id", "votes", "ups", "downs"))
+	if err != nil {
+		return mismatches, err
+	}
+	commentUps, commentDowns, err := voteTallies(c, "comment_id")
+	if err != nil {
+		return mismatches, err
+	}
+	for _, comment := range replies {
+		ups, downs := commentUps[comment.ID], commentDowns[comment.ID]
+		key := &models.Comment{Model: models.Model{ID: comment.ID}, TopicID: comment.TopicID, PostID: comment.PostID, Ups: ups, Downs: downs}
+		mismatch := CountMismatch{TopicID: comment.TopicID, PostID: comment.PostID, CommentID: comment.ID}
+		if err := check(tallies(mismatch, comment.Votes, comment.Ups, comment.Downs, ups, downs), key,
+			map[string]any{"votes": ups - downs, "ups": ups, "downs": downs}); err != nil {
+			return mismatches, err
+		}
+	}
+	return mismatches, nil
+}
+
+// tallies lists the votes, ups and downs stored on a post or comment
+// against the ones actually cast on it.
+func tallies(mismatch CountMismatch, votes, ups, downs, actualUps, actualDowns int) []CountMismatch {
+	found := make([]CountMismatch, 0, 3)
+	for _, column := range []struct {
+		name           string
+		stored, actual int
+	}{{"votes", votes, actualUps - actualDowns}, {"ups", ups, actualUps}, {"downs", downs, actualDowns}} {
+		mismatch.Column, mismatch.Stored, mismatch.Actual = column.name, column.stored, column.actual
+		found = append(found, mismatch)
+	}
+	return found
+}
+
+// voteTallies counts the upvotes and downvotes cast on posts, keyed by
+// post_id, or on comments, keyed by comment_id.
+func voteTallies(c context.Context, column string) (ups map[string]int, downs map[string]int, err error) {
+	on := store.Where("comment_id", "=", "")
+	if column == "comment_id" {
+		on = store.Where("comment_id", "<>", "")
+	}
+	tally := func(value int) (map[string]int, error) {
+		counts, err := Store.CountBy(c, &models.Vote{}, &models.Vote{Value: value}, column, on)
+		if err != nil {
+			return nil, err
+		}
+		totals := make(map[string]int, len(counts))
+		for key, count := range counts {
+			totals[key] = int(count)
+		}
+		return totals, nil
+	}
+	if ups, err = tally(1); err != nil {
+		return nil, nil, err
+	}
+	if downs, err = tally(-1); err != nil {
+		return nil, nil, err
+	}
+	return ups, downs, nil
+}
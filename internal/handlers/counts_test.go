@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestCommentCount follows a post's stored comment count through each
+// write that adds, removes or hides a comment, and checks CheckCounts
+// agrees after every step.
+func TestCommentCount(t *testing.T) {
+	e := newServer(t)
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"alice"}
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Welcome"},
+	)
+	count := func(what string, want int) {
+		t.Helper()
+		var post models.Post
+		call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1", "", nil, &post)
+		if post.CommentCount != want {
+			t.Errorf("%s: got %d comments, want %d", what, post.CommentCount, want)
+		}
+		if mismatches, err := CheckCounts(context.Background(), false); err != nil || len(mismatches) != 0 {
+			t.Errorf("%s: counts check got %+v, %v", what, mismatches, err)
+		}
+	}
+	comment := func(token, content string) models.Comment {
+		t.Helper()
+		var created models.Comment
+		if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments", token, map[string]any{"model": map[string]any{"content": content}}, &created); rec.Code != http.StatusCreated {
+			t.Fatalf("comment %q: %d", content, rec.Code)
+		}
+		return created
+	}
+	first := comment(aliceToken, "first")
+	comment(bobToken, "second")
+	count("two comments", 2)
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/posts/p1/comments/"+first.ID, aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d", rec.Code)
+	}
+	count("after a delete", 1)
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments/"+first.ID+"/restore", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("restore: %d", rec.Code)
+	}
+	count("after a restore", 2)
+	if rec := call(t, e, http.MethodPut, "/v1/users/bob/shadowban", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("shadowban: %d", rec.Code)
+	}
+	count("with bob shadowbanned", 1)
+	if rec := call(t, e, http.MethodDelete, "/v1/users/bob/shadowban", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("lift the shadowban: %d", rec.Code)
+	}
+	count("with the shadowban lifted", 2)
+
+	create(t, &models.AutomodRule{Model: models.Model{ID: "r1"}, TopicID: "golang", Name: "bob", Applies: "comment", Field: "author", Pattern: "^bob$", Action: models.AutomodHold})
+	held := comment(bobToken, "held")
+	count("with a comment held", 2)
+	queue := func() (reports []models.Report) {
+		t.Helper()
+		var list ModQueueList
+		call(t, e, http.MethodGet, "/v1/topics/golang/reports", aliceToken, nil, &list)
+		return list.Items
+	}
+	reports := queue()
+	if len(reports) != 1 || reports[0].CommentID != held.ID {
+		t.Fatalf("the queue: got %+v", reports)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/reports/"+reports[0].ID+"/approve", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("approve: %d", rec.Code)
+	}
+	count("with the held comment approved", 3)
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments/"+held.ID+"/reports", aliceToken, map[string]any{"reason": "spam"}, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("report: %d", rec.Code)
+	}
+	reports = queue()
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/reports/"+reports[0].ID+"/remove", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("remove: %d", rec.Code)
+	}
+	count("with the reported comment removed", 2)
+}
+
+// TestCheckCounts corrupts stored counts and has CheckCounts report and
+// then fix them.
+func TestCheckCounts(t *testing.T) {
+	newServer(t)
+	alice, _ := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1", CreatedAt: time.Now().Add(-time.Hour)}, TopicID: "golang", AuthorID: alice.ID, Title: "Drifted", Votes: 5, CommentCount: 1},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: alice.ID, Title: "Fine"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p2", AuthorID: alice.ID, Votes: -1},
+		&models.Vote{UserID: alice.ID, TopicID: "golang", PostID: "p1", Value: 1},
+	)
+	c := context.Background()
+	report := func(mismatches []CountMismatch) string {
+		var got []string
+		for _, m := range mismatches {
+			got = append(got, fmt.Sprintf("%s/%s %s %d->%d", m.PostID, m.CommentID, m.Column, m.Stored, m.Actual))
+		}
+		return fmt.Sprint(got)
+	}
+	want := "[p1/ votes 5->1 p1/ ups 0->1 p1/ comment_count 1->0 p2/ comment_count 0->1 p2/c1 votes -1->0]"
+	if mismatches, err := CheckCounts(c, false); err != nil || report(mismatches) != want {
+		t.Errorf("check: got %s, %v", report(mismatches), err)
+	}
+	if mismatches, err := CheckCounts(c, true); err != nil || report(mismatches) != want {
+		t.Errorf("fix: got %s, %v", report(mismatches), err)
+	}
+	if mismatches, err := CheckCounts(c, false); err != nil || len(mismatches) != 0 {
+		t.Errorf("check after the fix: got %s, %v", report(mismatches), err)
+	}
+	post, err := store.Get(c, Store, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"})
+	if err != nil || post.HotScore != models.Hot(1, post.CreatedAt) {
+		t.Errorf("the hot score after fixing the votes: got %v, want %v, %v", post.HotScore, models.Hot(1, post.CreatedAt), err)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrCrosspostSameTopic = NewError(BadRequest, "crosspost_same_topic", "a post cannot be crossposted into its own topic")
+var ErrAlreadyCrossposted = NewError(Conflict, "already_crossposted", "this post has already been crossposted there")
+
+// CrosspostRequest shares the post in the path into Topic, under Title or
+// else the original's title.
+type CrosspostRequest struct {
+	models.IDs
+	Topic string `json:"topic" form:"topic"`
+	Title string `json:"title" form:"title"`
+}
+
+func (r CrosspostRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.TopicID("topic", r.Topic)
+	errs.Text("title", models.StripTags(r.Title), MaxTitleLength, true)
+	return errs.Err()
+}
+
+// Crosspost shares a post into another topic. Crossposts of crossposts
+// share the original, so there is only ever one step back to it.
+func Crosspost(c context.Context, req CrosspostRequest) (*models.Post, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	original, _, err := findTarget(c, Store, models.IDs{TopicID: req.TopicID, PostID: req.PostID}, Visible(c))
+	if err != nil {
+		return nil, err
+	}
+	if original.IsCrosspost() {
+		if original, _, err = findTarget(c, Store, models.IDs{TopicID: original.CrosspostTopic, PostID: original.CrosspostOf}, Visible(c)); err != nil {
+			return nil, err
+		}
+	}
+	if req.Topic == original.TopicID {
+		return nil, ErrCrosspostSameTopic
+	}
+	if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: req.Topic}}); err != nil {
+		return nil, err
+	}
+	if count, err := Store.Count(c, &models.Post{}, &models.Post{TopicID: req.Topic, CrosspostTopic: original.TopicID, CrosspostOf: original.ID}); err != nil {
+		return nil, err
+	} else if count > 0 {
+		return nil, ErrAlreadyCrossposted
+	}
+	post := &models.Post{Model: models.Model{ID: uuid.NewString()}, TopicID: req.Topic, AuthorID: user.ID, Title: req.Title, Kind: models.PostCrosspost, CrosspostTopic: original.TopicID, CrosspostOf: original.ID, NSFW: original.NSFW, Spoiler: original.Spoiler}
+	if post.Title == "" {
+		post.Title = original.Title
+	}
+	if err := Submit(c, post, user); err != nil {
+		return nil, err
+	}
+	OnCreate(c, post, user)
+	return post, nil
+}
+
+// Crossposts are the other copies of a post: the original, when the post
+// is a crosspost, and the crossposts sharing it.
+type Crossposts struct {
+	Original   *models.Post  `json:"original,omitempty"`
+	Crossposts []models.Post `json:"crossposts"`
+}
+
+// ListCrossposts finds the copies of a post the viewer can see, each with
+// its topic and score, oldest crosspost first.
+func ListCrossposts(c context.Context, req GetRequest) (*Crossposts, error) {
+	post, _, err := findTarget(c, Store, models.IDs{TopicID: req.TopicID, PostID: req.PostID}, Visible(c))
+	if err != nil {
+		return nil, err
+	}
+	result := &Crossposts{}
+	original := models.Post{Model: models.Model{ID: post.ID}, TopicID: post.TopicID}
+	if post.IsCrosspost() {
+		original = models.Post{Model: models.Model{ID: post.CrosspostOf}, TopicID: post.CrosspostTopic}
+		originals, err := store.Find(c, Store, original, store.Preload("Author"), Visible(c))
+		if err != nil {
+			return nil, err
+		}
+		if len(originals) > 0 {
+			result.Original = &originals[0]
+		}
+	}
+	result.Crossposts, err = store.Find(c, Store, models.Post{CrosspostTopic: original.TopicID, CrosspostOf: original.ID}, store.Where("id", "<>", post.ID), store.Preload("Author"), Visible(c), store.OrderBy("created_at"))
+	return result, err
+}
+
+// AttachOriginal sets the post a crosspost shares, with its author, image,
+// preview and poll, unless it is gone or hidden from the viewer.
+func AttachOriginal(c context.Context, post *models.Post) error {
+	if !post.IsCrosspost() {
+		return nil
+	}
+	originals, err := store.Find(c, Store, models.Post{Model: models.Model{ID: post.CrosspostOf}, TopicID: post.CrosspostTopic}, store.Preload("Author"), store.Preload("Media"), Visible(c))
+	if err != nil || len(originals) == 0 {
+		return err
+	}
+	original := &originals[0]
+	LinkMedia(original.Media)
+	if err := AttachPreview(c, original); err != nil {
+		return err
+	}
+	if err := AttachPoll(c, original); err != nil {
+		return err
+	}
+	post.Original = original
+	return nil
+}
+
+// DeletePost deletes a post and, since they have nothing of their own to
+// show without it, its crossposts.
+func DeletePost(c context.Context, s store.Store, topicID string, postID string) error {
+	if _, err := store.Delete(c, s, models.Post{Model: models.Model{ID: postID}, TopicID: topicID}); err != nil {
+		return err
+	}
+	_, err := store.Delete(c, s, models.Post{CrosspostTopic: topicID, CrosspostOf: postID})
+	return err
+}
+
+// RestoreCrossposts restores the crossposts deleted along with a post,
+// which are those deleted no earlier than it was.
+func RestoreCrossposts(c context.Context, s store.Store, post *models.Post) error {
+	if !post.DeletedAt.Valid {
+		return nil
+	}
+	crossposts, err := store.Find(c, s, models.Post{CrosspostTopic: post.TopicID, CrosspostOf: post.ID}, store.Deleted(), store.Where("deleted_at", ">=", post.DeletedAt.Time))
+	if err != nil {
+		return err
+	}
+	for _, crosspost := range crossposts {
+		if _, err := store.Restore(c, s, models.Post{Model: models.Model{ID: crosspost.ID}, TopicID: crosspost.TopicID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestCrossposts shares a post into other topics on each store, and
+// deletes and restores the crossposts along with it.
+func TestCrossposts(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testCrossposts(t, s)
+		})
+	}
+}
+
+func testCrossposts(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.Topic{Model: models.Model{ID: "zig"}},
+		&models.Topic{Model: models.Model{ID: "python"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Generics are here", Content: "Original **content**"},
+	)
+
+	crosspost := func(topic, post, token string, body map[string]any) (int, models.Post) {
+		t.Helper()
+		var got models.Post
+		rec := call(t, e, http.MethodPost, "/v1/topics/"+topic+"/posts/"+post+"/crossposts", token, body, &got)
+		return rec.Code, got
+	}
+	code, rust := crosspost("golang", "p1", bobToken, map[string]any{"topic": "rust"})
+	if code != http.StatusCreated || rust.TopicID != "rust" || rust.Title != "Generics are here" || rust.Kind != models.PostCrosspost || rust.CrosspostTopic != "golang" || rust.CrosspostOf != "p1" || rust.AuthorID != bob.ID {
+		t.Fatalf("crosspost into rust: got %d %+v", code, rust)
+	}
+	code, zig := crosspost("rust", rust.ID, bobToken, map[string]any{"topic": "zig", "title": "Mine"})
+	if code != http.StatusCreated || zig.Title != "Mine" || zig.CrosspostTopic != "golang" || zig.CrosspostOf != "p1" {
+		t.Errorf("crosspost the crosspost into zig: got %d %+v", code, zig)
+	}
+	for _, tc := range []struct {
+		what, topic, post, token string
+		body                     map[string]any
+		want                     int
+	}{
+		{"into its own topic", "golang", "p1", bobToken, map[string]any{"topic": "golang"}, http.StatusBadRequest},
+		{"a crosspost into the original's topic", "rust", rust.ID, bobToken, map[string]any{"topic": "golang"}, http.StatusBadRequest},
+		{"again", "golang", "p1", aliceToken, map[string]any{"topic": "rust"}, http.StatusConflict},
+		{"into a missing topic", "golang", "p1", bobToken, map[string]any{"topic": "haskell"}, http.StatusNotFound},
+		{"into an invalid topic", "golang", "p1", bobToken, map[string]any{"topic": "a"}, http.StatusBadRequest},
+		{"a missing post", "golang", "p9", bobToken, map[string]any{"topic": "rust"}, http.StatusNotFound},
+		{"signed out", "golang", "p1", "", map[string]any{"topic": "python"}, http.StatusUnauthorized},
+	} {
+		if code, _ := crosspost(tc.topic, tc.post, tc.token, tc.body); code != tc.want {
+			t.Errorf("crosspost %s: got %d, want %d", tc.what, code, tc.want)
+		}
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/crosspost", url.Values{"topic": {"python"}}, login(t, bob)); rec.Code != http.StatusCreated {
+		t.Errorf("crosspost through the page: got %d %s", rec.Code, rec.Body)
+	}
+
+	var got models.Post
+	call(t, e, http.MethodGet, "/v1/topics/rust/posts/"+rust.ID, "", nil, &got)
+	if got.Original == nil || got.Original.ID != "p1" || got.Original.Author == nil || got.Original.Author.Username != "alice" {
+		t.Errorf("the v1 crosspost: got original %+v", got.Original)
+	}
+	if body := get(e, "/topics/rust").Body.String(); !strings.Contains(body, `(crossposted from <a href="/topics/golang/posts/p1">golang</a>)`) {
+		t.Errorf("the listing does not mark the crosspost: %s", body)
+	}
+	if body := get(e, "/topics/rust/posts/"+rust.ID).Body.String(); !strings.Contains(body, "<strong>content</strong>") || !strings.Contains(body, `by <a href="/u/alice">alice</a> &middot; <a href="/topics/golang/posts/p1">Generics are here</a>`) {
+		t.Errorf("the crosspost page does not show the original: %s", body)
+	}
+
+	// zig's crosspost is removed on its own before the original goes.
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/zig/posts/"+zig.ID, bobToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete the zig crosspost: %d", rec.Code)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/posts/p1", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete the original: %d", rec.Code)
+	}
+	live := func() string {
+		t.Helper()
+		var topics []string
+		for _, topic := range []string{"rust", "zig", "python"} {
+			var list models.ListResponse[models.Post]
+			call(t, e, http.MethodGet, "/v1/topics/"+topic+"/posts", "", nil, &list)
+			topics = append(topics, fmt.Sprintf("%s=%d", topic, len(list.Items)))
+		}
+		return strings.Join(topics, " ")
+	}
+	if got := live(); got != "rust=0 zig=0 python=0" {
+		t.Errorf("crossposts after deleting the original: got %s", got)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/restore", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("restore the original: %d %s", rec.Code, rec.Body)
+	}
+	if got := live(); got != "rust=1 zig=0 python=1" {
+		t.Errorf("crossposts after restoring the original: got %s", got)
+	}
+
+	// A crosspost whose original is gone says so.
+	if _, err := store.Delete(context.Background(), Store, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+	if body := get(e, "/topics/rust/posts/"+rust.ID).Body.String(); !strings.Contains(body, "crossposted from a post that is no longer available") {
+		t.Errorf("the crosspost page with the original gone: %s", body)
+	}
+	if _, err := store.Restore(context.Background(), Store, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the original through a report removes its crossposts too.
+	var report models.Report
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/reports", bobToken, map[string]any{"reason": "spam"}, &report); rec.Code != http.StatusCreated {
+		t.Fatalf("report the original: %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/reports/"+report.ID+"/remove", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("remove the original: %d %s", rec.Code, rec.Body)
+	}
+	if got := live(); got != "rust=0 zig=0 python=0" {
+		t.Errorf("crossposts after removing the original: got %s", got)
+	}
+}
+
+// TestListCrossposts crossposts a post into two topics and checks the
+// original lists both copies, and each copy links back to the original
+// and to the other copy.
+func TestListCrossposts(t *testing.T) {
+	e := newServer(t)
+	_, alice := newUser(t, "alice")
+	_, bob := newUser(t, "bob")
+	c := context.Background()
+	for _, topic := range []string{"golang", "books", "rust"} {
+		if _, err := store.Create(c, Store, models.Topic{Model: models.Model{ID: topic}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var original models.Post
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", alice, map[string]any{"model": map[string]any{"title": "Hello"}}, &original); rec.Code != http.StatusCreated {
+		t.Fatalf("create post: %d %s", rec.Code, rec.Body)
+	}
+	originalPath := "/v1/topics/golang/posts/" + original.ID
+	crosspost := func(topic string) models.Post {
+		t.Helper()
+		var post models.Post
+		if rec := call(t, e, http.MethodPost, originalPath+"/crossposts", bob, map[string]any{"topic": topic}, &post); rec.Code != http.StatusCreated {
+			t.Fatalf("crosspost into %s: %d %s", topic, rec.Code, rec.Body)
+		}
+		return post
+	}
+	books, rust := crosspost("books"), crosspost("rust")
+	if err := Store.Increment(c, &models.Post{Model: models.Model{ID: books.ID}, TopicID: "books"}, "votes", 3); err != nil {
+		t.Fatal(err)
+	}
+	list := func(path string) Crossposts {
+		t.Helper()
+		var got Crossposts
+		if rec := call(t, e, http.MethodGet, path+"/crossposts", "", nil, &got); rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, rec.Code, rec.Body)
+		}
+		return got
+	}
+
+	got := list(originalPath)
+	if got.Original != nil {
+		t.Errorf("the original has an original: %+v", got.Original)
+	}
+	if len(got.Crossposts) != 2 || got.Crossposts[0].ID != books.ID || got.Crossposts[1].ID != rust.ID {
+		t.Fatalf("crossposts of the original: got %+v", got.Crossposts)
+	}
+	if got.Crossposts[0].TopicID != "books" || got.Crossposts[0].Votes != 3 {
+		t.Errorf("crosspost into books: got topic %q with %d votes", got.Crossposts[0].TopicID, got.Crossposts[0].Votes)
+	}
+
+	got = list("/v1/topics/books/posts/" + books.ID)
+	if got.Original == nil || got.Original.ID != original.ID || got.Original.TopicID != "golang" {
+		t.Errorf("original of a crosspost: got %+v", got.Original)
+	}
+	if len(got.Crossposts) != 1 || got.Crossposts[0].ID != rust.ID {
+		t.Errorf("other crossposts: got %+v", got.Crossposts)
+	}
+
+	if got := list("/topics/golang/posts/" + original.ID); len(got.Crossposts) != 2 {
+		t.Errorf("crossposts through the site route: got %+v", got.Crossposts)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/missing/crossposts", "", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("crossposts of a missing post: got %d, want 404", rec.Code)
+	}
+}
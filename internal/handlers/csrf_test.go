@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestCSRF loads the login page for its token, and checks a form POST is
+// refused without it and accepted with it in the header or a form field.
+func TestCSRF(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	newUser(t, "alice")
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+	match := regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)">`).FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatalf("no csrf-token meta tag on the login page:\n%s", rec.Body)
+	}
+	token := match[1]
+	var cookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == CSRFCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != token || !cookie.HttpOnly {
+		t.Fatalf("csrf cookie: got %+v, want an HttpOnly cookie holding %q", cookie, token)
+	}
+
+	login := func(header, field string, cookies ...*http.Cookie) int {
+		values := url.Values{"username": {"alice"}, "password": {"password"}}
+		if field != "" {
+			values.Set(CSRFCookie, field)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(values.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		if header != "" {
+			req.Header.Set(echo.HeaderXCSRFToken, header)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, tc := range []struct {
+		name          string
+		header, field string
+		cookies       []*http.Cookie
+		want          int
+	}{
+		{"no token", "", "", []*http.Cookie{cookie}, http.StatusForbidden},
+		{"wrong token", "forged", "", []*http.Cookie{cookie}, http.StatusForbidden},
+		{"token without the cookie", token, "", nil, http.StatusForbidden},
+		{"header", token, "", []*http.Cookie{cookie}, http.StatusOK},
+		{"form field", "", token, []*http.Cookie{cookie}, http.StatusOK},
+	} {
+		if got := login(tc.header, tc.field, tc.cookies...); got != tc.want {
+			t.Errorf("login with %s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	if rec := call(t, e, http.MethodPost, "/v1/token", "", map[string]string{"username": "alice", "password": "password"}, nil); rec.Code != http.StatusOK {
+		t.Errorf("v1 token without a csrf token: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestDebug checks that only site admins reach /debug, by session or by
+// bearer token.
+func TestDebug(t *testing.T) {
+	e := newServer(t)
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"alice"}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	debug := func(path string, auth func(*http.Request)) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		auth(req)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set(echo.HeaderAuthorization, "Bearer "+token) }
+	}
+	session := func(cookie *http.Cookie) func(*http.Request) {
+		return func(req *http.Request) { req.AddCookie(cookie) }
+	}
+	for _, tc := range []struct {
+		what string
+		auth func(*http.Request)
+		want int
+	}{
+		{"signed out", func(*http.Request) {}, http.StatusUnauthorized},
+		{"with an invalid token", bearer("not a token"), http.StatusUnauthorized},
+		{"as a non-admin with a token", bearer(bobToken), http.StatusForbidden},
+		{"as a non-admin with a session", session(login(t, bob)), http.StatusForbidden},
+		{"as an admin with a token", bearer(aliceToken), http.StatusOK},
+		{"as an admin with a session", session(login(t, alice)), http.StatusOK},
+	} {
+		if rec := debug("/debug/pprof/", tc.auth); rec.Code != tc.want {
+			t.Errorf("the pprof index %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	for path, want := range map[string]string{
+		"/debug/pprof/":                  "goroutine",
+		"/debug/pprof/goroutine?debug=1": "goroutine profile:",
+		"/debug/pprof/cmdline":           "",
+		"/debug/vars":                    `"memstats"`,
+	} {
+		if rec := debug(path, bearer(aliceToken)); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: got %d, missing %q", path, rec.Code, want)
+		}
+	}
+	if rec := debug("/debug/vars", bearer(bobToken)); rec.Code != http.StatusForbidden {
+		t.Errorf("/debug/vars as a non-admin: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// DecaySetting names the setting holding the half-life the stored decayed
+// scores were computed with.
+const DecaySetting = "decay_half_life"
+
+// RescoreDecay recomputes the decayed score of every post, deleted ones
+// included, when the half-life changed since the scores were computed, and
+// returns how many scores changed. Like RekeyTitles it records the
+// half-life last, so a run cut short is picked up again by the next one.
+func RescoreDecay(c context.Context) (int, error) {
+	halfLife := models.Decay.HalfLife.String()
+	setting, err := store.Get(c, Store, models.Setting{Key: DecaySetting})
+	recorded := err == nil
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return 0, err
+	}
+	if recorded && setting.Value == halfLife {
+		return 0, nil
+	}
+	posts, err := store.Find(c, Store, models.Post{}, store.Unscoped(), store.Select("id", "topic_id", "votes", "created_at", "decayed_score"))
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, post := range posts {
+		score := models.Decayed(post.Votes, post.CreatedAt, models.Decay.HalfLife)
+		if score == post.DecayedScore {
+			continue
+		}
+		id := models.Post{Model: models.Model{ID: post.ID}, TopicID: post.TopicID}
+		if err := Store.UpdateColumns(c, &models.Post{}, &id, map[string]any{"decayed_score": score}, store.Unscoped()); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	if !recorded {
+		return changed, Store.Create(c, &models.Setting{Key: DecaySetting, Value: halfLife})
+	}
+	return changed, Store.Update(c, &models.Setting{Key: DecaySetting}, map[string]any{"value": halfLife})
+}
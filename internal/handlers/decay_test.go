@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestDecayedFeeds turns score decay on and checks a week-old post with
+// many votes drops below a fresh one with fewer in the home feed and on the
+// front page, but not in the topic's own listing until topics opt in.
+func TestDecayedFeeds(t *testing.T) {
+	e := newServer(t)
+	decay := models.Decay
+	t.Cleanup(func() { models.Decay = decay })
+	models.Decay = models.ScoreDecay{}
+	alice, token := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Subscription{UserID: alice.ID, TopicID: "golang"},
+		&models.Post{Model: models.Model{ID: "old", CreatedAt: time.Now().Add(-7 * 24 * time.Hour)}, TopicID: "golang", AuthorID: alice.ID, Title: "Old", Votes: 100},
+		&models.Post{Model: models.Model{ID: "fresh"}, TopicID: "golang", AuthorID: alice.ID, Title: "Fresh", Votes: 20},
+	)
+	list := func(path string) string {
+		t.Helper()
+		var page models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, path, token, nil, &page); rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, rec.Code, rec.Body)
+		}
+		var ids []string
+		for _, post := range page.Items {
+			ids = append(ids, post.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	front := func() string {
+		t.Helper()
+		posts, err := FrontPage(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	for _, tc := range []struct {
+		what  string
+		decay models.ScoreDecay
+		// home and topic are the top sorts of the home feed and the topic
+		// listing.
+		home, topic, front string
+	}{
+		{"without decay", models.ScoreDecay{}, "[old fresh]", "[old fresh]", "[fresh old]"},
+		{"with a day's half-life", models.ScoreDecay{HalfLife: 24 * time.Hour}, "[fresh old]", "[old fresh]", "[fresh old]"},
+		{"with a year's half-life", models.ScoreDecay{HalfLife: 365 * 24 * time.Hour}, "[old fresh]", "[old fresh]", "[old fresh]"},
+		{"with decay in topics too", models.ScoreDecay{HalfLife: 24 * time.Hour, Topics: true}, "[fresh old]", "[fresh old]", "[fresh old]"},
+	} {
+		models.Decay = tc.decay
+		if _, err := RescoreDecay(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := list("/v1/home?sort=top&t=all"); got != tc.home {
+			t.Errorf("home feed %s: got %s, want %s", tc.what, got, tc.home)
+		}
+		if got := list("/v1/topics/golang/posts?sort=top&t=all"); got != tc.topic {
+			t.Errorf("topic listing %s: got %s, want %s", tc.what, got, tc.topic)
+		}
+		if got := front(); got != tc.front {
+			t.Errorf("front page %s: got %s, want %s", tc.what, got, tc.front)
+		}
+	}
+}
+
+// TestRescoreDecay changes the half-life and checks the stored scores of
+// live and deleted posts follow it once, leaving votes and updated_at alone.
+func TestRescoreDecay(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			saved, decay := Store, models.Decay
+			t.Cleanup(func() { Store, models.Decay = saved, decay })
+			Store, models.Decay = s, models.ScoreDecay{}
+			testRescoreDecay(t)
+		})
+	}
+}
+
+func testRescoreDecay(t *testing.T) {
+	c := context.Background()
+	for _, obj := range []any{
+		&models.User{Model: models.Model{ID: "u1"}, Username: "alice"},
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: "u1", Title: "One", Votes: 4},
+		&models.Post{Model: models.Model{ID: "gone", DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}}, TopicID: "golang", AuthorID: "u1", Title: "Gone", Votes: 2},
+	} {
+		if err := Store.Create(c, obj); err != nil {
+			t.Fatalf("create %T: %v", obj, err)
+		}
+	}
+	if n, err := RescoreDecay(c); err != nil || n != 0 {
+		t.Errorf("first run without decay: got %d, %v", n, err)
+	}
+	before, err := store.Get(c, Store, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models.Decay.HalfLife = time.Hour
+	if n, err := RescoreDecay(c); err != nil || n != 2 {
+		t.Errorf("rescore with a half-life: got %d, %v; want 2", n, err)
+	}
+	if n, err := RescoreDecay(c); err != nil || n != 0 {
+		t.Errorf("rescore again: got %d, %v", n, err)
+	}
+	var posts []models.Post
+	if err := Store.Find(c, &posts, &models.Post{TopicID: "golang"}, store.Unscoped(), store.OrderBy("id")); err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		if want := models.Decayed(post.Votes, post.CreatedAt, time.Hour); post.DecayedScore != want || want == 0 {
+			t.Errorf("score of %s: got %v, want %v", post.ID, post.DecayedScore, want)
+		}
+		if post.ID == "p1" && (post.Votes != 4 || !post.UpdatedAt.Equal(before.UpdatedAt)) {
+			t.Errorf("p1 went from %d votes at %v to %d at %v", before.Votes, before.UpdatedAt, post.Votes, post.UpdatedAt)
+		}
+	}
+	setting, err := store.Get(c, Store, models.Setting{Key: DecaySetting})
+	if err != nil || setting.Value != "1h0m0s" {
+		t.Errorf("recorded half-life: got %+v, %v", setting, err)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/store"
+)
+
+// ErrorKind is the class of an error, named after and valued as the HTTP
+// status it is reported with.
+type ErrorKind int
+
+const (
+	BadRequest       ErrorKind = http.StatusBadRequest
+	Unauthorized     ErrorKind = http.StatusUnauthorized
+	Forbidden        ErrorKind = http.StatusForbidden
+	NotFound         ErrorKind = http.StatusNotFound
+	Conflict         ErrorKind = http.StatusConflict
+	TooLarge         ErrorKind = http.StatusRequestEntityTooLarge
+	UnsupportedMedia ErrorKind = http.StatusUnsupportedMediaType
+	TooManyRequests  ErrorKind = http.StatusTooManyRequests
+	Internal         ErrorKind = http.StatusInternalServerError
+	BadGateway       ErrorKind = http.StatusBadGateway
+	Unavailable      ErrorKind = http.StatusServiceUnavailable
+	// Validation errors are bad requests that also list the invalid fields.
+	Validation = BadRequest
+)
+
+// Error gives an error a kind and a stable machine-readable code, which
+// clients can rely on where the message may change.
+type Error struct {
+	Kind ErrorKind
+	Code string
+	Err  error
+}
+
+func NewError(kind ErrorKind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Err: errors.New(message)}
+}
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Code     string      `json:"code"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Fields   FieldErrors `json:"fields,omitempty"`
+}
+
+// StoreErrors reports the store's errors without their database wording.
+var StoreErrors = map[error]*Error{
+	store.ErrNotFound:           NewError(NotFound, "not_found", "resource not found"),
+	store.ErrDuplicatedKey:      NewError(Conflict, "already_exists", "resource already exists"),
+	store.ErrInvalidSort:        {Kind: BadRequest, Code: "invalid_sort", Err: store.ErrInvalidSort},
+	store.ErrInvalidCommentSort: {Kind: BadRequest, Code: "invalid_sort", Err: store.ErrInvalidCommentSort},
+	store.ErrInvalidPageToken:   {Kind: BadRequest, Code: "invalid_page_token", Err: store.ErrInvalidPageToken},
+	store.ErrEmptyQuery:         {Kind: BadRequest, Code: "empty_query", Err: store.ErrEmptyQuery},
+	store.ErrSearchUnavailable:  {Kind: Unavailable, Code: "search_unavailable", Err: store.ErrSearchUnavailable},
+}
+
+func Classify(err error) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	var fields FieldErrors
+	if errors.As(err, &fields) {
+		return &Error{Kind: Validation, Code: "validation_failed", Err: err}
+	}
+	for cause, known := range StoreErrors {
+		if errors.Is(err, cause) {
+			return known
+		}
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		code := strings.ReplaceAll(strings.ToLower(http.StatusText(httpErr.Code)), " ", "_")
+		return &Error{Kind: ErrorKind(httpErr.Code), Code: code, Err: fmt.Errorf("%v", httpErr.Message)}
+	}
+	return &Error{Kind: Internal, Code: "internal", Err: err}
+}
+
+// Fail writes err as a problem+json response. Internal errors are logged
+// and reported without a detail so database messages stay private.
+func Fail(c echo.Context, err error) error {
+	e := Classify(err)
+	problem := Problem{Type: "about:blank", Title: http.StatusText(int(e.Kind)), Status: int(e.Kind), Code: e.Code, Detail: e.Error(), Instance: c.Request().URL.Path}
+	if e.Kind == Internal {
+		logging.FromContext(c.Request().Context()).Error("request failed", "error", err)
+		problem.Detail = ""
+	}
+	errors.As(err, &problem.Fields)
+	c.Response().Header().Set(echo.HeaderContentType, "application/problem+json")
+	return c.JSON(problem.Status, problem)
+}
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	if err := Fail(c, err); err != nil {
+		logging.FromContext(c.Request().Context()).Error("failed to write the error response", "error", err)
+	}
+}
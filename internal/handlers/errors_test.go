@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestProblems provokes each kind of failure and checks it is reported as
+// problem details with its status and stable code.
+func TestProblems(t *testing.T) {
+	e := newServer(t)
+	alice, token := newUser(t, "alice")
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+
+	raw := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, tc := range []struct {
+		name string
+		rec  *httptest.ResponseRecorder
+		path string
+		code string
+		want int
+	}{
+		{"missing topic", call(t, e, http.MethodGet, "/v1/topics/rust", "", nil, nil), "/v1/topics/rust", "not_found", http.StatusNotFound},
+		{"post to a missing topic", call(t, e, http.MethodPost, "/v1/topics/rust/posts", token, map[string]any{"model": map[string]any{"title": "Hello"}}, nil), "/v1/topics/rust/posts", "not_found", http.StatusNotFound},
+		{"form post to a missing topic", postForm(e, "/topics/rust/posts", url.Values{"title": {"Hello"}}, login(t, alice)), "/topics/rust/posts", "not_found", http.StatusNotFound},
+		{"unknown route", call(t, e, http.MethodGet, "/nowhere", "", nil, nil), "/nowhere", "not_found", http.StatusNotFound},
+		{"bad credentials", call(t, e, http.MethodPost, "/v1/token", "", map[string]string{"username": "alice", "password": "wrong"}, nil), "/v1/token", "invalid_credentials", http.StatusUnauthorized},
+		{"bad token", call(t, e, http.MethodGet, "/v1/topics", "forged", nil, nil), "/v1/topics", "invalid_token", http.StatusUnauthorized},
+		{"not logged in", call(t, e, http.MethodPost, "/v1/topics", "", map[string]any{"model": map[string]any{"id": "rust"}}, nil), "/v1/topics", "not_logged_in", http.StatusUnauthorized},
+		{"malformed JSON", raw(http.MethodPost, "/v1/topics", "{"), "/v1/topics", "bad_request", http.StatusBadRequest},
+		{"conflict", call(t, e, http.MethodPost, "/v1/topics", token, map[string]any{"model": map[string]any{"id": "golang"}}, nil), "/v1/topics", "already_exists", http.StatusConflict},
+		{"validation", call(t, e, http.MethodPost, "/v1/topics", token, map[string]any{"model": map[string]any{"id": "go"}}, nil), "/v1/topics", "validation_failed", http.StatusBadRequest},
+		{"invalid sort", call(t, e, http.MethodGet, "/v1/topics/golang/posts?sort=sideways", "", nil, nil), "/v1/topics/golang/posts", "invalid_sort", http.StatusBadRequest},
+		{"csrf", raw(http.MethodPost, "/logout", ""), "/logout", "invalid_csrf", http.StatusForbidden},
+	} {
+		var problem Problem
+		if err := json.Unmarshal(tc.rec.Body.Bytes(), &problem); err != nil {
+			t.Errorf("%s: decode %q: %v", tc.name, tc.rec.Body, err)
+			continue
+		}
+		if got := tc.rec.Header().Get(echo.HeaderContentType); got != "application/problem+json" {
+			t.Errorf("%s: content type %q", tc.name, got)
+		}
+		want := Problem{Type: "about:blank", Title: http.StatusText(tc.want), Status: tc.want, Code: tc.code, Detail: problem.Detail, Instance: tc.path, Fields: problem.Fields}
+		if tc.rec.Code != tc.want || problem.Detail == "" || fmt.Sprint(problem) != fmt.Sprint(want) {
+			t.Errorf("%s: got %d %+v, want %+v", tc.name, tc.rec.Code, problem, want)
+		}
+		if strings.Contains(problem.Detail, "record") || strings.Contains(problem.Detail, "UNIQUE") {
+			t.Errorf("%s: the store's wording reached the client: %q", tc.name, problem.Detail)
+		}
+	}
+	if n, err := Store.Count(context.Background(), &models.Post{}, &models.Post{TopicID: "rust"}, store.Unscoped()); err != nil || n != 0 {
+		t.Errorf("posts stored in the missing topic: got %d, %v", n, err)
+	}
+	rec := httptest.NewRecorder()
+	e.Logger.SetOutput(io.Discard)
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/v1/topics", nil), rec)
+	if err := Fail(c, fmt.Errorf("list topics: %w", errors.New("connection refused"))); err != nil {
+		t.Fatal(err)
+	}
+	var problem Problem
+	json.Unmarshal(rec.Body.Bytes(), &problem)
+	if rec.Code != http.StatusInternalServerError || problem.Code != "internal" || problem.Detail != "" {
+		t.Errorf("internal error: got %d %+v, want 500 without a detail", rec.Code, problem)
+	}
+	if got := Classify(fmt.Errorf("get: %w", store.ErrNotFound)); got.Kind != NotFound || got.Code != "not_found" {
+		t.Errorf("wrapped store error: got %+v", got)
+	}
+}
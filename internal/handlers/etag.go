@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// buffered holds back what a handler writes so it can be tagged, or
+// dropped for a 304, before it is sent.
+type buffered struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *buffered) WriteHeader(status int)      { b.status = status }
+func (b *buffered) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// Conditional tags successful GET responses with an ETag and answers 304
+// Not Modified when If-None-Match already names it, so polling clients
+// only download what changed. The tag is a hash of the body rather than
+// of UpdatedAt: pages also carry votes, the viewer's own votes and unread
+// counts, none of which move a row's UpdatedAt. Responses must still be
+// revalidated every time, and ones meant for a single viewer are kept out
+// of shared caches.
+func Conditional(h echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Method != http.MethodGet && c.Request().Method != http.MethodHead {
+			return h(c)
+		}
+		res := c.Response()
+		writer := res.Writer
+		buf := &buffered{ResponseWriter: writer, status: http.StatusOK}
+		res.Writer = buf
+		err := h(c)
+		res.Writer = writer
+		if !res.Committed {
+			return err
+		}
+		if buf.status == http.StatusOK {
+			sum := sha256.Sum256(buf.body.Bytes())
+			etag := `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+			header := res.Header()
+			header.Set("ETag", etag)
+			if CurrentUser(c.Request().Context()) != nil || strings.HasPrefix(header.Get(echo.HeaderContentType), echo.MIMETextHTML) {
+				header.Set("Cache-Control", "private, no-cache")
+			} else {
+				header.Set("Cache-Control", "public, no-cache")
+				header.Add(echo.HeaderVary, echo.HeaderAuthorization)
+			}
+			if matchETag(c.Request().Header.Get("If-None-Match"), etag) {
+				header.Del(echo.HeaderContentType)
+				res.Status, res.Size = http.StatusNotModified, 0
+				writer.WriteHeader(http.StatusNotModified)
+				return err
+			}
+		}
+		writer.WriteHeader(buf.status)
+		if _, werr := writer.Write(buf.body.Bytes()); werr != nil && err == nil {
+			err = werr
+		}
+		return err
+	}
+}
+
+// matchETag compares the tags in an If-None-Match header to etag, ignoring
+// whether either is weak as RFC 9110 asks for GET.
+func matchETag(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// TestConditional repeats GETs with the ETag they returned.
+func TestConditional(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "First"},
+	)
+	request := func(path, token, ifNoneMatch string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("/v1/topics/golang/posts", "", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || len(etag) < 4 || etag[:3] != `W/"` || rec.Header().Get("Cache-Control") != "public, no-cache" || rec.Header().Get(echo.HeaderVary) != echo.HeaderAuthorization {
+		t.Fatalf("an anonymous list: got %d %v", rec.Code, rec.Header())
+	}
+	for _, match := range []string{etag, etag[2:], `"stale", ` + etag, "*"} {
+		if rec := request("/v1/topics/golang/posts", "", match); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 || rec.Header().Get("ETag") != etag {
+			t.Errorf("If-None-Match %s: got %d %q", match, rec.Code, rec.Body)
+		}
+	}
+	if rec := request("/v1/topics/golang/posts", "", `W/"stale"`); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("a stale tag: got %d", rec.Code)
+	}
+	post := map[string]any{"model": map[string]any{"title": "Second"}}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", aliceToken, post, nil); rec.Code != http.StatusCreated || rec.Header().Get("ETag") != "" {
+		t.Errorf("a new post: got %d with ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	if rec := request("/v1/topics/golang/posts", "", etag); rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Errorf("the list after a new post: got %d with the same tag", rec.Code)
+	}
+	if rec := request("/v1/topics/golang/posts", aliceToken, ""); rec.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Errorf("a signed in list: got Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+	if rec := request("/v1/topics/rust", "", ""); rec.Code != http.StatusNotFound || rec.Header().Get("ETag") != "" {
+		t.Errorf("a missing topic: got %d with ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	csrf := &http.Cookie{Name: CSRFCookie, Value: csrfToken}
+	session := login(t, alice)
+	rec = request("/topics/golang", "", "", csrf, session)
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("the topic page: got %d %v", rec.Code, rec.Header())
+	}
+	if again := request("/topics/golang", "", rec.Header().Get("ETag"), csrf, session); again.Code != http.StatusNotModified {
+		t.Errorf("the topic page again: got %d", again.Code)
+	}
+	for _, path := range []string{"/", "/topics", "/feed.rss", "/topics/golang/feed.rss", "/topics/golang/posts"} {
+		rec := request(path, "", "", csrf)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got %d", path, rec.Code)
+			continue
+		}
+		if again := request(path, "", rec.Header().Get("ETag"), csrf); again.Code != http.StatusNotModified {
+			t.Errorf("%s again: got %d", path, again.Code)
+		}
+	}
+}
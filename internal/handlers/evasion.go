@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrReviewResolved = NewError(Conflict, "review_resolved", "this review has already been resolved")
+
+type EvasionRequest struct {
+	ReviewID string `param:"reviewid"`
+}
+
+// CheckEvasion records that user signed in from ip and, when it is an
+// address a banned user has signed in from, shadow removes the user's
+// content and holds the account for an admin to review. Accounts that were
+// reviewed before, admins and accounts already shadowbanned are left
+// alone. It does nothing unless Features.ShadowRemoveEvaders is on.
+func CheckEvasion(c context.Context, user *models.User, ip string) error {
+	if !Features.ShadowRemoveEvaders || ip == "" {
+		return nil
+	}
+	address := models.UserAddress{UserID: user.ID, IP: ip, LastSeen: time.Now()}
+	if err := Store.Create(c, &address); errors.Is(err, store.ErrDuplicatedKey) {
+		err = Store.UpdateColumns(c, &models.UserAddress{}, &models.UserAddress{UserID: user.ID, IP: ip}, map[string]any{"last_seen": address.LastSeen})
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if IsAdmin(user) || user.Shadowbanned || user.Banned {
+		return nil
+	}
+	if reviewed, err := Store.Count(c, &models.EvasionReview{}, &models.EvasionReview{UserID: user.ID}); err != nil || reviewed > 0 {
+		return err
+	}
+	shared, err := store.Find(c, Store, models.UserAddress{IP: ip}, store.Where("user_id", "<>", user.ID))
+	if err != nil || len(shared) == 0 {
+		return err
+	}
+	var ids []string
+	for _, other := range shared {
+		ids = append(ids, other.UserID)
+	}
+	banned, err := store.Find(c, Store, models.User{Banned: true}, store.Where("id", "IN", ids), store.OrderBy("created_at"), store.Page(models.PageRequest{Limit: 1}))
+	if err != nil || len(banned) == 0 {
+		return err
+	}
+	return Store.Transaction(c, func(tx store.Store) error {
+		review := models.EvasionReview{Model: models.Model{ID: uuid.NewString()}, UserID: user.ID, BannedUserID: banned[0].ID, IP: ip, Status: models.EvasionOpen}
+		if err := tx.Create(c, &review); err != nil {
+			return err
+		}
+		return setShadowbanned(c, tx, user, true)
+	})
+}
+
+// EvasionQueue lists the accounts held for sharing an address with a
+// banned user, oldest first, to site admins.
+func EvasionQueue(c context.Context, req models.PageRequest) (*models.ListResponse[models.EvasionReview], error) {
+	if err := Administer(c); err != nil {
+		return nil, err
+	}
+	return store.List(c, Store, models.EvasionReview{Status: models.EvasionOpen}, req, store.Preload("User", "BannedUser"))
+}
+
+// ResolveEvasion closes a review. Clearing it shows the account's content
+// again, and confirming it bans the account, leaving its content hidden.
+func ResolveEvasion(status string) func(context.Context, EvasionRequest) (*models.EvasionReview, error) {
+	return func(c context.Context, req EvasionRequest) (*models.EvasionReview, error) {
+		if err := Administer(c); err != nil {
+			return nil, err
+		}
+		review, err := store.Get(c, Store, models.EvasionReview{Model: models.Model{ID: req.ReviewID}})
+		if err != nil {
+			return nil, err
+		} else if review.Status != models.EvasionOpen {
+			return nil, ErrReviewResolved
+		}
+		user, err := store.Get(c, Store, models.User{Model: models.Model{ID: review.UserID}})
+		if err != nil {
+			return nil, err
+		}
+		err = Store.Transaction(c, func(tx store.Store) error {
+			if err := tx.Update(c, review, models.EvasionReview{Status: status, ResolvedByID: CurrentUser(c).ID}); err != nil {
+				return err
+			}
+			if status == models.EvasionCleared {
+				return setShadowbanned(c, tx, user, false)
+			}
+			if err := tx.Update(c, user, map[string]any{"banned": true}); err != nil {
+				return err
+			}
+			_, err := store.Delete(c, tx, models.Session{UserID: user.ID})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		review.Status, review.ResolvedByID = status, CurrentUser(c).ID
+		return review, nil
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestEvasion signs accounts in from a banned user's address and checks
+// their content is shown to them alone until an admin reviews them.
+func TestEvasion(t *testing.T) {
+	e := newServer(t)
+	features, admins := Features, Admins
+	t.Cleanup(func() { Features, Admins = features, admins })
+	Features.ShadowRemoveEvaders, Admins = true, []string{"dave"}
+	bob, _ := newUser(t, "bob")
+	mallory, malloryToken := newUser(t, "mallory")
+	newUser(t, "carol")
+	eve, eveToken := newUser(t, "eve")
+	newUser(t, "frank")
+	_, daveToken := newUser(t, "dave")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "m1"}, TopicID: "golang", AuthorID: mallory.ID, Title: "Mallory's"},
+		&models.Post{Model: models.Model{ID: "e1"}, TopicID: "golang", AuthorID: eve.ID, Title: "Eve's"},
+	)
+	signIn := func(username, ip string) int {
+		t.Helper()
+		body, _ := json.Marshal(LoginRequest{Username: username, Password: "password"})
+		req := httptest.NewRequest(http.MethodPost, "/v1/token", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	visible := func(post, token string) bool {
+		t.Helper()
+		return call(t, e, http.MethodGet, "/v1/topics/golang/posts/"+post, token, nil, nil).Code == http.StatusOK
+	}
+	queue := func() []string {
+		t.Helper()
+		var list models.ListResponse[models.EvasionReview]
+		if rec := call(t, e, http.MethodGet, "/v1/admin/evasion", daveToken, nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("the review queue: %d %s", rec.Code, rec.Body)
+		}
+		var got []string
+		for _, review := range list.Items {
+			got = append(got, review.User.Username+" like "+review.BannedUser.Username+" from "+review.IP)
+		}
+		return got
+	}
+
+	signIn("bob", "192.0.2.1")
+	if err := SetBanned(context.Background(), bob, true); err != nil {
+		t.Fatal(err)
+	}
+	signIn("carol", "198.51.100.7")
+	if code := signIn("mallory", "192.0.2.1"); code != http.StatusOK {
+		t.Fatalf("mallory signing in: got %d", code)
+	}
+	if visible("m1", "") || !visible("m1", malloryToken) {
+		t.Error("mallory's post is not shown to mallory alone")
+	}
+	if got := queue(); len(got) != 1 || got[0] != "mallory like bob from 192.0.2.1" {
+		t.Errorf("the review queue: got %q", got)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/admin/evasion", malloryToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("the review queue as a non-admin: got %d", rec.Code)
+	}
+
+	reviews, err := store.Find(context.Background(), Store, models.EvasionReview{UserID: mallory.ID})
+	if err != nil || len(reviews) != 1 {
+		t.Fatalf("mallory's reviews: got %d, %v", len(reviews), err)
+	}
+	clear := "/v1/admin/evasion/" + reviews[0].ID + "/clear"
+	if rec := call(t, e, http.MethodPost, clear, daveToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("clear mallory: %d %s", rec.Code, rec.Body)
+	}
+	if !visible("m1", "") {
+		t.Error("mallory's post is still hidden once cleared")
+	}
+	if rec := call(t, e, http.MethodPost, clear, daveToken, nil, nil); rec.Code != http.StatusConflict {
+		t.Errorf("clear mallory again: got %d, want 409", rec.Code)
+	}
+	signIn("mallory", "192.0.2.1")
+	if !visible("m1", "") || len(queue()) != 0 {
+		t.Error("mallory was held again after being cleared")
+	}
+
+	signIn("eve", "192.0.2.1")
+	reviews, err = store.Find(context.Background(), Store, models.EvasionReview{UserID: eve.ID})
+	if err != nil || len(reviews) != 1 {
+		t.Fatalf("eve's reviews: got %d, %v", len(reviews), err)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/admin/evasion/"+reviews[0].ID+"/confirm", daveToken, nil, nil); rec.Code != http.StatusOK {
+		t.Fatalf("confirm eve: %d %s", rec.Code, rec.Body)
+	}
+	if visible("e1", "") {
+		t.Error("eve's post is shown once the review is confirmed")
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics", eveToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("eve's token once banned: got %d, want 403", rec.Code)
+	}
+
+	Features.ShadowRemoveEvaders = false
+	signIn("frank", "192.0.2.1")
+	if n, err := Store.Count(context.Background(), &models.UserAddress{}, &models.UserAddress{IP: "192.0.2.1"}); err != nil || n != 3 {
+		t.Errorf("addresses recorded with the feature off: got %d, %v, want bob's, mallory's and eve's", n, err)
+	}
+	if len(queue()) != 0 {
+		t.Error("frank was held with the feature off")
+	}
+}
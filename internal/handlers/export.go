@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// ExportBatch is how many rows of each kind an export loads at a time.
+var ExportBatch = 500
+
+// UserExport is everything a user has posted, voted on, subscribed to and
+// saved, as GET /v1/users/me/export writes it.
+type UserExport struct {
+	User          *models.User          `json:"user"`
+	Posts         []models.Post         `json:"posts"`
+	Comments      []models.Comment      `json:"comments"`
+	Votes         []models.Vote         `json:"votes"`
+	Subscriptions []models.Subscription `json:"subscriptions"`
+	Saved         []models.Saved        `json:"saved"`
+}
+
+type ExportRequest struct {
+	Username string `param:"username"`
+}
+
+// exportUser returns the user whose data is exported: the current user
+// for "me" or their own name, and anyone for an admin acting on their
+// behalf.
+func exportUser(c context.Context, username string) (*models.User, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	if username == "me" || username == user.Username {
+		return user, nil
+	}
+	if err := Administer(c); err != nil {
+		return nil, err
+	}
+	return UserByName(c, username)
+}
+
+// HandleExport streams a user's data as a UserExport, a batch of rows at
+// a time, rather than loading all of it first. Once the first bytes are
+// out an error can only cut the download short, which leaves invalid
+// JSON behind.
+func HandleExport(c echo.Context) error {
+	var req ExportRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	ctx := c.Request().Context()
+	user, err := exportUser(ctx, req.Username)
+	if err != nil {
+		return Fail(c, err)
+	}
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.json"`, user.Username))
+	res.WriteHeader(http.StatusOK)
+	err = exportJSON(res, `{"user":`, user)
+	if err == nil {
+		err = exportSection(ctx, res, "posts", models.Post{AuthorID: user.ID}, "created_at", "id")
+	}
+	if err == nil {
+		err = exportSection(ctx, res, "comments", models.Comment{AuthorID: user.ID}, "created_at", "id")
+	}
+	if err == nil {
+		err = exportSection(ctx, res, "votes", models.Vote{UserID: user.ID}, "created_at", "topic_id", "post_id", "comment_id")
+	}
+	if err == nil {
+		err = exportSection(ctx, res, "subscriptions", models.Subscription{UserID: user.ID}, "created_at", "topic_id")
+	}
+	if err == nil {
+		err = exportSection(ctx, res, "saved", models.Saved{UserID: user.ID}, "created_at", "topic_id", "post_id", "comment_id")
+	}
+	if err == nil {
+		_, err = res.Write([]byte("}"))
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to export user data", "user", user.ID, "error", err)
+	}
+	return nil
+}
+
+// exportJSON writes prefix and then v as JSON.
+func exportJSON(res *echo.Response, prefix string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = res.Write(append([]byte(prefix), data...))
+	return err
+}
+
+// exportSection writes the rows matching filter as the named array of the
+// export, flushing each batch to the client.
+func exportSection[T any](c context.Context, res *echo.Response, name string, filter T, order ...string) error {
+	prefix := `,"` + name + `":[`
+	for offset := 0; ; offset += ExportBatch {
+		rows, err := store.Find(c, Store, filter, store.OrderBy(order...), store.Page(models.PageRequest{Offset: offset, Limit: ExportBatch}))
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := exportJSON(res, prefix, row); err != nil {
+				return err
+			}
+			prefix = ","
+		}
+		res.Flush()
+		if len(rows) < ExportBatch {
+			break
+		}
+	}
+	if prefix == "," {
+		prefix = ""
+	}
+	_, err := res.Write([]byte(prefix + "]"))
+	return err
+}
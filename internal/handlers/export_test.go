@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// TestExport exports a user's data a couple of rows at a time and checks
+// it has all of theirs and none of anyone else's.
+func TestExport(t *testing.T) {
+	e := newServer(t)
+	admins, batch := Admins, ExportBatch
+	t.Cleanup(func() { Admins, ExportBatch = admins, batch })
+	Admins, ExportBatch = []string{"dave"}, 2
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	_, daveToken := newUser(t, "dave")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.Post{Model: models.Model{ID: "a1"}, TopicID: "golang", AuthorID: alice.ID, Title: "First"},
+		&models.Post{Model: models.Model{ID: "a2"}, TopicID: "golang", AuthorID: alice.ID, Title: "Second"},
+		&models.Post{Model: models.Model{ID: "a3"}, TopicID: "rust", AuthorID: alice.ID, Title: "Third"},
+		&models.Post{Model: models.Model{ID: "b1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Bob's"},
+		&models.Comment{Model: models.Model{ID: "ac1"}, TopicID: "golang", PostID: "b1", AuthorID: alice.ID, Content: "Reply"},
+		&models.Comment{Model: models.Model{ID: "bc1"}, TopicID: "golang", PostID: "a1", AuthorID: bob.ID, Content: "Reply"},
+		&models.Vote{UserID: alice.ID, TopicID: "golang", PostID: "b1", Value: 1},
+		&models.Vote{UserID: bob.ID, TopicID: "golang", PostID: "a1", Value: -1},
+		&models.Subscription{UserID: alice.ID, TopicID: "golang"},
+		&models.Subscription{UserID: alice.ID, TopicID: "rust"},
+		&models.Subscription{UserID: bob.ID, TopicID: "golang"},
+		&models.Saved{UserID: bob.ID, TopicID: "golang", PostID: "a1"},
+	)
+	for i, post := range []string{"a1", "a2", "a3", "b1"} {
+		// Spread the posts out so the export's order is theirs.
+		if err := Store.UpdateColumns(context.Background(), &models.Post{}, &models.Post{Model: models.Model{ID: post}}, map[string]any{"created_at": time.Now().Add(time.Duration(i-10) * time.Minute)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	export := func(path, token string) (int, UserExport) {
+		t.Helper()
+		var got UserExport
+		rec := call(t, e, http.MethodGet, path, token, nil, nil)
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("%s: %v: %s", path, err, rec.Body)
+			}
+			if disposition := rec.Header().Get(echo.HeaderContentDisposition); disposition != `attachment; filename="`+got.User.Username+`.json"` {
+				t.Errorf("%s: got Content-Disposition %q", path, disposition)
+			}
+		}
+		return rec.Code, got
+	}
+	summary := func(export UserExport) string {
+		var posts, comments, votes, topics, saved []string
+		for _, post := range export.Posts {
+			posts = append(posts, post.ID)
+		}
+		for _, comment := range export.Comments {
+			comments = append(comments, comment.ID)
+		}
+		for _, vote := range export.Votes {
+			votes = append(votes, fmt.Sprintf("%s%+d", vote.PostID, vote.Value))
+		}
+		for _, subscription := range export.Subscriptions {
+			topics = append(topics, subscription.TopicID)
+		}
+		for _, s := range export.Saved {
+			saved = append(saved, s.PostID)
+		}
+		return fmt.Sprint(export.User.Username, posts, comments, votes, topics, saved)
+	}
+	for _, tc := range []struct {
+		what, path, token string
+		code              int
+		want              string
+	}{
+		{"signed out", "/v1/users/me/export", "", http.StatusUnauthorized, ""},
+		{"alice's own", "/v1/users/me/export", aliceToken, http.StatusOK, "alice[a1 a2 a3] [ac1] [b1+1] [golang rust] []"},
+		{"alice's by name", "/v1/users/alice/export", aliceToken, http.StatusOK, "alice[a1 a2 a3] [ac1] [b1+1] [golang rust] []"},
+		{"bob's", "/v1/users/me/export", bobToken, http.StatusOK, "bob[b1] [bc1] [a1-1] [golang] [a1]"},
+		{"alice's as bob", "/v1/users/alice/export", bobToken, http.StatusForbidden, ""},
+		{"alice's as an admin", "/v1/users/alice/export", daveToken, http.StatusOK, "alice[a1 a2 a3] [ac1] [b1+1] [golang rust] []"},
+		{"an unknown user's as an admin", "/v1/users/nobody/export", daveToken, http.StatusNotFound, ""},
+	} {
+		code, got := export(tc.path, tc.token)
+		if code != tc.code {
+			t.Errorf("export %s: got %d, want %d", tc.what, code, tc.code)
+		} else if code == http.StatusOK && summary(got) != tc.want {
+			t.Errorf("export %s: got %s, want %s", tc.what, summary(got), tc.want)
+		}
+	}
+
+	RateLimits = RateLimitConfig{Enabled: true, Exports: RateBudget{Burst: 1, Per: time.Hour}}
+	RateLimiter = NewMemoryLimiter()
+	if code, _ := export("/v1/users/me/export", aliceToken); code != http.StatusOK {
+		t.Errorf("first export within the budget: got %d", code)
+	}
+	if code, _ := export("/v1/users/me/export", aliceToken); code != http.StatusTooManyRequests {
+		t.Errorf("second export: got %d, want 429", code)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("a read after the exports: got %d, want a budget of its own", rec.Code)
+	}
+}
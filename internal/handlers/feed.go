@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const FeedSize = 25
+
+// BaseURL is the public URL of the site, used for absolute links in feeds.
+var BaseURL string
+
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+type RSSChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Self        AtomLink  `xml:"atom:link"`
+	Items       []RSSItem `xml:"item"`
+}
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+type RSSItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        RSSGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Description string  `xml:"description"`
+}
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// Feed lists the newest posts of a topic, or of every topic when topicID is
+// empty, as an RSS 2.0 channel.
+func Feed(c context.Context, topicID string, self string) (*RSS, error) {
+	channel := RSSChannel{Title: "Reddit Clone", Link: BaseURL + "/", Description: "Newest posts on Reddit Clone"}
+	if topicID != "" {
+		if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: topicID}}); err != nil {
+			return nil, err
+		}
+		channel = RSSChannel{Title: topicID + " - Reddit Clone", Link: BaseURL + TopicURL(topicID), Description: "Newest posts in " + topicID}
+	}
+	channel.Self = AtomLink{Href: BaseURL + self, Rel: "self", Type: "application/rss+xml"}
+	posts, err := store.Find(c, Store, models.Post{TopicID: topicID}, store.Preload("Author"), store.OrderBy("created_at DESC"), store.Page(models.PageRequest{Limit: FeedSize}), Visible(c))
+	if err != nil {
+		return nil, err
+	}
+	channel.Items = []RSSItem{}
+	for _, post := range posts {
+		link := BaseURL + PostURL(post.TopicID, post.ID)
+		item := RSSItem{Title: post.Title, Link: link, GUID: RSSGUID{IsPermaLink: true, Value: link}, PubDate: post.CreatedAt.UTC().Format(time.RFC1123Z), Description: string(models.Markdown(post.Content))}
+		if post.Author != nil {
+			item.Creator = post.Author.Username
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return &RSS{Version: "2.0", Atom: "http://www.w3.org/2005/Atom", DC: "http://purl.org/dc/elements/1.1/", Channel: channel}, nil
+}
+func HandleFeed(c echo.Context) error {
+	feed, err := Feed(c.Request().Context(), c.Param("topicid"), c.Request().URL.Path)
+	if err != nil {
+		return Fail(c, err)
+	}
+	body, err := xml.MarshalIndent(feed, "", "\t")
+	if err != nil {
+		return Fail(c, err)
+	}
+	return c.Blob(http.StatusOK, "application/rss+xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestFeed reads the site and topic feeds and checks the newest posts come
+// first with absolute links, their author and rendered body.
+func TestFeed(t *testing.T) {
+	e := newServer(t)
+	base := BaseURL
+	t.Cleanup(func() { BaseURL = base })
+	BaseURL = "https://example.com"
+	alice, _ := newUser(t, "alice")
+	now := time.Now()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.Post{Model: models.Model{ID: "old", CreatedAt: now.Add(-time.Hour)}, TopicID: "golang", AuthorID: alice.ID, Title: "Old", Content: "*old*"},
+		&models.Post{Model: models.Model{ID: "new", CreatedAt: now}, TopicID: "golang", Title: "New"},
+		&models.Post{Model: models.Model{ID: "other", CreatedAt: now.Add(-time.Minute)}, TopicID: "rust", Title: "Other"},
+	)
+
+	read := func(path string) (RSS, string) {
+		t.Helper()
+		rec := get(e, path)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/rss+xml; charset=utf-8" {
+			t.Fatalf("%s: got %d %s", path, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		var feed RSS
+		if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return feed, rec.Body.String()
+	}
+	titles := func(feed RSS) (titles []string) {
+		for _, item := range feed.Channel.Items {
+			titles = append(titles, item.Title)
+		}
+		return titles
+	}
+
+	site, _ := read("/feed.rss")
+	if got := titles(site); len(got) != 3 || got[0] != "New" || got[1] != "Other" || got[2] != "Old" {
+		t.Errorf("site feed: got %v", got)
+	}
+	topic, body := read("/topics/golang/feed.rss")
+	if got := titles(topic); len(got) != 2 || got[0] != "New" || got[1] != "Old" {
+		t.Fatalf("topic feed: got %v", got)
+	}
+	// encoding/xml does not read prefixed names back, so the channel link,
+	// the atom:link and dc:creator are checked in the body.
+	for _, want := range []string{
+		"<link>https://example.com/topics/golang</link>",
+		`<atom:link href="https://example.com/topics/golang/feed.rss" rel="self" type="application/rss+xml"></atom:link>`,
+		"<dc:creator>alice</dc:creator>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("topic feed lacks %s:\n%s", want, body)
+		}
+	}
+	old := topic.Channel.Items[1]
+	link := "https://example.com/topics/golang/posts/old"
+	if old.Link != link || old.GUID.Value != link || !old.GUID.IsPermaLink || old.Description != "<p><em>old</em></p>\n" {
+		t.Errorf("item: got %+v", old)
+	}
+	if date, err := time.Parse(time.RFC1123Z, old.PubDate); err != nil || !date.Equal(now.Add(-time.Hour).Truncate(time.Second)) {
+		t.Errorf("pubDate: got %q, %v", old.PubDate, err)
+	}
+
+	if rec := get(e, "/topics/missing/feed.rss"); rec.Code != http.StatusNotFound {
+		t.Errorf("feed of a missing topic: got %d", rec.Code)
+	}
+}
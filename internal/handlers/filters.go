@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const MaxFilterLength = 255
+
+var ErrNotAdmin = NewError(Forbidden, "not_admin", "only site admins can do that")
+var ErrFiltered = NewError(BadRequest, "filtered", "this contains a banned word or link")
+
+// Admins are the usernames of the site admins, who manage the site-wide
+// filters.
+var Admins []string
+
+var linkHost = regexp.MustCompile(`(?i)\b(?:https?://|www\.)([a-z0-9.-]+)`)
+var validDomain = regexp.MustCompile(`^(?i)[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+
+type FilterRequest struct {
+	models.IDs
+	FilterID string `param:"filterid"`
+}
+
+func (e FieldErrors) Filter(prefix string, filter models.Filter) {
+	e.Text(prefix+"value", strings.TrimSpace(filter.Value), MaxFilterLength, false)
+	switch filter.Kind {
+	case models.FilterWord:
+	case models.FilterDomain:
+		if !validDomain.MatchString(strings.TrimSpace(filter.Value)) {
+			e[prefix+"value"] = "must be a domain name"
+		}
+	default:
+		e[prefix+"kind"] = "must be word or domain"
+	}
+	if filter.Action != models.FilterReject && filter.Action != models.FilterHold {
+		e[prefix+"action"] = "must be reject or hold"
+	}
+}
+func IsAdmin(user *models.User) bool {
+	return user != nil && slices.Contains(Admins, user.Username)
+}
+
+// Administer checks that the current user is a site admin.
+func Administer(c context.Context) error {
+	if user := CurrentUser(c); user == nil {
+		return ErrNotLoggedIn
+	} else if !IsAdmin(user) {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
+// ManageFilters checks that the current user may change the filters of the
+// topic, or the site-wide filters when topicID is empty. Topic changes
+// return the start of the ModAction to log.
+func ManageFilters(c context.Context, topicID string) (*models.ModAction, error) {
+	if topicID != "" {
+		if err := Moderate(c, topicID); err != nil {
+			return nil, err
+		}
+		return &models.ModAction{TopicID: topicID, Action: models.ModEditFilter}, nil
+	}
+	return nil, Administer(c)
+}
+
+// Filtered returns the filter, site-wide or of the topic, that the text
+// breaks, preferring ones that reject over ones that hold.
+func Filtered(c context.Context, s store.Store, topicID string, text string) (*models.Filter, error) {
+	var filters []models.Filter
+	for _, scope := range slices.Compact([]string{"", topicID}) {
+		found, err := store.Find(c, s, models.Filter{}, store.Where("topic_id", "=", scope))
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, found...)
+	}
+	var hosts []string
+	for _, match := range linkHost.FindAllStringSubmatch(text, -1) {
+		hosts = append(hosts, strings.ToLower(strings.TrimRight(match[1], ".")))
+	}
+	var hit *models.Filter
+	for i, filter := range filters {
+		if hit != nil && (hit.Action == models.FilterReject || filter.Action == models.FilterHold) {
+			continue
+		}
+		matched := false
+		switch filter.Kind {
+		case models.FilterWord:
+			matched = keywordPattern([]string{filter.Value}).MatchString(text)
+		case models.FilterDomain:
+			matched = slices.ContainsFunc(hosts, func(host string) bool { return host == filter.Value || strings.HasSuffix(host, "."+filter.Value) })
+		}
+		if matched {
+			hit = &filters[i]
+		}
+	}
+	return hit, nil
+}
+func Filters(c context.Context, req ListRequest) (*models.ListResponse[models.Filter], error) {
+	if _, err := ManageFilters(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	return store.List(c, Store, models.Filter{}, req.PageRequest, store.Where("topic_id", "=", req.TopicID), store.OrderBy("kind", "value"))
+}
+func CreateFilter(c context.Context, req CreateRequest[models.Filter]) (*models.Filter, error) {
+	action, err := ManageFilters(c, req.TopicID)
+	if err != nil {
+		return nil, err
+	}
+	filter := req.Model
+	filter.Model, filter.TopicID, filter.Value = models.Model{ID: uuid.NewString()}, req.TopicID, strings.TrimSpace(filter.Value)
+	if filter.Kind == models.FilterDomain {
+		filter.Value = strings.TrimPrefix(strings.ToLower(filter.Value), "www.")
+	}
+	if action != nil {
+		action.Details = "banned " + filter.Kind + " " + filter.Value
+	}
+	return &filter, Moderated(c, action, func(tx store.Store) error {
+		existing, err := store.Find(c, tx, models.Filter{Kind: filter.Kind, Value: filter.Value}, store.Where("topic_id", "=", filter.TopicID))
+		if err != nil {
+			return err
+		} else if len(existing) > 0 {
+			return store.ErrDuplicatedKey
+		}
+		return tx.Create(c, &filter)
+	})
+}
+func DeleteFilter(c context.Context, req FilterRequest) (*models.Filter, error) {
+	action, err := ManageFilters(c, req.TopicID)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := store.Find(c, Store, models.Filter{Model: models.Model{ID: req.FilterID}}, store.Where("topic_id", "=", req.TopicID))
+	if err != nil {
+		return nil, err
+	} else if len(filters) == 0 {
+		return nil, store.ErrNotFound
+	}
+	if action != nil {
+		action.Details = "unbanned " + filters[0].Kind + " " + filters[0].Value
+	}
+	return nil, Moderated(c, action, func(tx store.Store) error {
+		_, err := store.Delete(c, tx, models.Filter{Model: models.Model{ID: req.FilterID}})
+		return err
+	})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestFilters manages site-wide and topic filters over v1 and submits
+// content that breaks them.
+func TestFilters(t *testing.T) {
+	e := newServer(t)
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"root"}
+	_, rootToken := newUser(t, "root")
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+	)
+	filter := func(path, token, kind, value, action string, want int) models.Filter {
+		t.Helper()
+		var created models.Filter
+		body := map[string]any{"model": map[string]string{"kind": kind, "value": value, "action": action}}
+		if rec := call(t, e, http.MethodPost, path, token, body, &created); rec.Code != want {
+			t.Fatalf("ban %s %q at %s: got %d, want %d: %s", kind, value, path, rec.Code, want, rec.Body)
+		}
+		return created
+	}
+	filter("/v1/filters", "", "word", "scam", "reject", http.StatusUnauthorized)
+	filter("/v1/filters", aliceToken, "word", "scam", "reject", http.StatusForbidden)
+	filter("/v1/filters", rootToken, "word", "scam", "block", http.StatusBadRequest)
+	filter("/v1/filters", rootToken, "phrase", "scam", "reject", http.StatusBadRequest)
+	filter("/v1/filters", rootToken, "domain", "not a domain", "reject", http.StatusBadRequest)
+	scam := filter("/v1/filters", rootToken, "word", " scam ", "reject", http.StatusCreated)
+	filter("/v1/filters", rootToken, "word", "scam", "reject", http.StatusConflict)
+	filter("/v1/filters", rootToken, "domain", "WWW.Spam.example", "hold", http.StatusCreated)
+	filter("/v1/topics/golang/filters", bobToken, "word", "java", "hold", http.StatusForbidden)
+	filter("/v1/topics/golang/filters", aliceToken, "word", "java", "hold", http.StatusCreated)
+	filter("/v1/topics/golang/filters", aliceToken, "word", "scam", "hold", http.StatusCreated)
+
+	var list models.ListResponse[models.Filter]
+	call(t, e, http.MethodGet, "/v1/filters", rootToken, nil, &list)
+	if len(list.Items) != 2 || list.Items[0].Value != "spam.example" || list.Items[1].Value != "scam" {
+		t.Errorf("site-wide filters: got %+v", list.Items)
+	}
+	call(t, e, http.MethodGet, "/v1/topics/golang/filters", aliceToken, nil, &list)
+	if len(list.Items) != 2 {
+		t.Errorf("golang filters: got %+v", list.Items)
+	}
+
+	for _, tc := range []struct {
+		topic, title, content string
+		want                  int
+		visible, held         bool
+	}{
+		{"rust", "Not a SCAM", "", http.StatusBadRequest, false, false},
+		{"golang", "scam and java", "", http.StatusBadRequest, false, false},
+		{"golang", "Scammers", "", http.StatusCreated, true, false},
+		{"rust", "Deals", "at https://shop.spam.example/x", http.StatusCreated, false, true},
+		{"rust", "Deals", "at https://notspam.example/x", http.StatusCreated, true, false},
+		{"golang", "Java is fine", "", http.StatusCreated, false, true},
+		{"rust", "Java is fine", "", http.StatusCreated, true, false},
+	} {
+		var post models.Post
+		rec := call(t, e, http.MethodPost, "/v1/topics/"+tc.topic+"/posts", bobToken, map[string]any{"model": map[string]string{"title": tc.title, "content": tc.content}}, &post)
+		if rec.Code != tc.want {
+			t.Errorf("post %q to %s: got %d, want %d", tc.title, tc.topic, rec.Code, tc.want)
+			continue
+		}
+		if rec.Code != http.StatusCreated {
+			continue
+		}
+		if visible := call(t, e, http.MethodGet, "/v1/topics/"+tc.topic+"/posts/"+post.ID, "", nil, nil).Code == http.StatusOK; visible != tc.visible {
+			t.Errorf("post %q to %s: visible %v", tc.title, tc.topic, visible)
+		}
+		var queue ModQueueList
+		Store.Find(context.Background(), &queue.Items, &models.Report{PostID: post.ID})
+		if held := len(queue.Items) == 1 && queue.Items[0].Held; held != tc.held {
+			t.Errorf("post %q to %s: held %v", tc.title, tc.topic, held)
+		}
+	}
+
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/filters/"+scam.ID, aliceToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("delete a site-wide filter through a topic: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodDelete, "/v1/filters/"+scam.ID, rootToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete a site-wide filter: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/rust/posts", bobToken, map[string]any{"model": map[string]string{"title": "scam"}}, nil); rec.Code != http.StatusCreated {
+		t.Errorf("post once the filter is gone: got %d", rec.Code)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	if len(log.Items) != 2 || log.Items[0].Action != models.ModEditFilter || log.Items[1].Details != "banned word java" {
+		t.Errorf("filter changes in the modlog: got %+v", log.Items)
+	}
+}
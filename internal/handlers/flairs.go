@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const MaxFlairLength = 64
+
+// DefaultFlairColor is the color of flairs created without one.
+const DefaultFlairColor = "#e0e0e0"
+
+var flairColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type FlairRequest struct {
+	models.IDs
+	FlairID string `param:"flairid"`
+}
+type UpdateFlairRequest struct {
+	FlairRequest
+	Mask models.Flair `json:"updateMask"`
+}
+
+func (r UpdateFlairRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.Model("updateMask.", r.Mask, true)
+	return errs.Err()
+}
+func (e FieldErrors) Flair(prefix string, flair models.Flair, partial bool) {
+	e.Text(prefix+"text", models.StripTags(flair.Text), MaxFlairLength, partial)
+	if flair.Color != "" && !flairColor.MatchString(flair.Color) {
+		e[prefix+"color"] = "must be a color like #ff4500"
+	}
+}
+
+// Flairs lists the flairs authors can give their posts in the topic, and
+// those users can pick for themselves there.
+func Flairs(c context.Context, req ListRequest) (*models.ListResponse[models.Flair], error) {
+	if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: req.TopicID}}); err != nil {
+		return nil, err
+	}
+	return store.List(c, Store, models.Flair{TopicID: req.TopicID}, req.PageRequest, store.OrderBy("text"))
+}
+func CreateFlair(c context.Context, req CreateRequest[models.Flair]) (*models.Flair, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	flair := models.Flair{Model: models.Model{ID: uuid.NewString()}, TopicID: req.TopicID, Text: strings.TrimSpace(models.StripTags(req.Model.Text)), Color: strings.ToLower(cmp.Or(req.Model.Color, DefaultFlairColor)), Users: req.Model.Users}
+	return &flair, Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditFlair, Details: "created flair " + flair.Text}, func(tx store.Store) error {
+		if err := checkFlairText(c, tx, flair); err != nil {
+			return err
+		}
+		return tx.Create(c, &flair)
+	})
+}
+func UpdateFlair(c context.Context, req UpdateFlairRequest) (*models.Flair, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	id := models.Flair{Model: models.Model{ID: req.FlairID}, TopicID: req.TopicID}
+	flair, err := store.Get(c, Store, id)
+	if err != nil {
+		return nil, err
+	}
+	mask := models.Flair{Text: strings.TrimSpace(models.StripTags(req.Mask.Text)), Color: strings.ToLower(req.Mask.Color)}
+	err = Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditFlair, Details: "updated flair " + cmp.Or(mask.Text, flair.Text)}, func(tx store.Store) error {
+		if mask.Text != "" && mask.Text != flair.Text {
+			if err := checkFlairText(c, tx, models.Flair{Model: models.Model{ID: flair.ID}, TopicID: req.TopicID, Text: mask.Text}); err != nil {
+				return err
+			}
+		}
+		return tx.Update(c, flair, mask)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(c, Store, id)
+}
+
+// DeleteFlair takes a flair off the ones authors can pick. Posts that have
+// it lose it.
+func DeleteFlair(c context.Context, req FlairRequest) (*models.Flair, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	flair, err := store.Get(c, Store, models.Flair{Model: models.Model{ID: req.FlairID}, TopicID: req.TopicID})
+	if err != nil {
+		return nil, err
+	}
+	return nil, Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditFlair, Details: "deleted flair " + flair.Text}, func(tx store.Store) error {
+		_, err := store.Delete(c, tx, models.Flair{Model: models.Model{ID: flair.ID}, TopicID: flair.TopicID})
+		return err
+	})
+}
+
+// checkFlairText keeps the flairs of a topic distinct, ignoring case. A
+// flair may change the case of its own text.
+func checkFlairText(c context.Context, s store.Store, flair models.Flair) error {
+	existing, err := store.Find(c, s, models.Flair{TopicID: flair.TopicID})
+	if err != nil {
+		return err
+	}
+	for _, other := range existing {
+		if other.ID != flair.ID && strings.EqualFold(other.Text, flair.Text) {
+			return store.ErrDuplicatedKey
+		}
+	}
+	return nil
+}
+
+// CheckFlair checks that the flair a new post has is one of its topic's
+// post flairs.
+func CheckFlair(c context.Context, s store.Store, post *models.Post) error {
+	if post.FlairID == "" {
+		return nil
+	}
+	flair, err := store.Get(c, s, models.Flair{Model: models.Model{ID: post.FlairID}, TopicID: post.TopicID})
+	if errors.Is(err, store.ErrNotFound) || err == nil && flair.Users {
+		return FieldErrors{"flairID": "must be one of the topic's flairs"}
+	}
+	return err
+}
+
+type UserFlairRequest struct {
+	models.IDs
+	Username string `param:"username"`
+}
+
+// SetUserFlairRequest gives the user either the topic's user flair FlairID
+// or, from a moderator, any Text and Color.
+type SetUserFlairRequest struct {
+	UserFlairRequest
+	FlairID string `json:"flairID" form:"flairID"`
+	Text    string `json:"text" form:"text"`
+	Color   string `json:"color" form:"color"`
+}
+
+func (r SetUserFlairRequest) Validate() error {
+	errs := FieldErrors{}
+	if r.FlairID != "" {
+		if r.Text != "" || r.Color != "" {
+			errs["flairID"] = "cannot be set along with text or color"
+		}
+		return errs.Err()
+	}
+	errs.Flair("", models.Flair{Text: r.Text, Color: r.Color}, false)
+	return errs.Err()
+}
+
+// manageUserFlair checks that the current user may change the flair the
+// named user has in the topic, which they may do for themselves and
+// moderators for anyone, and reports whether they moderate it.
+func manageUserFlair(c context.Context, req UserFlairRequest) (*models.User, bool, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, false, ErrNotLoggedIn
+	}
+	if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: req.TopicID}}); err != nil {
+		return nil, false, err
+	}
+	target, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := Moderate(c, req.TopicID); errors.Is(err, ErrNotModerator) && target.ID == user.ID {
+		return target, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return target, true, nil
+}
+
+// userFlairAction is the ModAction to log when a moderator changes
+// someone else's flair.
+func userFlairAction(c context.Context, topicID string, target *models.User, details string) *models.ModAction {
+	if target.ID == CurrentUser(c).ID {
+		return nil
+	}
+	return &models.ModAction{TopicID: topicID, Action: models.ModEditUserFlair, TargetUserID: target.ID, Details: details}
+}
+
+// GetUserFlair is the flair the named user has in the topic.
+func GetUserFlair(c context.Context, req UserFlairRequest) (*models.UserFlair, error) {
+	target, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(c, Store, models.UserFlair{TopicID: req.TopicID, UserID: target.ID})
+}
+
+// SetUserFlair replaces the flair the named user has in the topic. Users
+// setting their own pick one of the topic's user flairs unless they
+// moderate it.
+func SetUserFlair(c context.Context, req SetUserFlairRequest) (*models.UserFlair, error) {
+	target, moderator, err := manageUserFlair(c, req.UserFlairRequest)
+	if err != nil {
+		return nil, err
+	}
+	flair := &models.UserFlair{TopicID: req.TopicID, UserID: target.ID, Text: strings.TrimSpace(models.StripTags(req.Text)), Color: strings.ToLower(cmp.Or(req.Color, DefaultFlairColor))}
+	if req.FlairID != "" {
+		picked, err := store.Get(c, Store, models.Flair{Model: models.Model{ID: req.FlairID}, TopicID: req.TopicID})
+		if errors.Is(err, store.ErrNotFound) || err == nil && !picked.Users {
+			return nil, FieldErrors{"flairID": "must be one of the topic's user flairs"}
+		} else if err != nil {
+			return nil, err
+		}
+		flair.Text, flair.Color = picked.Text, picked.Color
+	} else if !moderator {
+		return nil, FieldErrors{"flairID": "is required to pick your own flair"}
+	}
+	save := func(tx store.Store) error {
+		if _, err := store.Delete(c, tx, models.UserFlair{TopicID: flair.TopicID, UserID: flair.UserID}); err != nil {
+			return err
+		}
+		return tx.Create(c, flair)
+	}
+	if moderator {
+		if action := userFlairAction(c, req.TopicID, target, "set user flair "+flair.Text); action != nil {
+			return flair, Moderated(c, action, save)
+		}
+	}
+	return flair, Store.Transaction(c, save)
+}
+
+// RemoveUserFlair takes away the flair the named user has in the topic.
+func RemoveUserFlair(c context.Context, req UserFlairRequest) (*models.UserFlair, error) {
+	target, moderator, err := manageUserFlair(c, req)
+	if err != nil {
+		return nil, err
+	}
+	var action *models.ModAction
+	if moderator {
+		action = userFlairAction(c, req.TopicID, target, "removed user flair")
+	}
+	return nil, Moderated(c, action, func(tx store.Store) error {
+		_, err := store.Delete(c, tx, models.UserFlair{TopicID: req.TopicID, UserID: target.ID})
+		return err
+	})
+}
+
+// UserFlairs are the flairs the users have in the topic, by user ID.
+func UserFlairs(c context.Context, topicID string, userIDs []string) (map[string]*models.UserFlair, error) {
+	byUser := map[string]*models.UserFlair{}
+	if len(userIDs) == 0 {
+		return byUser, nil
+	}
+	flairs, err := store.Find(c, Store, models.UserFlair{TopicID: topicID}, store.Where("user_id", "IN", userIDs))
+	if err != nil {
+		return nil, err
+	}
+	for i := range flairs {
+		byUser[flairs[i].UserID] = &flairs[i]
+	}
+	return byUser, nil
+}
+
+// AttachUserFlairs sets the flair each author has in the topic on posts
+// and comments there.
+func AttachUserFlairs(c context.Context, topicID string, posts []models.Post, comments []models.Comment) error {
+	var authors []string
+	for _, post := range posts {
+		authors = append(authors, post.AuthorID)
+	}
+	for _, comment := range comments {
+		authors = append(authors, comment.AuthorID)
+	}
+	slices.Sort(authors)
+	flairs, err := UserFlairs(c, topicID, slices.Compact(authors))
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].AuthorFlair = flairs[posts[i].AuthorID]
+	}
+	for i := range comments {
+		comments[i].AuthorFlair = flairs[comments[i].AuthorID]
+	}
+	return nil
+}
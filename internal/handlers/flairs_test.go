@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestFlairs manages a topic's flairs on each store, posts with them and
+// narrows listings to one.
+func TestFlairs(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testFlairs(t, s)
+		})
+	}
+}
+
+func testFlairs(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Flair{Model: models.Model{ID: "rust-news"}, TopicID: "rust", Text: "News", Color: "#ffffff"},
+	)
+
+	flair := func(token string, model map[string]any) (int, models.Flair) {
+		t.Helper()
+		var got models.Flair
+		rec := call(t, e, http.MethodPost, "/v1/topics/golang/flairs", token, map[string]any{"model": model}, &got)
+		return rec.Code, got
+	}
+	code, news := flair(aliceToken, map[string]any{"text": " <i>News</i> ", "color": "#FF4500"})
+	if code != http.StatusCreated || news.Text != "News" || news.Color != "#ff4500" || news.TopicID != "golang" {
+		t.Fatalf("create news: got %d %+v", code, news)
+	}
+	code, help := flair(aliceToken, map[string]any{"text": "Help"})
+	if code != http.StatusCreated || help.Color != DefaultFlairColor {
+		t.Errorf("create help: got %d %+v", code, help)
+	}
+	for _, tc := range []struct {
+		what, token string
+		model       map[string]any
+		want        int
+	}{
+		{"as a non-moderator", bobToken, map[string]any{"text": "Mine"}, http.StatusForbidden},
+		{"a duplicate", aliceToken, map[string]any{"text": "NEWS"}, http.StatusConflict},
+		{"a named color", aliceToken, map[string]any{"text": "Red", "color": "red"}, http.StatusBadRequest},
+		{"without text", aliceToken, map[string]any{"color": "#000000"}, http.StatusBadRequest},
+		{"at length", aliceToken, map[string]any{"text": strings.Repeat("x", MaxFlairLength+1)}, http.StatusBadRequest},
+	} {
+		if code, _ := flair(tc.token, tc.model); code != tc.want {
+			t.Errorf("create %s: got %d, want %d", tc.what, code, tc.want)
+		}
+	}
+	flairs := func() string {
+		t.Helper()
+		var list models.ListResponse[models.Flair]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/flairs", "", nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("list flairs: %d", rec.Code)
+		}
+		var got []string
+		for _, f := range list.Items {
+			got = append(got, f.Text+f.Color)
+		}
+		return fmt.Sprint(got)
+	}
+	if got := flairs(); got != "[Help#e0e0e0 News#ff4500]" {
+		t.Errorf("flairs: got %s", got)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/haskell/flairs", "", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("flairs of a missing topic: got %d", rec.Code)
+	}
+
+	update := func(id, token string, mask map[string]any) int {
+		t.Helper()
+		return call(t, e, http.MethodPut, "/v1/topics/golang/flairs/"+id, token, map[string]any{"updateMask": mask}, nil).Code
+	}
+	for _, tc := range []struct {
+		what, id, token string
+		mask            map[string]any
+		want            int
+	}{
+		{"as a non-moderator", news.ID, bobToken, map[string]any{"color": "#000000"}, http.StatusForbidden},
+		{"into a duplicate", news.ID, aliceToken, map[string]any{"text": "help"}, http.StatusConflict},
+		{"to a bad color", news.ID, aliceToken, map[string]any{"color": "#12345"}, http.StatusBadRequest},
+		{"a missing flair", "missing", aliceToken, map[string]any{"color": "#000000"}, http.StatusNotFound},
+		{"another topic's flair", "rust-news", aliceToken, map[string]any{"color": "#000000"}, http.StatusNotFound},
+		{"the color", news.ID, aliceToken, map[string]any{"color": "#000000"}, http.StatusOK},
+		{"the text in another case", news.ID, aliceToken, map[string]any{"text": "NEWS"}, http.StatusOK},
+	} {
+		if code := update(tc.id, tc.token, tc.mask); code != tc.want {
+			t.Errorf("update %s: got %d, want %d", tc.what, code, tc.want)
+		}
+	}
+	if got := flairs(); got != "[Help#e0e0e0 NEWS#000000]" {
+		t.Errorf("flairs after the updates: got %s", got)
+	}
+
+	var post models.Post
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, map[string]any{"model": map[string]any{"title": "Go 1.23", "flairID": news.ID}}, &post); rec.Code != http.StatusCreated || post.FlairID != news.ID {
+		t.Fatalf("post with a flair: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, map[string]any{"model": map[string]any{"title": "Borrowed", "flairID": "rust-news"}}, nil); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "flairID") {
+		t.Errorf("post with another topic's flair: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Stuck"}, "flairID": {help.ID}}, login(t, bob)); rec.Code >= http.StatusBadRequest {
+		t.Errorf("post with a flair through the page: got %d %s", rec.Code, rec.Body)
+	}
+	create(t, &models.Post{Model: models.Model{ID: "plain"}, TopicID: "golang", AuthorID: alice.ID, Title: "Plain"})
+
+	titles := func(path string) string {
+		t.Helper()
+		var list models.ListResponse[models.Post]
+		call(t, e, http.MethodGet, path, "", nil, &list)
+		var got []string
+		for _, p := range list.Items {
+			got = append(got, p.Title)
+			if p.FlairID != "" && (p.Flair == nil || p.Flair.ID != p.FlairID) {
+				t.Errorf("%s: %s has flair %q but got %+v", path, p.Title, p.FlairID, p.Flair)
+			}
+		}
+		return fmt.Sprint(got)
+	}
+	if got := titles("/v1/topics/golang/posts?sort=new&flair=" + news.ID); got != "[Go 1.23]" {
+		t.Errorf("posts with news: got %s", got)
+	}
+	if got := titles("/v1/topics/golang/posts?sort=new"); got != "[Plain Stuck Go 1.23]" {
+		t.Errorf("all posts: got %s", got)
+	}
+	body := get(e, "/topics/golang?flair="+help.ID).Body.String()
+	if !strings.Contains(body, "Stuck") || strings.Contains(body, "Go 1.23") || !strings.Contains(body, `class="flair selected"`) {
+		t.Errorf("the topic page narrowed to help: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang/posts/"+post.ID, bob); !strings.Contains(body, `<a class="flair" style="background: #000000; color: #ffffff" href="/topics/golang?flair=`+news.ID+`">NEWS</a>`) {
+		t.Errorf("the post page lacks the flair: %s", body)
+	}
+	if got := PostsURL("golang", models.SortRequest{Sort: "new"}, help.ID, 10, "cursor"); got != "/topics/golang/posts?after=cursor&flair="+help.ID+"&limit=10&sort=new" {
+		t.Errorf("the next page of help: got %s", got)
+	}
+
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/flairs/"+news.ID, bobToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("delete as a non-moderator: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/flairs/"+news.ID, aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete news: %d", rec.Code)
+	}
+	var got models.Post
+	if call(t, e, http.MethodGet, "/v1/topics/golang/posts/"+post.ID, "", nil, &got); got.Flair != nil {
+		t.Errorf("the post still has the deleted flair: %+v", got.Flair)
+	}
+	if got := flairs(); got != "[Help#e0e0e0]" {
+		t.Errorf("flairs after the delete: got %s", got)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	var details []string
+	for _, action := range log.Items {
+		if action.Action == models.ModEditFlair {
+			details = append(details, action.Details)
+		}
+	}
+	if got := strings.Join(details, "|"); got != "deleted flair NEWS|updated flair NEWS|updated flair News|created flair Help|created flair News" {
+		t.Errorf("the mod log: got %s", got)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// FuzzedJSON shows the votes of posts and comments in responses fuzzed,
+// when the fuzzVotes feature is on.
+type FuzzedJSON struct {
+	echo.JSONSerializer
+}
+
+func (s FuzzedJSON) Serialize(c echo.Context, i any, indent string) error {
+	return s.JSONSerializer.Serialize(c, FuzzVotes(i), indent)
+}
+
+// FuzzVotes blurs the votes, upvotes and downvotes of every post and
+// comment in obj, when the fuzzVotes feature is on, so that bots cannot
+// tell whether their votes were counted. The counts stored are exact;
+// only what is rendered or serialized changes. Posts and comments obj
+// points to are changed in place, and ones it holds by value in a copy,
+// which is returned.
+func FuzzVotes(obj any) any {
+	if !Features.FuzzVotes || obj == nil {
+		return obj
+	}
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Pointer {
+		copied := reflect.New(v.Type())
+		copied.Elem().Set(v)
+		fuzz(copied, map[any]bool{})
+		return copied.Elem().Interface()
+	}
+	fuzz(v, map[any]bool{})
+	return obj
+}
+
+// fuzz walks v for posts and comments, skipping those already seen, as
+// the thread of a post points at the comments it also lists.
+func fuzz(v reflect.Value, seen map[any]bool) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			fuzz(v.Elem(), seen)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			fuzz(v.Index(i), seen)
+		}
+	case reflect.Struct:
+		if !v.CanAddr() {
+			return
+		}
+		obj := v.Addr().Interface()
+		if seen[obj] {
+			return
+		}
+		seen[obj] = true
+		switch obj := obj.(type) {
+		case *models.Post:
+			obj.Votes, obj.Ups, obj.Downs = fuzzTally(obj.ID, obj.Votes, obj.Ups, obj.Downs)
+		case *models.Comment:
+			obj.Votes, obj.Ups, obj.Downs = fuzzTally(obj.ID, obj.Votes, obj.Ups, obj.Downs)
+		}
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				fuzz(v.Field(i), seen)
+			}
+		}
+	}
+}
+
+// fuzzTally moves a score by up to a tenth of the votes cast, and adds as
+// many again to both upvotes and downvotes. The amounts follow from a hash
+// of the item, its tally and the JWT secret, so reloading shows the same
+// numbers until the votes change, and the exact tally cannot be worked
+// back out of them.
+func fuzzTally(id string, votes int, ups int, downs int) (int, int, int) {
+	spread := (max(ups+downs, votes, -votes) + 9) / 10
+	if spread == 0 {
+		return votes, ups, downs
+	}
+	h := fnv.New64a()
+	h.Write(JWTSecret)
+	fmt.Fprintf(h, "%s/%d/%d/%d", id, votes, ups, downs)
+	sum := h.Sum64()
+	shift := int(sum%uint64(2*spread+1)) - spread
+	noise := int(sum / uint64(2*spread+1) % uint64(spread+1))
+	return votes + shift, ups + noise + max(shift, 0), downs + noise + max(-shift, 0)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestFuzzTally checks fuzzed tallies stay near the exact ones, add up,
+// repeat for the same tally and depend on the secret.
+func TestFuzzTally(t *testing.T) {
+	secret := JWTSecret
+	t.Cleanup(func() { JWTSecret = secret })
+	JWTSecret = []byte("test secret")
+	if votes, ups, downs := fuzzTally("p1", 0, 0, 0); votes != 0 || ups != 0 || downs != 0 {
+		t.Errorf("no votes: got %d, %d and %d", votes, ups, downs)
+	}
+	moved := false
+	for i := range 50 {
+		id := fmt.Sprintf("p%d", i)
+		votes, ups, downs := fuzzTally(id, 40, 60, 20)
+		if votes < 32 || votes > 48 || ups < 60 || downs < 20 || ups-downs != votes {
+			t.Errorf("%s at 60 up and 20 down: got %d, %d and %d", id, votes, ups, downs)
+		}
+		if again, _, _ := fuzzTally(id, 40, 60, 20); again != votes {
+			t.Errorf("%s fuzzed to %d and then %d", id, votes, again)
+		}
+		moved = moved || votes != 40
+	}
+	if !moved {
+		t.Error("no score moved")
+	}
+	fuzzed := make([]int, 50)
+	for i := range fuzzed {
+		fuzzed[i], _, _ = fuzzTally(fmt.Sprintf("p%d", i), 40, 60, 20)
+	}
+	JWTSecret = []byte("another secret")
+	for i := range fuzzed {
+		if other, _, _ := fuzzTally(fmt.Sprintf("p%d", i), 40, 60, 20); other != fuzzed[i] {
+			return
+		}
+	}
+	t.Error("another secret fuzzed every score the same")
+}
+
+// TestFuzzVotes fuzzes posts and comments held by value and by pointer,
+// once each, and shows fuzzed votes through the API while the stored
+// counts stay exact.
+func TestFuzzVotes(t *testing.T) {
+	e := newServer(t)
+	features := Features
+	t.Cleanup(func() { Features = features })
+	Features.FuzzVotes = false
+	post := models.Post{Model: models.Model{ID: "p1"}, Votes: 40, Ups: 60, Downs: 20}
+	if got := FuzzVotes(post).(models.Post); got.Votes != 40 {
+		t.Errorf("with the feature off: got %d votes", got.Votes)
+	}
+
+	Features.FuzzVotes = true
+	votes, ups, downs := fuzzTally("p1", 40, 60, 20)
+	if got := FuzzVotes(post).(models.Post); got.Votes != votes || got.Ups != ups || got.Downs != downs || post.Votes != 40 {
+		t.Errorf("a post by value: got %d, %d and %d, leaving %d", got.Votes, got.Ups, got.Downs, post.Votes)
+	}
+	comment := &models.Comment{Model: models.Model{ID: "c1"}, Votes: 40, Ups: 60, Downs: 20}
+	thread := &models.Post{Model: models.Model{ID: "p1"}, Votes: 40, Ups: 60, Downs: 20, Comments: []models.Comment{*comment}}
+	thread.Thread = []*models.Comment{&thread.Comments[0]}
+	FuzzVotes(thread)
+	want, _, _ := fuzzTally("c1", 40, 60, 20)
+	if thread.Votes != votes || thread.Comments[0].Votes != want {
+		t.Errorf("a post and its thread by pointer: got %d and %d, want %d and %d", thread.Votes, thread.Comments[0].Votes, votes, want)
+	}
+	if FuzzVotes(nil) != nil {
+		t.Error("fuzzing nil should give nil")
+	}
+
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Fuzzed", Votes: 40, Ups: 60, Downs: 20},
+	)
+	var got models.Post
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1", "", nil, &got); rec.Code != http.StatusOK || got.Votes != votes || got.Ups != ups || got.Downs != downs {
+		t.Errorf("the post through the API: got %d %+v", rec.Code, got)
+	}
+	var page models.ListResponse[models.Post]
+	if call(t, e, http.MethodGet, "/v1/topics/golang/posts", "", nil, &page); len(page.Items) != 1 || page.Items[0].Votes != votes || page.Items[0].Ups != ups {
+		t.Errorf("the listing through the API: got %+v", page.Items)
+	}
+	alice, _ := newUser(t, "alice")
+	var vote VoteResponse
+	if rec := postForm(e, "/topics/golang/posts/p1/upvote", nil, login(t, alice)); rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &vote) != nil {
+		t.Fatalf("upvote: got %d %s", rec.Code, rec.Body)
+	}
+	if want, _, _ := fuzzTally("p1", 41, 61, 20); vote.Votes != want {
+		t.Errorf("the upvote's response: got %d votes, want %d", vote.Votes, want)
+	}
+	stored, err := store.Get(context.Background(), Store, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"})
+	if err != nil || stored.Votes != 41 || stored.Ups != 61 || stored.Downs != 20 {
+		t.Errorf("the stored post: got %+v, %v", stored, err)
+	}
+}
@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+	"reddit-clone/internal/tracing"
+)
+
+const ArchivePageSize = 25
+
+var ErrInvalidMonth = NewError(BadRequest, "invalid_month", "invalid year or month")
+
+// Store backs every handler; main sets it to the database store and tests
+// can swap in their own implementation.
+var Store store.Store
+
+type FeatureConfig struct {
+	Search  bool `yaml:"search"`
+	Signup  bool `yaml:"signup"`
+	Metrics bool `yaml:"metrics"`
+	// FuzzVotes shows vote counts slightly off; see FuzzVotes.
+	FuzzVotes bool `yaml:"fuzzVotes"`
+	// ShadowRemoveEvaders holds accounts signing in from a banned user's
+	// address for review; see CheckEvasion.
+	ShadowRemoveEvaders bool `yaml:"shadowRemoveEvaders"`
+}
+
+var Features FeatureConfig
+
+// Static holds the files served under /static.
+var Static fs.FS
+
+type CreateRequest[T any] struct {
+	models.IDs
+	Model T `json:"model"`
+}
+type UpdateRequest[T any] struct {
+	models.IDs
+	Mask T `json:"updateMask"`
+}
+type GetRequest struct {
+	models.IDs
+}
+type ListRequest struct {
+	models.IDs
+	models.PageRequest
+	models.SortRequest
+	// Flair narrows listings of posts to those with the flair.
+	Flair string `query:"flair"`
+	// IncludeNSFW lets NSFW posts into API listings, which leave them out
+	// unless asked.
+	IncludeNSFW bool `query:"include_nsfw"`
+}
+type DeleteRequest struct {
+	models.IDs
+}
+type Template struct {
+	Templates *template.Template
+	// Reload, when set, parses the templates afresh for every render so
+	// edits show up without a restart.
+	Reload func() (*template.Template, error)
+}
+type Page struct {
+	User     *models.User
+	Unread   int64
+	Messages int64
+	CSRF     string
+	Data     interface{}
+}
+type CreateCommentRequest struct {
+	models.IDs
+	ParentCommentID string `form:"parentCommentID"`
+	Content         string `form:"content"`
+}
+type CreatePostRequest struct {
+	models.IDs
+	Title   string `form:"title"`
+	Kind    string `form:"kind"`
+	URL     string `form:"url"`
+	MediaID string `form:"mediaID"`
+	FlairID string `form:"flairID"`
+	NSFW    bool   `form:"nsfw"`
+	Spoiler bool   `form:"spoiler"`
+	Content string `form:"content"`
+	// PollOptions are the answers of a poll post, open for PollDays or
+	// models.PollDuration when that is zero.
+	PollOptions []string `form:"pollOptions"`
+	PollDays    int      `form:"pollDays"`
+}
+type CreateTopicRequest struct {
+	ID          string `form:"id"`
+	Description string `form:"description"`
+}
+type VoteResponse struct {
+	Vote  int `json:"vote"`
+	Votes int `json:"votes"`
+}
+type DuplicatesRequest struct {
+	models.IDs
+	Title string `query:"title"`
+}
+type ArchiveRequest struct {
+	models.IDs
+	Year  int `param:"year"`
+	Month int `param:"month"`
+	Page  int `query:"page"`
+}
+type ArchiveMonth struct {
+	Year  int `json:"year"`
+	Month int `json:"month"`
+}
+type Archive struct {
+	TopicID string        `json:"topicID"`
+	Month   ArchiveMonth  `json:"month"`
+	Prev    ArchiveMonth  `json:"prev"`
+	Next    ArchiveMonth  `json:"next"`
+	Page    int           `json:"page"`
+	HasMore bool          `json:"hasMore"`
+	Posts   []models.Post `json:"posts"`
+}
+
+func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Context) (err error) {
+	ctx, span := tracing.Tracer.Start(c.Request().Context(), "render "+name)
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+	templates := t.Templates
+	if t.Reload != nil {
+		if templates, err = t.Reload(); err != nil {
+			return err
+		}
+	}
+	page := Page{User: CurrentUser(ctx), Data: FuzzVotes(data)}
+	page.CSRF, _ = c.Get("csrf").(string)
+	if page.User != nil {
+		unread, err := UnreadNotifications(ctx, page.User)
+		if err != nil {
+			return err
+		}
+		page.Unread = unread
+		if page.Messages, err = UnreadMessages(ctx, page.User); err != nil {
+			return err
+		}
+	}
+	return templates.ExecuteTemplate(w, name, page)
+}
+func V1[T any, R any](f func(context.Context, R) (T, error)) echo.HandlerFunc {
+	return V1WithStatus(http.StatusOK, f)
+}
+func V1WithStatus[T any, R any](status int, f func(context.Context, R) (T, error)) echo.HandlerFunc {
+	return Measured(Conditional(func(c echo.Context) error {
+		if c.Request().Method != http.MethodGet && CurrentUser(c.Request().Context()) == nil {
+			return Fail(c, ErrNotLoggedIn)
+		}
+		var req R
+		if err := c.Bind(&req); err != nil {
+			return Fail(c, err)
+		}
+		if err := Validate(req); err != nil {
+			return Fail(c, err)
+		}
+		obj, err := f(c.Request().Context(), req)
+		if err != nil {
+			return Fail(c, err)
+		}
+		if status == http.StatusNoContent {
+			return c.NoContent(status)
+		}
+		Paginate(obj, c.Request().URL)
+		if c.QueryParam("render") == "html" {
+			if renderer, ok := any(obj).(interface{ RenderContent() }); ok {
+				renderer.RenderContent()
+			}
+		}
+		return c.JSON(status, obj)
+	}))
+}
+func Serve[T any](template string, f func(models.IDs) T, prepare func(context.Context, *T, ListRequest) error, preloads ...string) echo.HandlerFunc {
+	return Measured(Conditional(func(c echo.Context) error {
+		var req ListRequest
+		if err := c.Bind(&req); err != nil {
+			return Fail(c, err)
+		}
+		obj, err := store.Get(c.Request().Context(), Store, f(req.IDs), preloads...)
+		if err != nil {
+			return Fail(c, err)
+		}
+		if err := prepare(c.Request().Context(), obj, req); err != nil {
+			return Fail(c, err)
+		}
+		Paginate(obj, c.Request().URL)
+		return c.Render(http.StatusOK, template, obj)
+	}))
+}
+func Paginate(obj any, u *url.URL) {
+	if paged, ok := obj.(interface{ Paging() *models.Pagination }); ok {
+		paged.Paging().Link(u)
+	}
+}
+func HandleCreate[T any, R any](f func(R, *models.User) T) echo.HandlerFunc {
+	return Measured(func(c echo.Context) error {
+		user := CurrentUser(c.Request().Context())
+		if user == nil {
+			return Fail(c, ErrNotLoggedIn)
+		}
+		var req R
+		if err := c.Bind(&req); err != nil {
+			return Fail(c, err)
+		}
+		if err := Validate(req); err != nil {
+			return Fail(c, err)
+		}
+		obj := f(req, user)
+		if err := Submit(c.Request().Context(), &obj, user); err != nil {
+			return Fail(c, err)
+		}
+		OnCreate(c.Request().Context(), &obj, user)
+		if comment, ok := any(&obj).(*models.Comment); ok && IsHTMX(c) {
+			// Held and removed comments are not shown, so there is
+			// nothing to add to the thread.
+			if Removed(comment) {
+				return c.NoContent(http.StatusNoContent)
+			}
+			comment.Author = user
+			if flairs, err := UserFlairs(c.Request().Context(), comment.TopicID, []string{user.ID}); err == nil {
+				comment.AuthorFlair = flairs[user.ID]
+			}
+			if comment.ParentCommentID != "" {
+				comment.Depth = 1
+			}
+			return c.Render(http.StatusOK, "comment-fragment", comment)
+		}
+		return c.JSON(http.StatusOK, obj)
+	})
+}
+func HandleVote[T any](f func(models.IDs) T, direction int, votes func(*T) int) echo.HandlerFunc {
+	return Measured(func(c echo.Context) error {
+		user := CurrentUser(c.Request().Context())
+		if user == nil {
+			return Fail(c, ErrNotLoggedIn)
+		}
+		var id models.IDs
+		if err := c.Bind(&id); err != nil {
+			return Fail(c, err)
+		}
+		if _, err := store.Get(c.Request().Context(), Store, f(id)); err != nil {
+			return Fail(c, err)
+		}
+		if err := CheckLocked(c.Request().Context(), Store, id.TopicID, id.PostID); err != nil {
+			return Fail(c, err)
+		}
+		key := models.Vote{UserID: user.ID, TopicID: id.TopicID, PostID: id.PostID, CommentID: id.CommentID}
+		target := f(id)
+		value, err := Store.CastVote(c.Request().Context(), &target, key, direction)
+		if err != nil {
+			return Fail(c, err)
+		}
+		countVote(id, direction)
+		if id.CommentID != "" {
+			if err := AutoPin(c.Request().Context(), Store, id.TopicID, id.PostID); err != nil {
+				return Fail(c, err)
+			}
+		}
+		obj, err := store.Get(c.Request().Context(), Store, f(id))
+		if err != nil {
+			return Fail(c, err)
+		}
+		FuzzVotes(obj)
+		PublishVotes(id, votes(obj))
+		if IsHTMX(c) {
+			state := Voting(obj)
+			state.MyVote = value
+			return c.Render(http.StatusOK, "votes-fragment", state)
+		}
+		return c.JSON(http.StatusOK, VoteResponse{Vote: value, Votes: votes(obj)})
+	})
+}
+func VotesByUser(c context.Context, user *models.User, topicID string, postID string) (map[string]int, error) {
+	votes := map[string]int{}
+	if user == nil {
+		return votes, nil
+	}
+	scopes := []store.Scope{store.Where("comment_id", "=", "")}
+	if postID != "" {
+		scopes = []store.Scope{store.Where("post_id", "=", postID), store.Where("comment_id", "<>", "")}
+	}
+	rows, err := store.Find(c, Store, models.Vote{UserID: user.ID, TopicID: topicID}, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	for _, vote := range rows {
+		votes[vote.PostID+"/"+vote.CommentID] = vote.Value
+	}
+	return votes, nil
+}
+
+func PrepareTopic(c context.Context, t *models.Topic, req ListRequest) error {
+	req.TopicID = t.ID
+	posts, err := topicPosts(c, req)
+	if err != nil {
+		return err
+	}
+	t.Posts, t.Page = posts.Items, posts.Pagination
+	if posts.NextPageToken != "" {
+		t.More = PostsURL(t.ID, req.SortRequest, req.Flair, t.Page.Limit, posts.NextPageToken)
+	}
+	if req.Offset == 0 && req.PageToken == "" {
+		pinned, err := PinnedPosts(c, req)
+		if err != nil {
+			return err
+		}
+		t.Posts = append(pinned.Items, t.Posts...)
+	}
+	if t.Flairs, err = store.Find(c, Store, models.Flair{TopicID: t.ID}, store.OrderBy("text")); err != nil {
+		return err
+	}
+	t.FlairID = req.Flair
+	if user := CurrentUser(c); user != nil {
+		flairs, err := UserFlairs(c, t.ID, []string{user.ID})
+		if err != nil {
+			return err
+		}
+		t.MyFlair = flairs[user.ID]
+	}
+	if t.Moderators, err = store.Find(c, Store, models.TopicModerator{TopicID: t.ID}, store.Preload("User")); err != nil {
+		return err
+	}
+	if t.Subscribers, err = Store.Count(c, &models.Subscription{}, &models.Subscription{TopicID: t.ID}); err != nil {
+		return err
+	}
+	t.Subscribed, err = IsSubscribed(c, CurrentUser(c), t.ID)
+	return err
+}
+func PreparePost(c context.Context, p *models.Post, req ListRequest) error {
+	if hidden, err := HiddenFrom(c, p.AuthorID, p.Shadowbanned); err != nil {
+		return err
+	} else if hidden {
+		return store.ErrNotFound
+	}
+	order, err := store.CommentOrder(req.SortRequest)
+	if err != nil {
+		return err
+	}
+	id := models.Comment{TopicID: p.TopicID, PostID: p.ID}
+	roots, err := store.List(c, Store, id, req.PageRequest, store.Preload("Author"), store.Where("parent_comment_id", "=", ""), store.Where("stickied", "=", false), store.Where("auto_pinned", "=", false), order, Visible(c))
+	if err != nil {
+		return err
+	}
+	if req.Offset == 0 && req.PageToken == "" {
+		stickied, err := store.Find(c, Store, models.Comment{TopicID: p.TopicID, PostID: p.ID, Stickied: true}, store.Preload("Author"), store.Where("parent_comment_id", "=", ""), Visible(c))
+		if err != nil {
+			return err
+		}
+		pinned, err := store.Find(c, Store, models.Comment{TopicID: p.TopicID, PostID: p.ID, AutoPinned: true}, store.Preload("Author"), store.Where("parent_comment_id", "=", ""), store.Where("stickied", "=", false), Visible(c))
+		if err != nil {
+			return err
+		}
+		roots.Items = append(append(stickied, pinned...), roots.Items...)
+	}
+	replies, err := store.Find(c, Store, id, store.Preload("Author"), store.Where("parent_comment_id", "<>", ""), order, Visible(c))
+	if err != nil {
+		return err
+	}
+	p.Comments, p.Page = append(roots.Items, replies...), roots.Pagination
+	if p.Moderator, err = IsModerator(c, CurrentUser(c), p.TopicID); err != nil {
+		return err
+	}
+	p.Moderator = p.Moderator || IsAdmin(CurrentUser(c))
+	author := []models.Post{{AuthorID: p.AuthorID}}
+	if err := AttachUserFlairs(c, p.TopicID, author, p.Comments); err != nil {
+		return err
+	}
+	p.AuthorFlair = author[0].AuthorFlair
+	p.Views += Views.Pending(models.IDs{TopicID: p.TopicID, PostID: p.ID})
+	LinkMedia(p.Media)
+	if err := AttachPreview(c, p); err != nil {
+		return err
+	}
+	if err := AttachPoll(c, p); err != nil {
+		return err
+	}
+	if err := AttachOriginal(c, p); err != nil {
+		return err
+	}
+	if user := CurrentUser(c); user != nil {
+		votes, err := store.Find(c, Store, models.Vote{UserID: user.ID, TopicID: p.TopicID, PostID: p.ID}, store.Where("comment_id", "=", ""), store.Page(models.PageRequest{Limit: 1}))
+		if err != nil {
+			return err
+		}
+		if len(votes) > 0 {
+			p.MyVote = votes[0].Value
+		}
+	}
+	if p.EditedAt != nil {
+		if p.Revisions, err = store.Find(c, Store, models.PostRevision{TopicID: p.TopicID, PostID: p.ID}, store.Preload("Editor"), store.OrderBy("created_at DESC")); err != nil {
+			return err
+		}
+	}
+	saved, err := SavedByUser(c, CurrentUser(c), p.TopicID, p.ID)
+	if err != nil {
+		return err
+	}
+	p.Saved = saved[p.ID+"/"]
+	if user := CurrentUser(c); user != nil {
+		if p.Hidden, err = hiddenBy(c, user, p); err != nil {
+			return err
+		}
+	}
+	votes, err := VotesByUser(c, CurrentUser(c), p.TopicID, p.ID)
+	for i := range p.Comments {
+		p.Comments[i].MyVote = votes[p.ID+"/"+p.Comments[i].ID]
+		p.Comments[i].Saved = saved[p.ID+"/"+p.Comments[i].ID]
+		p.Comments[i].Mine = CurrentUser(c) != nil && p.Comments[i].AuthorID == CurrentUser(c).ID
+		p.Comments[i].Moderator = p.Moderator
+	}
+	p.Thread = slices.DeleteFunc(models.BuildCommentTree(p.Comments, models.MaxCommentDepth), func(comment *models.Comment) bool {
+		return comment.ParentCommentID != ""
+	})
+	return err
+}
+func FindDuplicates(c context.Context, topicID string, title string) (*[]models.Post, error) {
+	key := models.TitleRules.Normalize(title)
+	if key == "" {
+		return &[]models.Post{}, nil
+	}
+	posts, err := store.Find(c, Store, models.Post{TopicID: topicID, NormalizedTitle: key}, Visible(c))
+	return &posts, err
+}
+func Owned[T any](c context.Context, id T, author func(*T) string) error {
+	user := CurrentUser(c)
+	if user == nil {
+		return ErrNotLoggedIn
+	}
+	obj, err := store.Get(c, Store, id)
+	if err != nil {
+		return err
+	}
+	if author(obj) != user.ID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (m ArchiveMonth) Start() time.Time {
+	return time.Date(m.Year, time.Month(m.Month), 1, 0, 0, 0, 0, time.UTC)
+}
+func (m ArchiveMonth) String() string {
+	return fmt.Sprintf("%04d/%02d", m.Year, m.Month)
+}
+func (a Archive) PrevPage() int { return a.Page - 1 }
+func (a Archive) NextPage() int { return a.Page + 1 }
+func monthOf(t time.Time) ArchiveMonth {
+	return ArchiveMonth{Year: t.Year(), Month: int(t.Month())}
+}
+func GetArchive(c context.Context, req ArchiveRequest) (*Archive, error) {
+	month := ArchiveMonth{Year: req.Year, Month: req.Month}
+	start := month.Start()
+	end := start.AddDate(0, 1, 0)
+	archive := &Archive{
+		TopicID: req.TopicID,
+		Month:   month,
+		Prev:    monthOf(start.AddDate(0, -1, 0)),
+		Next:    monthOf(end),
+		Page:    max(req.Page, 1),
+	}
+	posts, err := store.Find(c, Store, models.Post{TopicID: req.TopicID},
+		store.Where("created_at", ">=", start),
+		store.Where("created_at", "<", end),
+		store.OrderBy("created_at"),
+		store.Page(models.PageRequest{Limit: ArchivePageSize + 1, Offset: (archive.Page - 1) * ArchivePageSize}),
+		Visible(c))
+	archive.Posts = posts
+	if len(archive.Posts) > ArchivePageSize {
+		archive.Posts, archive.HasMore = archive.Posts[:ArchivePageSize], true
+	}
+	return archive, err
+}
+func HandleArchive(c echo.Context) error {
+	var req ArchiveRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	if req.Year < 1 || req.Year > 9999 || req.Month < 1 || req.Month > 12 {
+		return Fail(c, ErrInvalidMonth)
+	}
+	if _, err := store.Get(c.Request().Context(), Store, models.Topic{Model: models.Model{ID: req.TopicID}}); err != nil {
+		return Fail(c, err)
+	}
+	archive, err := GetArchive(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+		return c.JSON(http.StatusOK, archive)
+	}
+	return c.Render(http.StatusOK, "archive", archive)
+}
@@ -0,0 +1,980 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm/logger"
+
+	"reddit-clone/internal/events"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// newServer registers the routes against a fresh memory store, restoring
+// the package settings it changes once the test ends.
+func newServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	store_, secret, events_, limits, limiter, views, previews := Store, JWTSecret, Events, RateLimits, RateLimiter, Views, Previews
+	t.Cleanup(func() {
+		Store, JWTSecret, Events, RateLimits, RateLimiter, Views, Previews = store_, secret, events_, limits, limiter, views, previews
+	})
+	Store = store.NewMemoryStore()
+	JWTSecret = []byte("test secret")
+	Events = events.NewHub()
+	RateLimits, RateLimiter = RateLimitConfig{}, nil
+	Views = NewViewCounter(Views.Window)
+	// Link posts would otherwise be fetched from the internet.
+	Previews.Enabled = false
+	e := echo.New()
+	Register(e)
+	return e
+}
+
+// newUser signs up username and returns a bearer token for it.
+func newUser(t *testing.T, username string) (*models.User, string) {
+	t.Helper()
+	user, err := CreateUser(context.Background(), username, "password")
+	if err != nil {
+		t.Fatalf("create %s: %v", username, err)
+	}
+	token, err := IssueToken(user)
+	if err != nil {
+		t.Fatalf("token for %s: %v", username, err)
+	}
+	return user, token.Token
+}
+
+// create stores each object, failing the test on the first error.
+func create(t *testing.T, objs ...any) {
+	t.Helper()
+	for _, obj := range objs {
+		if err := Store.Create(context.Background(), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// call sends body as JSON with token as the bearer, either of which may be
+// empty, and decodes the response into out when given.
+func call(t *testing.T, e *echo.Echo, method, path, token string, body any, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if out != nil && rec.Code < http.StatusBadRequest {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+// get serves a GET of path through e, asking for JSON.
+func get(e *echo.Echo, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// csrfToken is the CSRF token postForm sends, as a page would.
+const csrfToken = "test csrf token"
+
+// postForm serves a form POST of values to path through e, sending cookies
+// and a CSRF token.
+func postForm(e *echo.Echo, path string, values url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	values = maps.Clone(values)
+	if values == nil {
+		values = url.Values{}
+	}
+	values.Set(CSRFCookie, csrfToken)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: csrfToken})
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// sessionCookie returns the session cookie rec sets.
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == SessionCookie {
+			return cookie
+		}
+	}
+	t.Fatalf("no session cookie in %v", rec.Header())
+	return nil
+}
+
+// login starts a session for user and returns its cookie.
+func login(t *testing.T, user *models.User) *http.Cookie {
+	t.Helper()
+	token, _, err := CreateSession(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: SessionCookie, Value: token}
+}
+
+func TestSignup(t *testing.T) {
+	features := Features
+	t.Cleanup(func() { Features = features })
+	Features.Signup = true
+	e := newServer(t)
+	signup := func(username, password string) *httptest.ResponseRecorder {
+		return postForm(e, "/signup", url.Values{"username": {username}, "password": {password}})
+	}
+	if rec := signup("alice", "correct horse"); rec.Code != http.StatusOK {
+		t.Fatalf("signup: %d %s", rec.Code, rec.Body)
+	}
+	users, err := store.Find(context.Background(), Store, models.User{Username: "alice"})
+	if err != nil || len(users) != 1 {
+		t.Fatalf("stored users: got %+v, %v", users, err)
+	}
+	if err := bcrypt.CompareHashAndPassword(users[0].PasswordHash, []byte("correct horse")); err != nil {
+		t.Errorf("stored password hash: %v", err)
+	}
+	for _, tc := range []struct {
+		username, password string
+		want               int
+	}{
+		{"alice", "another password", http.StatusConflict},
+		{"al", "correct horse", http.StatusBadRequest},
+		{"alice smith", "correct horse", http.StatusBadRequest},
+		{"bob", "short", http.StatusBadRequest},
+	} {
+		if rec := signup(tc.username, tc.password); rec.Code != tc.want {
+			t.Errorf("signup as %q with %q: got %d, want %d", tc.username, tc.password, rec.Code, tc.want)
+		}
+	}
+
+	Features.Signup = false
+	e = newServer(t)
+	if rec := signup("carol", "correct horse"); rec.Code != http.StatusNotFound {
+		t.Errorf("signup while disabled: got %d, want 404", rec.Code)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	features := Features
+	t.Cleanup(func() { Features = features })
+	Features.Signup = true
+	e := newServer(t)
+	c := context.Background()
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+	credentials := url.Values{"username": {"alice"}, "password": {"correct horse"}}
+	if rec := postForm(e, "/signup", credentials); rec.Code != http.StatusOK {
+		t.Fatalf("signup: %d %s", rec.Code, rec.Body)
+	} else if sessionCookie(t, rec).Value == "" {
+		t.Error("signup did not log the user in")
+	}
+	if rec := postForm(e, "/login", url.Values{"username": {"alice"}, "password": {"wrong password"}}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password: got %d, want 401", rec.Code)
+	}
+	rec := postForm(e, "/login", credentials)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", rec.Code, rec.Body)
+	}
+	cookie := sessionCookie(t, rec)
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("session cookie: HttpOnly %v, Secure %v, SameSite %v", cookie.HttpOnly, cookie.Secure, cookie.SameSite)
+	}
+	session := models.Session{Model: models.Model{ID: hashToken(cookie.Value)}}
+	if _, err := store.Get(c, Store, session); err != nil {
+		t.Fatalf("no session stored under the hash of the cookie: %v", err)
+	}
+
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Hello"}}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("post without a session: got %d, want 401", rec.Code)
+	}
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Hello"}}, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("post with a session: %d %s", rec.Code, rec.Body)
+	}
+	posts, err := store.Find(c, Store, models.Post{TopicID: "golang"}, store.Preload("Author"))
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("posts: got %+v, %v", posts, err)
+	}
+	if posts[0].Author == nil || posts[0].Author.Username != "alice" {
+		t.Errorf("post author: got %+v, want alice", posts[0].Author)
+	}
+
+	if rec := postForm(e, "/logout", nil, cookie); rec.Code != http.StatusOK || sessionCookie(t, rec).MaxAge >= 0 || !sessionCookie(t, rec).Secure {
+		t.Errorf("logout: got %d, cookie %v", rec.Code, rec.Header().Values("Set-Cookie"))
+	}
+	if _, err := store.Get(c, Store, session); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("logout kept the session: %v", err)
+	}
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Again"}}, cookie); rec.Code != http.StatusUnauthorized {
+		t.Errorf("post after logout: got %d, want 401", rec.Code)
+	}
+
+	secure := SecureCookies
+	t.Cleanup(func() { SecureCookies = secure })
+	SecureCookies = false
+	if rec := postForm(e, "/login", credentials); rec.Code != http.StatusOK || sessionCookie(t, rec).Secure {
+		t.Errorf("login without secure cookies: got %d, cookie %v", rec.Code, rec.Header().Values("Set-Cookie"))
+	}
+}
+
+// TestLoginTiming checks a login for an unknown username is not answered
+// much faster than one with a wrong password, which would tell the two
+// apart.
+func TestLoginTiming(t *testing.T) {
+	newServer(t)
+	newUser(t, "alice")
+	elapsed := func(username string) time.Duration {
+		t.Helper()
+		start := time.Now()
+		if _, err := Authenticate(context.Background(), username, "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("log in as %s: got %v", username, err)
+		}
+		return time.Since(start)
+	}
+	elapsed("nobody")
+	if known, unknown := elapsed("alice"), elapsed("nobody"); unknown < known/4 {
+		t.Errorf("a wrong password took %v but an unknown username only %v", known, unknown)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	e := newServer(t)
+	e.GET("/v1/me", func(c echo.Context) error { return c.JSON(http.StatusOK, CurrentUser(c.Request().Context())) }, JWTAuth)
+	alice, _ := newUser(t, "alice")
+
+	var token TokenResponse
+	if rec := call(t, e, http.MethodPost, "/v1/token", "", LoginRequest{Username: "alice", Password: "password"}, &token); rec.Code != http.StatusOK {
+		t.Fatalf("token: %d %s", rec.Code, rec.Body)
+	}
+	if d := time.Until(token.ExpiresAt); d < TokenLifetime-time.Minute || d > TokenLifetime {
+		t.Errorf("token expires in %v, want %v", d, TokenLifetime)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/token", "", LoginRequest{Username: "alice", Password: "wrong password"}, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token with a wrong password: got %d, want 401", rec.Code)
+	}
+	var me models.User
+	if rec := call(t, e, http.MethodGet, "/v1/me", token.Token, nil, &me); rec.Code != http.StatusOK || me.ID != alice.ID {
+		t.Errorf("request with the token: got %d as %+v", rec.Code, me)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/me", "", nil, nil); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "null" {
+		t.Errorf("request without a token: got %d %s", rec.Code, rec.Body)
+	}
+
+	secret := JWTSecret
+	JWTSecret = []byte("another secret")
+	forged, err := IssueToken(alice)
+	JWTSecret = secret
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.RegisteredClaims) string {
+		t.Helper()
+		signed, err := jwt.NewWithClaims(method, claims).SignedString(JWTSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	expired := sign(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: alice.ID, ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute))})
+	forever := sign(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: alice.ID})
+	hs512 := sign(jwt.SigningMethodHS512, jwt.RegisteredClaims{Subject: alice.ID, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))})
+	for name, bearer := range map[string]string{"garbage": "not a token", "another secret": forged.Token, "tampered": token.Token + "x", "expired": expired, "never expiring": forever, "HS512": hs512} {
+		if rec := call(t, e, http.MethodGet, "/v1/me", bearer, nil, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s token: got %d, want 401", name, rec.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/v1/me", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Basic "+token.Token)
+	rec := httptest.NewRecorder()
+	if e.ServeHTTP(rec, req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token without the Bearer scheme: got %d, want 401", rec.Code)
+	}
+}
+
+func TestOwned(t *testing.T) {
+	newServer(t)
+	alice, _ := newUser(t, "alice")
+	bob, _ := newUser(t, "bob")
+	create(t, &models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Hello"})
+	author := func(p *models.Post) string { return p.AuthorID }
+	id := models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}
+	if err := Owned(WithUser(context.Background(), alice), id, author); err != nil {
+		t.Errorf("the author: %v", err)
+	}
+	if err := Owned(WithUser(context.Background(), bob), id, author); !errors.Is(err, ErrForbidden) {
+		t.Errorf("another user: got %v, want ErrForbidden", err)
+	}
+	if err := Owned(context.Background(), id, author); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("nobody: got %v, want ErrNotLoggedIn", err)
+	}
+}
+
+// fakeProvider registers an OAuth provider named fake whose token and
+// profile endpoints are served by a test server. The profile is read from
+// *subject and *username at the time of the callback.
+func fakeProvider(t *testing.T, subject, username *string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		fmt.Fprint(w, `{"access_token":"access","token_type":"bearer"}`)
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(echo.HeaderAuthorization) != "Bearer access" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"sub": *subject, "login": *username})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	OAuthProviders["fake"] = OAuthProvider{
+		Config: &oauth2.Config{
+			ClientID:     "client",
+			ClientSecret: "secret",
+			Endpoint:     oauth2.Endpoint{AuthURL: srv.URL + "/authorize", TokenURL: srv.URL + "/token", AuthStyle: oauth2.AuthStyleInParams},
+			RedirectURL:  "http://example.com/auth/fake/callback",
+		},
+		Profile: func(c context.Context, client *http.Client) (*OAuthProfile, error) {
+			var profile struct{ Sub, Login string }
+			if err := fetchProfile(c, client, srv.URL+"/user", &profile); err != nil {
+				return nil, err
+			}
+			return &OAuthProfile{Subject: profile.Sub, Username: profile.Login}, nil
+		},
+	}
+	t.Cleanup(func() { delete(OAuthProviders, "fake") })
+}
+
+func TestOAuthLogin(t *testing.T) {
+	e := newServer(t)
+	c := context.Background()
+	subject, username := "1", "alice"
+	fakeProvider(t, &subject, &username)
+	newUser(t, "alice")
+
+	// login follows the redirect to the provider and back to the callback
+	// with code, returning the session cookie it sets.
+	login := func(code string, cookies ...*http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/fake/login", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("login: %d %s", rec.Code, rec.Body)
+		}
+		location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := location.Query().Get("state")
+		if state == "" || location.Query().Get("redirect_uri") != "http://example.com/auth/fake/callback" {
+			t.Fatalf("redirect to the provider: %s", location)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+		for _, cookie := range append(rec.Result().Cookies(), cookies...) {
+			req.AddCookie(cookie)
+		}
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == SessionCookie {
+				return rec, cookie
+			}
+		}
+		return rec, nil
+	}
+	userOf := func(cookie *http.Cookie) string {
+		t.Helper()
+		session, err := store.Get(c, Store, models.Session{Model: models.Model{ID: hashToken(cookie.Value)}}, "User")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session.User.Username
+	}
+
+	rec, cookie := login("good code")
+	if rec.Code != http.StatusFound || cookie == nil {
+		t.Fatalf("callback: %d %s", rec.Code, rec.Body)
+	}
+	first := userOf(cookie)
+	if first == "alice" || !strings.HasPrefix(first, "alice") {
+		t.Errorf("new user for a taken name: got %q, want alice and a suffix", first)
+	}
+	if _, cookie := login("good code"); cookie == nil || userOf(cookie) != first {
+		t.Errorf("second login with the same identity did not sign in as %s", first)
+	}
+
+	subject, username = "2", "someone-else"
+	if _, again := login("good code", cookie); again == nil || userOf(again) != first {
+		t.Errorf("a new identity while logged in was not linked to %s", first)
+	}
+	identities, err := Store.Count(c, &models.Identity{}, &models.Identity{Provider: "fake"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := Store.Count(c, &models.User{}, &models.User{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identities != 2 || users != 2 {
+		t.Errorf("got %d identities and %d users, want 2 and 2", identities, users)
+	}
+
+	if rec, _ := login("bad code"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("callback with a bad code: got %d, want 401", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/auth/fake/callback?state=forged&code=good+code", nil)
+	req.AddCookie(&http.Cookie{Name: OAuthStateCookie, Value: "the real state"})
+	rec = httptest.NewRecorder()
+	if e.ServeHTTP(rec, req); rec.Code != http.StatusBadRequest {
+		t.Errorf("callback with the wrong state: got %d, want 400", rec.Code)
+	}
+	if rec := get(e, "/auth/gitlab/login"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown provider: got %d, want 404", rec.Code)
+	}
+}
+
+func TestVotes(t *testing.T) {
+	e := newServer(t)
+	alice, _ := newUser(t, "alice")
+	bob, _ := newUser(t, "bob")
+	create(t,
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Hello"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", Content: "Hi"},
+	)
+	vote := func(path string, cookie *http.Cookie) VoteResponse {
+		t.Helper()
+		rec := postForm(e, path, nil, cookie)
+		var res VoteResponse
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, rec.Code, rec.Body)
+		} else if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	cookie := login(t, alice)
+	for i, tc := range []struct {
+		direction   string
+		vote, votes int
+	}{{"upvote", 1, 1}, {"upvote", 0, 0}, {"upvote", 1, 1}, {"downvote", -1, -1}, {"downvote", 0, 0}, {"downvote", -1, -1}} {
+		if got := vote("/topics/golang/posts/p1/"+tc.direction, cookie); got.Vote != tc.vote || got.Votes != tc.votes {
+			t.Errorf("vote %d, %s: got vote %d and score %d, want %d and %d", i+1, tc.direction, got.Vote, got.Votes, tc.vote, tc.votes)
+		}
+	}
+	if got := vote("/topics/golang/posts/p1/upvote", login(t, bob)); got.Votes != 0 {
+		t.Errorf("bob's upvote over alice's downvote: got score %d, want 0", got.Votes)
+	}
+	if got := vote("/topics/golang/posts/p1/comments/c1/upvote", cookie); got.Vote != 1 || got.Votes != 1 {
+		t.Errorf("comment upvote: got vote %d and score %d", got.Vote, got.Votes)
+	}
+
+	post := models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}
+	if err := PreparePost(WithUser(context.Background(), alice), &post, ListRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if post.MyVote != -1 || len(post.Comments) != 1 || post.Comments[0].MyVote != 1 {
+		t.Errorf("alice's votes on the post page: post %d, comments %+v", post.MyVote, post.Comments)
+	}
+
+	if rec := postForm(e, "/topics/golang/posts/p1/upvote", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("vote without a session: got %d, want 401", rec.Code)
+	}
+	if rec := postForm(e, "/topics/golang/posts/missing/upvote", nil, cookie); rec.Code != http.StatusNotFound {
+		t.Errorf("vote on a missing post: got %d, want 404", rec.Code)
+	}
+}
+
+// TestV1CRUD walks topics, posts and comments through the v1 API, as
+// their author, as another user and signed out.
+func TestV1CRUD(t *testing.T) {
+	e := newServer(t)
+	_, alice := newUser(t, "alice")
+	_, bob := newUser(t, "bob")
+	_, carol := newUser(t, "carol")
+	expect := func(rec *httptest.ResponseRecorder, want int, what string) {
+		t.Helper()
+		if rec.Code != want {
+			t.Errorf("%s: got %d, want %d: %s", what, rec.Code, want, rec.Body)
+		}
+	}
+	topic := map[string]any{"model": map[string]any{"id": "golang", "description": "Go"}}
+	expect(call(t, e, http.MethodPost, "/v1/topics", "", topic, nil), http.StatusUnauthorized, "create topic signed out")
+	expect(call(t, e, http.MethodPost, "/v1/topics", alice, topic, nil), http.StatusCreated, "create topic")
+	expect(call(t, e, http.MethodPost, "/v1/topics", bob, topic, nil), http.StatusConflict, "create a taken topic")
+	expect(call(t, e, http.MethodPost, "/v1/topics", alice, "not an object", nil), http.StatusBadRequest, "create topic from a bad body")
+	expect(call(t, e, http.MethodPost, "/v1/topics", alice, map[string]any{"model": map[string]any{"id": "rust"}}, nil), http.StatusCreated, "create another topic")
+	var got models.Topic
+	expect(call(t, e, http.MethodGet, "/v1/topics/golang", "", nil, &got), http.StatusOK, "get topic")
+	if got.ID != "golang" || got.Description != "Go" {
+		t.Errorf("topic: got %q, %q", got.ID, got.Description)
+	}
+	expect(call(t, e, http.MethodGet, "/v1/topics/java", "", nil, nil), http.StatusNotFound, "get missing topic")
+	edit := map[string]any{"updateMask": map[string]any{"description": "The Go language"}}
+	expect(call(t, e, http.MethodPut, "/v1/topics/golang", bob, edit, nil), http.StatusForbidden, "update topic as another user")
+	expect(call(t, e, http.MethodPut, "/v1/topics/golang", alice, edit, &got), http.StatusOK, "update topic as its moderator")
+	if got.Description != "The Go language" {
+		t.Errorf("updated description: got %q", got.Description)
+	}
+	var topics models.ListResponse[models.Topic]
+	expect(call(t, e, http.MethodGet, "/v1/topics", "", nil, &topics), http.StatusOK, "list topics")
+	if len(topics.Items) != 2 || topics.Items[0].ID != "golang" || topics.Items[1].ID != "rust" {
+		t.Errorf("listed topics: got %+v", topics.Items)
+	}
+
+	var post models.Post
+	expect(call(t, e, http.MethodPost, "/v1/topics/golang/posts", alice, map[string]any{"model": map[string]any{"title": "Hello", "content": "First"}}, &post), http.StatusCreated, "create post")
+	expect(call(t, e, http.MethodPost, "/v1/topics/java/posts", alice, map[string]any{"model": map[string]any{"title": "Hello"}}, nil), http.StatusNotFound, "create post in missing topic")
+	postPath := "/v1/topics/golang/posts/" + post.ID
+	expect(call(t, e, http.MethodGet, postPath, "", nil, &post), http.StatusOK, "get post")
+	if post.Title != "Hello" || post.Content != "First" {
+		t.Errorf("post: got %q, %q", post.Title, post.Content)
+	}
+	var posts models.ListResponse[models.Post]
+	expect(call(t, e, http.MethodGet, "/v1/topics/golang/posts", "", nil, &posts), http.StatusOK, "list posts")
+	if len(posts.Items) != 1 || posts.Items[0].ID != post.ID {
+		t.Errorf("listed posts: got %+v", posts.Items)
+	}
+	postEdit := map[string]any{"updateMask": map[string]any{"title": "Hello, World", "content": "Edited"}}
+	expect(call(t, e, http.MethodPut, postPath, "", postEdit, nil), http.StatusUnauthorized, "update post signed out")
+	expect(call(t, e, http.MethodPut, postPath, bob, postEdit, nil), http.StatusForbidden, "update post as another user")
+	expect(call(t, e, http.MethodPut, postPath, alice, postEdit, &post), http.StatusOK, "update post as its author")
+	if post.Content != "Edited" {
+		t.Errorf("edited post: got %q", post.Content)
+	}
+	if dups, err := FindDuplicates(context.Background(), "golang", "hello world"); err != nil || len(*dups) != 1 {
+		t.Errorf("the edited title is not keyed: got %v, %v", dups, err)
+	}
+
+	var comment models.Comment
+	expect(call(t, e, http.MethodPost, postPath+"/comments", bob, map[string]any{"model": map[string]any{"content": "Reply"}}, &comment), http.StatusCreated, "create comment")
+	expect(call(t, e, http.MethodPost, "/v1/topics/golang/posts/missing/comments", bob, map[string]any{"model": map[string]any{"content": "Reply"}}, nil), http.StatusNotFound, "create comment on missing post")
+	commentPath := postPath + "/comments/" + comment.ID
+	expect(call(t, e, http.MethodGet, commentPath, "", nil, &comment), http.StatusOK, "get comment")
+	var comments models.ListResponse[models.Comment]
+	expect(call(t, e, http.MethodGet, postPath+"/comments", "", nil, &comments), http.StatusOK, "list comments")
+	if len(comments.Items) != 1 {
+		t.Errorf("listed comments: got %d", len(comments.Items))
+	}
+	expect(call(t, e, http.MethodPut, commentPath, carol, map[string]any{"updateMask": map[string]any{"content": "Not mine"}}, nil), http.StatusForbidden, "update comment as another user")
+	expect(call(t, e, http.MethodPut, commentPath, bob, map[string]any{"updateMask": map[string]any{"content": "Edited reply"}}, &comment), http.StatusOK, "update comment as its author")
+	if comment.Content != "Edited reply" {
+		t.Errorf("edited comment: got %q", comment.Content)
+	}
+	expect(call(t, e, http.MethodDelete, commentPath, carol, nil, nil), http.StatusForbidden, "delete comment as another user")
+	expect(call(t, e, http.MethodDelete, commentPath, bob, nil, nil), http.StatusNoContent, "delete comment as its author")
+	expect(call(t, e, http.MethodGet, commentPath, "", nil, nil), http.StatusNotFound, "get deleted comment")
+
+	expect(call(t, e, http.MethodDelete, postPath, bob, nil, nil), http.StatusForbidden, "delete post as another user")
+	expect(call(t, e, http.MethodDelete, postPath, alice, nil, nil), http.StatusNoContent, "delete post as its author")
+	expect(call(t, e, http.MethodGet, postPath, "", nil, nil), http.StatusNotFound, "get deleted post")
+	expect(call(t, e, http.MethodDelete, postPath, alice, nil, nil), http.StatusNotFound, "delete deleted post")
+
+	expect(call(t, e, http.MethodDelete, "/v1/topics/golang", "", nil, nil), http.StatusUnauthorized, "delete topic signed out")
+	expect(call(t, e, http.MethodDelete, "/v1/topics/golang", bob, nil, nil), http.StatusForbidden, "delete topic as another user")
+	expect(call(t, e, http.MethodDelete, "/v1/topics/golang", alice, nil, nil), http.StatusNoContent, "delete topic as its moderator")
+	expect(call(t, e, http.MethodGet, "/v1/topics/golang", "", nil, nil), http.StatusNotFound, "get deleted topic")
+	expect(call(t, e, http.MethodDelete, "/v1/topics/golang", alice, nil, nil), http.StatusNotFound, "delete deleted topic")
+}
+
+func TestPagination(t *testing.T) {
+	e := newServer(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 30 {
+		create(t, &models.Post{Model: models.Model{ID: fmt.Sprintf("p%02d", i), CreatedAt: start.Add(time.Duration(i) * time.Minute)}, TopicID: "golang", Title: "Post"})
+	}
+	list := func(query string) models.ListResponse[models.Post] {
+		t.Helper()
+		var page models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts"+query, "", nil, &page); rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", query, rec.Code, rec.Body)
+		}
+		return page
+	}
+	page := list("")
+	if len(page.Items) != models.DefaultPageSize || page.Total != 30 || page.Items[0].ID != "p29" || page.Prev != "" {
+		t.Errorf("first page: got %d of %d from %s, prev %q", len(page.Items), page.Total, page.Items[0].ID, page.Prev)
+	}
+	if page.Next != "/v1/topics/golang/posts?limit=25&offset=25" {
+		t.Errorf("first page next link: got %q", page.Next)
+	}
+	page = list("?limit=10&offset=25")
+	if len(page.Items) != 5 || page.Items[0].ID != "p04" || page.Next != "" || page.Prev != "/v1/topics/golang/posts?limit=10&offset=15" {
+		t.Errorf("last page: got %d from %s, next %q, prev %q", len(page.Items), page.Items[0].ID, page.Next, page.Prev)
+	}
+	if page := list("?limit=500&offset=-3"); page.Limit != models.MaxPageSize || page.Offset != 0 || len(page.Items) != 30 {
+		t.Errorf("limit 500 at offset -3: got limit %d, offset %d, %d items", page.Limit, page.Offset, len(page.Items))
+	}
+
+	topic := models.Topic{Model: models.Model{ID: "golang"}}
+	if err := PrepareTopic(context.Background(), &topic, ListRequest{PageRequest: models.PageRequest{Limit: 10, Offset: 10}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(topic.Posts) != 10 || topic.Posts[0].ID != "p19" || topic.Page.Total != 30 || !topic.Page.HasNext() || !topic.Page.HasPrev() {
+		t.Errorf("topic page: got %d posts from %s, page %+v", len(topic.Posts), topic.Posts[0].ID, topic.Page)
+	}
+}
+
+func TestSortPosts(t *testing.T) {
+	e := newServer(t)
+	now := time.Now()
+	for _, post := range []models.Post{
+		{Model: models.Model{ID: "old", CreatedAt: now.Add(-48 * time.Hour)}, Votes: 10},
+		// The top cutoffs are truncated to the minute, so "recent" sits a
+		// couple of minutes outside the last hour.
+		{Model: models.Model{ID: "recent", CreatedAt: now.Add(-time.Hour - 2*time.Minute)}, Votes: 3},
+		{Model: models.Model{ID: "new", CreatedAt: now}},
+	} {
+		post.TopicID, post.Title = "golang", post.ID
+		create(t, &post)
+	}
+	for query, want := range map[string]string{
+		"":                 "[recent new old]",
+		"?sort=new":        "[new recent old]",
+		"?sort=hot":        "[recent new old]",
+		"?sort=top&t=all":  "[old recent new]",
+		"?sort=top":        "[recent new]",
+		"?sort=top&t=week": "[old recent new]",
+		"?sort=top&t=hour": "[new]",
+	} {
+		var page models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts"+query, "", nil, &page); rec.Code != http.StatusOK {
+			t.Fatalf("%q: %d %s", query, rec.Code, rec.Body)
+		}
+		var ids []string
+		for _, post := range page.Items {
+			ids = append(ids, post.ID)
+		}
+		if got := fmt.Sprint(ids); got != want {
+			t.Errorf("%q: got %s, want %s", query, got, want)
+		}
+	}
+	for _, query := range []string{"?sort=bogus", "?sort=top&t=decade"} {
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts"+query, "", nil, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: got %d, want 400", query, rec.Code)
+		}
+	}
+
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	body := rec.Body.String()
+	recent, fresh, old := strings.Index(body, ">recent<"), strings.Index(body, ">new<"), strings.Index(body, ">old<")
+	if rec.Code != http.StatusOK || recent < 0 || !(recent < fresh && fresh < old) {
+		t.Errorf("the front page should list the posts hottest first: got %d %s", rec.Code, body)
+	}
+}
+
+// TestSortComments lists comments by each sort, through the API and on
+// the post page.
+func TestSortComments(t *testing.T) {
+	e := newServer(t)
+	now := time.Now()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Sorted"},
+	)
+	for _, comment := range []models.Comment{
+		{Model: models.Model{ID: "popular", CreatedAt: now.Add(-4 * time.Hour)}, Ups: 30, Downs: 20},
+		{Model: models.Model{ID: "solid", CreatedAt: now.Add(-3 * time.Hour)}, Ups: 10, Downs: 1},
+		{Model: models.Model{ID: "split", CreatedAt: now.Add(-2 * time.Hour)}, Ups: 5, Downs: 5},
+		{Model: models.Model{ID: "lucky", CreatedAt: now.Add(-time.Hour)}, Ups: 1},
+		{Model: models.Model{ID: "fresh", CreatedAt: now}},
+	} {
+		comment.TopicID, comment.PostID, comment.Content = "golang", "p1", comment.ID
+		comment.Votes = comment.Ups - comment.Downs
+		scores := comment.Scores()
+		comment.BestScore, comment.Controversy = scores["best_score"].(float64), scores["controversy"].(float64)
+		create(t, &comment)
+	}
+	orders := map[string]string{
+		"":                    "[solid popular lucky split fresh]",
+		"?sort=best":          "[solid popular lucky split fresh]",
+		"?sort=top":           "[popular solid lucky split fresh]",
+		"?sort=new":           "[fresh lucky split solid popular]",
+		"?sort=old":           "[popular solid split lucky fresh]",
+		"?sort=controversial": "[popular split solid lucky fresh]",
+	}
+	for query, want := range orders {
+		var page models.ListResponse[models.Comment]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1/comments"+query, "", nil, &page); rec.Code != http.StatusOK {
+			t.Fatalf("%q: %d %s", query, rec.Code, rec.Body)
+		}
+		var ids []string
+		for _, comment := range page.Items {
+			ids = append(ids, comment.ID)
+		}
+		if got := fmt.Sprint(ids); got != want {
+			t.Errorf("%q: got %s, want %s", query, got, want)
+		}
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1/comments?sort=hot", "", nil, nil); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_sort") {
+		t.Errorf("an unknown comment sort: got %d %s", rec.Code, rec.Body)
+	}
+
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	for query, want := range orders {
+		rec := get(e, "/topics/golang/posts/p1"+query)
+		body := rec.Body.String()
+		var ids []string
+		for _, id := range []string{"popular", "solid", "split", "lucky", "fresh"} {
+			if !strings.Contains(body, "<p>"+id+"</p>") {
+				t.Fatalf("the post page%s lacks %s: %s", query, id, body)
+			}
+			ids = append(ids, id)
+		}
+		slices.SortFunc(ids, func(a, b string) int {
+			return strings.Index(body, "<p>"+a+"</p>") - strings.Index(body, "<p>"+b+"</p>")
+		})
+		if got := fmt.Sprint(ids); rec.Code != http.StatusOK || got != want {
+			t.Errorf("the post page%s: got %d %s, want %s", query, rec.Code, got, want)
+		}
+	}
+}
+
+// TestSearch runs on a sqlite store and needs the sqlite_fts5 build tag;
+// without it, it only checks that search reports itself unavailable.
+func TestSearch(t *testing.T) {
+	e := newServer(t)
+	c := context.Background()
+	search := func(query string) (*httptest.ResponseRecorder, models.ListResponse[models.SearchResult]) {
+		t.Helper()
+		var res models.ListResponse[models.SearchResult]
+		return call(t, e, http.MethodGet, "/v1/search?"+query, "", nil, &res), res
+	}
+	s, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.DB.Logger = logger.Discard
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	Store = s
+	if err := s.SetupSearch(); err != nil {
+		if rec, _ := search("q=generics"); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("search without FTS5: got %d, want 503", rec.Code)
+		}
+		t.Skipf("FTS5 is unavailable: %v", err)
+	}
+	alice, _ := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "books"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Generics in Go", Content: "Type parameters <b>at last</b>."},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "books", AuthorID: alice.ID, Title: "Reading list", Content: "The Go Programming Language."},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: alice.ID, Content: "I waited years for generics."},
+	)
+	kinds := func(res models.ListResponse[models.SearchResult]) string {
+		var kinds []string
+		for _, r := range res.Items {
+			kinds = append(kinds, r.Kind+":"+r.PostID+r.CommentID)
+		}
+		slices.Sort(kinds)
+		return fmt.Sprint(kinds)
+	}
+
+	rec, res := search("q=generics")
+	if rec.Code != http.StatusOK || kinds(res) != "[comment:p1c1 post:p1]" {
+		t.Fatalf("generics: got %d %s", rec.Code, kinds(res))
+	}
+	for _, r := range res.Items {
+		if r.Kind == "post" && r.Title != "<mark>Generics</mark> in Go" {
+			t.Errorf("post title: got %q", r.Title)
+		}
+		if r.Kind == "comment" && (r.Title != "Generics in Go" || !strings.Contains(string(r.Snippet), "<mark>generics</mark>")) {
+			t.Errorf("comment result: got title %q and snippet %q", r.Title, r.Snippet)
+		}
+	}
+	if _, res := search("q=at+last"); len(res.Items) != 1 || strings.Contains(string(res.Items[0].Snippet), "<b>") {
+		t.Errorf("markup in a snippet is not escaped: %+v", res.Items)
+	}
+	if _, res := search("q=generics&topic=books"); len(res.Items) != 0 {
+		t.Errorf("generics in books: got %s", kinds(res))
+	}
+	if rec, _ := search(url.Values{"q": {`go" OR NOT (*`}}.Encode()); rec.Code != http.StatusOK {
+		t.Errorf("a query of FTS syntax: got %d %s", rec.Code, rec.Body)
+	}
+
+	if err := Store.Update(c, &models.Post{Model: models.Model{ID: "p2"}, TopicID: "books"}, models.Post{Content: "Now with generics."}); err != nil {
+		t.Fatal(err)
+	}
+	if _, res := search("q=generics&topic=books"); kinds(res) != "[post:p2]" {
+		t.Errorf("an edited post is not reindexed: got %s", kinds(res))
+	}
+	if err := Store.Delete(c, &models.Post{}, &models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, res := search("q=generics"); kinds(res) != "[post:p2]" {
+		t.Errorf("a deleted post and its comments still match: got %s", kinds(res))
+	}
+	if rec, _ := search("q=+"); rec.Code != http.StatusBadRequest {
+		t.Errorf("an empty query: got %d, want 400", rec.Code)
+	}
+}
+
+// TestRenderHTML checks contentHTML is only filled in with ?render=html.
+func TestRenderHTML(t *testing.T) {
+	e := newServer(t)
+	create(t,
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Hello", Content: "*hi*"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", Content: "**yes**"},
+	)
+	var post models.Post
+	if call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1", "", nil, &post); post.ContentHTML != "" {
+		t.Errorf("contentHTML without render=html: %q", post.ContentHTML)
+	}
+	if call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1?render=html", "", nil, &post); post.ContentHTML != "<p><em>hi</em></p>\n" {
+		t.Errorf("post contentHTML: got %q", post.ContentHTML)
+	}
+	var comments models.ListResponse[models.Comment]
+	call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1/comments?render=html", "", nil, &comments)
+	if len(comments.Items) != 1 || comments.Items[0].ContentHTML != "<p><strong>yes</strong></p>\n" {
+		t.Errorf("listed comments with render=html: got %+v", comments.Items)
+	}
+}
+
+// TestStripTitles saves a topic and a post with markup in their ID and
+// title, and checks it was stripped before the title was keyed. The API
+// refuses markup in a topic ID, so the topic goes straight to the store.
+func TestStripTitles(t *testing.T) {
+	e := newServer(t)
+	_, alice := newUser(t, "alice")
+	topic := &models.Topic{Model: models.Model{ID: "<em>golang</em>"}}
+	if create(t, topic); topic.ID != "golang" {
+		t.Fatalf("created topic ID %q", topic.ID)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics", alice, map[string]any{"model": map[string]any{"id": "<em>rust</em>"}}, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("create topic with markup in its ID through the API: got %d, want 400", rec.Code)
+	}
+	var post models.Post
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", alice, map[string]any{"model": map[string]any{"title": "<b>Bold</b> title"}}, &post); rec.Code != http.StatusCreated || post.Title != "Bold title" {
+		t.Fatalf("create post: %d, title %q", rec.Code, post.Title)
+	}
+	if dups, err := FindDuplicates(context.Background(), "golang", "bold title"); err != nil || len(*dups) != 1 {
+		t.Errorf("duplicates of the stripped title: got %v, %v", dups, err)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	newServer(t)
+	c := context.Background()
+	create(t,
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Hello, World!"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", Title: "Something else"},
+		&models.Post{Model: models.Model{ID: "p3"}, TopicID: "books", Title: "hello world"},
+	)
+	posts, err := FindDuplicates(c, "golang", "HELLO  world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*posts) != 1 || (*posts)[0].ID != "p1" {
+		t.Errorf("duplicates of %q in golang: got %+v, want p1", "HELLO  world", *posts)
+	}
+	if posts, err := FindDuplicates(c, "golang", "?!"); err != nil || len(*posts) != 0 {
+		t.Errorf("duplicates of a title without words: got %+v, %v", posts, err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	e := newServer(t)
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}}, &models.Topic{Model: models.Model{ID: "books"}})
+	post := func(id, topic string, created time.Time) {
+		t.Helper()
+		create(t, &models.Post{Model: models.Model{ID: id, CreatedAt: created}, TopicID: topic, Title: id})
+	}
+	post("last-of-2023", "golang", time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC))
+	post("first-of-2024", "golang", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	post("mid-january", "golang", time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC))
+	post("other-topic", "books", time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC))
+	post("first-of-february", "golang", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	for i := range ArchivePageSize + 1 {
+		post(fmt.Sprintf("march-%02d", i), "golang", time.Date(2024, 3, 1, i, 0, 0, 0, time.UTC))
+	}
+	archive := func(path string) Archive {
+		t.Helper()
+		rec := get(e, path)
+		var a Archive
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, rec.Code, rec.Body)
+		} else if err := json.Unmarshal(rec.Body.Bytes(), &a); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	titles := func(a Archive) string {
+		var titles []string
+		for _, p := range a.Posts {
+			titles = append(titles, p.Title)
+		}
+		return fmt.Sprint(titles)
+	}
+	for _, tc := range []struct {
+		path, posts string
+		prev, next  ArchiveMonth
+	}{
+		{"/topics/golang/archive/2024/01", "[first-of-2024 mid-january]", ArchiveMonth{2023, 12}, ArchiveMonth{2024, 2}},
+		{"/topics/golang/archive/2023/12", "[last-of-2023]", ArchiveMonth{2023, 11}, ArchiveMonth{2024, 1}},
+		{"/topics/golang/archive/2024/02", "[first-of-february]", ArchiveMonth{2024, 1}, ArchiveMonth{2024, 3}},
+		{"/topics/golang/archive/2023/06", "[]", ArchiveMonth{2023, 5}, ArchiveMonth{2023, 7}},
+	} {
+		a := archive(tc.path)
+		if got := titles(a); got != tc.posts {
+			t.Errorf("%s: got posts %s, want %s", tc.path, got, tc.posts)
+		}
+		if a.Prev != tc.prev || a.Next != tc.next {
+			t.Errorf("%s: got prev %v and next %v, want %v and %v", tc.path, a.Prev, a.Next, tc.prev, tc.next)
+		}
+	}
+	if a := archive("/topics/golang/archive/2024/03"); len(a.Posts) != ArchivePageSize || !a.HasMore {
+		t.Errorf("first page of March: got %d posts, more %v", len(a.Posts), a.HasMore)
+	}
+	if a := archive("/topics/golang/archive/2024/03?page=2"); titles(a) != fmt.Sprintf("[march-%02d]", ArchivePageSize) || a.HasMore {
+		t.Errorf("second page of March: got %s, more %v", titles(a), a.HasMore)
+	}
+	for path, want := range map[string]int{"/topics/golang/archive/2024/13": http.StatusBadRequest, "/topics/rust/archive/2024/01": http.StatusNotFound} {
+		if rec := get(e, path); rec.Code != want {
+			t.Errorf("%s: got %d, want %d", path, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// ReadyTimeout bounds how long the readiness checks may take together.
+const ReadyTimeout = 5 * time.Second
+
+// Redis, when set, is shared with the other replicas and must answer for
+// this one to be ready.
+var Redis *redis.Client
+
+type Check struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+type Health struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks,omitempty"`
+}
+
+// HandleHealthz answers as long as the process is up.
+func HandleHealthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, Health{Status: "ok"})
+}
+
+// HandleReadyz reports whether the server can take traffic: the database
+// answers, its tables are migrated, the templates are loaded and Redis, if
+// used, answers. Any failing
+// check makes it a 503 so load balancers route around the instance.
+func HandleReadyz(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), ReadyTimeout)
+	defer cancel()
+	health := Health{Status: "ok", Checks: map[string]Check{}}
+	checks := map[string]func(context.Context) error{
+		"database":   Store.Ping,
+		"migrations": Store.Migrated,
+		"templates":  func(context.Context) error { return templatesLoaded(c.Echo()) },
+	}
+	if Redis != nil {
+		checks["redis"] = func(c context.Context) error { return Redis.Ping(c).Err() }
+	}
+	for name, check := range checks {
+		start := time.Now()
+		result := Check{Status: "ok"}
+		if err := check(ctx); err != nil {
+			result.Status, result.Error, health.Status = "failing", err.Error(), "unavailable"
+		}
+		result.Latency = time.Since(start).String()
+		health.Checks[name] = result
+	}
+	if health.Status != "ok" {
+		return c.JSON(http.StatusServiceUnavailable, health)
+	}
+	return c.JSON(http.StatusOK, health)
+}
+func templatesLoaded(e *echo.Echo) error {
+	if t, ok := e.Renderer.(*Template); !ok || t.Templates == nil || len(t.Templates.Templates()) == 0 {
+		return errors.New("no templates are loaded")
+	}
+	return nil
+}
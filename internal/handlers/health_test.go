@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"reddit-clone/internal/store"
+)
+
+// TestHealth probes liveness and readiness, with and without templates and
+// with a table missing.
+func TestHealth(t *testing.T) {
+	e := newServer(t)
+	RateLimits = RateLimitConfig{Enabled: true, Reads: RateBudget{Burst: 1, Per: time.Minute}}
+	RateLimiter = NewMemoryLimiter()
+	for range 3 {
+		if rec := get(e, "/healthz"); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"status":"ok"}` {
+			t.Fatalf("healthz: got %d %s", rec.Code, rec.Body)
+		}
+	}
+	ready := func() (int, Health) {
+		t.Helper()
+		rec := get(e, "/readyz")
+		var health Health
+		if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+			t.Fatalf("readyz: %v: %s", err, rec.Body)
+		}
+		return rec.Code, health
+	}
+	if code, health := ready(); code != http.StatusServiceUnavailable || health.Status != "unavailable" || health.Checks["templates"].Status != "failing" || health.Checks["database"].Status != "ok" {
+		t.Errorf("readyz without templates: got %d %+v", code, health)
+	}
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	if code, health := ready(); code != http.StatusOK || health.Status != "ok" || len(health.Checks) != 3 {
+		t.Errorf("readyz: got %d %+v", code, health)
+	}
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { Redis = nil })
+	Redis = client
+	if code, health := ready(); code != http.StatusOK || health.Checks["redis"].Status != "ok" {
+		t.Errorf("readyz with redis: got %d %+v", code, health)
+	}
+	server.Close()
+	client.Close()
+	if code, health := ready(); code != http.StatusServiceUnavailable || health.Checks["redis"].Status != "failing" {
+		t.Errorf("readyz with redis gone: got %d %+v", code, health)
+	}
+	Redis = nil
+
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	Store = sqlite
+	if code, health := ready(); code != http.StatusOK {
+		t.Errorf("readyz on a migrated database: got %d %+v", code, health)
+	}
+	if err := sqlite.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if code, health := ready(); code != http.StatusServiceUnavailable || health.Checks["migrations"].Error != "1 migrations are pending" {
+		t.Errorf("readyz with a migration pending: got %d %+v", code, health)
+	}
+	sqlite.Close()
+	if code, health := ready(); code != http.StatusServiceUnavailable || health.Checks["database"].Status != "failing" {
+		t.Errorf("readyz with the database closed: got %d %+v", code, health)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// Unhidden is the scope feeds and topic listings go through, leaving out
+// the posts the current user has hidden.
+func Unhidden(c context.Context) store.Scope {
+	if user := CurrentUser(c); user != nil {
+		return store.NotHiddenBy(user.ID)
+	}
+	return func(*store.Query) {}
+}
+func hiddenBy(c context.Context, user *models.User, post *models.Post) (bool, error) {
+	count, err := Store.Count(c, &models.HiddenPost{}, &models.HiddenPost{UserID: user.ID, TopicID: post.TopicID, PostID: post.ID})
+	return count > 0, err
+}
+
+// Hide hides or unhides a post for the current user. Hiding twice does
+// nothing.
+func Hide(hide bool) func(context.Context, GetRequest) (*models.HiddenPost, error) {
+	return func(c context.Context, req GetRequest) (*models.HiddenPost, error) {
+		user := CurrentUser(c)
+		if user == nil {
+			return nil, ErrNotLoggedIn
+		}
+		id := models.HiddenPost{UserID: user.ID, TopicID: req.TopicID, PostID: req.PostID}
+		if !hide {
+			_, err := store.Delete(c, Store, id)
+			return nil, err
+		}
+		if _, _, err := findTarget(c, Store, req.IDs, Visible(c)); err != nil {
+			return nil, err
+		}
+		if hidden, err := hiddenBy(c, user, &models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID}); err != nil || hidden {
+			return nil, err
+		}
+		return nil, Store.Create(c, &id)
+	}
+}
+
+// HiddenPosts lists the posts the current user has hidden, most recently
+// hidden first.
+func HiddenPosts(c context.Context, req models.PageRequest) (*models.ListResponse[models.HiddenPost], error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	list, err := store.List(c, Store, models.HiddenPost{UserID: user.ID}, req, store.OrderBy("created_at DESC"))
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		hidden := &list.Items[i]
+		hidden.Post, _, err = findTarget(c, Store, models.IDs{TopicID: hidden.TopicID, PostID: hidden.PostID}, Visible(c))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+func HandleHidden(c echo.Context) error {
+	if CurrentUser(c.Request().Context()) == nil {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	var req models.PageRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := HiddenPosts(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "hidden", list)
+}
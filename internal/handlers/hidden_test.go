@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestHidden hides posts over v1 and the forms and checks which listings
+// leave them out.
+func TestHidden(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Subscription{UserID: alice.ID, TopicID: "golang"},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Keep"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: alice.ID, Title: "Hide me"},
+	)
+	for _, tc := range []struct {
+		what, token, post string
+		want              int
+	}{
+		{"signed out", "", "p2", http.StatusUnauthorized},
+		{"a missing post", aliceToken, "p9", http.StatusNotFound},
+		{"p2", aliceToken, "p2", http.StatusNoContent},
+		{"p2 again", aliceToken, "p2", http.StatusNoContent},
+	} {
+		if rec := call(t, e, http.MethodPut, "/v1/topics/golang/posts/"+tc.post+"/hidden", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("hide %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+
+	ids := func(path, token string) string {
+		t.Helper()
+		var posts models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, path, token, nil, &posts); rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d", path, rec.Code)
+		}
+		var ids []string
+		for _, post := range posts.Items {
+			ids = append(ids, post.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	for _, tc := range []struct{ what, path, token, want string }{
+		{"alice's topic listing", "/v1/topics/golang/posts?sort=new", aliceToken, "[p1]"},
+		{"alice's home feed", "/v1/home", aliceToken, "[p1]"},
+		{"alice's profile", "/v1/users/alice/posts", aliceToken, "[p2 p1]"},
+		{"bob's topic listing", "/v1/topics/golang/posts?sort=new", bobToken, "[p2 p1]"},
+	} {
+		if got := ids(tc.path, tc.token); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.what, got, tc.want)
+		}
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p2", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("get the hidden post: got %d", rec.Code)
+	}
+	var hidden models.ListResponse[models.HiddenPost]
+	call(t, e, http.MethodGet, "/v1/me/hidden", aliceToken, nil, &hidden)
+	if len(hidden.Items) != 1 || hidden.Items[0].Post == nil || hidden.Items[0].Post.Title != "Hide me" {
+		t.Errorf("alice's hidden posts: got %+v", hidden.Items)
+	}
+
+	page := func(path string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(login(t, alice))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	if body := page("/topics/golang"); strings.Contains(body, "Hide me") || !strings.Contains(body, "Keep") {
+		t.Errorf("the topic page shows the hidden post: %s", body)
+	}
+	if body := page("/topics/golang/posts/p2"); !strings.Contains(body, "/posts/p2/unhide") {
+		t.Errorf("the hidden post's page has no unhide button: %s", body)
+	}
+	if body := page("/hidden"); !strings.Contains(body, "Hide me") {
+		t.Errorf("the hidden page does not list the post: %s", body)
+	}
+
+	if rec := postForm(e, "/topics/golang/posts/p2/unhide", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("unhide through the form: got %d", rec.Code)
+	}
+	if got := ids("/v1/topics/golang/posts?sort=new", aliceToken); got != "[p2 p1]" {
+		t.Errorf("alice's topic listing after unhiding: got %s", got)
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/hide", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("hide through the form: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/posts/p1/hidden", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("unhide: got %d", rec.Code)
+	}
+	if got := ids("/v1/home", aliceToken); got != "[p1 p2]" && got != "[p2 p1]" {
+		t.Errorf("alice's home feed at the end: got %s", got)
+	}
+}
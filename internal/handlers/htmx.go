@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// IsHTMX reports whether the request was sent by HTMX, which swaps the
+// HTML fragment it gets back into the page instead of reading JSON.
+func IsHTMX(c echo.Context) bool {
+	return c.Request().Header.Get("HX-Request") == "true"
+}
+
+// VoteState is what the votes fragment shows of a post or comment: its
+// score, the viewer's vote and where to vote on it.
+type VoteState struct {
+	ID     string
+	URL    string
+	Votes  int
+	MyVote int
+}
+
+func Voting(obj any) VoteState {
+	switch obj := obj.(type) {
+	case models.Post:
+		return VoteState{ID: obj.ID, URL: PostURL(obj.TopicID, obj.ID), Votes: obj.Votes, MyVote: obj.MyVote}
+	case *models.Post:
+		return Voting(*obj)
+	case models.Comment:
+		return VoteState{ID: obj.ID, URL: PostURL(obj.TopicID, obj.PostID) + "/comments/" + obj.ID, Votes: obj.Votes, MyVote: obj.MyVote}
+	case *models.Comment:
+		return Voting(*obj)
+	}
+	return VoteState{}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// TestHTMX votes and comments from the post page as HTMX does, and checks
+// the fragments that come back.
+func TestHTMX(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, _ := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Filter{TopicID: "golang", Kind: models.FilterWord, Value: "java", Action: models.FilterHold},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Post"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: alice.ID, Content: "First"},
+	)
+	htmx := func(path string, values url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		if values == nil {
+			values = url.Values{}
+		}
+		values.Set(CSRFCookie, csrfToken)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.Header.Set("HX-Request", "true")
+		req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: csrfToken})
+		req.AddCookie(login(t, alice))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := htmx("/topics/golang/posts/p1/upvote", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `<span id="p1-votes">1</span>`) || !strings.Contains(body, `hx-post="/topics/golang/posts/p1/upvote" hx-target="closest .votes" hx-swap="outerHTML" class="voted"`) {
+		t.Errorf("upvote the post: got %d %s", rec.Code, body)
+	}
+	rec = htmx("/topics/golang/posts/p1/comments/c1/downvote", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `<span id="c1-votes">-1</span>`) || !strings.Contains(body, `/comments/c1/downvote" hx-target="closest .votes" hx-swap="outerHTML" class="voted"`) {
+		t.Errorf("downvote the comment: got %d %s", rec.Code, body)
+	}
+	rec = htmx("/topics/golang/posts/p1/comments", url.Values{"content": {"Top level"}})
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, `<div id="comment-`) || !strings.Contains(body, "<p>Top level</p>") || !strings.Contains(body, `href="/u/alice"`) || !strings.Contains(body, "margin-left: 0") {
+		t.Errorf("comment: got %d %s", rec.Code, body)
+	}
+	rec = htmx("/topics/golang/posts/p1/comments", url.Values{"content": {"Reply"}, "parentCommentID": {"c1"}})
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "margin-left: 2em") {
+		t.Errorf("reply: got %d %s", rec.Code, body)
+	}
+	if rec := htmx("/topics/golang/posts/p1/comments", url.Values{"content": {"java"}}); rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("a held comment: got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = postForm(e, "/topics/golang/posts/p1/downvote", nil, login(t, alice))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON) || !strings.Contains(rec.Body.String(), `"votes":-1`) {
+		t.Errorf("a vote without HTMX: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/comments", url.Values{"content": {"Plain"}}, login(t, alice)); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"content":"Plain"`) {
+		t.Errorf("a comment without HTMX: got %d %s", rec.Code, rec.Body)
+	}
+	if body := get(e, "/topics/golang/posts/p1").Body.String(); !strings.Contains(body, `hx-post="/topics/golang/posts/p1/comments"`) || !strings.Contains(body, "htmx.org") {
+		t.Error("the post page does not load HTMX or post its comment form with it")
+	}
+}
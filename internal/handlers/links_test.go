@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestLinkPosts creates link and text posts through the API and the form,
+// checks links against the banned domains, and finds the domain and the
+// outbound link on the pages.
+func TestLinkPosts(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, token := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Filter{TopicID: "golang", Kind: models.FilterDomain, Value: "spam.example", Action: models.FilterReject},
+	)
+	for _, tc := range []struct {
+		what  string
+		model map[string]any
+		kind  string
+	}{
+		{"a link", map[string]any{"title": "Go 1.22", "kind": "link", "url": "https://go.dev/blog/go1.22"}, models.PostLink},
+		{"a URL without a kind", map[string]any{"title": "Spec", "url": "https://www.go.dev/ref/spec"}, models.PostLink},
+		{"text", map[string]any{"title": "Question", "content": "Why?"}, models.PostSelf},
+	} {
+		var post models.Post
+		link, _ := tc.model["url"].(string)
+		if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", token, map[string]any{"model": tc.model}, &post); rec.Code != http.StatusCreated || post.Kind != tc.kind || post.URL != link {
+			t.Errorf("post %s: got %d %+v", tc.what, rec.Code, post)
+		}
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", token, map[string]any{"model": map[string]any{"title": "Deal", "url": "https://shop.spam.example/deal"}}, nil); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "filtered") {
+		t.Errorf("a link to a banned domain: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"From the form"}, "kind": {"link"}, "url": {"https://pkg.go.dev/net/http"}}, login(t, alice)); rec.Code >= http.StatusBadRequest {
+		t.Fatalf("a link through the form: got %d %s", rec.Code, rec.Body)
+	}
+
+	var page models.ListResponse[models.Post]
+	call(t, e, http.MethodGet, "/v1/topics/golang/posts?sort=new", "", nil, &page)
+	if len(page.Items) != 4 || page.Items[0].Kind != models.PostLink || page.Items[0].URL != "https://pkg.go.dev/net/http" {
+		t.Fatalf("the listing: got %+v", page.Items)
+	}
+	body := get(e, "/topics/golang").Body.String()
+	for _, want := range []string{`<span class="domain">(pkg.go.dev)</span>`, `<span class="domain">(go.dev)</span>`, `name="kind" type="radio" value="link"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the topic page lacks %s", want)
+		}
+	}
+	if strings.Count(body, `class="domain"`) != 3 {
+		t.Errorf("the topic page should mark the three links only: %s", body)
+	}
+	body = get(e, "/topics/golang/posts/"+page.Items[0].ID).Body.String()
+	if !strings.Contains(body, `<a href="https://pkg.go.dev/net/http" rel="nofollow noopener noreferrer" target="_blank">`) {
+		t.Errorf("the post page lacks the outbound link: %s", body)
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrLocked = NewError(Forbidden, "locked", "this post is locked")
+
+// Lock stops new comments and votes on a post, or lets them in again. Only
+// the topic's moderators may, and it is logged.
+func Lock(on bool) func(context.Context, GetRequest) (*models.Post, error) {
+	return func(c context.Context, req GetRequest) (*models.Post, error) {
+		if err := Moderate(c, req.TopicID); err != nil {
+			return nil, err
+		}
+		post, _, err := findTarget(c, Store, models.IDs{TopicID: req.TopicID, PostID: req.PostID})
+		if err != nil {
+			return nil, err
+		} else if post.Locked == on {
+			return nil, nil
+		}
+		action := &models.ModAction{TopicID: req.TopicID, Action: models.ModLock, PostID: req.PostID, TargetUserID: post.AuthorID}
+		if !on {
+			action.Action = models.ModUnlock
+		}
+		return nil, Moderated(c, action, func(tx store.Store) error {
+			return tx.Update(c, &models.Post{Model: models.Model{ID: post.ID}, TopicID: post.TopicID}, map[string]any{"locked": on})
+		})
+	}
+}
+
+// CheckLocked checks that the post still takes comments and votes.
+func CheckLocked(c context.Context, s store.Store, topicID string, postID string) error {
+	post, err := store.Get(c, s, models.Post{Model: models.Model{ID: postID}, TopicID: topicID})
+	if err != nil {
+		return err
+	} else if post.Locked {
+		return ErrLocked
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestLocks locks a post on each store and checks that it stops taking
+// comments and votes until it is unlocked.
+func TestLocks(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testLocks(t, s)
+		})
+	}
+}
+
+func testLocks(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	closes := time.Now().Add(time.Hour)
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Heated", Kind: models.PostPoll, PollClosesAt: &closes},
+		&models.PollOption{TopicID: "golang", PostID: "p1", Position: 1, Text: "Yes"},
+		&models.PollOption{TopicID: "golang", PostID: "p1", Position: 2, Text: "No"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "First"},
+	)
+	lock := func(method, token string) int {
+		t.Helper()
+		return call(t, e, method, "/v1/topics/golang/posts/p1/locked", token, nil, nil).Code
+	}
+	if code := lock(http.MethodPut, bobToken); code != http.StatusForbidden {
+		t.Errorf("lock as a non-moderator: got %d", code)
+	}
+	if code := call(t, e, http.MethodPut, "/v1/topics/golang/posts/p9/locked", aliceToken, nil, nil).Code; code != http.StatusNotFound {
+		t.Errorf("lock a missing post: got %d", code)
+	}
+	for range 2 {
+		if code := lock(http.MethodPut, aliceToken); code != http.StatusNoContent {
+			t.Fatalf("lock: %d", code)
+		}
+	}
+
+	for _, tc := range []struct {
+		what string
+		do   func() (int, string)
+	}{
+		{"a comment through the API", func() (int, string) {
+			rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments", bobToken, map[string]any{"model": map[string]any{"content": "Late"}}, nil)
+			return rec.Code, rec.Body.String()
+		}},
+		{"a comment through the form", func() (int, string) {
+			rec := postForm(e, "/topics/golang/posts/p1/comments", url.Values{"content": {"Late"}}, login(t, bob))
+			return rec.Code, rec.Body.String()
+		}},
+		{"a post vote", func() (int, string) {
+			rec := postForm(e, "/topics/golang/posts/p1/upvote", nil, login(t, bob))
+			return rec.Code, rec.Body.String()
+		}},
+		{"a comment vote", func() (int, string) {
+			rec := postForm(e, "/topics/golang/posts/p1/comments/c1/downvote", nil, login(t, alice))
+			return rec.Code, rec.Body.String()
+		}},
+		{"a poll vote", func() (int, string) {
+			rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/poll/vote", bobToken, map[string]any{"option": 1}, nil)
+			return rec.Code, rec.Body.String()
+		}},
+	} {
+		if code, body := tc.do(); code != http.StatusForbidden || !strings.Contains(body, `"locked"`) {
+			t.Errorf("%s on a locked post: got %d %s", tc.what, code, body)
+		}
+	}
+
+	body := postPage(t, e, "/topics/golang/posts/p1", alice)
+	if !strings.Contains(body, `<p class="locked">`) || strings.Contains(body, `id="commentform"`) || !strings.Contains(body, `/posts/p1/unlock">Unlock</button>`) {
+		t.Errorf("the locked post page for a moderator: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang/posts/p1", bob); strings.Contains(body, `<button class="lock"`) {
+		t.Errorf("the post page offers a non-moderator to unlock: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang", bob); !strings.Contains(body, `<span class="mark">locked</span> <a href="/topics/golang/posts/p1">Heated</a>`) {
+		t.Errorf("the topic page lacks the locked badge: %s", body)
+	}
+
+	if rec := postForm(e, "/topics/golang/posts/p1/unlock", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Fatalf("unlock through the page: %d %s", rec.Code, rec.Body)
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/upvote", nil, login(t, bob)); rec.Code != http.StatusOK {
+		t.Errorf("a post vote after unlocking: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments", bobToken, map[string]any{"model": map[string]any{"content": "Back"}}, nil); rec.Code != http.StatusCreated {
+		t.Errorf("a comment after unlocking: got %d %s", rec.Code, rec.Body)
+	}
+	if code := lock(http.MethodDelete, aliceToken); code != http.StatusNoContent {
+		t.Errorf("unlock an unlocked post: got %d", code)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	var actions []string
+	for _, action := range log.Items {
+		actions = append(actions, action.Action+" "+action.PostID)
+	}
+	if got := strings.Join(actions, "|"); got != "unlock p1|lock p1" {
+		t.Errorf("the mod log: got %s", got)
+	}
+}
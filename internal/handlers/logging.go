@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+
+	"reddit-clone/internal/logging"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[\w.-]{1,64}$`)
+
+// RequestLogger gives each request an ID, taken from the X-Request-ID
+// header when a proxy already set one and returned in it, and puts a logger
+// tagged with it in the request context. The request itself is logged once
+// handled, with the signed in user if any.
+func RequestLogger(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		req := c.Request()
+		id := req.Header.Get(echo.HeaderXRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		logger := slog.Default().With("request_id", id)
+		if sc := trace.SpanContextFromContext(req.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		c.SetRequest(req.WithContext(logging.WithLogger(req.Context(), logger)))
+		err := next(c)
+		status := responseStatus(c, err)
+		attrs := []any{"method", req.Method, "route", c.Path(), "path", req.URL.Path, "status", status,
+			"latency", time.Since(start), "bytes", c.Response().Size, "ip", c.RealIP()}
+		if user := CurrentUser(c.Request().Context()); user != nil {
+			attrs = append(attrs, "user_id", user.ID)
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		logger.Log(req.Context(), level, "request", attrs...)
+		return err
+	}
+}
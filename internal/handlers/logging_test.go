@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestRequestLogger sends requests with and without a request ID and reads
+// back the lines logged for them.
+func TestRequestLogger(t *testing.T) {
+	var out strings.Builder
+	logger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(logger) })
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&out, nil)))
+	e := newServer(t)
+	e.GET("/boom", func(c echo.Context) error { return errors.New("boom") })
+	alice, token := newUser(t, "alice")
+	lines := func() []map[string]any {
+		t.Helper()
+		var lines []map[string]any
+		scanner := bufio.NewScanner(strings.NewReader(out.String()))
+		for scanner.Scan() {
+			var line map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, line)
+		}
+		out.Reset()
+		return lines
+	}
+	send := func(path, id, token string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+		if id != "" {
+			req.Header.Set(echo.HeaderXRequestID, id)
+		}
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Header().Get(echo.HeaderXRequestID)
+	}
+
+	if id := send("/v1/topics/golang", "proxy-id.1", token); id != "proxy-id.1" {
+		t.Errorf("the proxy's request ID was replaced with %q", id)
+	}
+	got := lines()
+	if len(got) != 1 {
+		t.Fatalf("logged %v, want one line", got)
+	}
+	want := map[string]any{"level": "INFO", "msg": "request", "request_id": "proxy-id.1", "method": "GET", "route": "/v1/topics/:topicid", "path": "/v1/topics/golang", "status": float64(404), "user_id": alice.ID}
+	for key, value := range want {
+		if got[0][key] != value {
+			t.Errorf("%s: got %v, want %v", key, got[0][key], value)
+		}
+	}
+
+	id := send("/v1/topics", "not a sane id!", "")
+	if id == "not a sane id!" || id == "" {
+		t.Errorf("a malformed request ID was kept: %q", id)
+	}
+	if got := lines(); len(got) != 1 || got[0]["request_id"] != id || got[0]["user_id"] != nil {
+		t.Errorf("signed out request: got %v", got)
+	}
+
+	id = send("/boom", "", "")
+	got = lines()
+	if len(got) != 2 || got[0]["level"] != "ERROR" || got[0]["status"] != float64(500) {
+		t.Fatalf("a 500 was not logged as an error: %v", got)
+	}
+	if got[1]["msg"] != "request failed" || got[1]["error"] != "boom" || got[1]["request_id"] != id {
+		t.Errorf("the failure was not logged with the request ID: %v", got[1])
+	}
+
+	spans()
+	req := httptest.NewRequest(http.MethodGet, "/v1/topics", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	if got := lines(); len(got) != 1 || got[0]["trace_id"] != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("a traced request was not logged with its trace ID: %v", got)
+	}
+}
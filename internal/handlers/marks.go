@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// MarkPost sets or clears a post's "nsfw" or "spoiler" mark, which hides
+// its content until the reader asks for it. Its author or the topic's
+// moderators may, and moderators log it.
+func MarkPost(mark string, on bool) func(context.Context, GetRequest) (*models.Post, error) {
+	return func(c context.Context, req GetRequest) (*models.Post, error) {
+		id := models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID}
+		action, err := OwnedOrModerated(c, id, req.TopicID, func(p *models.Post) string { return p.AuthorID })
+		if err != nil {
+			return nil, err
+		} else if action != nil {
+			action.Action, action.PostID, action.Details = models.ModEditPost, req.PostID, "marked "+mark
+			if !on {
+				action.Details = "unmarked " + mark
+			}
+		}
+		return nil, Moderated(c, action, func(tx store.Store) error {
+			return tx.Update(c, &id, map[string]any{mark: on})
+		})
+	}
+}
+
+// SafeForWork leaves NSFW posts out of a listing unless it asked for them.
+func SafeForWork(includeNSFW bool) store.Scope {
+	if includeNSFW {
+		return func(*store.Query) {}
+	}
+	return store.Where("nsfw", "=", false)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestMarks marks posts NSFW and as spoilers on each store, and checks
+// which listings leave them out and how pages show them.
+func TestMarks(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testMarks(t, s)
+		})
+	}
+}
+
+func testMarks(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	carol, carolToken := newUser(t, "carol")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Subscription{UserID: bob.ID, TopicID: "golang"},
+		&models.Post{Model: models.Model{ID: "plain"}, TopicID: "golang", AuthorID: bob.ID, Title: "Plain"},
+	)
+	var nsfw models.Post
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, map[string]any{"model": map[string]any{"title": "Racy", "nsfw": true}}, &nsfw); rec.Code != http.StatusCreated || !nsfw.NSFW || nsfw.Spoiler {
+		t.Fatalf("create an NSFW post: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Ending"}, "spoiler": {"true"}}, login(t, bob)); rec.Code >= http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"spoiler":true`) {
+		t.Errorf("create a spoiler through the page: got %d %s", rec.Code, rec.Body)
+	}
+
+	titles := func(path, token string) string {
+		t.Helper()
+		var list models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, path, token, nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("%s: %d", path, rec.Code)
+		}
+		var got []string
+		for _, p := range list.Items {
+			got = append(got, p.Title)
+		}
+		return fmt.Sprint(got)
+	}
+	for _, tc := range []struct{ path, want string }{
+		{"/v1/topics/golang/posts?sort=new", "[Ending Plain]"},
+		{"/v1/topics/golang/posts?sort=new&include_nsfw=true", "[Ending Racy Plain]"},
+		{"/v1/users/bob/posts", "[Ending Plain]"},
+		{"/v1/users/bob/posts?include_nsfw=true", "[Ending Racy Plain]"},
+		{"/v1/home?sort=new", "[Ending Plain]"},
+		{"/v1/home?sort=new&include_nsfw=true", "[Ending Racy Plain]"},
+	} {
+		if got := titles(tc.path, bobToken); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.path, got, tc.want)
+		}
+	}
+
+	path := "/v1/topics/golang/posts/" + nsfw.ID
+	for _, tc := range []struct {
+		what, method, mark, token string
+		want                      int
+	}{
+		{"as someone else", http.MethodPut, "spoiler", carolToken, http.StatusForbidden},
+		{"as the author", http.MethodPut, "spoiler", bobToken, http.StatusNoContent},
+		{"as a moderator", http.MethodDelete, "nsfw", aliceToken, http.StatusNoContent},
+		{"a missing post", http.MethodPut, "nsfw", aliceToken, http.StatusNotFound},
+	} {
+		p := path
+		if tc.what == "a missing post" {
+			p = "/v1/topics/golang/posts/missing"
+		}
+		if rec := call(t, e, tc.method, p+"/"+tc.mark, tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("%s %s %s: got %d, want %d", tc.method, tc.mark, tc.what, rec.Code, tc.want)
+		}
+	}
+	var got models.Post
+	if call(t, e, http.MethodGet, path, "", nil, &got); got.NSFW || !got.Spoiler {
+		t.Errorf("the marks after the changes: got nsfw %v and spoiler %v", got.NSFW, got.Spoiler)
+	}
+	if rec := postForm(e, "/topics/golang/posts/"+nsfw.ID+"/nsfw", nil, login(t, bob)); rec.Code != http.StatusNoContent {
+		t.Errorf("mark NSFW through the page: got %d %s", rec.Code, rec.Body)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	if len(log.Items) != 1 || log.Items[0].Action != models.ModEditPost || log.Items[0].Details != "unmarked nsfw" || log.Items[0].PostID != nsfw.ID {
+		t.Errorf("the mod log: got %+v", log.Items)
+	}
+
+	var crosspost models.Post
+	if rec := call(t, e, http.MethodPost, path+"/crossposts", bobToken, map[string]any{"topic": "rust"}, &crosspost); rec.Code != http.StatusCreated || !crosspost.NSFW || !crosspost.Spoiler {
+		t.Errorf("a crosspost of a marked post: got %d %s", rec.Code, rec.Body)
+	}
+
+	body := postPage(t, e, "/topics/golang", carol)
+	if !strings.Contains(body, ">Racy</a> <span class=\"mark nsfw\">NSFW</span> <span class=\"mark\">spoiler</span>") {
+		t.Errorf("the topic page lacks the badges: %s", body)
+	}
+	body = postPage(t, e, "/topics/golang/posts/"+nsfw.ID, carol)
+	if !strings.Contains(body, `<details class="reveal">`) || strings.Contains(body, `class="set-mark"`) {
+		t.Errorf("the post page for a reader: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang/posts/"+nsfw.ID, bob); !strings.Contains(body, `data-url="/topics/golang/posts/`+nsfw.ID+`/sfw">Unmark NSFW</button>`) {
+		t.Errorf("the post page does not offer the author to unmark it: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang/posts/plain", alice); strings.Contains(body, `<details class="reveal">`) || !strings.Contains(body, `/posts/plain/spoiler">Mark spoiler</button>`) {
+		t.Errorf("the post page of an unmarked post for a moderator: %s", body)
+	}
+	if body := postPage(t, e, "/", bob); !strings.Contains(body, "Racy") {
+		t.Errorf("the home page leaves out the NSFW post: %s", body)
+	}
+}
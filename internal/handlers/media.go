@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/media"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// MediaConfig has uploaded images of at most MaxBytes each, with
+// thumbnails that fit in a ThumbnailSize pixel square, kept by the Backend:
+// "local" for files under Root, or "s3" for the bucket S3 describes.
+type MediaConfig struct {
+	Backend       string         `yaml:"backend"`
+	Root          string         `yaml:"root"`
+	S3            media.S3Config `yaml:"s3"`
+	MaxBytes      int            `yaml:"maxBytes"`
+	ThumbnailSize int            `yaml:"thumbnailSize"`
+}
+
+var Media = MediaConfig{Backend: "local", Root: "media", MaxBytes: 10 << 20, ThumbnailSize: 320}
+
+// MediaPath is where the site serves stored images from, for the stores it
+// cannot link to directly.
+const MediaPath = "/media/"
+
+// MediaStore keeps uploaded images and their thumbnails.
+var MediaStore media.Store = media.NewLocal(Media.Root, MediaPath)
+
+var ErrImageTooLarge = NewError(TooLarge, "image_too_large", "the image is too large")
+var ErrUnsupportedImage = NewError(UnsupportedMedia, "unsupported_image", "images must be JPEG, PNG or GIF")
+
+// mediaName matches the names images and thumbnails are stored under, so
+// nothing else in the store can be served.
+var mediaName = regexp.MustCompile(`^[0-9a-f-]{36}(\.jpg|\.png|\.gif|-thumb\.jpg)$`)
+
+// Store opens the configured backend.
+func (cfg MediaConfig) Store() (media.Store, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return media.NewLocal(cfg.Root, MediaPath), nil
+	case "s3":
+		return media.NewS3(cfg.S3, MediaPath)
+	}
+	return nil, fmt.Errorf("media: unknown backend %q, want local or s3", cfg.Backend)
+}
+
+// MediaURL is where the stored file with the key is served from.
+func MediaURL(key string) string {
+	return MediaStore.URL(key)
+}
+
+// ThumbnailURL is where the thumbnail of the image with the ID is served
+// from.
+func ThumbnailURL(mediaID string) string {
+	return MediaURL(models.ThumbnailKey(mediaID))
+}
+
+// LinkMedia fills in where the image and its thumbnail are served from.
+func LinkMedia(m *models.Media) {
+	if m != nil {
+		m.URL, m.ThumbnailURL = MediaURL(m.Key()), ThumbnailURL(m.ID)
+	}
+}
+
+// HandleUpload stores an image sent as the "file" field of a multipart
+// form, and its thumbnail, for the current user to attach to a post.
+func HandleUpload(c echo.Context) error {
+	user := CurrentUser(c.Request().Context())
+	if user == nil {
+		return Fail(c, ErrNotLoggedIn)
+	}
+	// Leave room for the rest of the form around the file.
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, int64(Media.MaxBytes)+64<<10)
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Fail(c, ErrImageTooLarge)
+	} else if err != nil {
+		return Fail(c, FieldErrors{"file": "is required"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return Fail(c, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(Media.MaxBytes)+1))
+	if err != nil {
+		return Fail(c, err)
+	} else if len(data) > Media.MaxBytes {
+		return Fail(c, ErrImageTooLarge)
+	}
+	uploaded, err := Upload(c.Request().Context(), user, data)
+	if err != nil {
+		return Fail(c, err)
+	}
+	return c.JSON(http.StatusCreated, uploaded)
+}
+
+// Upload checks that data is an image, and stores it, its thumbnail and
+// its record.
+func Upload(c context.Context, user *models.User, data []byte) (*models.Media, error) {
+	img, err := media.Decode(data)
+	if errors.Is(err, media.ErrTooManyPixels) {
+		return nil, ErrImageTooLarge
+	} else if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	b := img.Bounds()
+	uploaded := &models.Media{Model: models.Model{ID: uuid.NewString()}, UploaderID: user.ID, ContentType: img.ContentType, Width: b.Dx(), Height: b.Dy(), Size: int64(len(data))}
+	var thumb bytes.Buffer
+	if err := media.EncodeThumbnail(&thumb, img, Media.ThumbnailSize); err != nil {
+		return nil, err
+	}
+	if err := MediaStore.Put(c, uploaded.Key(), data, uploaded.ContentType); err != nil {
+		return nil, err
+	}
+	if err := MediaStore.Put(c, uploaded.ThumbnailKey(), thumb.Bytes(), "image/jpeg"); err != nil {
+		MediaStore.Delete(c, uploaded.Key())
+		return nil, err
+	}
+	if err := Store.Create(c, uploaded); err != nil {
+		MediaStore.Delete(c, uploaded.Key())
+		MediaStore.Delete(c, uploaded.ThumbnailKey())
+		return nil, err
+	}
+	LinkMedia(uploaded)
+	return uploaded, nil
+}
+
+// HandleMedia serves a stored image or thumbnail. Their names are new for
+// every upload, so browsers may keep them for good.
+func HandleMedia(c echo.Context) error {
+	name := c.Param("name")
+	if !mediaName.MatchString(name) {
+		return Fail(c, store.ErrNotFound)
+	}
+	object, err := MediaStore.Get(c.Request().Context(), name)
+	if errors.Is(err, media.ErrNotFound) {
+		return Fail(c, store.ErrNotFound)
+	} else if err != nil {
+		return Fail(c, err)
+	}
+	defer object.Body.Close()
+	header := c.Response().Header()
+	header.Set("Cache-Control", media.CacheControl)
+	if body, ok := object.Body.(io.ReadSeeker); ok {
+		http.ServeContent(c.Response(), c.Request(), name, object.ModTime, body)
+		return nil
+	}
+	if !object.ModTime.IsZero() {
+		header.Set("Last-Modified", object.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if object.Size >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	}
+	return c.Stream(http.StatusOK, object.ContentType, object.Body)
+}
+
+// CheckMedia checks that the image a new post shows was uploaded by the
+// post's author.
+func CheckMedia(c context.Context, s store.Store, post *models.Post, author *models.User) error {
+	if post.MediaID == "" {
+		return nil
+	}
+	uploaded, err := store.Get(c, s, models.Media{Model: models.Model{ID: post.MediaID}})
+	if errors.Is(err, store.ErrNotFound) || err == nil && uploaded.UploaderID != author.ID {
+		return FieldErrors{"mediaID": "must be an image you uploaded"}
+	}
+	return err
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/media"
+	"reddit-clone/internal/models"
+)
+
+// upload serves a multipart upload of data as the "file" field to path
+// through e, signed in with the cookie or token if there is one.
+func upload(t *testing.T, e *echo.Echo, path string, data []byte, token string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if data != nil {
+		part, err := form.CreateFormFile("file", "upload.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	req.Header.Set(echo.HeaderXCSRFToken, csrfToken)
+	req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: csrfToken})
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// useMedia keeps uploads of at most 4 KiB, with 16 pixel thumbnails, in a
+// directory of their own for the test.
+func useMedia(t *testing.T) {
+	t.Helper()
+	config, mediaStore := Media, MediaStore
+	t.Cleanup(func() { Media, MediaStore = config, mediaStore })
+	Media = MediaConfig{Backend: "local", Root: t.TempDir(), MaxBytes: 4096, ThumbnailSize: 16}
+	MediaStore = media.NewLocal(Media.Root, MediaPath)
+}
+
+// TestUpload uploads images through the API and the site, refuses what is
+// not an image or too big, and serves what was stored.
+func TestUpload(t *testing.T) {
+	e := newServer(t)
+	useMedia(t)
+	alice, token := newUser(t, "alice")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 32))); err != nil {
+		t.Fatal(err)
+	}
+	img := buf.Bytes()
+
+	for _, tc := range []struct {
+		what   string
+		path   string
+		data   []byte
+		token  string
+		cookie bool
+		want   int
+	}{
+		{"signed out", "/v1/media", img, "", false, http.StatusUnauthorized},
+		{"without a file", "/v1/media", nil, token, false, http.StatusBadRequest},
+		{"text", "/v1/media", []byte("hello, I am a PNG"), token, false, http.StatusUnsupportedMediaType},
+		{"a file over the limit", "/v1/media", bytes.Repeat([]byte{1}, 8192), token, false, http.StatusRequestEntityTooLarge},
+		{"a body far over the limit", "/v1/media", bytes.Repeat([]byte{1}, 128<<10), token, false, http.StatusRequestEntityTooLarge},
+		{"too many pixels", "/v1/media", []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00"), token, false, http.StatusRequestEntityTooLarge},
+		{"through the site", "/media", img, "", true, http.StatusCreated},
+	} {
+		var cookies []*http.Cookie
+		if tc.cookie {
+			cookies = append(cookies, login(t, alice))
+		}
+		if rec := upload(t, e, tc.path, tc.data, tc.token, cookies...); rec.Code != tc.want {
+			t.Errorf("upload %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+
+	rec := upload(t, e, "/v1/media", img, token)
+	var got models.Media
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); rec.Code != http.StatusCreated || err != nil {
+		t.Fatalf("upload: got %d %s, %v", rec.Code, rec.Body, err)
+	}
+	if got.UploaderID != alice.ID || got.ContentType != "image/png" || got.Width != 64 || got.Height != 32 || got.Size != int64(len(img)) || got.URL != "/media/"+got.ID+".png" || got.ThumbnailURL != "/media/"+got.ID+"-thumb.jpg" {
+		t.Errorf("upload: got %+v", got)
+	}
+	entries, _ := os.ReadDir(Media.Root)
+	if len(entries) != 4 {
+		t.Errorf("the media root holds %d files, want two uploads and their thumbnails", len(entries))
+	}
+
+	if rec := get(e, got.URL); rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), img) || rec.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Errorf("the image: got %d %q", rec.Code, rec.Header())
+	}
+	if rec := get(e, got.ThumbnailURL); rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "image/jpeg" {
+		t.Errorf("the thumbnail: got %d %q", rec.Code, rec.Header())
+	} else if config, _, err := image.DecodeConfig(rec.Body); err != nil || config.Width != 16 || config.Height != 8 {
+		t.Errorf("the thumbnail: got %+v, %v", config, err)
+	}
+	if err := os.WriteFile(filepath.Join(Media.Root, "secret.txt"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/media/secret.txt", "/media/..%2Fsecret.txt", "/media/" + strings.Repeat("0", 36) + ".png", "/media/" + got.ID + ".gif"} {
+		if rec := get(e, path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+// TestImagePosts posts an uploaded image and shows it on the listing, the
+// post page and the v1 post.
+func TestImagePosts(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	useMedia(t)
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	var uploaded models.Media
+	if err := json.Unmarshal(upload(t, e, "/v1/media", buf.Bytes(), aliceToken).Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		what, token, mediaID string
+		want                 int
+	}{
+		{"someone else's image", bobToken, uploaded.ID, http.StatusBadRequest},
+		{"an unknown image", aliceToken, "missing", http.StatusBadRequest},
+		{"her own image", aliceToken, uploaded.ID, http.StatusCreated},
+	} {
+		var post models.Post
+		rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", tc.token, map[string]any{"model": map[string]any{"title": "Look", "mediaID": tc.mediaID}}, &post)
+		if rec.Code != tc.want {
+			t.Errorf("post %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		} else if rec.Code == http.StatusCreated && post.Kind != models.PostImage {
+			t.Errorf("post %s: got kind %q", tc.what, post.Kind)
+		}
+	}
+	if rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Again"}, "kind": {"image"}, "mediaID": {uploaded.ID}}, login(t, alice)); rec.Code >= http.StatusBadRequest {
+		t.Errorf("post through the page: got %d %s", rec.Code, rec.Body)
+	}
+
+	var list models.ListResponse[models.Post]
+	call(t, e, http.MethodGet, "/v1/topics/golang/posts", "", nil, &list)
+	if len(list.Items) != 2 || list.Items[0].MediaID != uploaded.ID {
+		t.Fatalf("the listing: got %+v", list.Items)
+	}
+	var post models.Post
+	call(t, e, http.MethodGet, "/v1/topics/golang/posts/"+list.Items[0].ID, "", nil, &post)
+	if post.Media == nil || post.Media.URL != uploaded.URL || post.Media.ThumbnailURL != uploaded.ThumbnailURL {
+		t.Errorf("the v1 post: got media %+v", post.Media)
+	}
+	if body := get(e, "/topics/golang").Body.String(); strings.Count(body, `<img class="thumbnail" src="`+uploaded.ThumbnailURL+`"`) != 2 {
+		t.Errorf("the topic page lacks the thumbnails: %s", body)
+	}
+	if body := get(e, "/topics/golang/posts/"+post.ID).Body.String(); !strings.Contains(body, `<img src="`+uploaded.URL+`"`) {
+		t.Errorf("the post page lacks the image: %s", body)
+	}
+}
+
+// TestMediaS3 uploads to a fake bucket, serves the image back through the
+// site, and links the bucket directly once it has a public URL.
+func TestMediaS3(t *testing.T) {
+	e := newServer(t)
+	useMedia(t)
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	bucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+				// Over plain HTTP the client sends the body in signed
+				// chunks, each after its size in hex.
+				var body []byte
+				for rest := string(data); ; {
+					header, chunk, _ := strings.Cut(rest, "\r\n")
+					size, err := strconv.ParseInt(strings.Split(header, ";")[0], 16, 64)
+					if err != nil || size == 0 || int64(len(chunk)) < size {
+						break
+					}
+					body = append(body, chunk[:size]...)
+					rest = strings.TrimPrefix(chunk[size:], "\r\n")
+				}
+				data = body
+			}
+			objects[r.URL.Path] = data
+		case http.MethodGet, http.MethodHead:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+				return
+			}
+			w.Header().Set(echo.HeaderContentType, "image/png")
+			w.Header().Set(echo.HeaderContentLength, strconv.Itoa(len(data)))
+			w.Header().Set(echo.HeaderLastModified, "Mon, 02 Jan 2006 15:04:05 GMT")
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(bucket.Close)
+	Media.Backend, Media.S3 = "s3", media.S3Config{Endpoint: bucket.URL, Bucket: "uploads", AccessKey: "access", SecretKey: "secret", PathStyle: true}
+	var err error
+	if MediaStore, err = Media.Store(); err != nil {
+		t.Fatal(err)
+	}
+	_, token := newUser(t, "alice")
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	var uploaded models.Media
+	if err := json.Unmarshal(upload(t, e, "/v1/media", buf.Bytes(), token).Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || !bytes.Equal(objects["/uploads/"+uploaded.ID+".png"], buf.Bytes()) {
+		t.Errorf("the bucket holds %d objects", len(objects))
+	}
+	rec := get(e, uploaded.URL)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), buf.Bytes()) || rec.Header().Get(echo.HeaderContentLength) != fmt.Sprint(buf.Len()) || rec.Header().Get("Cache-Control") != media.CacheControl {
+		t.Errorf("the image through the site: got %d %q", rec.Code, rec.Header())
+	}
+	if rec := get(e, "/media/"+strings.Repeat("0", 36)+".png"); rec.Code != http.StatusNotFound {
+		t.Errorf("a missing image: got %d", rec.Code)
+	}
+
+	Media.S3.PublicURL = "https://cdn.example.com"
+	if MediaStore, err = Media.Store(); err != nil {
+		t.Fatal(err)
+	}
+	if got := MediaURL(uploaded.Key()); got != "https://cdn.example.com/"+uploaded.ID+".png" {
+		t.Errorf("the public URL: got %q", got)
+	}
+	for _, backend := range []string{"ftp", "S3"} {
+		if _, err := (MediaConfig{Backend: backend}).Store(); err == nil {
+			t.Errorf("opened the %q backend", backend)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type SendMessageRequest struct {
+	To      string `json:"to" form:"to"`
+	Content string `json:"content" form:"content"`
+}
+type MessageRequest struct {
+	models.PageRequest
+	Username string `param:"username"`
+}
+type Conversation struct {
+	With   *models.User   `json:"with"`
+	Latest models.Message `json:"latest"`
+	Unread int            `json:"unread"`
+}
+type Mailbox struct {
+	models.ListResponse[models.Message]
+	Sent bool `json:"sent"`
+}
+
+func (r SendMessageRequest) Validate() error {
+	errs := FieldErrors{}
+	if !ValidUsername(r.To) {
+		errs["to"] = "must be a username"
+	}
+	errs.Text("content", r.Content, MaxMessageLength, false)
+	return errs.Err()
+}
+func (c *Conversation) RenderContent() { c.Latest.RenderContent() }
+
+// paginate pages through rows that had to be merged in memory, newest first.
+func paginate[T any](rows []T, req models.PageRequest, created func(T) time.Time) *models.ListResponse[T] {
+	slices.SortStableFunc(rows, func(a, b T) int { return created(b).Compare(created(a)) })
+	req = req.Normalize()
+	list := &models.ListResponse[T]{Items: []T{}, Pagination: models.Pagination{Total: int64(len(rows)), Limit: req.Limit, Offset: req.Offset}}
+	if req.Offset < len(rows) {
+		list.Items = rows[req.Offset:min(req.Offset+req.Limit, len(rows))]
+	}
+	return list
+}
+
+// correspondent looks up the other side of a conversation by username.
+func correspondent(c context.Context, user *models.User, username string) (*models.User, error) {
+	other, err := UserByName(c, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, FieldErrors{"to": "is not a user"}
+	} else if err != nil {
+		return nil, err
+	}
+	if other.ID == user.ID {
+		return nil, FieldErrors{"to": "must be someone else"}
+	}
+	return other, nil
+}
+func SendMessage(c context.Context, req SendMessageRequest) (*models.Message, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	recipient, err := correspondent(c, user, req.To)
+	if err != nil {
+		return nil, err
+	}
+	if blocked, err := HasBlocked(c, Store, recipient.ID, user.ID); err != nil {
+		return nil, err
+	} else if blocked {
+		return nil, ErrBlocked
+	}
+	return store.Create(c, Store, models.Message{Model: models.Model{ID: uuid.NewString()}, SenderID: user.ID, RecipientID: recipient.ID, Content: req.Content, Unread: true})
+}
+func UnreadMessages(c context.Context, user *models.User) (int64, error) {
+	return Store.Count(c, &models.Message{}, &models.Message{RecipientID: user.ID}, store.Where("unread", "=", true))
+}
+
+// Conversations lists everyone the current user has exchanged messages with,
+// by the latest message either way.
+func Conversations(c context.Context, req models.PageRequest) (*models.ListResponse[Conversation], error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	sent, err := store.Find(c, Store, models.Message{SenderID: user.ID}, store.Preload("Recipient"))
+	if err != nil {
+		return nil, err
+	}
+	received, err := store.Find(c, Store, models.Message{RecipientID: user.ID}, store.Preload("Sender"))
+	if err != nil {
+		return nil, err
+	}
+	byUser := map[string]*Conversation{}
+	add := func(withID string, with *models.User, message models.Message) {
+		conversation, ok := byUser[withID]
+		if !ok {
+			conversation = &Conversation{With: with, Latest: message}
+			byUser[withID] = conversation
+		} else if message.CreatedAt.After(conversation.Latest.CreatedAt) {
+			conversation.Latest = message
+		}
+		if message.Unread && message.RecipientID == user.ID {
+			conversation.Unread++
+		}
+	}
+	for _, message := range sent {
+		add(message.RecipientID, message.Recipient, message)
+	}
+	for _, message := range received {
+		add(message.SenderID, message.Sender, message)
+	}
+	var conversations []Conversation
+	for _, conversation := range byUser {
+		conversations = append(conversations, *conversation)
+	}
+	return paginate(conversations, req, func(c Conversation) time.Time { return c.Latest.CreatedAt }), nil
+}
+
+// ConversationWith lists the messages between the current user and another,
+// newest first.
+func ConversationWith(c context.Context, req MessageRequest) (*models.ListResponse[models.Message], error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	other, err := correspondent(c, user, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := store.Find(c, Store, models.Message{SenderID: user.ID, RecipientID: other.ID}, store.Preload("Sender", "Recipient"))
+	if err != nil {
+		return nil, err
+	}
+	received, err := store.Find(c, Store, models.Message{SenderID: other.ID, RecipientID: user.ID}, store.Preload("Sender", "Recipient"))
+	if err != nil {
+		return nil, err
+	}
+	return paginate(append(sent, received...), req.PageRequest, func(m models.Message) time.Time { return m.CreatedAt }), nil
+}
+
+// MarkConversationRead marks every message the other user sent to the
+// current user as read, in one update.
+func MarkConversationRead(c context.Context, req MessageRequest) (*models.Message, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	other, err := correspondent(c, user, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := store.Find(c, Store, models.Message{SenderID: other.ID, RecipientID: user.ID}, store.Where("unread", "=", true))
+	if err != nil || len(unread) == 0 {
+		return nil, err
+	}
+	ids := make([]string, len(unread))
+	for i, message := range unread {
+		ids[i] = message.ID
+	}
+	return nil, Store.UpdateColumns(c, &models.Message{}, &models.Message{RecipientID: user.ID}, map[string]any{"unread": false, "updated_at": time.Now()}, store.Where("id", "IN", ids))
+}
+
+// HandleMailbox renders the inbox, or the outbox when sent is set.
+func HandleMailbox(sent bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c.Request().Context())
+		if user == nil {
+			return c.Redirect(http.StatusFound, "/login")
+		}
+		var req models.PageRequest
+		if err := c.Bind(&req); err != nil {
+			return Fail(c, err)
+		}
+		id, preload := models.Message{RecipientID: user.ID}, "Sender"
+		if sent {
+			id, preload = models.Message{SenderID: user.ID}, "Recipient"
+		}
+		list, err := store.List(c.Request().Context(), Store, id, req, store.Preload(preload), store.OrderBy("created_at DESC"))
+		if err != nil {
+			return Fail(c, err)
+		}
+		list.Link(c.Request().URL)
+		return c.Render(http.StatusOK, "messages", Mailbox{ListResponse: *list, Sent: sent})
+	}
+}
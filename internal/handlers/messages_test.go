@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestMessages sends messages between three users and checks the
+// conversations, a conversation's messages and marking it read.
+func TestMessages(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	carol, _ := newUser(t, "carol")
+	now := time.Now()
+	create(t,
+		&models.Message{Model: models.Model{ID: "m1", CreatedAt: now.Add(-3 * time.Hour)}, SenderID: alice.ID, RecipientID: bob.ID, Content: "one", Unread: true},
+		&models.Message{Model: models.Model{ID: "m2", CreatedAt: now.Add(-2 * time.Hour)}, SenderID: bob.ID, RecipientID: alice.ID, Content: "two", Unread: true},
+		&models.Message{Model: models.Model{ID: "m3", CreatedAt: now.Add(-time.Hour)}, SenderID: carol.ID, RecipientID: bob.ID, Content: "three", Unread: true},
+	)
+
+	var sent models.Message
+	if rec := call(t, e, http.MethodPost, "/v1/messages", aliceToken, map[string]any{"to": "bob", "content": "*four*"}, &sent); rec.Code != http.StatusCreated || sent.SenderID != alice.ID || sent.RecipientID != bob.ID || !sent.Unread {
+		t.Fatalf("send: got %d %+v", rec.Code, sent)
+	}
+	var conversations models.ListResponse[Conversation]
+	if rec := call(t, e, http.MethodGet, "/v1/messages", bobToken, nil, &conversations); rec.Code != http.StatusOK {
+		t.Fatalf("conversations: %d", rec.Code)
+	}
+	var got []string
+	for _, c := range conversations.Items {
+		got = append(got, fmt.Sprintf("%s:%s:%d", c.With.Username, c.Latest.Content, c.Unread))
+	}
+	if fmt.Sprint(got) != "[alice:*four*:2 carol:three:1]" {
+		t.Errorf("bob's conversations: got %v", got)
+	}
+	call(t, e, http.MethodGet, "/v1/messages?limit=1&offset=1", bobToken, nil, &conversations)
+	if len(conversations.Items) != 1 || conversations.Items[0].With.Username != "carol" || conversations.Total != 2 {
+		t.Errorf("second page of one conversation: got %+v", conversations)
+	}
+
+	var messages models.ListResponse[models.Message]
+	call(t, e, http.MethodGet, "/v1/messages/alice?render=html", bobToken, nil, &messages)
+	got = nil
+	for _, m := range messages.Items {
+		got = append(got, m.Content)
+	}
+	if fmt.Sprint(got) != "[*four* two one]" || messages.Items[0].ContentHTML != "<p><em>four</em></p>\n" || messages.Items[0].Sender == nil {
+		t.Errorf("bob's messages with alice: got %v, first %+v", got, messages.Items[0])
+	}
+
+	counted := &updateCounter{Store: Store}
+	saved := Store
+	Store = counted
+	if rec := call(t, e, http.MethodPost, "/v1/messages/alice/read", bobToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("mark read: %d", rec.Code)
+	}
+	Store = saved
+	if counted.n != 1 {
+		t.Errorf("marking alice's two messages read took %d updates, want 1", counted.n)
+	}
+	call(t, e, http.MethodGet, "/v1/messages", bobToken, nil, &conversations)
+	if conversations.Items[0].Unread != 0 || conversations.Items[1].Unread != 1 {
+		t.Errorf("after reading alice's messages: got %+v", conversations.Items)
+	}
+	if unread, err := UnreadMessages(context.Background(), alice); err != nil || unread != 1 {
+		t.Errorf("bob reading his messages changed alice's unread count to %d, %v", unread, err)
+	}
+
+	for _, tc := range []struct {
+		token string
+		body  map[string]any
+		want  int
+	}{
+		{"", map[string]any{"to": "bob", "content": "hi"}, http.StatusUnauthorized},
+		{aliceToken, map[string]any{"to": "alice", "content": "hi"}, http.StatusBadRequest},
+		{aliceToken, map[string]any{"to": "nobody", "content": "hi"}, http.StatusBadRequest},
+		{aliceToken, map[string]any{"to": "bob", "content": " "}, http.StatusBadRequest},
+	} {
+		if rec := call(t, e, http.MethodPost, "/v1/messages", tc.token, tc.body, nil); rec.Code != tc.want {
+			t.Errorf("send %v: got %d, want %d", tc.body, rec.Code, tc.want)
+		}
+	}
+	if rec := postForm(e, "/messages", url.Values{"to": {"carol"}, "content": {"from the form"}}, login(t, bob)); rec.Code != http.StatusCreated {
+		t.Errorf("send through the form: got %d", rec.Code)
+	}
+	if unread, _ := UnreadMessages(context.Background(), carol); unread != 1 {
+		t.Errorf("carol's unread messages: got %d", unread)
+	}
+	if rec := get(e, "/messages"); rec.Code != http.StatusFound {
+		t.Errorf("inbox signed out: got %d", rec.Code)
+	}
+}
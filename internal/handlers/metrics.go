@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/metrics"
+	"reddit-clone/internal/models"
+)
+
+var (
+	requestsTotal   = metrics.NewCounter("http_requests_total", "HTTP requests handled, by route, method and status.", "route", "method", "status")
+	requestDuration = metrics.NewHistogram("http_request_duration_seconds", "Time spent handling HTTP requests, by route and method.", "route", "method")
+	votesTotal      = metrics.NewCounter("votes_total", "Votes cast, by target and direction.", "target", "direction")
+	liveConnections = metrics.NewGauge("live_connections", "Open live update connections, by transport.", "transport")
+)
+
+// Measured counts and times the requests h handles under their route, so
+// /metrics can break them down without every route opting in.
+func Measured(h echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := h(c)
+		requestsTotal.Inc(c.Path(), c.Request().Method, strconv.Itoa(responseStatus(c, err)))
+		requestDuration.Observe(time.Since(start).Seconds(), c.Path(), c.Request().Method)
+		return err
+	}
+}
+
+// responseStatus is the status a request was, or will be, answered with
+// once the error handler has seen err.
+func responseStatus(c echo.Context, err error) int {
+	if err != nil && !c.Response().Committed {
+		return int(Classify(err).Kind)
+	}
+	return c.Response().Status
+}
+func countVote(id models.IDs, direction int) {
+	target, dir := "post", "up"
+	if id.CommentID != "" {
+		target = "comment"
+	}
+	if direction < 0 {
+		dir = "down"
+	}
+	votesTotal.Inc(target, dir)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestMetrics makes requests and votes, holds a stream open, and checks the
+// counts /metrics reports moved by as much.
+func TestMetrics(t *testing.T) {
+	features := Features
+	t.Cleanup(func() { Features = features })
+	Features.Metrics = true
+	e := newServer(t)
+	alice, _ := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Hello"},
+	)
+	// metric reads a series from /metrics, or 0 when it is not there yet.
+	metric := func(series string) float64 {
+		t.Helper()
+		rec := get(e, "/metrics")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("/metrics: %d", rec.Code)
+		}
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if value, ok := strings.CutPrefix(line, series+" "); ok {
+				n, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return n
+			}
+		}
+		return 0
+	}
+	found := `http_requests_total{route="/v1/topics/:topicid",method="GET",status="200"}`
+	missing := `http_requests_total{route="/v1/topics/:topicid",method="GET",status="404"}`
+	timed := `http_request_duration_seconds_count{route="/v1/topics/:topicid",method="GET"}`
+	upvotes := `votes_total{target="post",direction="up"}`
+	before := map[string]float64{}
+	for _, series := range []string{found, missing, timed, upvotes} {
+		before[series] = metric(series)
+	}
+	get(e, "/v1/topics/golang")
+	get(e, "/v1/topics/golang")
+	get(e, "/v1/topics/rust")
+	if rec := postForm(e, "/topics/golang/posts/p1/upvote", nil, login(t, alice)); rec.Code != http.StatusOK {
+		t.Fatalf("upvote: %d", rec.Code)
+	}
+	for series, want := range map[string]float64{found: 2, missing: 1, timed: 3, upvotes: 1} {
+		if got := metric(series) - before[series]; got != want {
+			t.Errorf("%s went up by %v, want %v", series, got, want)
+		}
+	}
+
+	sse := `live_connections{transport="sse"}`
+	open := metric(sse)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/topics/golang/posts/p1/stream", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := metric(sse) - open; got != 1 {
+		t.Errorf("open streams went up by %v, want 1", got)
+	}
+	res.Body.Close()
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); metric(sse) != open; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the closed stream is still counted")
+		}
+	}
+
+	Features.Metrics = false
+	if rec := get(newServer(t), "/metrics"); rec.Code != http.StatusNotFound {
+		t.Errorf("/metrics when turned off: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrNotModerator = NewError(Forbidden, "not_moderator", "only moderators of this topic can do that")
+var ErrLastModerator = NewError(Conflict, "last_moderator", "a topic must keep at least one moderator")
+
+type ModLogList struct {
+	models.ListResponse[models.ModAction]
+	TopicID string `json:"topicID"`
+}
+type ModeratorRequest struct {
+	models.IDs
+	Username string `json:"username" form:"username" param:"username"`
+}
+
+func IsModerator(c context.Context, user *models.User, topicID string) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	count, err := Store.Count(c, &models.TopicModerator{}, &models.TopicModerator{TopicID: topicID, UserID: user.ID})
+	return count > 0, err
+}
+
+// Moderate checks that the current user moderates the topic. Site admins
+// moderate every topic.
+func Moderate(c context.Context, topicID string) error {
+	user := CurrentUser(c)
+	if user == nil {
+		return ErrNotLoggedIn
+	} else if IsAdmin(user) {
+		return nil
+	}
+	ok, err := IsModerator(c, user, topicID)
+	if err != nil {
+		return err
+	} else if !ok {
+		return ErrNotModerator
+	}
+	return nil
+}
+
+// OwnedOrModerated is Owned, except that moderators of the topic and site
+// admins may also act on other people's content. When they do, it returns the start of the
+// ModAction to log, naming the content's author.
+func OwnedOrModerated[T any](c context.Context, id T, topicID string, author func(*T) string) (*models.ModAction, error) {
+	err := Owned(c, id, author)
+	if !errors.Is(err, ErrForbidden) {
+		return nil, err
+	}
+	if modErr := Moderate(c, topicID); errors.Is(modErr, ErrNotModerator) {
+		return nil, err
+	} else if modErr != nil {
+		return nil, modErr
+	}
+	obj, err := store.Get(c, Store, id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ModAction{TopicID: topicID, TargetUserID: author(obj)}, nil
+}
+
+// Moderated runs f in a transaction that also logs the moderator action, or
+// runs it on its own when there is no action to log.
+func Moderated(c context.Context, action *models.ModAction, f func(store.Store) error) error {
+	if action == nil {
+		return f(Store)
+	}
+	return Store.Transaction(c, func(tx store.Store) error {
+		if err := f(tx); err != nil {
+			return err
+		}
+		action.ID, action.ModeratorID = uuid.NewString(), CurrentUser(c).ID
+		return tx.Create(c, action)
+	})
+}
+func ModLog(c context.Context, req ListRequest) (*models.ListResponse[models.ModAction], error) {
+	return store.List(c, Store, models.ModAction{TopicID: req.TopicID}, req.PageRequest, store.Preload("Moderator", "TargetUser"), store.OrderBy("created_at DESC"))
+}
+func HandleModLog(c echo.Context) error {
+	var req ListRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := ModLog(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "modlog", ModLogList{ListResponse: *list, TopicID: req.TopicID})
+}
+
+// CreateTopic creates a topic along with its creator as the first moderator
+// and subscriber.
+func CreateTopic(c context.Context, req CreateTopicRequest) (*models.Topic, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	topic := &models.Topic{Model: models.Model{ID: req.ID}, Description: req.Description}
+	return topic, Store.Transaction(c, func(tx store.Store) error {
+		if err := tx.Create(c, topic); err != nil {
+			return err
+		}
+		if err := tx.Create(c, &models.TopicModerator{TopicID: topic.ID, UserID: user.ID}); err != nil {
+			return err
+		}
+		return tx.Create(c, &models.Subscription{UserID: user.ID, TopicID: topic.ID})
+	})
+}
+func Moderators(c context.Context, req ListRequest) (*models.ListResponse[models.TopicModerator], error) {
+	if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: req.TopicID}}); err != nil {
+		return nil, err
+	}
+	return store.List(c, Store, models.TopicModerator{TopicID: req.TopicID}, req.PageRequest, store.Preload("User"))
+}
+func AddModerator(c context.Context, req ModeratorRequest) (*models.TopicModerator, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	user, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	moderator := &models.TopicModerator{TopicID: req.TopicID, UserID: user.ID}
+	err = Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModAddModerator, TargetUserID: user.ID}, func(tx store.Store) error {
+		return tx.Create(c, moderator)
+	})
+	if err != nil {
+		return nil, err
+	}
+	moderator.User = user
+	return moderator, nil
+}
+
+// RemoveModerator takes a user off the topic's moderators, which moderators
+// may also do to themselves, as long as someone is left.
+func RemoveModerator(c context.Context, req ModeratorRequest) (*models.TopicModerator, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	user, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	return nil, Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModRemoveModerator, TargetUserID: user.ID}, func(tx store.Store) error {
+		moderator := models.TopicModerator{TopicID: req.TopicID, UserID: user.ID}
+		if _, err := store.Get(c, tx, moderator); err != nil {
+			return err
+		}
+		count, err := tx.Count(c, &models.TopicModerator{}, &models.TopicModerator{TopicID: req.TopicID})
+		if err != nil {
+			return err
+		} else if count <= 1 {
+			return ErrLastModerator
+		}
+		_, err = store.Delete(c, tx, moderator)
+		return err
+	})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestModerators creates a topic through the form, hands moderation to
+// another user and checks what moderators and everyone else may do.
+func TestModerators(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	carol, carolToken := newUser(t, "carol")
+	if rec := postForm(e, "/topics", url.Values{"id": {"golang"}, "description": {"Go"}}, login(t, alice)); rec.Code != http.StatusOK {
+		t.Fatalf("create topic through the form: %d %s", rec.Code, rec.Body)
+	}
+	create(t,
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: carol.ID, Title: "Carol's"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: alice.ID, Title: "Alice's"},
+	)
+	moderators := func() string {
+		t.Helper()
+		var list models.ListResponse[models.TopicModerator]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/moderators", "", nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("list moderators: %d", rec.Code)
+		}
+		var names []string
+		for _, m := range list.Items {
+			names = append(names, m.User.Username)
+		}
+		return fmt.Sprint(names)
+	}
+	if got := moderators(); got != "[alice]" {
+		t.Errorf("moderators of a new topic: got %s", got)
+	}
+
+	for _, tc := range []struct {
+		what         string
+		method, path string
+		token        string
+		body         any
+		want         int
+	}{
+		{"add a moderator as a non-moderator", http.MethodPost, "/v1/topics/golang/moderators", bobToken, map[string]string{"username": "bob"}, http.StatusForbidden},
+		{"add an unknown user", http.MethodPost, "/v1/topics/golang/moderators", aliceToken, map[string]string{"username": "nobody"}, http.StatusNotFound},
+		{"add bob", http.MethodPost, "/v1/topics/golang/moderators", aliceToken, map[string]string{"username": "bob"}, http.StatusCreated},
+		{"add bob again", http.MethodPost, "/v1/topics/golang/moderators", aliceToken, map[string]string{"username": "bob"}, http.StatusConflict},
+		{"delete someone else's post as a moderator", http.MethodDelete, "/v1/topics/golang/posts/p1", bobToken, nil, http.StatusNoContent},
+		{"delete someone else's post as a non-moderator", http.MethodDelete, "/v1/topics/golang/posts/p2", carolToken, nil, http.StatusForbidden},
+		{"remove a moderator as a non-moderator", http.MethodDelete, "/v1/topics/golang/moderators/bob", carolToken, nil, http.StatusForbidden},
+		{"remove a user who is not a moderator", http.MethodDelete, "/v1/topics/golang/moderators/carol", aliceToken, nil, http.StatusNotFound},
+		{"remove bob", http.MethodDelete, "/v1/topics/golang/moderators/bob", aliceToken, nil, http.StatusNoContent},
+		{"remove the last moderator", http.MethodDelete, "/v1/topics/golang/moderators/alice", aliceToken, nil, http.StatusConflict},
+		{"describe a topic at length", http.MethodPut, "/v1/topics/golang", aliceToken, map[string]any{"updateMask": map[string]any{"description": strings.Repeat("x", MaxDescriptionLength+1)}}, http.StatusBadRequest},
+		{"list the moderators of a missing topic", http.MethodGet, "/v1/topics/rust/moderators", "", nil, http.StatusNotFound},
+	} {
+		if rec := call(t, e, tc.method, tc.path, tc.token, tc.body, nil); rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+	if got := moderators(); got != "[alice]" {
+		t.Errorf("moderators at the end: got %s", got)
+	}
+	if ok, err := IsModerator(context.Background(), carol, "golang"); ok || err != nil {
+		t.Errorf("carol moderates golang: %v, %v", ok, err)
+	}
+}
+
+// TestAdminsModerate checks that site admins pass every moderator check
+// and that their actions on other people's content are logged.
+func TestAdminsModerate(t *testing.T) {
+	e := newServer(t)
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"dave"}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	_, carolToken := newUser(t, "carol")
+	_, daveToken := newUser(t, "dave")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Bob's"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: bob.ID, Title: "Bob's other"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "Bob's reply"},
+	)
+	edit := func(content string) map[string]any {
+		return map[string]any{"updateMask": map[string]any{"content": content}}
+	}
+	for _, tc := range []struct {
+		what         string
+		method, path string
+		token        string
+		body         any
+		want         int
+	}{
+		{"edit a comment as someone else", http.MethodPut, "/v1/topics/golang/posts/p1/comments/c1", carolToken, edit("carol's"), http.StatusForbidden},
+		{"edit a comment as its author", http.MethodPut, "/v1/topics/golang/posts/p1/comments/c1", bobToken, edit("bob's"), http.StatusOK},
+		{"edit a comment as a moderator", http.MethodPut, "/v1/topics/golang/posts/p1/comments/c1", aliceToken, edit("alice's"), http.StatusOK},
+		{"edit a post as an admin", http.MethodPut, "/v1/topics/golang/posts/p1", daveToken, edit("dave's"), http.StatusOK},
+		{"edit the topic as an admin", http.MethodPut, "/v1/topics/golang", daveToken, map[string]any{"updateMask": map[string]any{"description": "Dave's"}}, http.StatusOK},
+		{"delete a post as someone else", http.MethodDelete, "/v1/topics/golang/posts/p2", carolToken, nil, http.StatusForbidden},
+		{"delete a post as an admin", http.MethodDelete, "/v1/topics/golang/posts/p2", daveToken, nil, http.StatusNoContent},
+		{"restore a post as an admin", http.MethodPost, "/v1/topics/golang/posts/p2/restore", daveToken, nil, http.StatusOK},
+	} {
+		if rec := call(t, e, tc.method, tc.path, tc.token, tc.body, nil); rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+	rec := call(t, e, http.MethodDelete, "/v1/topics/golang/posts/p1", carolToken, nil, nil)
+	var problem Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || problem.Code != "forbidden" || problem.Detail != ErrForbidden.Error() {
+		t.Errorf("delete as someone else: got %+v, %v", problem, err)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/moderators", daveToken, map[string]string{"username": "carol"}, nil); rec.Code != http.StatusCreated {
+		t.Errorf("add a moderator as an admin: got %d", rec.Code)
+	}
+
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	var got []string
+	for _, action := range log.Items {
+		got = append(got, action.Moderator.Username+" "+action.Action)
+	}
+	if fmt.Sprint(got) != "[dave add_moderator dave restore dave remove dave edit_topic dave edit_post alice edit_comment]" {
+		t.Errorf("the mod log: got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestModLog does each moderator action over v1 and reads the log back from
+// the API and the page.
+func TestModLog(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	newUser(t, "carol")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Spam"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: bob.ID, Title: "Fine"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p2", AuthorID: bob.ID, Content: "Mine"},
+		&models.Report{Model: models.Model{ID: "r1"}, TopicID: "golang", PostID: "p2", ReporterID: alice.ID, Reason: "looks odd", Status: models.ReportOpen},
+	)
+	for _, step := range []struct {
+		method, path, token string
+		body                any
+		want                int
+	}{
+		{http.MethodDelete, "/v1/topics/golang/posts/p1", aliceToken, nil, http.StatusNoContent},
+		{http.MethodDelete, "/v1/topics/golang/posts/p2/comments/c1", bobToken, nil, http.StatusNoContent},
+		{http.MethodPost, "/v1/topics/golang/reports/r1/approve", aliceToken, nil, http.StatusOK},
+		{http.MethodPost, "/v1/topics/golang/moderators", aliceToken, map[string]string{"username": "carol"}, http.StatusCreated},
+		{http.MethodDelete, "/v1/topics/golang/moderators/carol", aliceToken, nil, http.StatusNoContent},
+		{http.MethodPut, "/v1/topics/golang", aliceToken, map[string]any{"updateMask": map[string]any{"description": "All about Go"}}, http.StatusOK},
+		{http.MethodPut, "/v1/topics/golang", bobToken, map[string]any{"updateMask": map[string]any{"description": "Mine now"}}, http.StatusForbidden},
+		{http.MethodDelete, "/v1/topics/golang", aliceToken, nil, http.StatusNoContent},
+	} {
+		if rec := call(t, e, step.method, step.path, step.token, step.body, nil); rec.Code != step.want {
+			t.Fatalf("%s %s: got %d, want %d: %s", step.method, step.path, rec.Code, step.want, rec.Body)
+		}
+	}
+
+	var log models.ListResponse[models.ModAction]
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log); rec.Code != http.StatusOK {
+		t.Fatalf("the log: %d", rec.Code)
+	}
+	var got []string
+	for _, action := range log.Items {
+		if action.Moderator == nil || action.Moderator.Username != "alice" {
+			t.Errorf("%s: logged moderator %+v", action.Action, action.Moderator)
+		}
+		entry := action.Action
+		if action.TargetUser != nil {
+			entry += " " + action.TargetUser.Username
+		}
+		if action.PostID != "" {
+			entry += " " + action.PostID
+		}
+		if action.Details != "" {
+			entry += " " + action.Details
+		}
+		got = append(got, entry)
+	}
+	want := "delete_topic|edit_topic All about Go|remove_moderator carol|add_moderator carol|approve bob p2 looks odd|remove bob p1"
+	if s := strings.Join(got, "|"); s != want {
+		t.Errorf("the log, newest first: got %s", s)
+	}
+
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog?limit=2", "", nil, &log)
+	if len(log.Items) != 2 || log.Total != 6 {
+		t.Errorf("the first page of the log: got %d of %d", len(log.Items), log.Total)
+	}
+	rec := call(t, e, http.MethodGet, "/topics/golang/modlog", "", nil, nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "<q>All about Go</q>") {
+		t.Errorf("the log page: got %d", rec.Code)
+	}
+}
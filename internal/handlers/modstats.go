@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// ModStatsDays is how many days of mod actions and resolved reports the
+// moderator stats go back.
+const ModStatsDays = 30
+
+// ModStatsMaxAge is how long a topic's moderator stats are served before
+// they are counted again.
+var ModStatsMaxAge = time.Minute
+
+// ModeratorActivity counts one moderator's recent mod actions in a topic.
+type ModeratorActivity struct {
+	ModeratorID string `json:"moderatorID"`
+	Actions     int64  `json:"actions"`
+}
+
+// ModStats is a topic's moderator workload: its open reports, how many of
+// them hold content back for approval, each moderator's actions and the
+// average time from report to resolution over the last ModStatsDays days.
+type ModStats struct {
+	TopicID           string              `json:"topicID"`
+	OpenReports       int64               `json:"openReports"`
+	ApprovalQueue     int64               `json:"approvalQueue"`
+	Moderators        []ModeratorActivity `json:"moderators"`
+	ResolvedReports   int64               `json:"resolvedReports"`
+	AverageResolution float64             `json:"averageResolutionSeconds"`
+	Counted           time.Time           `json:"counted"`
+}
+
+var modStatsMu sync.Mutex
+var modStats = map[string]*ModStats{}
+
+// TopicModStats returns a topic's moderator stats to its moderators,
+// counting them again when they are older than ModStatsMaxAge.
+func TopicModStats(c context.Context, req GetRequest) (*ModStats, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	modStatsMu.Lock()
+	defer modStatsMu.Unlock()
+	if stats := modStats[req.TopicID]; stats != nil && time.Since(stats.Counted) < ModStatsMaxAge {
+		return stats, nil
+	}
+	stats, err := countModStats(c, req.TopicID)
+	if err != nil {
+		return nil, err
+	}
+	modStats[req.TopicID] = stats
+	return stats, nil
+}
+
+func countModStats(c context.Context, topicID string) (*ModStats, error) {
+	now := time.Now()
+	since := now.AddDate(0, 0, -ModStatsDays)
+	stats := &ModStats{TopicID: topicID, Moderators: []ModeratorActivity{}, Counted: now}
+	open := &models.Report{TopicID: topicID, Status: models.ReportOpen}
+	var err error
+	if stats.OpenReports, err = Store.Count(c, &models.Report{}, open); err != nil {
+		return nil, err
+	}
+	if stats.ApprovalQueue, err = Store.Count(c, &models.Report{}, open, store.Where("held", "=", true)); err != nil {
+		return nil, err
+	}
+	actions, err := Store.CountBy(c, &models.ModAction{}, &models.ModAction{TopicID: topicID}, "moderator_id", store.Where("created_at", ">=", since))
+	if err != nil {
+		return nil, err
+	}
+	for moderatorID, n := range actions {
+		stats.Moderators = append(stats.Moderators, ModeratorActivity{ModeratorID: moderatorID, Actions: n})
+	}
+	slices.SortFunc(stats.Moderators, func(a, b ModeratorActivity) int {
+		return cmp.Or(cmp.Compare(b.Actions, a.Actions), cmp.Compare(a.ModeratorID, b.ModeratorID))
+	})
+	// A report's last update is its resolution.
+	resolved, err := store.Find(c, Store, models.Report{TopicID: topicID}, store.Where("status", "<>", models.ReportOpen), store.Where("updated_at", ">=", since))
+	if err != nil {
+		return nil, err
+	}
+	var total time.Duration
+	for _, report := range resolved {
+		total += report.UpdatedAt.Sub(report.CreatedAt)
+	}
+	if stats.ResolvedReports = int64(len(resolved)); stats.ResolvedReports > 0 {
+		stats.AverageResolution = (total / time.Duration(len(resolved))).Seconds()
+	}
+	return stats, nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestModStats seeds reports and mod actions in two topics and reads one
+// topic's moderator stats, then checks they are served from the cache.
+func TestModStats(t *testing.T) {
+	e := newServer(t)
+	stats, maxAge := modStats, ModStatsMaxAge
+	t.Cleanup(func() { modStats, ModStatsMaxAge = stats, maxAge })
+	modStats = map[string]*ModStats{}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	carol, _ := newUser(t, "carol")
+	now := time.Now()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.TopicModerator{TopicID: "golang", UserID: carol.ID},
+		&models.TopicModerator{TopicID: "rust", UserID: bob.ID},
+		&models.Report{Model: models.Model{ID: "open"}, TopicID: "golang", PostID: "p1", ReporterID: bob.ID, Status: models.ReportOpen},
+		&models.Report{Model: models.Model{ID: "held"}, TopicID: "golang", PostID: "p2", ReporterID: bob.ID, Status: models.ReportOpen, Held: true},
+		// Resolved after one hour and after three.
+		&models.Report{Model: models.Model{ID: "approved", CreatedAt: now.Add(-5 * time.Hour), UpdatedAt: now.Add(-4 * time.Hour)}, TopicID: "golang", PostID: "p3", ReporterID: bob.ID, Status: models.ReportApproved, ResolvedByID: alice.ID},
+		&models.Report{Model: models.Model{ID: "removed", CreatedAt: now.Add(-5 * time.Hour), UpdatedAt: now.Add(-2 * time.Hour)}, TopicID: "golang", PostID: "p4", ReporterID: bob.ID, Status: models.ReportRemoved, ResolvedByID: carol.ID},
+		// Resolved before the stats' window.
+		&models.Report{Model: models.Model{ID: "old", CreatedAt: now.AddDate(0, 0, -60), UpdatedAt: now.AddDate(0, 0, -50)}, TopicID: "golang", PostID: "p5", ReporterID: bob.ID, Status: models.ReportRemoved, ResolvedByID: carol.ID},
+		&models.Report{Model: models.Model{ID: "elsewhere"}, TopicID: "rust", PostID: "r1", ReporterID: alice.ID, Status: models.ReportOpen, Held: true},
+		&models.ModAction{Model: models.Model{ID: "a1"}, TopicID: "golang", ModeratorID: alice.ID, Action: models.ModApprove},
+		&models.ModAction{Model: models.Model{ID: "a2"}, TopicID: "golang", ModeratorID: carol.ID, Action: models.ModRemove},
+		&models.ModAction{Model: models.Model{ID: "a3"}, TopicID: "golang", ModeratorID: carol.ID, Action: models.ModRemove},
+		&models.ModAction{Model: models.Model{ID: "a4", CreatedAt: now.AddDate(0, 0, -50)}, TopicID: "golang", ModeratorID: alice.ID, Action: models.ModRemove},
+		&models.ModAction{Model: models.Model{ID: "a5"}, TopicID: "rust", ModeratorID: bob.ID, Action: models.ModRemove},
+	)
+
+	for _, tc := range []struct {
+		what, token string
+		want        int
+	}{
+		{"signed out", "", http.StatusUnauthorized},
+		{"as another topic's moderator", bobToken, http.StatusForbidden},
+	} {
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/mod-stats", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("mod stats %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	read := func() ModStats {
+		t.Helper()
+		var got ModStats
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/mod-stats", aliceToken, nil, &got); rec.Code != http.StatusOK {
+			t.Fatalf("mod stats: %d %s", rec.Code, rec.Body)
+		}
+		return got
+	}
+	got := read()
+	if got.OpenReports != 2 || got.ApprovalQueue != 1 || got.ResolvedReports != 2 {
+		t.Errorf("reports: got %d open, %d held and %d resolved, want 2, 1 and 2", got.OpenReports, got.ApprovalQueue, got.ResolvedReports)
+	}
+	if want := (2 * time.Hour).Seconds(); got.AverageResolution < want-1 || got.AverageResolution > want+1 {
+		t.Errorf("average resolution: got %vs, want %vs", got.AverageResolution, want)
+	}
+	if want := []ModeratorActivity{{carol.ID, 2}, {alice.ID, 1}}; len(got.Moderators) != 2 || got.Moderators[0] != want[0] || got.Moderators[1] != want[1] {
+		t.Errorf("moderators: got %+v, want %+v", got.Moderators, want)
+	}
+
+	create(t, &models.Report{Model: models.Model{ID: "new"}, TopicID: "golang", PostID: "p6", ReporterID: bob.ID, Status: models.ReportOpen})
+	if got := read(); got.OpenReports != 2 {
+		t.Errorf("open reports within the max age: got %d, want the cached 2", got.OpenReports)
+	}
+	ModStatsMaxAge = 0
+	if got := read(); got.OpenReports != 3 {
+		t.Errorf("open reports after the max age: got %d, want 3", got.OpenReports)
+	}
+}
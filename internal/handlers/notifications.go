@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type NotificationRequest struct {
+	models.PageRequest
+	ID string `param:"notificationid"`
+}
+type NotificationList struct {
+	models.ListResponse[models.Notification]
+	Unread int64 `json:"unread"`
+}
+
+// OnCreate runs the side effects of new content. They are logged rather than
+// failing a create that already happened.
+func OnCreate(c context.Context, obj any, author *models.User) {
+	if post, ok := obj.(*models.Post); ok {
+		UnfurlLater(c, post)
+	}
+	if Removed(obj) || author != nil && author.Shadowbanned {
+		return
+	}
+	Publish(obj, author)
+	if err := Notify(c, obj); err != nil {
+		logging.FromContext(c).Error("failed to send notifications", "error", err)
+	}
+}
+
+// Notify tells the author of the post or comment being replied to and the
+// users mentioned in the content, each at most once and never the author
+// or anyone who has blocked them.
+func Notify(c context.Context, obj any) error {
+	var base models.Notification
+	var content string
+	var recipients []models.Notification
+	switch obj := obj.(type) {
+	case *models.Post:
+		base = models.Notification{ActorID: obj.AuthorID, TopicID: obj.TopicID, PostID: obj.ID}
+		content = obj.Content
+	case *models.Comment:
+		base = models.Notification{ActorID: obj.AuthorID, TopicID: obj.TopicID, PostID: obj.PostID, CommentID: obj.ID}
+		content = obj.Content
+		reply := base
+		if obj.ParentCommentID != "" {
+			parent, err := store.Get(c, Store, models.Comment{Model: models.Model{ID: obj.ParentCommentID}, TopicID: obj.TopicID, PostID: obj.PostID})
+			if err != nil {
+				return err
+			}
+			reply.UserID, reply.Kind = parent.AuthorID, models.NotifyCommentReply
+		} else {
+			post, err := store.Get(c, Store, models.Post{Model: models.Model{ID: obj.PostID}, TopicID: obj.TopicID})
+			if err != nil {
+				return err
+			}
+			reply.UserID, reply.Kind = post.AuthorID, models.NotifyPostReply
+		}
+		recipients = append(recipients, reply)
+	default:
+		return nil
+	}
+	for _, name := range models.Mentions(content) {
+		user, err := UserByName(c, name)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		mention := base
+		mention.UserID, mention.Kind = user.ID, models.NotifyMention
+		recipients = append(recipients, mention)
+	}
+	notified := map[string]bool{base.ActorID: true, "": true}
+	for _, notification := range recipients {
+		if notified[notification.UserID] {
+			continue
+		}
+		notified[notification.UserID] = true
+		if blocked, err := HasBlocked(c, Store, notification.UserID, base.ActorID); err != nil {
+			return err
+		} else if blocked {
+			continue
+		}
+		notification.ID, notification.Unread = uuid.NewString(), true
+		if _, err := store.Create(c, Store, notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func UnreadNotifications(c context.Context, user *models.User) (int64, error) {
+	return Store.Count(c, &models.Notification{}, &models.Notification{UserID: user.ID}, store.Where("unread", "=", true))
+}
+func Notifications(c context.Context, req NotificationRequest) (*NotificationList, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	list, err := store.List(c, Store, models.Notification{UserID: user.ID}, req.PageRequest, store.Preload("Actor"), store.OrderBy("created_at DESC"))
+	if err != nil {
+		return nil, err
+	}
+	unread, err := UnreadNotifications(c, user)
+	return &NotificationList{ListResponse: *list, Unread: unread}, err
+}
+func MarkRead(c context.Context, req NotificationRequest) (*models.Notification, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	notification, err := store.Get(c, Store, models.Notification{Model: models.Model{ID: req.ID}, UserID: user.ID})
+	if err != nil {
+		return nil, err
+	}
+	if err := Store.Update(c, notification, map[string]any{"unread": false}); err != nil {
+		return nil, err
+	}
+	notification.Unread = false
+	return notification, nil
+}
+
+// MarkAllRead marks the current user's unread notifications read, in one
+// update.
+func MarkAllRead(c context.Context, _ NotificationRequest) (*models.Notification, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	unread, err := store.Find(c, Store, models.Notification{UserID: user.ID}, store.Where("unread", "=", true))
+	if err != nil || len(unread) == 0 {
+		return nil, err
+	}
+	ids := make([]string, len(unread))
+	for i, notification := range unread {
+		ids[i] = notification.ID
+	}
+	return nil, Store.UpdateColumns(c, &models.Notification{}, &models.Notification{UserID: user.ID}, map[string]any{"unread": false, "updated_at": time.Now()}, store.Where("id", "IN", ids))
+}
+func HandleNotifications(c echo.Context) error {
+	if CurrentUser(c.Request().Context()) == nil {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	var req NotificationRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := Notifications(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "notifications", list)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestNotifications replies to posts and comments over v1 and the form and
+// checks who is notified, then marks the notifications read.
+func TestNotifications(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Hello"},
+	)
+	comment := func(token, parent string) models.Comment {
+		t.Helper()
+		var c models.Comment
+		if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments", token, map[string]any{"model": map[string]any{"content": "hi", "parentCommentID": parent}}, &c); rec.Code != http.StatusCreated {
+			t.Fatalf("comment: %d", rec.Code)
+		}
+		return c
+	}
+	list := func(token string) NotificationList {
+		t.Helper()
+		var list NotificationList
+		if rec := call(t, e, http.MethodGet, "/v1/notifications", token, nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("notifications: %d", rec.Code)
+		}
+		return list
+	}
+
+	reply := comment(bobToken, "")
+	comment(aliceToken, "")
+	if rec := postForm(e, "/topics/golang/posts/p1/comments", url.Values{"content": {"thanks"}, "parentCommentID": {reply.ID}}, login(t, alice)); rec.Code != http.StatusOK {
+		t.Fatalf("reply through the form: %d", rec.Code)
+	}
+	comment(bobToken, reply.ID)
+
+	got := list(aliceToken)
+	if got.Unread != 1 || len(got.Items) != 1 || got.Items[0].Kind != models.NotifyPostReply || got.Items[0].CommentID != reply.ID || got.Items[0].Actor == nil || got.Items[0].Actor.Username != "bob" {
+		t.Errorf("alice's notifications: got %d unread in %+v", got.Unread, got.Items)
+	}
+	got = list(bobToken)
+	if got.Unread != 1 || len(got.Items) != 1 || got.Items[0].Kind != models.NotifyCommentReply || got.Items[0].ActorID != alice.ID || got.Items[0].UserID != bob.ID {
+		t.Fatalf("bob's notifications: got %d unread in %+v", got.Unread, got.Items)
+	}
+
+	path := "/v1/notifications/" + got.Items[0].ID + "/read"
+	if rec := call(t, e, http.MethodPost, path, aliceToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("mark someone else's notification read: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodPost, path, "", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("mark read signed out: got %d", rec.Code)
+	}
+	var read models.Notification
+	if rec := call(t, e, http.MethodPost, path, bobToken, nil, &read); rec.Code != http.StatusOK || read.Unread {
+		t.Errorf("mark read: got %d %+v", rec.Code, read)
+	}
+	if got := list(bobToken); got.Unread != 0 || len(got.Items) != 1 {
+		t.Errorf("bob after marking read: got %d unread in %d", got.Unread, len(got.Items))
+	}
+
+	comment(bobToken, "")
+	if got := list(aliceToken); got.Unread != 2 {
+		t.Errorf("alice before marking all read: got %d unread", got.Unread)
+	}
+	counted := &updateCounter{Store: Store}
+	saved := Store
+	Store = counted
+	if rec := postForm(e, "/notifications/read", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("mark all read through the form: got %d", rec.Code)
+	}
+	Store = saved
+	if counted.n != 1 {
+		t.Errorf("marking two notifications read took %d updates, want 1", counted.n)
+	}
+	if got := list(aliceToken); got.Unread != 0 || len(got.Items) != 2 {
+		t.Errorf("alice after marking all read: got %d unread in %d", got.Unread, len(got.Items))
+	}
+	if got := list(bobToken); got.Unread != 0 {
+		t.Errorf("marking alice's read changed bob's: got %d unread", got.Unread)
+	}
+
+	if rec := get(e, "/notifications"); rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login" {
+		t.Errorf("notifications page signed out: got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+// TestMentionNotifications mentions users in a post and a comment and checks
+// each is notified once, the author never.
+func TestMentionNotifications(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	carol, _ := newUser(t, "carol")
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+	kinds := func(user *models.User) map[string]int {
+		t.Helper()
+		notifications, err := store.Find(context.Background(), Store, models.Notification{UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds := map[string]int{}
+		for _, n := range notifications {
+			kinds[n.Kind]++
+		}
+		return kinds
+	}
+
+	var post models.Post
+	body := map[string]any{"model": map[string]any{"title": "Hello", "content": "cc @bob @carol @alice @nobody `@carol`"}}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", aliceToken, body, &post); rec.Code != http.StatusCreated {
+		t.Fatalf("create post: %d", rec.Code)
+	}
+	for user, want := range map[*models.User]string{alice: "map[]", bob: "map[mention:1]", carol: "map[mention:1]"} {
+		if got := fmt.Sprint(kinds(user)); got != want {
+			t.Errorf("%s after the post: got %s, want %s", user.Username, got, want)
+		}
+	}
+
+	body = map[string]any{"model": map[string]any{"content": "thanks @alice and @carol, @carol"}}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/"+post.ID+"/comments", bobToken, body, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("create comment: %d", rec.Code)
+	}
+	for user, want := range map[*models.User]string{alice: "map[post_reply:1]", bob: "map[mention:1]", carol: "map[mention:2]"} {
+		if got := fmt.Sprint(kinds(user)); got != want {
+			t.Errorf("%s after the comment: got %s, want %s", user.Username, got, want)
+		}
+	}
+}
+
+// updateCounter counts the updates made through a store, inside
+// transactions too.
+type updateCounter struct {
+	store.Store
+	n int
+}
+
+func (s *updateCounter) Update(c context.Context, model any, mask any) error {
+	s.n++
+	return s.Store.Update(c, model, mask)
+}
+func (s *updateCounter) UpdateColumns(c context.Context, model any, id any, values map[string]any, scopes ...store.Scope) error {
+	s.n++
+	return s.Store.UpdateColumns(c, model, id, values, scopes...)
+}
+func (s *updateCounter) Transaction(c context.Context, f func(store.Store) error) error {
+	return s.Store.Transaction(c, func(tx store.Store) error {
+		counted := &updateCounter{Store: tx}
+		defer func() { s.n += counted.n }()
+		return f(counted)
+	})
+}
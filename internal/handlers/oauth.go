@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/endpoints"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const OAuthStateCookie = "oauth_state"
+
+type OAuthRequest struct {
+	Provider string `param:"provider"`
+	State    string `query:"state"`
+	Code     string `query:"code"`
+}
+type OAuthProfile struct {
+	Subject  string
+	Username string
+}
+type OAuthProvider struct {
+	Config  *oauth2.Config
+	Profile func(context.Context, *http.Client) (*OAuthProfile, error)
+}
+type OAuthClient struct {
+	ClientID     string `yaml:"clientID"`
+	ClientSecret string `yaml:"clientSecret"`
+}
+type OAuthSpec struct {
+	Endpoint oauth2.Endpoint
+	Scopes   []string
+	Profile  func(context.Context, *http.Client) (*OAuthProfile, error)
+}
+
+var ErrUnknownProvider = NewError(NotFound, "unknown_provider", "unknown login provider")
+var ErrInvalidOAuthState = NewError(BadRequest, "invalid_oauth_state", "invalid login state, please try again")
+var OAuthProviders = map[string]OAuthProvider{}
+var OAuthSpecs = map[string]OAuthSpec{
+	"github": {endpoints.GitHub, []string{"read:user"}, GitHubProfile},
+	"google": {endpoints.Google, []string{"openid", "email"}, GoogleProfile},
+}
+
+func fetchProfile(c context.Context, client *http.Client, url string, profile any) error {
+	req, err := http.NewRequestWithContext(c, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching profile from %s: %s", url, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(profile)
+}
+func GitHubProfile(c context.Context, client *http.Client) (*OAuthProfile, error) {
+	var profile struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := fetchProfile(c, client, "https://api.github.com/user", &profile); err != nil {
+		return nil, err
+	}
+	return &OAuthProfile{Subject: strconv.FormatInt(profile.ID, 10), Username: profile.Login}, nil
+}
+func GoogleProfile(c context.Context, client *http.Client) (*OAuthProfile, error) {
+	var profile struct {
+		Sub   string `json:"sub"`
+		Email string `json:"email"`
+	}
+	if err := fetchProfile(c, client, "https://openidconnect.googleapis.com/v1/userinfo", &profile); err != nil {
+		return nil, err
+	}
+	username, _, _ := strings.Cut(profile.Email, "@")
+	return &OAuthProfile{Subject: profile.Sub, Username: username}, nil
+}
+func ConfigureOAuth(baseURL string, clients map[string]OAuthClient) {
+	for name, spec := range OAuthSpecs {
+		client := clients[name]
+		if client.ClientID == "" || client.ClientSecret == "" {
+			continue
+		}
+		OAuthProviders[name] = OAuthProvider{
+			Config: &oauth2.Config{
+				ClientID:     client.ClientID,
+				ClientSecret: client.ClientSecret,
+				Endpoint:     spec.Endpoint,
+				Scopes:       spec.Scopes,
+				RedirectURL:  baseURL + "/auth/" + name + "/callback",
+			},
+			Profile: spec.Profile,
+		}
+	}
+}
+func OAuthProviderNames() []string {
+	names := make([]string, 0, len(OAuthProviders))
+	for name := range OAuthProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+func AvailableUsername(c context.Context, s store.Store, base string) (string, error) {
+	base = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, base)
+	if len(base) > 15 {
+		base = base[:15]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+	username := base
+	for i := 0; i < 10; i++ {
+		count, err := s.Count(c, &models.User{}, &models.User{Username: username})
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		buf := make([]byte, 2)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		username = base + hex.EncodeToString(buf)
+	}
+	return "", store.ErrDuplicatedKey
+}
+func LoginWithIdentity(c context.Context, provider string, profile *OAuthProfile) (*models.User, error) {
+	identity, err := store.Get(c, Store, models.Identity{Provider: provider, Subject: profile.Subject})
+	if err == nil {
+		return store.Get(c, Store, models.User{Model: models.Model{ID: identity.UserID}})
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	user := CurrentUser(c)
+	err = Store.Transaction(c, func(tx store.Store) error {
+		if user == nil {
+			username, err := AvailableUsername(c, tx, profile.Username)
+			if err != nil {
+				return err
+			}
+			if user, err = store.Create(c, tx, models.User{Model: models.Model{ID: uuid.NewString()}, Username: username}); err != nil {
+				return err
+			}
+		}
+		_, err := store.Create(c, tx, models.Identity{Model: models.Model{ID: uuid.NewString()}, Provider: provider, Subject: profile.Subject, UserID: user.ID})
+		return err
+	})
+	return user, err
+}
+func HandleOAuthLogin(c echo.Context) error {
+	var req OAuthRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	provider, ok := OAuthProviders[req.Provider]
+	if !ok {
+		return Fail(c, ErrUnknownProvider)
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return Fail(c, err)
+	}
+	state := base64.RawURLEncoding.EncodeToString(buf)
+	c.SetCookie(&http.Cookie{
+		Name:     OAuthStateCookie,
+		Value:    state,
+		Path:     "/auth/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusFound, provider.Config.AuthCodeURL(state))
+}
+func HandleOAuthCallback(c echo.Context) error {
+	var req OAuthRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	provider, ok := OAuthProviders[req.Provider]
+	if !ok {
+		return Fail(c, ErrUnknownProvider)
+	}
+	cookie, err := c.Cookie(OAuthStateCookie)
+	if err != nil || req.State == "" || cookie.Value != req.State {
+		return Fail(c, ErrInvalidOAuthState)
+	}
+	c.SetCookie(&http.Cookie{Name: OAuthStateCookie, Value: "", Path: "/auth/", MaxAge: -1, HttpOnly: true, Secure: SecureCookies, SameSite: http.SameSiteLaxMode})
+	ctx := c.Request().Context()
+	token, err := provider.Config.Exchange(ctx, req.Code)
+	if err != nil {
+		return Fail(c, &Error{Kind: Unauthorized, Code: "oauth_exchange_failed", Err: err})
+	}
+	profile, err := provider.Profile(ctx, provider.Config.Client(ctx, token))
+	if err != nil {
+		return Fail(c, &Error{Kind: BadGateway, Code: "oauth_profile_failed", Err: err})
+	}
+	user, err := LoginWithIdentity(ctx, req.Provider, profile)
+	if err != nil {
+		return Fail(c, err)
+	}
+	if err := StartSession(c, user); err != nil {
+		return Fail(c, err)
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// OpenAPI is an OpenAPI 3 document built from the request and response types
+// of the routes registered through Route.
+type OpenAPI struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       map[string]string                `json:"info"`
+	Servers    []map[string]string              `json:"servers"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas         map[string]map[string]any `json:"schemas"`
+		SecuritySchemes map[string]map[string]any `json:"securitySchemes"`
+	} `json:"components"`
+}
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Parameters  []map[string]any      `json:"parameters,omitempty"`
+	RequestBody map[string]any        `json:"requestBody,omitempty"`
+	Responses   map[string]any        `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// API is the v1 route group, documenting every route added with Route.
+type API struct {
+	*echo.Group
+	Spec *OpenAPI
+}
+
+func NewOpenAPI(prefix string) *OpenAPI {
+	spec := &OpenAPI{
+		OpenAPI: "3.0.3",
+		Info:    map[string]string{"title": "Reddit Clone API", "version": "1.0.0"},
+		Servers: []map[string]string{{"url": prefix}},
+		Paths:   map[string]map[string]*Operation{},
+	}
+	spec.Components.Schemas = map[string]map[string]any{}
+	spec.Components.SecuritySchemes = map[string]map[string]any{"bearerAuth": {"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}}
+	return spec
+}
+func Route[T any, R any](api API, method string, path string, status int, f func(context.Context, R) (T, error), middleware ...echo.MiddlewareFunc) {
+	api.Add(method, path, V1WithStatus(status, f), middleware...)
+	api.Spec.Document(method, path, status, method != http.MethodGet, reflect.TypeFor[R](), reflect.TypeFor[T]())
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+func (s *OpenAPI) Document(method string, path string, status int, auth bool, req reflect.Type, res reflect.Type) {
+	op := &Operation{OperationID: operationID(method, path, res), Responses: map[string]any{}}
+	body := map[string]any{}
+	for _, field := range fields(req) {
+		if name := field.Tag.Get("param"); name != "" && strings.Contains(path, ":"+name) {
+			op.Parameters = append(op.Parameters, map[string]any{"name": name, "in": "path", "required": true, "schema": s.Schema(field.Type)})
+		} else if name := field.Tag.Get("query"); name != "" {
+			op.Parameters = append(op.Parameters, map[string]any{"name": name, "in": "query", "schema": s.Schema(field.Type)})
+		} else if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+			body[name] = s.Schema(field.Type)
+		}
+	}
+	if len(body) > 0 {
+		op.RequestBody = map[string]any{"required": true, "content": map[string]any{
+			echo.MIMEApplicationJSON: map[string]any{"schema": map[string]any{"type": "object", "properties": body}},
+		}}
+	}
+	response := map[string]any{"description": http.StatusText(status)}
+	if status != http.StatusNoContent {
+		response["content"] = map[string]any{echo.MIMEApplicationJSON: map[string]any{"schema": s.Schema(res)}}
+	}
+	op.Responses[strconv.Itoa(status)] = response
+	op.Responses["default"] = map[string]any{"description": "Error", "content": map[string]any{
+		"application/problem+json": map[string]any{"schema": s.Schema(reflect.TypeFor[Problem]())},
+	}}
+	if auth {
+		op.Security = []map[string][]string{{"bearerAuth": {}}}
+	}
+	path = pathParam.ReplaceAllString(path, "{$1}")
+	if s.Paths[path] == nil {
+		s.Paths[path] = map[string]*Operation{}
+	}
+	s.Paths[path][strings.ToLower(method)] = op
+}
+
+// Schema describes t the way encoding/json marshals it, adding named structs
+// to the components and referring to them.
+func (s *OpenAPI) Schema(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeFor[gorm.DeletedAt]():
+		return map[string]any{"type": "string", "format": "date-time", "nullable": true}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.Schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.Schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.Schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := s.Components.Schemas[name]; !ok {
+			properties := map[string]any{}
+			s.Components.Schemas[name] = map[string]any{"type": "object", "properties": properties}
+			for _, field := range fields(t) {
+				if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "-" {
+					properties[cmp.Or(name, field.Name)] = s.Schema(field.Type)
+				}
+			}
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// fields lists the exported fields of t with embedded structs flattened, as
+// both encoding/json and echo's binder see them.
+func fields(t reflect.Type) []reflect.StructField {
+	var out []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			out = append(out, fields(field.Type)...)
+		} else if field.IsExported() {
+			out = append(out, field)
+		}
+	}
+	return out
+}
+
+var qualified = regexp.MustCompile(`[\w./-]*\.`)
+
+func schemaName(t reflect.Type) string {
+	return strings.NewReplacer("[", "", "]", "", ",", "").Replace(qualified.ReplaceAllString(t.Name(), ""))
+}
+func operationID(method string, path string, res reflect.Type) string {
+	var resource string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" && !strings.HasPrefix(segment, ":") {
+			resource = segment
+		}
+	}
+	resource = strings.ToUpper(resource[:1]) + resource[1:]
+	verb := map[string]string{http.MethodGet: "get", http.MethodPost: "create", http.MethodPut: "update", http.MethodDelete: "delete"}[method]
+	if res.Kind() == reflect.Pointer {
+		res = res.Elem()
+	}
+	if strings.HasPrefix(schemaName(res), "ListResponse") {
+		return "list" + resource
+	}
+	return verb + strings.TrimSuffix(resource, "s")
+}
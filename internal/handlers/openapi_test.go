@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestOpenAPI fetches the served spec and checks it documents every v1
+// route, with the parameters, body, responses and security of a few.
+func TestOpenAPI(t *testing.T) {
+	e := newServer(t)
+	rec := get(e, "/v1/openapi.json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("spec: got %d", rec.Code)
+	}
+	var spec OpenAPI
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range e.Routes() {
+		path, ok := strings.CutPrefix(route.Path, "/v1")
+		if !ok || path == "/openapi.json" || path == "/docs" || route.Method == echo.RouteNotFound {
+			continue
+		}
+		path = pathParam.ReplaceAllString(path, "{$1}")
+		if spec.Paths[path][strings.ToLower(route.Method)] == nil {
+			t.Errorf("%s %s is not in the spec", route.Method, route.Path)
+		}
+	}
+
+	create := spec.Paths["/topics/{topicid}/posts"]["post"]
+	if create == nil {
+		t.Fatal("no operation to create a post")
+	}
+	var params []string
+	for _, param := range create.Parameters {
+		params = append(params, fmt.Sprint(param["in"], ":", param["name"]))
+	}
+	body, _ := json.Marshal(create.RequestBody)
+	created, _ := json.Marshal(create.Responses["201"])
+	if create.OperationID != "createPost" || fmt.Sprint(params) != "[path:topicid]" || len(create.Security) != 1 {
+		t.Errorf("create post: got %s with parameters %v and security %v", create.OperationID, params, create.Security)
+	}
+	if !strings.Contains(string(body), `"model":{"$ref":"#/components/schemas/Post"}`) || !strings.Contains(string(created), `"$ref":"#/components/schemas/Post"`) {
+		t.Errorf("create post body %s and response %s do not refer to the Post schema", body, created)
+	}
+	if _, ok := create.Responses["default"]; !ok {
+		t.Error("create post does not document its error response")
+	}
+
+	list := spec.Paths["/topics/{topicid}/posts"]["get"]
+	params = nil
+	for _, param := range list.Parameters {
+		params = append(params, fmt.Sprint(param["in"], ":", param["name"]))
+	}
+	if list.OperationID != "listPosts" || list.Security != nil || !strings.Contains(fmt.Sprint(params), "query:sort") {
+		t.Errorf("list posts: got %s with parameters %v and security %v", list.OperationID, params, list.Security)
+	}
+	if _, ok := spec.Paths["/topics/{topicid}"]["delete"].Responses["204"].(map[string]any)["content"]; ok {
+		t.Error("delete topic documents a body for its 204")
+	}
+
+	post, _ := json.Marshal(spec.Components.Schemas["Post"])
+	for _, want := range []string{`"votes":{"type":"integer"}`, `"CreatedAt":{"format":"date-time","type":"string"}`, `"author":{"$ref":"#/components/schemas/User"}`} {
+		if !strings.Contains(string(post), want) {
+			t.Errorf("Post schema %s lacks %s", post, want)
+		}
+	}
+	user, _ := json.Marshal(spec.Components.Schemas["User"])
+	if strings.Contains(string(post), "NormalizedTitle") || strings.Contains(string(user), "PasswordHash") {
+		t.Errorf("schemas document fields json leaves out: %s %s", post, user)
+	}
+
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	if rec := get(e, "/v1/docs"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Errorf("docs page: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// MaxPinnedPosts is how many posts a topic can have pinned at once.
+var MaxPinnedPosts = 2
+
+var ErrTooManyPinned = NewError(Conflict, "too_many_pinned", "the topic already has as many pinned posts as it can")
+
+// Pin pins a post to the top of its topic, or unpins it. Only the topic's
+// moderators may, and it is logged.
+func Pin(on bool) func(context.Context, GetRequest) (*models.Post, error) {
+	return func(c context.Context, req GetRequest) (*models.Post, error) {
+		if err := Moderate(c, req.TopicID); err != nil {
+			return nil, err
+		}
+		post, _, err := findTarget(c, Store, models.IDs{TopicID: req.TopicID, PostID: req.PostID})
+		if err != nil {
+			return nil, err
+		} else if post.Pinned == on {
+			return nil, nil
+		}
+		action := &models.ModAction{TopicID: req.TopicID, Action: models.ModPin, PostID: req.PostID, TargetUserID: post.AuthorID}
+		if !on {
+			action.Action = models.ModUnpin
+		}
+		return nil, Moderated(c, action, func(tx store.Store) error {
+			if on {
+				if count, err := tx.Count(c, &models.Post{}, &models.Post{TopicID: req.TopicID, Pinned: true}); err != nil {
+					return err
+				} else if count >= int64(MaxPinnedPosts) {
+					return ErrTooManyPinned
+				}
+			}
+			return tx.Update(c, &models.Post{Model: models.Model{ID: post.ID}, TopicID: post.TopicID}, map[string]any{"pinned": on})
+		})
+	}
+}
+
+// PinnedPosts lists the topic's pinned posts, or those with the flair,
+// newest first.
+func PinnedPosts(c context.Context, req ListRequest) (*models.ListResponse[models.Post], error) {
+	if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: req.TopicID}}); err != nil {
+		return nil, err
+	}
+	posts, err := store.Find(c, Store, models.Post{TopicID: req.TopicID, FlairID: req.Flair, Pinned: true}, store.Select(ListingColumns...), store.Preload("Author", "Flair"), store.OrderBy("created_at DESC"), Visible(c), Unhidden(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := annotateListing(c, req.TopicID, posts); err != nil {
+		return nil, err
+	}
+	return &models.ListResponse[models.Post]{Items: posts, Pagination: models.Pagination{Total: int64(len(posts)), Limit: len(posts)}}, nil
+}
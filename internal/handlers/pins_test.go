@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestPins pins and unpins posts on each store, and checks where pinned
+// posts are listed.
+func TestPins(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testPins(t, s)
+		})
+	}
+}
+
+func testPins(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	now := time.Now()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Flair{Model: models.Model{ID: "news"}, TopicID: "golang", Text: "News", Color: "#e0e0e0"},
+		&models.Post{Model: models.Model{ID: "p1", CreatedAt: now.Add(-3 * time.Hour)}, TopicID: "golang", AuthorID: bob.ID, Title: "Rules", FlairID: "news"},
+		&models.Post{Model: models.Model{ID: "p2", CreatedAt: now.Add(-2 * time.Hour)}, TopicID: "golang", AuthorID: bob.ID, Title: "Weekly thread"},
+		&models.Post{Model: models.Model{ID: "p3", CreatedAt: now.Add(-time.Hour)}, TopicID: "golang", AuthorID: bob.ID, Title: "Question"},
+	)
+	for _, tc := range []struct {
+		what, method, post, token string
+		want                      int
+	}{
+		{"as a non-moderator", http.MethodPut, "p1", bobToken, http.StatusForbidden},
+		{"p1", http.MethodPut, "p1", aliceToken, http.StatusNoContent},
+		{"p2", http.MethodPut, "p2", aliceToken, http.StatusNoContent},
+		{"p1 again", http.MethodPut, "p1", aliceToken, http.StatusNoContent},
+		{"past the limit", http.MethodPut, "p3", aliceToken, http.StatusConflict},
+		{"a missing post", http.MethodPut, "p9", aliceToken, http.StatusNotFound},
+		{"an unpinned post", http.MethodDelete, "p3", aliceToken, http.StatusNoContent},
+	} {
+		if rec := call(t, e, tc.method, "/v1/topics/golang/posts/"+tc.post+"/pinned", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("%s %s: got %d, want %d: %s", tc.method, tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+
+	titles := func(posts []models.Post) string {
+		var got []string
+		for _, p := range posts {
+			got = append(got, p.Title)
+		}
+		return fmt.Sprint(got)
+	}
+	pinned := func(query string) string {
+		t.Helper()
+		var list models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/pinned"+query, "", nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("pinned posts: %d", rec.Code)
+		}
+		return titles(list.Items)
+	}
+	if got := pinned(""); got != "[Weekly thread Rules]" {
+		t.Errorf("pinned posts: got %s", got)
+	}
+	if got := pinned("?flair=news"); got != "[Rules]" {
+		t.Errorf("pinned news: got %s", got)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/rust/pinned", "", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("pinned posts of a missing topic: got %d", rec.Code)
+	}
+	var page PostPage
+	call(t, e, http.MethodGet, "/topics/golang/posts?sort=new", "", nil, &page)
+	if got := titles(page.Posts); got != "[Question]" {
+		t.Errorf("the infinite scroll: got %s", got)
+	}
+	body := postPage(t, e, "/topics/golang?sort=new", bob)
+	if i, j, k := strings.Index(body, `<span class="pin">pinned</span> <a href="/topics/golang/posts/p2">`), strings.Index(body, `<span class="pin">pinned</span> <a class="flair"`), strings.Index(body, ">Question</a>"); i < 0 || j < i || k < j {
+		t.Errorf("the topic page does not list the pinned posts first: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang?sort=new&offset=1", bob); strings.Contains(body, `<span class="pin">`) {
+		t.Errorf("a later page of the topic lists the pinned posts: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang/posts/p1", alice); !strings.Contains(body, `data-url="/topics/golang/posts/p1/unpin">Unpin</button>`) {
+		t.Errorf("the post page does not offer a moderator to unpin: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang/posts/p1", bob); strings.Contains(body, `<button class="pin"`) {
+		t.Errorf("the post page offers a non-moderator to unpin: %s", body)
+	}
+
+	for range 2 {
+		if rec := postForm(e, "/topics/golang/posts/p1/unpin", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+			t.Errorf("unpin through the page: got %d %s", rec.Code, rec.Body)
+		}
+	}
+	if got := pinned(""); got != "[Weekly thread]" {
+		t.Errorf("pinned posts after unpinning: got %s", got)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	var actions []string
+	for _, action := range log.Items {
+		actions = append(actions, action.Action+" "+action.PostID)
+	}
+	if got := strings.Join(actions, "|"); got != "unpin p1|pin p2|pin p1" {
+		t.Errorf("the mod log: got %s", got)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrNotPoll = NewError(BadRequest, "not_a_poll", "this post is not a poll")
+var ErrPollClosed = NewError(Forbidden, "poll_closed", "this poll has closed")
+var ErrAlreadyVoted = NewError(Conflict, "already_voted", "you have already voted in this poll")
+
+type PollVoteRequest struct {
+	models.IDs
+	Option int `json:"option" form:"option"`
+}
+
+// NewPoll is the poll with the given options, or nil without any.
+func NewPoll(options []string) *models.Poll {
+	if len(options) == 0 {
+		return nil
+	}
+	poll := &models.Poll{}
+	for _, text := range options {
+		poll.Options = append(poll.Options, models.PollOption{Text: text})
+	}
+	return poll
+}
+
+// PollCloses is when a poll open for the given number of days closes, or
+// nil to leave it open for the default models.PollDuration.
+func PollCloses(days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+	closes := time.Now().AddDate(0, 0, days)
+	return &closes
+}
+
+// CreatePoll stores the options of a new poll post, numbered in the order
+// they were given.
+func CreatePoll(c context.Context, s store.Store, post *models.Post) error {
+	if post.Poll == nil {
+		return nil
+	}
+	for i := range post.Poll.Options {
+		option := &post.Poll.Options[i]
+		option.TopicID, option.PostID, option.Position = post.TopicID, post.ID, i+1
+		option.Text = models.StripTags(option.Text)
+		if err := s.Create(c, option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttachPoll sets the options of a poll post and how the current user
+// voted, leaving the counts out until they voted or the poll closed.
+func AttachPoll(c context.Context, post *models.Post) error {
+	if !post.IsPoll() {
+		return nil
+	}
+	options, err := store.Find(c, Store, models.PollOption{TopicID: post.TopicID, PostID: post.ID}, store.OrderBy("position"))
+	if err != nil {
+		return err
+	}
+	poll := &models.Poll{Options: options, Closed: post.PollClosesAt != nil && !time.Now().Before(*post.PollClosesAt)}
+	if user := CurrentUser(c); user != nil {
+		votes, err := store.Find(c, Store, models.PollVote{UserID: user.ID, TopicID: post.TopicID, PostID: post.ID})
+		if err != nil {
+			return err
+		}
+		if len(votes) > 0 {
+			poll.MyVote = votes[0].Position
+		}
+	}
+	poll.Results = poll.Closed || poll.MyVote > 0
+	for i := range poll.Options {
+		if !poll.Results {
+			poll.Options[i].Votes = 0
+		}
+		poll.Total += poll.Options[i].Votes
+	}
+	post.Poll = poll
+	return nil
+}
+
+// VotePoll records the current user's one vote in a poll that is still
+// open, and returns the results.
+func VotePoll(c context.Context, req PollVoteRequest) (*models.Poll, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	post, _, err := findTarget(c, Store, models.IDs{TopicID: req.TopicID, PostID: req.PostID}, Visible(c))
+	if err != nil {
+		return nil, err
+	} else if !post.IsPoll() {
+		return nil, ErrNotPoll
+	} else if post.Locked {
+		return nil, ErrLocked
+	} else if post.PollClosesAt != nil && !time.Now().Before(*post.PollClosesAt) {
+		return nil, ErrPollClosed
+	}
+	option := models.PollOption{TopicID: req.TopicID, PostID: req.PostID, Position: req.Option}
+	if req.Option < 1 {
+		return nil, FieldErrors{"option": "must be one of the poll's options"}
+	} else if _, err := store.Get(c, Store, option); errors.Is(err, store.ErrNotFound) {
+		return nil, FieldErrors{"option": "must be one of the poll's options"}
+	} else if err != nil {
+		return nil, err
+	}
+	err = Store.Transaction(c, func(tx store.Store) error {
+		err := tx.Create(c, &models.PollVote{UserID: user.ID, TopicID: req.TopicID, PostID: req.PostID, Position: req.Option})
+		if errors.Is(err, store.ErrDuplicatedKey) {
+			return ErrAlreadyVoted
+		} else if err != nil {
+			return err
+		}
+		return tx.Increment(c, &option, "votes", 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := AttachPoll(c, post); err != nil {
+		return nil, err
+	}
+	return post.Poll, nil
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestPolls creates polls through the API and the site on each store,
+// votes in them, and checks who sees the counts.
+func TestPolls(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testPolls(t, s)
+		})
+	}
+}
+
+func testPolls(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	_, carolToken := newUser(t, "carol")
+	closed := time.Now().Add(-time.Hour)
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "self"}, TopicID: "golang", AuthorID: alice.ID, Title: "Not a poll"},
+		&models.Post{Model: models.Model{ID: "closed", CreatedAt: closed.Add(-time.Hour)}, TopicID: "golang", AuthorID: alice.ID, Title: "Closed", Kind: models.PostPoll, PollClosesAt: &closed},
+		&models.PollOption{TopicID: "golang", PostID: "closed", Position: 1, Text: "Yes", Votes: 3},
+		&models.PollOption{TopicID: "golang", PostID: "closed", Position: 2, Text: "No", Votes: 1},
+	)
+
+	var post models.Post
+	body := map[string]any{"model": map[string]any{"title": "Best language?", "poll": map[string]any{"options": []map[string]any{{"text": "Go"}, {"text": "<b>Rust</b>"}, {"text": "Zig"}}}}}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", aliceToken, body, &post); rec.Code != http.StatusCreated {
+		t.Fatalf("create a poll: %d %s", rec.Code, rec.Body)
+	}
+	if post.Kind != models.PostPoll || post.PollClosesAt == nil || post.PollClosesAt.Sub(post.CreatedAt) != models.PollDuration {
+		t.Errorf("the new poll: got kind %q closing %v", post.Kind, post.PollClosesAt)
+	}
+	poll := func(id, token string) *models.Poll {
+		t.Helper()
+		var got models.Post
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/"+id, token, nil, &got); rec.Code != http.StatusOK || got.Poll == nil {
+			t.Fatalf("get %s: %d %s", id, rec.Code, rec.Body)
+		}
+		return got.Poll
+	}
+	counts := func(p *models.Poll) string {
+		var got []string
+		for _, option := range p.Options {
+			got = append(got, fmt.Sprintf("%d.%s=%d", option.Position, option.Text, option.Votes))
+		}
+		return fmt.Sprintf("%v %d closed=%v results=%v mine=%d", got, p.Total, p.Closed, p.Results, p.MyVote)
+	}
+	if got := counts(poll(post.ID, bobToken)); got != "[1.Go=0 2.Rust=0 3.Zig=0] 0 closed=false results=false mine=0" {
+		t.Errorf("before voting: got %s", got)
+	}
+
+	vote := func(id, token string, option int) (int, *models.Poll) {
+		t.Helper()
+		var got models.Poll
+		rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/"+id+"/poll/vote", token, map[string]any{"option": option}, &got)
+		return rec.Code, &got
+	}
+	if code, got := vote(post.ID, bobToken, 2); code != http.StatusOK || counts(got) != "[1.Go=0 2.Rust=1 3.Zig=0] 1 closed=false results=true mine=2" {
+		t.Errorf("bob's vote: got %d %s", code, counts(got))
+	}
+	for _, tc := range []struct {
+		what, id, token string
+		option          int
+		want            int
+	}{
+		{"again", post.ID, bobToken, 1, http.StatusConflict},
+		{"signed out", post.ID, "", 1, http.StatusUnauthorized},
+		{"for option 0", post.ID, carolToken, 0, http.StatusBadRequest},
+		{"for a missing option", post.ID, carolToken, 4, http.StatusBadRequest},
+		{"in a closed poll", "closed", carolToken, 1, http.StatusForbidden},
+		{"in a post that is not a poll", "self", carolToken, 1, http.StatusBadRequest},
+		{"in a missing post", "missing", carolToken, 1, http.StatusNotFound},
+	} {
+		if code, _ := vote(tc.id, tc.token, tc.option); code != tc.want {
+			t.Errorf("vote %s: got %d, want %d", tc.what, code, tc.want)
+		}
+	}
+	if got := counts(poll(post.ID, bobToken)); got != "[1.Go=0 2.Rust=1 3.Zig=0] 1 closed=false results=true mine=2" {
+		t.Errorf("bob after voting: got %s", got)
+	}
+	for who, token := range map[string]string{"alice": aliceToken, "a visitor": ""} {
+		if got := counts(poll(post.ID, token)); got != "[1.Go=0 2.Rust=0 3.Zig=0] 0 closed=false results=false mine=0" {
+			t.Errorf("%s before voting: got %s", who, got)
+		}
+	}
+	if got := counts(poll("closed", "")); got != "[1.Yes=3 2.No=1] 4 closed=true results=true mine=0" {
+		t.Errorf("the closed poll: got %s", got)
+	}
+
+	rec := postForm(e, "/topics/golang/posts", url.Values{"title": {"Tabs or spaces?"}, "kind": {"poll"}, "pollOptions": {"Tabs", "Spaces"}, "pollDays": {"1"}}, login(t, bob))
+	if rec.Code >= http.StatusBadRequest {
+		t.Fatalf("create a poll through the page: %d %s", rec.Code, rec.Body)
+	}
+	polls, err := store.Find(context.Background(), Store, models.Post{TopicID: "golang", Title: "Tabs or spaces?"})
+	if err != nil || len(polls) != 1 || polls[0].PollClosesAt == nil || time.Until(*polls[0].PollClosesAt) > 24*time.Hour || time.Until(*polls[0].PollClosesAt) < 23*time.Hour {
+		t.Fatalf("the poll from the page: got %+v, %v", polls, err)
+	}
+	if rec := postForm(e, "/topics/golang/posts/"+polls[0].ID+"/poll/vote", url.Values{"option": {"2"}}, login(t, alice)); rec.Code != http.StatusOK {
+		t.Errorf("vote through the page: got %d %s", rec.Code, rec.Body)
+	}
+	if body := get(e, "/topics/golang/posts/"+polls[0].ID).Body.String(); !strings.Contains(body, `<form class="poll-vote">`) || strings.Contains(body, "% (") {
+		t.Errorf("the poll page shows a visitor the counts: %s", body)
+	}
+	page := postPage(t, e, "/topics/golang/posts/"+polls[0].ID, alice)
+	if !strings.Contains(page, `<span>Spaces</span> <span class="domain">100% (1 vote)</span>`) || !strings.Contains(page, `poll-option voted`) {
+		t.Errorf("the poll page does not show alice the results: %s", page)
+	}
+	if body := get(e, "/topics/golang").Body.String(); strings.Count(body, `<span class="domain">(poll)</span>`) != 3 {
+		t.Errorf("the topic page does not mark the polls: %s", body)
+	}
+
+	for _, id := range []string{post.ID, "closed"} {
+		if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/posts/"+id, aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete %s: %d", id, rec.Code)
+		}
+	}
+	if _, _, err := Purge(context.Background(), time.Now().Add(time.Minute), false); err != nil {
+		t.Fatal(err)
+	}
+	// Only bob's poll, with alice's vote in it, is left.
+	for model, want := range map[any]int64{&models.PollOption{}: 2, &models.PollVote{}: 1} {
+		if n, err := Store.Count(context.Background(), model, model); err != nil || n != want {
+			t.Errorf("%T after the purge: got %d, %v; want %d", model, n, err, want)
+		}
+	}
+}
+
+// postPage serves the post page at path to the signed in user.
+func postPage(t *testing.T, e http.Handler, path string, user *models.User) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.AddCookie(login(t, user))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec.Body.String()
+}
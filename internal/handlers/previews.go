@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// PreviewConfig has link posts unfurled into a preview when Enabled,
+// giving up on a page after Timeout or once MaxBytes of it were read.
+// AllowPrivate lets previews reach loopback and private network
+// addresses, which is only meant for development.
+type PreviewConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Timeout      time.Duration `yaml:"timeout"`
+	MaxBytes     int           `yaml:"maxBytes"`
+	AllowPrivate bool          `yaml:"allowPrivate"`
+}
+
+var Previews = PreviewConfig{Enabled: true, Timeout: 5 * time.Second, MaxBytes: 1 << 20}
+
+// PreviewWorkers is how many link previews are fetched at once. Posts
+// beyond that wait their turn.
+const PreviewWorkers = 4
+
+// PreviewAgent is the User-Agent previews are fetched with.
+const PreviewAgent = "reddit-clone-preview/1.0"
+
+var ErrPrivateAddress = errors.New("link preview: address is not public")
+
+var previewSlots = make(chan struct{}, PreviewWorkers)
+
+// nonPublic are the ranges outside the private, loopback and link-local
+// ones net/netip knows that a preview must not reach either.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// PublicAddr reports whether addr is on the public internet.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Client is the HTTP client previews are fetched with. It checks every
+// address it connects to after the name is resolved, redirects included,
+// so a link cannot point it at the site's own network, and it never goes
+// through a proxy, whose address is all it would check.
+func (cfg PreviewConfig) Client() *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout, Control: func(network string, address string, _ syscall.RawConn) error {
+		if cfg.AllowPrivate {
+			return nil
+		}
+		addr, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !PublicAddr(addr.Addr()) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}}
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext:            dialer.DialContext,
+			TLSHandshakeTimeout:    cfg.Timeout,
+			ResponseHeaderTimeout:  cfg.Timeout,
+			MaxResponseHeaderBytes: 64 << 10,
+			DisableKeepAlives:      true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("link preview: too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("link preview: cannot follow a redirect to %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// UnfurlLater fetches the preview of a link post in the background, so
+// creating the post does not wait on the site it links to.
+func UnfurlLater(c context.Context, post *models.Post) {
+	if !Previews.Enabled || !post.IsLink() {
+		return
+	}
+	c = context.WithoutCancel(c)
+	id, link := models.IDs{TopicID: post.TopicID, PostID: post.ID}, post.URL
+	go func() {
+		previewSlots <- struct{}{}
+		defer func() { <-previewSlots }()
+		if err := Unfurl(c, Previews, id, link); err != nil {
+			logging.FromContext(c).Warn("link preview failed", "url", link, "error", err)
+		}
+	}()
+}
+
+// Unfurl fetches the page at link and stores what its Open Graph tags, or
+// failing those its oEmbed data and title, say about it as the preview of
+// the post. Pages that say nothing get no preview.
+func Unfurl(c context.Context, cfg PreviewConfig, id models.IDs, link string) error {
+	client := cfg.Client()
+	page, err := fetchPage(c, client, cfg, link)
+	if err != nil {
+		return err
+	}
+	preview := page.meta
+	if page.oembed != "" && (preview.Title == "" || preview.ImageURL == "") {
+		if embed, err := fetchOEmbed(c, client, cfg, page.oembed); err == nil {
+			preview.Title = firstText(preview.Title, embed.Title)
+			preview.ImageURL = firstText(preview.ImageURL, embed.ThumbnailURL)
+			preview.SiteName = firstText(preview.SiteName, embed.ProviderName)
+		}
+	}
+	preview.Title = firstText(preview.Title, page.title)
+	if preview.Title == "" && preview.Description == "" {
+		return nil
+	}
+	preview.TopicID, preview.PostID, preview.URL = id.TopicID, id.PostID, link
+	preview.Title = clip(preview.Title, 300)
+	preview.Description = clip(preview.Description, 1000)
+	preview.SiteName = clip(preview.SiteName, 100)
+	preview.ImageURL = resolveLink(page.url, preview.ImageURL)
+	return Store.Create(c, &preview)
+}
+
+type previewPage struct {
+	url    *url.URL
+	meta   models.LinkPreview
+	title  string
+	oembed string
+}
+
+// fetchPage reads the head of an HTML page for its meta tags, title and
+// oEmbed link.
+func fetchPage(c context.Context, client *http.Client, cfg PreviewConfig, link string) (*previewPage, error) {
+	res, err := previewGet(c, client, link, "text/html")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if kind, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); kind != "text/html" && kind != "application/xhtml+xml" {
+		return nil, fmt.Errorf("link preview: %s is not a page", kind)
+	}
+	page := &previewPage{url: res.Request.URL}
+	z := html.NewTokenizer(io.LimitReader(res.Body, int64(cfg.MaxBytes)))
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return page, nil
+		case html.TextToken:
+			if inTitle {
+				page.title += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return page, nil
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "body":
+				return page, nil
+			case "meta":
+				applyMeta(&page.meta, firstText(attrs["property"], attrs["name"]), attrs["content"])
+			case "link":
+				if attrs["type"] == "application/json+oembed" && page.oembed == "" {
+					page.oembed = resolveLink(page.url, attrs["href"])
+				}
+			}
+		}
+	}
+}
+
+// applyMeta fills in the preview from a meta tag, preferring Open Graph
+// titles and descriptions to Twitter's and the plain description, and
+// taking the first image given.
+func applyMeta(preview *models.LinkPreview, name string, content string) {
+	switch strings.ToLower(name) {
+	case "og:title":
+		preview.Title = firstText(content, preview.Title)
+	case "twitter:title":
+		preview.Title = firstText(preview.Title, content)
+	case "og:description":
+		preview.Description = firstText(content, preview.Description)
+	case "twitter:description", "description":
+		preview.Description = firstText(preview.Description, content)
+	case "og:image", "og:image:url", "og:image:secure_url", "twitter:image":
+		preview.ImageURL = firstText(preview.ImageURL, content)
+	case "og:site_name":
+		preview.SiteName = firstText(content, preview.SiteName)
+	}
+}
+
+// oEmbed is the part of an oEmbed response a preview uses.
+type oEmbed struct {
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func fetchOEmbed(c context.Context, client *http.Client, cfg PreviewConfig, link string) (*oEmbed, error) {
+	res, err := previewGet(c, client, link, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var embed oEmbed
+	return &embed, json.NewDecoder(io.LimitReader(res.Body, int64(cfg.MaxBytes))).Decode(&embed)
+}
+func previewGet(c context.Context, client *http.Client, link string, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", PreviewAgent)
+	req.Header.Set("Accept", accept)
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("link preview: %s answered %s", req.URL.Host, res.Status)
+	}
+	return res, nil
+}
+
+// AttachPreviews sets the previews of the link posts among posts, with
+// one query for all of them.
+func AttachPreviews(c context.Context, posts []models.Post) error {
+	var ids []string
+	for _, post := range posts {
+		if post.IsLink() {
+			ids = append(ids, post.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	previews, err := store.Find(c, Store, models.LinkPreview{}, store.Where("post_id", "IN", ids))
+	if err != nil {
+		return err
+	}
+	byPost := map[models.IDs]*models.LinkPreview{}
+	for i, preview := range previews {
+		byPost[models.IDs{TopicID: preview.TopicID, PostID: preview.PostID}] = &previews[i]
+	}
+	for i := range posts {
+		posts[i].Preview = byPost[models.IDs{TopicID: posts[i].TopicID, PostID: posts[i].ID}]
+	}
+	return nil
+}
+
+// AttachPreview sets the preview of a single link post.
+func AttachPreview(c context.Context, post *models.Post) error {
+	if !post.IsLink() {
+		return nil
+	}
+	previews, err := store.Find(c, Store, models.LinkPreview{TopicID: post.TopicID, PostID: post.ID})
+	if len(previews) > 0 {
+		post.Preview = &previews[0]
+	}
+	return err
+}
+
+// resolveLink makes a link found on the page absolute, dropping anything
+// but http and https.
+func resolveLink(base *url.URL, link string) string {
+	u, err := base.Parse(strings.TrimSpace(link))
+	if link == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.String()) > MaxURLLength {
+		return ""
+	}
+	return u.String()
+}
+func clip(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+func firstText(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
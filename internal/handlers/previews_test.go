@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::":    true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"64:ff9b::a00:1":       false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::ffff:93.184.216.34": true,
+	} {
+		if got := PublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s: got %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// previewSite serves pages to unfurl on the loopback address.
+func previewSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	page := func(path, contentType, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("User-Agent") != PreviewAgent {
+				t.Errorf("%s fetched as %q", path, r.Header.Get("User-Agent"))
+			}
+			w.Header().Set("Content-Type", contentType)
+			fmt.Fprint(w, body)
+		})
+	}
+	page("/og", "text/html; charset=utf-8", `<html><head><title>Plain title</title>
+<meta name="twitter:title" content="Twitter title">
+<meta property="og:title" content="  Open   Graph title ">
+<meta name="description" content="Plain description">
+<meta property="og:description" content="OG description">
+<meta property="og:image" content="/cover.png">
+<meta property="og:site_name" content="Example">
+</head><body><meta property="og:title" content="Too late"></body></html>`)
+	page("/embed", "text/html", `<head><title>Embedded</title><link rel="alternate" type="application/json+oembed" href="/oembed.json"></head>`)
+	page("/oembed.json", "application/json", `{"title": "oEmbed title", "provider_name": "Tube", "thumbnail_url": "https://img.example/thumb.jpg"}`)
+	page("/title", "text/html", `<title>Only a title</title><meta property="og:image" content="javascript:alert(1)">`)
+	page("/blank", "text/html", `<html><body>Nothing to say</body></html>`)
+	page("/image.png", "image/png", "\x89PNG")
+	page("/long", "text/html", "<head><title>"+strings.Repeat("word ", 200)+"</title></head>")
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/og", http.StatusFound) })
+	mux.HandleFunc("/ftp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://example.com/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestUnfurl reads previews from Open Graph tags, oEmbed and titles, stores
+// nothing for pages that say nothing, and refuses what is not a page.
+func TestUnfurl(t *testing.T) {
+	newServer(t)
+	site := previewSite(t)
+	cfg := PreviewConfig{Enabled: true, Timeout: 5 * time.Second, MaxBytes: 1 << 20, AllowPrivate: true}
+	c := context.Background()
+	unfurl := func(path string) (*models.LinkPreview, error) {
+		t.Helper()
+		id := models.IDs{TopicID: "golang", PostID: strings.Trim(path, "/.")}
+		if err := Unfurl(c, cfg, id, site.URL+path); err != nil {
+			return nil, err
+		}
+		previews, err := store.Find(c, Store, models.LinkPreview{TopicID: id.TopicID, PostID: id.PostID})
+		if err != nil || len(previews) == 0 {
+			return nil, err
+		}
+		return &previews[0], nil
+	}
+	for path, want := range map[string]models.LinkPreview{
+		"/og":    {Title: "Open Graph title", Description: "OG description", ImageURL: site.URL + "/cover.png", SiteName: "Example"},
+		"/moved": {Title: "Open Graph title", Description: "OG description", ImageURL: site.URL + "/cover.png", SiteName: "Example"},
+		"/embed": {Title: "oEmbed title", ImageURL: "https://img.example/thumb.jpg", SiteName: "Tube"},
+		"/title": {Title: "Only a title"},
+	} {
+		got, err := unfurl(path)
+		if err != nil || got == nil {
+			t.Errorf("%s: got %+v, %v", path, got, err)
+			continue
+		}
+		if got.Title != want.Title || got.Description != want.Description || got.ImageURL != want.ImageURL || got.SiteName != want.SiteName || got.URL != site.URL+path {
+			t.Errorf("%s: got %+v, want %+v", path, got, want)
+		}
+	}
+	if got, err := unfurl("/long"); err != nil || got == nil || len([]rune(got.Title)) != 300 || !strings.HasSuffix(got.Title, "…") {
+		t.Errorf("/long: got %+v, %v", got, err)
+	}
+	if got, err := unfurl("/blank"); err != nil || got != nil {
+		t.Errorf("/blank: got %+v, %v; want no preview", got, err)
+	}
+	for _, path := range []string{"/image.png", "/missing", "/ftp"} {
+		if _, err := unfurl(path); err == nil {
+			t.Errorf("%s: unfurled", path)
+		}
+	}
+
+	cfg.AllowPrivate = false
+	if _, err := unfurl("/og"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("a loopback address with private addresses refused: got %v", err)
+	}
+}
+
+// TestPreviews unfurls a link post created through the API in the
+// background and shows its preview in the listing, on the post page and in
+// the v1 post, until the post is purged.
+func TestPreviews(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	site := previewSite(t)
+	Previews = PreviewConfig{Enabled: true, Timeout: 5 * time.Second, MaxBytes: 1 << 20, AllowPrivate: true}
+	_, token := newUser(t, "alice")
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+	var post models.Post
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", token, map[string]any{"model": map[string]any{"title": "Read this", "url": site.URL + "/og"}}, &post); rec.Code != http.StatusCreated {
+		t.Fatalf("create a link post: %d %s", rec.Code, rec.Body)
+	}
+	c := context.Background()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if n, err := Store.Count(c, &models.LinkPreview{}, &models.LinkPreview{TopicID: "golang", PostID: post.ID}); err != nil || n == 1 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("the preview was not fetched")
+		}
+	}
+
+	var got models.Post
+	if call(t, e, http.MethodGet, "/v1/topics/golang/posts/"+post.ID, "", nil, &got); got.Preview == nil || got.Preview.Title != "Open Graph title" {
+		t.Errorf("the v1 post: got preview %+v", got.Preview)
+	}
+	var page models.ListResponse[models.Post]
+	if call(t, e, http.MethodGet, "/v1/topics/golang/posts", "", nil, &page); len(page.Items) != 1 || page.Items[0].Preview == nil {
+		t.Errorf("the listing: got %+v", page.Items)
+	}
+	want := `<a href="` + site.URL + `/og" rel="nofollow noopener noreferrer" target="_blank">Open Graph title</a> <small>Example</small>`
+	for _, path := range []string{"/topics/golang", "/topics/golang/posts/" + post.ID} {
+		if body := get(e, path).Body.String(); !strings.Contains(body, want) {
+			t.Errorf("%s lacks the preview: %s", path, body)
+		}
+	}
+
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/posts/"+post.ID, token, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete the post: %d", rec.Code)
+	}
+	if _, _, err := Purge(c, time.Now().Add(time.Minute), false); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Store.Count(c, &models.LinkPreview{}, &models.LinkPreview{}); err != nil || n != 0 {
+		t.Errorf("previews after the purge: got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type UserRequest struct {
+	models.PageRequest
+	Username string `param:"username"`
+	Show     string `query:"show"`
+	// IncludeNSFW is as for ListRequest.
+	IncludeNSFW bool `query:"include_nsfw"`
+}
+
+// Profile is a user's page, listing either their posts or their comments.
+type Profile struct {
+	User     *models.User                         `json:"user"`
+	Show     string                               `json:"show"`
+	Blocked  bool                                 `json:"blocked"`
+	Posts    *models.ListResponse[models.Post]    `json:"posts,omitempty"`
+	Comments *models.ListResponse[models.Comment] `json:"comments,omitempty"`
+}
+
+// UserByName looks a user up by username, treating names that could never
+// have been registered as not found.
+func UserByName(c context.Context, username string) (*models.User, error) {
+	if !ValidUsername(username) {
+		return nil, store.ErrNotFound
+	}
+	return store.Get(c, Store, models.User{Username: username})
+}
+func UserPosts(c context.Context, req UserRequest) (*models.ListResponse[models.Post], error) {
+	user, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	return store.List(c, Store, models.Post{AuthorID: user.ID}, req.PageRequest, store.Preload("Author", "Flair"), store.OrderBy("created_at DESC"), SafeForWork(req.IncludeNSFW), Visible(c))
+}
+func UserComments(c context.Context, req UserRequest) (*models.ListResponse[models.Comment], error) {
+	user, err := UserByName(c, req.Username)
+	if err != nil {
+		return nil, err
+	}
+	return store.List(c, Store, models.Comment{AuthorID: user.ID}, req.PageRequest, store.Preload("Author"), store.OrderBy("created_at DESC"), Visible(c))
+}
+func HandleProfile(c echo.Context) error {
+	var req UserRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	user, err := UserByName(c.Request().Context(), req.Username)
+	if err != nil {
+		return Fail(c, err)
+	}
+	profile := Profile{User: user, Show: "posts"}
+	if viewer := CurrentUser(c.Request().Context()); viewer != nil {
+		if profile.Blocked, err = HasBlocked(c.Request().Context(), Store, viewer.ID, user.ID); err != nil {
+			return Fail(c, err)
+		}
+	}
+	if req.Show == "comments" {
+		profile.Show = "comments"
+		profile.Comments, err = UserComments(c.Request().Context(), req)
+	} else {
+		req.IncludeNSFW = true
+		profile.Posts, err = UserPosts(c.Request().Context(), req)
+	}
+	if err != nil {
+		return Fail(c, err)
+	}
+	if profile.Comments != nil {
+		profile.Comments.Link(c.Request().URL)
+	} else {
+		profile.Posts.Link(c.Request().URL)
+	}
+	return c.Render(http.StatusOK, "profile", profile)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestProfile lists a user's posts and comments over v1 and on their page.
+func TestProfile(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, _ := newUser(t, "alice")
+	bob, _ := newUser(t, "bob")
+	now := time.Now()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1", CreatedAt: now.Add(-2 * time.Hour)}, TopicID: "golang", AuthorID: alice.ID, Title: "First"},
+		&models.Post{Model: models.Model{ID: "p2", CreatedAt: now.Add(-time.Hour)}, TopicID: "golang", AuthorID: alice.ID, Title: "Second"},
+		&models.Post{Model: models.Model{ID: "p3", CreatedAt: now}, TopicID: "golang", AuthorID: bob.ID, Title: "Bob's"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p3", AuthorID: alice.ID, Content: "Nice"},
+		&models.User{Model: models.Model{ID: "ghost"}},
+	)
+
+	var posts models.ListResponse[models.Post]
+	call(t, e, http.MethodGet, "/v1/users/alice/posts", "", nil, &posts)
+	var titles []string
+	for _, post := range posts.Items {
+		titles = append(titles, post.Title)
+	}
+	if fmt.Sprint(titles) != "[Second First]" || posts.Items[0].Author == nil || posts.Items[0].Author.Username != "alice" {
+		t.Errorf("alice's posts: got %v", titles)
+	}
+	call(t, e, http.MethodGet, "/v1/users/alice/posts?limit=1&offset=1", "", nil, &posts)
+	if len(posts.Items) != 1 || posts.Items[0].Title != "First" || posts.Total != 2 {
+		t.Errorf("second page of alice's posts: got %+v", posts)
+	}
+	var comments models.ListResponse[models.Comment]
+	call(t, e, http.MethodGet, "/v1/users/alice/comments", "", nil, &comments)
+	if len(comments.Items) != 1 || comments.Items[0].Content != "Nice" {
+		t.Errorf("alice's comments: got %+v", comments.Items)
+	}
+	for _, path := range []string{"/v1/users/nobody/posts", "/v1/users/a/comments", "/u/nobody"} {
+		if rec := call(t, e, http.MethodGet, path, "", nil, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, rec.Code)
+		}
+	}
+	if _, err := UserByName(context.Background(), ""); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("an empty username found a user without one: %v", err)
+	}
+
+	for path, want := range map[string][]string{
+		"/u/alice":               {"Second", "First"},
+		"/u/alice?show=comments": {"Nice"},
+	} {
+		rec := get(e, path)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: got %d", path, rec.Code)
+			continue
+		}
+		for _, text := range want {
+			if !strings.Contains(rec.Body.String(), text) {
+				t.Errorf("%s lacks %q", path, text)
+			}
+		}
+		if strings.Contains(rec.Body.String(), "Bob&#39;s") {
+			t.Errorf("%s lists bob's post", path)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// PurgeConfig has deleted posts and comments removed for good once they
+// have been deleted for longer than Retention, checking every Interval. A
+// zero Retention keeps them forever. DryRun only counts what would go.
+type PurgeConfig struct {
+	Retention time.Duration `yaml:"retention"`
+	Interval  time.Duration `yaml:"interval"`
+	DryRun    bool          `yaml:"dryRun"`
+}
+
+// PurgeStats counts the posts and comments the purge job has removed since
+// the server started. In a dry run they count what the last run would have
+// removed instead.
+type PurgeStats struct {
+	Runs      int64     `json:"runs"`
+	LastRun   time.Time `json:"lastRun"`
+	LastError string    `json:"lastError,omitempty"`
+	DryRun    bool      `json:"dryRun"`
+	Posts     int64     `json:"posts"`
+	Comments  int64     `json:"comments"`
+}
+
+var purgeMu sync.Mutex
+var purgeStats PurgeStats
+
+// Purge removes the posts and comments deleted before cutoff for good,
+// along with everything under those posts and the votes, saves, reports and
+// notifications pointing at either, and returns how many went.
+func Purge(c context.Context, cutoff time.Time, dryRun bool) (posts int64, comments int64, err error) {
+	old := []store.Scope{store.Deleted(), store.Where("deleted_at", "<", cutoff)}
+	purgeableComments, err := store.Find(c, Store, models.Comment{}, append(old, store.Select("id", "topic_id", "post_id"))...)
+	if err != nil {
+		return 0, 0, err
+	}
+	purgeable, err := store.Find(c, Store, models.Post{}, old...)
+	if err != nil || dryRun {
+		return int64(len(purgeable)), int64(len(purgeableComments)), err
+	}
+	for _, comment := range purgeableComments {
+		err := Store.Transaction(c, func(tx store.Store) error {
+			if err := purgeDependents(c, tx, comment.TopicID, comment.PostID, comment.ID); err != nil {
+				return err
+			}
+			_, err := store.Delete(c, tx, models.Comment{Model: models.Model{ID: comment.ID}, TopicID: comment.TopicID, PostID: comment.PostID}, store.Unscoped())
+			return err
+		})
+		if err != nil {
+			return posts, comments, err
+		}
+		comments++
+	}
+	for _, post := range purgeable {
+		err := Store.Transaction(c, func(tx store.Store) error {
+			under, err := tx.Count(c, &models.Comment{}, &models.Comment{TopicID: post.TopicID, PostID: post.ID}, store.Unscoped())
+			if err != nil {
+				return err
+			}
+			if err := purgeDependents(c, tx, post.TopicID, post.ID, ""); err != nil {
+				return err
+			}
+			if _, err := store.Delete(c, tx, models.HiddenPost{TopicID: post.TopicID, PostID: post.ID}); err != nil {
+				return err
+			}
+			if _, err := store.Delete(c, tx, models.Comment{TopicID: post.TopicID, PostID: post.ID}, store.Unscoped()); err != nil {
+				return err
+			}
+			if _, err := store.Delete(c, tx, models.PostRevision{TopicID: post.TopicID, PostID: post.ID}, store.Unscoped()); err != nil {
+				return err
+			}
+			if _, err := store.Delete(c, tx, models.LinkPreview{TopicID: post.TopicID, PostID: post.ID}); err != nil {
+				return err
+			}
+			if _, err := store.Delete(c, tx, models.PollOption{TopicID: post.TopicID, PostID: post.ID}); err != nil {
+				return err
+			}
+			if _, err := store.Delete(c, tx, models.PollVote{TopicID: post.TopicID, PostID: post.ID}); err != nil {
+				return err
+			}
+			if _, err := store.Delete(c, tx, models.Post{Model: models.Model{ID: post.ID}, TopicID: post.TopicID}, store.Unscoped()); err != nil {
+				return err
+			}
+			comments += under
+			return nil
+		})
+		if err != nil {
+			return posts, comments, err
+		}
+		posts++
+	}
+	return posts, comments, nil
+}
+
+// purgeDependents removes the votes, saves, reports, archived reports and
+// notifications of a post and its comments, or of just one comment when
+// commentID is set. The mod log keeps its entries about them.
+func purgeDependents(c context.Context, tx store.Store, topicID string, postID string, commentID string) error {
+	if _, err := store.Delete(c, tx, models.Vote{TopicID: topicID, PostID: postID, CommentID: commentID}); err != nil {
+		return err
+	}
+	if _, err := store.Delete(c, tx, models.Saved{TopicID: topicID, PostID: postID, CommentID: commentID}); err != nil {
+		return err
+	}
+	if _, err := store.Delete(c, tx, models.Report{TopicID: topicID, PostID: postID, CommentID: commentID}, store.Unscoped()); err != nil {
+		return err
+	}
+	if _, err := store.Delete(c, tx, models.ArchivedReport{TopicID: topicID, PostID: postID, CommentID: commentID}, store.Unscoped()); err != nil {
+		return err
+	}
+	_, err := store.Delete(c, tx, models.Notification{TopicID: topicID, PostID: postID, CommentID: commentID}, store.Unscoped())
+	return err
+}
+
+// RunPurger purges on the configured schedule until the context ends.
+func RunPurger(c context.Context, cfg PurgeConfig) {
+	if cfg.Retention <= 0 {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		posts, comments, err := Purge(c, time.Now().Add(-cfg.Retention), cfg.DryRun)
+		purgeMu.Lock()
+		purgeStats.Runs++
+		purgeStats.LastRun, purgeStats.DryRun, purgeStats.LastError = time.Now(), cfg.DryRun, ""
+		if cfg.DryRun {
+			purgeStats.Posts, purgeStats.Comments = posts, comments
+		} else {
+			purgeStats.Posts += posts
+			purgeStats.Comments += comments
+		}
+		if err != nil {
+			purgeStats.LastError = err.Error()
+		}
+		purgeMu.Unlock()
+		switch {
+		case err != nil:
+			slog.Error("purge failed", "error", err)
+		case posts == 0 && comments == 0:
+		case cfg.DryRun:
+			slog.Info("purge dry run", "posts", posts, "comments", comments, "retention", cfg.Retention)
+		default:
+			slog.Info("purged deleted content", "posts", posts, "comments", comments, "retention", cfg.Retention)
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeStatus reports the purge job's counters to site admins.
+func PurgeStatus(c context.Context, _ struct{}) (*PurgeStats, error) {
+	if err := Administer(c); err != nil {
+		return nil, err
+	}
+	purgeMu.Lock()
+	defer purgeMu.Unlock()
+	stats := purgeStats
+	return &stats, nil
+}
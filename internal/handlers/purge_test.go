@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestPurge purges a post and comments deleted long ago, and checks that
+// live content and recently deleted content stay.
+func TestPurge(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			saved := Store
+			t.Cleanup(func() { Store = saved })
+			Store = s
+			testPurge(t)
+		})
+	}
+}
+
+func testPurge(t *testing.T) {
+	c := context.Background()
+	create := func(obj any) {
+		t.Helper()
+		if err := Store.Create(c, obj); err != nil {
+			t.Fatalf("create %T: %v", obj, err)
+		}
+	}
+	create(&models.User{Model: models.Model{ID: "u1"}, Username: "alice"})
+	create(&models.Topic{Model: models.Model{ID: "golang"}})
+	// "gone" was deleted 60 days ago and "recent" yesterday; the rest is live.
+	model := func(id string) models.Model {
+		switch id {
+		case "gone", "live-gone":
+			return models.Model{ID: id, DeletedAt: gorm.DeletedAt{Time: time.Now().Add(-60 * 24 * time.Hour), Valid: true}}
+		case "recent", "live-recent":
+			return models.Model{ID: id, DeletedAt: gorm.DeletedAt{Time: time.Now().Add(-24 * time.Hour), Valid: true}}
+		}
+		return models.Model{ID: id}
+	}
+	for _, post := range []string{"gone", "recent", "live"} {
+		create(&models.Post{Model: model(post), TopicID: "golang", AuthorID: "u1", Title: post})
+		create(&models.PostRevision{Model: models.Model{ID: "revision-" + post}, TopicID: "golang", PostID: post, EditorID: "u1", Title: post})
+	}
+	for _, comment := range []string{"gone", "recent", "live"} {
+		create(&models.Comment{Model: model("live-" + comment), TopicID: "golang", PostID: "live", AuthorID: "u1", Content: comment})
+	}
+	create(&models.Comment{Model: models.Model{ID: "gone-live"}, TopicID: "golang", PostID: "gone", AuthorID: "u1"})
+
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+	if posts, comments, err := Purge(c, cutoff, true); err != nil || posts != 1 || comments != 1 {
+		t.Errorf("dry run: got %d posts and %d comments, %v; want 1 and 1", posts, comments, err)
+	}
+	count := func(model any) int64 {
+		t.Helper()
+		n, err := Store.Count(c, model, model, store.Unscoped())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(&models.Comment{}); n != 4 {
+		t.Errorf("comments after the dry run: got %d, want 4", n)
+	}
+	if posts, comments, err := Purge(c, cutoff, false); err != nil || posts != 1 || comments != 2 {
+		t.Errorf("purge: got %d posts and %d comments, %v; want 1 and 2", posts, comments, err)
+	}
+	for _, tc := range []struct {
+		what  string
+		model any
+		want  int64
+	}{
+		{"posts", &models.Post{}, 2},
+		{"comments", &models.Comment{}, 2},
+		{"revisions", &models.PostRevision{}, 2},
+		{"the purged post", &models.Post{Model: models.Model{ID: "gone"}}, 0},
+		{"the purged post's revisions", &models.PostRevision{PostID: "gone"}, 0},
+		{"the recently deleted comment", &models.Comment{Model: models.Model{ID: "live-recent"}}, 1},
+	} {
+		if got := count(tc.model); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.what, got, tc.want)
+		}
+	}
+	if posts, comments, err := Purge(c, cutoff, false); err != nil || posts != 0 || comments != 0 {
+		t.Errorf("purge again: got %d posts and %d comments, %v", posts, comments, err)
+	}
+}
+
+// TestPurgeRelated purges a post and a comment deleted long ago and checks the
+// rows pointing at them went too, but not those of live content or the
+// mod log.
+func TestPurgeRelated(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			saved := Store
+			t.Cleanup(func() { Store = saved })
+			Store = s
+			testPurgeRelated(t)
+		})
+	}
+}
+
+func testPurgeRelated(t *testing.T) {
+	c := context.Background()
+	create := func(obj any) {
+		t.Helper()
+		if err := Store.Create(c, obj); err != nil {
+			t.Fatalf("create %T: %v", obj, err)
+		}
+	}
+	create(&models.User{Model: models.Model{ID: "u1"}, Username: "alice"})
+	create(&models.User{Model: models.Model{ID: "u2"}, Username: "bob"})
+	create(&models.Topic{Model: models.Model{ID: "golang"}})
+	// Content is created already deleted, 60 days ago; the rest is live.
+	deleted := func(id string) models.Model {
+		if id != "gone" && id != "live-gone" {
+			return models.Model{ID: id}
+		}
+		return models.Model{ID: id, DeletedAt: gorm.DeletedAt{Time: time.Now().Add(-60 * 24 * time.Hour), Valid: true}}
+	}
+	for _, post := range []string{"gone", "live"} {
+		create(&models.Post{Model: deleted(post), TopicID: "golang", AuthorID: "u1", Title: post})
+		create(&models.Vote{UserID: "u2", TopicID: "golang", PostID: post, Value: 1})
+		create(&models.Saved{UserID: "u2", TopicID: "golang", PostID: post})
+		create(&models.HiddenPost{UserID: "u2", TopicID: "golang", PostID: post})
+		create(&models.Report{Model: models.Model{ID: "report-" + post}, TopicID: "golang", PostID: post, ReporterID: "u2"})
+		create(&models.ArchivedReport{Model: models.Model{ID: "archived-" + post}, TopicID: "golang", PostID: post, ReporterID: "u1", Status: models.ReportApproved})
+		create(&models.ModAction{Model: models.Model{ID: "action-" + post}, TopicID: "golang", ModeratorID: "u1", Action: models.ModRemove, PostID: post})
+		for _, comment := range []string{"gone", "live"} {
+			id := post + "-" + comment
+			create(&models.Comment{Model: deleted(id), TopicID: "golang", PostID: post, AuthorID: "u2", Content: id})
+			create(&models.Vote{UserID: "u1", TopicID: "golang", PostID: post, CommentID: id, Value: 1})
+			create(&models.Saved{UserID: "u1", TopicID: "golang", PostID: post, CommentID: id})
+			create(&models.Report{Model: models.Model{ID: "report-" + id}, TopicID: "golang", PostID: post, CommentID: id, ReporterID: "u1"})
+			create(&models.ArchivedReport{Model: models.Model{ID: "archived-" + id}, TopicID: "golang", PostID: post, CommentID: id, ReporterID: "u2", Status: models.ReportApproved})
+			create(&models.Notification{Model: models.Model{ID: "notification-" + id}, UserID: "u1", ActorID: "u2", Kind: models.NotifyPostReply, TopicID: "golang", PostID: post, CommentID: id})
+		}
+	}
+	posts, comments, err := Purge(c, time.Now().Add(-30*24*time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posts != 1 || comments != 3 {
+		t.Errorf("purged %d posts and %d comments, want 1 and 3", posts, comments)
+	}
+	count := func(model any, id any) int64 {
+		t.Helper()
+		n, err := Store.Count(c, model, id, store.Unscoped())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	for _, tc := range []struct {
+		what      string
+		model, id any
+		want      int64
+	}{
+		{"comments", &models.Comment{}, &models.Comment{}, 1},
+		{"votes on the purged post", &models.Vote{}, &models.Vote{PostID: "gone"}, 0},
+		{"votes on the live post", &models.Vote{}, &models.Vote{PostID: "live"}, 2},
+		{"votes on the live post's purged comment", &models.Vote{}, &models.Vote{CommentID: "live-gone"}, 0},
+		{"saves", &models.Saved{}, &models.Saved{}, 2},
+		{"saves of the live comment", &models.Saved{}, &models.Saved{CommentID: "live-live"}, 1},
+		{"hidden posts", &models.HiddenPost{}, &models.HiddenPost{}, 1},
+		{"reports", &models.Report{}, &models.Report{}, 2},
+		{"reports of the live comment", &models.Report{}, &models.Report{CommentID: "live-live"}, 1},
+		{"archived reports", &models.ArchivedReport{}, &models.ArchivedReport{}, 2},
+		{"notifications", &models.Notification{}, &models.Notification{}, 1},
+		{"notifications of the live comment", &models.Notification{}, &models.Notification{CommentID: "live-live"}, 1},
+		{"mod actions", &models.ModAction{}, &models.ModAction{}, 2},
+	} {
+		if got := count(tc.model, tc.id); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.what, got, tc.want)
+		}
+	}
+}
+
+// TestPurgeStatus runs the purger once and reads its counters as an admin.
+func TestPurgeStatus(t *testing.T) {
+	e := newServer(t)
+	admins, stats := Admins, purgeStats
+	t.Cleanup(func() { Admins, purgeStats = admins, stats })
+	Admins, purgeStats = []string{"alice"}, PurgeStats{}
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1", DeletedAt: gorm.DeletedAt{Time: time.Now().Add(-2 * time.Hour), Valid: true}}, TopicID: "golang", AuthorID: alice.ID},
+	)
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+	RunPurger(c, PurgeConfig{Retention: time.Hour, DryRun: true})
+
+	for _, tc := range []struct {
+		what, token string
+		want        int
+	}{
+		{"signed out", "", http.StatusUnauthorized},
+		{"as a non-admin", bobToken, http.StatusForbidden},
+		{"as an admin", aliceToken, http.StatusOK},
+	} {
+		var got PurgeStats
+		if rec := call(t, e, http.MethodGet, "/v1/admin/purge", tc.token, nil, &got); rec.Code != tc.want {
+			t.Errorf("purge status %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		} else if rec.Code == http.StatusOK && (got.Runs != 1 || !got.DryRun || got.Posts != 1 || got.LastRun.IsZero()) {
+			t.Errorf("purge status: got %+v", got)
+		}
+	}
+	if n, err := Store.Count(context.Background(), &models.Post{}, &models.Post{}, store.Unscoped()); err != nil || n != 1 {
+		t.Errorf("posts after a dry run: got %d, %v", n, err)
+	}
+}
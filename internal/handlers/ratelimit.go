@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+
+	"reddit-clone/internal/logging"
+)
+
+// RateBudget allows Burst requests at once, refilled evenly over Per. A zero
+// Burst leaves the requests it covers unlimited.
+type RateBudget struct {
+	Burst int           `yaml:"burst"`
+	Per   time.Duration `yaml:"per"`
+}
+
+// Backoff shuts out a client that keeps running out of its budget. Its
+// first rate limited request earns a cooldown of Base, and each one after
+// doubles it up to Max, until it stays out of cooldown for Window. A zero
+// Base or Window leaves clients to their budgets alone.
+type Backoff struct {
+	Base   time.Duration `yaml:"base"`
+	Max    time.Duration `yaml:"max"`
+	Window time.Duration `yaml:"window"`
+}
+
+func (b Backoff) enabled() bool {
+	return b.Base > 0 && b.Window > 0
+}
+
+// cooldown is how long the offense-th rate limited request in a row shuts
+// the client out.
+func (b Backoff) cooldown(offense int) time.Duration {
+	cooldown := b.Base
+	for range offense - 1 {
+		if b.Max > 0 && cooldown >= b.Max {
+			break
+		}
+		cooldown *= 2
+	}
+	if b.Max > 0 && cooldown > b.Max {
+		cooldown = b.Max
+	}
+	return cooldown
+}
+
+type RateLimitConfig struct {
+	Enabled  bool       `yaml:"enabled"`
+	Reads    RateBudget `yaml:"reads"`
+	Writes   RateBudget `yaml:"writes"`
+	Votes    RateBudget `yaml:"votes"`
+	Exports  RateBudget `yaml:"exports"`
+	Backoff  Backoff    `yaml:"backoff"`
+	Brigades Brigades   `yaml:"brigades"`
+}
+
+// Limiter takes a token from the bucket named by key and returns how long
+// the caller has to wait for one when the bucket is empty. Offend records
+// that actor was rate limited and returns the cooldown it earned, and
+// Cooldown how much of it is left.
+type Limiter interface {
+	Allow(key string, budget RateBudget) (time.Duration, error)
+	Offend(actor string, backoff Backoff) (time.Duration, error)
+	Cooldown(actor string) (time.Duration, error)
+}
+
+var ErrRateLimited = NewError(TooManyRequests, "rate_limited", "too many requests, retry later")
+var RateLimits RateLimitConfig
+var RateLimiter Limiter
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	per    time.Duration
+}
+
+// offense counts an actor's rate limited requests in a row, which are
+// forgotten once it has been out of cooldown for window.
+type offense struct {
+	count  int
+	ends   time.Time
+	window time.Duration
+}
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	offenses map[string]*offense
+	swept    time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: map[string]*bucket{}, offenses: map[string]*offense{}, swept: time.Now()}
+}
+func (l *MemoryLimiter) Allow(key string, budget RateBudget) (time.Duration, error) {
+	if budget.Burst <= 0 || budget.Per <= 0 {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > time.Minute {
+		// A bucket idle for a whole period is full again, so forgetting it changes nothing.
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= b.per {
+				delete(l.buckets, k)
+			}
+		}
+		for actor, o := range l.offenses {
+			if now.Sub(o.ends) >= o.window {
+				delete(l.offenses, actor)
+			}
+		}
+		l.swept = now
+	}
+	rate := float64(budget.Burst) / budget.Per.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(budget.Burst), last: now, per: budget.Per}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(budget.Burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second)), nil
+	}
+	b.tokens--
+	return 0, nil
+}
+func (l *MemoryLimiter) Offend(actor string, backoff Backoff) (time.Duration, error) {
+	if !backoff.enabled() {
+		return 0, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	o, ok := l.offenses[actor]
+	if !ok || now.Sub(o.ends) >= o.window {
+		o = &offense{}
+		l.offenses[actor] = o
+	}
+	o.count++
+	cooldown := backoff.cooldown(o.count)
+	o.ends, o.window = now.Add(cooldown), backoff.Window
+	return cooldown, nil
+}
+func (l *MemoryLimiter) Cooldown(actor string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if o, ok := l.offenses[actor]; ok {
+		return max(0, time.Until(o.ends)), nil
+	}
+	return 0, nil
+}
+
+// RedisLimiter keeps the buckets in Redis so every replica draws from the
+// same ones. A script refills and spends a bucket in one step, on the
+// clock of the Redis server, and lets it expire once idle long enough to
+// be full again.
+type RedisLimiter struct {
+	client *redis.Client
+	prefix string
+}
+
+var allowScript = redis.NewScript(`
+local burst, rate = tonumber(ARGV[1]), tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1e6
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = math.min(burst, (tonumber(bucket[1]) or burst) + math.max(0, now - (tonumber(bucket[2]) or now)) * rate)
+local wait = 0
+if tokens < 1 then
+	wait = (1 - tokens) / rate
+else
+	tokens = tokens - 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return tostring(wait)
+`)
+
+// offendScript counts an offense in milliseconds on the Redis clock,
+// starting over when the last cooldown ended a window ago, and keeps the
+// count until then.
+var offendScript = redis.NewScript(`
+local base, cap, window = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local offense = redis.call('HMGET', KEYS[1], 'count', 'ends')
+local count = tonumber(offense[1]) or 0
+if now - (tonumber(offense[2]) or now) >= window then
+	count = 0
+end
+count = count + 1
+local cooldown = base
+for i = 2, count do
+	if cap > 0 and cooldown >= cap then
+		break
+	end
+	cooldown = cooldown * 2
+end
+if cap > 0 and cooldown > cap then
+	cooldown = cap
+end
+redis.call('HSET', KEYS[1], 'count', count, 'ends', now + cooldown)
+redis.call('PEXPIRE', KEYS[1], cooldown + window)
+return cooldown
+`)
+
+var cooldownScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local ends = tonumber(redis.call('HGET', KEYS[1], 'ends')) or now
+return math.max(0, ends - now)
+`)
+
+func NewRedisLimiter(client *redis.Client, prefix string) *RedisLimiter {
+	return &RedisLimiter{client: client, prefix: prefix}
+}
+func (l *RedisLimiter) Allow(key string, budget RateBudget) (time.Duration, error) {
+	if budget.Burst <= 0 || budget.Per <= 0 {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	rate := float64(budget.Burst) / budget.Per.Seconds()
+	reply, err := allowScript.Run(ctx, l.client, []string{l.prefix + "ratelimit:" + key}, budget.Burst, rate, budget.Per.Milliseconds()).Text()
+	if err != nil {
+		return 0, err
+	}
+	wait, err := strconv.ParseFloat(reply, 64)
+	return time.Duration(wait * float64(time.Second)), err
+}
+func (l *RedisLimiter) Offend(actor string, backoff Backoff) (time.Duration, error) {
+	if !backoff.enabled() {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	cooldown, err := offendScript.Run(ctx, l.client, []string{l.prefix + "backoff:" + actor}, backoff.Base.Milliseconds(), backoff.Max.Milliseconds(), backoff.Window.Milliseconds()).Int64()
+	return time.Duration(cooldown) * time.Millisecond, err
+}
+func (l *RedisLimiter) Cooldown(actor string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	left, err := cooldownScript.Run(ctx, l.client, []string{l.prefix + "backoff:" + actor}).Int64()
+	return time.Duration(left) * time.Millisecond, err
+}
+
+// RateLimit spends a token from the caller's bucket for the kind of request,
+// keyed on the signed in user or else the client IP, so it has to run after
+// the middleware that authenticates the request. With a backoff, a caller
+// in cooldown is turned away from every kind of request, and each request
+// it runs out of budget for lengthens its next cooldown.
+func RateLimit(skip func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if RateLimiter == nil || !RateLimits.Enabled || (skip != nil && skip(c)) {
+				return next(c)
+			}
+			kind, budget := "read", RateLimits.Reads
+			if strings.HasSuffix(c.Path(), "/upvote") || strings.HasSuffix(c.Path(), "/downvote") {
+				kind, budget = "vote", RateLimits.Votes
+			} else if strings.HasSuffix(c.Path(), "/export") {
+				kind, budget = "export", RateLimits.Exports
+			} else if m := c.Request().Method; m != http.MethodGet && m != http.MethodHead && m != http.MethodOptions {
+				kind, budget = "write", RateLimits.Writes
+			}
+			actor := "ip:" + c.RealIP()
+			if user := CurrentUser(c.Request().Context()); user != nil {
+				actor = "user:" + user.ID
+			}
+			backoff := RateLimits.Backoff
+			var wait time.Duration
+			var err error
+			if backoff.enabled() {
+				wait, err = RateLimiter.Cooldown(actor)
+			}
+			if err == nil && wait == 0 {
+				wait, err = RateLimiter.Allow(kind+":"+actor, budget)
+				if err == nil && wait > 0 {
+					var cooldown time.Duration
+					cooldown, err = RateLimiter.Offend(actor, backoff)
+					wait = max(wait, cooldown)
+				}
+			}
+			if err != nil {
+				logging.FromContext(c.Request().Context()).Error("rate limiter failed", "error", err)
+				return next(c)
+			}
+			if wait > 0 {
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				return Fail(c, ErrRateLimited)
+			}
+			return next(c)
+		}
+	}
+}
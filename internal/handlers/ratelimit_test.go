@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	l := NewMemoryLimiter()
+	budget := RateBudget{Burst: 2, Per: time.Second}
+	for i := range 2 {
+		if wait, err := l.Allow("a", budget); err != nil || wait != 0 {
+			t.Fatalf("request %d within the burst: waited %v, %v", i+1, wait, err)
+		}
+	}
+	wait, err := l.Allow("a", budget)
+	if err != nil || wait <= 0 || wait > time.Second/2 {
+		t.Errorf("request past the burst: got wait %v, %v, want up to half a second", wait, err)
+	}
+	if wait, _ := l.Allow("b", budget); wait != 0 {
+		t.Errorf("another key shares the bucket: waited %v", wait)
+	}
+	time.Sleep(wait)
+	if wait, _ := l.Allow("a", budget); wait != 0 {
+		t.Errorf("after waiting for the refill: waited %v", wait)
+	}
+	if wait, _ := l.Allow("a", RateBudget{}); wait != 0 {
+		t.Errorf("an empty budget limited the request: waited %v", wait)
+	}
+}
+
+// TestMemoryLimiterBackoff offends repeatedly and checks each cooldown is
+// twice the last up to the cap, and that a quiet window starts over.
+func TestMemoryLimiterBackoff(t *testing.T) {
+	l := NewMemoryLimiter()
+	backoff := Backoff{Base: 10 * time.Millisecond, Max: 40 * time.Millisecond, Window: 50 * time.Millisecond}
+	for i, want := range []time.Duration{10, 20, 40, 40} {
+		if cooldown, err := l.Offend("ip:192.0.2.1", backoff); err != nil || cooldown != want*time.Millisecond {
+			t.Errorf("offense %d: got %v, %v, want %v", i+1, cooldown, err, want*time.Millisecond)
+		}
+	}
+	if left, _ := l.Cooldown("ip:192.0.2.1"); left <= 0 || left > 40*time.Millisecond {
+		t.Errorf("cooldown after the offenses: got %v, want up to 40ms", left)
+	}
+	if left, _ := l.Cooldown("ip:192.0.2.2"); left != 0 {
+		t.Errorf("another client's cooldown: got %v", left)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if left, _ := l.Cooldown("ip:192.0.2.1"); left != 0 {
+		t.Errorf("cooldown once it is over: got %v", left)
+	}
+	if cooldown, _ := l.Offend("ip:192.0.2.1", backoff); cooldown != 40*time.Millisecond {
+		t.Errorf("offense within the window: got %v, want 40ms", cooldown)
+	}
+	time.Sleep(40*time.Millisecond + backoff.Window)
+	if cooldown, _ := l.Offend("ip:192.0.2.1", backoff); cooldown != 10*time.Millisecond {
+		t.Errorf("offense after a quiet window: got %v, want 10ms", cooldown)
+	}
+	if cooldown, _ := l.Offend("ip:192.0.2.1", Backoff{}); cooldown != 0 {
+		t.Errorf("offense without a backoff: got %v", cooldown)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	e := newServer(t)
+	RateLimits = RateLimitConfig{
+		Enabled: true,
+		Reads:   RateBudget{Burst: 2, Per: time.Minute},
+		Writes:  RateBudget{Burst: 1, Per: time.Minute},
+		Votes:   RateBudget{Burst: 1, Per: time.Minute},
+	}
+	RateLimiter = NewMemoryLimiter()
+	_, alice := newUser(t, "alice")
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := call(t, e, http.MethodGet, "/v1/topics", "", nil, nil)
+		if rec.Code != want {
+			t.Errorf("anonymous read %d: got %d, want %d", i+1, rec.Code, want)
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "30" {
+			t.Errorf("Retry-After: got %q, want 30", rec.Header().Get("Retry-After"))
+		}
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics", alice, nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("a signed in read from the same address: got %d, want its own bucket", rec.Code)
+	}
+	topic := map[string]any{"model": map[string]any{"id": "golang"}}
+	if rec := call(t, e, http.MethodPost, "/v1/topics", alice, topic, nil); rec.Code != http.StatusCreated {
+		t.Errorf("first write: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics", alice, topic, nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second write: got %d, want 429", rec.Code)
+	}
+	if rec := postForm(e, "/topics/golang/posts/missing/upvote", nil); rec.Code == http.StatusTooManyRequests {
+		t.Error("a vote was charged to the spent write budget")
+	}
+	if rec := postForm(e, "/topics/golang/posts/missing/upvote", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second vote: got %d, want 429", rec.Code)
+	}
+
+	RateLimits.Enabled = false
+	if rec := call(t, e, http.MethodGet, "/v1/topics", "", nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("read with limiting off: got %d", rec.Code)
+	}
+}
+
+func TestRedisLimiter(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	limiter := NewRedisLimiter(client, "test:")
+	budget := RateBudget{Burst: 3, Per: time.Minute}
+	for i := range 5 {
+		wait, err := limiter.Allow("write:ip:192.0.2.1", budget)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed := wait == 0; allowed != (i < 3) {
+			t.Errorf("request %d: got wait %v", i+1, wait)
+		} else if !allowed && (wait <= 0 || wait > 20*time.Second) {
+			t.Errorf("request %d: got wait %v, want up to the 20s one token takes", i+1, wait)
+		}
+	}
+	if wait, err := limiter.Allow("write:ip:192.0.2.2", budget); err != nil || wait != 0 {
+		t.Errorf("another client: got wait %v, %v", wait, err)
+	}
+	if wait, err := limiter.Allow("write:ip:192.0.2.1", RateBudget{}); err != nil || wait != 0 {
+		t.Errorf("an empty budget limited the request: waited %v, %v", wait, err)
+	}
+	if ttl := server.TTL("test:ratelimit:write:ip:192.0.2.1"); ttl != time.Minute {
+		t.Errorf("bucket expires in %v, want a minute", ttl)
+	}
+	server.Close()
+	if _, err := limiter.Allow("write:ip:192.0.2.1", budget); err == nil {
+		t.Error("allowed a request with Redis gone")
+	}
+}
+
+// TestRedisLimiterBackoff offends on the Redis clock, which the test moves
+// past cooldowns and windows.
+func TestRedisLimiterBackoff(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	limiter := NewRedisLimiter(client, "test:")
+	now := time.Now()
+	server.SetTime(now)
+	backoff := Backoff{Base: time.Minute, Max: 4 * time.Minute, Window: time.Hour}
+	for i, want := range []time.Duration{1, 2, 4, 4} {
+		if cooldown, err := limiter.Offend("user:u1", backoff); err != nil || cooldown != want*time.Minute {
+			t.Errorf("offense %d: got %v, %v, want %v", i+1, cooldown, err, want*time.Minute)
+		}
+	}
+	if left, err := limiter.Cooldown("user:u1"); err != nil || left != 4*time.Minute {
+		t.Errorf("cooldown after the offenses: got %v, %v, want 4m", left, err)
+	}
+	if left, err := limiter.Cooldown("user:u2"); err != nil || left != 0 {
+		t.Errorf("another client's cooldown: got %v, %v", left, err)
+	}
+	if ttl := server.TTL("test:backoff:user:u1"); ttl != 4*time.Minute+time.Hour {
+		t.Errorf("offenses expire in %v, want the cooldown and the window", ttl)
+	}
+	server.SetTime(now.Add(5 * time.Minute))
+	if left, _ := limiter.Cooldown("user:u1"); left != 0 {
+		t.Errorf("cooldown once it is over: got %v", left)
+	}
+	if cooldown, _ := limiter.Offend("user:u1", backoff); cooldown != 4*time.Minute {
+		t.Errorf("offense within the window: got %v, want 4m", cooldown)
+	}
+	server.SetTime(now.Add(5*time.Minute + 4*time.Minute + time.Hour))
+	if cooldown, _ := limiter.Offend("user:u1", backoff); cooldown != time.Minute {
+		t.Errorf("offense after a quiet window: got %v, want 1m", cooldown)
+	}
+}
+
+// TestRateLimitBackoff runs out of a budget through the middleware and
+// checks the client is turned away for longer each time, from every kind
+// of request, until it has been quiet for a window.
+func TestRateLimitBackoff(t *testing.T) {
+	e := newServer(t)
+	RateLimits = RateLimitConfig{
+		Enabled: true,
+		Reads:   RateBudget{Burst: 1, Per: time.Hour},
+		Writes:  RateBudget{Burst: 1, Per: time.Hour},
+		Backoff: Backoff{Base: 2 * time.Hour, Max: 8 * time.Hour, Window: time.Hour},
+	}
+	limiter := NewMemoryLimiter()
+	RateLimiter = limiter
+	user, alice := newUser(t, "alice")
+	// endCooldown moves the client's cooldown to have ended ago.
+	endCooldown := func(ago time.Duration) {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+		limiter.offenses["user:"+user.ID].ends = time.Now().Add(-ago)
+	}
+	read := func() string {
+		t.Helper()
+		rec := call(t, e, http.MethodGet, "/v1/topics", alice, nil, nil)
+		if rec.Code != http.StatusOK && rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("read: got %d", rec.Code)
+		}
+		return rec.Header().Get("Retry-After")
+	}
+	if got := read(); got != "" {
+		t.Fatalf("first read: got Retry-After %q", got)
+	}
+	if got := read(); got != "7200" {
+		t.Errorf("read past the budget: got Retry-After %q, want the 2h base", got)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics", alice, map[string]any{"model": map[string]any{"id": "golang"}}, nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("a write in cooldown: got %d, want 429", rec.Code)
+	}
+	if got := read(); got == "" || got == "14400" {
+		t.Errorf("read in cooldown: got Retry-After %q, want what is left of the first cooldown", got)
+	}
+	for _, want := range []string{"14400", "28800", "28800"} {
+		endCooldown(0)
+		if got := read(); got != want {
+			t.Errorf("read after a cooldown: got Retry-After %q, want %s", got, want)
+		}
+	}
+	endCooldown(time.Hour)
+	if got := read(); got != "7200" {
+		t.Errorf("read after a quiet window: got Retry-After %q, want the 2h base again", got)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics", "", nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("an anonymous read: got %d, want its own cooldown", rec.Code)
+	}
+}
+
+func TestRateLimitIgnoresForwardedFor(t *testing.T) {
+	e := newServer(t)
+	RateLimits = RateLimitConfig{Enabled: true, Writes: RateBudget{Burst: 5, Per: time.Minute}}
+	RateLimiter = NewMemoryLimiter()
+	newUser(t, "alice")
+	var codes []int
+	for i := range 8 {
+		req := httptest.NewRequest(http.MethodPost, "/v1/token", strings.NewReader(`{"username":"alice","password":"wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(i))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	for i, code := range codes {
+		want := http.StatusUnauthorized
+		if i >= 5 {
+			want = http.StatusTooManyRequests
+		}
+		if code != want {
+			t.Errorf("attempt %d: got %d, want %d", i+1, code, want)
+		}
+	}
+}
+
+func TestTrustProxies(t *testing.T) {
+	extract, err := TrustProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		remote, forwarded, want string
+	}{
+		{"10.1.2.3:80", "203.0.113.7", "203.0.113.7"},
+		{"10.1.2.3:80", "198.51.100.1, 203.0.113.7", "203.0.113.7"},
+		{"192.0.2.1:80", "203.0.113.7", "192.0.2.1"},
+		{"127.0.0.1:80", "203.0.113.7", "127.0.0.1"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		req.Header.Set("X-Forwarded-For", tc.forwarded)
+		if got := extract(req); got != tc.want {
+			t.Errorf("%s forwarding %q: got %s, want %s", tc.remote, tc.forwarded, got, tc.want)
+		}
+	}
+	if _, err := TrustProxies([]string{"10.0.0.0"}); err == nil {
+		t.Error("a bare address was accepted as a range")
+	}
+	if got := ClientIP(httptest.NewRequest(http.MethodGet, "/", nil)); got != "192.0.2.1" {
+		t.Errorf("default extractor: got %s", got)
+	}
+}
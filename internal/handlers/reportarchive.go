@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// ReportArchiveConfig has reports moved to the archive once they have been
+// resolved for longer than Age, checking every Interval. A zero Age keeps
+// every report in the queue's table.
+type ReportArchiveConfig struct {
+	Age      time.Duration `yaml:"age"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ReportArchiveBatch is how many reports are moved in each transaction.
+var ReportArchiveBatch = 500
+
+// ArchiveReports moves the reports resolved before cutoff to the archive
+// and returns how many went. A report's last update is its resolution.
+func ArchiveReports(c context.Context, cutoff time.Time) (int64, error) {
+	var archived int64
+	for {
+		reports, err := store.Find(c, Store, models.Report{}, store.Where("status", "<>", models.ReportOpen), store.Where("updated_at", "<", cutoff), store.OrderBy("updated_at", "id"), store.Page(models.PageRequest{Limit: ReportArchiveBatch}))
+		if err != nil || len(reports) == 0 {
+			return archived, err
+		}
+		now := time.Now()
+		err = Store.Transaction(c, func(tx store.Store) error {
+			var ids []string
+			for _, report := range reports {
+				ids = append(ids, report.ID)
+				if err := tx.Create(c, &models.ArchivedReport{Model: report.Model, TopicID: report.TopicID, PostID: report.PostID, CommentID: report.CommentID, ReporterID: report.ReporterID, Reason: report.Reason, Status: report.Status, ResolvedByID: report.ResolvedByID, Held: report.Held, ArchivedAt: now}); err != nil {
+					return err
+				}
+			}
+			_, err := store.Delete(c, tx, models.Report{}, store.Where("id", "IN", ids), store.Unscoped())
+			return err
+		})
+		if err != nil {
+			return archived, err
+		}
+		archived += int64(len(reports))
+		if len(reports) < ReportArchiveBatch {
+			return archived, nil
+		}
+	}
+}
+
+// RunReportArchiver archives reports on the configured schedule until the
+// context ends.
+func RunReportArchiver(c context.Context, cfg ReportArchiveConfig) {
+	if cfg.Age <= 0 {
+		return
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := ArchiveReports(c, time.Now().Add(-cfg.Age)); err != nil {
+			slog.Error("report archival failed", "error", err)
+		} else if n > 0 {
+			slog.Info("archived resolved reports", "reports", n, "age", cfg.Age)
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestArchiveReports archives the reports resolved long enough ago, a
+// batch at a time, and lists them with ?archived=true while open reports
+// stay in the queue.
+func TestArchiveReports(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	batch := ReportArchiveBatch
+	t.Cleanup(func() { ReportArchiveBatch = batch })
+	ReportArchiveBatch = 1
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			e := newServer(t)
+			Store = s
+			testArchiveReports(t, e)
+		})
+	}
+}
+
+func testArchiveReports(t *testing.T, e *echo.Echo) {
+	c := context.Background()
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	longAgo := time.Now().AddDate(0, 0, -100)
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Reported"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: alice.ID, Title: "Reported"},
+		&models.Post{Model: models.Model{ID: "p3"}, TopicID: "golang", AuthorID: alice.ID, Title: "Reported"},
+		&models.Post{Model: models.Model{ID: "r1"}, TopicID: "rust", AuthorID: alice.ID, Title: "Reported"},
+		&models.Report{Model: models.Model{ID: "old", CreatedAt: longAgo, UpdatedAt: longAgo}, TopicID: "golang", PostID: "p1", ReporterID: bob.ID, Status: models.ReportApproved, ResolvedByID: alice.ID},
+		&models.Report{Model: models.Model{ID: "recent", CreatedAt: longAgo, UpdatedAt: time.Now().AddDate(0, 0, -1)}, TopicID: "golang", PostID: "p2", ReporterID: bob.ID, Status: models.ReportRemoved, ResolvedByID: alice.ID},
+		&models.Report{Model: models.Model{ID: "stale", CreatedAt: longAgo, UpdatedAt: longAgo}, TopicID: "golang", PostID: "p3", ReporterID: bob.ID, Status: models.ReportOpen},
+		&models.Report{Model: models.Model{ID: "elsewhere", CreatedAt: longAgo, UpdatedAt: longAgo}, TopicID: "rust", PostID: "r1", ReporterID: bob.ID, Status: models.ReportRemoved, ResolvedByID: alice.ID},
+	)
+
+	cutoff := time.Now().AddDate(0, 0, -90)
+	if n, err := ArchiveReports(c, cutoff); err != nil || n != 2 {
+		t.Fatalf("archive: got %d, %v, want 2", n, err)
+	}
+	if n, err := ArchiveReports(c, cutoff); err != nil || n != 0 {
+		t.Errorf("archive again: got %d, %v, want 0", n, err)
+	}
+	ids := func(query string) []string {
+		t.Helper()
+		var list ModQueueList
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/reports"+query, aliceToken, nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("reports%s: %d %s", query, rec.Code, rec.Body)
+		}
+		var got []string
+		for _, report := range list.Items {
+			got = append(got, report.ID+":"+report.Status)
+			if report.Post == nil || report.Post.ID != report.PostID {
+				t.Errorf("report %s without its post", report.ID)
+			}
+		}
+		return got
+	}
+	if got := ids(""); len(got) != 1 || got[0] != "stale:open" {
+		t.Errorf("open reports: got %q, want the stale one", got)
+	}
+	if got := ids("?archived=true"); len(got) != 1 || got[0] != "old:approved" {
+		t.Errorf("archived reports: got %q, want old", got)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/reports?archived=true", bobToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("archived reports as a non-moderator: got %d, want 403", rec.Code)
+	}
+	if n, err := Store.Count(c, &models.Report{}, &models.Report{}, store.Unscoped()); err != nil || n != 2 {
+		t.Errorf("reports left in the queue's table: got %d, %v, want recent and stale", n, err)
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrReportResolved = NewError(Conflict, "report_resolved", "this report has already been resolved")
+
+type ReportRequest struct {
+	models.IDs
+	Reason string `json:"reason" form:"reason"`
+}
+type ResolveRequest struct {
+	models.IDs
+	ReportID string `param:"reportid"`
+}
+type ModQueueRequest struct {
+	ListRequest
+	// Archived lists the archived reports instead of the open ones.
+	Archived bool `query:"archived"`
+}
+type ModQueueList struct {
+	models.ListResponse[models.Report]
+	TopicID string `json:"topicID"`
+}
+
+func (r ReportRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.Text("reason", r.Reason, MaxReasonLength, false)
+	return errs.Err()
+}
+
+// findTarget loads the post, or the comment when the IDs have one, that a
+// report or bookmark is about.
+func findTarget(c context.Context, s store.Store, id models.IDs, scopes ...store.Scope) (*models.Post, *models.Comment, error) {
+	scopes = append(scopes, store.Preload("Author"))
+	if id.CommentID != "" {
+		comments, err := store.Find(c, s, models.Comment{Model: models.Model{ID: id.CommentID}, TopicID: id.TopicID, PostID: id.PostID}, scopes...)
+		if err == nil && len(comments) == 0 {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &comments[0], nil
+	}
+	posts, err := store.Find(c, s, models.Post{Model: models.Model{ID: id.PostID}, TopicID: id.TopicID}, scopes...)
+	if err == nil && len(posts) == 0 {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &posts[0], nil, nil
+}
+func FileReport(c context.Context, req ReportRequest) (*models.Report, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	if _, _, err := findTarget(c, Store, req.IDs); err != nil {
+		return nil, err
+	}
+	return store.Create(c, Store, models.Report{Model: models.Model{ID: uuid.NewString()}, TopicID: req.TopicID, PostID: req.PostID, CommentID: req.CommentID, ReporterID: user.ID, Reason: req.Reason, Status: models.ReportOpen})
+}
+
+// ModQueue lists a topic's open reports, oldest first, with the reported
+// content, including content held by AutoModerator. Content that is already
+// gone is left out of its report. With Archived it lists the topic's
+// archived reports instead, most recently archived first.
+func ModQueue(c context.Context, req ModQueueRequest) (*ModQueueList, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	if req.Archived {
+		return archivedReports(c, req)
+	}
+	list, err := store.List(c, Store, models.Report{TopicID: req.TopicID, Status: models.ReportOpen}, req.PageRequest, store.Preload("Reporter"))
+	if err != nil {
+		return nil, err
+	}
+	if err := reportTargets(c, list.Items); err != nil {
+		return nil, err
+	}
+	return &ModQueueList{ListResponse: *list, TopicID: req.TopicID}, nil
+}
+
+func archivedReports(c context.Context, req ModQueueRequest) (*ModQueueList, error) {
+	archived, err := store.List(c, Store, models.ArchivedReport{TopicID: req.TopicID}, req.PageRequest, store.Preload("Reporter"), store.OrderBy("archived_at DESC", "id"))
+	if err != nil {
+		return nil, err
+	}
+	list := &ModQueueList{ListResponse: models.ListResponse[models.Report]{Items: []models.Report{}, Pagination: archived.Pagination}, TopicID: req.TopicID}
+	for _, report := range archived.Items {
+		list.Items = append(list.Items, report.Report())
+	}
+	if err := reportTargets(c, list.Items); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// reportTargets loads the content of each report, leaving out content that
+// is already gone.
+func reportTargets(c context.Context, reports []models.Report) error {
+	for i := range reports {
+		report := &reports[i]
+		var scopes []store.Scope
+		if report.Held {
+			scopes = append(scopes, store.Unscoped())
+		}
+		var err error
+		report.Post, report.Comment, err = findTarget(c, Store, models.IDs{TopicID: report.TopicID, PostID: report.PostID, CommentID: report.CommentID}, scopes...)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveReport closes a report along with every other open report on the
+// same content. Removing soft-deletes the content, and approving content
+// held by AutoModerator restores it.
+func ResolveReport(status string) func(context.Context, ResolveRequest) (*models.Report, error) {
+	return func(c context.Context, req ResolveRequest) (*models.Report, error) {
+		if err := Moderate(c, req.TopicID); err != nil {
+			return nil, err
+		}
+		report, err := store.Get(c, Store, models.Report{Model: models.Model{ID: req.ReportID}, TopicID: req.TopicID})
+		if err != nil {
+			return nil, err
+		} else if report.Status != models.ReportOpen {
+			return nil, ErrReportResolved
+		}
+		resolution := models.Report{Status: status, ResolvedByID: CurrentUser(c).ID}
+		action := &models.ModAction{TopicID: report.TopicID, Action: models.ModApprove, PostID: report.PostID, CommentID: report.CommentID, Details: report.Reason}
+		if status == models.ReportRemoved {
+			action.Action = models.ModRemove
+		}
+		var scopes []store.Scope
+		if report.Held {
+			scopes = append(scopes, store.Unscoped())
+		}
+		post, comment, err := findTarget(c, Store, models.IDs{TopicID: report.TopicID, PostID: report.PostID, CommentID: report.CommentID}, scopes...)
+		if post != nil {
+			action.TargetUserID = post.AuthorID
+		} else if comment != nil {
+			action.TargetUserID = comment.AuthorID
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		err = Moderated(c, action, func(tx store.Store) error {
+			if status == models.ReportRemoved {
+				var err error
+				if report.CommentID != "" {
+					_, err = store.Delete(c, tx, models.Comment{Model: models.Model{ID: report.CommentID}, TopicID: report.TopicID, PostID: report.PostID})
+				} else {
+					err = DeletePost(c, tx, report.TopicID, report.PostID)
+				}
+				if err != nil {
+					return err
+				}
+			} else if report.Held {
+				var err error
+				if report.CommentID != "" {
+					_, err = store.Restore(c, tx, models.Comment{Model: models.Model{ID: report.CommentID}, TopicID: report.TopicID, PostID: report.PostID})
+				} else {
+					_, err = store.Restore(c, tx, models.Post{Model: models.Model{ID: report.PostID}, TopicID: report.TopicID})
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if report.CommentID != "" && (status == models.ReportRemoved || report.Held) {
+				if err := RecountComments(c, tx, report.TopicID, report.PostID); err != nil {
+					return err
+				}
+			}
+			open, err := store.Find(c, tx, models.Report{TopicID: report.TopicID, PostID: report.PostID, Status: models.ReportOpen}, store.Where("comment_id", "=", report.CommentID))
+			if err != nil {
+				return err
+			}
+			for _, other := range open {
+				if err := tx.Update(c, &other, resolution); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if report.Held && status == models.ReportApproved {
+			if post != nil {
+				post.DeletedAt = gorm.DeletedAt{}
+				OnCreate(c, post, post.Author)
+			} else if comment != nil {
+				comment.DeletedAt = gorm.DeletedAt{}
+				OnCreate(c, comment, comment.Author)
+			}
+		}
+		report.Status, report.ResolvedByID = resolution.Status, resolution.ResolvedByID
+		return report, nil
+	}
+}
+func HandleModQueue(c echo.Context) error {
+	if CurrentUser(c.Request().Context()) == nil {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	var req ListRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	list, err := ModQueue(c.Request().Context(), ModQueueRequest{ListRequest: req})
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "modqueue", list)
+}
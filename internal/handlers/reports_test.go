@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestReports files reports over v1 and the form, and resolves them from the
+// moderation queue.
+func TestReports(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	carol, carolToken := newUser(t, "carol")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: carol.ID, Title: "Spam"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: carol.ID, Content: "More spam"},
+	)
+	reason := func(s string) map[string]string { return map[string]string{"reason": s} }
+	for _, tc := range []struct {
+		what        string
+		path, token string
+		body        any
+		want        int
+	}{
+		{"report signed out", "/v1/topics/golang/posts/p1/reports", "", reason("spam"), http.StatusUnauthorized},
+		{"report a missing post", "/v1/topics/golang/posts/p2/reports", bobToken, reason("spam"), http.StatusNotFound},
+		{"report at length", "/v1/topics/golang/posts/p1/reports", bobToken, reason(strings.Repeat("x", MaxReasonLength+1)), http.StatusBadRequest},
+		{"report a post", "/v1/topics/golang/posts/p1/reports", bobToken, reason("spam"), http.StatusCreated},
+		{"report a post twice", "/v1/topics/golang/posts/p1/reports", bobToken, reason("still spam"), http.StatusConflict},
+		{"report a post someone else reported", "/v1/topics/golang/posts/p1/reports", aliceToken, reason("ads"), http.StatusCreated},
+		{"report a comment", "/v1/topics/golang/posts/p1/comments/c1/reports", bobToken, reason("spam"), http.StatusCreated},
+	} {
+		if rec := call(t, e, http.MethodPost, tc.path, tc.token, tc.body, nil); rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+
+	if rec := postForm(e, "/topics/golang/posts/p1/comments/c1/report", url.Values{"reason": {"rude"}}, login(t, alice)); rec.Code != http.StatusCreated {
+		t.Errorf("report a comment through the form: got %d", rec.Code)
+	}
+
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/reports", bobToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("the queue as a non-moderator: got %d", rec.Code)
+	}
+	queue := func() ModQueueList {
+		t.Helper()
+		var list ModQueueList
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/reports", aliceToken, nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("the queue: %d", rec.Code)
+		}
+		return list
+	}
+	list := queue()
+	if len(list.Items) != 4 || list.TopicID != "golang" {
+		t.Fatalf("the queue: got %+v", list)
+	}
+	var postReport, commentReport models.Report
+	for _, report := range list.Items {
+		switch {
+		case report.CommentID == "c1" && report.ReporterID == bob.ID && report.Comment != nil && report.Comment.Content == "More spam":
+			commentReport = report
+		case report.ReporterID == bob.ID && report.Post != nil && report.Post.Title == "Spam" && report.Reporter != nil && report.Reporter.Username == "bob":
+			postReport = report
+		}
+	}
+	if postReport.ID == "" || commentReport.ID == "" {
+		t.Fatalf("the queue is missing content or reporters: %+v", list.Items)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/topics/golang/modqueue", nil)
+	req.AddCookie(login(t, alice))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "More spam") {
+		t.Errorf("the queue page: got %d", rec.Code)
+	}
+	if rec := get(e, "/topics/golang/modqueue"); rec.Code != http.StatusFound {
+		t.Errorf("the queue page signed out: got %d, want a redirect", rec.Code)
+	}
+
+	path := "/v1/topics/golang/reports/" + postReport.ID
+	if rec := call(t, e, http.MethodPost, path+"/remove", carolToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("remove as a non-moderator: got %d", rec.Code)
+	}
+	var resolved models.Report
+	if rec := call(t, e, http.MethodPost, path+"/remove", aliceToken, nil, &resolved); rec.Code != http.StatusOK || resolved.Status != models.ReportRemoved || resolved.ResolvedByID != alice.ID {
+		t.Errorf("remove: got %d, %+v", rec.Code, resolved)
+	}
+	if rec := call(t, e, http.MethodPost, path+"/approve", aliceToken, nil, nil); rec.Code != http.StatusConflict {
+		t.Errorf("approve a resolved report: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1", "", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("the removed post: got %d", rec.Code)
+	}
+	if list := queue(); len(list.Items) != 2 || list.Items[0].CommentID != "c1" || list.Items[1].CommentID != "c1" {
+		t.Errorf("the queue after removing the post: got %+v", list.Items)
+	}
+
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/reports/"+commentReport.ID+"/approve", aliceToken, nil, &resolved); rec.Code != http.StatusOK || resolved.Status != models.ReportApproved {
+		t.Errorf("approve: got %d, %+v", rec.Code, resolved)
+	}
+	if list := queue(); len(list.Items) != 0 {
+		t.Errorf("the queue after approving both reports on the comment: got %+v", list.Items)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/reports/missing/approve", aliceToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("approve a missing report: got %d", rec.Code)
+	}
+}
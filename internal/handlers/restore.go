@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type DeletedRequest struct {
+	ListRequest
+	Type string `query:"type"`
+}
+
+// DeletedList is a page of a topic's soft-deleted posts or comments, most
+// recently deleted first.
+type DeletedList struct {
+	TopicID  string                               `json:"topicID"`
+	Type     string                               `json:"type"`
+	Posts    *models.ListResponse[models.Post]    `json:"posts,omitempty"`
+	Comments *models.ListResponse[models.Comment] `json:"comments,omitempty"`
+}
+
+func (r DeletedRequest) Validate() error {
+	if !slices.Contains([]string{"", "post", "comment"}, r.Type) {
+		return FieldErrors{"type": "must be post or comment"}
+	}
+	return nil
+}
+
+func DeleteTopic(c context.Context, req DeleteRequest) (*models.Topic, error) {
+	topic := models.Topic{Model: models.Model{ID: req.TopicID}}
+	if _, err := store.Get(c, Store, topic); err != nil {
+		return nil, err
+	}
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	return nil, Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModDeleteTopic}, func(tx store.Store) error {
+		_, err := store.Delete(c, tx, topic)
+		return err
+	})
+}
+
+// restore undeletes a soft-deleted row, logging it as action. Rows that were
+// never deleted are returned as they are.
+func restore[T any](c context.Context, id T, topicID string, action *models.ModAction, author func(*T) string) (*T, error) {
+	if err := Moderate(c, topicID); err != nil {
+		return nil, err
+	}
+	rows, err := store.Find(c, Store, id, store.Deleted())
+	if err != nil {
+		return nil, err
+	} else if len(rows) == 0 {
+		return store.Get(c, Store, id)
+	}
+	action.TopicID = topicID
+	if author != nil {
+		action.TargetUserID = author(&rows[0])
+	}
+	err = Moderated(c, action, func(tx store.Store) error {
+		if _, err := store.Restore(c, tx, id); err != nil {
+			return err
+		}
+		if comment, ok := any(&id).(*models.Comment); ok {
+			return RecountComments(c, tx, comment.TopicID, comment.PostID)
+		}
+		if post, ok := any(&rows[0]).(*models.Post); ok {
+			return RestoreCrossposts(c, tx, post)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(c, Store, id)
+}
+func RestoreTopic(c context.Context, req GetRequest) (*models.Topic, error) {
+	return restore(c, models.Topic{Model: models.Model{ID: req.TopicID}}, req.TopicID, &models.ModAction{Action: models.ModRestoreTopic}, nil)
+}
+func RestorePost(c context.Context, req GetRequest) (*models.Post, error) {
+	return restore(c, models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID}, req.TopicID,
+		&models.ModAction{Action: models.ModRestore, PostID: req.PostID}, func(p *models.Post) string { return p.AuthorID })
+}
+func RestoreComment(c context.Context, req GetRequest) (*models.Comment, error) {
+	return restore(c, models.Comment{Model: models.Model{ID: req.CommentID}, TopicID: req.TopicID, PostID: req.PostID}, req.TopicID,
+		&models.ModAction{Action: models.ModRestore, PostID: req.PostID, CommentID: req.CommentID}, func(c *models.Comment) string { return c.AuthorID })
+}
+
+// DeletedContent lists a topic's deleted posts, or its deleted comments when
+// the request's type is comment, so moderators can undo removals.
+func DeletedContent(c context.Context, req DeletedRequest) (*DeletedList, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	list := &DeletedList{TopicID: req.TopicID, Type: req.Type}
+	scopes := []store.Scope{store.Deleted(), store.Preload("Author"), store.OrderBy("deleted_at DESC")}
+	var err error
+	if req.Type == "comment" {
+		list.Comments, err = store.List(c, Store, models.Comment{TopicID: req.TopicID}, req.PageRequest, scopes...)
+	} else {
+		list.Type = "post"
+		list.Posts, err = store.List(c, Store, models.Post{TopicID: req.TopicID}, req.PageRequest, scopes...)
+	}
+	return list, err
+}
+func HandleDeleted(c echo.Context) error {
+	if CurrentUser(c.Request().Context()) == nil {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	var req DeletedRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	if err := req.Validate(); err != nil {
+		return Fail(c, err)
+	}
+	list, err := DeletedContent(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	if list.Posts != nil {
+		list.Posts.Link(c.Request().URL)
+	} else {
+		list.Comments.Link(c.Request().URL)
+	}
+	return c.Render(http.StatusOK, "deleted", list)
+}
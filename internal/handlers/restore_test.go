@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestRestore deletes posts, comments and a topic and restores them as a
+// moderator and as an admin.
+func TestRestore(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"dave"}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	_, daveToken := newUser(t, "dave")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "First"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: bob.ID, Title: "Second"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "Reply"},
+	)
+	for _, path := range []string{"/v1/topics/golang/posts/p1", "/v1/topics/golang/posts/p2", "/v1/topics/golang/posts/p1/comments/c1"} {
+		if rec := call(t, e, http.MethodDelete, path, bobToken, nil, nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("delete %s: %d", path, rec.Code)
+		}
+	}
+
+	deleted := func(query, token string) (int, string) {
+		t.Helper()
+		var list DeletedList
+		rec := call(t, e, http.MethodGet, "/v1/topics/golang/deleted"+query, token, nil, &list)
+		var got []string
+		if list.Posts != nil {
+			for _, post := range list.Posts.Items {
+				got = append(got, post.ID)
+			}
+		}
+		if list.Comments != nil {
+			for _, comment := range list.Comments.Items {
+				got = append(got, comment.ID)
+			}
+		}
+		return rec.Code, list.Type + fmt.Sprint(got)
+	}
+	for _, tc := range []struct {
+		what, query, token string
+		code               int
+		want               string
+	}{
+		{"as a non-moderator", "", bobToken, http.StatusForbidden, "[]"},
+		{"posts", "", aliceToken, http.StatusOK, "post[p2 p1]"},
+		{"comments", "?type=comment", aliceToken, http.StatusOK, "comment[c1]"},
+		{"as an admin", "", daveToken, http.StatusOK, "post[p2 p1]"},
+		{"an unknown type", "?type=topic", aliceToken, http.StatusBadRequest, "[]"},
+	} {
+		if code, got := deleted(tc.query, tc.token); code != tc.code || got != tc.want {
+			t.Errorf("deleted %s: got %d %s, want %d %s", tc.what, code, got, tc.code, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		what, path, token string
+		want              int
+	}{
+		{"a post as a non-moderator", "/v1/topics/golang/posts/p1/restore", bobToken, http.StatusForbidden},
+		{"an unknown post", "/v1/topics/golang/posts/p9/restore", aliceToken, http.StatusNotFound},
+		{"p1", "/v1/topics/golang/posts/p1/restore", aliceToken, http.StatusOK},
+		{"p1 again", "/v1/topics/golang/posts/p1/restore", aliceToken, http.StatusOK},
+		{"c1 as an admin", "/v1/topics/golang/posts/p1/comments/c1/restore", daveToken, http.StatusOK},
+		{"a topic that was never deleted", "/v1/topics/golang/restore", aliceToken, http.StatusOK},
+	} {
+		if rec := call(t, e, http.MethodPost, tc.path, tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("restore %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1/comments/c1", "", nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("get the restored comment: got %d", rec.Code)
+	}
+	if _, got := deleted("", aliceToken); got != "post[p2]" {
+		t.Errorf("deleted posts after the restores: got %s", got)
+	}
+
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete the topic: %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/restore", aliceToken, nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("restore the topic: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang", "", nil, nil); rec.Code != http.StatusOK {
+		t.Errorf("get the restored topic: got %d", rec.Code)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	var actions []string
+	for _, action := range log.Items {
+		actions = append(actions, action.Action+" "+action.PostID+action.CommentID)
+	}
+	if got := strings.Join(actions, "|"); got != "restore_topic |delete_topic |restore p1c1|restore p1" {
+		t.Errorf("the mod log: got %s", got)
+	}
+
+	page := func(path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(login(t, alice))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if body := page("/topics/golang").Body.String(); !strings.Contains(body, `href="/topics/golang/deleted"`) {
+		t.Error("the topic page does not link the deleted page for a moderator")
+	}
+	if body := page("/topics/golang/deleted").Body.String(); !strings.Contains(body, `data-url="/topics/golang/posts/p2/restore"`) {
+		t.Errorf("the deleted page does not offer to restore p2: %s", body)
+	}
+	if rec := postForm(e, "/topics/golang/posts/p2/restore", nil, login(t, alice)); rec.Code != http.StatusOK {
+		t.Errorf("restore through the page: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := get(e, "/topics/golang/deleted"); rec.Code != http.StatusFound {
+		t.Errorf("the deleted page signed out: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TitleEditWindow is how long after posting authors may still change a
+// post's title. Moderators may change it at any time.
+const TitleEditWindow = 5 * time.Minute
+
+// EditGrace is how long after posting a comment can be edited without being
+// marked as edited.
+var EditGrace = 5 * time.Minute
+
+var ErrTitleLocked = NewError(Forbidden, "title_locked", "titles can only be edited in the first 5 minutes after posting")
+
+// EditPost changes a post's title or content, keeping what it said before
+// as a PostRevision. Moderators editing someone else's post log it.
+func EditPost(c context.Context, req UpdateRequest[models.Post]) (*models.Post, error) {
+	id := models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID}
+	action, err := OwnedOrModerated(c, id, req.TopicID, func(p *models.Post) string { return p.AuthorID })
+	if err != nil {
+		return nil, err
+	}
+	post, err := store.Get(c, Store, id)
+	if err != nil {
+		return nil, err
+	}
+	mask := models.Post{Title: models.StripTags(req.Mask.Title), Content: req.Mask.Content}
+	if mask.Title == post.Title {
+		mask.Title = ""
+	}
+	if mask.Content == post.Content {
+		mask.Content = ""
+	}
+	if mask.Title == "" && mask.Content == "" {
+		return post, nil
+	}
+	if mask.Title != "" && action == nil && time.Since(post.CreatedAt) > TitleEditWindow {
+		return nil, ErrTitleLocked
+	}
+	if filter, err := Filtered(c, Store, req.TopicID, mask.Title+"\n"+mask.Content); err != nil {
+		return nil, err
+	} else if filter != nil && filter.Action == models.FilterReject {
+		return nil, ErrFiltered
+	}
+	if action != nil {
+		action.Action, action.PostID = models.ModEditPost, req.PostID
+	}
+	now := time.Now()
+	mask.NormalizedTitle, mask.EditedAt = models.TitleRules.Normalize(mask.Title), &now
+	err = Moderated(c, action, func(tx store.Store) error {
+		revision := &models.PostRevision{Model: models.Model{ID: uuid.NewString()}, TopicID: post.TopicID, PostID: post.ID, EditorID: CurrentUser(c).ID, Title: post.Title, Content: post.Content}
+		if err := tx.Create(c, revision); err != nil {
+			return err
+		}
+		return tx.Update(c, &id, mask)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(c, Store, id)
+}
+
+// EditComment changes a comment's content. Edits after the EditGrace period
+// mark it as edited, and moderators editing someone else's comment log it.
+func EditComment(c context.Context, req UpdateRequest[models.Comment]) (*models.Comment, error) {
+	id := models.Comment{Model: models.Model{ID: req.CommentID}, TopicID: req.TopicID, PostID: req.PostID}
+	action, err := OwnedOrModerated(c, id, req.TopicID, func(c *models.Comment) string { return c.AuthorID })
+	if err != nil {
+		return nil, err
+	}
+	comment, err := store.Get(c, Store, id)
+	if err != nil {
+		return nil, err
+	} else if req.Mask.Content == "" || req.Mask.Content == comment.Content {
+		return comment, nil
+	}
+	if filter, err := Filtered(c, Store, req.TopicID, req.Mask.Content); err != nil {
+		return nil, err
+	} else if filter != nil && filter.Action == models.FilterReject {
+		return nil, ErrFiltered
+	}
+	mask := models.Comment{Content: req.Mask.Content}
+	if now := time.Now(); now.Sub(comment.CreatedAt) > EditGrace {
+		mask.EditedAt = &now
+	}
+	if action != nil {
+		action.Action, action.PostID, action.CommentID = models.ModEditComment, req.PostID, req.CommentID
+	}
+	err = Moderated(c, action, func(tx store.Store) error { return tx.Update(c, &id, mask) })
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(c, Store, id)
+}
+
+// PostRevisions lists a post's earlier versions, newest first.
+func PostRevisions(c context.Context, req ListRequest) (*models.ListResponse[models.PostRevision], error) {
+	post, err := store.Get(c, Store, models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID})
+	if err != nil {
+		return nil, err
+	} else if hidden, err := HiddenFrom(c, post.AuthorID, post.Shadowbanned); err != nil {
+		return nil, err
+	} else if hidden {
+		return nil, store.ErrNotFound
+	}
+	return store.List(c, Store, models.PostRevision{TopicID: req.TopicID, PostID: req.PostID}, req.PageRequest, store.Preload("Editor"), store.OrderBy("created_at DESC"))
+}
+
+// EditedPost is a post in a topic's recently edited list, with the path of
+// its revisions to compare against.
+type EditedPost struct {
+	models.Post
+	Revisions string `json:"revisions"`
+}
+
+// RecentlyEdited lists a topic's posts that were edited after posting, most
+// recently edited first, for moderators watching for edits that change a
+// post after it drew votes. UpdatedAt also moves with votes and moderation,
+// so only EditedAt counts as an edit.
+func RecentlyEdited(c context.Context, req ListRequest) (*models.ListResponse[EditedPost], error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	posts, err := store.List(c, Store, models.Post{TopicID: req.TopicID}, req.PageRequest, store.Where("edited_at", "<>", nil), store.Preload("Author"), store.OrderBy("edited_at DESC"))
+	if err != nil {
+		return nil, err
+	}
+	list := &models.ListResponse[EditedPost]{Items: make([]EditedPost, len(posts.Items)), Pagination: posts.Pagination}
+	for i, post := range posts.Items {
+		list.Items[i] = EditedPost{Post: post, Revisions: "/v1/topics/" + post.TopicID + "/posts/" + post.ID + "/revisions"}
+	}
+	return list, nil
+}
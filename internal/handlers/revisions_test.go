@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// TestEditPost edits posts as their author and as a moderator and reads the
+// revisions back.
+func TestEditPost(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	_, carolToken := newUser(t, "carol")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Filter{TopicID: "golang", Kind: models.FilterWord, Value: "java", Action: models.FilterReject},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "First", Content: "one"},
+		&models.Post{Model: models.Model{ID: "old", CreatedAt: time.Now().Add(-time.Hour)}, TopicID: "golang", AuthorID: bob.ID, Title: "Old", Content: "old"},
+	)
+	for _, tc := range []struct {
+		what, token, post string
+		mask              map[string]any
+		want              int
+	}{
+		{"as someone else", carolToken, "p1", map[string]any{"content": "carol's"}, http.StatusForbidden},
+		{"a missing post", bobToken, "p9", map[string]any{"content": "two"}, http.StatusNotFound},
+		{"the content", bobToken, "p1", map[string]any{"content": "two"}, http.StatusOK},
+		{"nothing", bobToken, "p1", map[string]any{"title": "First", "content": "two"}, http.StatusOK},
+		{"the title", bobToken, "p1", map[string]any{"title": "Second"}, http.StatusOK},
+		{"into a rejected word", bobToken, "p1", map[string]any{"content": "java"}, http.StatusBadRequest},
+		{"an old title", bobToken, "old", map[string]any{"title": "Newer"}, http.StatusForbidden},
+		{"an old post's content", bobToken, "old", map[string]any{"content": "still fine"}, http.StatusOK},
+		{"an old title as a moderator", aliceToken, "old", map[string]any{"title": "Renamed"}, http.StatusOK},
+	} {
+		if rec := call(t, e, http.MethodPut, "/v1/topics/golang/posts/"+tc.post, tc.token, map[string]any{"updateMask": tc.mask}, nil); rec.Code != tc.want {
+			t.Errorf("edit %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+
+	revisions := func(post string) []models.PostRevision {
+		t.Helper()
+		var list models.ListResponse[models.PostRevision]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/"+post+"/revisions", "", nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("revisions of %s: %d", post, rec.Code)
+		}
+		return list.Items
+	}
+	if got := revisions("p1"); len(got) != 2 || got[0].Title != "First" || got[0].Content != "two" || got[1].Content != "one" || got[1].Editor == nil || got[1].Editor.Username != "bob" {
+		t.Errorf("revisions of p1: got %+v", got)
+	}
+	if got := revisions("old"); len(got) != 2 || got[0].Title != "Old" || got[0].Editor == nil || got[0].Editor.Username != "alice" {
+		t.Errorf("revisions of old: got %+v", got)
+	}
+	var post models.Post
+	call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1", "", nil, &post)
+	if post.Title != "Second" || post.Content != "two" || post.EditedAt == nil {
+		t.Errorf("p1 after the edits: got %+v", post)
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p9/revisions", "", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("revisions of a missing post: got %d", rec.Code)
+	}
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	if len(log.Items) != 1 || log.Items[0].Action != models.ModEditPost || log.Items[0].PostID != "old" {
+		t.Errorf("the mod log: got %+v", log.Items)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/topics/golang/posts/p1/edit", strings.NewReader(`{"updateMask":{"content":"three"}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXCSRFToken, csrfToken)
+	req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: csrfToken})
+	req.AddCookie(login(t, bob))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("edit through the page: got %d %s", rec.Code, rec.Body)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/topics/golang/posts/p1", nil)
+	req.AddCookie(login(t, bob))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "edited ") || !strings.Contains(body, `id="editform"`) || !strings.Contains(body, "<strong>First</strong>") {
+		t.Errorf("the post page does not show the edit history: %s", body)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/topics/golang/posts/p1", nil)
+	req.AddCookie(login(t, alice))
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if strings.Contains(rec.Body.String(), `id="editform"`) {
+		t.Error("the post page offers the edit form to someone other than the author")
+	}
+}
+
+// TestRecentlyEdited edits posts and lists them for moderators, most
+// recently edited first, without the posts that were only voted on.
+func TestRecentlyEdited(t *testing.T) {
+	e := newServer(t)
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "First"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: bob.ID, Title: "Second"},
+		&models.Post{Model: models.Model{ID: "p3"}, TopicID: "golang", AuthorID: bob.ID, Title: "Third"},
+		&models.Post{Model: models.Model{ID: "r1"}, TopicID: "rust", AuthorID: bob.ID, Title: "Elsewhere"},
+	)
+	for _, path := range []string{"/v1/topics/golang/posts/p2", "/v1/topics/rust/posts/r1", "/v1/topics/golang/posts/p1"} {
+		if rec := call(t, e, http.MethodPut, path, bobToken, map[string]any{"updateMask": map[string]any{"content": "edited"}}, nil); rec.Code != http.StatusOK {
+			t.Fatalf("edit %s: %d", path, rec.Code)
+		}
+	}
+	if rec := postForm(e, "/topics/golang/posts/p3/upvote", nil, login(t, alice)); rec.Code >= http.StatusBadRequest {
+		t.Fatalf("vote on p3: %d %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		what, token string
+		want        int
+	}{
+		{"signed out", "", http.StatusUnauthorized},
+		{"as a non-moderator", bobToken, http.StatusForbidden},
+	} {
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/recently-edited", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("recently edited %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	var list models.ListResponse[EditedPost]
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/recently-edited", aliceToken, nil, &list); rec.Code != http.StatusOK {
+		t.Fatalf("recently edited: %d %s", rec.Code, rec.Body)
+	}
+	var got []string
+	for _, post := range list.Items {
+		got = append(got, post.ID+" "+post.Revisions)
+	}
+	if want := "[p1 /v1/topics/golang/posts/p1/revisions p2 /v1/topics/golang/posts/p2/revisions]"; fmt.Sprint(got) != want || list.Total != 2 {
+		t.Errorf("recently edited: got %v of %d, want %s", got, list.Total, want)
+	}
+	if len(list.Items) > 0 && (list.Items[0].EditedAt == nil || list.Items[0].Author == nil) {
+		t.Errorf("the latest edit: got %+v", list.Items[0])
+	}
+}
+
+// TestEditComment edits comments inside and after the grace period.
+func TestEditComment(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	grace := EditGrace
+	t.Cleanup(func() { EditGrace = grace })
+	EditGrace = time.Minute
+	bob, bobToken := newUser(t, "bob")
+	_, carolToken := newUser(t, "carol")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Filter{TopicID: "golang", Kind: models.FilterWord, Value: "java", Action: models.FilterReject},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Post"},
+		&models.Comment{Model: models.Model{ID: "new"}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "new"},
+		&models.Comment{Model: models.Model{ID: "old", CreatedAt: time.Now().Add(-time.Hour)}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "old"},
+	)
+	edit := func(comment, token, content string) (*httptest.ResponseRecorder, models.Comment) {
+		t.Helper()
+		var out models.Comment
+		rec := call(t, e, http.MethodPut, "/v1/topics/golang/posts/p1/comments/"+comment, token, map[string]any{"updateMask": map[string]any{"content": content}}, &out)
+		return rec, out
+	}
+	if rec, _ := edit("new", carolToken, "carol's"); rec.Code != http.StatusForbidden {
+		t.Errorf("edit as someone else: got %d", rec.Code)
+	}
+	if rec, _ := edit("new", bobToken, "java"); rec.Code != http.StatusBadRequest {
+		t.Errorf("edit into a rejected word: got %d", rec.Code)
+	}
+	if rec, got := edit("new", bobToken, "newer"); rec.Code != http.StatusOK || got.Content != "newer" || got.EditedAt != nil {
+		t.Errorf("edit inside the grace period: got %d %+v", rec.Code, got)
+	}
+	if rec, got := edit("old", bobToken, "old"); rec.Code != http.StatusOK || got.EditedAt != nil {
+		t.Errorf("edit that changes nothing: got %d %+v", rec.Code, got)
+	}
+	if rec, got := edit("old", bobToken, "older"); rec.Code != http.StatusOK || got.Content != "older" || got.EditedAt == nil {
+		t.Errorf("edit after the grace period: got %d %+v", rec.Code, got)
+	}
+	if rec := get(e, "/topics/golang/posts/p1"); strings.Count(rec.Body.String(), "edited ") != 1 {
+		t.Errorf("the post page should mark one comment edited: %s", rec.Body)
+	}
+}
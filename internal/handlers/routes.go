@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/metrics"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+func Register(e *echo.Echo) {
+	e.HTTPErrorHandler = ErrorHandler
+	e.IPExtractor = ClientIP
+	e.Binder = TracedBinder{e.Binder}
+	e.JSONSerializer = FuzzedJSON{e.JSONSerializer}
+	e.Use(Traced, RequestLogger, Sessions, CSRF, RateLimit(func(c echo.Context) bool {
+		return strings.HasPrefix(c.Path(), "/v1/") || strings.HasPrefix(c.Path(), "/static/") || strings.HasPrefix(c.Path(), "/media/") || c.Path() == "/healthz" || c.Path() == "/readyz"
+	}))
+	if Static != nil {
+		e.StaticFS("/static/", Static)
+	}
+	e.GET("/media/:name", HandleMedia)
+	e.POST("/media", HandleUpload)
+	e.GET("/healthz", HandleHealthz)
+	e.GET("/readyz", HandleReadyz)
+	e.GET("/", Conditional(HandleIndex))
+	e.GET("/topics", Conditional(HandleTopics))
+	if Features.Signup {
+		e.GET("/signup", func(c echo.Context) error { return c.Render(http.StatusOK, "signup", nil) })
+		e.POST("/signup", HandleSignup)
+	}
+	if Features.Metrics {
+		e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	}
+	debug := e.Group("/debug", AdminOnly)
+	debug.GET("/pprof/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	debug.GET("/pprof/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	debug.GET("/pprof/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	debug.GET("/pprof/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	debug.GET("/pprof/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	debug.GET("/pprof/:profile", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	debug.GET("/vars", echo.WrapHandler(expvar.Handler()))
+	e.GET("/login", func(c echo.Context) error { return c.Render(http.StatusOK, "login", OAuthProviderNames()) })
+	e.POST("/login", HandleLogin)
+	e.POST("/logout", HandleLogout)
+	e.GET("/auth/:provider/login", HandleOAuthLogin)
+	e.GET("/auth/:provider/callback", HandleOAuthCallback)
+	e.GET("/topics/:topicid", Serve("topic", func(i models.IDs) models.Topic { return models.Topic{Model: models.Model{ID: i.TopicID}} }, PrepareTopic))
+	e.GET("/topics/:topicid/posts/:postid", Viewed(Serve("post", func(i models.IDs) models.Post {
+		return models.Post{Model: models.Model{ID: i.PostID}, TopicID: i.TopicID}
+	}, PreparePost, "Author", "Media", "Flair")))
+	e.GET("/topics/:topicid/posts/:postid/stream", HandleStream)
+	e.GET("/topics/:topicid/votes", HandleVoteSocket)
+	e.GET("/topics/:topicid/posts/:postid/votes", HandleVoteSocket)
+	e.GET("/u/:username", HandleProfile)
+	e.POST("/u/:username/block", V1WithStatus(http.StatusNoContent, BlockUser))
+	e.POST("/u/:username/unblock", V1WithStatus(http.StatusNoContent, UnblockUser))
+	e.POST("/topics/:topicid/posts/:postid/report", V1WithStatus(http.StatusCreated, FileReport))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/report", V1WithStatus(http.StatusCreated, FileReport))
+	e.POST("/topics/:topicid/posts/:postid/save", V1WithStatus(http.StatusNoContent, Save(true)))
+	e.POST("/topics/:topicid/posts/:postid/unsave", V1WithStatus(http.StatusNoContent, Save(false)))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/save", V1WithStatus(http.StatusNoContent, Save(true)))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/unsave", V1WithStatus(http.StatusNoContent, Save(false)))
+	e.GET("/saved", HandleSaved)
+	e.POST("/topics/:topicid/posts/:postid/hide", V1WithStatus(http.StatusNoContent, Hide(true)))
+	e.POST("/topics/:topicid/posts/:postid/unhide", V1WithStatus(http.StatusNoContent, Hide(false)))
+	e.GET("/hidden", HandleHidden)
+	e.POST("/topics/:topicid/posts/:postid/edit", V1(EditPost))
+	e.POST("/topics/:topicid/posts/:postid/poll/vote", V1(VotePoll))
+	e.POST("/topics/:topicid/posts/:postid/crosspost", V1WithStatus(http.StatusCreated, Crosspost))
+	e.GET("/topics/:topicid/posts/:postid/crossposts", V1(ListCrossposts))
+	e.POST("/topics/:topicid/posts/:postid/nsfw", V1WithStatus(http.StatusNoContent, MarkPost("nsfw", true)))
+	e.POST("/topics/:topicid/posts/:postid/sfw", V1WithStatus(http.StatusNoContent, MarkPost("nsfw", false)))
+	e.POST("/topics/:topicid/posts/:postid/spoiler", V1WithStatus(http.StatusNoContent, MarkPost("spoiler", true)))
+	e.POST("/topics/:topicid/posts/:postid/unspoiler", V1WithStatus(http.StatusNoContent, MarkPost("spoiler", false)))
+	e.POST("/topics/:topicid/posts/:postid/pin", V1WithStatus(http.StatusNoContent, Pin(true)))
+	e.POST("/topics/:topicid/posts/:postid/unpin", V1WithStatus(http.StatusNoContent, Pin(false)))
+	e.POST("/topics/:topicid/posts/:postid/lock", V1WithStatus(http.StatusNoContent, Lock(true)))
+	e.POST("/topics/:topicid/posts/:postid/unlock", V1WithStatus(http.StatusNoContent, Lock(false)))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/sticky", V1WithStatus(http.StatusNoContent, Sticky(true)))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/unsticky", V1WithStatus(http.StatusNoContent, Sticky(false)))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/distinguish", V1WithStatus(http.StatusNoContent, Distinguish(true)))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/undistinguish", V1WithStatus(http.StatusNoContent, Distinguish(false)))
+	e.POST("/topics/:topicid/users/:username/flair", V1(SetUserFlair))
+	e.POST("/topics/:topicid/users/:username/flair/remove", V1WithStatus(http.StatusNoContent, RemoveUserFlair))
+	e.GET("/topics/:topicid/deleted", HandleDeleted)
+	e.POST("/topics/:topicid/posts/:postid/restore", V1(RestorePost))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/restore", V1(RestoreComment))
+	e.GET("/topics/:topicid/modqueue", HandleModQueue)
+	e.POST("/topics/:topicid/modqueue/:reportid/approve", V1(ResolveReport(models.ReportApproved)))
+	e.POST("/topics/:topicid/modqueue/:reportid/remove", V1(ResolveReport(models.ReportRemoved)))
+	e.GET("/topics/:topicid/modlog", HandleModLog)
+	e.GET("/admin", HandleAdmin)
+	e.GET("/admin/users", HandleAdminUsers)
+	e.POST("/admin/users/:username/ban", V1WithStatus(http.StatusNoContent, Ban(true)))
+	e.POST("/admin/users/:username/unban", V1WithStatus(http.StatusNoContent, Ban(false)))
+	e.GET("/admin/topics", HandleAdminTopics)
+	e.POST("/admin/topics/:topicid/delete", V1WithStatus(http.StatusNoContent, DeleteTopic))
+	e.GET("/admin/reports", HandleAdminReports)
+	e.GET("/admin/stats", HandleAdminStats)
+	e.GET("/m", HandleCollections)
+	e.POST("/m", V1WithStatus(http.StatusCreated, CreateCollection))
+	e.GET("/m/:collection", HandleCollection)
+	e.POST("/m/:collection/delete", V1WithStatus(http.StatusNoContent, DeleteCollection))
+	e.POST("/topics/:topicid/join", V1WithStatus(http.StatusNoContent, Subscribe))
+	e.POST("/topics/:topicid/leave", V1WithStatus(http.StatusNoContent, Unsubscribe))
+	e.GET("/search", HandleSearch)
+	e.GET("/notifications", HandleNotifications)
+	e.POST("/notifications/read", V1WithStatus(http.StatusNoContent, MarkAllRead))
+	e.POST("/notifications/:notificationid/read", V1(MarkRead))
+	e.GET("/messages", HandleMailbox(false))
+	e.GET("/messages/sent", HandleMailbox(true))
+	e.POST("/messages", V1WithStatus(http.StatusCreated, SendMessage))
+	e.POST("/messages/:username/read", V1WithStatus(http.StatusNoContent, MarkConversationRead))
+	e.GET("/feed.rss", Conditional(HandleFeed))
+	e.GET("/sitemap.xml", HandleSitemapIndex)
+	e.GET("/sitemap/:page", HandleSitemap)
+	e.GET("/robots.txt", HandleRobots)
+	e.GET("/topics/:topicid/feed.rss", Conditional(HandleFeed))
+	e.GET("/topics/:topicid/archive/:year/:month", Conditional(HandleArchive))
+	e.GET("/topics/:topicid/duplicates", V1(func(c context.Context, req DuplicatesRequest) (*[]models.Post, error) {
+		return FindDuplicates(c, req.TopicID, req.Title)
+	}))
+	e.POST("/topics", V1(CreateTopic))
+	e.GET("/topics/:topicid/posts", Measured(Conditional(HandleTopicPosts)))
+	e.POST("/topics/:topicid/posts", HandleCreate(func(req CreatePostRequest, author *models.User) models.Post {
+		return models.Post{Model: models.Model{ID: uuid.NewString()}, TopicID: req.TopicID, AuthorID: author.ID, Title: req.Title, Kind: req.Kind, URL: req.URL, MediaID: req.MediaID, FlairID: req.FlairID, NSFW: req.NSFW, Spoiler: req.Spoiler, Poll: NewPoll(req.PollOptions), PollClosesAt: PollCloses(req.PollDays), Content: req.Content}
+	}))
+	e.POST("/topics/:topicid/posts/:postid/comments", HandleCreate(func(req CreateCommentRequest, author *models.User) models.Comment {
+		return models.Comment{Model: models.Model{ID: uuid.NewString()}, TopicID: req.TopicID, PostID: req.PostID, ParentCommentID: req.ParentCommentID, AuthorID: author.ID, Content: req.Content}
+	}))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/upvote", HandleVote(func(id models.IDs) models.Comment {
+		return models.Comment{Model: models.Model{ID: id.CommentID}, TopicID: id.TopicID, PostID: id.PostID}
+	}, 1, func(comment *models.Comment) int { return comment.Votes }))
+	e.POST("/topics/:topicid/posts/:postid/comments/:commentid/downvote", HandleVote(func(id models.IDs) models.Comment {
+		return models.Comment{Model: models.Model{ID: id.CommentID}, TopicID: id.TopicID, PostID: id.PostID}
+	}, -1, func(comment *models.Comment) int { return comment.Votes }))
+	e.POST("/topics/:topicid/posts/:postid/upvote", HandleVote(func(id models.IDs) models.Post {
+		return models.Post{Model: models.Model{ID: id.PostID}, TopicID: id.TopicID}
+	}, 1, func(post *models.Post) int { return post.Votes }))
+	e.POST("/topics/:topicid/posts/:postid/downvote", HandleVote(func(id models.IDs) models.Post {
+		return models.Post{Model: models.Model{ID: id.PostID}, TopicID: id.TopicID}
+	}, -1, func(post *models.Post) int { return post.Votes }))
+
+	api := API{Group: e.Group("/v1", JWTAuth, RateLimit(nil)), Spec: NewOpenAPI("/v1")}
+	api.POST("/token", HandleToken)
+	api.Spec.Document(http.MethodPost, "/token", http.StatusOK, false, reflect.TypeFor[LoginRequest](), reflect.TypeFor[*TokenResponse]())
+	// The image goes in the "file" field of a multipart form, which the
+	// spec's JSON request bodies cannot describe.
+	api.POST("/media", HandleUpload)
+	api.Spec.Document(http.MethodPost, "/media", http.StatusCreated, true, reflect.TypeFor[struct{}](), reflect.TypeFor[*models.Media]())
+	// The export is streamed rather than marshalled in one go.
+	api.GET("/users/:username/export", HandleExport)
+	api.Spec.Document(http.MethodGet, "/users/:username/export", http.StatusOK, true, reflect.TypeFor[ExportRequest](), reflect.TypeFor[*UserExport]())
+	api.GET("/openapi.json", func(c echo.Context) error { return c.JSON(http.StatusOK, api.Spec) })
+	api.GET("/docs", func(c echo.Context) error { return c.Render(http.StatusOK, "swagger", "/v1/openapi.json") })
+	Route(api, http.MethodPost, "/topics", http.StatusCreated, func(c context.Context, req CreateRequest[models.Topic]) (*models.Topic, error) {
+		return CreateTopic(c, CreateTopicRequest{ID: req.Model.ID, Description: req.Model.Description})
+	})
+	Route(api, http.MethodPut, "/topics/:topicid", http.StatusOK, func(c context.Context, req UpdateRequest[models.Topic]) (*models.Topic, error) {
+		if err := Moderate(c, req.TopicID); err != nil {
+			return nil, err
+		}
+		topic := models.Topic{Model: models.Model{ID: req.TopicID}}
+		err := Moderated(c, &models.ModAction{TopicID: req.TopicID, Action: models.ModEditTopic, Details: req.Mask.Description}, func(tx store.Store) error {
+			return tx.Update(c, &topic, models.Topic{Description: req.Mask.Description})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return store.Get(c, Store, topic)
+	})
+	Route(api, http.MethodPut, "/topics/:topicid/auto-pin", http.StatusOK, SetAutoPin)
+	Route(api, http.MethodGet, "/topics/:topicid", http.StatusOK, func(c context.Context, req GetRequest) (*models.Topic, error) {
+		return store.Get(c, Store, models.Topic{Model: models.Model{ID: req.TopicID}})
+	})
+	Route(api, http.MethodGet, "/home", http.StatusOK, HomeFeed)
+	Route(api, http.MethodGet, "/collections", http.StatusOK, Collections)
+	Route(api, http.MethodPost, "/collections", http.StatusCreated, CreateCollection)
+	Route(api, http.MethodGet, "/collections/:collection", http.StatusOK, GetCollection)
+	Route(api, http.MethodPut, "/collections/:collection", http.StatusOK, UpdateCollection)
+	Route(api, http.MethodDelete, "/collections/:collection", http.StatusNoContent, DeleteCollection)
+	Route(api, http.MethodGet, "/collections/:collection/posts", http.StatusOK, CollectionPosts)
+	Route(api, http.MethodGet, "/subscriptions", http.StatusOK, Subscriptions)
+	Route(api, http.MethodPut, "/topics/:topicid/subscription", http.StatusNoContent, Subscribe)
+	Route(api, http.MethodDelete, "/topics/:topicid/subscription", http.StatusNoContent, Unsubscribe)
+	Route(api, http.MethodGet, "/topics/:topicid/moderators", http.StatusOK, Moderators)
+	Route(api, http.MethodPost, "/topics/:topicid/moderators", http.StatusCreated, AddModerator)
+	Route(api, http.MethodDelete, "/topics/:topicid/moderators/:username", http.StatusNoContent, RemoveModerator)
+	Route(api, http.MethodPost, "/topics/:topicid/posts/:postid/reports", http.StatusCreated, FileReport)
+	Route(api, http.MethodPost, "/topics/:topicid/posts/:postid/comments/:commentid/reports", http.StatusCreated, FileReport)
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/saved", http.StatusNoContent, Save(true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/saved", http.StatusNoContent, Save(false))
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/comments/:commentid/saved", http.StatusNoContent, Save(true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/comments/:commentid/saved", http.StatusNoContent, Save(false))
+	Route(api, http.MethodGet, "/me/saved", http.StatusOK, SavedItems)
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/hidden", http.StatusNoContent, Hide(true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/hidden", http.StatusNoContent, Hide(false))
+	Route(api, http.MethodGet, "/me/hidden", http.StatusOK, HiddenPosts)
+	Route(api, http.MethodGet, "/topics/:topicid/reports", http.StatusOK, ModQueue)
+	Route(api, http.MethodPost, "/topics/:topicid/reports/:reportid/approve", http.StatusOK, ResolveReport(models.ReportApproved))
+	Route(api, http.MethodPost, "/topics/:topicid/reports/:reportid/remove", http.StatusOK, ResolveReport(models.ReportRemoved))
+	Route(api, http.MethodGet, "/topics/:topicid/modlog", http.StatusOK, ModLog)
+	Route(api, http.MethodGet, "/topics/:topicid/mod-stats", http.StatusOK, TopicModStats)
+	Route(api, http.MethodGet, "/topics/:topicid/health", http.StatusOK, TopicHealthScore)
+	Route(api, http.MethodGet, "/topics/:topicid/deleted", http.StatusOK, DeletedContent)
+	Route(api, http.MethodPost, "/topics/:topicid/restore", http.StatusOK, RestoreTopic)
+	Route(api, http.MethodPost, "/topics/:topicid/posts/:postid/restore", http.StatusOK, RestorePost)
+	Route(api, http.MethodPost, "/topics/:topicid/posts/:postid/comments/:commentid/restore", http.StatusOK, RestoreComment)
+	Route(api, http.MethodGet, "/topics/:topicid/automod", http.StatusOK, AutomodRules)
+	Route(api, http.MethodPost, "/topics/:topicid/automod", http.StatusCreated, CreateAutomodRule)
+	Route(api, http.MethodPut, "/topics/:topicid/automod/:ruleid", http.StatusOK, UpdateAutomodRule)
+	Route(api, http.MethodDelete, "/topics/:topicid/automod/:ruleid", http.StatusNoContent, DeleteAutomodRule)
+	Route(api, http.MethodGet, "/topics/:topicid/flairs", http.StatusOK, Flairs)
+	Route(api, http.MethodPost, "/topics/:topicid/flairs", http.StatusCreated, CreateFlair)
+	Route(api, http.MethodPut, "/topics/:topicid/flairs/:flairid", http.StatusOK, UpdateFlair)
+	Route(api, http.MethodDelete, "/topics/:topicid/flairs/:flairid", http.StatusNoContent, DeleteFlair)
+	Route(api, http.MethodGet, "/topics/:topicid/users/:username/flair", http.StatusOK, GetUserFlair)
+	Route(api, http.MethodPut, "/topics/:topicid/users/:username/flair", http.StatusOK, SetUserFlair)
+	Route(api, http.MethodDelete, "/topics/:topicid/users/:username/flair", http.StatusNoContent, RemoveUserFlair)
+	Route(api, http.MethodGet, "/topics/:topicid/filters", http.StatusOK, Filters)
+	Route(api, http.MethodPost, "/topics/:topicid/filters", http.StatusCreated, CreateFilter)
+	Route(api, http.MethodDelete, "/topics/:topicid/filters/:filterid", http.StatusNoContent, DeleteFilter)
+	Route(api, http.MethodGet, "/filters", http.StatusOK, Filters)
+	Route(api, http.MethodPost, "/filters", http.StatusCreated, CreateFilter)
+	Route(api, http.MethodDelete, "/filters/:filterid", http.StatusNoContent, DeleteFilter)
+	Route(api, http.MethodGet, "/admin/purge", http.StatusOK, PurgeStatus)
+	Route(api, http.MethodGet, "/admin/stats", http.StatusOK, Stats)
+	Route(api, http.MethodPost, "/admin/sitemap", http.StatusOK, RebuildSitemap)
+	Route(api, http.MethodGet, "/admin/users", http.StatusOK, AdminUsers)
+	Route(api, http.MethodGet, "/admin/reports", http.StatusOK, RecentReports)
+	Route(api, http.MethodGet, "/admin/evasion", http.StatusOK, EvasionQueue)
+	Route(api, http.MethodPost, "/admin/evasion/:reviewid/clear", http.StatusOK, ResolveEvasion(models.EvasionCleared))
+	Route(api, http.MethodPost, "/admin/evasion/:reviewid/confirm", http.StatusOK, ResolveEvasion(models.EvasionConfirmed))
+	Route(api, http.MethodGet, "/search", http.StatusOK, Search)
+	Route(api, http.MethodGet, "/trending", http.StatusOK, Trending)
+	Route(api, http.MethodGet, "/stats", http.StatusOK, Activity)
+	Route(api, http.MethodGet, "/notifications", http.StatusOK, Notifications)
+	Route(api, http.MethodPost, "/notifications/read", http.StatusNoContent, MarkAllRead)
+	Route(api, http.MethodPost, "/notifications/:notificationid/read", http.StatusOK, MarkRead)
+	Route(api, http.MethodGet, "/users/:username/posts", http.StatusOK, UserPosts)
+	Route(api, http.MethodGet, "/users/:username/comments", http.StatusOK, UserComments)
+	Route(api, http.MethodPut, "/users/:username/shadowban", http.StatusNoContent, Shadowban(true))
+	Route(api, http.MethodDelete, "/users/:username/shadowban", http.StatusNoContent, Shadowban(false))
+	Route(api, http.MethodPut, "/users/:username/ban", http.StatusNoContent, Ban(true))
+	Route(api, http.MethodDelete, "/users/:username/ban", http.StatusNoContent, Ban(false))
+	Route(api, http.MethodGet, "/blocks", http.StatusOK, Blocks)
+	Route(api, http.MethodPut, "/users/:username/block", http.StatusNoContent, BlockUser)
+	Route(api, http.MethodDelete, "/users/:username/block", http.StatusNoContent, UnblockUser)
+	Route(api, http.MethodPost, "/messages", http.StatusCreated, SendMessage)
+	Route(api, http.MethodGet, "/messages", http.StatusOK, Conversations)
+	Route(api, http.MethodGet, "/messages/:username", http.StatusOK, ConversationWith)
+	Route(api, http.MethodPost, "/messages/:username/read", http.StatusNoContent, MarkConversationRead)
+	Route(api, http.MethodGet, "/topics", http.StatusOK, func(c context.Context, req ListRequest) (*models.ListResponse[models.Topic], error) {
+		return store.List(c, Store, models.Topic{}, req.PageRequest)
+	})
+	Route(api, http.MethodDelete, "/topics/:topicid", http.StatusNoContent, DeleteTopic)
+	Route(api, http.MethodPost, "/topics/:topicid/posts", http.StatusCreated, func(c context.Context, req CreateRequest[models.Post]) (*models.Post, error) {
+		post := &models.Post{Model: models.Model{ID: uuid.NewString()}, TopicID: req.TopicID, AuthorID: CurrentUser(c).ID, Title: req.Model.Title, Kind: req.Model.Kind, URL: req.Model.URL, MediaID: req.Model.MediaID, FlairID: req.Model.FlairID, NSFW: req.Model.NSFW, Spoiler: req.Model.Spoiler, Poll: req.Model.Poll, PollClosesAt: req.Model.PollClosesAt, Content: req.Model.Content}
+		if err := Submit(c, post, CurrentUser(c)); err != nil {
+			return nil, err
+		}
+		OnCreate(c, post, CurrentUser(c))
+		return post, nil
+	})
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid", http.StatusOK, EditPost)
+	Route(api, http.MethodGet, "/topics/:topicid/posts/:postid/revisions", http.StatusOK, PostRevisions)
+	Route(api, http.MethodGet, "/topics/:topicid/recently-edited", http.StatusOK, RecentlyEdited)
+	Route(api, http.MethodGet, "/topics/:topicid/posts/:postid", http.StatusOK, func(c context.Context, req GetRequest) (*models.Post, error) {
+		post, err := store.Get(c, Store, models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID}, "Media", "Flair")
+		if err != nil {
+			return nil, err
+		} else if hidden, err := HiddenFrom(c, post.AuthorID, post.Shadowbanned); err != nil {
+			return nil, err
+		} else if hidden {
+			return nil, store.ErrNotFound
+		}
+		LinkMedia(post.Media)
+		post.Views += Views.Pending(req.IDs)
+		if err := AttachPoll(c, post); err != nil {
+			return nil, err
+		}
+		if err := AttachOriginal(c, post); err != nil {
+			return nil, err
+		}
+		return post, AttachPreview(c, post)
+	}, Viewed)
+	Route(api, http.MethodGet, "/topics/:topicid/posts/:postid/crossposts", http.StatusOK, ListCrossposts)
+	Route(api, http.MethodPost, "/topics/:topicid/posts/:postid/crossposts", http.StatusCreated, Crosspost)
+	Route(api, http.MethodPost, "/topics/:topicid/posts/:postid/poll/vote", http.StatusOK, VotePoll)
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/nsfw", http.StatusNoContent, MarkPost("nsfw", true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/nsfw", http.StatusNoContent, MarkPost("nsfw", false))
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/spoiler", http.StatusNoContent, MarkPost("spoiler", true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/spoiler", http.StatusNoContent, MarkPost("spoiler", false))
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/pinned", http.StatusNoContent, Pin(true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/pinned", http.StatusNoContent, Pin(false))
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/locked", http.StatusNoContent, Lock(true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/locked", http.StatusNoContent, Lock(false))
+	Route(api, http.MethodGet, "/topics/:topicid/pinned", http.StatusOK, PinnedPosts)
+	Route(api, http.MethodGet, "/topics/:topicid/posts", http.StatusOK, func(c context.Context, req ListRequest) (*models.ListResponse[models.Post], error) {
+		order, err := TopicOrder(req.SortRequest)
+		if err != nil {
+			return nil, err
+		}
+		list, err := store.List(c, Store, models.Post{TopicID: req.TopicID, FlairID: req.Flair}, req.PageRequest, store.Preload("Flair"), order, SafeForWork(req.IncludeNSFW), Visible(c), Unhidden(c))
+		if err != nil {
+			return nil, err
+		}
+		return list, AttachPreviews(c, list.Items)
+	})
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid", http.StatusNoContent, func(c context.Context, req DeleteRequest) (*models.Post, error) {
+		post := models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID}
+		action, err := OwnedOrModerated(c, post, req.TopicID, func(p *models.Post) string { return p.AuthorID })
+		if err != nil {
+			return nil, err
+		} else if action != nil {
+			action.Action, action.PostID = models.ModRemove, req.PostID
+		}
+		return nil, Moderated(c, action, func(tx store.Store) error {
+			return DeletePost(c, tx, req.TopicID, req.PostID)
+		})
+	})
+	Route(api, http.MethodPost, "/topics/:topicid/posts/:postid/comments", http.StatusCreated, func(c context.Context, req CreateRequest[models.Comment]) (*models.Comment, error) {
+		if _, err := store.Get(c, Store, models.Post{Model: models.Model{ID: req.PostID}, TopicID: req.TopicID}); err != nil {
+			return nil, err
+		}
+		comment := &models.Comment{Model: models.Model{ID: uuid.NewString()}, TopicID: req.TopicID, PostID: req.PostID, ParentCommentID: req.Model.ParentCommentID, AuthorID: CurrentUser(c).ID, Content: req.Model.Content}
+		if err := Submit(c, comment, CurrentUser(c)); err != nil {
+			return nil, err
+		}
+		OnCreate(c, comment, CurrentUser(c))
+		return comment, nil
+	})
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/comments/:commentid", http.StatusOK, EditComment)
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/comments/:commentid/stickied", http.StatusNoContent, Sticky(true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/comments/:commentid/stickied", http.StatusNoContent, Sticky(false))
+	Route(api, http.MethodPut, "/topics/:topicid/posts/:postid/comments/:commentid/distinguished", http.StatusNoContent, Distinguish(true))
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/comments/:commentid/distinguished", http.StatusNoContent, Distinguish(false))
+	Route(api, http.MethodGet, "/topics/:topicid/posts/:postid/comments/:commentid", http.StatusOK, func(c context.Context, req GetRequest) (*models.Comment, error) {
+		comment, err := store.Get(c, Store, models.Comment{Model: models.Model{ID: req.CommentID}, TopicID: req.TopicID, PostID: req.PostID})
+		if err != nil {
+			return nil, err
+		} else if hidden, err := HiddenFrom(c, comment.AuthorID, comment.Shadowbanned); err != nil {
+			return nil, err
+		} else if hidden {
+			return nil, store.ErrNotFound
+		}
+		return comment, nil
+	})
+	Route(api, http.MethodGet, "/topics/:topicid/posts/:postid/comments", http.StatusOK, func(c context.Context, req ListRequest) (*models.ListResponse[models.Comment], error) {
+		order, err := store.CommentOrder(req.SortRequest)
+		if err != nil {
+			return nil, err
+		}
+		return store.List(c, Store, models.Comment{TopicID: req.TopicID, PostID: req.PostID}, req.PageRequest, order, Visible(c))
+	})
+	Route(api, http.MethodDelete, "/topics/:topicid/posts/:postid/comments/:commentid", http.StatusNoContent, func(c context.Context, req DeleteRequest) (*models.Comment, error) {
+		comment := models.Comment{Model: models.Model{ID: req.CommentID}, TopicID: req.TopicID, PostID: req.PostID}
+		action, err := OwnedOrModerated(c, comment, req.TopicID, func(c *models.Comment) string { return c.AuthorID })
+		if err != nil {
+			return nil, err
+		} else if action != nil {
+			action.Action, action.PostID, action.CommentID = models.ModRemove, req.PostID, req.CommentID
+		}
+		return nil, Moderated(c, action, func(tx store.Store) error {
+			if _, err := store.Delete(c, tx, comment); err != nil {
+				return err
+			}
+			return RecountComments(c, tx, req.TopicID, req.PostID)
+		})
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type SavedRequest struct {
+	models.PageRequest
+	Type string `query:"type"`
+}
+
+// SavedList is a page of saved items along with the type they were filtered
+// by, if any.
+type SavedList struct {
+	models.ListResponse[models.Saved]
+	Type string `json:"type,omitempty"`
+}
+
+func (r SavedRequest) Validate() error {
+	if !slices.Contains([]string{"", "post", "comment"}, r.Type) {
+		return FieldErrors{"type": "must be post or comment, or empty for both"}
+	}
+	return nil
+}
+
+// SavedByUser maps "postID/commentID" to whether the user saved it, like
+// VotesByUser.
+func SavedByUser(c context.Context, user *models.User, topicID string, postID string) (map[string]bool, error) {
+	saved := map[string]bool{}
+	if user == nil {
+		return saved, nil
+	}
+	rows, err := store.Find(c, Store, models.Saved{UserID: user.ID, TopicID: topicID, PostID: postID})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		saved[row.PostID+"/"+row.CommentID] = true
+	}
+	return saved, nil
+}
+
+// Save saves or unsaves a post or comment for the current user. Saving twice
+// does nothing.
+func Save(save bool) func(context.Context, models.IDs) (*models.Saved, error) {
+	return func(c context.Context, req models.IDs) (*models.Saved, error) {
+		user := CurrentUser(c)
+		if user == nil {
+			return nil, ErrNotLoggedIn
+		}
+		id := models.Saved{UserID: user.ID, TopicID: req.TopicID, PostID: req.PostID, CommentID: req.CommentID}
+		if !save {
+			_, err := store.Delete(c, Store, id, store.Where("comment_id", "=", req.CommentID))
+			return nil, err
+		}
+		if _, _, err := findTarget(c, Store, req, Visible(c)); err != nil {
+			return nil, err
+		}
+		if count, err := Store.Count(c, &models.Saved{}, &id, store.Where("comment_id", "=", req.CommentID)); err != nil || count > 0 {
+			return nil, err
+		}
+		return nil, Store.Create(c, &id)
+	}
+}
+
+// SavedItems lists what the current user saved, newest first, with the saved
+// content. Content that is gone since is left out of its item.
+func SavedItems(c context.Context, req SavedRequest) (*SavedList, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	scopes := []store.Scope{store.OrderBy("created_at DESC")}
+	switch req.Type {
+	case "post":
+		scopes = append(scopes, store.Where("comment_id", "=", ""))
+	case "comment":
+		scopes = append(scopes, store.Where("comment_id", "<>", ""))
+	}
+	list, err := store.List(c, Store, models.Saved{UserID: user.ID}, req.PageRequest, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		saved := &list.Items[i]
+		saved.Post, saved.Comment, err = findTarget(c, Store, models.IDs{TopicID: saved.TopicID, PostID: saved.PostID, CommentID: saved.CommentID}, Visible(c))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+	}
+	return &SavedList{ListResponse: *list, Type: req.Type}, nil
+}
+func HandleSaved(c echo.Context) error {
+	if CurrentUser(c.Request().Context()) == nil {
+		return c.Redirect(http.StatusFound, "/login")
+	}
+	var req SavedRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	if err := req.Validate(); err != nil {
+		return Fail(c, err)
+	}
+	list, err := SavedItems(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	list.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "saved", list)
+}
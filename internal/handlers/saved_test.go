@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestSaved saves and unsaves posts and comments over v1 and the forms, and
+// lists them back.
+func TestSaved(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "First"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: alice.ID, Title: "Second"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: alice.ID, Content: "A comment"},
+	)
+	for _, tc := range []struct {
+		what, method, path, token string
+		want                      int
+	}{
+		{"save signed out", http.MethodPut, "/v1/topics/golang/posts/p1/saved", "", http.StatusUnauthorized},
+		{"save a missing post", http.MethodPut, "/v1/topics/golang/posts/p9/saved", aliceToken, http.StatusNotFound},
+		{"save a missing comment", http.MethodPut, "/v1/topics/golang/posts/p1/comments/c9/saved", aliceToken, http.StatusNotFound},
+		{"save p1", http.MethodPut, "/v1/topics/golang/posts/p1/saved", aliceToken, http.StatusNoContent},
+		{"save p1 again", http.MethodPut, "/v1/topics/golang/posts/p1/saved", aliceToken, http.StatusNoContent},
+		{"save c1", http.MethodPut, "/v1/topics/golang/posts/p1/comments/c1/saved", aliceToken, http.StatusNoContent},
+	} {
+		if rec := call(t, e, tc.method, tc.path, tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	if rec := postForm(e, "/topics/golang/posts/p2/save", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("save p2 through the form: got %d", rec.Code)
+	}
+
+	saved := func(query string) string {
+		t.Helper()
+		var list SavedList
+		if rec := call(t, e, http.MethodGet, "/v1/me/saved"+query, aliceToken, nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("saved%s: %d", query, rec.Code)
+		}
+		var items []string
+		for _, item := range list.Items {
+			switch {
+			case item.Comment != nil:
+				items = append(items, item.Comment.Content)
+			case item.Post != nil:
+				items = append(items, item.Post.Title)
+			default:
+				items = append(items, "gone")
+			}
+		}
+		return fmt.Sprint(items)
+	}
+	for query, want := range map[string]string{"": "[Second A comment First]", "?type=post": "[Second First]", "?type=comment": "[A comment]", "?limit=1&offset=1": "[A comment]"} {
+		if got := saved(query); got != want {
+			t.Errorf("saved%s: got %s, want %s", query, got, want)
+		}
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/me/saved?type=user", aliceToken, nil, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("saved of an unknown type: got %d", rec.Code)
+	}
+
+	page := func(path string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(login(t, alice))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	if body := page("/topics/golang/posts/p1"); strings.Count(body, `data-saved="true"`) != 2 {
+		t.Errorf("the post page does not show p1 and c1 saved: %s", body)
+	}
+	if body := page("/saved?type=comment"); !strings.Contains(body, "#comment-c1") || strings.Contains(body, "/posts/p2\"") {
+		t.Errorf("the saved comments page: %s", body)
+	}
+
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/posts/p1/saved", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("unsave p1: got %d", rec.Code)
+	}
+	if got := saved(""); got != "[Second A comment]" {
+		t.Errorf("unsaving p1 touched its comment: got %s", got)
+	}
+	call(t, e, http.MethodDelete, "/v1/topics/golang/posts/p2", aliceToken, nil, nil)
+	if got := saved(""); got != "[gone A comment]" {
+		t.Errorf("saved after deleting p2: got %s", got)
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/comments/c1/unsave", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("unsave c1 through the form: got %d", rec.Code)
+	}
+	if got := saved(""); got != "[gone]" {
+		t.Errorf("saved at the end: got %s", got)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type TopicPostsRequest struct {
+	ListRequest
+	After string `query:"after"`
+}
+
+// PostPage is a stretch of a topic's posts loaded as the reader scrolls,
+// with the cursor and URL of the next one.
+type PostPage struct {
+	Posts []models.Post `json:"items"`
+	After string        `json:"after,omitempty"`
+	More  string        `json:"next,omitempty"`
+}
+
+// TopicPosts lists the topic's posts after the cursor, or from the offset
+// when there is none.
+func TopicPosts(c context.Context, req TopicPostsRequest) (*PostPage, error) {
+	if req.After != "" {
+		req.PageToken = req.After
+	}
+	if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: req.TopicID}}); err != nil {
+		return nil, err
+	}
+	list, err := topicPosts(c, req.ListRequest)
+	if err != nil {
+		return nil, err
+	}
+	page := &PostPage{Posts: list.Items}
+	if list.NextPageToken != "" {
+		page.After = list.NextPageToken
+		page.More = PostsURL(req.TopicID, req.SortRequest, req.Flair, list.Limit, page.After)
+	}
+	return page, nil
+}
+
+// ListingColumns are the post columns a listing shows, leaving out the
+// bodies it never renders.
+var ListingColumns = []string{"id", "topic_id", "title", "author_id", "kind", "url", "media_id", "crosspost_topic", "crosspost_of", "flair_id", "nsfw", "spoiler", "pinned", "locked", "votes", "ups", "downs", "comment_count", "shadowbanned", "edited_at", "created_at", "updated_at", "deleted_at"}
+
+// TopicOrder orders a topic's listing. Votes only decay in it when
+// models.Decay is set for topics too.
+func TopicOrder(sort models.SortRequest) (store.Scope, error) {
+	if models.Decay.Topics {
+		return store.DecayedPostOrder(sort)
+	}
+	return store.PostOrder(sort)
+}
+
+// topicPosts lists a page of the topic's posts, or of those with the
+// flair, with the viewer's votes. Pinned posts are listed apart, by
+// PinnedPosts.
+func topicPosts(c context.Context, req ListRequest) (*models.ListResponse[models.Post], error) {
+	order, err := TopicOrder(req.SortRequest)
+	if err != nil {
+		return nil, err
+	}
+	list, err := store.List(c, Store, models.Post{TopicID: req.TopicID, FlairID: req.Flair}, req.PageRequest, store.Select(ListingColumns...), store.Preload("Author", "Flair"), store.Where("pinned", "=", false), order, Visible(c), Unhidden(c))
+	if err != nil {
+		return nil, err
+	}
+	return list, annotateListing(c, req.TopicID, list.Items)
+}
+
+// annotateListing sets the previews, author flairs and viewer's votes on
+// posts listed in a topic.
+func annotateListing(c context.Context, topicID string, posts []models.Post) error {
+	if err := AttachPreviews(c, posts); err != nil {
+		return err
+	}
+	if err := AttachUserFlairs(c, topicID, posts, nil); err != nil {
+		return err
+	}
+	votes, err := VotesByUser(c, CurrentUser(c), topicID, "")
+	for i := range posts {
+		posts[i].MyVote = votes[posts[i].ID+"/"]
+	}
+	return err
+}
+
+// PostsURL is where the page of the topic's posts after the cursor is
+// loaded from, in the same order and with the same flair.
+func PostsURL(topicID string, sort models.SortRequest, flair string, limit int, after string) string {
+	query := url.Values{"after": {after}, "limit": {strconv.Itoa(limit)}}
+	if flair != "" {
+		query.Set("flair", flair)
+	}
+	if sort.Sort != "" {
+		query.Set("sort", sort.Sort)
+	}
+	if sort.Window != "" {
+		query.Set("t", sort.Window)
+	}
+	return TopicURL(topicID) + "/posts?" + query.Encode()
+}
+
+// HandleTopicPosts answers HTMX with the rendered posts, ending in the
+// element that loads the next page once scrolled into view, and anything
+// else with JSON.
+func HandleTopicPosts(c echo.Context) error {
+	var req TopicPostsRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	page, err := TopicPosts(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	if IsHTMX(c) {
+		return c.Render(http.StatusOK, "posts", page)
+	}
+	return c.JSON(http.StatusOK, page)
+}
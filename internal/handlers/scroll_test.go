@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestTopicPosts scrolls through a topic's posts two at a time, as JSON and
+// as HTMX fragments.
+func TestTopicPosts(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, _ := newUser(t, "alice")
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+	for i := range 5 {
+		create(t, &models.Post{Model: models.Model{ID: fmt.Sprintf("p%d", i+1), CreatedAt: time.Now().Add(time.Duration(i-5) * time.Minute)}, TopicID: "golang", AuthorID: alice.ID, Title: fmt.Sprintf("Post %d", i+1)})
+	}
+
+	var ids, afters []string
+	next, pages := "/topics/golang/posts?sort=new&limit=2", 0
+	for next != "" {
+		var page PostPage
+		if rec := call(t, e, http.MethodGet, next, "", nil, &page); rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", next, rec.Code, rec.Body)
+		}
+		for _, post := range page.Posts {
+			ids = append(ids, post.ID)
+		}
+		if page.More != "" && !strings.Contains(page.More, "sort=new") {
+			t.Errorf("the next page loses the sort: %s", page.More)
+		}
+		next, pages, afters = page.More, pages+1, append(afters, page.After)
+	}
+	if got := fmt.Sprint(ids); got != "[p5 p4 p3 p2 p1]" || pages != 3 {
+		t.Errorf("scrolling by new: got %s over %d pages", got, pages)
+	}
+
+	ids = nil
+	for token := ""; ; {
+		var list models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts?sort=new&limit=2&pageToken="+token, "", nil, &list); rec.Code != http.StatusOK {
+			t.Fatalf("v1 page after %q: got %d %s", token, rec.Code, rec.Body)
+		}
+		for _, post := range list.Items {
+			ids = append(ids, post.ID)
+		}
+		if token = list.NextPageToken; token == "" {
+			break
+		}
+	}
+	if got := fmt.Sprint(ids); got != "[p5 p4 p3 p2 p1]" {
+		t.Errorf("following nextPageToken on v1: got %s", got)
+	}
+
+	htmx := func(path string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("HX-Request", "true")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", path, rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+	body := htmx("/topics/golang/posts?sort=new&limit=2&after=" + afters[0])
+	if !strings.Contains(body, ">Post 3</a>") || !strings.Contains(body, ">Post 2</a>") || strings.Contains(body, "Post 4") || !strings.Contains(body, `hx-get="/topics/golang/posts?after=`+afters[1]+`&amp;limit=2&amp;sort=new" hx-trigger="revealed"`) {
+		t.Errorf("the second page as HTMX: %s", body)
+	}
+	if body := htmx("/topics/golang/posts?sort=new&limit=2&after=" + afters[1]); !strings.Contains(body, "Post 1") || strings.Contains(body, "hx-trigger") {
+		t.Errorf("the last page as HTMX: %s", body)
+	}
+	if body := get(e, "/topics/golang?sort=new&limit=2").Body.String(); !strings.Contains(body, `hx-get="/topics/golang/posts?after=`+afters[0]) || !strings.Contains(body, "<noscript>") {
+		t.Errorf("the topic page does not load the second page: %s", body)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/topics/golang/posts?after=not-a-cursor!", http.StatusBadRequest},
+		{"/topics/golang/posts?after=" + base64.RawURLEncoding.EncodeToString([]byte(`{"o":-2}`)), http.StatusBadRequest},
+		{"/topics/golang/posts?sort=hot&after=" + afters[0], http.StatusBadRequest},
+		{"/topics/rust/posts", http.StatusNotFound},
+	} {
+		if rec := get(e, tc.path); rec.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.path, rec.Code, tc.want)
+		} else if tc.want == http.StatusBadRequest && !strings.Contains(rec.Body.String(), "invalid_page_token") {
+			t.Errorf("%s: got %s", tc.path, rec.Body)
+		}
+	}
+}
+
+// TestCommentCounts reads the comment counts on the listings and checks
+// the scroll JSON leaves out post bodies.
+func TestCommentCounts(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	bob, _ := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Subscription{UserID: bob.ID, TopicID: "golang"},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Busy", Content: "a long body"},
+		&models.Post{Model: models.Model{ID: "p2", CreatedAt: time.Now().Add(-time.Hour)}, TopicID: "golang", AuthorID: alice.ID, Title: "Quiet"},
+	)
+	for _, content := range []string{"one", "two"} {
+		if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments", aliceToken, map[string]any{"model": map[string]any{"content": content}}, nil); rec.Code != http.StatusCreated {
+			t.Fatalf("comment: %d", rec.Code)
+		}
+	}
+
+	var page PostPage
+	if rec := call(t, e, http.MethodGet, "/topics/golang/posts?sort=new", "", nil, &page); rec.Code != http.StatusOK {
+		t.Fatalf("scroll: got %d %s", rec.Code, rec.Body)
+	}
+	if len(page.Posts) != 2 || page.Posts[0].CommentCount != 2 || page.Posts[1].CommentCount != 0 || page.Posts[0].Content != "" || page.Posts[0].Title != "Busy" {
+		t.Errorf("scroll: got %+v", page.Posts)
+	}
+	var post models.Post
+	if call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1", "", nil, &post); post.Content != "a long body" {
+		t.Errorf("the post itself lost its body: %+v", post)
+	}
+
+	html := func(path string, user *models.User) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != nil {
+			req.AddCookie(login(t, user))
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	for _, tc := range []struct {
+		what, path string
+		user       *models.User
+		want       string
+	}{
+		{"the topic page", "/topics/golang", nil, `#comments">2 comments</a>`},
+		{"the home feed", "/", bob, `#comments">2 comments</a>`},
+		{"an empty post", "/topics/golang", alice, `#comments">0 comments</a>`},
+	} {
+		if body := html(tc.path, tc.user); !strings.Contains(body, tc.want) {
+			t.Errorf("%s lacks %s: %s", tc.what, tc.want, body)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+type SearchRequest struct {
+	models.PageRequest
+	Query   string `query:"q"`
+	TopicID string `query:"topic"`
+}
+type SearchPage struct {
+	SearchRequest
+	Results *models.ListResponse[models.SearchResult]
+}
+
+func Search(c context.Context, req SearchRequest) (*models.ListResponse[models.SearchResult], error) {
+	return Store.Search(c, req.Query, req.TopicID, req.PageRequest, Visible(c))
+}
+func HandleSearch(c echo.Context) error {
+	var req SearchRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	page := SearchPage{SearchRequest: req}
+	if strings.TrimSpace(req.Query) != "" {
+		results, err := Search(c.Request().Context(), req)
+		if err != nil {
+			return Fail(c, err)
+		}
+		results.Link(c.Request().URL)
+		page.Results = results
+	}
+	return c.Render(http.StatusOK, "search", page)
+}
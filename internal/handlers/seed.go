@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// SeedPassword is the password of every user Seed creates.
+const SeedPassword = "password"
+
+var seedUsers = []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi", "ivan", "judy", "mallory", "oscar"}
+
+var seedTopics = []struct {
+	ID          string
+	Description string
+	Posts       [][2]string
+}{
+	{"golang", "News and discussion about the Go programming language.", [][2]string{
+		{"Go 1.22 loop variables finally behave", "Every iteration gets its own variable now. Which of your `x := x` lines are you deleting first?"},
+		{"How do you structure a medium-sized service?", "We have about 40k lines in one `internal` package and it is getting hard to navigate. What layouts worked for you?"},
+		{"Generics one year in: where did they actually help?", "Mostly I use them for small helpers like `Map` and typed caches. Curious where they paid off for others."},
+		{"Is GORM worth it over database/sql?", "Starting a new project and torn between the convenience and the surprises."},
+		{"TIL about `errors.Join`", "Handy for collecting every validation failure instead of stopping at the first one."},
+		{"Share your favourite small standard library package", "Mine is `text/tabwriter`, it makes CLI output look tidy for free."},
+	}},
+	{"cooking", "Recipes, techniques and kitchen disasters.", [][2]string{
+		{"My first sourdough loaf actually rose", "Ten days of feeding the starter and it finally happened. Crumb shot in the comments."},
+		{"What is one cheap tool that improved your cooking?", "For me it was an instant-read thermometer. No more guessing on chicken."},
+		{"Weeknight dinners under 30 minutes", "Looking for ideas that do not involve pasta for the fourth time this week."},
+		{"Why does my risotto turn out gluey?", "I stir constantly and add stock a ladle at a time, but it always ends up like paste."},
+		{"Cast iron: soap or no soap?", "Let's settle this once and for all."},
+		{"Made stock from a week of vegetable scraps", "Onion skins, carrot ends and parsley stems. Honestly better than the carton."},
+	}},
+	{"books", "What are you reading?", [][2]string{
+		{"Books that changed how you think", "Not necessarily the best written, just the ones that stuck with you."},
+		{"Finished Middlemarch after three attempts", "The first hundred pages are a wall, but it is worth it."},
+		{"Audiobooks count as reading, fight me", "I get through twice as many books on my commute."},
+		{"Looking for science fiction with good worldbuilding", "Already read the Expanse and Hyperion. What next?"},
+		{"Do you finish books you are not enjoying?", "I used to push through everything, lately I give up at page 50."},
+		{"Monthly reading thread", "Tell us what you read this month and whether you would recommend it."},
+	}},
+	{"gardening", "Growing things, indoors and out.", [][2]string{
+		{"Tomatoes splitting after rain", "Every heavy rain and half the crop cracks. Anything to be done?"},
+		{"First harvest from the balcony", "Three pots of herbs and a chilli plant, small but very satisfying."},
+		{"Best plants for a shady corner?", "North-facing yard that gets maybe two hours of sun."},
+		{"Composting in an apartment", "Has anyone had luck with a worm bin indoors? Worried about the smell."},
+		{"Slugs ate all my lettuce overnight", "Beer traps, copper tape or just accept defeat?"},
+		{"Seed starting setup on a budget", "Shop lights and a heat mat got me through this spring."},
+	}},
+	{"meta", "Feedback and announcements about this site.", [][2]string{
+		{"Welcome! Read this before posting", "Be kind, stay on topic and report anything that breaks the rules."},
+		{"Dark mode when?", "My eyes at 2am would appreciate it."},
+		{"Feature request: saved searches", "It would be nice to get notified when new posts match a query."},
+		{"Bug: vote count flickers on refresh", "Happens maybe one time in ten on the post page."},
+		{"What topics should we add next?", "Suggest communities you would like to see here."},
+		{"Thanks to the moderators", "Just wanted to say the place feels friendly, keep it up."},
+	}},
+}
+
+var seedReplies = []string{
+	"This is exactly what I needed today, thanks for posting.",
+	"I had the same problem and ended up giving up, so good to see it solved.",
+	"Strongly disagree, but I can see where you are coming from.",
+	"Do you have a source for that?",
+	"Came here to say this.",
+	"Underrated comment.",
+	"I tried this last week and it worked better than expected.",
+	"Honestly it depends on the situation, there is no single right answer.",
+	"Can you share more details? Hard to say without knowing your setup.",
+	"This thread is a goldmine.",
+	"Counterpoint: the old way was fine and nobody complained.",
+	"Saving this for later.",
+	"Same here! Glad I am not the only one.",
+	"Wait, really? I always thought it was the other way around.",
+	"My experience was the complete opposite.",
+	"Good question, following.",
+	"This made me laugh more than it should have.",
+	"I would add one thing: take it slowly at first.",
+}
+
+// Seed fills the store with sample users, topics, posts, threaded comments
+// and votes so the UI and rankings have something to show locally. Every
+// choice comes from a fixed random seed and every ID is derived from it, so
+// running it again only creates what is missing.
+func Seed(c context.Context) error {
+	rng := rand.New(rand.NewPCG(805, 1))
+	users := make([]*models.User, len(seedUsers))
+	for i, name := range seedUsers {
+		user, err := UserByName(c, name)
+		if errors.Is(err, store.ErrNotFound) {
+			user, err = CreateUser(c, name, SeedPassword)
+		}
+		if err != nil {
+			return err
+		}
+		users[i] = user
+	}
+	now := time.Now()
+	var posts, comments, votes int
+	for i, topic := range seedTopics {
+		_, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: topic.ID}})
+		if errors.Is(err, store.ErrNotFound) {
+			_, err = CreateTopic(WithUser(c, users[i]), CreateTopicRequest{ID: topic.ID, Description: topic.Description})
+		}
+		if err != nil {
+			return err
+		}
+		for j, content := range topic.Posts {
+			author := users[rng.IntN(len(users))]
+			// Most posts are recent, a few are weeks old, so hot and top
+			// rank them differently.
+			created := now.Add(-time.Duration(math.Min(rng.ExpFloat64()*3, 30) * float64(24*time.Hour)))
+			post := models.Post{Model: models.Model{ID: seedID(topic.ID, j), CreatedAt: created}, TopicID: topic.ID, AuthorID: author.ID, Title: content[0], Content: content[1]}
+			isNew, err := seedSubmit(c, &post, models.Post{Model: models.Model{ID: post.ID}, TopicID: topic.ID}, author)
+			if err != nil {
+				return err
+			}
+			if isNew {
+				posts++
+			}
+			cast, err := seedVotes(c, rng, users, &models.Post{Model: models.Model{ID: post.ID}, TopicID: topic.ID}, models.Vote{TopicID: topic.ID, PostID: post.ID}, isNew)
+			if err != nil {
+				return err
+			}
+			votes += cast
+			var thread []models.Comment
+			depths := map[string]int{}
+			for k, n := 0, rng.IntN(15); k < n; k++ {
+				commenter := users[rng.IntN(len(users))]
+				comment := models.Comment{TopicID: topic.ID, PostID: post.ID, AuthorID: commenter.ID, Content: seedReplies[rng.IntN(len(seedReplies))]}
+				comment.ID = seedID(topic.ID, j, k)
+				comment.CreatedAt = created.Add(time.Duration(rng.Float64() * float64(now.Sub(created))))
+				if len(thread) > 0 && rng.Float64() < 0.6 {
+					parent := thread[rng.IntN(len(thread))]
+					if depths[parent.ID] < models.MaxCommentDepth-1 && parent.CreatedAt.Before(comment.CreatedAt) {
+						comment.ParentCommentID, depths[comment.ID] = parent.ID, depths[parent.ID]+1
+					}
+				}
+				isNew, err := seedSubmit(c, &comment, models.Comment{Model: models.Model{ID: comment.ID}, TopicID: topic.ID, PostID: post.ID}, commenter)
+				if err != nil {
+					return err
+				}
+				if isNew {
+					comments++
+				}
+				cast, err := seedVotes(c, rng, users, &models.Comment{Model: models.Model{ID: comment.ID}, TopicID: topic.ID, PostID: post.ID}, models.Vote{TopicID: topic.ID, PostID: post.ID, CommentID: comment.ID}, isNew)
+				if err != nil {
+					return err
+				}
+				votes += cast
+				thread = append(thread, comment)
+			}
+		}
+	}
+	slog.Info("seeded the database", "users", len(users), "topics", len(seedTopics), "posts", posts, "comments", comments, "votes", votes)
+	return nil
+}
+
+// seedID derives a stable ID for the seeded post or comment at the given
+// position.
+func seedID(topicID string, position ...int) string {
+	name := "seed/" + topicID
+	for _, p := range position {
+		name += "/" + strconv.Itoa(p)
+	}
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)).String()
+}
+
+// seedSubmit submits obj unless the row key selects already exists, and
+// reports whether it did.
+func seedSubmit[T any](c context.Context, obj *T, key T, author *models.User) (bool, error) {
+	if _, err := store.Get(c, Store, key); !errors.Is(err, store.ErrNotFound) {
+		return false, err
+	}
+	return true, Submit(c, obj, author)
+}
+
+// seedVotes has each user vote on target with a chance drawn per target, so
+// some posts are loved, some ignored and some divisive. Votes are only cast
+// when cast is set, but the same draws are made either way to keep later
+// choices stable.
+func seedVotes(c context.Context, rng *rand.Rand, users []*models.User, target any, key models.Vote, cast bool) (int, error) {
+	turnout, approval := rng.Float64(), math.Max(0.05, math.Min(0.95, 0.65+rng.NormFloat64()*0.2))
+	votes := 0
+	for _, user := range users {
+		if rng.Float64() >= turnout {
+			continue
+		}
+		direction := 1
+		if rng.Float64() >= approval {
+			direction = -1
+		}
+		if !cast {
+			continue
+		}
+		key.UserID = user.ID
+		if _, err := Store.CastVote(c, target, key, direction); err != nil {
+			return votes, err
+		}
+		votes++
+	}
+	return votes, nil
+}
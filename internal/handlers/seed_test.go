@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestSeed seeds the store twice and checks the second run adds nothing.
+func TestSeed(t *testing.T) {
+	e := newServer(t)
+	c := context.Background()
+	counts := func() [4]int64 {
+		t.Helper()
+		var got [4]int64
+		for i, model := range []any{&models.User{}, &models.Topic{}, &models.Post{}, &models.Comment{}} {
+			n, err := Store.Count(c, model, model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[i] = n
+		}
+		return got
+	}
+	if err := Seed(c); err != nil {
+		t.Fatal(err)
+	}
+	seeded := counts()
+	if seeded[0] != 12 || seeded[1] != 5 || seeded[2] != 30 || seeded[3] == 0 {
+		t.Errorf("users, topics, posts and comments after seeding: got %v", seeded)
+	}
+	votes, err := Store.Count(c, &models.Vote{}, &models.Vote{})
+	if err != nil || votes == 0 {
+		t.Errorf("votes after seeding: got %d, %v", votes, err)
+	}
+	if err := Seed(c); err != nil {
+		t.Fatal(err)
+	}
+	if got := counts(); got != seeded {
+		t.Errorf("seeding again: got %v, want %v", got, seeded)
+	}
+	if again, _ := Store.Count(c, &models.Vote{}, &models.Vote{}); again != votes {
+		t.Errorf("votes after seeding again: got %d, want %d", again, votes)
+	}
+
+	var posts models.ListResponse[models.Post]
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts?sort=hot", "", nil, &posts); rec.Code != http.StatusOK || len(posts.Items) != 6 {
+		t.Errorf("golang by hot: got %d with %d posts", rec.Code, len(posts.Items))
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/token", "", LoginRequest{Username: "alice", Password: SeedPassword}, nil); rec.Code != http.StatusOK {
+		t.Errorf("log in as a seeded user: got %d %s", rec.Code, rec.Body)
+	}
+	comments, err := store.Find(c, Store, models.Comment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents := map[string]string{}
+	for _, comment := range comments {
+		parents[comment.ID] = comment.ParentCommentID
+	}
+	for id := range parents {
+		depth := 0
+		for parent := parents[id]; parent != ""; parent = parents[parent] {
+			depth++
+		}
+		if depth >= models.MaxCommentDepth {
+			t.Errorf("comment %s is nested %d deep", id, depth)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+type ShadowbanRequest struct {
+	Username string `param:"username"`
+}
+
+// Visible is the scope every listing of posts and comments goes through, so
+// that content by shadowbanned users only ever shows up for themselves.
+func Visible(c context.Context) store.Scope {
+	if user := CurrentUser(c); user != nil {
+		return store.VisibleTo(user.ID)
+	}
+	return store.VisibleTo("")
+}
+
+// HiddenFrom is Visible for a single post or comment: hidden when its
+// author is shadowbanned, unless they are the viewer, or blocked by the
+// viewer.
+func HiddenFrom(c context.Context, authorID string, shadowbanned bool) (bool, error) {
+	user := CurrentUser(c)
+	if user == nil || user.ID == authorID || shadowbanned {
+		return shadowbanned && (user == nil || user.ID != authorID), nil
+	}
+	return HasBlocked(c, Store, user.ID, authorID)
+}
+
+// Shadowban sets or lifts a user's shadowban, along with the flag on every
+// post and comment they have written, deleted ones included, and the
+// comment counts of the posts they commented on. Only site admins can do that.
+func Shadowban(ban bool) func(context.Context, ShadowbanRequest) (*models.User, error) {
+	return func(c context.Context, req ShadowbanRequest) (*models.User, error) {
+		if err := Administer(c); err != nil {
+			return nil, err
+		}
+		user, err := UserByName(c, req.Username)
+		if err != nil {
+			return nil, err
+		}
+		return nil, Store.Transaction(c, func(tx store.Store) error {
+			return setShadowbanned(c, tx, user, ban)
+		})
+	}
+}
+
+// setShadowbanned sets or lifts the shadowban of user and the content they
+// have written, without checking who asked.
+func setShadowbanned(c context.Context, tx store.Store, user *models.User, ban bool) error {
+	mask := map[string]any{"shadowbanned": ban}
+	if err := tx.Update(c, user, mask); err != nil {
+		return err
+	}
+	if err := tx.UpdateColumns(c, &models.Post{}, &models.Post{AuthorID: user.ID}, mask, store.Unscoped()); err != nil {
+		return err
+	}
+	if err := tx.UpdateColumns(c, &models.Comment{}, &models.Comment{AuthorID: user.ID}, mask, store.Unscoped()); err != nil {
+		return err
+	}
+	comments, err := store.Find(c, tx, models.Comment{AuthorID: user.ID}, store.Select("topic_id", "post_id"))
+	if err != nil {
+		return err
+	}
+	recount := map[[2]string]bool{}
+	for _, comment := range comments {
+		recount[[2]string{comment.TopicID, comment.PostID}] = true
+	}
+	for post := range recount {
+		if err := RecountComments(c, tx, post[0], post[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestShadowban bans a user over v1 and checks what they, another user and
+// anonymous visitors see, on the memory store and on sqlite, where search
+// also runs when FTS5 is available.
+func TestShadowban(t *testing.T) {
+	for _, driver := range []string{"memory", "sqlite"} {
+		t.Run(driver, func(t *testing.T) { testShadowban(t, driver) })
+	}
+}
+func testShadowban(t *testing.T, driver string) {
+	e := newServer(t)
+	search := false
+	if driver == "sqlite" {
+		s, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.DB.Logger = logger.Discard
+		if err := s.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		search = s.SetupSearch() == nil
+		Store = s
+	}
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"root"}
+	_, rootToken := newUser(t, "root")
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "pa"}, TopicID: "golang", AuthorID: alice.ID, Title: "Alice on generics"},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Bob on generics"},
+		&models.Post{Model: models.Model{ID: "gone", DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}}, TopicID: "golang", AuthorID: bob.ID, Title: "Deleted generics"},
+	)
+	comment := func(content string) {
+		t.Helper()
+		if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/pa/comments", bobToken, map[string]any{"model": map[string]string{"content": content}}, nil); rec.Code != http.StatusCreated {
+			t.Fatalf("comment: %d", rec.Code)
+		}
+	}
+	comment("generics before the ban")
+
+	for _, tc := range []struct {
+		what, token, username string
+		want                  int
+	}{
+		{"signed out", "", "bob", http.StatusUnauthorized},
+		{"as a non-admin", aliceToken, "bob", http.StatusForbidden},
+		{"an unknown user", rootToken, "nobody", http.StatusNotFound},
+		{"bob", rootToken, "bob", http.StatusNoContent},
+	} {
+		if rec := call(t, e, http.MethodPut, "/v1/users/"+tc.username+"/shadowban", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("shadowban %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	// flagged counts bob's posts and comments flagged, deleted ones included.
+	flagged := func() string {
+		t.Helper()
+		var counts []int64
+		for _, model := range []any{&models.Post{AuthorID: bob.ID}, &models.Comment{AuthorID: bob.ID}} {
+			n, err := Store.Count(context.Background(), model, model, store.Unscoped(), store.Where("shadowbanned", "=", true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts = append(counts, n)
+		}
+		return fmt.Sprint(counts)
+	}
+	if got := flagged(); got != "[2 1]" {
+		t.Errorf("bob's flagged posts and comments after the ban: got %s, want [2 1]", got)
+	}
+	var p2 models.Post
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, map[string]any{"model": map[string]string{"title": "More generics"}}, &p2); rec.Code != http.StatusCreated {
+		t.Fatalf("post while banned: %d", rec.Code)
+	}
+	comment("generics after the ban")
+	var notifications NotificationList
+	call(t, e, http.MethodGet, "/v1/notifications", aliceToken, nil, &notifications)
+	if notifications.Unread != 1 {
+		t.Errorf("alice was notified of %d comments, want only the one before the ban", notifications.Unread)
+	}
+
+	// seen lists, for the token, the posts and comments each listing shows.
+	seen := func(token string) string {
+		t.Helper()
+		var out []string
+		var posts models.ListResponse[models.Post]
+		call(t, e, http.MethodGet, "/v1/topics/golang/posts", token, nil, &posts)
+		var comments models.ListResponse[models.Comment]
+		call(t, e, http.MethodGet, "/v1/topics/golang/posts/pa/comments", token, nil, &comments)
+		var profile models.ListResponse[models.Post]
+		call(t, e, http.MethodGet, "/v1/users/bob/posts", token, nil, &profile)
+		out = append(out, fmt.Sprintf("posts:%d comments:%d profile:%d", posts.Total, comments.Total, profile.Total))
+		for _, path := range []string{"/v1/topics/golang/posts/p1", "/v1/topics/golang/posts/" + p2.ID} {
+			out = append(out, fmt.Sprint(call(t, e, http.MethodGet, path, token, nil, nil).Code))
+		}
+		if search {
+			var res models.ListResponse[models.SearchResult]
+			call(t, e, http.MethodGet, "/v1/search?q=generics", token, nil, &res)
+			out = append(out, fmt.Sprintf("search:%d", res.Total))
+		}
+		return strings.Join(out, " ")
+	}
+	hidden, shown := "posts:1 comments:0 profile:0 404 404", "posts:3 comments:2 profile:2 200 200"
+	if search {
+		hidden, shown = hidden+" search:1", shown+" search:5"
+	}
+	for who, want := range map[string]string{"anonymously": hidden, "as alice": hidden, "as bob": shown} {
+		token := map[string]string{"as alice": aliceToken, "as bob": bobToken}[who]
+		if got := seen(token); got != want {
+			t.Errorf("viewing %s while bob is banned: got %q, want %q", who, got, want)
+		}
+	}
+	rec := get(e, "/topics/golang/feed.rss")
+	if body := rec.Body.String(); strings.Contains(body, "Bob on generics") || !strings.Contains(body, "Alice on generics") {
+		t.Errorf("the feed while bob is banned: got %s", body)
+	}
+
+	if rec := call(t, e, http.MethodDelete, "/v1/users/bob/shadowban", rootToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("lift the shadowban: %d", rec.Code)
+	}
+	if got := seen(""); got != shown {
+		t.Errorf("viewing anonymously after the ban is lifted: got %q, want %q", got, shown)
+	}
+	if got := flagged(); got != "[0 0]" {
+		t.Errorf("bob's flagged posts and comments after the ban is lifted: got %s", got)
+	}
+	if user, err := UserByName(context.Background(), "bob"); err != nil || user.Shadowbanned {
+		t.Errorf("bob after the ban is lifted: %+v, %v", user, err)
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const SitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// SitemapMaxURLs is the most URLs the sitemap protocol allows per page.
+const SitemapMaxURLs = 50000
+
+// SitemapConfig has the sitemap rebuilt when it is requested more than
+// MaxAge after it was last built, with at most Size URLs per page.
+type SitemapConfig struct {
+	MaxAge time.Duration `yaml:"maxAge"`
+	Size   int           `yaml:"size"`
+}
+
+var Sitemap = SitemapConfig{MaxAge: time.Hour, Size: SitemapMaxURLs}
+
+type URLSet struct {
+	XMLName xml.Name     `xml:"urlset" json:"-"`
+	XMLNS   string       `xml:"xmlns,attr" json:"-"`
+	URLs    []SitemapURL `xml:"url"`
+}
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex" json:"-"`
+	XMLNS    string       `xml:"xmlns,attr" json:"-"`
+	Sitemaps []SitemapURL `xml:"sitemap" json:"sitemaps"`
+}
+type SitemapURL struct {
+	Loc     string `xml:"loc" json:"loc"`
+	LastMod string `xml:"lastmod,omitempty" json:"lastmod,omitempty"`
+}
+
+// Sitemaps is the sitemap index and its pages as last built.
+type Sitemaps struct {
+	Index SitemapIndex
+	Pages []URLSet
+	Built time.Time
+}
+
+var sitemapMu sync.Mutex
+var sitemaps *Sitemaps
+
+// CurrentSitemaps returns the sitemaps, building them first if they are
+// older than the configured MaxAge. Requests arriving during a build wait
+// for it rather than starting their own.
+func CurrentSitemaps(c context.Context) (*Sitemaps, error) {
+	sitemapMu.Lock()
+	defer sitemapMu.Unlock()
+	if sitemaps != nil && time.Since(sitemaps.Built) < Sitemap.MaxAge {
+		return sitemaps, nil
+	}
+	built, err := BuildSitemaps(c, Sitemap.Size)
+	if err != nil {
+		return nil, err
+	}
+	sitemaps = built
+	return sitemaps, nil
+}
+
+// BuildSitemaps lists every topic and every post visible to visitors,
+// with when each last changed, in pages of at most size URLs.
+func BuildSitemaps(c context.Context, size int) (*Sitemaps, error) {
+	topics, err := store.Find(c, Store, models.Topic{}, store.Select("id", "updated_at"), store.OrderBy("id"))
+	if err != nil {
+		return nil, err
+	}
+	var urls []SitemapURL
+	live := map[string]bool{}
+	for _, topic := range topics {
+		live[topic.ID] = true
+		urls = append(urls, SitemapURL{Loc: BaseURL + TopicURL(topic.ID), LastMod: lastMod(topic.UpdatedAt)})
+	}
+	const batch = 1000
+	for offset := 0; ; offset += batch {
+		posts, err := store.Find(c, Store, models.Post{}, store.Select("id", "topic_id", "updated_at"), store.Where("shadowbanned", "=", false), store.OrderBy("created_at", "id"), store.Page(models.PageRequest{Offset: offset, Limit: batch}))
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			if live[post.TopicID] {
+				urls = append(urls, SitemapURL{Loc: BaseURL + PostURL(post.TopicID, post.ID), LastMod: lastMod(post.UpdatedAt)})
+			}
+		}
+		if len(posts) < batch {
+			break
+		}
+	}
+	if size <= 0 || size > SitemapMaxURLs {
+		size = SitemapMaxURLs
+	}
+	built := &Sitemaps{Index: SitemapIndex{XMLNS: SitemapNS}, Built: time.Now()}
+	for start := 0; start < len(urls) || start == 0; start += size {
+		page := URLSet{XMLNS: SitemapNS, URLs: urls[start:min(start+size, len(urls))]}
+		latest := ""
+		for _, url := range page.URLs {
+			latest = max(latest, url.LastMod)
+		}
+		built.Pages = append(built.Pages, page)
+		built.Index.Sitemaps = append(built.Index.Sitemaps, SitemapURL{Loc: fmt.Sprintf("%s/sitemap/%d.xml", BaseURL, len(built.Pages)), LastMod: latest})
+	}
+	return built, nil
+}
+
+// RebuildSitemap builds the sitemaps now, for admins who do not want to
+// wait for MaxAge after a big change.
+func RebuildSitemap(c context.Context, _ struct{}) (*SitemapIndex, error) {
+	if err := Administer(c); err != nil {
+		return nil, err
+	}
+	built, err := BuildSitemaps(c, Sitemap.Size)
+	if err != nil {
+		return nil, err
+	}
+	sitemapMu.Lock()
+	sitemaps = built
+	sitemapMu.Unlock()
+	return &built.Index, nil
+}
+func lastMod(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func HandleSitemapIndex(c echo.Context) error {
+	built, err := CurrentSitemaps(c.Request().Context())
+	if err != nil {
+		return Fail(c, err)
+	}
+	return sitemapXML(c, built.Index)
+}
+func HandleSitemap(c echo.Context) error {
+	page, err := strconv.Atoi(strings.TrimSuffix(c.Param("page"), ".xml"))
+	if err != nil {
+		return Fail(c, store.ErrNotFound)
+	}
+	built, err := CurrentSitemaps(c.Request().Context())
+	if err != nil {
+		return Fail(c, err)
+	}
+	if page < 1 || page > len(built.Pages) {
+		return Fail(c, store.ErrNotFound)
+	}
+	return sitemapXML(c, built.Pages[page-1])
+}
+func sitemapXML(c echo.Context, v any) error {
+	body, err := xml.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return Fail(c, err)
+	}
+	return c.Blob(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
+
+// HandleRobots points crawlers at the sitemap.
+func HandleRobots(c echo.Context) error {
+	return c.String(http.StatusOK, "User-agent: *\nDisallow: /admin\nDisallow: /v1/\n\nSitemap: "+BaseURL+"/sitemap.xml\n")
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+)
+
+// TestSitemap pages the visible topics and posts, serves the built
+// sitemaps until they are older than MaxAge, and rebuilds them for admins.
+func TestSitemap(t *testing.T) {
+	e := newServer(t)
+	baseURL, config, built, admins := BaseURL, Sitemap, sitemaps, Admins
+	t.Cleanup(func() { BaseURL, Sitemap, sitemaps, Admins = baseURL, config, built, admins })
+	BaseURL, Sitemap, sitemaps, Admins = "https://example.com", SitemapConfig{MaxAge: time.Hour, Size: 3}, nil, []string{"alice"}
+	_, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	now := time.Now()
+	gone := models.Model{ID: "gone", DeletedAt: gorm.DeletedAt{Time: now, Valid: true}}
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.Topic{Model: gone},
+		&models.Post{Model: models.Model{ID: "p1", CreatedAt: now.Add(-3 * time.Hour)}, TopicID: "golang", Title: "First"},
+		&models.Post{Model: models.Model{ID: "r1", CreatedAt: now.Add(-2 * time.Hour)}, TopicID: "rust", Title: "Rusty"},
+		&models.Post{Model: models.Model{ID: "p2", CreatedAt: now.Add(-time.Hour)}, TopicID: "golang", Title: "Second"},
+		&models.Post{Model: models.Model{ID: "hidden"}, TopicID: "golang", Title: "Hidden", Shadowbanned: true},
+		&models.Post{Model: gone, TopicID: "golang", Title: "Deleted"},
+		&models.Post{Model: models.Model{ID: "orphan"}, TopicID: "gone", Title: "In a deleted topic"},
+	)
+
+	fetch := func(path string, out any) int {
+		t.Helper()
+		rec := get(e, path)
+		if rec.Code == http.StatusOK {
+			if got := rec.Header().Get("Content-Type"); got != "application/xml; charset=utf-8" {
+				t.Errorf("%s: got content type %q", path, got)
+			}
+			if err := xml.Unmarshal(rec.Body.Bytes(), out); err != nil {
+				t.Fatalf("%s: %v: %s", path, err, rec.Body)
+			}
+		}
+		return rec.Code
+	}
+	locs := func(urls []SitemapURL) string {
+		var got []string
+		for _, url := range urls {
+			got = append(got, strings.TrimPrefix(url.Loc, "https://example.com"))
+		}
+		return fmt.Sprint(got)
+	}
+	var index SitemapIndex
+	if code := fetch("/sitemap.xml", &index); code != http.StatusOK || locs(index.Sitemaps) != "[/sitemap/1.xml /sitemap/2.xml]" || index.XMLNS != SitemapNS {
+		t.Fatalf("the index: got %d %+v", code, index)
+	}
+	for page, want := range map[string]string{
+		"/sitemap/1.xml": "[/topics/golang /topics/rust /topics/golang/posts/p1]",
+		"/sitemap/2.xml": "[/topics/rust/posts/r1 /topics/golang/posts/p2]",
+	} {
+		var urls URLSet
+		if code := fetch(page, &urls); code != http.StatusOK || locs(urls.URLs) != want {
+			t.Errorf("%s: got %d %s, want %s", page, code, locs(urls.URLs), want)
+		}
+		for _, url := range urls.URLs {
+			if _, err := time.Parse(time.RFC3339, url.LastMod); err != nil {
+				t.Errorf("%s: %s has lastmod %q", page, url.Loc, url.LastMod)
+			}
+		}
+	}
+	for _, page := range []string{"/sitemap/0.xml", "/sitemap/3.xml", "/sitemap/one.xml"} {
+		if rec := get(e, page); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", page, rec.Code)
+		}
+	}
+
+	create(t, &models.Post{Model: models.Model{ID: "p3"}, TopicID: "golang", Title: "Third"})
+	var cached SitemapIndex
+	if fetch("/sitemap.xml", &cached); len(cached.Sitemaps) != 2 {
+		t.Errorf("the index within MaxAge: got %d pages, want the 2 built before", len(cached.Sitemaps))
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/admin/sitemap", bobToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("rebuild as a non-admin: got %d", rec.Code)
+	}
+	var rebuilt SitemapIndex
+	if rec := call(t, e, http.MethodPost, "/v1/admin/sitemap", aliceToken, nil, &rebuilt); rec.Code != http.StatusOK || len(rebuilt.Sitemaps) != 2 {
+		t.Errorf("rebuild as an admin: got %d %+v", rec.Code, rebuilt)
+	}
+	var last URLSet
+	if fetch("/sitemap/2.xml", &last); !strings.HasSuffix(locs(last.URLs), "/topics/golang/posts/p3]") {
+		t.Errorf("the last page after the rebuild: got %s", locs(last.URLs))
+	}
+	Sitemap.MaxAge = 0
+	create(t, &models.Post{Model: models.Model{ID: "p4"}, TopicID: "golang", Title: "Fourth"})
+	var expired SitemapIndex
+	if fetch("/sitemap.xml", &expired); len(expired.Sitemaps) != 3 {
+		t.Errorf("the index past MaxAge: got %d pages, want 3", len(expired.Sitemaps))
+	}
+
+	if rec := get(e, "/robots.txt"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Sitemap: https://example.com/sitemap.xml\n") || !strings.Contains(rec.Body.String(), "Disallow: /admin\n") {
+		t.Errorf("robots.txt: got %d %q", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+
+	"reddit-clone/internal/events"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const SocketWriteTimeout = 10 * time.Second
+
+type VoteCount struct {
+	TopicID   string `json:"topicID"`
+	PostID    string `json:"postID"`
+	CommentID string `json:"commentID,omitempty"`
+	Votes     int    `json:"votes"`
+}
+
+func TopicChannel(topicID string) string {
+	return "topic:" + topicID
+}
+
+// PublishVotes announces a new score to the post's page, and for posts to
+// their topic's page as well.
+func PublishVotes(id models.IDs, votes int) {
+	if Events == nil {
+		return
+	}
+	event := events.Event{Type: "vote", Data: VoteCount{TopicID: id.TopicID, PostID: id.PostID, CommentID: id.CommentID, Votes: votes}}
+	Events.Publish(PostChannel(id.TopicID, id.PostID), event)
+	if id.CommentID == "" {
+		Events.Publish(TopicChannel(id.TopicID), event)
+	}
+}
+
+// voteCount is the count a vote event carries, which arrives as JSON when
+// events come through Redis.
+func voteCount(event events.Event) (VoteCount, bool) {
+	switch data := event.Data.(type) {
+	case VoteCount:
+		return data, true
+	case json.RawMessage:
+		var count VoteCount
+		return count, event.Type == "vote" && json.Unmarshal(data, &count) == nil
+	}
+	return VoteCount{}, false
+}
+
+// HandleVoteSocket sends the vote counts of a topic page, or of a post page
+// when the route has a post, over a WebSocket. Counts that queue up while
+// the client is slow are collapsed to the latest one per post or comment,
+// and a client that cannot take a write within SocketWriteTimeout is
+// dropped.
+func HandleVoteSocket(c echo.Context) error {
+	var id models.IDs
+	if err := c.Bind(&id); err != nil {
+		return Fail(c, err)
+	}
+	channel := TopicChannel(id.TopicID)
+	var err error
+	if id.PostID != "" {
+		channel = PostChannel(id.TopicID, id.PostID)
+		_, err = store.Get(c.Request().Context(), Store, models.Post{Model: models.Model{ID: id.PostID}, TopicID: id.TopicID})
+	} else {
+		_, err = store.Get(c.Request().Context(), Store, models.Topic{Model: models.Model{ID: id.TopicID}})
+	}
+	if err != nil {
+		return Fail(c, err)
+	}
+	if Events == nil {
+		return Fail(c, NewError(Unavailable, "streams_unavailable", "live updates are unavailable"))
+	}
+	websocket.Handler(func(ws *websocket.Conn) {
+		sub, cancel := Events.Subscribe(channel)
+		defer cancel()
+		liveConnections.Inc("websocket")
+		defer liveConnections.Dec("websocket")
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, ws)
+			close(closed)
+		}()
+		for {
+			var event events.Event
+			var ok bool
+			select {
+			case <-closed:
+				return
+			case event, ok = <-sub:
+				if !ok {
+					return
+				}
+			}
+			latest := map[VoteCount]VoteCount{}
+			var order []VoteCount
+			for pending := true; pending; {
+				if count, isVote := voteCount(event); isVote {
+					key := VoteCount{TopicID: count.TopicID, PostID: count.PostID, CommentID: count.CommentID}
+					if _, seen := latest[key]; !seen {
+						order = append(order, key)
+					}
+					latest[key] = count
+				}
+				select {
+				case event, ok = <-sub:
+					if !ok {
+						return
+					}
+				default:
+					pending = false
+				}
+			}
+			for _, key := range order {
+				ws.SetWriteDeadline(time.Now().Add(SocketWriteTimeout))
+				if err := websocket.JSON.Send(ws, latest[key]); err != nil {
+					return
+				}
+			}
+		}
+	}).ServeHTTP(c.Response(), c.Request())
+	return nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"reddit-clone/internal/events"
+	"reddit-clone/internal/models"
+)
+
+// TestVoteSocket opens the topic and post sockets, votes on the post and a
+// comment, and checks each socket gets the counts for its page.
+func TestVoteSocket(t *testing.T) {
+	e := newServer(t)
+	alice, _ := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Hello"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", Content: "hi"},
+	)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	dial := func(path, channel string) *websocket.Conn {
+		t.Helper()
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, "", server.URL)
+		if err != nil {
+			t.Fatalf("dial %s: %v", path, err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		// The handler subscribes after the handshake, so publish a marker
+		// until it comes through before relying on the subscription.
+		marker := VoteCount{TopicID: "sync"}
+		for deadline := time.Now().Add(5 * time.Second); ; {
+			Events.Publish(channel, events.Event{Type: "vote", Data: marker})
+			ws.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+			var got VoteCount
+			if websocket.JSON.Receive(ws, &got) == nil && got == marker {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s did not subscribe", path)
+			}
+		}
+		// Drain markers sent while the first one was on its way.
+		for {
+			ws.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+			var got VoteCount
+			if websocket.JSON.Receive(ws, &got) != nil {
+				break
+			}
+		}
+		return ws
+	}
+	receive := func(ws *websocket.Conn) (VoteCount, error) {
+		ws.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		var got VoteCount
+		err := websocket.JSON.Receive(ws, &got)
+		return got, err
+	}
+	topic := dial("/topics/golang/votes", TopicChannel("golang"))
+	post := dial("/topics/golang/posts/p1/votes", PostChannel("golang", "p1"))
+	cookie := login(t, alice)
+
+	if rec := postForm(e, "/topics/golang/posts/p1/upvote", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("upvote post: %d", rec.Code)
+	}
+	want := VoteCount{TopicID: "golang", PostID: "p1", Votes: 1}
+	for name, ws := range map[string]*websocket.Conn{"topic": topic, "post": post} {
+		if got, err := receive(ws); err != nil || got != want {
+			t.Errorf("post vote on the %s socket: got %+v, %v", name, got, err)
+		}
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/comments/c1/downvote", nil, cookie); rec.Code != http.StatusOK {
+		t.Fatalf("downvote comment: %d", rec.Code)
+	}
+	if got, err := receive(post); err != nil || got != (VoteCount{TopicID: "golang", PostID: "p1", CommentID: "c1", Votes: -1}) {
+		t.Errorf("comment vote on the post socket: got %+v, %v", got, err)
+	}
+	if got, err := receive(topic); err == nil {
+		t.Errorf("comment vote on the topic socket: got %+v", got)
+	}
+
+	for _, path := range []string{"/topics/rust/votes", "/topics/golang/posts/missing/votes"} {
+		if rec := get(e, path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+// TestVoteCount reads the count from a vote event published here and from
+// one that came through Redis as JSON.
+func TestVoteCount(t *testing.T) {
+	want := VoteCount{TopicID: "golang", PostID: "p1", Votes: 3}
+	for _, tc := range []struct {
+		what  string
+		event events.Event
+		ok    bool
+	}{
+		{"a local vote", events.Event{Type: "vote", Data: want}, true},
+		{"a vote from redis", events.Event{Type: "vote", Data: json.RawMessage(`{"topicID":"golang","postID":"p1","votes":3}`)}, true},
+		{"another event from redis", events.Event{Type: "post", Data: json.RawMessage(`{"topicID":"golang"}`)}, false},
+		{"bad JSON", events.Event{Type: "vote", Data: json.RawMessage(`{`)}, false},
+		{"another event", events.Event{Type: "post", Data: "p1"}, false},
+	} {
+		got, ok := voteCount(tc.event)
+		if ok != tc.ok || (ok && got != want) {
+			t.Errorf("%s: got %+v, %v", tc.what, got, ok)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/web"
+)
+
+// TestStatic serves the embedded stylesheet and templates.
+func TestStatic(t *testing.T) {
+	saved := Static
+	t.Cleanup(func() { Static = saved })
+	var err error
+	if Static, err = fs.Sub(web.FS, "static"); err != nil {
+		t.Fatal(err)
+	}
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseFS(web.FS, "views/*.html"))}
+	RateLimits = RateLimitConfig{Enabled: true, Reads: RateBudget{Burst: 1, Per: time.Minute}}
+	RateLimiter = NewMemoryLimiter()
+	for range 2 {
+		rec := get(e, "/static/style.css")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/css") {
+			t.Fatalf("the stylesheet: got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+		}
+	}
+	for _, path := range []string{"/static/missing.css", "/static/../web.go", "/static/%2e%2e/web.go"} {
+		if rec := get(e, path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, rec.Code)
+		}
+	}
+	if rec := get(e, "/login"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `href="/static/style.css"`) {
+		t.Errorf("the login page from the embedded templates: got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// StatsDays is how many days of activity the stats go back.
+const StatsDays = 30
+
+// StatsTopPosts is how many of the week's top posts the stats list.
+const StatsTopPosts = 10
+
+// DayActivity counts what was posted and voted on in one UTC day.
+type DayActivity struct {
+	Day      string `json:"day"`
+	Posts    int64  `json:"posts"`
+	Comments int64  `json:"comments"`
+	Votes    int64  `json:"votes"`
+}
+
+// TopicActivity counts what was posted in one topic over the last week.
+type TopicActivity struct {
+	TopicID  string `json:"topicID"`
+	Posts    int64  `json:"posts"`
+	Comments int64  `json:"comments"`
+}
+
+// ActivityStats is how busy the site has been lately: posts, comments and
+// votes per day, the topics posted in this week, busiest first, and the
+// week's top posts.
+type ActivityStats struct {
+	Days         []DayActivity   `json:"days"`
+	ActiveTopics []TopicActivity `json:"activeTopics"`
+	TopPosts     []models.Post   `json:"topPosts"`
+}
+
+// Activity counts the site's recent activity with a grouped query per
+// model, rather than loading the rows.
+func Activity(c context.Context, _ struct{}) (*ActivityStats, error) {
+	now := time.Now().UTC()
+	first := now.AddDate(0, 0, 1-StatsDays).Truncate(24 * time.Hour)
+	week := store.Where("created_at", ">=", now.AddDate(0, 0, -7))
+	visible := store.Where("shadowbanned", "=", false)
+	stats := &ActivityStats{}
+	var daily [3]map[string]int64
+	for i, model := range []any{&models.Post{}, &models.Comment{}, &models.Vote{}} {
+		scopes := []store.Scope{store.Where("created_at", ">=", first)}
+		if _, ok := model.(*models.Vote); !ok {
+			scopes = append(scopes, visible)
+		}
+		var err error
+		if daily[i], err = Store.CountByDay(c, model, nil, "created_at", scopes...); err != nil {
+			return nil, err
+		}
+	}
+	for day := first; !day.After(now); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		stats.Days = append(stats.Days, DayActivity{Day: key, Posts: daily[0][key], Comments: daily[1][key], Votes: daily[2][key]})
+	}
+	posts, err := Store.CountBy(c, &models.Post{}, nil, "topic_id", week, visible)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := Store.CountBy(c, &models.Comment{}, nil, "topic_id", week, visible)
+	if err != nil {
+		return nil, err
+	}
+	topics := map[string]*TopicActivity{}
+	for _, counts := range []map[string]int64{posts, comments} {
+		for topicID := range counts {
+			topics[topicID] = &TopicActivity{TopicID: topicID, Posts: posts[topicID], Comments: comments[topicID]}
+		}
+	}
+	for _, topic := range topics {
+		stats.ActiveTopics = append(stats.ActiveTopics, *topic)
+	}
+	slices.SortFunc(stats.ActiveTopics, func(a, b TopicActivity) int {
+		return cmp.Or(cmp.Compare(b.Posts+b.Comments, a.Posts+a.Comments), cmp.Compare(a.TopicID, b.TopicID))
+	})
+	stats.TopPosts, err = store.Find(c, Store, models.Post{}, store.Select(ListingColumns...), store.Preload("Author"), week, store.OrderBy("votes DESC", "created_at DESC"), store.Page(models.PageRequest{Limit: StatsTopPosts}), Visible(c))
+	return stats, err
+}
+
+func HandleAdminStats(c echo.Context) error {
+	if err := Administer(c.Request().Context()); err != nil {
+		return Fail(c, err)
+	}
+	stats, err := Activity(c.Request().Context(), struct{}{})
+	if err != nil {
+		return Fail(c, err)
+	}
+	return c.Render(http.StatusOK, "adminstats", stats)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestActivity reads the site's recent activity through the API and on
+// the admin stats page.
+func TestActivity(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"alice"}
+	alice, _ := newUser(t, "alice")
+	bob, _ := newUser(t, "bob")
+	now := time.Now()
+	tenDaysAgo := now.AddDate(0, 0, -10)
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.Post{Model: models.Model{ID: "top", CreatedAt: now.Add(-time.Hour)}, TopicID: "golang", AuthorID: bob.ID, Title: "Top", Votes: 9},
+		&models.Post{Model: models.Model{ID: "mid", CreatedAt: now.Add(-2 * time.Hour)}, TopicID: "golang", AuthorID: bob.ID, Title: "Mid", Votes: 3},
+		&models.Post{Model: models.Model{ID: "r1", CreatedAt: now.AddDate(0, 0, -3)}, TopicID: "rust", AuthorID: bob.ID, Title: "Rusty", Votes: 1},
+		// Counted on its day, but older than a week.
+		&models.Post{Model: models.Model{ID: "old", CreatedAt: tenDaysAgo}, TopicID: "golang", AuthorID: bob.ID, Title: "Old", Votes: 50},
+		&models.Post{Model: models.Model{ID: "ancient", CreatedAt: now.AddDate(0, 0, -40)}, TopicID: "golang", AuthorID: bob.ID, Title: "Ancient"},
+		&models.Post{Model: models.Model{ID: "ghost"}, TopicID: "golang", AuthorID: bob.ID, Title: "Ghost", Votes: 100, Shadowbanned: true},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "rust", PostID: "r1", AuthorID: bob.ID},
+		&models.Comment{Model: models.Model{ID: "c2"}, TopicID: "rust", PostID: "r1", AuthorID: alice.ID},
+		&models.Comment{Model: models.Model{ID: "c3"}, TopicID: "golang", PostID: "top", AuthorID: bob.ID, Shadowbanned: true},
+		&models.Vote{UserID: alice.ID, TopicID: "golang", PostID: "top", Value: 1},
+		&models.Vote{UserID: bob.ID, TopicID: "golang", PostID: "top", Value: 1},
+	)
+
+	var stats ActivityStats
+	if rec := call(t, e, http.MethodGet, "/v1/stats", "", nil, &stats); rec.Code != http.StatusOK {
+		t.Fatalf("/v1/stats: %d %s", rec.Code, rec.Body)
+	}
+	if len(stats.Days) != StatsDays || stats.Days[StatsDays-1].Day != now.UTC().Format(time.DateOnly) || stats.Days[0].Day != now.UTC().AddDate(0, 0, 1-StatsDays).Format(time.DateOnly) {
+		t.Fatalf("days: got %d from %+v", len(stats.Days), stats.Days)
+	}
+	var total DayActivity
+	for _, day := range stats.Days {
+		total.Posts, total.Comments, total.Votes = total.Posts+day.Posts, total.Comments+day.Comments, total.Votes+day.Votes
+		if day.Day == tenDaysAgo.UTC().Format(time.DateOnly) && day.Posts != 1 {
+			t.Errorf("ten days ago: got %+v, want the old post", day)
+		}
+	}
+	if total != (DayActivity{Posts: 4, Comments: 2, Votes: 2}) {
+		t.Errorf("activity over the days: got %+v, want 4 posts, 2 comments and 2 votes", total)
+	}
+	if got := fmt.Sprint(stats.ActiveTopics); got != "[{rust 1 2} {golang 2 0}]" {
+		t.Errorf("active topics: got %s", got)
+	}
+	var top []string
+	for _, post := range stats.TopPosts {
+		top = append(top, post.ID)
+	}
+	if fmt.Sprint(top) != "[top mid r1]" || stats.TopPosts[0].Author == nil || stats.TopPosts[0].Author.Username != "bob" {
+		t.Errorf("top posts: got %v %+v", top, stats.TopPosts)
+	}
+
+	page := func(path string, user *models.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(login(t, user))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+	if body := page("/admin", alice).Body.String(); !strings.Contains(body, `href="/admin/stats"`) {
+		t.Errorf("the dashboard does not link the stats: %s", body)
+	}
+	if rec := page("/admin/stats", alice); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<td><a href="/topics/rust">rust</a></td><td>1</td><td>2</td>`) {
+		t.Errorf("the stats page: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := page("/admin/stats", bob); rec.Code != http.StatusForbidden {
+		t.Errorf("the stats page as a non-admin: got %d", rec.Code)
+	}
+}
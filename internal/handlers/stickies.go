@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+var ErrNotTopLevel = NewError(BadRequest, "not_top_level", "only top-level comments can be stickied")
+var ErrNotAuthor = NewError(Forbidden, "not_author", "only the author of a comment can distinguish it")
+
+// Sticky keeps a top-level comment at the top of its post, in place of the
+// one stickied before, or lets it go back among the rest. Only the topic's
+// moderators may, and it is logged.
+func Sticky(on bool) func(context.Context, GetRequest) (*models.Comment, error) {
+	return func(c context.Context, req GetRequest) (*models.Comment, error) {
+		if err := Moderate(c, req.TopicID); err != nil {
+			return nil, err
+		}
+		_, comment, err := findTarget(c, Store, req.IDs, Visible(c))
+		if err != nil {
+			return nil, err
+		} else if comment == nil {
+			return nil, store.ErrNotFound
+		} else if comment.ParentCommentID != "" {
+			return nil, ErrNotTopLevel
+		} else if comment.Stickied == on {
+			return nil, nil
+		}
+		action := &models.ModAction{TopicID: req.TopicID, Action: models.ModSticky, PostID: req.PostID, CommentID: req.CommentID, TargetUserID: comment.AuthorID}
+		if !on {
+			action.Action = models.ModUnsticky
+		}
+		return nil, Moderated(c, action, func(tx store.Store) error {
+			if on {
+				stickied, err := store.Find(c, tx, models.Comment{TopicID: req.TopicID, PostID: req.PostID, Stickied: true})
+				if err != nil {
+					return err
+				}
+				for _, other := range stickied {
+					if err := tx.Update(c, &models.Comment{Model: models.Model{ID: other.ID}, TopicID: other.TopicID, PostID: other.PostID}, map[string]any{"stickied": false}); err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Update(c, &models.Comment{Model: models.Model{ID: comment.ID}, TopicID: comment.TopicID, PostID: comment.PostID}, map[string]any{"stickied": on})
+		})
+	}
+}
+
+// Distinguish marks a comment as made by a moderator of its topic, or a
+// site admin, or takes the marker off. Only its author may, and only while
+// they are one.
+func Distinguish(on bool) func(context.Context, GetRequest) (*models.Comment, error) {
+	return func(c context.Context, req GetRequest) (*models.Comment, error) {
+		id := models.Comment{Model: models.Model{ID: req.CommentID}, TopicID: req.TopicID, PostID: req.PostID}
+		if err := Owned(c, id, func(c *models.Comment) string { return c.AuthorID }); errors.Is(err, ErrForbidden) {
+			return nil, ErrNotAuthor
+		} else if err != nil {
+			return nil, err
+		}
+		distinguished := ""
+		if on {
+			moderator, err := IsModerator(c, CurrentUser(c), req.TopicID)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case moderator:
+				distinguished = models.DistinguishModerator
+			case IsAdmin(CurrentUser(c)):
+				distinguished = models.DistinguishAdmin
+			default:
+				return nil, ErrNotModerator
+			}
+		}
+		return nil, Store.Update(c, &id, map[string]any{"distinguished": distinguished})
+	}
+}
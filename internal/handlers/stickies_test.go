@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestStickies stickies and distinguishes comments on each store, and
+// checks how the post page shows them.
+func TestStickies(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testStickies(t, s)
+		})
+	}
+}
+
+func testStickies(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	admins := Admins
+	t.Cleanup(func() { Admins = admins })
+	Admins = []string{"dave"}
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	dave, daveToken := newUser(t, "dave")
+	now := time.Now()
+	comment := func(id, author, parent string, age time.Duration) *models.Comment {
+		return &models.Comment{Model: models.Model{ID: id, CreatedAt: now.Add(-age)}, TopicID: "golang", PostID: "p1", AuthorID: author, ParentCommentID: parent, Content: id}
+	}
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Post"},
+		comment("c1", bob.ID, "", 4*time.Hour),
+		comment("c2", alice.ID, "", 3*time.Hour),
+		comment("c3", bob.ID, "", 2*time.Hour),
+		comment("r1", bob.ID, "c1", time.Hour),
+		comment("d1", dave.ID, "", time.Minute),
+	)
+	path := func(comment string) string { return "/v1/topics/golang/posts/p1/comments/" + comment }
+
+	for _, tc := range []struct {
+		what, method, comment, token string
+		want                         int
+	}{
+		{"as a non-moderator", http.MethodPut, "c3", bobToken, http.StatusForbidden},
+		{"a reply", http.MethodPut, "r1", aliceToken, http.StatusBadRequest},
+		{"a missing comment", http.MethodPut, "c9", aliceToken, http.StatusNotFound},
+		{"c3", http.MethodPut, "c3", aliceToken, http.StatusNoContent},
+		{"c1 in place of c3", http.MethodPut, "c1", aliceToken, http.StatusNoContent},
+		{"c1 again", http.MethodPut, "c1", aliceToken, http.StatusNoContent},
+		{"an unstickied comment", http.MethodDelete, "c2", aliceToken, http.StatusNoContent},
+	} {
+		if rec := call(t, e, tc.method, path(tc.comment)+"/stickied", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("%s %s: got %d, want %d: %s", tc.method, tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+	stickied := func(comment string) bool {
+		t.Helper()
+		var got models.Comment
+		call(t, e, http.MethodGet, path(comment), "", nil, &got)
+		return got.Stickied
+	}
+	if !stickied("c1") || stickied("c3") {
+		t.Errorf("stickied after the changes: c1 %v and c3 %v", stickied("c1"), stickied("c3"))
+	}
+	for _, sort := range []string{"new", "old"} {
+		body := postPage(t, e, "/topics/golang/posts/p1?sort="+sort, bob)
+		first := strings.Index(body, `id="comment-c1"`)
+		for _, other := range []string{"c2", "c3", "d1"} {
+			if i := strings.Index(body, `id="comment-`+other+`"`); first < 0 || i < first {
+				t.Errorf("sorted by %s, the stickied comment is not listed before %s: %s", sort, other, body)
+			}
+		}
+		if strings.Count(body, `id="comment-c1"`) != 1 || !strings.Contains(body, `<span class="pin">stickied</span> <a href="/u/bob">bob</a>`) {
+			t.Errorf("sorted by %s, the stickied comment is not shown once with its badge: %s", sort, body)
+		}
+	}
+
+	distinguish := func(method, comment, token string) (int, string) {
+		t.Helper()
+		rec := call(t, e, method, path(comment)+"/distinguished", token, nil, nil)
+		if rec.Code != http.StatusNoContent {
+			return rec.Code, rec.Body.String()
+		}
+		var got models.Comment
+		call(t, e, http.MethodGet, path(comment), "", nil, &got)
+		return rec.Code, got.Distinguished
+	}
+	for _, tc := range []struct {
+		what, method, comment, token string
+		code                         int
+		want                         string
+	}{
+		{"someone else's comment", http.MethodPut, "c2", bobToken, http.StatusForbidden, `"not_author"`},
+		{"as a non-moderator", http.MethodPut, "c3", bobToken, http.StatusForbidden, `"not_moderator"`},
+		{"as a moderator", http.MethodPut, "c2", aliceToken, http.StatusNoContent, "moderator"},
+		{"as an admin", http.MethodPut, "d1", daveToken, http.StatusNoContent, "admin"},
+	} {
+		// got is the error on failure and the marker on success.
+		if code, got := distinguish(tc.method, tc.comment, tc.token); code != tc.code || !strings.Contains(got, tc.want) {
+			t.Errorf("distinguish %s: got %d %s, want %d %s", tc.what, code, got, tc.code, tc.want)
+		}
+	}
+	body := postPage(t, e, "/topics/golang/posts/p1", alice)
+	for _, want := range []string{
+		`<a class="distinguished admin" title="admin" href="/u/dave">dave</a> <span class="distinguished admin">A</span>`,
+		`<a class="distinguished moderator" title="moderator" href="/u/alice">alice</a> <span class="distinguished moderator">M</span>`,
+		`data-url="/topics/golang/posts/p1/comments/c1/unsticky">Unsticky</button>`,
+		`data-url="/topics/golang/posts/p1/comments/c2/undistinguish">Undistinguish</button>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the post page for a moderator lacks %s: %s", want, body)
+		}
+	}
+	if strings.Contains(body, "/comments/r1/sticky") || strings.Contains(body, "/comments/c3/distinguish") {
+		t.Errorf("the post page offers to sticky a reply or distinguish someone else's comment: %s", body)
+	}
+	if body := postPage(t, e, "/topics/golang/posts/p1", bob); strings.Contains(body, `<button class="sticky"`) || strings.Contains(body, `<button class="distinguish"`) {
+		t.Errorf("the post page offers a non-moderator to sticky or distinguish: %s", body)
+	}
+	if code, got := distinguish(http.MethodDelete, "c2", aliceToken); code != http.StatusNoContent || got != "" {
+		t.Errorf("undistinguish: got %d %q", code, got)
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/comments/c1/unsticky", nil, login(t, alice)); rec.Code != http.StatusNoContent || stickied("c1") {
+		t.Errorf("unsticky through the page: got %d %s", rec.Code, rec.Body)
+	}
+
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	var actions []string
+	for _, action := range log.Items {
+		actions = append(actions, action.Action+" "+action.CommentID)
+	}
+	if got := strings.Join(actions, "|"); got != "unsticky c1|sticky c1|sticky c3" {
+		t.Errorf("the mod log: got %s", got)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/events"
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+const StreamKeepAlive = 30 * time.Second
+
+// Events carries live updates to the streams; main sets it to the broker.
+var Events events.Broker
+
+func PostChannel(topicID string, postID string) string {
+	return "post:" + topicID + "/" + postID
+}
+
+// Publish announces a newly created object to the streams watching it.
+func Publish(obj any, author *models.User) {
+	if Events == nil {
+		return
+	}
+	switch obj := obj.(type) {
+	case *models.Comment:
+		comment := *obj
+		comment.Author = author
+		comment.RenderContent()
+		Events.Publish(PostChannel(comment.TopicID, comment.PostID), events.Event{Type: "comment", Data: comment})
+	}
+}
+
+// HandleStream sends the events of a post as Server-Sent Events until the
+// client goes away or the server shuts down. Comments by users the viewer
+// had blocked when the stream opened are left out.
+func HandleStream(c echo.Context) error {
+	var id models.IDs
+	if err := c.Bind(&id); err != nil {
+		return Fail(c, err)
+	}
+	if _, err := store.Get(c.Request().Context(), Store, models.Post{Model: models.Model{ID: id.PostID}, TopicID: id.TopicID}); err != nil {
+		return Fail(c, err)
+	}
+	if Events == nil {
+		return Fail(c, NewError(Unavailable, "streams_unavailable", "live updates are unavailable"))
+	}
+	blocked := map[string]bool{}
+	if user := CurrentUser(c.Request().Context()); user != nil {
+		blocks, err := store.Find(c.Request().Context(), Store, models.Block{UserID: user.ID})
+		if err != nil {
+			return Fail(c, err)
+		}
+		for _, block := range blocks {
+			blocked[block.BlockedID] = true
+		}
+	}
+	sub, cancel := Events.Subscribe(PostChannel(id.TopicID, id.PostID))
+	defer cancel()
+	liveConnections.Inc("sse")
+	defer liveConnections.Dec("sse")
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+	ticker := time.NewTicker(StreamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case event, ok := <-sub:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				return err
+			}
+			var author struct {
+				AuthorID string `json:"authorID"`
+			}
+			if json.Unmarshal(data, &author) == nil && blocked[author.AuthorID] {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		w.Flush()
+	}
+}
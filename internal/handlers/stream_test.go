@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestStream watches a post's stream and checks comments created over v1
+// and through the form arrive on it, and that closing the hub ends it.
+func TestStream(t *testing.T) {
+	e := newServer(t)
+	alice, token := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Hello"},
+	)
+	server := httptest.NewServer(e)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/topics/golang/posts/p1/stream", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream: got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(res.Body)
+	next := func() (string, models.Comment) {
+		t.Helper()
+		var event string
+		var comment models.Comment
+		for lines.Scan() {
+			line := lines.Text()
+			if line == "" {
+				return event, comment
+			}
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				if err := json.Unmarshal([]byte(data), &comment); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		t.Fatalf("the stream ended: %v", lines.Err())
+		return "", comment
+	}
+
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts/p1/comments", token, map[string]any{"model": map[string]any{"content": "*first*"}}, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("comment over v1: %d", rec.Code)
+	}
+	if event, comment := next(); event != "comment" || comment.Content != "*first*" || comment.ContentHTML != "<p><em>first</em></p>\n" || comment.Author == nil || comment.Author.Username != "alice" {
+		t.Errorf("first event: got %s %+v", event, comment)
+	}
+	if rec := postForm(e, "/topics/golang/posts/p1/comments", url.Values{"content": {"second"}}, login(t, alice)); rec.Code != http.StatusOK {
+		t.Fatalf("comment through the form: %d", rec.Code)
+	}
+	if event, comment := next(); event != "comment" || comment.Content != "second" {
+		t.Errorf("second event: got %s %+v", event, comment)
+	}
+
+	Events.Close()
+	if lines.Scan() {
+		t.Errorf("the stream went on after the hub closed: %q", lines.Text())
+	}
+
+	if rec := get(e, "/topics/golang/posts/missing/stream"); rec.Code != http.StatusNotFound {
+		t.Errorf("stream of a missing post: got %d", rec.Code)
+	}
+	Events = nil
+	if rec := get(e, "/topics/golang/posts/p1/stream"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("stream without a broker: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// Index is a page of topics under the trending ones, and on the front
+// page the hottest posts.
+type Index struct {
+	*models.ListResponse[models.Topic]
+	Trending []models.TopicStats
+	Posts    []models.Post
+}
+
+// TrendingTopics is how many trending topics the index shows.
+const TrendingTopics = 5
+
+func IsSubscribed(c context.Context, user *models.User, topicID string) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	count, err := Store.Count(c, &models.Subscription{}, &models.Subscription{UserID: user.ID, TopicID: topicID})
+	return count > 0, err
+}
+func Subscriptions(c context.Context, req models.PageRequest) (*models.ListResponse[models.Subscription], error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	return store.List(c, Store, models.Subscription{UserID: user.ID}, req, store.OrderBy("topic_id"))
+}
+
+// Subscribe joins the current user to a topic, doing nothing if they
+// already are.
+func Subscribe(c context.Context, req GetRequest) (*models.Subscription, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	if _, err := store.Get(c, Store, models.Topic{Model: models.Model{ID: req.TopicID}}); err != nil {
+		return nil, err
+	}
+	if subscribed, err := IsSubscribed(c, user, req.TopicID); err != nil || subscribed {
+		return nil, err
+	}
+	return nil, Store.Create(c, &models.Subscription{UserID: user.ID, TopicID: req.TopicID})
+}
+func Unsubscribe(c context.Context, req GetRequest) (*models.Subscription, error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	_, err := store.Delete(c, Store, models.Subscription{UserID: user.ID, TopicID: req.TopicID})
+	return nil, err
+}
+
+// TopicsFeed merges the posts of several topics, with votes decaying once
+// a half-life is configured.
+func TopicsFeed(c context.Context, topics []string, req ListRequest) (*models.ListResponse[models.Post], error) {
+	order, err := store.DecayedPostOrder(req.SortRequest)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := store.List(c, Store, models.Post{}, req.PageRequest, store.Where("topic_id", "IN", topics), store.Preload("Author", "Flair"), order, SafeForWork(req.IncludeNSFW), Visible(c), Unhidden(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := AttachPreviews(c, posts.Items); err != nil {
+		return nil, err
+	}
+	votes, err := VotesByUser(c, CurrentUser(c), "", "")
+	for i := range posts.Items {
+		posts.Items[i].MyVote = votes[posts.Items[i].ID+"/"]
+	}
+	return posts, err
+}
+
+// HomeFeed is the TopicsFeed of every topic the current user subscribes to.
+func HomeFeed(c context.Context, req ListRequest) (*models.ListResponse[models.Post], error) {
+	user := CurrentUser(c)
+	if user == nil {
+		return nil, ErrNotLoggedIn
+	}
+	subscriptions, err := store.Find(c, Store, models.Subscription{UserID: user.ID})
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]string, len(subscriptions))
+	for i, subscription := range subscriptions {
+		topics[i] = subscription.TopicID
+	}
+	return TopicsFeed(c, topics, req)
+}
+
+// FrontPage lists the hottest posts of every topic, or the best ranked
+// once votes decay.
+func FrontPage(c context.Context) ([]models.Post, error) {
+	order, err := store.DecayedPostOrder(models.SortRequest{Sort: "hot"})
+	if err != nil {
+		return nil, err
+	}
+	posts, err := store.Find(c, Store, models.Post{}, store.Select(ListingColumns...), store.Preload("Author", "Flair"), order, store.Page(models.PageRequest{Limit: models.DefaultPageSize}), Visible(c), Unhidden(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := AttachPreviews(c, posts); err != nil {
+		return nil, err
+	}
+	votes, err := VotesByUser(c, CurrentUser(c), "", "")
+	for i := range posts {
+		posts[i].MyVote = votes[posts[i].ID+"/"]
+	}
+	return posts, err
+}
+
+// HandleIndex shows logged-in users who subscribe to topics their home
+// feed, and everyone else the list of all topics under the front page.
+func HandleIndex(c echo.Context) error {
+	user := CurrentUser(c.Request().Context())
+	if user == nil {
+		return renderIndex(c, true)
+	}
+	count, err := Store.Count(c.Request().Context(), &models.Subscription{}, &models.Subscription{UserID: user.ID})
+	if err != nil {
+		return Fail(c, err)
+	} else if count == 0 {
+		return renderIndex(c, true)
+	}
+	var req ListRequest
+	if err := c.Bind(&req); err != nil {
+		return Fail(c, err)
+	}
+	// Pages show NSFW posts with their content hidden instead.
+	req.IncludeNSFW = true
+	posts, err := HomeFeed(c.Request().Context(), req)
+	if err != nil {
+		return Fail(c, err)
+	}
+	posts.Link(c.Request().URL)
+	return c.Render(http.StatusOK, "home", posts)
+}
+func HandleTopics(c echo.Context) error {
+	return renderIndex(c, false)
+}
+
+// renderIndex shows a page of topics, after the front page's posts when
+// front is set.
+func renderIndex(c echo.Context, front bool) error {
+	var page models.PageRequest
+	if err := c.Bind(&page); err != nil {
+		return Fail(c, err)
+	}
+	topics, err := store.List(c.Request().Context(), Store, models.Topic{}, page)
+	if err != nil {
+		return Fail(c, err)
+	}
+	topics.Link(c.Request().URL)
+	index := Index{ListResponse: topics}
+	trending, err := Trending(c.Request().Context(), models.PageRequest{Limit: TrendingTopics})
+	if err != nil {
+		return Fail(c, err)
+	}
+	index.Trending = trending.Items
+	if front {
+		if index.Posts, err = FrontPage(c.Request().Context()); err != nil {
+			return Fail(c, err)
+		}
+	}
+	return c.Render(http.StatusOK, "index", index)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestSubscriptions joins and leaves topics over v1 and the form, and reads
+// the home feed they make up.
+func TestSubscriptions(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	now := time.Now()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "rust"}},
+		&models.Topic{Model: models.Model{ID: "java"}},
+		&models.Post{Model: models.Model{ID: "g1", CreatedAt: now.Add(-2 * time.Hour)}, TopicID: "golang", Title: "Go, older", Votes: 10},
+		&models.Post{Model: models.Model{ID: "r1", CreatedAt: now.Add(-time.Hour)}, TopicID: "rust", Title: "Rust, newer"},
+		&models.Post{Model: models.Model{ID: "j1", CreatedAt: now}, TopicID: "java", Title: "Java, newest"},
+	)
+	for _, tc := range []struct {
+		what, token, topic string
+		want               int
+	}{
+		{"signed out", "", "golang", http.StatusUnauthorized},
+		{"an unknown topic", aliceToken, "python", http.StatusNotFound},
+		{"golang", aliceToken, "golang", http.StatusNoContent},
+		{"golang again", aliceToken, "golang", http.StatusNoContent},
+		{"rust", aliceToken, "rust", http.StatusNoContent},
+	} {
+		if rec := call(t, e, http.MethodPut, "/v1/topics/"+tc.topic+"/subscription", tc.token, nil, nil); rec.Code != tc.want {
+			t.Errorf("subscribe to %s: got %d, want %d", tc.what, rec.Code, tc.want)
+		}
+	}
+	var subscriptions models.ListResponse[models.Subscription]
+	call(t, e, http.MethodGet, "/v1/subscriptions", aliceToken, nil, &subscriptions)
+	if len(subscriptions.Items) != 2 || subscriptions.Items[0].TopicID != "golang" || subscriptions.Items[1].TopicID != "rust" {
+		t.Errorf("subscriptions: got %+v", subscriptions.Items)
+	}
+
+	home := func(query string) string {
+		t.Helper()
+		var posts models.ListResponse[models.Post]
+		if rec := call(t, e, http.MethodGet, "/v1/home"+query, aliceToken, nil, &posts); rec.Code != http.StatusOK {
+			t.Fatalf("home%s: %d", query, rec.Code)
+		}
+		var ids []string
+		for _, post := range posts.Items {
+			ids = append(ids, post.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	for query, want := range map[string]string{"": "[g1 r1]", "?sort=new": "[r1 g1]", "?sort=new&limit=1&offset=1": "[g1]"} {
+		if got := home(query); got != want {
+			t.Errorf("home%s: got %s, want %s", query, got, want)
+		}
+	}
+	if rec := call(t, e, http.MethodGet, "/v1/home", "", nil, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("home signed out: got %d", rec.Code)
+	}
+
+	index := func(cookies ...*http.Cookie) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	if body := index(login(t, alice)); !strings.Contains(body, "Rust, newer") || strings.Contains(body, "Java, newest") {
+		t.Errorf("the home page shows the wrong posts: %s", body)
+	}
+	if body := index(); !strings.Contains(body, "/topics/java") {
+		t.Errorf("the index signed out does not list every topic: %s", body)
+	}
+
+	if rec := postForm(e, "/topics/golang/leave", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("leave through the form: got %d", rec.Code)
+	}
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/rust/subscription", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("unsubscribe: got %d", rec.Code)
+	}
+	if got := home(""); got != "[]" {
+		t.Errorf("home with no subscriptions: got %s", got)
+	}
+	if body := index(login(t, alice)); !strings.Contains(body, "/topics/java") {
+		t.Errorf("the index without subscriptions does not list every topic: %s", body)
+	}
+	if rec := postForm(e, "/topics/java/join", nil, login(t, alice)); rec.Code != http.StatusNoContent {
+		t.Errorf("join through the form: got %d", rec.Code)
+	}
+	if got := home(""); got != "[j1]" {
+		t.Errorf("home after joining java: got %s", got)
+	}
+
+	if rec := postForm(e, "/topics", url.Values{"id": {"python"}}, login(t, alice)); rec.Code != http.StatusOK {
+		t.Fatalf("create a topic: %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/topics/python", nil)
+	req.AddCookie(login(t, alice))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "1 subscriber") || strings.Contains(body, "1 subscribers") || !strings.Contains(body, "/topics/python/leave") {
+		t.Errorf("the creator's view of a new topic: %s", body)
+	}
+}
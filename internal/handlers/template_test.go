@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTemplateReload edits, breaks and fixes a template between renders of
+// a renderer that reloads.
+func TestTemplateReload(t *testing.T) {
+	e := newServer(t)
+	path := filepath.Join(t.TempDir(), "page.html")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parse := func() (*template.Template, error) {
+		return template.New("").Funcs(TemplateFuncs).ParseGlob(path)
+	}
+	write(`{{define "page.html"}}first{{end}}`)
+	templates, err := parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := func(renderer *Template) (string, error) {
+		t.Helper()
+		var out strings.Builder
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		err := renderer.Render(&out, "page.html", nil, c)
+		return out.String(), err
+	}
+	static := &Template{Templates: templates}
+	dev := &Template{Templates: templates, Reload: parse}
+
+	write(`{{define "page.html"}}second{{end}}`)
+	if got, err := render(static); err != nil || got != "first" {
+		t.Errorf("without reloading: got %q, %v", got, err)
+	}
+	if got, err := render(dev); err != nil || got != "second" {
+		t.Errorf("reloading after an edit: got %q, %v", got, err)
+	}
+	write(`{{define "page.html"}}{{if}}{{end}}`)
+	if _, err := render(dev); err == nil {
+		t.Error("rendered a broken template")
+	}
+	write(`{{define "page.html"}}fixed{{end}}`)
+	if got, err := render(dev); err != nil || got != "fixed" {
+		t.Errorf("reloading once fixed: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+var TemplateFuncs = template.FuncMap{
+	"markdown":      models.Markdown,
+	"signupEnabled": func() bool { return Features.Signup },
+	"isAdmin":       IsAdmin,
+	"timeAgo":       TimeAgo,
+	"plural":        Plural,
+	"score":         Score,
+	"topicURL":      TopicURL,
+	"postURL":       PostURL,
+	"commentURL":    CommentURL,
+	"voting":        Voting,
+	"thumbnailURL":  ThumbnailURL,
+	"percent":       Percent,
+}
+
+var ages = []struct {
+	unit string
+	size time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+}
+
+// TimeAgo describes how long ago t was in its largest whole unit, like
+// "5 minutes ago".
+func TimeAgo(t time.Time) string {
+	age := time.Since(t)
+	for _, a := range ages {
+		if age >= a.size {
+			return Plural(int64(age/a.size), a.unit) + " ago"
+		}
+	}
+	return "just now"
+}
+
+// Plural counts n of something named by its singular, like "1 comment" or
+// "3 comments".
+func Plural(n any, singular string) string {
+	count := fmt.Sprint(n)
+	if count == "1" || count == "-1" {
+		return count + " " + singular
+	}
+	if strings.HasSuffix(singular, "y") && !strings.ContainsAny(singular[max(len(singular)-2, 0):len(singular)-1], "aeiou") {
+		return count + " " + strings.TrimSuffix(singular, "y") + "ies"
+	}
+	return count + " " + singular + "s"
+}
+
+// Percent is n out of total as a whole percentage, 0 when total is.
+func Percent(n int, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(n) * 100 / float64(total)))
+}
+
+// Score abbreviates large vote counts, like 1.2k or 34k. Live updates
+// format counts the same way in the browser.
+func Score(votes int) string {
+	n := math.Abs(float64(votes))
+	for _, unit := range []struct {
+		suffix string
+		size   float64
+	}{{"m", 1e6}, {"k", 1e3}} {
+		if n < unit.size {
+			continue
+		}
+		value := n / unit.size
+		if value < 10 {
+			value = math.Round(value*10) / 10
+		} else {
+			value = math.Round(value)
+		}
+		sign := ""
+		if votes < 0 {
+			sign = "-"
+		}
+		return sign + strconv.FormatFloat(value, 'f', -1, 64) + unit.suffix
+	}
+	return strconv.Itoa(votes)
+}
+func TopicURL(topicID string) string {
+	return "/topics/" + topicID
+}
+func PostURL(topicID string, postID string) string {
+	return TopicURL(topicID) + "/posts/" + postID
+}
+
+// CommentURL links to the comment on its post's page.
+func CommentURL(topicID string, postID string, commentID string) string {
+	return PostURL(topicID, postID) + "#comment-" + commentID
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+func TestTimeAgo(t *testing.T) {
+	for _, tc := range []struct {
+		age  time.Duration
+		want string
+	}{
+		{0, "just now"},
+		{59 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{5*time.Minute + 30*time.Second, "5 minutes ago"},
+		{25 * time.Hour, "1 day ago"},
+		{45 * 24 * time.Hour, "1 month ago"},
+		{800 * 24 * time.Hour, "2 years ago"},
+	} {
+		if got := TimeAgo(time.Now().Add(-tc.age)); got != tc.want {
+			t.Errorf("TimeAgo(%v ago): got %q, want %q", tc.age, got, tc.want)
+		}
+	}
+}
+
+func TestPlural(t *testing.T) {
+	for _, tc := range []struct {
+		n        any
+		singular string
+		want     string
+	}{
+		{1, "comment", "1 comment"},
+		{0, "comment", "0 comments"},
+		{-1, "point", "-1 point"},
+		{int64(3), "reply", "3 replies"},
+		{2, "day", "2 days"},
+	} {
+		if got := Plural(tc.n, tc.singular); got != tc.want {
+			t.Errorf("Plural(%v, %q): got %q, want %q", tc.n, tc.singular, got, tc.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	for _, tc := range []struct{ n, total, want int }{
+		{1, 3, 33},
+		{2, 3, 67},
+		{3, 3, 100},
+		{0, 0, 0},
+		{1, 8, 13},
+	} {
+		if got := Percent(tc.n, tc.total); got != tc.want {
+			t.Errorf("Percent(%d, %d): got %d, want %d", tc.n, tc.total, got, tc.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	for votes, want := range map[int]string{
+		0:        "0",
+		999:      "999",
+		-42:      "-42",
+		1000:     "1k",
+		1234:     "1.2k",
+		9960:     "10k",
+		34499:    "34k",
+		-1500:    "-1.5k",
+		999999:   "1000k",
+		1250000:  "1.3m",
+		12345678: "12m",
+	} {
+		if got := Score(votes); got != want {
+			t.Errorf("Score(%d): got %q, want %q", votes, got, want)
+		}
+	}
+}
+
+func TestPermalinks(t *testing.T) {
+	if got := TopicURL("golang"); got != "/topics/golang" {
+		t.Errorf("TopicURL: got %q", got)
+	}
+	if got := PostURL("golang", "p1"); got != "/topics/golang/posts/p1" {
+		t.Errorf("PostURL: got %q", got)
+	}
+	if got := CommentURL("golang", "p1", "c1"); got != "/topics/golang/posts/p1#comment-c1" {
+		t.Errorf("CommentURL: got %q", got)
+	}
+}
+
+// TestTemplateHelpers renders a post page and checks the helpers' output.
+func TestTemplateHelpers(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	bob, _ := newUser(t, "bob")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1", CreatedAt: time.Now().Add(-3 * time.Hour)}, TopicID: "golang", AuthorID: bob.ID, Title: "Popular", Votes: 1234},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: bob.ID, Content: "Reply"},
+	)
+	body := get(e, "/topics/golang/posts/p1").Body.String()
+	for _, want := range []string{"1.2k", ">3 hours ago</time>", `href="/topics/golang"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the post page lacks %s: %s", want, body)
+		}
+	}
+	if rec := get(e, "/topics/golang"); !strings.Contains(rec.Body.String(), `href="/topics/golang/posts/p1"`) || !strings.Contains(rec.Body.String(), "1 post<") {
+		t.Errorf("the topic page does not link the post: %s", rec.Body)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TitleRulesSetting names the setting holding the title rules the stored
+// duplicate-detection keys were made with.
+const TitleRulesSetting = "title_rules"
+
+// RekeyTitles remakes the duplicate-detection key of every post, deleted
+// ones included, when the title rules changed since the keys were made, and
+// returns how many keys changed. The rules are recorded last, so a run cut
+// short is picked up again by the next one.
+func RekeyTitles(c context.Context) (int, error) {
+	rules := models.TitleRules.Fingerprint()
+	setting, err := store.Get(c, Store, models.Setting{Key: TitleRulesSetting})
+	recorded := err == nil
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return 0, err
+	}
+	if recorded && setting.Value == rules {
+		return 0, nil
+	}
+	posts, err := store.Find(c, Store, models.Post{}, store.Unscoped(), store.Select("id", "topic_id", "title", "normalized_title"))
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for _, post := range posts {
+		key := models.TitleRules.Normalize(post.Title)
+		if key == post.NormalizedTitle {
+			continue
+		}
+		id := models.Post{Model: models.Model{ID: post.ID}, TopicID: post.TopicID}
+		if err := Store.UpdateColumns(c, &models.Post{}, &id, map[string]any{"normalized_title": key}, store.Unscoped()); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	if !recorded {
+		return changed, Store.Create(c, &models.Setting{Key: TitleRulesSetting, Value: rules})
+	}
+	return changed, Store.Update(c, &models.Setting{Key: TitleRulesSetting}, map[string]any{"value": rules})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestRekeyTitles changes the title rules and checks the stored keys of
+// live and deleted posts follow them once, leaving updated_at alone.
+func TestRekeyTitles(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			saved, rules := Store, models.TitleRules
+			t.Cleanup(func() { Store, models.TitleRules = saved, rules })
+			Store = s
+			testRekeyTitles(t)
+		})
+	}
+}
+
+func testRekeyTitles(t *testing.T) {
+	c := context.Background()
+	for _, obj := range []any{
+		&models.User{Model: models.Model{ID: "u1"}, Username: "alice"},
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: "u1", Title: "Go 1.23 is out!"},
+		&models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: "u1", Title: "go 123 is out"},
+		&models.Post{Model: models.Model{ID: "gone", DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}}, TopicID: "golang", AuthorID: "u1", Title: "Gone, Gone"},
+	} {
+		if err := Store.Create(c, obj); err != nil {
+			t.Fatalf("create %T: %v", obj, err)
+		}
+	}
+	if n, err := RekeyTitles(c); err != nil || n != 0 {
+		t.Errorf("first run under the rules the posts were written with: got %d, %v", n, err)
+	}
+	before, err := store.Get(c, Store, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicates := func() int {
+		t.Helper()
+		posts, err := FindDuplicates(c, "golang", "go 123 is out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(*posts)
+	}
+	if n := duplicates(); n != 2 {
+		t.Errorf("duplicates under the default rules: got %d, want 2", n)
+	}
+
+	models.TitleRules = models.TitleNormalization{}
+	if n, err := RekeyTitles(c); err != nil || n != 2 {
+		t.Errorf("rekey under new rules: got %d, %v; want 2", n, err)
+	}
+	if n, err := RekeyTitles(c); err != nil || n != 0 {
+		t.Errorf("rekey again: got %d, %v", n, err)
+	}
+	var posts []models.Post
+	if err := Store.Find(c, &posts, &models.Post{TopicID: "golang"}, store.Unscoped(), store.OrderBy("id")); err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		if post.NormalizedTitle != post.Title {
+			t.Errorf("key of %s: got %q, want %q", post.ID, post.NormalizedTitle, post.Title)
+		}
+		if post.ID == "p1" && !post.UpdatedAt.Equal(before.UpdatedAt) {
+			t.Errorf("updated_at of p1 moved from %v to %v", before.UpdatedAt, post.UpdatedAt)
+		}
+	}
+	if n := duplicates(); n != 1 {
+		t.Errorf("duplicates under the new rules: got %d, want 1", n)
+	}
+	setting, err := store.Get(c, Store, models.Setting{Key: TitleRulesSetting})
+	if err != nil || setting.Value != models.TitleRules.Fingerprint() {
+		t.Errorf("recorded rules: got %+v, %v", setting, err)
+	}
+}
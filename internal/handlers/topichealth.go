@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// HealthWeights are how much each part of a topic's health counts toward
+// its score, relative to the others.
+type HealthWeights struct {
+	Activity float64 `yaml:"activity" json:"activity"`
+	Reports  float64 `yaml:"reports" json:"reports"`
+	Removals float64 `yaml:"removals" json:"removals"`
+	Growth   float64 `yaml:"growth" json:"growth"`
+}
+
+// TopicHealthConfig has topic health scores count the last Window of a
+// topic's activity, treat Target posts and comments in it as fully active,
+// and serve a score for MaxAge before counting it again.
+type TopicHealthConfig struct {
+	Window  time.Duration `yaml:"window"`
+	Target  int           `yaml:"target"`
+	MaxAge  time.Duration `yaml:"maxAge"`
+	Weights HealthWeights `yaml:"weights"`
+}
+
+var TopicHealth = TopicHealthConfig{
+	Window:  7 * 24 * time.Hour,
+	Target:  100,
+	MaxAge:  10 * time.Minute,
+	Weights: HealthWeights{Activity: 40, Reports: 20, Removals: 20, Growth: 20},
+}
+
+// HealthScore is a topic's health from 0 to 100, and the parts it is
+// weighed from, each from 0 to 1:
+//
+//   - Activity is the posts and comments in the window over the target.
+//   - Reports is one less the reports per post or comment.
+//   - Removals is one less the share of posts and comments removed.
+//   - Growth is a half when as many people posted as in the window before,
+//     and moves a half toward 1 or 0 as that doubles or drops to none.
+type HealthScore struct {
+	TopicID string        `json:"topicID"`
+	Score   int           `json:"score"`
+	Parts   HealthWeights `json:"parts"`
+	Counted time.Time     `json:"counted"`
+}
+
+var healthMu sync.Mutex
+var healthScores = map[string]*HealthScore{}
+
+// TopicHealthScore returns a topic's health score to its moderators,
+// counting it again when it is older than TopicHealth.MaxAge.
+func TopicHealthScore(c context.Context, req GetRequest) (*HealthScore, error) {
+	if err := Moderate(c, req.TopicID); err != nil {
+		return nil, err
+	}
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	if score := healthScores[req.TopicID]; score != nil && time.Since(score.Counted) < TopicHealth.MaxAge {
+		return score, nil
+	}
+	score, err := countHealth(c, req.TopicID)
+	if err != nil {
+		return nil, err
+	}
+	healthScores[req.TopicID] = score
+	return score, nil
+}
+
+func countHealth(c context.Context, topicID string) (*HealthScore, error) {
+	now := time.Now()
+	since := now.Add(-TopicHealth.Window)
+	window := store.Where("created_at", ">=", since)
+	visible := store.Where("shadowbanned", "=", false)
+	var items int64
+	authors := map[string]bool{}
+	before := map[string]bool{}
+	for _, model := range []any{&models.Post{}, &models.Comment{}} {
+		counts, err := Store.CountBy(c, model, nil, "author_id", store.Where("topic_id", "=", topicID), window, visible)
+		if err != nil {
+			return nil, err
+		}
+		for author, n := range counts {
+			items += n
+			authors[author] = true
+		}
+		counts, err = Store.CountBy(c, model, nil, "author_id", store.Where("topic_id", "=", topicID), store.Where("created_at", ">=", since.Add(-TopicHealth.Window)), store.Where("created_at", "<", since), visible)
+		if err != nil {
+			return nil, err
+		}
+		for author := range counts {
+			before[author] = true
+		}
+	}
+	reports, err := Store.Count(c, &models.Report{}, &models.Report{TopicID: topicID}, window)
+	if err != nil {
+		return nil, err
+	}
+	// Removed posts and comments are gone from the counts above, so they
+	// are counted from the mod log.
+	removals, err := Store.Count(c, &models.ModAction{}, &models.ModAction{TopicID: topicID, Action: models.ModRemove}, window)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := HealthWeights{Reports: 1, Removals: 1}
+	if TopicHealth.Target > 0 {
+		parts.Activity = min(1, float64(items)/float64(TopicHealth.Target))
+	}
+	if total := float64(items + removals); total > 0 {
+		parts.Reports = 1 - min(1, float64(reports)/total)
+		parts.Removals = 1 - float64(removals)/total
+	}
+	growth := float64(len(authors)-len(before)) / float64(max(len(before), 1))
+	parts.Growth = max(0, min(1, 0.5+growth/2))
+
+	w := TopicHealth.Weights
+	score := &HealthScore{TopicID: topicID, Parts: parts, Counted: now}
+	if total := w.Activity + w.Reports + w.Removals + w.Growth; total > 0 {
+		sum := w.Activity*parts.Activity + w.Reports*parts.Reports + w.Removals*parts.Removals + w.Growth*parts.Growth
+		score.Score = int(math.Round(100 * sum / total))
+	}
+	return score, nil
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestTopicHealth scores a busy, growing topic against one with few posts,
+// many reports and removals and fewer people posting than the week before.
+func TestTopicHealth(t *testing.T) {
+	e := newServer(t)
+	scores, config := healthScores, TopicHealth
+	t.Cleanup(func() { healthScores, TopicHealth = scores, config })
+	healthScores = map[string]*HealthScore{}
+	TopicHealth.Target = 10
+	alice, aliceToken := newUser(t, "alice")
+	_, bobToken := newUser(t, "bob")
+	var authors []string
+	for i := range 4 {
+		author, _ := newUser(t, fmt.Sprint("author", i))
+		authors = append(authors, author.ID)
+	}
+	lastWeek := time.Now().AddDate(0, 0, -8)
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Topic{Model: models.Model{ID: "spam"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+		&models.TopicModerator{TopicID: "spam", UserID: alice.ID},
+	)
+	post := func(topicID string, n int, author string, created time.Time) {
+		t.Helper()
+		create(t, &models.Post{Model: models.Model{ID: fmt.Sprintf("%s-%d", topicID, n), CreatedAt: created}, TopicID: topicID, AuthorID: author, Title: "Post"})
+	}
+	// golang: twelve posts by four people this week, two the week before.
+	for i := range 12 {
+		post("golang", i, authors[i%4], time.Now())
+	}
+	post("golang", 12, authors[0], lastWeek)
+	post("golang", 13, authors[1], lastWeek)
+	// spam: three posts by one person this week, three the week before, and
+	// four reports and five removals.
+	for i := range 3 {
+		post("spam", i, authors[0], time.Now())
+		post("spam", 3+i, authors[i+1], lastWeek)
+	}
+	for i := range 5 {
+		if i < 4 {
+			create(t, &models.Report{Model: models.Model{ID: fmt.Sprint("report", i)}, TopicID: "spam", PostID: "spam-0", ReporterID: authors[i], Status: models.ReportOpen})
+		}
+		create(t, &models.ModAction{Model: models.Model{ID: fmt.Sprint("removal", i)}, TopicID: "spam", ModeratorID: alice.ID, Action: models.ModRemove})
+	}
+
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/health", bobToken, nil, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("health as a non-moderator: got %d, want 403", rec.Code)
+	}
+	read := func(topicID string) HealthScore {
+		t.Helper()
+		var got HealthScore
+		if rec := call(t, e, http.MethodGet, "/v1/topics/"+topicID+"/health", aliceToken, nil, &got); rec.Code != http.StatusOK {
+			t.Fatalf("%s health: %d %s", topicID, rec.Code, rec.Body)
+		}
+		return got
+	}
+	golang, spam := read("golang"), read("spam")
+	if golang.Score <= spam.Score {
+		t.Errorf("scores: got golang %d and spam %d, want golang higher", golang.Score, spam.Score)
+	}
+	if golang.Score != 100 || golang.Parts != (HealthWeights{1, 1, 1, 1}) {
+		t.Errorf("golang: got %d from %+v, want 100", golang.Score, golang.Parts)
+	}
+	// 40×0.3 + 20×0.5 + 20×0.375 + 20×(0.5 - 2/3/2), out of 100.
+	if spam.Score != 33 {
+		t.Errorf("spam: got %d from %+v, want 33", spam.Score, spam.Parts)
+	}
+
+	create(t, &models.Report{Model: models.Model{ID: "new"}, TopicID: "golang", PostID: "golang-0", ReporterID: alice.ID, Status: models.ReportOpen})
+	if got := read("golang"); got.Score != 100 {
+		t.Errorf("golang within the max age: got %d, want the cached 100", got.Score)
+	}
+	TopicHealth.MaxAge = 0
+	if got := read("golang"); got.Score != 98 {
+		t.Errorf("golang after the max age: got %d, want 98 with a report per twelve posts", got.Score)
+	}
+	TopicHealth.Weights = HealthWeights{Reports: 1}
+	if got := read("spam"); got.Score != 50 {
+		t.Errorf("spam weighing only reports: got %d, want 50", got.Score)
+	}
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+
+	"reddit-clone/internal/tracing"
+)
+
+// Traced starts a server span for each request, continuing the caller's
+// trace when it sends a traceparent header. Everything below it reaches the
+// span through the request context.
+var Traced = otelecho.Middleware("reddit-clone")
+
+// TracedBinder times binding request parameters and bodies.
+type TracedBinder struct {
+	echo.Binder
+}
+
+func (b TracedBinder) Bind(i any, c echo.Context) error {
+	_, span := tracing.Tracer.Start(c.Request().Context(), "bind")
+	defer span.End()
+	err := b.Binder.Bind(i, c)
+	tracing.Fail(span, err)
+	return err
+}
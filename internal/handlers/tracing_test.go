@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"reddit-clone/internal/models"
+)
+
+// spans is installed as the global tracer provider's exporter the first
+// time a test asks for it. The tracers the middleware and the store got at
+// startup bind to the first provider set, so it is set once and reset
+// between tests.
+var spans = sync.OnceValue(func() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return exporter
+})
+
+// TestTraced serves a page with a traceparent and checks the spans it
+// produced hang off the caller's span.
+func TestTraced(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, _ := newUser(t, "alice")
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}})
+	recorder := spans()
+	recorder.Reset()
+
+	req := httptest.NewRequest(http.MethodGet, "/topics/golang", nil)
+	req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	req.AddCookie(login(t, alice))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("topic page: %d", rec.Code)
+	}
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range recorder.GetSpans() {
+		byName[span.Name] = span
+	}
+	server, ok := byName["GET /topics/:topicid"]
+	if !ok {
+		t.Fatalf("no server span in %v", byName)
+	}
+	if server.SpanContext.TraceID().String() != "0af7651916cd43dd8448eb211c80319c" || server.Parent.SpanID().String() != "b7ad6b7169203331" || server.SpanKind != trace.SpanKindServer {
+		t.Errorf("the server span does not continue the caller's trace: %+v", server)
+	}
+	attributes := map[string]any{}
+	for _, kv := range server.Attributes {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	if attributes["http.route"] != "/topics/:topicid" || attributes["http.response.status_code"] != int64(http.StatusOK) || server.Status.Code == codes.Error {
+		t.Errorf("server span: got %v, %+v", attributes, server.Status)
+	}
+	for _, name := range []string{"bind", "render topic"} {
+		if span, ok := byName[name]; !ok || span.Parent.SpanID() != server.SpanContext.SpanID() || span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("%s is not under the server span: %+v", name, span)
+		}
+	}
+
+	recorder.Reset()
+	if rec := get(e, "/v1/topics/rust"); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing topic: %d", rec.Code)
+	}
+	got := recorder.GetSpans()
+	if len(got) == 0 {
+		t.Fatal("no spans for the missing topic")
+	}
+	if server := got[len(got)-1]; server.Parent.IsValid() || server.SpanKind != trace.SpanKindServer {
+		t.Errorf("the missing topic did not start a trace of its own: %+v", server)
+	}
+}
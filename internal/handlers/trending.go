@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TrendingConfig has topic activity recounted every Interval. A zero
+// Interval turns trending off.
+type TrendingConfig struct {
+	Interval time.Duration `yaml:"interval"`
+}
+
+// TrendingWindow is how far back the trending job counts activity, and
+// how far before that it looks for the activity to compare with.
+const TrendingWindow = 24 * time.Hour
+
+// TrendingPostWeight is how many votes a new post counts as.
+const TrendingPostWeight = 5
+
+// TrendingDamping is added to the activity a topic grew from, so a topic
+// going from one vote to three does not outrank a busy one doubling.
+const TrendingDamping = 10
+
+// Trending lists the topics whose activity grew the most over the last
+// day, as the trending job last counted it.
+func Trending(c context.Context, req models.PageRequest) (*models.ListResponse[models.TopicStats], error) {
+	return store.List(c, Store, models.TopicStats{}, req, store.Where("growth", ">", 0.0), store.OrderBy("growth DESC", "topic_id"))
+}
+
+// UpdateTrending counts the posts and votes of every topic over the last
+// day and the day before, with one grouped query each, and replaces the
+// stored topic stats with them.
+func UpdateTrending(c context.Context, now time.Time) error {
+	since, before := now.Add(-TrendingWindow), now.Add(-2*TrendingWindow)
+	count := func(model any, from time.Time, to time.Time, scopes ...store.Scope) (map[string]int64, error) {
+		scopes = append(scopes, store.Where("created_at", ">=", from), store.Where("created_at", "<", to))
+		return Store.CountBy(c, model, nil, "topic_id", scopes...)
+	}
+	visible := store.Where("shadowbanned", "=", false)
+	posts, err := count(&models.Post{}, since, now, visible)
+	if err != nil {
+		return err
+	}
+	previousPosts, err := count(&models.Post{}, before, since, visible)
+	if err != nil {
+		return err
+	}
+	votes, err := count(&models.Vote{}, since, now)
+	if err != nil {
+		return err
+	}
+	previousVotes, err := count(&models.Vote{}, before, since)
+	if err != nil {
+		return err
+	}
+	stats := map[string]*models.TopicStats{}
+	for _, counts := range []map[string]int64{posts, previousPosts, votes, previousVotes} {
+		for topicID := range counts {
+			stats[topicID] = &models.TopicStats{
+				TopicID:       topicID,
+				Posts:         int(posts[topicID]),
+				Votes:         int(votes[topicID]),
+				PreviousPosts: int(previousPosts[topicID]),
+				PreviousVotes: int(previousVotes[topicID]),
+				CreatedAt:     now,
+			}
+		}
+	}
+	return Store.Transaction(c, func(tx store.Store) error {
+		if _, err := store.Delete(c, tx, models.TopicStats{}, store.Where("topic_id", "<>", "")); err != nil {
+			return err
+		}
+		for _, topic := range stats {
+			activity := topic.Posts*TrendingPostWeight + topic.Votes
+			previous := topic.PreviousPosts*TrendingPostWeight + topic.PreviousVotes
+			topic.Growth = float64(activity-previous) / float64(previous+TrendingDamping)
+			if err := tx.Create(c, topic); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunTrending updates the topic stats on the configured schedule until the
+// context ends.
+func RunTrending(c context.Context, cfg TrendingConfig) {
+	if cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := UpdateTrending(c, time.Now()); err != nil {
+			slog.Error("updating trending topics failed", "error", err)
+		}
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestUpdateTrending counts a day of posts and votes against the day
+// before on each store and lists the topics that grew, fastest first.
+func TestUpdateTrending(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			saved := Store
+			t.Cleanup(func() { Store = saved })
+			Store = s
+			testUpdateTrending(t)
+		})
+	}
+}
+
+func testUpdateTrending(t *testing.T) {
+	c := context.Background()
+	create := func(obj any) {
+		t.Helper()
+		if err := Store.Create(c, obj); err != nil {
+			t.Fatalf("create %T: %v", obj, err)
+		}
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	today, yesterday, old := now.Add(-time.Hour), now.Add(-TrendingWindow-time.Hour), now.Add(-3*TrendingWindow)
+	for i := range 20 {
+		create(&models.User{Model: models.Model{ID: fmt.Sprintf("u%d", i)}, Username: fmt.Sprintf("user%d", i)})
+	}
+	post := func(topic, id string, at time.Time) {
+		create(&models.Post{Model: models.Model{ID: id, CreatedAt: at}, TopicID: topic, AuthorID: "u0", Title: id})
+	}
+	votes := func(topic string, n int, at time.Time, from int) {
+		for i := range n {
+			create(&models.Vote{UserID: fmt.Sprintf("u%d", from+i), TopicID: topic, PostID: topic + "-old", Value: 1, CreatedAt: at})
+		}
+	}
+	for _, topic := range []string{"rising", "busy", "quiet", "fading"} {
+		create(&models.Topic{Model: models.Model{ID: topic}})
+		post(topic, topic+"-old", old)
+	}
+	// rising: 2 posts today against nothing, growth 10/10.
+	post("rising", "r1", today)
+	post("rising", "r2", today)
+	// busy: 1 post and 15 votes today against 1 post and 5 votes, 10/20.
+	post("busy", "b1", today)
+	votes("busy", 15, today, 0)
+	post("busy", "b0", yesterday)
+	votes("busy", 5, yesterday, 15)
+	// quiet: 3 votes today against 1, 2/11; its shadowbanned post is left
+	// out.
+	votes("quiet", 3, today, 0)
+	votes("quiet", 1, yesterday, 3)
+	create(&models.Post{Model: models.Model{ID: "q1", CreatedAt: today}, TopicID: "quiet", AuthorID: "u0", Title: "q1", Shadowbanned: true})
+	// fading: 1 post yesterday and nothing today.
+	post("fading", "f0", yesterday)
+
+	if err := UpdateTrending(c, now); err != nil {
+		t.Fatal(err)
+	}
+	trending, err := Trending(c, models.PageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, topic := range trending.Items {
+		got = append(got, fmt.Sprintf("%s %d/%d %d/%d %.4f", topic.TopicID, topic.Posts, topic.PreviousPosts, topic.Votes, topic.PreviousVotes, topic.Growth))
+	}
+	if want := "[rising 2/0 0/0 1.0000 busy 1/1 15/5 0.5000 quiet 0/0 3/1 0.1818]"; fmt.Sprint(got) != want {
+		t.Errorf("trending: got %v, want %s", got, want)
+	}
+	if n, err := Store.Count(c, &models.TopicStats{}, &models.TopicStats{}); err != nil || n != 4 {
+		t.Errorf("topic stats: got %d, %v; want 4 with fading", n, err)
+	}
+
+	if err := UpdateTrending(c, now.Add(5*TrendingWindow)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Store.Count(c, &models.TopicStats{}, &models.TopicStats{}); err != nil || n != 0 {
+		t.Errorf("topic stats once everything is old: got %d, %v", n, err)
+	}
+}
+
+// TestTrending reads the trending topics through the API and on the index.
+func TestTrending(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	create(t, &models.Topic{Model: models.Model{ID: "golang"}}, &models.Topic{Model: models.Model{ID: "rust"}})
+	if body := get(e, "/").Body.String(); strings.Contains(body, "Trending:") {
+		t.Errorf("the index shows trending topics before any were counted: %s", body)
+	}
+	create(t, &models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "New"})
+	if err := UpdateTrending(context.Background(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	var list models.ListResponse[models.TopicStats]
+	if rec := call(t, e, http.MethodGet, "/v1/trending", "", nil, &list); rec.Code != http.StatusOK || len(list.Items) != 1 || list.Items[0].TopicID != "golang" || list.Items[0].Posts != 1 {
+		t.Errorf("/v1/trending: got %d %+v", rec.Code, list.Items)
+	}
+	if body := get(e, "/").Body.String(); !strings.Contains(body, `<a href="/topics/golang">golang</a> (1 post, 0 votes today)`) {
+		t.Errorf("the index does not show golang trending: %s", body)
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestUserFlairs picks, sets and clears flairs users have in a topic on
+// each store, and checks they show next to the users' names.
+func TestUserFlairs(t *testing.T) {
+	sqlite, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{SQLite: store.SQLiteConfig{ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if err := sqlite.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			testUserFlairs(t, s)
+		})
+	}
+}
+
+func testUserFlairs(t *testing.T, s store.Store) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	Store = s
+	alice, aliceToken := newUser(t, "alice")
+	bob, bobToken := newUser(t, "bob")
+	carol, _ := newUser(t, "carol")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.TopicModerator{TopicID: "golang", UserID: alice.ID},
+	)
+	var gopher, news models.Flair
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/flairs", aliceToken, map[string]any{"model": map[string]any{"text": "Gopher", "users": true}}, &gopher); rec.Code != http.StatusCreated || !gopher.Users {
+		t.Fatalf("create a user flair: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/flairs", aliceToken, map[string]any{"model": map[string]any{"text": "News"}}, &news); rec.Code != http.StatusCreated || news.Users {
+		t.Fatalf("create a post flair: got %d %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		what, path, token string
+		body              map[string]any
+		want              int
+	}{
+		{"signed out", "/v1/topics/golang/users/bob/flair", "", map[string]any{"flairID": gopher.ID}, http.StatusUnauthorized},
+		{"in a missing topic", "/v1/topics/rust/users/bob/flair", bobToken, map[string]any{"flairID": gopher.ID}, http.StatusNotFound},
+		{"on a missing user", "/v1/topics/golang/users/dave/flair", aliceToken, map[string]any{"text": "Ghost"}, http.StatusNotFound},
+		{"on someone else", "/v1/topics/golang/users/carol/flair", bobToken, map[string]any{"flairID": gopher.ID}, http.StatusForbidden},
+		{"to a custom text", "/v1/topics/golang/users/bob/flair", bobToken, map[string]any{"text": "King"}, http.StatusBadRequest},
+		{"to a post flair", "/v1/topics/golang/users/bob/flair", bobToken, map[string]any{"flairID": news.ID}, http.StatusBadRequest},
+		{"to a flair and a text", "/v1/topics/golang/users/bob/flair", bobToken, map[string]any{"flairID": gopher.ID, "text": "King"}, http.StatusBadRequest},
+		{"to a bad color", "/v1/topics/golang/users/carol/flair", aliceToken, map[string]any{"text": "Helper", "color": "green"}, http.StatusBadRequest},
+		{"to a user flair", "/v1/topics/golang/users/bob/flair", bobToken, map[string]any{"flairID": gopher.ID}, http.StatusOK},
+		{"as a moderator", "/v1/topics/golang/users/carol/flair", aliceToken, map[string]any{"text": "Helper", "color": "#00FF00"}, http.StatusOK},
+		{"as a moderator for themselves", "/v1/topics/golang/users/alice/flair", aliceToken, map[string]any{"text": "Mod"}, http.StatusOK},
+	} {
+		if rec := call(t, e, http.MethodPut, tc.path, tc.token, tc.body, nil); rec.Code != tc.want {
+			t.Errorf("set a flair %s: got %d, want %d: %s", tc.what, rec.Code, tc.want, rec.Body)
+		}
+	}
+	flair := func(username string) (int, models.UserFlair) {
+		t.Helper()
+		var got models.UserFlair
+		rec := call(t, e, http.MethodGet, "/v1/topics/golang/users/"+username+"/flair", "", nil, &got)
+		return rec.Code, got
+	}
+	if code, got := flair("bob"); code != http.StatusOK || got.Text != "Gopher" || got.Color != DefaultFlairColor || got.UserID != bob.ID {
+		t.Errorf("bob's flair: got %d %+v", code, got)
+	}
+	if code, got := flair("carol"); code != http.StatusOK || got.Text != "Helper" || got.Color != "#00ff00" {
+		t.Errorf("carol's flair: got %d %+v", code, got)
+	}
+
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", bobToken, map[string]any{"model": map[string]any{"title": "Flaired", "flairID": gopher.ID}}, nil); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "flairID") {
+		t.Errorf("post with a user flair: got %d %s", rec.Code, rec.Body)
+	}
+	create(t,
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: bob.ID, Title: "Hello"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: carol.ID, Content: "Hi"},
+	)
+	body := postPage(t, e, "/topics/golang/posts/p1", bob)
+	for _, want := range []string{
+		`<a href="/u/bob">bob</a> <span class="flair" style="background: #e0e0e0; color: #000000">Gopher</span>`,
+		`<a href="/u/carol">carol</a> <span class="flair" style="background: #00ff00; color: #000000">Helper</span>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the post page lacks %s: %s", want, body)
+		}
+	}
+	body = postPage(t, e, "/topics/golang", bob)
+	if !strings.Contains(body, `<a href="/u/bob">bob</a> <span class="flair" style="background: #e0e0e0; color: #000000">Gopher</span>`) {
+		t.Errorf("the topic page lacks bob's flair: %s", body)
+	}
+	if !strings.Contains(body, `id="userflair"`) || !strings.Contains(body, `<option value="`+gopher.ID+`" selected>Gopher</option>`) || strings.Contains(body, `<option value="`+news.ID+`" selected>`) {
+		t.Errorf("the topic page lacks bob's flair picker: %s", body)
+	}
+	values := url.Values{"content": {"Thanks"}, CSRFCookie: {csrfToken}}
+	req := httptest.NewRequest(http.MethodPost, "/topics/golang/posts/p1/comments", strings.NewReader(values.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	req.Header.Set("HX-Request", "true")
+	req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: csrfToken})
+	req.AddCookie(login(t, bob))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), ">Gopher</span>") {
+		t.Errorf("the new comment lacks bob's flair: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := postForm(e, "/topics/golang/users/bob/flair/remove", nil, login(t, bob)); rec.Code != http.StatusNoContent {
+		t.Errorf("clear a flair through the page: got %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, e, http.MethodDelete, "/v1/topics/golang/users/carol/flair", aliceToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("clear carol's flair: got %d", rec.Code)
+	}
+	for _, username := range []string{"bob", "carol"} {
+		if code, _ := flair(username); code != http.StatusNotFound {
+			t.Errorf("%s's cleared flair: got %d", username, code)
+		}
+	}
+	if rec := postForm(e, "/topics/golang/users/bob/flair", url.Values{"flairID": {gopher.ID}}, login(t, bob)); rec.Code != http.StatusOK {
+		t.Errorf("pick a flair through the page: got %d %s", rec.Code, rec.Body)
+	}
+
+	var log models.ListResponse[models.ModAction]
+	call(t, e, http.MethodGet, "/v1/topics/golang/modlog", "", nil, &log)
+	var got []string
+	for _, action := range log.Items {
+		if action.Action == models.ModEditUserFlair {
+			got = append(got, action.TargetUserID+" "+action.Details)
+		}
+	}
+	if want := carol.ID + " removed user flair|" + carol.ID + " set user flair Helper"; strings.Join(got, "|") != want {
+		t.Errorf("the mod log: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"reddit-clone/internal/models"
+)
+
+const (
+	MaxTitleLength   = 300
+	MaxPostLength    = 40000
+	MaxCommentLength = 10000
+	MaxMessageLength = 10000
+	MaxURLLength     = 2048
+
+	MaxDescriptionLength = 500
+	MaxReasonLength      = 500
+
+	MaxCollectionTopics = 50
+
+	MinPollOptions      = 2
+	MaxPollOptions      = 6
+	MaxPollOptionLength = 100
+	MaxPollDays         = 7
+)
+
+// FieldErrors maps each invalid request field to what is wrong with it.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field, problem := range e {
+		fields = append(fields, field+" "+problem)
+	}
+	sort.Strings(fields)
+	return "invalid request: " + strings.Join(fields, "; ")
+}
+func (e FieldErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Text checks a free text field, which must not be blank unless the field
+// is optional and left empty.
+func (e FieldErrors) Text(field string, value string, max int, optional bool) {
+	if strings.TrimSpace(value) == "" {
+		if !optional || value != "" {
+			e[field] = "is required"
+		}
+	} else if utf8.RuneCountInString(value) > max {
+		e[field] = fmt.Sprintf("must be at most %d characters", max)
+	}
+}
+
+// URL checks a link, which must be an absolute http or https URL.
+func (e FieldErrors) URL(field string, value string) {
+	u, err := url.Parse(value)
+	if len(value) > MaxURLLength {
+		e[field] = fmt.Sprintf("must be at most %d characters", MaxURLLength)
+	} else if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		e[field] = "must be an http or https URL"
+	}
+}
+
+// Poll checks a new poll's options, of which there must be a few, each
+// different.
+func (e FieldErrors) Poll(field string, poll models.Poll) {
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		e[field+".options"] = fmt.Sprintf("must have %d-%d options", MinPollOptions, MaxPollOptions)
+		return
+	}
+	seen := map[string]bool{}
+	for i, option := range poll.Options {
+		text := strings.ToLower(strings.TrimSpace(models.StripTags(option.Text)))
+		e.Text(fmt.Sprintf("%s.options[%d]", field, i), models.StripTags(option.Text), MaxPollOptionLength, false)
+		if seen[text] && text != "" {
+			e[fmt.Sprintf("%s.options[%d]", field, i)] = "must differ from the other options"
+		}
+		seen[text] = true
+	}
+}
+func (e FieldErrors) TopicID(field string, id string) {
+	if !ValidTopicID(id) {
+		e[field] = "must be 3-21 letters, digits, '-' or '_'"
+	}
+}
+func (e FieldErrors) Model(prefix string, model any, partial bool) {
+	switch m := model.(type) {
+	case models.Topic:
+		if !partial {
+			e.TopicID(prefix+"id", m.ID)
+		}
+		e.Text(prefix+"description", m.Description, MaxDescriptionLength, true)
+	case models.Post:
+		if !partial || m.Title != "" {
+			e.Text(prefix+"title", models.StripTags(m.Title), MaxTitleLength, false)
+		}
+		e.Text(prefix+"content", m.Content, MaxPostLength, true)
+		switch {
+		case m.Kind != "" && m.Kind != models.PostSelf && m.Kind != models.PostLink && m.Kind != models.PostImage && m.Kind != models.PostPoll:
+			e[prefix+"kind"] = "must be self, link, image or poll"
+		case m.URL != "" && m.MediaID != "":
+			e[prefix+"url"] = "cannot be set along with mediaID"
+		case m.Poll != nil && (m.URL != "" || m.MediaID != ""):
+			e[prefix+"poll"] = "cannot be set along with url or mediaID"
+		case m.Kind == models.PostLink && m.URL == "":
+			e[prefix+"url"] = "is required"
+		case m.Kind == models.PostImage && m.MediaID == "":
+			e[prefix+"mediaID"] = "is required"
+		case m.Kind == models.PostPoll && m.Poll == nil:
+			e[prefix+"poll"] = "is required"
+		case m.Kind != "" && m.Kind != models.PostLink && m.URL != "":
+			e[prefix+"url"] = "must be empty unless the post is a link"
+		case m.Kind != "" && m.Kind != models.PostImage && m.MediaID != "":
+			e[prefix+"mediaID"] = "must be empty unless the post is an image"
+		case m.Kind != "" && m.Kind != models.PostPoll && m.Poll != nil:
+			e[prefix+"poll"] = "must be empty unless the post is a poll"
+		case m.URL != "":
+			e.URL(prefix+"url", m.URL)
+		case m.Poll != nil:
+			e.Poll(prefix+"poll", *m.Poll)
+		}
+		if m.PollClosesAt != nil {
+			if m.Poll == nil {
+				e[prefix+"pollClosesAt"] = "must be empty unless the post is a poll"
+			} else if !m.PollClosesAt.After(time.Now()) || m.PollClosesAt.After(time.Now().AddDate(0, 0, MaxPollDays)) {
+				e[prefix+"pollClosesAt"] = fmt.Sprintf("must be within the next %d days", MaxPollDays)
+			}
+		}
+	case models.Comment:
+		e.Text(prefix+"content", m.Content, MaxCommentLength, partial)
+	case models.AutomodRule:
+		e.AutomodRule(prefix, m, partial)
+	case models.Filter:
+		e.Filter(prefix, m)
+	case models.Flair:
+		e.Flair(prefix, m, partial)
+	case models.Collection:
+		e.Collection(prefix, m, partial)
+	}
+}
+
+func validName(name string, min int, max int) bool {
+	if len(name) < min || len(name) > max {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+func ValidTopicID(id string) bool {
+	return validName(id, 3, 21)
+}
+
+// Validate checks requests that know how to validate themselves, called by
+// the generic handlers right after binding.
+func Validate(req any) error {
+	if v, ok := req.(interface{ Validate() error }); ok {
+		return v.Validate()
+	}
+	return nil
+}
+func (r CreateTopicRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.TopicID("id", r.ID)
+	errs.Text("description", r.Description, MaxDescriptionLength, true)
+	return errs.Err()
+}
+func (r CreatePostRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.Model("", models.Post{Title: r.Title, Kind: r.Kind, URL: r.URL, MediaID: r.MediaID, Poll: NewPoll(r.PollOptions), Content: r.Content}, false)
+	if r.PollDays < 0 || r.PollDays > MaxPollDays {
+		errs["pollDays"] = fmt.Sprintf("must be at most %d", MaxPollDays)
+	}
+	return errs.Err()
+}
+func (r CreateCommentRequest) Validate() error {
+	errs := FieldErrors{}
+	errs.Model("", models.Comment{Content: r.Content}, false)
+	return errs.Err()
+}
+func (r CreateRequest[T]) Validate() error {
+	errs := FieldErrors{}
+	errs.Model("model.", r.Model, false)
+	return errs.Err()
+}
+func (r UpdateRequest[T]) Validate() error {
+	errs := FieldErrors{}
+	errs.Model("updateMask.", r.Mask, true)
+	return errs.Err()
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// TestValidate sends invalid create and update requests to the v1 API and
+// the form routes, and checks each is refused naming the invalid fields.
+func TestValidate(t *testing.T) {
+	e := newServer(t)
+	alice, token := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Hello"},
+		&models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p1", AuthorID: alice.ID, Content: "hi"},
+	)
+	long := func(n int) string { return strings.Repeat("é", n) }
+
+	for i, tc := range []struct {
+		method, path string
+		body         any
+		fields       []string
+	}{
+		{http.MethodPost, "/v1/topics", map[string]any{"model": map[string]any{"id": "go"}}, []string{"model.id"}},
+		{http.MethodPost, "/v1/topics", map[string]any{"model": map[string]any{"id": "go lang"}}, []string{"model.id"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{}}, []string{"model.title"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "<b></b>"}}, []string{"model.title"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": long(MaxTitleLength + 1), "content": " "}}, []string{"model.content", "model.title"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "content": long(MaxPostLength + 1)}}, []string{"model.content"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "video"}}, []string{"model.kind"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "link"}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "self", "url": "https://example.com"}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "image"}}, []string{"model.mediaID"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "poll"}}, []string{"model.poll"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "poll": map[string]any{"options": []map[string]any{{"text": "one"}}}}}, []string{"model.poll.options"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "poll": map[string]any{"options": []map[string]any{{"text": "1"}, {"text": "2"}, {"text": "3"}, {"text": "4"}, {"text": "5"}, {"text": "6"}, {"text": "7"}}}}}, []string{"model.poll.options"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "poll": map[string]any{"options": []map[string]any{{"text": "Go"}, {"text": "go "}}}}}, []string{"model.poll.options[1]"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "poll": map[string]any{"options": []map[string]any{{"text": "Go"}, {"text": " "}}}}}, []string{"model.poll.options[1]"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "poll": map[string]any{"options": []map[string]any{{"text": "a"}, {"text": "b"}}}, "url": "https://example.com"}}, []string{"model.poll"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "self", "poll": map[string]any{"options": []map[string]any{{"text": "a"}, {"text": "b"}}}}}, []string{"model.poll"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "poll": map[string]any{"options": []map[string]any{{"text": "a"}, {"text": "b"}}}, "pollClosesAt": time.Now().Add(-time.Hour)}}, []string{"model.pollClosesAt"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "poll": map[string]any{"options": []map[string]any{{"text": "a"}, {"text": "b"}}}, "pollClosesAt": time.Now().AddDate(0, 0, 8)}}, []string{"model.pollClosesAt"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "pollClosesAt": time.Now().Add(time.Hour)}}, []string{"model.pollClosesAt"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "url": "https://example.com", "mediaID": "m1"}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "image", "mediaID": "m1", "url": "https://example.com"}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "link", "url": "https://example.com", "mediaID": "m1"}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "kind": "self", "mediaID": "m1"}}, []string{"model.mediaID"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "url": "javascript:alert(1)"}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "url": "/relative"}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts", map[string]any{"model": map[string]any{"title": "ok", "url": "https://example.com/" + strings.Repeat("a", MaxURLLength)}}, []string{"model.url"}},
+		{http.MethodPost, "/v1/topics/golang/posts/p1/comments", map[string]any{"model": map[string]any{"content": "  "}}, []string{"model.content"}},
+		{http.MethodPut, "/v1/topics/golang/posts/p1", map[string]any{"updateMask": map[string]any{"title": "\t"}}, []string{"updateMask.title"}},
+		{http.MethodPut, "/v1/topics/golang/posts/p1/comments/c1", map[string]any{"updateMask": map[string]any{"content": long(MaxCommentLength + 1)}}, []string{"updateMask.content"}},
+	} {
+		var body Problem
+		rec := call(t, e, tc.method, tc.path, token, tc.body, nil)
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); rec.Code != http.StatusBadRequest || err != nil || body.Code != "validation_failed" {
+			t.Errorf("request %d, %s %s: got %d %s, want 400 validation_failed", i, tc.method, tc.path, rec.Code, body.Code)
+			continue
+		}
+		for _, field := range tc.fields {
+			if body.Fields[field] == "" {
+				t.Errorf("request %d, %s %s: %s is not among the invalid fields %v", i, tc.method, tc.path, field, body.Fields)
+			}
+		}
+		if tc.fields != nil && len(body.Fields) != len(tc.fields) {
+			t.Errorf("request %d, %s %s: got invalid fields %v, want %v", i, tc.method, tc.path, body.Fields, tc.fields)
+		}
+	}
+
+	var post models.Post
+	if rec := call(t, e, http.MethodPut, "/v1/topics/golang/posts/p1", token, map[string]any{"updateMask": map[string]any{"content": "new content"}}, &post); rec.Code != http.StatusOK || post.Title != "Hello" {
+		t.Errorf("update leaving the title out of the mask: got %d, title %q", rec.Code, post.Title)
+	}
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", token, map[string]any{"model": map[string]any{"title": long(MaxTitleLength)}}, nil); rec.Code != http.StatusCreated {
+		t.Errorf("post with a title of %d characters: got %d", MaxTitleLength, rec.Code)
+	}
+
+	cookie := login(t, alice)
+	for _, tc := range []struct {
+		path   string
+		values url.Values
+		field  string
+	}{
+		{"/topics", url.Values{"id": {"a"}}, "id"},
+		{"/topics/golang/posts", url.Values{"title": {" "}}, "title"},
+		{"/topics/golang/posts", url.Values{"title": {"ok"}, "kind": {"link"}}, "url"},
+		{"/topics/golang/posts", url.Values{"title": {"ok"}, "kind": {"image"}}, "mediaID"},
+		{"/topics/golang/posts", url.Values{"title": {"ok"}, "kind": {"poll"}, "pollOptions": {"a"}}, "poll.options"},
+		{"/topics/golang/posts", url.Values{"title": {"ok"}, "pollOptions": {"a", "b"}, "pollDays": {"8"}}, "pollDays"},
+		{"/topics/golang/posts/p1/comments", url.Values{"content": {""}}, "content"},
+	} {
+		rec := postForm(e, tc.path, tc.values, cookie)
+		var body struct{ Fields map[string]string }
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusBadRequest || body.Fields[tc.field] == "" {
+			t.Errorf("form POST %s %v: got %d %s, want 400 naming %s", tc.path, tc.values, rec.Code, rec.Body, tc.field)
+		}
+	}
+}
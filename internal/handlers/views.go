@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"reddit-clone/internal/models"
+)
+
+// ViewsConfig has a viewer's repeat views of a post within Window count
+// once, and the views counted in memory written to the database every
+// Interval.
+type ViewsConfig struct {
+	Window   time.Duration `yaml:"window"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ViewCounter counts post views in memory until they are flushed, so a
+// page view does not cost a database write. Each replica keeps its own,
+// so a viewer switching replicas within the window can count twice.
+type ViewCounter struct {
+	Window time.Duration
+
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	pending map[models.IDs]int
+}
+
+var Views = NewViewCounter(30 * time.Minute)
+
+func NewViewCounter(window time.Duration) *ViewCounter {
+	return &ViewCounter{Window: window, seen: map[string]time.Time{}, pending: map[models.IDs]int{}}
+}
+
+// Record counts a view of the post by viewer, unless they viewed it
+// within the window already.
+func (v *ViewCounter) Record(viewer string, id models.IDs, now time.Time) {
+	key := viewer + " " + id.TopicID + "/" + id.PostID
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if last, ok := v.seen[key]; ok && now.Sub(last) < v.Window {
+		return
+	}
+	v.seen[key] = now
+	v.pending[id]++
+}
+
+// Pending is how many views of the post are waiting to be flushed.
+func (v *ViewCounter) Pending(id models.IDs) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.pending[id]
+}
+
+// Flush adds the pending views to the posts' stored counts and forgets
+// viewers whose window has passed. Views it fails to write stay pending.
+func (v *ViewCounter) Flush(c context.Context, now time.Time) error {
+	v.mu.Lock()
+	pending := v.pending
+	v.pending = map[models.IDs]int{}
+	for key, last := range v.seen {
+		if now.Sub(last) >= v.Window {
+			delete(v.seen, key)
+		}
+	}
+	v.mu.Unlock()
+	var failed error
+	for id, views := range pending {
+		err := Store.Increment(c, &models.Post{Model: models.Model{ID: id.PostID}, TopicID: id.TopicID}, "views", views)
+		if err != nil {
+			failed = err
+			v.mu.Lock()
+			v.pending[id] += views
+			v.mu.Unlock()
+		}
+	}
+	return failed
+}
+
+// RunViewFlusher flushes the counted views on the configured schedule
+// until the context ends. The server flushes once more after draining
+// requests, so none are lost on shutdown.
+func RunViewFlusher(c context.Context, cfg ViewsConfig) {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := Views.Flush(c, time.Now()); err != nil {
+			slog.Error("flushing post views failed", "error", err)
+		}
+	}
+}
+
+// Viewed counts a view of the post a request showed, by the signed-in
+// user or otherwise by the client's address.
+func Viewed(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if err != nil || c.Response().Status != http.StatusOK {
+			return err
+		}
+		viewer := "ip:" + c.RealIP()
+		if user := CurrentUser(c.Request().Context()); user != nil {
+			viewer = "user:" + user.ID
+		}
+		Views.Record(viewer, models.IDs{TopicID: c.Param("topicid"), PostID: c.Param("postid")}, time.Now())
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store"
+)
+
+// TestViewCounter records views inside and past the window, flushes them
+// into the store, and keeps views it fails to write.
+func TestViewCounter(t *testing.T) {
+	newServer(t)
+	c := context.Background()
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", Title: "Viewed"},
+	)
+	id := models.IDs{TopicID: "golang", PostID: "p1"}
+	views := NewViewCounter(time.Hour)
+	now := time.Now()
+	for _, view := range []struct {
+		viewer string
+		at     time.Time
+		want   int
+	}{
+		{"user:alice", now, 1},
+		{"user:alice", now.Add(59 * time.Minute), 1},
+		{"ip:192.0.2.1", now, 2},
+		{"user:alice", now.Add(time.Hour), 3},
+	} {
+		views.Record(view.viewer, id, view.at)
+		if got := views.Pending(id); got != view.want {
+			t.Errorf("%s at %v: got %d pending, want %d", view.viewer, view.at.Sub(now), got, view.want)
+		}
+	}
+	if err := views.Flush(c, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	post, err := store.Get(c, Store, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"})
+	if err != nil || post.Views != 3 || views.Pending(id) != 0 {
+		t.Errorf("after the flush: got %d stored and %d pending, %v", post.Views, views.Pending(id), err)
+	}
+	// The flush forgot the visitor, whose window had passed, but not alice.
+	views.Record("ip:192.0.2.1", id, now.Add(time.Hour))
+	views.Record("user:alice", id, now.Add(time.Hour))
+	if got := views.Pending(id); got != 1 {
+		t.Errorf("after the flush: got %d pending, want 1", got)
+	}
+
+	closed, err := store.Open("sqlite", filepath.Join(t.TempDir(), "test.db"), store.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	Store = closed
+	if err := views.Flush(c, now); err == nil || views.Pending(id) != 1 {
+		t.Errorf("a failed flush: got %v with %d pending, want an error and 1", err, views.Pending(id))
+	}
+}
+
+// TestViewed counts views of the post page and the v1 post, and shows the
+// ones not yet flushed.
+func TestViewed(t *testing.T) {
+	e := newServer(t)
+	e.Renderer = &Template{Templates: template.Must(template.New("").Funcs(TemplateFuncs).ParseGlob("../../web/views/*.html"))}
+	alice, aliceToken := newUser(t, "alice")
+	create(t,
+		&models.Topic{Model: models.Model{ID: "golang"}},
+		&models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang", AuthorID: alice.ID, Title: "Viewed", Views: 10},
+	)
+	id := models.IDs{TopicID: "golang", PostID: "p1"}
+	for range 2 {
+		if rec := get(e, "/topics/golang/posts/p1"); rec.Code != http.StatusOK {
+			t.Fatalf("the post page: %d", rec.Code)
+		}
+	}
+	if got := Views.Pending(id); got != 1 {
+		t.Errorf("two visits from one address: got %d pending, want 1", got)
+	}
+	if body := get(e, "/topics/golang/posts/p1").Body.String(); !strings.Contains(body, "&middot; 11 views</p>") {
+		t.Errorf("the post page does not show 11 views: %s", body)
+	}
+	var post models.Post
+	if rec := call(t, e, http.MethodGet, "/v1/topics/golang/posts/p1", aliceToken, nil, &post); rec.Code != http.StatusOK || post.Views != 11 {
+		t.Errorf("the v1 post: got %d with %d views, want 11", rec.Code, post.Views)
+	}
+	if got := Views.Pending(id); got != 2 {
+		t.Errorf("after alice's view: got %d pending, want 2", got)
+	}
+	for _, path := range []string{"/topics/golang/posts/p9", "/v1/topics/golang/posts/p9"} {
+		if rec := get(e, path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, rec.Code)
+		}
+		if got := Views.Pending(models.IDs{TopicID: "golang", PostID: "p9"}); got != 0 {
+			t.Errorf("%s counted %d views", path, got)
+		}
+	}
+}
+
+func TestViewsIgnoreForwardedFor(t *testing.T) {
+	e := newServer(t)
+	_, token := newUser(t, "alice")
+	if rec := call(t, e, http.MethodPost, "/v1/topics", token, map[string]any{"model": map[string]any{"id": "golang"}}, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("create topic: %d %s", rec.Code, rec.Body)
+	}
+	var post models.Post
+	if rec := call(t, e, http.MethodPost, "/v1/topics/golang/posts", token, map[string]any{"model": map[string]any{"title": "Hello", "content": "world"}}, &post); rec.Code != http.StatusCreated {
+		t.Fatalf("create post: %d %s", rec.Code, rec.Body)
+	}
+	view := func(remote, forwarded string) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/topics/golang/posts/"+post.ID, nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("view: %d %s", rec.Code, rec.Body)
+		}
+	}
+	for _, forwarded := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		view("192.0.2.1:1234", forwarded)
+	}
+	id := models.IDs{TopicID: "golang", PostID: post.ID}
+	if got := Views.Pending(id); got != 1 {
+		t.Errorf("one address forwarding for three: got %d views, want 1", got)
+	}
+	view("192.0.2.2:1234", "")
+	if got := Views.Pending(id); got != 2 {
+		t.Errorf("second address: got %d views, want 2", got)
+	}
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+func WithLogger(c context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(c, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of the request c belongs to, which tags
+// every line with the request's ID, or the default logger outside requests.
+func FromContext(c context.Context) *slog.Logger {
+	if logger, ok := c.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// New builds a logger writing text or json lines to w.
+func New(format string, w io.Writer) (*slog.Logger, error) {
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, nil)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, want text or json", format)
+}
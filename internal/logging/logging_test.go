@@ -0,0 +1,35 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	for format, want := range map[string]string{"": "level=INFO msg=hello n=1\n", "text": "level=INFO msg=hello n=1\n", "json": `"level":"INFO","msg":"hello","n":1}` + "\n"} {
+		var out strings.Builder
+		logger, err := New(format, &out)
+		if err != nil {
+			t.Fatalf("%q: %v", format, err)
+		}
+		logger.Info("hello", "n", 1)
+		if !strings.HasSuffix(out.String(), want) {
+			t.Errorf("%q: got %q, want it to end in %q", format, out.String(), want)
+		}
+	}
+	if _, err := New("xml", nil); err == nil {
+		t.Error("built a logger for an unknown format")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != slog.Default() {
+		t.Error("a context without a logger should get the default one")
+	}
+	logger := slog.Default().With("request_id", "r1")
+	if FromContext(WithLogger(context.Background(), logger)) != logger {
+		t.Error("the context's logger was not returned")
+	}
+}
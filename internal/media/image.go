@@ -0,0 +1,93 @@
+// Package media checks uploaded images, makes their thumbnails and stores
+// them on disk or in S3.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+
+	// Registered for image.Decode; JPEG is imported above to encode.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// MaxPixels is the largest image, by width times height, that is decoded.
+// Anything bigger could take gigabytes of memory however small the file.
+const MaxPixels = 40_000_000
+
+// ThumbnailQuality is the JPEG quality thumbnails are encoded at.
+const ThumbnailQuality = 85
+
+var ErrUnsupported = errors.New("not a JPEG, PNG or GIF image")
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// ContentTypes maps the image formats Go decodes to their content types.
+var ContentTypes = map[string]string{"jpeg": "image/jpeg", "png": "image/png", "gif": "image/gif"}
+
+// Image is an uploaded image after decoding.
+type Image struct {
+	image.Image
+	ContentType string
+}
+
+// Decode reads an image in one of the supported formats, checking its size
+// from the header before decoding the pixels.
+func Decode(data []byte) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || ContentTypes[format] == "" {
+		return nil, ErrUnsupported
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	return &Image{Image: img, ContentType: ContentTypes[format]}, nil
+}
+
+// Thumbnail scales img down to fit in a size by size square, averaging the
+// pixels each thumbnail pixel covers, on white where img is transparent.
+// Images already that small keep their size.
+func Thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/h, y0+1)
+		for x := range w {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(b.Min.X+(x+1)*b.Dx()/w, x0+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			// The colours are premultiplied, so white shows through by
+			// however much alpha is missing.
+			white := n*0xffff - a
+			thumb.SetRGBA(x, y, color.RGBA{uint8((r + white) / n >> 8), uint8((g + white) / n >> 8), uint8((bl + white) / n >> 8), 0xff})
+		}
+	}
+	return thumb
+}
+
+// EncodeThumbnail writes the thumbnail of img as a JPEG.
+func EncodeThumbnail(w io.Writer, img image.Image, size int) error {
+	return jpeg.Encode(w, Thumbnail(img, size), &jpeg.Options{Quality: ThumbnailQuality})
+}
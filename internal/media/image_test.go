@@ -0,0 +1,103 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encode(t *testing.T, format string, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestDecode reads the supported formats by their content and refuses
+// other data and images too big to decode.
+func TestDecode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	for format, want := range map[string]string{"png": "image/png", "jpeg": "image/jpeg", "gif": "image/gif"} {
+		got, err := Decode(encode(t, format, img))
+		if err != nil || got.ContentType != want || got.Bounds().Dx() != 30 || got.Bounds().Dy() != 20 {
+			t.Errorf("%s: got %v, %v", format, got, err)
+		}
+	}
+	for what, data := range map[string][]byte{
+		"text":          []byte("not an image at all"),
+		"a cut off PNG": encode(t, "png", img)[:60],
+		"nothing":       nil,
+	} {
+		if _, err := Decode(data); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: got %v, want ErrUnsupported", what, err)
+		}
+	}
+	// A GIF header claiming 65535 by 65535 pixels and nothing else.
+	huge := []byte("GIF89a\xff\xff\xff\xff\x00\x00\x00")
+	if _, err := Decode(huge); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("a huge GIF: got %v, want ErrTooManyPixels", err)
+	}
+}
+
+// TestThumbnail fits images in the square, keeps small ones as they are,
+// averages the pixels it shrinks and puts transparency on white.
+func TestThumbnail(t *testing.T) {
+	for _, tc := range []struct{ w, h, wantW, wantH int }{
+		{640, 320, 320, 160},
+		{320, 640, 160, 320},
+		{100, 50, 100, 50},
+		{2000, 1, 320, 1},
+		{1, 2000, 1, 320},
+	} {
+		if b := Thumbnail(image.NewRGBA(image.Rect(0, 0, tc.w, tc.h)), 320).Bounds(); b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+			t.Errorf("%dx%d: got %dx%d, want %dx%d", tc.w, tc.h, b.Dx(), b.Dy(), tc.wantW, tc.wantH)
+		}
+	}
+
+	// Black and white columns average to grey.
+	stripes := image.NewRGBA(image.Rect(10, 10, 14, 12))
+	for x := 10; x < 14; x++ {
+		for y := 10; y < 12; y++ {
+			if x%2 == 0 {
+				stripes.Set(x, y, color.White)
+			} else {
+				stripes.Set(x, y, color.Black)
+			}
+		}
+	}
+	if got := Thumbnail(stripes, 2).RGBAAt(0, 0); got.R < 126 || got.R > 128 || got.R != got.G || got.G != got.B || got.A != 0xff {
+		t.Errorf("stripes: got %v, want opaque grey", got)
+	}
+	if got := Thumbnail(image.NewNRGBA(image.Rect(0, 0, 4, 4)), 2).RGBAAt(1, 1); got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("transparent: got %v, want white", got)
+	}
+	red := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	red.SetNRGBA(0, 0, color.NRGBA{R: 0xff, A: 0x80})
+	if got := Thumbnail(red, 1).RGBAAt(0, 0); got.R != 0xff || got.G < 0x7e || got.G > 0x80 || got.G != got.B {
+		t.Errorf("half transparent red: got %v, want pink", got)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeThumbnail(&buf, image.NewRGBA(image.Rect(0, 0, 640, 480)), 320); err != nil {
+		t.Fatal(err)
+	}
+	if config, format, err := image.DecodeConfig(&buf); err != nil || format != "jpeg" || config.Width != 320 || config.Height != 240 {
+		t.Errorf("encoded thumbnail: got %+v %s, %v", config, format, err)
+	}
+}
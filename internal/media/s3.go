@@ -0,0 +1,144 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Timeout bounds every request to the bucket, reading a file included.
+const S3Timeout = 30 * time.Second
+
+// S3Config keeps files in Bucket on an S3 compatible service. Endpoint
+// defaults to AWS in Region; MinIO and most others want their own URL,
+// such as http://localhost:9000, and PathStyle. Files are served from
+// PublicURL, where the bucket is readable by anyone, or through the site
+// when it is empty.
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	PathStyle bool   `yaml:"pathStyle"`
+	PublicURL string `yaml:"publicURL"`
+}
+
+// S3 is a Store in an S3 bucket, talked to through the MinIO client.
+type S3 struct {
+	cfg    S3Config
+	client *minio.Client
+	prefix string
+}
+
+// NewS3 checks the config of a bucket whose files, without a public URL,
+// are served under the path prefix.
+func NewS3(cfg S3Config, prefix string) (*S3, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: no bucket is set")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3: the access key and secret key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3: endpoint %q is not an http or https URL", cfg.Endpoint)
+	}
+	if endpoint.Path != "" {
+		return nil, fmt.Errorf("s3: endpoint %q has a path, but the bucket must be at its root", cfg.Endpoint)
+	}
+	lookup := minio.BucketLookupDNS
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       endpoint.Scheme == "https",
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	return &S3{cfg: cfg, client: client, prefix: prefix}, nil
+}
+func (s *S3) Put(c context.Context, key string, data []byte, contentType string) error {
+	c, cancel := context.WithTimeout(c, S3Timeout)
+	defer cancel()
+	_, err := s.client.PutObject(c, s.cfg.Bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: contentType, CacheControl: CacheControl})
+	return s.fail(http.MethodPut, key, err)
+}
+func (s *S3) Get(c context.Context, key string) (*Object, error) {
+	c, cancel := context.WithTimeout(c, S3Timeout)
+	object, err := s.client.GetObject(c, s.cfg.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		cancel()
+		return nil, s.fail(http.MethodGet, key, err)
+	}
+	// GetObject only sends the request once the object is first used.
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		cancel()
+		return nil, s.fail(http.MethodGet, key, err)
+	}
+	return &Object{Body: s3Body{object, cancel}, ContentType: info.ContentType, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// Delete succeeds for keys that are already gone, as S3 itself does.
+func (s *S3) Delete(c context.Context, key string) error {
+	c, cancel := context.WithTimeout(c, S3Timeout)
+	defer cancel()
+	err := s.fail(http.MethodDelete, key, s.client.RemoveObject(c, s.cfg.Bucket, key, minio.RemoveObjectOptions{}))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+func (s *S3) URL(key string) string {
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + key
+	}
+	return s.prefix + key
+}
+
+// fail turns a missing object into ErrNotFound and says which request
+// any other error came from.
+func (s *S3) fail(method string, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if response := minio.ToErrorResponse(err); response.StatusCode == http.StatusNotFound && response.Code != "NoSuchBucket" {
+		return ErrNotFound
+	}
+	return fmt.Errorf("s3: %s %s: %w", method, key, err)
+}
+
+// s3Body is an object being read, which can seek, and whose request ends
+// when it is closed.
+type s3Body struct {
+	*minio.Object
+	cancel context.CancelFunc
+}
+
+func (b s3Body) Close() error {
+	defer b.cancel()
+	return b.Object.Close()
+}
@@ -0,0 +1,147 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 keeps objects in memory, answering the requests S3 does for a
+// path-style bucket, and checks they are signed with the access key.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+type fakeObject struct {
+	data                      []byte
+	contentType, cacheControl string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=test-key/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		f.t.Errorf("%s %s: unsigned, Authorization %q", r.Method, r.URL.Path, auth)
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/uploads/")
+	if !ok {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, found := f.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+			data = unchunk(data)
+		}
+		f.objects[key] = fakeObject{data, r.Header.Get("Content-Type"), r.Header.Get("Cache-Control")}
+	case http.MethodGet, http.MethodHead:
+		if !found {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		w.Write(object.data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// unchunk decodes a body sent with aws-chunked encoding, where each chunk
+// starts with its size in hex and its signature.
+func unchunk(body []byte) []byte {
+	var data []byte
+	for {
+		header, rest, _ := strings.Cut(string(body), "\r\n")
+		size, err := strconv.ParseInt(strings.Split(header, ";")[0], 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			return data
+		}
+		data = append(data, rest[:size]...)
+		body = []byte(strings.TrimPrefix(rest[size:], "\r\n"))
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{t: t, objects: map[string]fakeObject{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s, err := NewS3(S3Config{Endpoint: server.URL, Bucket: "uploads", AccessKey: "test-key", SecretKey: "test-secret", PathStyle: true}, "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.Put(c, "a.png", []byte("image"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if stored := fake.objects["a.png"]; string(stored.data) != "image" || stored.contentType != "image/png" || stored.cacheControl != CacheControl {
+		t.Errorf("stored %q as %q with %q", stored.data, stored.contentType, stored.cacheControl)
+	}
+	object, err := s.Get(c, "a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := object.Body.(io.ReadSeeker); !ok {
+		t.Error("the body cannot seek")
+	}
+	data, err := io.ReadAll(object.Body)
+	object.Body.Close()
+	if err != nil || string(data) != "image" || object.ContentType != "image/png" || object.Size != 5 || object.ModTime.IsZero() {
+		t.Errorf("got %q, %v, %+v", data, err, object)
+	}
+	if _, err := s.Get(c, "missing.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing object: got %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(c, "a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(c, "a.png"); err != nil {
+		t.Errorf("deleting again: %v", err)
+	}
+	if _, err := s.Get(c, "a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted object: got %v, want ErrNotFound", err)
+	}
+	if got := s.URL("a.png"); got != "/media/a.png" {
+		t.Errorf("URL: got %s", got)
+	}
+	if _, err := NewS3(S3Config{Endpoint: server.URL + "/path", Bucket: "uploads", AccessKey: "k", SecretKey: "s"}, ""); err == nil {
+		t.Error("an endpoint with a path was accepted")
+	}
+}
+
+// TestNewS3 links to a public URL when there is one and refuses
+// incomplete configs.
+func TestNewS3(t *testing.T) {
+	s3, err := NewS3(S3Config{Bucket: "uploads", AccessKey: "access", SecretKey: "secret", PublicURL: "https://cdn.example.com/"}, "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s3.URL("a.png"); got != "https://cdn.example.com/a.png" {
+		t.Errorf("public URL: got %q", got)
+	}
+	for what, cfg := range map[string]S3Config{
+		"no bucket":        {AccessKey: "access", SecretKey: "secret"},
+		"no secret key":    {Bucket: "uploads", AccessKey: "access"},
+		"a relative URL":   {Bucket: "uploads", AccessKey: "access", SecretKey: "secret", Endpoint: "localhost:9000"},
+		"an ftp endpoint":  {Bucket: "uploads", AccessKey: "access", SecretKey: "secret", Endpoint: "ftp://localhost"},
+		"an unparsed host": {Bucket: "uploads", AccessKey: "access", SecretKey: "secret", Endpoint: "http://[::1"},
+	} {
+		if _, err := NewS3(cfg, "/media/"); err == nil {
+			t.Errorf("%s: opened", what)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// CacheControl is sent with stored files. Their keys are new for every
+// upload, so they never change and may be kept for good.
+const CacheControl = "public, max-age=31536000, immutable"
+
+var ErrNotFound = errors.New("media: not found")
+
+// Store keeps uploaded files under keys. URL is where a stored file is
+// served from, which for stores the site cannot link to directly is the
+// site itself, reading the file back with Get.
+type Store interface {
+	Put(c context.Context, key string, data []byte, contentType string) error
+	Get(c context.Context, key string) (*Object, error)
+	Delete(c context.Context, key string) error
+	URL(key string) string
+}
+
+// Object is a stored file being read. Its Body is also an io.ReadSeeker
+// when the store can seek in it.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// Local is a Store in a directory on disk, served under the path prefix.
+// Files only live as long as the disk, so hosts that replace theirs on
+// every deploy need S3 instead.
+type Local struct {
+	root   string
+	prefix string
+}
+
+func NewLocal(root string, prefix string) *Local {
+	return &Local{root: root, prefix: prefix}
+}
+
+// Put writes the file whole or not at all, so a half-written file is never
+// served.
+func (l *Local) Put(_ context.Context, key string, data []byte, _ string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+func (l *Local) Get(_ context.Context, key string) (*Object, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Object{Body: file, ContentType: mime.TypeByExtension(path.Ext(key)), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+func (l *Local) Delete(_ context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+func (l *Local) URL(key string) string {
+	return l.prefix + key
+}
+
+// path keeps keys inside the root.
+func (l *Local) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", &fs.PathError{Op: "media", Path: key, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,53 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLocal stores, reads and deletes files under a root, and refuses keys
+// that would leave it.
+func TestLocal(t *testing.T) {
+	c := context.Background()
+	root := t.TempDir()
+	local := NewLocal(root, "/media/")
+	if err := local.Put(c, "a/b.png", []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	object, err := local.Get(c, "a/b.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(object.Body)
+	object.Body.Close()
+	if _, ok := object.Body.(io.ReadSeeker); !ok || string(data) != "png" || object.ContentType != "image/png" || object.Size != 3 || object.ModTime.IsZero() {
+		t.Errorf("get: got %q and %+v", data, object)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "a")); len(entries) != 1 {
+		t.Errorf("put left %d files behind, want only the file", len(entries))
+	}
+	if got := local.URL("a/b.png"); got != "/media/a/b.png" {
+		t.Errorf("URL: got %q", got)
+	}
+	if err := local.Delete(c, "a/b.png"); err != nil {
+		t.Error(err)
+	}
+	if _, err := local.Get(c, "a/b.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after the delete: got %v", err)
+	}
+	if err := local.Delete(c, "a/b.png"); err != nil {
+		t.Errorf("delete again: %v", err)
+	}
+	for _, key := range []string{"../escape.png", "/etc/passwd", ".", "a/../../b"} {
+		if err := local.Put(c, key, []byte("x"), ""); err == nil {
+			t.Errorf("put %q: succeeded", key)
+		}
+		if _, err := local.Get(c, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get %q: got %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, histograms sort
+// durations into.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	mu         sync.Mutex
+	registered []*metric
+)
+
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*series
+}
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64
+	count  uint64
+}
+
+// Counter counts events, one series per combination of label values.
+type Counter struct{ m *metric }
+
+// Gauge tracks a value that goes up and down, like open connections.
+type Gauge struct{ m *metric }
+
+// Histogram sorts observations into buckets and keeps their sum.
+type Histogram struct{ m *metric }
+
+func register(name, help, kind string, buckets []float64, labels []string) *metric {
+	m := &metric{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: map[string]*series{}}
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, m)
+	return m
+}
+func NewCounter(name, help string, labels ...string) Counter {
+	return Counter{register(name, help, "counter", nil, labels)}
+}
+func NewGauge(name, help string, labels ...string) Gauge {
+	return Gauge{register(name, help, "gauge", nil, labels)}
+}
+func NewHistogram(name, help string, labels ...string) Histogram {
+	return Histogram{register(name, help, "histogram", DefaultBuckets, labels)}
+}
+
+// with runs f on the series of the given label values, creating it first.
+func (m *metric) with(values []string, f func(*series)) {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d labels, got %d", m.name, len(m.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.series[key]
+	if s == nil {
+		s = &series{labels: slices.Clone(values), counts: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	f(s)
+}
+func (c Counter) Inc(labels ...string) {
+	c.m.with(labels, func(s *series) { s.value++ })
+}
+func (g Gauge) Inc(labels ...string) {
+	g.m.with(labels, func(s *series) { s.value++ })
+}
+func (g Gauge) Dec(labels ...string) {
+	g.m.with(labels, func(s *series) { s.value-- })
+}
+func (h Histogram) Observe(value float64, labels ...string) {
+	h.m.with(labels, func(s *series) {
+		for i, bound := range h.m.buckets {
+			if value <= bound {
+				s.counts[i]++
+			}
+		}
+		s.value += value
+		s.count++
+	})
+}
+
+// Write writes every registered metric in the Prometheus text format.
+func Write(w io.Writer) {
+	mu.Lock()
+	metrics := slices.Clone(registered)
+	mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+func (m *metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, m.format(s.labels, ""), number(s.value))
+			continue
+		}
+		for i, bound := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.format(s.labels, number(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.format(s.labels, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, m.format(s.labels, ""), number(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, m.format(s.labels, ""), s.count)
+	}
+}
+
+var escape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// format renders label values as {name="value",...}, adding the bucket
+// bound le when it is set.
+func (m *metric) format(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range m.labels {
+		pairs = append(pairs, name+`="`+escape.Replace(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+func number(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the registered metrics for Prometheus to scrape.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
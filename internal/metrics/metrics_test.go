@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestWrite records into each kind of metric and checks the text the
+// scrape endpoint serves.
+func TestWrite(t *testing.T) {
+	counter := NewCounter("test_events_total", "Events, by kind.", "kind")
+	gauge := NewGauge("test_open", "Open things.")
+	histogram := NewHistogram("test_seconds", "Durations, by step.", "step")
+	counter.Inc("b")
+	counter.Inc(`a "quoted"` + "\n")
+	counter.Inc("b")
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	histogram.Observe(0.002, "load")
+	histogram.Observe(3, "load")
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("content type: got %q", got)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# HELP test_events_total Events, by kind.\n# TYPE test_events_total counter\n" +
+			`test_events_total{kind="a \"quoted\"\n"} 1` + "\n" +
+			`test_events_total{kind="b"} 2` + "\n",
+		"# TYPE test_open gauge\ntest_open 1\n",
+		"# TYPE test_seconds histogram\n" +
+			`test_seconds_bucket{step="load",le="0.001"} 0` + "\n" +
+			`test_seconds_bucket{step="load",le="0.005"} 1` + "\n",
+		`test_seconds_bucket{step="load",le="2.5"} 1` + "\n" +
+			`test_seconds_bucket{step="load",le="5"} 2` + "\n",
+		`test_seconds_bucket{step="load",le="+Inf"} 2` + "\n" +
+			`test_seconds_sum{step="load"} 3.002` + "\n" +
+			`test_seconds_count{step="load"} 2` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing\n%s\nin\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "test_events_total") > strings.Index(body, "test_open") {
+		t.Error("metrics are not sorted by name")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a counter took the wrong number of labels")
+		}
+	}()
+	counter.Inc("a", "b")
+}
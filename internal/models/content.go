@@ -0,0 +1,111 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// TitleNormalization is what Normalize does to a title to make the key
+// duplicate posts are found by. With every step off, titles only match
+// when they are the same apart from surrounding spaces.
+type TitleNormalization struct {
+	Lowercase          bool `yaml:"lowercase"`
+	StripPunctuation   bool `yaml:"stripPunctuation"`
+	CollapseWhitespace bool `yaml:"collapseWhitespace"`
+}
+
+var TitleRules = TitleNormalization{Lowercase: true, StripPunctuation: true, CollapseWhitespace: true}
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM), mentions)
+var ContentPolicy = bluemonday.UGCPolicy()
+var TextPolicy = bluemonday.StrictPolicy()
+
+// Fingerprint names the rules that are on, so keys made under other rules
+// can be told apart.
+func (n TitleNormalization) Fingerprint() string {
+	return fmt.Sprintf("lowercase=%t,stripPunctuation=%t,collapseWhitespace=%t", n.Lowercase, n.StripPunctuation, n.CollapseWhitespace)
+}
+func (n TitleNormalization) Normalize(title string) string {
+	if n.Lowercase {
+		title = strings.ToLower(title)
+	}
+	if n.StripPunctuation {
+		title = strings.Map(func(r rune) rune {
+			if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+				return -1
+			}
+			return r
+		}, title)
+	}
+	if n.CollapseWhitespace {
+		title = strings.Join(strings.Fields(title), " ")
+	}
+	return strings.TrimSpace(title)
+}
+func (p *Post) RenderContent()    { p.ContentHTML = string(Markdown(p.Content)) }
+func (c *Comment) RenderContent() { c.ContentHTML = string(Markdown(c.Content)) }
+func (m *Message) RenderContent() { m.ContentHTML = string(Markdown(m.Content)) }
+func Markdown(source string) template.HTML {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return template.HTML(html.EscapeString(source))
+	}
+	return template.HTML(ContentPolicy.SanitizeBytes(buf.Bytes()))
+}
+func StripTags(text string) string {
+	for i := 0; i < 8; i++ {
+		stripped := html.UnescapeString(TextPolicy.Sanitize(text))
+		if stripped == text {
+			break
+		}
+		text = stripped
+	}
+	return strings.TrimSpace(text)
+}
+
+// BuildCommentTree nests comments under their parents, keeping siblings in
+// the order they come in. Replies deeper than maxDepth are listed under
+// the comment at that depth.
+func BuildCommentTree(comments []Comment, maxDepth int) []*Comment {
+	byID := make(map[string]*Comment, len(comments))
+	for i := range comments {
+		comments[i].Replies, comments[i].Depth = nil, 0
+		byID[comments[i].ID] = &comments[i]
+	}
+	children := map[string][]*Comment{}
+	var roots []*Comment
+	for i := range comments {
+		comment := &comments[i]
+		if _, ok := byID[comment.ParentCommentID]; ok && comment.ParentCommentID != comment.ID {
+			children[comment.ParentCommentID] = append(children[comment.ParentCommentID], comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+	var attach func(parent *Comment, replies []*Comment)
+	attach = func(parent *Comment, replies []*Comment) {
+		for _, reply := range replies {
+			if parent.Depth >= maxDepth {
+				reply.Depth = parent.Depth
+				parent.Replies = append(parent.Replies, reply)
+				attach(parent, children[reply.ID])
+				continue
+			}
+			reply.Depth = parent.Depth + 1
+			parent.Replies = append(parent.Replies, reply)
+			attach(reply, children[reply.ID])
+		}
+	}
+	for _, root := range roots {
+		attach(root, children[root.ID])
+	}
+	return roots
+}
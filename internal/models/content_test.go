@@ -0,0 +1,141 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	for _, title := range []string{"Hello, World!", "HELLO   world", "Hello\tWorld?!", "  hello world... "} {
+		if got := TitleRules.Normalize(title); got != "hello world" {
+			t.Errorf("Normalize(%q) = %q, want %q", title, got, "hello world")
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		rules TitleNormalization
+		a, b  string
+		same  bool
+	}{
+		{TitleRules, "Is GORM worth it?", "is gorm worth it", true},
+		{TitleRules, "TIL about `errors.Join`!", "til about errorsjoin", true},
+		{TitleRules, "  Go   1.22  is out ", "go 122 is out", true},
+		{TitleRules, "Tabs\tand\nnewlines", "tabs and newlines", true},
+		{TitleRules, "Is GORM worth it?", "Is GORM worth it for you?", false},
+		{TitleNormalization{StripPunctuation: true}, "Is GORM worth it?", "is gorm worth it", false},
+		{TitleNormalization{Lowercase: true}, "Is GORM worth it?", "is gorm worth it", false},
+		{TitleNormalization{}, "  Is GORM worth it? ", "Is GORM worth it?", true},
+		{TitleNormalization{}, "Is GORM  worth it?", "Is GORM worth it?", false},
+	} {
+		a, b := tc.rules.Normalize(tc.a), tc.rules.Normalize(tc.b)
+		if (a == b) != tc.same {
+			t.Errorf("%+v: %q normalizes to %q and %q to %q, want same = %v", tc.rules, tc.a, a, tc.b, b, tc.same)
+		}
+	}
+}
+
+func TestBuildCommentTree(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var comments []Comment
+	add := func(id, parent string) {
+		comments = append(comments, Comment{Model: Model{ID: id, CreatedAt: start.Add(time.Duration(len(comments)) * time.Minute)}, ParentCommentID: parent})
+	}
+	// A chain of 12 replies, a second top-level comment, and a reply to a
+	// comment that is not there.
+	add("c1", "")
+	for i := 2; i <= 12; i++ {
+		add(fmt.Sprintf("c%d", i), fmt.Sprintf("c%d", i-1))
+	}
+	add("top", "")
+	add("orphan", "deleted")
+	// Listed newest first, as sort=new returns them. The tree keeps that
+	// order among siblings.
+	slices.Reverse(comments)
+
+	roots := BuildCommentTree(comments, MaxCommentDepth)
+	var ids []string
+	for _, root := range roots {
+		ids = append(ids, root.ID)
+	}
+	if fmt.Sprint(ids) != "[orphan top c1]" {
+		t.Fatalf("top level: got %v, want [orphan top c1]", ids)
+	}
+	comment := roots[2]
+	for depth := 0; depth < MaxCommentDepth; depth++ {
+		if comment.Depth != depth || len(comment.Replies) != 1 {
+			t.Fatalf("%s: got depth %d with %d replies, want depth %d with 1", comment.ID, comment.Depth, len(comment.Replies), depth)
+		}
+		comment = comment.Replies[0]
+	}
+	var flat []string
+	for _, reply := range comment.Replies {
+		flat = append(flat, fmt.Sprintf("%s@%d", reply.ID, reply.Depth))
+	}
+	if comment.ID != "c9" || fmt.Sprint(flat) != "[c10@8 c11@8 c12@8]" {
+		t.Errorf("replies below depth %d under %s: got %v, want c10 to c12 under c9", MaxCommentDepth, comment.ID, flat)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	got := string(Markdown("**bold** and `code`\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n<script>alert(1)</script>\n"))
+	for _, want := range []string{"<strong>bold</strong>", "<code>code</code>", "<table>", "<td>2</td>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rendered markdown lacks %s: %s", want, got)
+		}
+	}
+	if strings.Contains(got, "<script>") {
+		t.Errorf("raw HTML was rendered: %s", got)
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	got := string(Markdown("[bad](javascript:alert(1)) [good](https://example.com) <img src=x onerror=alert(1)> **bold**"))
+	if strings.Contains(got, "javascript:") || strings.Contains(got, "onerror") {
+		t.Errorf("unsafe markup survived: %s", got)
+	}
+	if !strings.Contains(got, `href="https://example.com"`) || !strings.Contains(got, `rel="nofollow"`) {
+		t.Errorf("https link lost its href or nofollow: %s", got)
+	}
+	if !strings.Contains(got, "<strong>bold</strong>") {
+		t.Errorf("bold was not rendered: %s", got)
+	}
+	for text, want := range map[string]string{
+		"<b>Bold</b> title":           "Bold title",
+		"&lt;i&gt;escaped&lt;/i&gt;":  "escaped",
+		"  <script>x</script>plain  ": "plain",
+	} {
+		if got := StripTags(text); got != want {
+			t.Errorf("StripTags(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	many := ""
+	for i := range MaxMentions + 2 {
+		many += fmt.Sprintf("@user%d ", i)
+	}
+	for source, want := range map[string]string{
+		"hi @alice and @bob-2, @alice again": "[alice bob-2]",
+		"mail bob@example.com":               "[]",
+		"`@carol` and\n\n    @dave\n":        "[]",
+		"@al is too short, @x_y_z is fine":   "[x_y_z]",
+		"see example.com/@erin or @@frank":   "[]",
+		"**@grace** in bold":                 "[grace]",
+		many:                                 fmt.Sprint([]string{"user0", "user1", "user2", "user3", "user4", "user5", "user6", "user7", "user8", "user9"}),
+	} {
+		if got := fmt.Sprint(Mentions(source)); got != want {
+			t.Errorf("Mentions(%q): got %s, want %s", source, got, want)
+		}
+	}
+	got := string(Markdown("hi @alice, mail bob@example.com `@carol`"))
+	want := `<p>hi <a href="/u/alice" rel="nofollow">@alice</a>, mail <a href="mailto:bob@example.com" rel="nofollow">bob@example.com</a> <code>@carol</code></p>` + "\n"
+	if got != want {
+		t.Errorf("rendered mentions: got %q, want %q", got, want)
+	}
+}
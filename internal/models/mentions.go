@@ -0,0 +1,59 @@
+package models
+
+import (
+	"regexp"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// MaxMentions caps how many users one post or comment can notify.
+const MaxMentions = 10
+
+var mentionPattern = regexp.MustCompile(`^@([A-Za-z0-9_-]{3,20})\b`)
+
+// mentionParser turns @username into a link to the user's profile, leaving
+// email addresses and code alone.
+type mentionParser struct{}
+
+func (mentionParser) Trigger() []byte { return []byte{'@'} }
+func (mentionParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if prev := block.PrecendingCharacter(); unicode.IsLetter(prev) || unicode.IsDigit(prev) || prev == '_' || prev == '-' || prev == '@' || prev == '/' {
+		return nil
+	}
+	line, segment := block.PeekLine()
+	match := mentionPattern.FindSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	block.Advance(len(match[0]))
+	link := ast.NewLink()
+	link.Destination = []byte("/u/" + string(match[1]))
+	link.SetAttributeString("data-mention", match[1])
+	link.AppendChild(link, ast.NewTextSegment(segment.WithStop(segment.Start+len(match[0]))))
+	return link
+}
+
+var mentions = goldmark.WithParserOptions(parser.WithInlineParsers(util.Prioritized(mentionParser{}, 500)))
+
+// Mentions lists the distinct usernames mentioned in Markdown source.
+func Mentions(source string) []string {
+	var names []string
+	seen := map[string]bool{}
+	doc := markdown.Parser().Parse(text.NewReader([]byte(source)))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if name, ok := n.AttributeString("data-mention"); ok && !seen[string(name.([]byte))] && len(names) < MaxMentions {
+			seen[string(name.([]byte))] = true
+			names = append(names, string(name.([]byte)))
+		}
+		return ast.WalkContinue, nil
+	})
+	return names
+}
@@ -0,0 +1,639 @@
+package models
+
+import (
+	"html/template"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageSize = 25
+	MaxPageSize     = 100
+	MaxCommentDepth = 8
+
+	NotifyPostReply    = "post_reply"
+	NotifyCommentReply = "comment_reply"
+	NotifyMention      = "mention"
+
+	ReportOpen     = "open"
+	ReportApproved = "approved"
+	ReportRemoved  = "removed"
+
+	EvasionOpen      = "open"
+	EvasionCleared   = "cleared"
+	EvasionConfirmed = "confirmed"
+
+	ModRemove          = "remove"
+	ModApprove         = "approve"
+	ModAddModerator    = "add_moderator"
+	ModRemoveModerator = "remove_moderator"
+	ModEditTopic       = "edit_topic"
+	ModDeleteTopic     = "delete_topic"
+	ModEditAutomod     = "edit_automod"
+	ModEditFilter      = "edit_filter"
+	ModEditPost        = "edit_post"
+	ModEditComment     = "edit_comment"
+	ModRestore         = "restore"
+	ModRestoreTopic    = "restore_topic"
+	ModEditFlair       = "edit_flair"
+	ModEditUserFlair   = "edit_user_flair"
+	ModPin             = "pin"
+	ModUnpin           = "unpin"
+	ModSticky          = "sticky"
+	ModUnsticky        = "unsticky"
+	ModLock            = "lock"
+	ModUnlock          = "unlock"
+	ModEditAutoPin     = "edit_auto_pin"
+
+	// Comments are distinguished as from a moderator of their topic or a
+	// site admin.
+	DistinguishModerator = "moderator"
+	DistinguishAdmin     = "admin"
+
+	AutomodRemove = "remove"
+	AutomodHold   = "hold"
+	AutomodFlag   = "flag"
+
+	FilterWord   = "word"
+	FilterDomain = "domain"
+	FilterReject = "reject"
+	FilterHold   = "hold"
+
+	PostSelf  = "self"
+	PostLink  = "link"
+	PostImage = "image"
+	PostPoll  = "poll"
+	// PostCrosspost shares the content of the post in another topic it
+	// names, with its own votes and comments.
+	PostCrosspost = "crosspost"
+
+	// PollDuration is how long polls stay open unless their author says.
+	PollDuration = 3 * 24 * time.Hour
+)
+
+// MediaExtensions are the content types images are uploaded in, with the
+// file extension each is stored under.
+var MediaExtensions = map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/gif": ".gif"}
+
+type IDs struct {
+	TopicID   string `param:"topicid"`
+	PostID    string `param:"postid"`
+	CommentID string `param:"commentid"`
+}
+type Model struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+type User struct {
+	Model
+	Username     string `gorm:"uniqueIndex;size:64" json:"username"`
+	PasswordHash []byte `json:"-"`
+	PostKarma    int    `gorm:"not null;default:0" json:"postKarma"`
+	CommentKarma int    `gorm:"not null;default:0" json:"commentKarma"`
+	Shadowbanned bool   `gorm:"not null;default:false" json:"-"`
+	Banned       bool   `gorm:"not null;default:false" json:"banned"`
+}
+type Session struct {
+	Model
+	UserID    string `gorm:"index;size:64"`
+	User      *User
+	ExpiresAt time.Time `gorm:"index"`
+}
+type Identity struct {
+	Model
+	Provider string `gorm:"uniqueIndex:idx_identities_provider_subject;size:32"`
+	Subject  string `gorm:"uniqueIndex:idx_identities_provider_subject;size:191"`
+	UserID   string `gorm:"index;size:64"`
+}
+type Vote struct {
+	UserID    string `gorm:"primaryKey;size:64"`
+	TopicID   string `gorm:"primaryKey;size:64"`
+	PostID    string `gorm:"primaryKey;size:64"`
+	CommentID string `gorm:"primaryKey;size:64"`
+	Value     int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+type Topic struct {
+	Model
+	Description string `json:"description"`
+	// AutoPinVotes and AutoPinMargin pin the top-level comment of a post
+	// with at least AutoPinVotes votes and AutoPinMargin more than any
+	// other. A zero AutoPinVotes leaves comments unpinned.
+	AutoPinVotes  int              `gorm:"not null;default:0" json:"autoPinVotes"`
+	AutoPinMargin int              `gorm:"not null;default:0" json:"autoPinMargin"`
+	Posts         []Post           `json:"posts"`
+	Moderators    []TopicModerator `gorm:"-" json:"-"`
+	Flairs        []Flair          `gorm:"-" json:"-"`
+	FlairID       string           `gorm:"-" json:"-"`
+	MyFlair       *UserFlair       `gorm:"-" json:"-"`
+	Subscribers   int64            `gorm:"-" json:"-"`
+	Subscribed    bool             `gorm:"-" json:"-"`
+	Page          Pagination       `gorm:"-" json:"-"`
+	More          string           `gorm:"-" json:"-"`
+}
+type TopicModerator struct {
+	TopicID   string    `gorm:"primaryKey;size:64" json:"topicID"`
+	UserID    string    `gorm:"primaryKey;size:64" json:"userID"`
+	User      *User     `json:"user,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Collection is a user's named set of topics, browsed as one feed.
+type Collection struct {
+	Model
+	OwnerID string   `gorm:"index;size:64" json:"ownerID"`
+	Name    string   `gorm:"size:64" json:"name"`
+	Topics  []string `gorm:"serializer:json" json:"topics"`
+}
+
+// TopicStats is how active a topic was over the last day, next to the day
+// before, as the trending job last counted it.
+type TopicStats struct {
+	TopicID       string    `gorm:"primaryKey;size:64" json:"topicID"`
+	Posts         int       `gorm:"not null;default:0" json:"posts"`
+	Votes         int       `gorm:"not null;default:0" json:"votes"`
+	PreviousPosts int       `gorm:"not null;default:0" json:"previousPosts"`
+	PreviousVotes int       `gorm:"not null;default:0" json:"previousVotes"`
+	Growth        float64   `gorm:"not null;default:0;index" json:"growth"`
+	CreatedAt     time.Time `json:"countedAt"`
+}
+type Subscription struct {
+	UserID    string    `gorm:"primaryKey;size:64" json:"userID"`
+	TopicID   string    `gorm:"primaryKey;size:64" json:"topicID"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Block hides the blocked user's posts and comments from the user, and stops
+// them replying to or messaging the user.
+type Block struct {
+	UserID    string    `gorm:"primaryKey;size:64" json:"userID"`
+	BlockedID string    `gorm:"primaryKey;size:64" json:"blockedID"`
+	Blocked   *User     `json:"blocked,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Saved is a post, or a comment when CommentID is set, that a user bookmarked.
+type Saved struct {
+	UserID    string    `gorm:"primaryKey;size:64" json:"userID"`
+	TopicID   string    `gorm:"primaryKey;size:64" json:"topicID"`
+	PostID    string    `gorm:"primaryKey;size:64" json:"postID"`
+	CommentID string    `gorm:"primaryKey;size:64" json:"commentID,omitempty"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+	Post      *Post     `gorm:"-" json:"post,omitempty"`
+	Comment   *Comment  `gorm:"-" json:"comment,omitempty"`
+}
+
+// HiddenPost keeps a post out of the user's feeds and topic listings.
+type HiddenPost struct {
+	UserID    string    `gorm:"primaryKey;size:64" json:"userID"`
+	TopicID   string    `gorm:"primaryKey;size:64" json:"topicID"`
+	PostID    string    `gorm:"primaryKey;size:64" json:"postID"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+	Post      *Post     `gorm:"-" json:"post,omitempty"`
+}
+type Post struct {
+	Model
+	TopicID         string         `gorm:"primaryKey;size:64;index:idx_posts_normalized_title,priority:1" json:"topicID"`
+	Title           string         `json:"title"`
+	NormalizedTitle string         `gorm:"size:191;index:idx_posts_normalized_title,priority:2" json:"-"`
+	AuthorID        string         `gorm:"index;size:64" json:"authorID"`
+	Author          *User          `json:"author,omitempty"`
+	AuthorFlair     *UserFlair     `gorm:"-" json:"authorFlair,omitempty"`
+	Kind            string         `gorm:"size:16;not null;default:self" json:"kind"`
+	URL             string         `gorm:"size:2048" json:"url,omitempty"`
+	MediaID         string         `gorm:"size:64" json:"mediaID,omitempty"`
+	Media           *Media         `json:"media,omitempty"`
+	Preview         *LinkPreview   `gorm:"-" json:"preview,omitempty"`
+	Poll            *Poll          `gorm:"-" json:"poll,omitempty"`
+	PollClosesAt    *time.Time     `json:"pollClosesAt,omitempty"`
+	CrosspostTopic  string         `gorm:"size:64" json:"crosspostTopic,omitempty"`
+	CrosspostOf     string         `gorm:"size:64;index" json:"crosspostOf,omitempty"`
+	Original        *Post          `gorm:"-" json:"original,omitempty"`
+	FlairID         string         `gorm:"size:64;index" json:"flairID,omitempty"`
+	Flair           *Flair         `json:"flair,omitempty"`
+	NSFW            bool           `gorm:"not null;default:false" json:"nsfw"`
+	Spoiler         bool           `gorm:"not null;default:false" json:"spoiler"`
+	Pinned          bool           `gorm:"not null;default:false" json:"pinned"`
+	Locked          bool           `gorm:"not null;default:false" json:"locked"`
+	Content         string         `json:"content"`
+	ContentHTML     string         `gorm:"-" json:"contentHTML,omitempty"`
+	Votes           int            `json:"votes"`
+	Ups             int            `gorm:"not null;default:0" json:"ups"`
+	Downs           int            `gorm:"not null;default:0" json:"downs"`
+	MyVote          int            `gorm:"-" json:"myVote"`
+	CommentCount    int            `gorm:"not null;default:0" json:"commentCount"`
+	Views           int            `gorm:"not null;default:0" json:"views"`
+	HotScore        float64        `gorm:"not null;default:0;index" json:"-"`
+	DecayedScore    float64        `gorm:"not null;default:0;index" json:"-"`
+	Saved           bool           `gorm:"-" json:"-"`
+	Hidden          bool           `gorm:"-" json:"-"`
+	Moderator       bool           `gorm:"-" json:"-"`
+	Shadowbanned    bool           `gorm:"not null;default:false" json:"-"`
+	EditedAt        *time.Time     `json:"editedAt,omitempty"`
+	Revisions       []PostRevision `gorm:"-" json:"-"`
+	Comments        []Comment      `json:"comments"`
+	Thread          []*Comment     `gorm:"-" json:"-"`
+	Page            Pagination     `gorm:"-" json:"-"`
+}
+
+// LinkPreview is what the page a link post points to says about itself,
+// fetched once after the post is created.
+type LinkPreview struct {
+	TopicID     string    `gorm:"primaryKey;size:64" json:"topicID"`
+	PostID      string    `gorm:"primaryKey;size:64" json:"postID"`
+	URL         string    `gorm:"size:2048" json:"url"`
+	Title       string    `gorm:"size:300" json:"title"`
+	Description string    `gorm:"size:1000" json:"description,omitempty"`
+	ImageURL    string    `gorm:"size:2048" json:"imageURL,omitempty"`
+	SiteName    string    `gorm:"size:100" json:"siteName,omitempty"`
+	CreatedAt   time.Time `json:"fetchedAt"`
+}
+
+// Media is an image a user uploaded, stored with a thumbnail of it.
+type Media struct {
+	Model
+	UploaderID   string `gorm:"index;size:64" json:"uploaderID"`
+	ContentType  string `gorm:"size:32" json:"contentType"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Size         int64  `json:"size"`
+	URL          string `gorm:"-" json:"url,omitempty"`
+	ThumbnailURL string `gorm:"-" json:"thumbnailURL,omitempty"`
+}
+
+// Poll is a poll post's options, with how many votes each got once the
+// user voted or the poll closed, when Results is set, and which one the
+// user voted for.
+type Poll struct {
+	Options []PollOption `json:"options"`
+	Closed  bool         `json:"closed"`
+	Results bool         `json:"results"`
+	Total   int          `json:"total"`
+	MyVote  int          `json:"myVote,omitempty"`
+}
+
+// PollOption is one of the answers to a poll, numbered from 1 by Position.
+type PollOption struct {
+	TopicID  string `gorm:"primaryKey;size:64" json:"-"`
+	PostID   string `gorm:"primaryKey;size:64" json:"-"`
+	Position int    `gorm:"primaryKey;autoIncrement:false" json:"position"`
+	Text     string `gorm:"size:100" json:"text"`
+	Votes    int    `gorm:"not null;default:0" json:"votes"`
+}
+
+// PollVote is the option a user picked in a poll. Users get one vote per
+// poll and cannot change it.
+type PollVote struct {
+	UserID    string    `gorm:"primaryKey;size:64" json:"userID"`
+	TopicID   string    `gorm:"primaryKey;size:64" json:"topicID"`
+	PostID    string    `gorm:"primaryKey;size:64" json:"postID"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PostRevision is the title and content a post had before an edit.
+type PostRevision struct {
+	Model
+	TopicID  string `gorm:"index:idx_post_revisions_post,priority:1;size:64" json:"topicID"`
+	PostID   string `gorm:"index:idx_post_revisions_post,priority:2;size:64" json:"postID"`
+	EditorID string `gorm:"size:64" json:"editorID"`
+	Editor   *User  `json:"editor,omitempty"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+}
+type Comment struct {
+	Model
+	TopicID         string     `gorm:"primaryKey;size:64" json:"topicID"`
+	PostID          string     `gorm:"primaryKey;size:64" json:"postID"`
+	ParentCommentID string     `gorm:"index;size:64" json:"parentCommentID,omitempty"`
+	AuthorID        string     `gorm:"index;size:64" json:"authorID"`
+	Author          *User      `json:"author,omitempty"`
+	AuthorFlair     *UserFlair `gorm:"-" json:"authorFlair,omitempty"`
+	Content         string     `json:"content"`
+	ContentHTML     string     `gorm:"-" json:"contentHTML,omitempty"`
+	Votes           int        `json:"votes"`
+	Ups             int        `gorm:"not null;default:0" json:"ups"`
+	Downs           int        `gorm:"not null;default:0" json:"downs"`
+	BestScore       float64    `gorm:"not null;default:0" json:"-"`
+	Controversy     float64    `gorm:"not null;default:0" json:"-"`
+	Stickied        bool       `gorm:"not null;default:false" json:"stickied"`
+	AutoPinned      bool       `gorm:"not null;default:false" json:"autoPinned"`
+	Distinguished   string     `gorm:"size:16" json:"distinguished,omitempty"`
+	MyVote          int        `gorm:"-" json:"myVote"`
+	Saved           bool       `gorm:"-" json:"-"`
+	Mine            bool       `gorm:"-" json:"-"`
+	Moderator       bool       `gorm:"-" json:"-"`
+	Shadowbanned    bool       `gorm:"not null;default:false" json:"-"`
+	EditedAt        *time.Time `json:"editedAt,omitempty"`
+	Depth           int        `gorm:"-" json:"-"`
+	Replies         []*Comment `gorm:"-" json:"-"`
+}
+type Notification struct {
+	Model
+	UserID    string `gorm:"index;size:64" json:"userID"`
+	ActorID   string `gorm:"size:64" json:"actorID"`
+	Actor     *User  `json:"actor,omitempty"`
+	Kind      string `gorm:"size:32" json:"kind"`
+	TopicID   string `gorm:"size:64" json:"topicID"`
+	PostID    string `gorm:"size:64" json:"postID"`
+	CommentID string `gorm:"size:64" json:"commentID"`
+	Unread    bool   `gorm:"index" json:"unread"`
+}
+type Message struct {
+	Model
+	SenderID    string `gorm:"index;size:64" json:"senderID"`
+	Sender      *User  `json:"sender,omitempty"`
+	RecipientID string `gorm:"index;size:64" json:"recipientID"`
+	Recipient   *User  `json:"recipient,omitempty"`
+	Content     string `json:"content"`
+	ContentHTML string `gorm:"-" json:"contentHTML,omitempty"`
+	Unread      bool   `gorm:"index" json:"unread"`
+}
+type Report struct {
+	Model
+	TopicID      string   `gorm:"index:idx_reports_topic_status,priority:1;uniqueIndex:idx_reports_reporter_target,priority:2;size:64" json:"topicID"`
+	PostID       string   `gorm:"uniqueIndex:idx_reports_reporter_target,priority:3;size:64" json:"postID"`
+	CommentID    string   `gorm:"uniqueIndex:idx_reports_reporter_target,priority:4;size:64" json:"commentID,omitempty"`
+	ReporterID   string   `gorm:"uniqueIndex:idx_reports_reporter_target,priority:1;size:64" json:"reporterID"`
+	Reporter     *User    `json:"reporter,omitempty"`
+	Reason       string   `json:"reason"`
+	Status       string   `gorm:"index:idx_reports_topic_status,priority:2;size:16" json:"status"`
+	ResolvedByID string   `gorm:"size:64" json:"resolvedByID,omitempty"`
+	Held         bool     `json:"held"`
+	Post         *Post    `gorm:"-" json:"post,omitempty"`
+	Comment      *Comment `gorm:"-" json:"comment,omitempty"`
+}
+
+// ArchivedReport is a resolved report moved out of the reports table once
+// it is old enough, so the queue's queries only go through recent ones.
+type ArchivedReport struct {
+	Model
+	TopicID      string    `gorm:"index:idx_archived_reports_topic,priority:1;size:64" json:"topicID"`
+	PostID       string    `gorm:"size:64" json:"postID"`
+	CommentID    string    `gorm:"size:64" json:"commentID,omitempty"`
+	ReporterID   string    `gorm:"size:64" json:"reporterID"`
+	Reporter     *User     `json:"reporter,omitempty"`
+	Reason       string    `json:"reason"`
+	Status       string    `gorm:"size:16" json:"status"`
+	ResolvedByID string    `gorm:"size:64" json:"resolvedByID,omitempty"`
+	Held         bool      `json:"held"`
+	ArchivedAt   time.Time `gorm:"index:idx_archived_reports_topic,priority:2" json:"archivedAt"`
+}
+type ModAction struct {
+	Model
+	TopicID      string `gorm:"index;size:64" json:"topicID"`
+	ModeratorID  string `gorm:"size:64" json:"moderatorID"`
+	Moderator    *User  `json:"moderator,omitempty"`
+	Action       string `gorm:"size:32" json:"action"`
+	TargetUserID string `gorm:"size:64" json:"targetUserID,omitempty"`
+	TargetUser   *User  `json:"targetUser,omitempty"`
+	PostID       string `gorm:"size:64" json:"postID,omitempty"`
+	CommentID    string `gorm:"size:64" json:"commentID,omitempty"`
+	Details      string `json:"details,omitempty"`
+}
+
+// AutomodRule acts on new posts and comments in a topic that meet all of
+// its conditions: a match of Pattern or any of Keywords in Field, an author
+// account younger than MinAccountDays, or author karma below MinKarma.
+type AutomodRule struct {
+	Model
+	TopicID        string   `gorm:"index;size:64" json:"topicID"`
+	Name           string   `gorm:"size:100" json:"name"`
+	Applies        string   `gorm:"size:16" json:"applies,omitempty"`
+	Field          string   `gorm:"size:16" json:"field,omitempty"`
+	Pattern        string   `json:"pattern,omitempty"`
+	Keywords       []string `gorm:"serializer:json" json:"keywords,omitempty"`
+	MinAccountDays int      `json:"minAccountDays,omitempty"`
+	MinKarma       *int     `json:"minKarma,omitempty"`
+	Action         string   `gorm:"size:16" json:"action"`
+}
+
+// Filter bans a word or a link domain, in one topic or, when TopicID is
+// empty, site-wide. Banned domains also cover their subdomains.
+type Filter struct {
+	Model
+	TopicID string `gorm:"index;size:64" json:"topicID,omitempty"`
+	Kind    string `gorm:"size:16" json:"kind"`
+	Value   string `gorm:"size:255" json:"value"`
+	Action  string `gorm:"size:16" json:"action"`
+}
+
+// Flair is a label a topic's moderators define for authors to give their
+// posts there, shown in Color. Flairs for Users are instead the ones users
+// may pick to show next to their name in the topic.
+type Flair struct {
+	Model
+	TopicID string `gorm:"index;size:64" json:"topicID"`
+	Text    string `gorm:"size:64" json:"text"`
+	Color   string `gorm:"size:7" json:"color"`
+	Users   bool   `gorm:"not null;default:false" json:"users"`
+}
+
+// UserFlair is shown next to the user's name on their posts and comments
+// in the topic. Moderators may set any text, while users pick one of the
+// topic's user flairs, which is copied.
+type UserFlair struct {
+	TopicID   string    `gorm:"primaryKey;size:64" json:"topicID"`
+	UserID    string    `gorm:"primaryKey;size:64" json:"userID"`
+	Text      string    `gorm:"size:64" json:"text"`
+	Color     string    `gorm:"size:7" json:"color"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Setting is a value the server keeps about itself between runs, such as
+// the title rules the stored duplicate keys were made with.
+type Setting struct {
+	Key       string    `gorm:"primaryKey;size:64" json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// UserAddress is an address a user has signed in from, kept to spot new
+// accounts of banned users.
+type UserAddress struct {
+	UserID   string    `gorm:"primaryKey;size:64" json:"userID"`
+	IP       string    `gorm:"primaryKey;size:45;index" json:"ip"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// EvasionReview holds an account that signed in from the address of a
+// banned one for an admin to look at. Until then its content is shadow
+// removed: shown to it alone.
+type EvasionReview struct {
+	Model
+	UserID       string `gorm:"index;size:64" json:"userID"`
+	User         *User  `json:"user,omitempty"`
+	BannedUserID string `gorm:"size:64" json:"bannedUserID"`
+	BannedUser   *User  `json:"bannedUser,omitempty"`
+	IP           string `gorm:"size:45" json:"ip"`
+	Status       string `gorm:"index;size:16" json:"status"`
+	ResolvedByID string `gorm:"size:64" json:"resolvedByID,omitempty"`
+}
+type SortRequest struct {
+	Sort   string `query:"sort"`
+	Window string `query:"t"`
+}
+type PageRequest struct {
+	Limit     int    `query:"limit"`
+	Offset    int    `query:"offset"`
+	PageToken string `query:"pageToken"`
+}
+type Pagination struct {
+	Total  int64  `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Next   string `json:"next,omitempty"`
+	Prev   string `json:"prev,omitempty"`
+	// NextPageToken fetches the following page when passed as pageToken.
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+type ListResponse[T any] struct {
+	Items []T `json:"items"`
+	Pagination
+}
+type SearchResult struct {
+	Kind      string        `json:"kind"`
+	TopicID   string        `json:"topicID"`
+	PostID    string        `json:"postID"`
+	CommentID string        `json:"commentID,omitempty"`
+	Title     template.HTML `json:"title"`
+	Snippet   template.HTML `json:"snippet"`
+}
+
+// All lists every model the database schema is built from.
+func All() []any {
+	return []any{&User{}, &Session{}, &Identity{}, &Vote{}, &Post{}, &Comment{}, &Topic{}, &Notification{}, &Message{}, &TopicModerator{}, &Report{}, &ArchivedReport{}, &ModAction{}, &AutomodRule{}, &Filter{}, &Block{}, &Subscription{}, &Collection{}, &Saved{}, &HiddenPost{}, &PostRevision{}, &LinkPreview{}, &Media{}, &PollOption{}, &PollVote{}, &Flair{}, &UserFlair{}, &Setting{}, &UserAddress{}, &EvasionReview{}}
+}
+func (t *Topic) BeforeCreate(tx *gorm.DB) error {
+	t.ID = StripTags(t.ID)
+	return nil
+}
+func (p *Post) BeforeCreate(tx *gorm.DB) error {
+	p.Title = StripTags(p.Title)
+	p.NormalizedTitle = TitleRules.Normalize(p.Title)
+	if p.Kind == "" {
+		p.Kind = PostSelf
+		if p.URL != "" {
+			p.Kind = PostLink
+		} else if p.MediaID != "" {
+			p.Kind = PostImage
+		} else if p.Poll != nil {
+			p.Kind = PostPoll
+		}
+	}
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	if p.Kind == PostPoll && p.PollClosesAt == nil {
+		closes := p.CreatedAt.Add(PollDuration)
+		p.PollClosesAt = &closes
+	}
+	p.HotScore, p.DecayedScore = Hot(p.Votes, p.CreatedAt), Decayed(p.Votes, p.CreatedAt, Decay.HalfLife)
+	return nil
+}
+
+// Report returns the archived report as the report it was.
+func (r ArchivedReport) Report() Report {
+	return Report{Model: r.Model, TopicID: r.TopicID, PostID: r.PostID, CommentID: r.CommentID, ReporterID: r.ReporterID, Reporter: r.Reporter, Reason: r.Reason, Status: r.Status, ResolvedByID: r.ResolvedByID, Held: r.Held}
+}
+func (p PageRequest) Normalize() PageRequest {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageSize
+	}
+	return PageRequest{Limit: min(p.Limit, MaxPageSize), Offset: max(p.Offset, 0), PageToken: p.PageToken}
+}
+func (p Pagination) HasNext() bool        { return int64(p.Offset+p.Limit) < p.Total }
+func (p Pagination) HasPrev() bool        { return p.Offset > 0 }
+func (p *Pagination) Paging() *Pagination { return p }
+func (p *Pagination) Link(u *url.URL) {
+	link := func(offset int) string {
+		query := u.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("limit", strconv.Itoa(p.Limit))
+		return u.Path + "?" + query.Encode()
+	}
+	if p.HasNext() {
+		p.Next = link(p.Offset + p.Limit)
+	}
+	if p.HasPrev() {
+		p.Prev = link(max(p.Offset-p.Limit, 0))
+	}
+}
+func (l *ListResponse[T]) RenderContent() {
+	for i := range l.Items {
+		if renderer, ok := any(&l.Items[i]).(interface{ RenderContent() }); ok {
+			renderer.RenderContent()
+		}
+	}
+}
+func (t *Topic) Paging() *Pagination { return &t.Page }
+func (p *Post) Paging() *Pagination  { return &p.Page }
+
+// PostFlairs are the topic's flairs for posts.
+func (t Topic) PostFlairs() []Flair {
+	return slices.DeleteFunc(slices.Clone(t.Flairs), func(f Flair) bool { return f.Users })
+}
+
+// UserFlairs are the topic's flairs for users to pick from.
+func (t Topic) UserFlairs() []Flair {
+	return slices.DeleteFunc(slices.Clone(t.Flairs), func(f Flair) bool { return !f.Users })
+}
+
+// Key is the name the original image is stored under.
+func (m Media) Key() string { return m.ID + MediaExtensions[m.ContentType] }
+
+// ThumbnailKey is the name the image's thumbnail is stored under.
+func (m Media) ThumbnailKey() string { return ThumbnailKey(m.ID) }
+
+// ThumbnailKey is the name the thumbnail of the image with the ID is
+// stored under. Thumbnails are always JPEG, so listings can link one
+// without loading the image's record.
+func ThumbnailKey(mediaID string) string { return mediaID + "-thumb.jpg" }
+
+// IsLink reports whether the post links out rather than being a text post.
+func (p Post) IsLink() bool { return p.Kind == PostLink }
+
+// IsPoll reports whether the post asks a poll.
+func (p Post) IsPoll() bool { return p.Kind == PostPoll }
+
+// IsCrosspost reports whether the post shares another post's content.
+func (p Post) IsCrosspost() bool { return p.Kind == PostCrosspost }
+
+// TextColor is black or white, whichever reads better on the flair's
+// color.
+func (f Flair) TextColor() string { return textColor(f.Color) }
+
+// TextColor is as for Flair.
+func (f UserFlair) TextColor() string { return textColor(f.Color) }
+
+// textColor is black or white, whichever reads better on the #rrggbb
+// background.
+func textColor(background string) string {
+	rgb, err := strconv.ParseUint(strings.TrimPrefix(background, "#"), 16, 24)
+	if err != nil {
+		return "#000000"
+	}
+	r, g, b := rgb>>16, rgb>>8&0xff, rgb&0xff
+	if 299*r+587*g+114*b < 128000 {
+		return "#ffffff"
+	}
+	return "#000000"
+}
+
+// Domain is the host a link post points to, without a leading "www.".
+func (p Post) Domain() string {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
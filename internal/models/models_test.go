@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestPostDomain(t *testing.T) {
+	for _, tc := range []struct {
+		url, want string
+	}{
+		{"https://www.Example.com/a?b=c", "example.com"},
+		{"http://blog.golang.org:8080/", "blog.golang.org"},
+		{"", ""},
+		{"://bad", ""},
+	} {
+		if got := (Post{Kind: PostLink, URL: tc.url}).Domain(); got != tc.want {
+			t.Errorf("domain of %q: got %q, want %q", tc.url, got, tc.want)
+		}
+	}
+	if (Post{Kind: PostSelf}).IsLink() || !(Post{Kind: PostLink}).IsLink() {
+		t.Error("only link posts should be links")
+	}
+}
+
+func TestFlairTextColor(t *testing.T) {
+	for color, want := range map[string]string{
+		"#000000": "#ffffff",
+		"#ffffff": "#000000",
+		"#ff4500": "#ffffff",
+		"#e0e0e0": "#000000",
+		"red":     "#000000",
+	} {
+		if got := (Flair{Color: color}).TextColor(); got != want {
+			t.Errorf("text color on %s: got %s, want %s", color, got, want)
+		}
+		if got := (UserFlair{Color: color}).TextColor(); got != want {
+			t.Errorf("user flair text color on %s: got %s, want %s", color, got, want)
+		}
+	}
+}
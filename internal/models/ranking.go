@@ -0,0 +1,99 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// HotEpoch is when hot scores start counting. Only differences between
+// scores matter, so any fixed time in the past would do.
+var HotEpoch = time.Date(2005, time.December, 8, 7, 46, 43, 0, time.UTC)
+
+// HotDecay is how much newer a post must be to rank level with one that
+// has ten times its votes.
+const HotDecay = 12*time.Hour + 30*time.Minute
+
+// Hot ranks a post by the order of magnitude of its votes plus its age, so
+// every 12.5 hours a post needs ten times the votes to keep its place.
+// Scores do not change as time passes, only when votes do, so they can be
+// stored and indexed.
+func Hot(votes int, created time.Time) float64 {
+	order := math.Log10(math.Max(math.Abs(float64(votes)), 1))
+	sign := 0.0
+	if votes > 0 {
+		sign = 1
+	} else if votes < 0 {
+		sign = -1
+	}
+	seconds := created.Sub(HotEpoch).Seconds()
+	return math.Round((sign*order+seconds/HotDecay.Seconds())*1e7) / 1e7
+}
+
+// ScoreDecay makes feeds rank posts by their votes halved for every
+// HalfLife of age, instead of by the hot score or raw votes. Feeds across
+// topics use it once HalfLife is set, topic listings only with Topics too.
+type ScoreDecay struct {
+	HalfLife time.Duration `yaml:"halfLife"`
+	Topics   bool          `yaml:"topics"`
+}
+
+// Decay is off until a half-life is configured.
+var Decay ScoreDecay
+
+// Decayed ranks a post the way its votes times 2^(-age/halfLife) would,
+// in the form Hot uses: the base 2 logarithm of its votes plus how many
+// half-lives after HotEpoch it was posted. Like Hot, it only changes with
+// votes. Without a half-life it is 0.
+func Decayed(votes int, created time.Time, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return 0
+	}
+	order := math.Log2(math.Max(math.Abs(float64(votes)), 1))
+	sign := 0.0
+	if votes > 0 {
+		sign = 1
+	} else if votes < 0 {
+		sign = -1
+	}
+	halfLives := created.Sub(HotEpoch).Seconds() / halfLife.Seconds()
+	return math.Round((sign*order+halfLives)*1e7) / 1e7
+}
+
+// Wilson is the lower bound of the Wilson score interval for a comment's
+// share of upvotes at 80% confidence: the share it has earned, discounted
+// for how few votes that is based on. A comment without upvotes scores 0.
+func Wilson(ups, downs int) float64 {
+	if ups <= 0 {
+		return 0
+	}
+	n := float64(ups + downs)
+	const z = 1.281551565545
+	p := float64(ups) / n
+	return (p + z*z/(2*n) - z*math.Sqrt((p*(1-p)+z*z/(4*n))/n)) / (1 + z*z/n)
+}
+
+// Controversy grows with the number of votes and how evenly they split.
+// Anything voted only one way scores 0.
+func Controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(float64(ups+downs), balance)
+}
+
+// Scored is a post or comment with ranking columns that follow from its
+// votes, stored whenever they change.
+type Scored interface {
+	Scores() map[string]any
+}
+
+func (p *Post) Scores() map[string]any {
+	return map[string]any{"hot_score": Hot(p.Votes, p.CreatedAt), "decayed_score": Decayed(p.Votes, p.CreatedAt, Decay.HalfLife)}
+}
+func (c *Comment) Scores() map[string]any {
+	return map[string]any{"best_score": Wilson(c.Ups, c.Downs), "controversy": Controversy(c.Ups, c.Downs)}
+}
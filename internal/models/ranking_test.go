@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHot(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if Hot(0, HotEpoch) != 0 || Hot(1, HotEpoch) != 0 || Hot(-1, HotEpoch) != 0 {
+		t.Error("a post at the epoch with at most one vote should score 0")
+	}
+	if got := Hot(100, HotEpoch); got != 2 {
+		t.Errorf("100 votes at the epoch: got %v, want 2", got)
+	}
+	if got := Hot(-100, HotEpoch); got != -2 {
+		t.Errorf("-100 votes at the epoch: got %v, want -2", got)
+	}
+	if a, b := Hot(10, now), Hot(1, now.Add(HotDecay)); a != b {
+		t.Errorf("ten times the votes should keep level with a post one decay newer: got %v and %v", a, b)
+	}
+	if Hot(5, now) <= Hot(5, now.Add(-time.Hour)) || Hot(6, now) <= Hot(5, now) {
+		t.Error("a newer post, or one with more votes, should rank higher")
+	}
+}
+
+func TestDecayed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	if Decayed(100, now, 0) != 0 {
+		t.Error("without a half-life every post should score 0")
+	}
+	if a, b := Decayed(8, now, time.Hour), Decayed(1, now.Add(3*time.Hour), time.Hour); a != b {
+		t.Errorf("eight times the votes should keep level with a post three half-lives newer: got %v and %v", a, b)
+	}
+	week := now.Add(-7 * 24 * time.Hour)
+	if Decayed(1000, week, 24*time.Hour) >= Decayed(20, now, 24*time.Hour) {
+		t.Error("1000 votes halved seven times should rank below 20 fresh ones")
+	}
+	if Decayed(1000, week, 30*24*time.Hour) <= Decayed(20, now, 30*24*time.Hour) {
+		t.Error("with a month's half-life a week-old post should keep its lead")
+	}
+}
+
+func TestWilson(t *testing.T) {
+	if Wilson(0, 0) != 0 || Wilson(0, 5) != 0 {
+		t.Error("a comment without upvotes should score 0")
+	}
+	if Wilson(1, 0) <= Wilson(4, 3) {
+		t.Errorf("one upvote alone should beat four against three: got %v and %v", Wilson(1, 0), Wilson(4, 3))
+	}
+	if Wilson(100, 0) <= Wilson(10, 0) || Wilson(10, 0) >= 1 {
+		t.Error("more upvotes should raise the score towards 1")
+	}
+	if Wilson(10, 1) <= Wilson(30, 20) {
+		t.Error("a larger share of upvotes should win over more of them")
+	}
+}
+
+func TestControversy(t *testing.T) {
+	if Controversy(5, 0) != 0 || Controversy(0, 5) != 0 {
+		t.Error("a comment voted only one way should score 0")
+	}
+	if got := Controversy(5, 5); got != 10 {
+		t.Errorf("an even split of 10 votes: got %v, want 10", got)
+	}
+	if Controversy(5, 5) <= Controversy(9, 1) || Controversy(50, 50) <= Controversy(5, 5) {
+		t.Error("an even split, or more votes, should be more controversial")
+	}
+	if Controversy(3, 7) != Controversy(7, 3) {
+		t.Error("controversy should not depend on which side has more")
+	}
+}
@@ -0,0 +1,229 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"reddit-clone/internal/metrics"
+	"reddit-clone/internal/models"
+)
+
+var cacheRequests = metrics.NewCounter("store_cache_requests_total", "Topic and post reads the store cache answered (hit) or passed on (miss).", "model", "result")
+
+type CacheConfig struct {
+	// Size is how many results are kept; 0 turns the cache off.
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+// CachedStore keeps recent topic and post reads in memory, so the topic
+// index and topic pages do not query the database on every hit. Any write
+// empties it: writes are rare next to reads, and a vote, comment or ban
+// can change what many cached lists hold. Results are still kept for at
+// most TTL, in case another instance writes to the same database.
+type CachedStore struct {
+	Store
+	size int
+	ttl  time.Duration
+
+	// Changed, when set, is called after every write, so other replicas
+	// can be told to Invalidate theirs.
+	Changed func()
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	generation uint64
+}
+type cacheEntry struct {
+	key     string
+	value   reflect.Value
+	expires time.Time
+}
+
+func NewCachedStore(s Store, cfg CacheConfig) *CachedStore {
+	return &CachedStore{Store: s, size: cfg.Size, ttl: cfg.TTL, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+// cachedModel is the name of the model a read of dest returns, if it is
+// one the cache keeps.
+func cachedModel(dest any) (string, bool) {
+	switch dest.(type) {
+	case *models.Topic, *[]models.Topic:
+		return "topic", true
+	case *models.Post, *[]models.Post:
+		return "post", true
+	}
+	return "", false
+}
+
+// read answers dest from the cache, or through fetch and then remembers
+// the result unless the store was written to meanwhile.
+func (s *CachedStore) read(model string, key string, dest any, fetch func() error) error {
+	target := reflect.ValueOf(dest).Elem()
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok && time.Now().Before(e.Value.(*cacheEntry).expires) {
+		s.lru.MoveToFront(e)
+		target.Set(clone(e.Value.(*cacheEntry).value))
+		s.mu.Unlock()
+		cacheRequests.Inc(model, "hit")
+		return nil
+	}
+	generation := s.generation
+	s.mu.Unlock()
+	cacheRequests.Inc(model, "miss")
+	if err := fetch(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation != generation {
+		return nil
+	}
+	if e, ok := s.entries[key]; ok {
+		s.lru.Remove(e)
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{key: key, value: clone(target), expires: time.Now().Add(s.ttl)})
+	for s.lru.Len() > s.size {
+		delete(s.entries, s.lru.Remove(s.lru.Back()).(*cacheEntry).key)
+	}
+	return nil
+}
+
+// clone deep-copies a cached struct or slice, down through the pointers,
+// slices and maps in it, so handlers that fill in a viewer's votes or an
+// image's URLs do not write them into the cache.
+func clone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(clone(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(clone(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			c.SetMapIndex(iter.Key(), clone(iter.Value()))
+		}
+		return c
+	case reflect.Struct:
+		// Copy the whole struct first for the unexported fields, such as
+		// time.Time's, then replace the exported ones with copies.
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := range v.NumField() {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(clone(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
+
+// Invalidate empties the cache.
+func (s *CachedStore) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	clear(s.entries)
+	s.lru.Init()
+}
+func cacheKey(op string, model any, id any, q any) string {
+	return fmt.Sprintf("%s %T %+v %+v", op, model, reflect.Indirect(reflect.ValueOf(id)), q)
+}
+func (s *CachedStore) Get(c context.Context, dest any, id any, preloads ...string) error {
+	model, ok := cachedModel(dest)
+	if !ok {
+		return s.Store.Get(c, dest, id, preloads...)
+	}
+	return s.read(model, cacheKey("get", dest, id, preloads), dest, func() error { return s.Store.Get(c, dest, id, preloads...) })
+}
+func (s *CachedStore) Find(c context.Context, dest any, id any, scopes ...Scope) error {
+	model, ok := cachedModel(dest)
+	if !ok {
+		return s.Store.Find(c, dest, id, scopes...)
+	}
+	return s.read(model, cacheKey("find", dest, id, queryKey(scopes)), dest, func() error { return s.Store.Find(c, dest, id, scopes...) })
+}
+func (s *CachedStore) Count(c context.Context, model any, id any, scopes ...Scope) (int64, error) {
+	name, ok := cachedModel(model)
+	if !ok {
+		return s.Store.Count(c, model, id, scopes...)
+	}
+	var count int64
+	err := s.read(name, cacheKey("count", model, id, queryKey(scopes)), &count, func() (err error) {
+		count, err = s.Store.Count(c, model, id, scopes...)
+		return err
+	})
+	return count, err
+}
+
+// queryKey spells out the query scopes build, cursor included.
+func queryKey(scopes []Scope) string {
+	q := Build(scopes...)
+	after := "-"
+	if q.After != nil {
+		after = fmt.Sprintf("%+v", *q.After)
+	}
+	q.After = nil
+	return fmt.Sprintf("%+v after %s", q, after)
+}
+
+// The cache must forget whatever a write could have changed.
+func (s *CachedStore) changed() {
+	s.Invalidate()
+	if s.Changed != nil {
+		s.Changed()
+	}
+}
+func (s *CachedStore) Create(c context.Context, obj any) error {
+	defer s.changed()
+	return s.Store.Create(c, obj)
+}
+func (s *CachedStore) Update(c context.Context, model any, mask any) error {
+	defer s.changed()
+	return s.Store.Update(c, model, mask)
+}
+func (s *CachedStore) Increment(c context.Context, model any, column string, n int) error {
+	defer s.changed()
+	return s.Store.Increment(c, model, column, n)
+}
+func (s *CachedStore) UpdateColumns(c context.Context, model any, id any, values map[string]any, scopes ...Scope) error {
+	defer s.changed()
+	return s.Store.UpdateColumns(c, model, id, values, scopes...)
+}
+func (s *CachedStore) Delete(c context.Context, model any, id any, scopes ...Scope) error {
+	defer s.changed()
+	return s.Store.Delete(c, model, id, scopes...)
+}
+func (s *CachedStore) Restore(c context.Context, model any, id any) error {
+	defer s.changed()
+	return s.Store.Restore(c, model, id)
+}
+func (s *CachedStore) Transaction(c context.Context, f func(Store) error) error {
+	defer s.changed()
+	return s.Store.Transaction(c, f)
+}
+func (s *CachedStore) CastVote(c context.Context, target any, key models.Vote, direction int) (int, error) {
+	defer s.changed()
+	return s.Store.CastVote(c, target, key, direction)
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/metrics"
+	"reddit-clone/internal/models"
+)
+
+// countingStore counts the reads that reach the store under a cache.
+type countingStore struct {
+	Store
+	reads int
+}
+
+func (s *countingStore) Get(c context.Context, dest any, id any, preloads ...string) error {
+	s.reads++
+	return s.Store.Get(c, dest, id, preloads...)
+}
+func (s *countingStore) Find(c context.Context, dest any, id any, scopes ...Scope) error {
+	s.reads++
+	return s.Store.Find(c, dest, id, scopes...)
+}
+func (s *countingStore) Count(c context.Context, model any, id any, scopes ...Scope) (int64, error) {
+	s.reads++
+	return s.Store.Count(c, model, id, scopes...)
+}
+
+// TestCachedStore reads topics and posts through the cache and checks what
+// reaches the store underneath.
+func TestCachedStore(t *testing.T) {
+	c := context.Background()
+	under := &countingStore{Store: NewMemoryStore()}
+	s := NewCachedStore(under, CacheConfig{Size: 2, TTL: time.Minute})
+	seed(t, s, 3)
+	reads := func(what string, want int, read func() error) {
+		t.Helper()
+		before := under.reads
+		if err := read(); err != nil {
+			t.Fatalf("%s: %v", what, err)
+		}
+		if got := under.reads - before; got != want {
+			t.Errorf("%s: %d reads reached the store, want %d", what, got, want)
+		}
+	}
+	list := func() error {
+		_, err := List(c, s, models.Post{TopicID: "golang"}, models.PageRequest{Limit: 2}, OrderBy("votes DESC"))
+		return err
+	}
+	reads("list posts", 2, list)
+	reads("list posts again", 0, list)
+	// The count is shared with the first page, and this page pushes the
+	// first one out.
+	reads("the next page", 1, func() error {
+		_, err := List(c, s, models.Post{TopicID: "golang"}, models.PageRequest{Limit: 2, Offset: 2}, OrderBy("votes DESC"))
+		return err
+	})
+	reads("the first page after it was pushed out", 1, list)
+
+	post := func() (*models.Post, error) {
+		return Get(c, s, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"})
+	}
+	got, _ := post()
+	got.MyVote, got.Title = 1, "Changed"
+	reads("get a post again", 0, func() error {
+		got, err := post()
+		if err == nil && (got.MyVote != 0 || got.Title != "Post 1") {
+			t.Errorf("a change to a read reached the cache: %+v", got)
+		}
+		return err
+	})
+	reads("list users", 1, func() error {
+		_, err := Find(c, s, models.User{})
+		return err
+	})
+	reads("list users again", 1, func() error {
+		_, err := Find(c, s, models.User{})
+		return err
+	})
+
+	if _, err := s.CastVote(c, &models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}, models.Vote{UserID: "u1", TopicID: "golang", PostID: "p1"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	reads("get the post after a vote", 1, func() error {
+		got, err := post()
+		if err == nil && got.Votes != 2 {
+			t.Errorf("votes after the vote: got %d, want 2", got.Votes)
+		}
+		return err
+	})
+
+	short := NewCachedStore(under, CacheConfig{Size: 10, TTL: time.Millisecond})
+	get := func() error {
+		_, err := Get(c, short, models.Topic{Model: models.Model{ID: "golang"}})
+		return err
+	}
+	reads("get a topic", 1, get)
+	time.Sleep(5 * time.Millisecond)
+	reads("get the topic past its TTL", 1, get)
+
+	var scraped strings.Builder
+	metrics.Write(&scraped)
+	for _, want := range []string{`store_cache_requests_total{model="post",result="hit"}`, `store_cache_requests_total{model="topic",result="miss"}`} {
+		if !strings.Contains(scraped.String(), want) {
+			t.Errorf("the metrics lack %s", want)
+		}
+	}
+}
+
+// TestCachedStoreChanged counts the writes reported through Changed, which
+// reads do not trigger.
+func TestCachedStoreChanged(t *testing.T) {
+	c := context.Background()
+	s := NewCachedStore(NewMemoryStore(), CacheConfig{Size: 10, TTL: time.Minute})
+	var changes int
+	s.Changed = func() { changes++ }
+	seed(t, s, 1)
+	before := changes
+	if _, err := Get(c, s, models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+	if changes != before {
+		t.Errorf("a read reported %d changes", changes-before)
+	}
+	if err := s.Update(c, &models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}, map[string]any{"title": "Changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(c, &models.Post{}, &models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+	if changes != before+2 {
+		t.Errorf("two writes reported %d changes", changes-before)
+	}
+}
+
+// TestCacheReturnsCopies changes what a cached read returned, down to the
+// structs it points at, and checks the next read does not see it.
+func TestCacheReturnsCopies(t *testing.T) {
+	c := context.Background()
+	s := NewCachedStore(NewMemoryStore(), CacheConfig{Size: 10, TTL: time.Minute})
+	user, _ := seed(t, s, 1)
+	if _, err := Create(c, s, models.Media{Model: models.Model{ID: "m1"}, UploaderID: user.ID, ContentType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+	id := models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}
+	if err := s.Update(c, &id, map[string]any{"media_id": "m1"}); err != nil {
+		t.Fatal(err)
+	}
+	read := func() *models.Post {
+		t.Helper()
+		post, err := Get(c, s, id, "Author", "Media")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Author == nil || post.Media == nil {
+			t.Fatalf("author and media were not loaded: %+v", post)
+		}
+		return post
+	}
+	read()
+	post := read()
+	post.MyVote = 1
+	post.Author.Username = "mallory"
+	post.Media.URL = "/media/m1.png"
+	post = read()
+	if post.MyVote != 0 || post.Author.Username != "alice" || post.Media.URL != "" {
+		t.Errorf("a change to a read reached the cache: vote %d, author %q, media URL %q", post.MyVote, post.Author.Username, post.Media.URL)
+	}
+
+	var posts []models.Post
+	for range 2 {
+		var err error
+		if posts, err = Find(c, s, models.Post{TopicID: "golang"}, Preload("Media")); err != nil || len(posts) != 1 || posts[0].Media == nil {
+			t.Fatalf("find: got %+v, %v", posts, err)
+		}
+		posts[0].Media.URL = "/media/m1.png"
+	}
+	if posts, _ = Find(c, s, models.Post{TopicID: "golang"}, Preload("Media")); posts[0].Media.URL != "" {
+		t.Errorf("a change to a listed post reached the cache: media URL %q", posts[0].Media.URL)
+	}
+}
@@ -0,0 +1,522 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+// eachStore runs test against a MemoryStore and a GormStore on every
+// database driver, which should all behave the same.
+func eachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryStore()) })
+	eachDriver(t, func(t *testing.T, s *GormStore) { test(t, s) })
+}
+
+// seed creates a user and a topic with n posts by them, titled Post 0 to
+// Post n-1 and created in that order.
+func seed(t *testing.T, s Store, n int) (*models.User, []models.Post) {
+	t.Helper()
+	c := context.Background()
+	user, err := Create(c, s, models.User{Model: models.Model{ID: "u1"}, Username: "alice"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := Create(c, s, models.Topic{Model: models.Model{ID: "golang"}}); err != nil {
+		t.Fatalf("create topic: %v", err)
+	}
+	var posts []models.Post
+	for i := range n {
+		post, err := Create(c, s, models.Post{Model: models.Model{ID: fmt.Sprintf("p%d", i)}, TopicID: "golang", AuthorID: user.ID, Title: fmt.Sprintf("Post %d", i), Votes: i})
+		if err != nil {
+			t.Fatalf("create post: %v", err)
+		}
+		posts = append(posts, *post)
+	}
+	return user, posts
+}
+
+func TestStoreCreateGet(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		_, posts := seed(t, s, 1)
+		post, err := Get(c, s, models.Post{Model: models.Model{ID: posts[0].ID}, TopicID: "golang"}, "Author")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Title != "Post 0" || post.NormalizedTitle != "post 0" || post.Author == nil || post.Author.Username != "alice" {
+			t.Errorf("got %+v", post)
+		}
+		if post.CreatedAt.IsZero() {
+			t.Error("created_at was not set")
+		}
+		if _, err := Get(c, s, models.Post{Model: models.Model{ID: "missing"}}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("missing post: got %v, want ErrNotFound", err)
+		}
+		if _, err := Create(c, s, models.User{Model: models.Model{ID: "u2"}, Username: "alice"}); !errors.Is(err, ErrDuplicatedKey) {
+			t.Errorf("duplicate username: got %v, want ErrDuplicatedKey", err)
+		}
+	})
+}
+
+func TestStoreFind(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 5)
+		posts, err := Find(c, s, models.Post{TopicID: "golang"}, Where("votes", ">=", 2), OrderBy("votes DESC"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := titles(posts); fmt.Sprint(got) != "[Post 4 Post 3 Post 2]" {
+			t.Errorf("votes >= 2 by votes: got %v", got)
+		}
+		posts, err = Find(c, s, models.Post{}, OrderBy("votes"), Page(models.PageRequest{Limit: 2, Offset: 1}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := titles(posts); fmt.Sprint(got) != "[Post 1 Post 2]" {
+			t.Errorf("second page of two by votes: got %v", got)
+		}
+		posts, err = Find(c, s, models.Post{}, Where("id", "IN", []string{"p1", "p3", "p9"}), OrderBy("title"))
+		if err != nil || fmt.Sprint(titles(posts)) != "[Post 1 Post 3]" {
+			t.Errorf("id IN p1, p3, p9: got %v, %v", titles(posts), err)
+		}
+		if posts, err := Find(c, s, models.Post{}, Where("id", "IN", []string{})); err != nil || len(posts) != 0 {
+			t.Errorf("id IN nothing: got %v, %v", titles(posts), err)
+		}
+		for i, id := range []string{"p3", "p1"} {
+			edited := time.Now().Add(time.Duration(i) * time.Minute)
+			if err := s.Update(c, &models.Post{Model: models.Model{ID: id}, TopicID: "golang"}, map[string]any{"edited_at": &edited}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if posts, err := Find(c, s, models.Post{}, Where("edited_at", "<>", nil), OrderBy("edited_at DESC")); err != nil || fmt.Sprint(titles(posts)) != "[Post 1 Post 3]" {
+			t.Errorf("edited_at IS NOT NULL: got %v, %v", titles(posts), err)
+		}
+		if count, err := s.Count(c, &models.Post{}, &models.Post{}, Where("edited_at", "=", nil)); err != nil || count != 3 {
+			t.Errorf("count edited_at IS NULL: got %d, %v", count, err)
+		}
+		if count, err := s.Count(c, &models.Post{}, &models.Post{}, Where("edited_at", ">", time.Time{})); err != nil || count != 2 {
+			t.Errorf("count edited_at > zero, skipping NULLs: got %d, %v", count, err)
+		}
+		if _, err := Find(c, s, models.Post{}, Where("votes", "LIKE", 1)); err == nil {
+			t.Error("an unsupported operator was accepted")
+		}
+		count, err := s.Count(c, &models.Post{}, &models.Post{TopicID: "golang"}, Where("votes", "<", 3))
+		if err != nil || count != 3 {
+			t.Errorf("count votes < 3: got %d, %v", count, err)
+		}
+		for _, n := range []models.Notification{{Model: models.Model{ID: "n1"}, UserID: "u1", ActorID: "u1", Unread: true}, {Model: models.Model{ID: "n2"}, UserID: "u1", ActorID: "u1"}} {
+			if _, err := Create(c, s, n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if count, err := s.Count(c, &models.Notification{}, &models.Notification{UserID: "u1"}, Where("unread", "=", true)); err != nil || count != 1 {
+			t.Errorf("count unread = true: got %d, %v", count, err)
+		}
+		if err := s.Update(c, &models.Post{Model: models.Model{ID: "p4"}, TopicID: "golang"}, map[string]any{"shadowbanned": true}); err != nil {
+			t.Fatal(err)
+		}
+		if posts, err := Find(c, s, models.Post{}, VisibleTo("u2"), OrderBy("title")); err != nil || fmt.Sprint(titles(posts)) != "[Post 0 Post 1 Post 2 Post 3]" {
+			t.Errorf("visible to another user: got %v, %v", titles(posts), err)
+		}
+		if count, err := s.Count(c, &models.Post{}, &models.Post{}, VisibleTo("")); err != nil || count != 4 {
+			t.Errorf("count visible anonymously: got %d, %v", count, err)
+		}
+		if count, err := s.Count(c, &models.Post{}, &models.Post{}, VisibleTo("u1")); err != nil || count != 5 {
+			t.Errorf("count visible to the author: got %d, %v", count, err)
+		}
+		if counts, err := s.CountBy(c, &models.Post{}, &models.Post{TopicID: "golang"}, "author_id"); err != nil || fmt.Sprint(counts) != "map[u1:5]" {
+			t.Errorf("count by author: got %v, %v", counts, err)
+		}
+		if counts, err := s.CountBy(c, &models.Post{}, &models.Post{}, "votes", Where("votes", "<", 2), VisibleTo("")); err != nil || fmt.Sprint(counts) != "map[0:1 1:1]" {
+			t.Errorf("count by votes visible anonymously: got %v, %v", counts, err)
+		}
+		if _, err := s.CountBy(c, &models.Post{}, &models.Post{}, "nope"); err == nil {
+			t.Error("counted by an unknown column")
+		}
+		if _, err := Create(c, s, models.HiddenPost{UserID: "u1", TopicID: "golang", PostID: "p0"}); err != nil {
+			t.Fatal(err)
+		}
+		if posts, err := Find(c, s, models.Post{}, NotHiddenBy("u1"), OrderBy("title")); err != nil || fmt.Sprint(titles(posts)) != "[Post 1 Post 2 Post 3 Post 4]" {
+			t.Errorf("posts u1 has not hidden: got %v, %v", titles(posts), err)
+		}
+		if count, err := s.Count(c, &models.Post{}, &models.Post{}, NotHiddenBy("u2")); err != nil || count != 5 {
+			t.Errorf("count posts u2 has not hidden: got %d, %v", count, err)
+		}
+		if _, err := Create(c, s, models.Block{UserID: "u2", BlockedID: "u1"}); err != nil {
+			t.Fatal(err)
+		}
+		if count, err := s.Count(c, &models.Post{}, &models.Post{}, VisibleTo("u2")); err != nil || count != 0 {
+			t.Errorf("count visible to a user who blocked the author: got %d, %v", count, err)
+		}
+	})
+}
+
+func TestStoreSelect(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 2)
+		if err := s.Update(c, &models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}, map[string]any{"content": "body"}); err != nil {
+			t.Fatal(err)
+		}
+		posts, err := Find(c, s, models.Post{TopicID: "golang"}, Select("id", "topic_id", "title", "author_id"), Preload("Author"), OrderBy("title"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 2 || posts[1].Title != "Post 1" || posts[1].Content != "" || posts[1].Votes != 0 || posts[1].Author == nil || posts[1].Author.Username != "alice" {
+			t.Errorf("selected columns: got %+v", posts)
+		}
+		if post, err := Get(c, s, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}); err != nil || post.Content != "body" {
+			t.Errorf("a read without Select: got %+v, %v", post, err)
+		}
+		if _, err := Find(c, s, models.Post{}, Select("nope")); err == nil {
+			t.Error("selected an unknown column")
+		}
+	})
+}
+
+func TestStoreList(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 5)
+		var got []string
+		page := models.PageRequest{Limit: 2}
+		for range 5 {
+			list, err := List(c, s, models.Post{TopicID: "golang"}, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, titles(list.Items)...)
+			if !list.Pagination.HasNext() {
+				break
+			}
+			page.Offset += page.Limit
+		}
+		if fmt.Sprint(got) != "[Post 0 Post 1 Post 2 Post 3 Post 4]" {
+			t.Errorf("paging in creation order: got %v", got)
+		}
+	})
+}
+
+// TestStorePageToken pages through posts by page token: newest first by
+// seeking, so a post created mid-way is neither repeated nor skipped, and by
+// votes through offsets.
+func TestStorePageToken(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		user, _ := seed(t, s, 5)
+		pages := func(order Scope, between func()) []string {
+			t.Helper()
+			var got []string
+			page := models.PageRequest{Limit: 2}
+			for range 5 {
+				list, err := List(c, s, models.Post{TopicID: "golang"}, page, order)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, titles(list.Items)...)
+				if list.NextPageToken == "" {
+					break
+				}
+				page.PageToken = list.NextPageToken
+				if between != nil {
+					between()
+					between = nil
+				}
+			}
+			return got
+		}
+		got := pages(OrderBy("created_at DESC"), func() {
+			if _, err := Create(c, s, models.Post{Model: models.Model{ID: "p5"}, TopicID: "golang", AuthorID: user.ID, Title: "Post 5"}); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if fmt.Sprint(got) != "[Post 4 Post 3 Post 2 Post 1 Post 0]" {
+			t.Errorf("newest first with a post created after the first page: got %v", got)
+		}
+		if got := pages(OrderBy("votes DESC"), nil); fmt.Sprint(got) != "[Post 4 Post 3 Post 2 Post 1 Post 0 Post 5]" {
+			t.Errorf("by votes: got %v", got)
+		}
+
+		seek, err := List(c, s, models.Post{TopicID: "golang"}, models.PageRequest{Limit: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range []struct {
+			what, token string
+			order       Scope
+		}{
+			{"a malformed token", "not a token", OrderBy("created_at")},
+			{"a seek token on a list by votes", seek.NextPageToken, OrderBy("votes DESC")},
+		} {
+			if _, err := List(c, s, models.Post{TopicID: "golang"}, models.PageRequest{PageToken: tc.token}, tc.order); !errors.Is(err, ErrInvalidPageToken) {
+				t.Errorf("%s: got %v", tc.what, err)
+			}
+		}
+	})
+}
+
+func TestStoreUpdate(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 2)
+		id := models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}
+		if _, err := Update(c, s, id, models.Post{Content: "edited"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Update(c, &id, map[string]any{"votes": 3}); err != nil {
+			t.Fatal(err)
+		}
+		post, err := Get(c, s, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Content != "edited" || post.Votes != 3 || post.Title != "Post 0" {
+			t.Errorf("updated post: got %+v", post)
+		}
+		other, err := Get(c, s, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other.Content != "" || other.Votes != 1 {
+			t.Errorf("update leaked to another post: %+v", other)
+		}
+	})
+}
+
+// TestStoreCountByDay groups posts by the UTC day they were created,
+// whatever zone the time was written in.
+func TestStoreCountByDay(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 0)
+		east := time.FixedZone("UTC+2", 2*60*60)
+		for i, created := range []time.Time{
+			time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 6, 1, 23, 59, 0, 0, time.UTC),
+			// 23:00 UTC on May 31st.
+			time.Date(2024, 6, 1, 1, 0, 0, 0, east),
+			time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC),
+		} {
+			post := models.Post{Model: models.Model{ID: fmt.Sprintf("p%d", i), CreatedAt: created}, TopicID: "golang", AuthorID: "u1", Title: "Dated"}
+			if _, err := Create(c, s, post); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts, err := s.CountByDay(c, &models.Post{}, nil, "created_at")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]int64{"2024-05-31": 1, "2024-06-01": 2, "2024-06-03": 1}; fmt.Sprint(counts) != fmt.Sprint(want) {
+			t.Errorf("posts by day: got %v, want %v", counts, want)
+		}
+		counts, err = s.CountByDay(c, &models.Post{}, nil, "created_at", Where("created_at", ">=", time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)))
+		if err != nil || fmt.Sprint(counts) != "map[2024-06-03:1]" {
+			t.Errorf("posts by day since June 2nd: got %v, %v", counts, err)
+		}
+	})
+}
+
+// TestStoreIncrement adds to a column in place, on the matching row only
+// and without touching updated_at.
+func TestStoreIncrement(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 2)
+		before, err := Get(c, s, models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int{3, 4} {
+			if err := s.Increment(c, &models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}, "views", n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		post, err := Get(c, s, models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Views != 7 || !post.UpdatedAt.Equal(before.UpdatedAt) {
+			t.Errorf("incremented post: got %d views, updated %v, want 7 and %v", post.Views, post.UpdatedAt, before.UpdatedAt)
+		}
+		if other, err := Get(c, s, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}); err != nil || other.Views != 0 {
+			t.Errorf("increment leaked to another post: %+v, %v", other, err)
+		}
+		if err := s.Increment(c, &models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}, "bogus", 1); err == nil {
+			t.Error("incremented an unknown column")
+		}
+	})
+}
+
+// TestStoreUpdateColumns sets a column on every matching row, deleted ones
+// only when unscoped, without touching updated_at.
+func TestStoreUpdateColumns(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 3)
+		before, err := Get(c, s, models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete(c, &models.Post{}, &models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpdateColumns(c, &models.Post{}, &models.Post{TopicID: "golang"}, map[string]any{"content": "bulk"}, Where("votes", "<", 2)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UpdateColumns(c, &models.Post{}, &models.Post{TopicID: "golang"}, map[string]any{"title": "Gone"}, Unscoped(), Deleted()); err != nil {
+			t.Fatal(err)
+		}
+		var posts []models.Post
+		if err := s.Find(c, &posts, &models.Post{TopicID: "golang"}, Unscoped(), OrderBy("id")); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, post := range posts {
+			got = append(got, post.ID+":"+post.Title+":"+post.Content)
+		}
+		if want := "[p0:Post 0:bulk p1:Post 1:bulk p2:Gone:]"; fmt.Sprint(got) != want {
+			t.Errorf("posts after the updates: got %v, want %s", got, want)
+		}
+		if !posts[0].UpdatedAt.Equal(before.UpdatedAt) {
+			t.Errorf("updated_at moved from %v to %v", before.UpdatedAt, posts[0].UpdatedAt)
+		}
+		if err := s.UpdateColumns(c, &models.Post{}, &models.Post{TopicID: "golang"}, map[string]any{"bogus": 1}); err == nil {
+			t.Error("updated an unknown column")
+		}
+	})
+}
+
+func TestStoreDelete(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		seed(t, s, 2)
+		id := models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}
+		if err := s.Delete(c, &models.Post{}, &id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Get(c, s, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleted post: got %v, want ErrNotFound", err)
+		}
+		if posts, err := Find(c, s, models.Post{TopicID: "golang"}); err != nil || fmt.Sprint(titles(posts)) != "[Post 1]" {
+			t.Errorf("posts left: got %v, %v", titles(posts), err)
+		}
+		if _, err := Create(c, s, models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang", Title: "Again"}); !errors.Is(err, ErrDuplicatedKey) {
+			t.Errorf("reusing a soft-deleted key: got %v, want ErrDuplicatedKey", err)
+		}
+		if posts, err := Find(c, s, models.Post{TopicID: "golang"}, Unscoped(), OrderBy("title")); err != nil || fmt.Sprint(titles(posts)) != "[Post 0 Post 1]" {
+			t.Errorf("unscoped posts: got %v, %v", titles(posts), err)
+		}
+		if n, err := s.Count(c, &models.Post{}, &models.Post{TopicID: "golang"}, Unscoped()); err != nil || n != 2 {
+			t.Errorf("unscoped count: got %d, %v", n, err)
+		}
+		if posts, err := Find(c, s, models.Post{TopicID: "golang"}, Deleted()); err != nil || fmt.Sprint(titles(posts)) != "[Post 0]" {
+			t.Errorf("deleted posts: got %v, %v", titles(posts), err)
+		}
+		if n, err := s.Count(c, &models.Post{}, &models.Post{TopicID: "golang"}, Deleted()); err != nil || n != 1 {
+			t.Errorf("deleted count: got %d, %v", n, err)
+		}
+		post, err := Restore(c, s, id)
+		if err != nil || post.Title != "Post 0" || post.DeletedAt.Valid {
+			t.Fatalf("restore: got %+v, %v", post, err)
+		}
+		if posts, err := Find(c, s, models.Post{TopicID: "golang"}); err != nil || len(posts) != 2 {
+			t.Errorf("posts after the restore: got %v, %v", titles(posts), err)
+		}
+		if err := s.Delete(c, &models.Post{}, &models.Post{TopicID: "golang"}, Where("votes", ">=", 1)); err != nil {
+			t.Fatal(err)
+		}
+		if posts, err := Find(c, s, models.Post{TopicID: "golang"}); err != nil || fmt.Sprint(titles(posts)) != "[Post 0]" {
+			t.Errorf("posts left after deleting votes >= 1: got %v, %v", titles(posts), err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if err := s.Delete(c, &models.Post{}, &id); err != nil {
+			t.Fatal(err)
+		}
+		if posts, err := Find(c, s, models.Post{TopicID: "golang"}, Deleted(), OrderBy("deleted_at DESC")); err != nil || fmt.Sprint(titles(posts)) != "[Post 0 Post 1]" {
+			t.Errorf("deleted posts, most recent first: got %v, %v", titles(posts), err)
+		}
+		if err := s.Delete(c, &models.Post{}, &models.Post{TopicID: "golang"}, Deleted(), Where("votes", "<", 1)); err != nil {
+			t.Fatal(err)
+		}
+		if posts, err := Find(c, s, models.Post{TopicID: "golang"}, Unscoped()); err != nil || fmt.Sprint(titles(posts)) != "[Post 1]" {
+			t.Errorf("posts left after removing deleted posts with no votes for good: got %v, %v", titles(posts), err)
+		}
+		if err := s.Delete(c, &models.Post{}, &models.Post{TopicID: "golang"}, Unscoped()); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.Count(c, &models.Post{}, &models.Post{}, Unscoped()); err != nil || n != 0 {
+			t.Errorf("posts left after an unscoped delete: got %d, %v", n, err)
+		}
+	})
+}
+
+func TestStoreTransaction(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		user, _ := seed(t, s, 2)
+		p0 := models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}
+		p1 := models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}
+		failed := errors.New("failed")
+		err := s.Transaction(c, func(tx Store) error {
+			if _, err := Create(c, tx, models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: user.ID, Title: "Rolled back"}); err != nil {
+				return err
+			}
+			if _, err := tx.CastVote(c, &p0, models.Vote{UserID: user.ID, TopicID: "golang", PostID: "p0"}, 1); err != nil {
+				return err
+			}
+			if err := tx.Update(c, &p0, map[string]any{"votes": 10}); err != nil {
+				return err
+			}
+			if err := tx.Increment(c, &p0, "views", 3); err != nil {
+				return err
+			}
+			if err := tx.UpdateColumns(c, &models.Post{}, &p0, map[string]any{"content": "rolled back"}); err != nil {
+				return err
+			}
+			if err := tx.Delete(c, &models.Post{}, &p0); err != nil {
+				return err
+			}
+			if err := tx.Delete(c, &models.Post{}, &p1, Unscoped()); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("got %v, want the error f returned", err)
+		}
+		posts, err := Find(c, s, models.Post{TopicID: "golang"}, OrderBy("id"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 2 || posts[0].Votes != 0 || posts[0].Ups != 0 || posts[0].Views != 0 || posts[0].Content != "" || posts[1].ID != "p1" {
+			t.Errorf("after rollback: got %+v", posts)
+		}
+		if n, err := s.Count(c, &models.Vote{}, &models.Vote{}); err != nil || n != 0 {
+			t.Errorf("votes after rollback: got %d, %v", n, err)
+		}
+		err = s.Transaction(c, func(tx Store) error {
+			_, err := Create(c, tx, models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang", AuthorID: user.ID, Title: "Committed"})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Get(c, s, models.Post{Model: models.Model{ID: "p2"}, TopicID: "golang"}); err != nil {
+			t.Errorf("after commit: %v", err)
+		}
+	})
+}
+
+func titles(posts []models.Post) []string {
+	titles := make([]string, len(posts))
+	for i, post := range posts {
+		titles[i] = post.Title
+	}
+	return titles
+}
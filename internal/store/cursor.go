@@ -0,0 +1,99 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"reddit-clone/internal/models"
+)
+
+var ErrInvalidPageToken = errors.New("pageToken must be the nextPageToken of an earlier page")
+
+// Cursor is where the next page of a list starts, handed to clients as an
+// opaque page token. Lists in creation order continue after the CreatedAt
+// and ID of the last row, which stays fast on large tables and neither
+// skips nor repeats rows as new ones arrive. Lists in other orders, like
+// hot, continue from an offset.
+type Cursor struct {
+	CreatedAt *time.Time `json:"c,omitempty"`
+	ID        string     `json:"i,omitempty"`
+	Offset    int        `json:"o,omitempty"`
+}
+
+func (c Cursor) Token() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+func ParseCursor(token string) (Cursor, error) {
+	var cursor Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(data, &cursor) != nil || cursor.Offset < 0 || (cursor.ID != "") != (cursor.CreatedAt != nil) {
+		return Cursor{}, ErrInvalidPageToken
+	}
+	return cursor, nil
+}
+
+// After keeps the rows that come after the cursor in creation order, or
+// before it when desc is set.
+func After(cursor Cursor, desc bool) Scope {
+	return func(q *Query) { q.After, q.AfterDesc = &cursor, desc }
+}
+
+// keyset reports whether a list of T in the given order can page by
+// CreatedAt and ID, and whether newest comes first.
+func keyset[T any](orders []string) (ok bool, desc bool) {
+	t := reflect.TypeFor[T]()
+	if _, ok := t.FieldByName("ID"); !ok {
+		return false, false
+	}
+	if _, ok := t.FieldByName("CreatedAt"); !ok {
+		return false, false
+	}
+	switch {
+	case len(orders) == 0:
+		return true, false
+	case len(orders) > 1:
+		return false, false
+	}
+	column, direction, _ := strings.Cut(orders[0], " ")
+	direction = strings.ToUpper(strings.TrimSpace(direction))
+	return column == "created_at" && (direction == "" || direction == "ASC" || direction == "DESC"), direction == "DESC"
+}
+
+// seekPage pages through a list ordered by CreatedAt and ID, fetching a row
+// more than asked for to tell whether there is a next page.
+func seekPage(c Cursor, page models.PageRequest, desc bool) []Scope {
+	direction := ""
+	if desc {
+		direction = " DESC"
+	}
+	scopes := []Scope{OrderBy("created_at"+direction, "id"+direction)}
+	if c.ID == "" {
+		return append(scopes, Page(models.PageRequest{Limit: page.Limit + 1, Offset: page.Offset}))
+	}
+	return append(scopes, After(c, desc), Page(models.PageRequest{Limit: page.Limit + 1}))
+}
+
+// offsetPage moves page to the offset its token holds, for lists that
+// cannot seek.
+func offsetPage(page models.PageRequest) (models.PageRequest, error) {
+	if page.PageToken == "" {
+		return page, nil
+	}
+	cursor, err := ParseCursor(page.PageToken)
+	if err != nil {
+		return page, err
+	}
+	page.Offset = cursor.Offset
+	return page, nil
+}
+func offsetToken(p models.Pagination) string {
+	if !p.HasNext() {
+		return ""
+	}
+	return Cursor{Offset: p.Offset + p.Limit}.Token()
+}
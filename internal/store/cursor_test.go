@@ -0,0 +1,22 @@
+package store
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestParseCursor(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, cursor := range []Cursor{{Offset: 20}, {CreatedAt: &created, ID: "p1"}} {
+		got, err := ParseCursor(cursor.Token())
+		if err != nil || got.Offset != cursor.Offset || got.ID != cursor.ID || (got.CreatedAt == nil) != (cursor.CreatedAt == nil) || got.CreatedAt != nil && !got.CreatedAt.Equal(created) {
+			t.Errorf("round trip of %+v: got %+v, %v", cursor, got, err)
+		}
+	}
+	for _, token := range []string{"not base64!", base64.RawURLEncoding.EncodeToString([]byte("o:2")), base64.RawURLEncoding.EncodeToString([]byte(`{"o":-1}`)), base64.RawURLEncoding.EncodeToString([]byte(`{"i":"p1"}`))} {
+		if _, err := ParseCursor(token); err != ErrInvalidPageToken {
+			t.Errorf("ParseCursor(%q): got %v", token, err)
+		}
+	}
+}
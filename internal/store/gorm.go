@@ -0,0 +1,380 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	otelgorm "gorm.io/plugin/opentelemetry/tracing"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/metrics"
+	"reddit-clone/internal/models"
+)
+
+var Drivers = map[string]func(dsn string) gorm.Dialector{
+	"sqlite":   sqlite.Open,
+	"postgres": postgres.Open,
+	"mysql":    mysql.Open,
+}
+
+var operators = map[string]bool{"=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true, "IN": true}
+
+type GormStore struct {
+	DB     *gorm.DB
+	search *bool
+}
+
+// Options tune the connections Open makes.
+type Options struct {
+	SQLite SQLiteConfig `yaml:"sqlite"`
+	Pool   PoolConfig   `yaml:"pool"`
+}
+
+// SQLiteConfig is set on every SQLite connection. WAL lets readers carry on
+// while a write is in progress, and transactions take the write lock as
+// they begin, so concurrent votes queue for up to BusyTimeout instead of
+// failing with "database is locked" when two try to upgrade at once.
+type SQLiteConfig struct {
+	JournalMode string        `yaml:"journalMode"`
+	BusyTimeout time.Duration `yaml:"busyTimeout"`
+	ForeignKeys bool          `yaml:"foreignKeys"`
+}
+
+// PoolConfig limits the connections kept to the database. Zero leaves the
+// database/sql default.
+type PoolConfig struct {
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+}
+
+func Open(driver, dsn string, opts Options) (*GormStore, error) {
+	open, ok := Drivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	if driver == "sqlite" {
+		dsn = SQLiteDSN(dsn, opts.SQLite)
+	}
+	// Queries are logged by instrumentQueries instead, tagged with their
+	// request, and failures by the handlers that see them.
+	db, err := gorm.Open(open(dsn), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Pool.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(opts.Pool.MaxOpenConns)
+	}
+	if opts.Pool.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(opts.Pool.MaxIdleConns)
+	}
+	if opts.Pool.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(opts.Pool.ConnMaxLifetime)
+	}
+	s := &GormStore{DB: db, search: new(bool)}
+	if err := db.Callback().Create().After("gorm:create").Register("search:index", s.index); err != nil {
+		return nil, err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("search:index", s.index); err != nil {
+		return nil, err
+	}
+	return s, instrumentQueries(db)
+}
+
+// SQLiteDSN adds cfg to dsn as connection parameters, which the driver
+// applies to every connection in the pool rather than just the one a
+// PRAGMA would run on. Parameters dsn already sets are left alone.
+func SQLiteDSN(dsn string, cfg SQLiteConfig) string {
+	path, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return dsn
+	}
+	set := func(key, value string) {
+		if value != "" && !params.Has(key) {
+			params.Set(key, value)
+		}
+	}
+	set("_journal_mode", cfg.JournalMode)
+	if cfg.BusyTimeout > 0 {
+		set("_busy_timeout", strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10))
+	}
+	if cfg.ForeignKeys {
+		set("_foreign_keys", "1")
+	}
+	set("_txlock", "immediate")
+	return path + "?" + params.Encode()
+}
+
+// SlowQuery is how long a query may take before it is logged, with the
+// request it ran for. Zero turns the log off.
+var SlowQuery = 200 * time.Millisecond
+
+var queryDuration = metrics.NewHistogram("db_query_duration_seconds", "Time spent on database queries, by operation.", "operation")
+
+// instrumentQueries has every query gorm runs observed by queryDuration,
+// logged when slow and, within a traced request, recorded as a span of its
+// own by the OpenTelemetry plugin. Preloads run as separate queries and get
+// separate spans.
+func instrumentQueries(db *gorm.DB) error {
+	if err := db.Use(otelgorm.NewPlugin(otelgorm.WithoutMetrics(), otelgorm.WithoutQueryVariables())); err != nil {
+		return err
+	}
+	type hook interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+	cb := db.Callback()
+	for operation, hooks := range map[string][2]hook{
+		"create": {cb.Create().Before("gorm:create"), cb.Create().After("gorm:create")},
+		"query":  {cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")},
+		"update": {cb.Update().Before("gorm:update"), cb.Update().After("gorm:update")},
+		"delete": {cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete")},
+		"row":    {cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")},
+		"raw":    {cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")},
+	} {
+		err := hooks[0].Register("instrument:start", func(tx *gorm.DB) {
+			tx.InstanceSet("instrument:start", time.Now())
+		})
+		if err != nil {
+			return err
+		}
+		err = hooks[1].Register("instrument:end", func(tx *gorm.DB) {
+			if started, ok := tx.InstanceGet("instrument:start"); ok {
+				elapsed := time.Since(started.(time.Time))
+				queryDuration.Observe(elapsed.Seconds(), operation)
+				if SlowQuery > 0 && elapsed >= SlowQuery {
+					logging.FromContext(tx.Statement.Context).Warn("slow query", "operation", operation, "table", tx.Statement.Table, "sql", tx.Statement.SQL.String(), "duration", elapsed)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *GormStore) Ping(c context.Context) error {
+	db, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(c)
+}
+func (s *GormStore) Close() error {
+	db, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+func (s *GormStore) with(tx *gorm.DB) *GormStore {
+	return &GormStore{DB: tx, search: s.search}
+}
+func (s *GormStore) query(c context.Context, model any, id any, scopes ...Scope) (*gorm.DB, error) {
+	q := Build(scopes...)
+	db := s.DB.WithContext(c).Model(model)
+	if q.Unscoped {
+		db = db.Unscoped()
+	}
+	if q.Deleted {
+		db = db.Where("deleted_at IS NOT NULL")
+	}
+	if id != nil {
+		db = db.Where(id)
+	}
+	if q.Visible {
+		db = db.Where("shadowbanned = ? OR author_id = ?", false, q.Viewer).
+			Where("author_id NOT IN (SELECT blocked_id FROM blocks WHERE user_id = ?)", q.Viewer)
+	}
+	if q.HiddenBy != "" {
+		db = db.Where("id NOT IN (SELECT post_id FROM hidden_posts WHERE user_id = ?)", q.HiddenBy)
+	}
+	for _, preload := range q.Preloads {
+		db = db.Preload(preload)
+	}
+	if len(q.Columns) > 0 {
+		db = db.Select(q.Columns)
+	}
+	for _, cond := range q.Conds {
+		switch {
+		case !operators[cond.Op]:
+			return nil, fmt.Errorf("unsupported operator %q", cond.Op)
+		case cond.Value == nil && cond.Op == "=":
+			db = db.Where(cond.Column + " IS NULL")
+		case cond.Value == nil && cond.Op == "<>":
+			db = db.Where(cond.Column + " IS NOT NULL")
+		default:
+			db = db.Where(cond.Column+" "+cond.Op+" ?", cond.Value)
+		}
+	}
+	if q.After != nil {
+		op := ">"
+		if q.AfterDesc {
+			op = "<"
+		}
+		db = db.Where("(created_at "+op+" ? OR (created_at = ? AND id "+op+" ?))", *q.After.CreatedAt, *q.After.CreatedAt, q.After.ID)
+	}
+	for _, order := range q.Orders {
+		db = db.Order(order)
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	if q.Offset > 0 {
+		db = db.Offset(q.Offset)
+	}
+	return db, nil
+}
+func (s *GormStore) Get(c context.Context, dest any, id any, preloads ...string) error {
+	db, err := s.query(c, dest, id, Preload(preloads...))
+	if err != nil {
+		return err
+	}
+	return db.First(dest).Error
+}
+func (s *GormStore) Find(c context.Context, dest any, id any, scopes ...Scope) error {
+	db, err := s.query(c, nil, id, scopes...)
+	if err != nil {
+		return err
+	}
+	return db.Find(dest).Error
+}
+func (s *GormStore) Count(c context.Context, model any, id any, scopes ...Scope) (int64, error) {
+	var count int64
+	db, err := s.query(c, model, id, scopes...)
+	if err != nil {
+		return 0, err
+	}
+	return count, db.Count(&count).Error
+}
+func (s *GormStore) CountBy(c context.Context, model any, id any, column string, scopes ...Scope) (map[string]int64, error) {
+	return s.countBy(c, model, id, column, scopes...)
+}
+func (s *GormStore) CountByDay(c context.Context, model any, id any, column string, scopes ...Scope) (map[string]int64, error) {
+	day := "strftime('%Y-%m-%d', " + column + ")"
+	switch s.DB.Dialector.Name() {
+	case "postgres":
+		day = "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	case "mysql":
+		day = "DATE_FORMAT(" + column + ", '%Y-%m-%d')"
+	}
+	return s.countBy(c, model, id, day, scopes...)
+}
+
+// countBy counts the matching rows grouped by the value of the expression.
+func (s *GormStore) countBy(c context.Context, model any, id any, expr string, scopes ...Scope) (map[string]int64, error) {
+	db, err := s.query(c, model, id, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		GroupKey string
+		Count    int64
+	}
+	if err := db.Select(expr + " AS group_key, COUNT(*) AS count").Group(expr).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.GroupKey] = row.Count
+	}
+	return counts, nil
+}
+func (s *GormStore) Create(c context.Context, obj any) error {
+	return s.DB.WithContext(c).Create(obj).Error
+}
+func (s *GormStore) Update(c context.Context, model any, mask any) error {
+	return s.DB.WithContext(c).Model(model).Updates(mask).Error
+}
+func (s *GormStore) Increment(c context.Context, model any, column string, n int) error {
+	return s.DB.WithContext(c).Model(reflect.New(reflect.TypeOf(model).Elem()).Interface()).Where(model).UpdateColumn(column, gorm.Expr(column+" + ?", n)).Error
+}
+func (s *GormStore) UpdateColumns(c context.Context, model any, id any, values map[string]any, scopes ...Scope) error {
+	db, err := s.query(c, model, id, scopes...)
+	if err != nil {
+		return err
+	}
+	return db.UpdateColumns(values).Error
+}
+func (s *GormStore) Delete(c context.Context, model any, id any, scopes ...Scope) error {
+	db, err := s.query(c, model, id, scopes...)
+	if err != nil {
+		return err
+	}
+	return db.Delete(model).Error
+}
+func (s *GormStore) Restore(c context.Context, model any, id any) error {
+	return s.DB.WithContext(c).Unscoped().Model(model).Where(id).Update("deleted_at", nil).Error
+}
+func (s *GormStore) Transaction(c context.Context, f func(Store) error) error {
+	return s.DB.WithContext(c).Transaction(func(tx *gorm.DB) error { return f(s.with(tx)) })
+}
+func (s *GormStore) CastVote(c context.Context, target any, key models.Vote, direction int) (int, error) {
+	value := direction
+	model := reflect.New(reflect.TypeOf(target).Elem()).Interface()
+	err := s.DB.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// Touch the target row first so concurrent votes on it queue up
+		// behind this transaction instead of reading the same prior vote.
+		if err := tx.Model(model).Where(target).Update("votes", gorm.Expr("votes")).Error; err != nil {
+			return err
+		}
+		var existing models.Vote
+		match := tx.Where("user_id = ? AND topic_id = ? AND post_id = ? AND comment_id = ?", key.UserID, key.TopicID, key.PostID, key.CommentID)
+		if err := match.Session(&gorm.Session{}).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+		if existing.Value == direction {
+			value = 0
+		}
+		key.Value = value
+		var err error
+		if value == 0 {
+			err = match.Session(&gorm.Session{}).Delete(&models.Vote{}).Error
+		} else {
+			err = tx.Clauses(clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"})}).Create(&key).Error
+		}
+		if err != nil {
+			return err
+		}
+		ups, downs := boolInt(value == 1)-boolInt(existing.Value == 1), boolInt(value == -1)-boolInt(existing.Value == -1)
+		err = tx.Model(model).Where(target).Updates(map[string]any{
+			"votes": gorm.Expr("votes + ?", value-existing.Value),
+			"ups":   gorm.Expr("ups + ?", ups),
+			"downs": gorm.Expr("downs + ?", downs),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if scored, ok := model.(models.Scored); ok {
+			if err := tx.Model(model).Where(target).Take(scored).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(model).Where(target).UpdateColumns(scored.Scores()).Error; err != nil {
+				return err
+			}
+		}
+		var authors []string
+		if err := tx.Model(model).Where(target).Limit(1).Pluck("author_id", &authors).Error; err != nil || len(authors) == 0 {
+			return err
+		}
+		column := KarmaColumn(key)
+		return tx.Model(&models.User{}).Where("id = ?", authors[0]).Update(column, gorm.Expr(column+" + ?", value-existing.Value)).Error
+	})
+	return value, err
+}
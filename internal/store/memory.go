@@ -0,0 +1,778 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"reddit-clone/internal/models"
+)
+
+// MemoryStore keeps every model in process memory. It interprets lookups,
+// scopes, soft deletes and unique keys the way the gorm store does, so
+// handlers behave the same against it without a database.
+type MemoryStore struct {
+	*memory
+	// undo, inside a transaction, collects how to take back each of its
+	// writes, latest last.
+	undo *[]func()
+}
+type memory struct {
+	mu      sync.Mutex
+	tables  map[reflect.Type][]reflect.Value
+	schemas sync.Map
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{memory: &memory{tables: map[reflect.Type][]reflect.Value{}}}
+}
+
+// logUndo records how to take back a write made inside a transaction.
+func (s *MemoryStore) logUndo(f func()) {
+	if s.undo != nil {
+		*s.undo = append(*s.undo, f)
+	}
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+func (s *MemoryStore) Ping(c context.Context) error     { return nil }
+func (s *MemoryStore) Migrated(c context.Context) error { return nil }
+
+// set writes value to the field of a stored row, recording what it held
+// before when inside a transaction.
+func (s *MemoryStore) set(field *schema.Field, row reflect.Value, value any) error {
+	if s.undo != nil {
+		saved, _ := field.ValueOf(context.Background(), row.Elem())
+		s.logUndo(func() { field.Set(context.Background(), row.Elem(), saved) })
+	}
+	return field.Set(context.Background(), row.Elem(), value)
+}
+
+func (s *MemoryStore) schema(t reflect.Type) (*schema.Schema, error) {
+	return schema.Parse(reflect.New(t).Interface(), &s.schemas, schema.NamingStrategy{})
+}
+
+// structType returns the model type behind a *T, *[]T or T.
+func structType(v any) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+func deleted(sch *schema.Schema, row reflect.Value) bool {
+	field := sch.LookUpField("deleted_at")
+	if field == nil {
+		return false
+	}
+	_, zero := field.ValueOf(context.Background(), row)
+	return !zero
+}
+func (s *MemoryStore) hidden(sch *schema.Schema, row reflect.Value, viewerID string) bool {
+	banned, author := sch.LookUpField("shadowbanned"), sch.LookUpField("author_id")
+	if banned == nil || author == nil {
+		return false
+	}
+	value, _ := banned.ValueOf(context.Background(), row)
+	authorID, _ := author.ValueOf(context.Background(), row)
+	if value == true && authorID != viewerID {
+		return true
+	}
+	for _, block := range s.tables[reflect.TypeFor[models.Block]()] {
+		if b := block.Interface().(*models.Block); b.UserID == viewerID && b.BlockedID == authorID {
+			return true
+		}
+	}
+	return false
+}
+func (s *MemoryStore) hiddenBy(row reflect.Value, userID string) bool {
+	post, ok := row.Addr().Interface().(*models.Post)
+	if !ok {
+		return false
+	}
+	for _, hidden := range s.tables[reflect.TypeFor[models.HiddenPost]()] {
+		if h := hidden.Interface().(*models.HiddenPost); h.UserID == userID && h.TopicID == post.TopicID && h.PostID == post.ID {
+			return true
+		}
+	}
+	return false
+}
+func (s *MemoryStore) match(sch *schema.Schema, row reflect.Value, id any, conds []Cond) (bool, error) {
+	if want := reflect.Indirect(reflect.ValueOf(id)); want.IsValid() {
+		for _, field := range sch.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			value, zero := field.ValueOf(context.Background(), want)
+			if zero {
+				continue
+			}
+			got, _ := field.ValueOf(context.Background(), row)
+			if !reflect.DeepEqual(got, value) {
+				return false, nil
+			}
+		}
+	}
+	for _, cond := range conds {
+		field := sch.LookUpField(cond.Column)
+		if field == nil {
+			return false, fmt.Errorf("unknown column %q", cond.Column)
+		}
+		got, _ := field.ValueOf(context.Background(), row)
+		if cond.Value == nil && (cond.Op == "=" || cond.Op == "<>") {
+			if null(got) != (cond.Op == "=") {
+				return false, nil
+			}
+			continue
+		} else if null(got) {
+			// NULL compares to nothing, as in SQL.
+			return false, nil
+		}
+		if cond.Op == "IN" {
+			if !in(got, cond.Value) {
+				return false, nil
+			}
+			continue
+		}
+		c, err := compare(got, cond.Value)
+		if err != nil {
+			return false, err
+		}
+		ok := map[string]bool{"=": c == 0, "<>": c != 0, "<": c < 0, "<=": c <= 0, ">": c > 0, ">=": c >= 0}
+		result, known := ok[cond.Op]
+		if !known {
+			return false, fmt.Errorf("unsupported operator %q", cond.Op)
+		}
+		if !result {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+func (s *MemoryStore) after(sch *schema.Schema, row reflect.Value, cursor Cursor, desc bool) bool {
+	created, _ := sch.LookUpField("created_at").ValueOf(context.Background(), row)
+	id, _ := sch.LookUpField("id").ValueOf(context.Background(), row)
+	c := cmp.Or(created.(time.Time).Compare(*cursor.CreatedAt), strings.Compare(id.(string), cursor.ID))
+	return desc && c < 0 || !desc && c > 0
+}
+func null(value any) bool {
+	v := reflect.ValueOf(value)
+	return !v.IsValid() || v.Kind() == reflect.Pointer && v.IsNil()
+}
+func compare(a, b any) (int, error) {
+	if v := reflect.ValueOf(a); v.Kind() == reflect.Pointer && !v.IsNil() {
+		a = v.Elem().Interface()
+	}
+	if v := reflect.ValueOf(b); v.Kind() == reflect.Pointer && !v.IsNil() {
+		b = v.Elem().Interface()
+	}
+	if d, ok := a.(gorm.DeletedAt); ok {
+		a = d.Time
+	}
+	if d, ok := b.(gorm.DeletedAt); ok {
+		b = d.Time
+	}
+	if t, ok := a.(time.Time); ok {
+		if u, ok := b.(time.Time); ok {
+			return t.Compare(u), nil
+		}
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case va.CanInt() && vb.CanInt():
+		return cmp.Compare(va.Int(), vb.Int()), nil
+	case va.CanFloat() && vb.CanFloat():
+		return cmp.Compare(va.Float(), vb.Float()), nil
+	case va.Kind() == reflect.String && vb.Kind() == reflect.String:
+		return strings.Compare(va.String(), vb.String()), nil
+	case va.Kind() == reflect.Bool && vb.Kind() == reflect.Bool:
+		return cmp.Compare(boolInt(va.Bool()), boolInt(vb.Bool())), nil
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+func in(value any, list any) bool {
+	items := reflect.ValueOf(list)
+	for i := range items.Len() {
+		if c, err := compare(value, items.Index(i).Interface()); err == nil && c == 0 {
+			return true
+		}
+	}
+	return false
+}
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+func (s *MemoryStore) sort(sch *schema.Schema, rows []reflect.Value, orders []string) error {
+	for i := len(orders) - 1; i >= 0; i-- {
+		column, direction, _ := strings.Cut(orders[i], " ")
+		field := sch.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("unknown column %q", column)
+		}
+		desc := strings.EqualFold(strings.TrimSpace(direction), "DESC")
+		var err error
+		slices.SortStableFunc(rows, func(a, b reflect.Value) int {
+			x, _ := field.ValueOf(context.Background(), a)
+			y, _ := field.ValueOf(context.Background(), b)
+			c, cerr := compare(x, y)
+			if cerr != nil {
+				err = cerr
+			}
+			if desc {
+				return -c
+			}
+			return c
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (s *MemoryStore) preload(sch *schema.Schema, row reflect.Value, preloads []string) error {
+	for _, name := range preloads {
+		rel, ok := sch.Relationships.Relations[name]
+		if !ok || rel.Type != schema.BelongsTo {
+			return fmt.Errorf("cannot preload %q on %s", name, sch.Name)
+		}
+		for _, related := range s.tables[rel.FieldSchema.ModelType] {
+			if deleted(rel.FieldSchema, related.Elem()) {
+				continue
+			}
+			found := true
+			for _, ref := range rel.References {
+				foreign, _ := ref.ForeignKey.ValueOf(context.Background(), row)
+				primary, _ := ref.PrimaryKey.ValueOf(context.Background(), related.Elem())
+				found = found && reflect.DeepEqual(foreign, primary)
+			}
+			if found {
+				copied := reflect.New(rel.FieldSchema.ModelType)
+				copied.Elem().Set(related.Elem())
+				if err := rel.Field.Set(context.Background(), row, copied.Interface()); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// selectColumns zeroes the columns of row that were not selected, as if
+// they had not been loaded.
+func selectColumns(sch *schema.Schema, row reflect.Value, columns []string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	for _, column := range columns {
+		if sch.LookUpField(column) == nil {
+			return fmt.Errorf("unknown column %q", column)
+		}
+	}
+	for _, field := range sch.Fields {
+		if field.DBName == "" || slices.Contains(columns, field.DBName) {
+			continue
+		}
+		row.FieldByIndex(field.StructField.Index).SetZero()
+	}
+	return nil
+}
+func (s *MemoryStore) find(t reflect.Type, id any, scopes ...Scope) ([]reflect.Value, *schema.Schema, error) {
+	sch, err := s.schema(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	q := Build(scopes...)
+	var rows []reflect.Value
+	for _, row := range s.tables[t] {
+		if !q.Unscoped && deleted(sch, row.Elem()) || q.Deleted && !deleted(sch, row.Elem()) || q.Visible && s.hidden(sch, row.Elem(), q.Viewer) || q.HiddenBy != "" && s.hiddenBy(row.Elem(), q.HiddenBy) {
+			continue
+		}
+		ok, err := s.match(sch, row.Elem(), id, q.Conds)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok && q.After != nil {
+			ok = s.after(sch, row.Elem(), *q.After, q.AfterDesc)
+		}
+		if ok {
+			copied := reflect.New(t)
+			copied.Elem().Set(row.Elem())
+			rows = append(rows, copied)
+		}
+	}
+	if err := s.sort(sch, rows, q.Orders); err != nil {
+		return nil, nil, err
+	}
+	rows = rows[min(q.Offset, len(rows)):]
+	if q.Limit > 0 {
+		rows = rows[:min(q.Limit, len(rows))]
+	}
+	for _, row := range rows {
+		if err := s.preload(sch, row.Elem(), q.Preloads); err != nil {
+			return nil, nil, err
+		}
+		if err := selectColumns(sch, row.Elem(), q.Columns); err != nil {
+			return nil, nil, err
+		}
+	}
+	return rows, sch, nil
+}
+func (s *MemoryStore) Get(c context.Context, dest any, id any, preloads ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows, _, err := s.find(structType(dest), id, Preload(preloads...), Page(models.PageRequest{Limit: 1}))
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	reflect.ValueOf(dest).Elem().Set(rows[0].Elem())
+	return nil
+}
+func (s *MemoryStore) Find(c context.Context, dest any, id any, scopes ...Scope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows, _, err := s.find(structType(dest), id, scopes...)
+	if err != nil {
+		return err
+	}
+	items := reflect.ValueOf(dest).Elem()
+	items.Set(reflect.MakeSlice(items.Type(), 0, len(rows)))
+	for _, row := range rows {
+		items.Set(reflect.Append(items, row.Elem()))
+	}
+	return nil
+}
+func (s *MemoryStore) Count(c context.Context, model any, id any, scopes ...Scope) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	built := Build(scopes...)
+	rows, _, err := s.find(structType(model), id, func(q *Query) {
+		q.Conds, q.Unscoped, q.Deleted, q.Visible, q.Viewer, q.HiddenBy = built.Conds, built.Unscoped, built.Deleted, built.Visible, built.Viewer, built.HiddenBy
+	})
+	return int64(len(rows)), err
+}
+func (s *MemoryStore) CountBy(c context.Context, model any, id any, column string, scopes ...Scope) (map[string]int64, error) {
+	return s.countBy(model, id, column, func(value any) string { return fmt.Sprint(value) }, scopes...)
+}
+func (s *MemoryStore) CountByDay(c context.Context, model any, id any, column string, scopes ...Scope) (map[string]int64, error) {
+	return s.countBy(model, id, column, func(value any) string {
+		return value.(time.Time).UTC().Format(time.DateOnly)
+	}, scopes...)
+}
+
+// countBy counts the matching rows grouped by what key makes of column.
+func (s *MemoryStore) countBy(model any, id any, column string, key func(any) string, scopes ...Scope) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	built := Build(scopes...)
+	rows, sch, err := s.find(structType(model), id, func(q *Query) {
+		q.Conds, q.Unscoped, q.Deleted, q.Visible, q.Viewer, q.HiddenBy = built.Conds, built.Unscoped, built.Deleted, built.Visible, built.Viewer, built.HiddenBy
+	})
+	if err != nil {
+		return nil, err
+	}
+	field := sch.LookUpField(column)
+	if field == nil {
+		return nil, fmt.Errorf("unknown column %q", column)
+	}
+	counts := map[string]int64{}
+	for _, row := range rows {
+		value, _ := field.ValueOf(context.Background(), row.Elem())
+		counts[key(value)]++
+	}
+	return counts, nil
+}
+func (s *MemoryStore) Create(c context.Context, obj any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(obj)
+}
+func (s *MemoryStore) create(obj any) error {
+	t := structType(obj)
+	sch, err := s.schema(t)
+	if err != nil {
+		return err
+	}
+	if hook, ok := obj.(interface{ BeforeCreate(*gorm.DB) error }); ok {
+		if err := hook.BeforeCreate(nil); err != nil {
+			return err
+		}
+	}
+	row := reflect.ValueOf(obj).Elem()
+	now := time.Now()
+	for _, field := range sch.Fields {
+		if _, zero := field.ValueOf(context.Background(), row); zero && (field.AutoCreateTime > 0 || field.AutoUpdateTime > 0) {
+			if err := field.Set(context.Background(), row, now); err != nil {
+				return err
+			}
+		}
+	}
+	unique := [][]*schema.Field{sch.PrimaryFields}
+	for _, index := range sch.ParseIndexes() {
+		if index.Class == "UNIQUE" {
+			var fields []*schema.Field
+			for _, option := range index.Fields {
+				fields = append(fields, option.Field)
+			}
+			unique = append(unique, fields)
+		}
+	}
+	for _, existing := range s.tables[t] {
+		for _, fields := range unique {
+			same := true
+			for _, field := range fields {
+				x, _ := field.ValueOf(context.Background(), row)
+				y, _ := field.ValueOf(context.Background(), existing.Elem())
+				same = same && reflect.DeepEqual(x, y)
+			}
+			if same {
+				return ErrDuplicatedKey
+			}
+		}
+	}
+	stored := reflect.New(t)
+	stored.Elem().Set(row)
+	s.tables[t] = append(s.tables[t], stored)
+	s.logUndo(func() {
+		s.tables[t] = slices.DeleteFunc(s.tables[t], func(row reflect.Value) bool { return row.Pointer() == stored.Pointer() })
+	})
+	return nil
+}
+func (s *MemoryStore) Update(c context.Context, model any, mask any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(model, mask)
+}
+func (s *MemoryStore) update(model any, mask any) error {
+	t := structType(model)
+	sch, err := s.schema(t)
+	if err != nil {
+		return err
+	}
+	key, keyed := reflect.New(t), false
+	for _, field := range sch.PrimaryFields {
+		value, zero := field.ValueOf(context.Background(), reflect.Indirect(reflect.ValueOf(model)))
+		if err := field.Set(context.Background(), key.Elem(), value); err != nil {
+			return err
+		}
+		keyed = keyed || !zero
+	}
+	if !keyed {
+		return gorm.ErrMissingWhereClause
+	}
+	values := map[string]any{}
+	if m, ok := mask.(map[string]any); ok {
+		values = m
+	} else {
+		masked := reflect.Indirect(reflect.ValueOf(mask))
+		for _, field := range sch.Fields {
+			if value, zero := field.ValueOf(context.Background(), masked); field.DBName != "" && !zero {
+				values[field.DBName] = value
+			}
+		}
+	}
+	for _, row := range s.tables[t] {
+		if ok, err := s.match(sch, row.Elem(), key.Interface(), nil); err != nil || !ok || deleted(sch, row.Elem()) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for column, value := range values {
+			field := sch.LookUpField(column)
+			if field == nil {
+				return fmt.Errorf("unknown column %q", column)
+			}
+			if err := s.set(field, row, value); err != nil {
+				return err
+			}
+		}
+		if field := sch.LookUpField("updated_at"); field != nil {
+			if err := s.set(field, row, time.Now()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func (s *MemoryStore) Increment(c context.Context, model any, column string, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := structType(model)
+	sch, err := s.schema(t)
+	if err != nil {
+		return err
+	}
+	field := sch.LookUpField(column)
+	if field == nil {
+		return fmt.Errorf("unknown column %q", column)
+	}
+	for _, row := range s.tables[t] {
+		if ok, err := s.match(sch, row.Elem(), model, nil); err != nil || !ok || deleted(sch, row.Elem()) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		current, _ := field.ValueOf(context.Background(), row.Elem())
+		if err := s.set(field, row, current.(int)+n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (s *MemoryStore) UpdateColumns(c context.Context, model any, id any, values map[string]any, scopes ...Scope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := structType(model)
+	sch, err := s.schema(t)
+	if err != nil {
+		return err
+	}
+	fields := map[*schema.Field]any{}
+	for column, value := range values {
+		field := sch.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("unknown column %q", column)
+		}
+		fields[field] = value
+	}
+	q := Build(scopes...)
+	for _, row := range s.tables[t] {
+		if !q.Unscoped && deleted(sch, row.Elem()) || q.Deleted && !deleted(sch, row.Elem()) {
+			continue
+		}
+		if ok, err := s.match(sch, row.Elem(), id, q.Conds); err != nil || !ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for field, value := range fields {
+			if err := s.set(field, row, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func (s *MemoryStore) Delete(c context.Context, model any, id any, scopes ...Scope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delete(model, id, Build(scopes...))
+}
+
+// delete soft-deletes the matching rows of models that support it, and
+// removes them for good otherwise or when the query is unscoped.
+func (s *MemoryStore) delete(model any, id any, q Query) error {
+	t := structType(model)
+	sch, err := s.schema(t)
+	if err != nil {
+		return err
+	}
+	soft := sch.LookUpField("deleted_at")
+	kept := s.tables[t][:0]
+	for _, row := range s.tables[t] {
+		if q.Deleted && !deleted(sch, row.Elem()) {
+			kept = append(kept, row)
+			continue
+		}
+		ok, err := s.match(sch, row.Elem(), id, q.Conds)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !ok || !q.Unscoped && deleted(sch, row.Elem()):
+			kept = append(kept, row)
+		case soft != nil && !q.Unscoped:
+			if err := s.set(soft, row, time.Now()); err != nil {
+				return err
+			}
+			kept = append(kept, row)
+		default:
+			s.logUndo(func() { s.tables[t] = append(s.tables[t], row) })
+		}
+	}
+	s.tables[t] = kept
+	return nil
+}
+
+func (s *MemoryStore) Restore(c context.Context, model any, id any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := structType(model)
+	sch, err := s.schema(t)
+	if err != nil {
+		return err
+	}
+	soft := sch.LookUpField("deleted_at")
+	if soft == nil {
+		return nil
+	}
+	for _, row := range s.tables[t] {
+		if ok, err := s.match(sch, row.Elem(), id, nil); err != nil {
+			return err
+		} else if ok {
+			if err := s.set(soft, row, gorm.DeletedAt{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Transaction runs f against the store and, if it fails, takes back the
+// writes f made, latest first. Writes made meanwhile outside f are kept. It
+// does not isolate f from concurrent writers.
+func (s *MemoryStore) Transaction(c context.Context, f func(Store) error) error {
+	tx := &MemoryStore{memory: s.memory, undo: &[]func(){}}
+	if err := f(tx); err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, undo := range slices.Backward(*tx.undo) {
+			undo()
+		}
+		return err
+	}
+	// A nested transaction's writes are the outer one's to take back.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, undo := range *tx.undo {
+		s.logUndo(undo)
+	}
+	return nil
+}
+func (s *MemoryStore) CastVote(c context.Context, target any, key models.Vote, direction int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	match := []Scope{
+		Where("user_id", "=", key.UserID),
+		Where("topic_id", "=", key.TopicID),
+		Where("post_id", "=", key.PostID),
+		Where("comment_id", "=", key.CommentID),
+	}
+	rows, _, err := s.find(reflect.TypeOf(key), nil, match...)
+	if err != nil {
+		return 0, err
+	}
+	var existing models.Vote
+	if len(rows) > 0 {
+		existing = rows[0].Elem().Interface().(models.Vote)
+	}
+	value := direction
+	if existing.Value == direction {
+		value = 0
+	}
+	if err := s.delete(&models.Vote{}, nil, Build(match...)); err != nil {
+		return 0, err
+	}
+	if value != 0 {
+		key.Value, key.CreatedAt = value, existing.CreatedAt
+		if err := s.create(&key); err != nil {
+			return 0, err
+		}
+	}
+	targets, sch, err := s.find(structType(target), target)
+	if err != nil || len(targets) == 0 {
+		return value, err
+	}
+	changes := map[string]any{}
+	for column, delta := range map[string]int{
+		"votes": value - existing.Value,
+		"ups":   boolInt(value == 1) - boolInt(existing.Value == 1),
+		"downs": boolInt(value == -1) - boolInt(existing.Value == -1),
+	} {
+		field := sch.LookUpField(column)
+		current, _ := field.ValueOf(context.Background(), targets[0].Elem())
+		changes[column] = current.(int) + delta
+		if err := field.Set(context.Background(), targets[0].Elem(), changes[column]); err != nil {
+			return 0, err
+		}
+	}
+	if scored, ok := targets[0].Interface().(models.Scored); ok {
+		for column, score := range scored.Scores() {
+			changes[column] = score
+		}
+	}
+	if err := s.update(target, changes); err != nil {
+		return 0, err
+	}
+	author, zero := sch.LookUpField("author_id").ValueOf(context.Background(), targets[0].Elem())
+	if zero {
+		return value, nil
+	}
+	users, userSchema, err := s.find(reflect.TypeOf(models.User{}), &models.User{Model: models.Model{ID: author.(string)}})
+	if err != nil || len(users) == 0 {
+		return value, err
+	}
+	column := KarmaColumn(key)
+	karma, _ := userSchema.LookUpField(column).ValueOf(context.Background(), users[0].Elem())
+	return value, s.update(&models.User{Model: models.Model{ID: author.(string)}}, map[string]any{column: karma.(int) + value - existing.Value})
+}
+
+// Search matches every term case-insensitively against post titles and
+// post and comment bodies. It has no ranking or highlighting.
+func (s *MemoryStore) Search(c context.Context, q string, topicID string, page models.PageRequest, scopes ...Scope) (*models.ListResponse[models.SearchResult], error) {
+	page, err := offsetPage(page.Normalize())
+	if err != nil {
+		return &models.ListResponse[models.SearchResult]{Items: []models.SearchResult{}}, err
+	}
+	res := &models.ListResponse[models.SearchResult]{Items: []models.SearchResult{}, Pagination: models.Pagination{Limit: page.Limit, Offset: page.Offset}}
+	terms := strings.Fields(strings.ToLower(q))
+	if len(terms) == 0 {
+		return res, ErrEmptyQuery
+	}
+	matches := func(text string) bool {
+		text = strings.ToLower(text)
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				return false
+			}
+		}
+		return true
+	}
+	var id any
+	if topicID != "" {
+		id = &models.Post{TopicID: topicID}
+	}
+	var posts []models.Post
+	if err := s.Find(c, &posts, id, scopes...); err != nil {
+		return res, err
+	}
+	var results []models.SearchResult
+	for _, post := range posts {
+		if matches(post.Title + " " + post.Content) {
+			results = append(results, models.SearchResult{Kind: "post", TopicID: post.TopicID, PostID: post.ID, Title: template.HTML(html.EscapeString(post.Title)), Snippet: template.HTML(html.EscapeString(post.Content))})
+		}
+		var comments []models.Comment
+		if err := s.Find(c, &comments, &models.Comment{TopicID: post.TopicID, PostID: post.ID}, scopes...); err != nil {
+			return res, err
+		}
+		for _, comment := range comments {
+			if matches(comment.Content) {
+				results = append(results, models.SearchResult{Kind: "comment", TopicID: post.TopicID, PostID: post.ID, CommentID: comment.ID, Title: template.HTML(html.EscapeString(post.Title)), Snippet: template.HTML(html.EscapeString(comment.Content))})
+			}
+		}
+	}
+	res.Total = int64(len(results))
+	res.NextPageToken = offsetToken(res.Pagination)
+	res.Items = append(res.Items, results[min(page.Offset, len(results)):min(page.Offset+page.Limit, len(results))]...)
+	return res, nil
+}
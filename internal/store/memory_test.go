@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestMemoryTransactionKeepsOtherWrites fails a transaction while another
+// writer creates and updates posts, and checks only the transaction's own
+// writes were taken back.
+func TestMemoryTransactionKeepsOtherWrites(t *testing.T) {
+	c := context.Background()
+	s := NewMemoryStore()
+	user, _ := seed(t, s, 1)
+	p0 := models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}
+	failed := errors.New("failed")
+	err := s.Transaction(c, func(tx Store) error {
+		if err := tx.Update(c, &p0, map[string]any{"title": "Rolled back"}); err != nil {
+			return err
+		}
+		// Another request writes while the transaction is open.
+		if _, err := Create(c, s, models.Post{Model: models.Model{ID: "other"}, TopicID: "golang", AuthorID: user.ID, Title: "Other"}); err != nil {
+			return err
+		}
+		if err := s.Increment(c, &p0, "views", 2); err != nil {
+			return err
+		}
+		// A nested transaction's writes go when the outer one fails.
+		if err := tx.Transaction(c, func(tx Store) error {
+			_, err := Create(c, tx, models.Post{Model: models.Model{ID: "nested"}, TopicID: "golang", AuthorID: user.ID, Title: "Nested"})
+			return err
+		}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("got %v, want the error f returned", err)
+	}
+	posts, err := Find(c, s, models.Post{TopicID: "golang"}, OrderBy("id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := titles(posts); len(got) != 2 || got[0] != "Other" || got[1] != "Post 0" {
+		t.Errorf("posts after the rollback: got %v, want [Other Post 0]", got)
+	}
+	if len(posts) == 2 && posts[1].Views != 2 {
+		t.Errorf("the other writer's increment: got %d views, want 2", posts[1].Views)
+	}
+}
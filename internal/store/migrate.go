@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/store/migrations"
+)
+
+// schemaMigration records a migration applied to the database.
+type schemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:100"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState is a known migration and when it was applied, if it was.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+func (s *GormStore) applied(c context.Context) (map[int]schemaMigration, error) {
+	db := s.DB.WithContext(c)
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := map[int]schemaMigration{}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Migrate applies the migrations the database has not seen yet, in order.
+// A database AutoMigrate built before migrations existed picks up from 1.
+func (s *GormStore) Migrate() error {
+	applied, err := s.applied(context.Background())
+	if err != nil {
+		return err
+	}
+	return s.migrating(func(db *gorm.DB) error {
+		for _, m := range migrations.All {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			slog.Info("applied migration", "version", m.Version, "name", m.Name)
+		}
+		return nil
+	})
+}
+
+// Rollback undoes the most recently applied migration.
+func (s *GormStore) Rollback() error {
+	applied, err := s.applied(context.Background())
+	if err != nil {
+		return err
+	}
+	for i := len(migrations.All) - 1; i >= 0; i-- {
+		m := migrations.All[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := s.migrating(func(db *gorm.DB) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{Version: m.Version}).Error
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("rolling back migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		slog.Info("rolled back migration", "version", m.Version, "name", m.Name)
+		return nil
+	}
+	return errors.New("no migrations to roll back")
+}
+
+// migrating runs fn on one connection, with foreign keys off on SQLite.
+// SQLite rebuilds a table to change it, and the rebuild checks the keys
+// of the tables around it against a schema that is only half migrated;
+// the initial schema's key from comments to posts(id) cannot even be
+// checked until migration 2 drops it. The pragma is ignored inside a
+// transaction, so it is set on the connection the migrations then use.
+func (s *GormStore) migrating(fn func(db *gorm.DB) error) error {
+	if s.DB.Dialector.Name() != "sqlite" {
+		return fn(s.DB)
+	}
+	return s.DB.Connection(func(conn *gorm.DB) error {
+		db := conn.Session(&gorm.Session{NewDB: true})
+		var enforced bool
+		if err := db.Raw("PRAGMA foreign_keys").Scan(&enforced).Error; err != nil {
+			return err
+		}
+		if !enforced {
+			return fn(db)
+		}
+		if err := db.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		return errors.Join(fn(db), db.Exec("PRAGMA foreign_keys = ON").Error)
+	})
+}
+
+// MigrationStatus lists every known migration and whether it is applied.
+func (s *GormStore) MigrationStatus() ([]MigrationState, error) {
+	applied, err := s.applied(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(migrations.All))
+	for i, m := range migrations.All {
+		states[i] = MigrationState{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			states[i].AppliedAt = &row.AppliedAt
+		}
+	}
+	return states, nil
+}
+
+// Migrated checks that every known migration has been applied.
+func (s *GormStore) Migrated(c context.Context) error {
+	if !s.DB.WithContext(c).Migrator().HasTable(&schemaMigration{}) {
+		return errors.New("no migrations have been applied")
+	}
+	var count int64
+	if err := s.DB.WithContext(c).Model(&schemaMigration{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if pending := len(migrations.All) - int(count); pending > 0 {
+		return fmt.Errorf("%d migrations are pending", pending)
+	}
+	return nil
+}
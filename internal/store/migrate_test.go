@@ -0,0 +1,779 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"reddit-clone/internal/models"
+	"reddit-clone/internal/store/migrations"
+)
+
+// TestMigrate applies, lists and rolls back the migrations, and picks up a
+// database AutoMigrate built before they existed.
+func TestMigrate(t *testing.T) {
+	c := context.Background()
+	s := openStore(t, "sqlite")
+	states, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != len(migrations.All) || states[0].Name != "initial" || states[0].AppliedAt == nil {
+		t.Errorf("status after migrating: got %+v", states)
+	}
+	if err := s.Migrate(); err != nil {
+		t.Errorf("migrate again: %v", err)
+	}
+	if err := s.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrated(c); err == nil || err.Error() != "1 migrations are pending" {
+		t.Errorf("migrated after a rollback: got %v", err)
+	}
+	if states, _ := s.MigrationStatus(); states[len(states)-1].AppliedAt != nil || states[len(states)-2].AppliedAt == nil {
+		t.Errorf("status after a rollback: got %+v", states)
+	}
+	for range migrations.All[1:] {
+		if !s.DB.Migrator().HasTable(&models.Post{}) {
+			t.Error("a later migration's rollback dropped the posts table")
+		}
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasTable(&models.Post{}) {
+		t.Error("rolling back the initial migration left the posts table")
+	}
+	if err := s.Rollback(); err == nil {
+		t.Error("rolled back with nothing applied")
+	}
+
+	legacy, err := Open("sqlite", filepath.Join(t.TempDir(), "legacy.db"), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.Close()
+	if err := legacy.Migrated(c); err == nil {
+		t.Error("a new database counts as migrated")
+	}
+	if err := legacy.DB.AutoMigrate(models.All()...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(c, legacy, models.Topic{Model: models.Model{ID: "golang"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.Migrate(); err != nil {
+		t.Fatalf("migrate a database AutoMigrate built: %v", err)
+	}
+	if err := legacy.Migrated(c); err != nil {
+		t.Errorf("migrated: %v", err)
+	}
+	if _, err := Get(c, legacy, models.Topic{Model: models.Model{ID: "golang"}}); err != nil {
+		t.Errorf("the topic after migrating: %v", err)
+	}
+}
+
+// TestMigrateCommentCounts rolls back to before posts kept a comment count
+// and checks migrating fills it in, leaving out deleted and shadowbanned
+// comments.
+func TestMigrateCommentCounts(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "comment_count") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'One'), ('p2', 'golang', 'u1', 'Two')",
+		"INSERT INTO comments (id, topic_id, post_id, author_id) VALUES ('c1', 'golang', 'p1', 'u1'), ('c2', 'golang', 'p1', 'u1')",
+		"INSERT INTO comments (id, topic_id, post_id, author_id, deleted_at) VALUES ('c3', 'golang', 'p1', 'u1', CURRENT_TIMESTAMP)",
+		"INSERT INTO comments (id, topic_id, post_id, author_id, shadowbanned) VALUES ('c4', 'golang', 'p1', 'u1', true)",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var counts []int
+	if err := s.DB.Table("posts").Order("id").Pluck("comment_count", &counts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(counts) != "[2 0]" {
+		t.Errorf("comment counts after migrating: got %v, want [2 0]", counts)
+	}
+}
+
+// TestMigrateHotScores rolls back to before posts kept a hot score and
+// checks migrating computes it for the existing posts.
+func TestMigrateHotScores(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "hot_score") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.DB.Exec("INSERT INTO posts (id, topic_id, author_id, title, votes, created_at) VALUES ('p1', 'golang', 'u1', 'One', 100, ?), ('p2', 'golang', 'u1', 'Two', -3, ?)", created, created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var scores []float64
+	if err := s.DB.Table("posts").Order("id").Pluck("hot_score", &scores).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{models.Hot(100, created), models.Hot(-3, created)}; fmt.Sprint(scores) != fmt.Sprint(want) {
+		t.Errorf("hot scores after migrating: got %v, want %v", scores, want)
+	}
+	if !s.DB.Migrator().HasIndex(&models.Post{}, "HotScore") {
+		t.Error("hot_score is not indexed")
+	}
+}
+
+// TestMigrateVoteTallies counts the votes already cast into upvotes and
+// downvotes, and scores the comments from them.
+func TestMigrateVoteTallies(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "ups") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice'), ('u2', 'bob'), ('u3', 'carol')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title, votes) VALUES ('p1', 'golang', 'u1', 'One', 1)",
+		"INSERT INTO comments (id, topic_id, post_id, author_id, content, votes) VALUES ('c1', 'golang', 'p1', 'u1', 'Split', 0), ('c2', 'golang', 'p1', 'u1', 'Quiet', 0)",
+		"INSERT INTO votes (user_id, topic_id, post_id, comment_id, value) VALUES ('u2', 'golang', 'p1', '', 1), ('u3', 'golang', 'p1', '', 1), ('u1', 'golang', 'p1', '', -1), ('u2', 'golang', 'p1', 'c1', 1), ('u3', 'golang', 'p1', 'c1', -1)",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.Ups != 2 || post.Downs != 1 {
+		t.Errorf("p1 after migrating: got %d up and %d down, want 2 and 1", post.Ups, post.Downs)
+	}
+	var comments []models.Comment
+	if err := s.DB.Order("id").Find(&comments).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 {
+		t.Fatalf("comments after migrating: got %d", len(comments))
+	}
+	if c1 := comments[0]; c1.Ups != 1 || c1.Downs != 1 || c1.BestScore != models.Wilson(1, 1) || c1.Controversy != models.Controversy(1, 1) {
+		t.Errorf("c1 after migrating: got %d up, %d down, best %v and controversy %v", c1.Ups, c1.Downs, c1.BestScore, c1.Controversy)
+	}
+	if c2 := comments[1]; c2.Ups != 0 || c2.Downs != 0 || c2.BestScore != 0 || c2.Controversy != 0 {
+		t.Errorf("c2 after migrating: got %+v", c2)
+	}
+}
+
+// TestMigrateLinkPosts marks the posts from before link posts as text
+// posts.
+func TestMigrateLinkPosts(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "kind") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.Kind != models.PostSelf || post.URL != "" || post.IsLink() {
+		t.Errorf("p1 after migrating: got kind %q and URL %q", post.Kind, post.URL)
+	}
+}
+
+// TestMigrateLinkPreviews rolls back until the link_previews table is gone
+// and migrates it back.
+func TestMigrateLinkPreviews(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasTable(&models.LinkPreview{}) {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	preview := models.LinkPreview{TopicID: "golang", PostID: "p1", URL: "https://example.com/", Title: "Example"}
+	if err := s.DB.Create(&preview).Error; err != nil {
+		t.Errorf("store a preview after migrating: %v", err)
+	}
+}
+
+// TestMigrateMedia rolls back to before posts could show an image and
+// checks migrating leaves existing posts as they were.
+func TestMigrateMedia(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "media_id") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasTable(&models.Media{}) {
+		t.Error("rolling back left the media table")
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title, kind, url) VALUES ('p1', 'golang', 'u1', 'Old', 'link', 'https://example.com/')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.Kind != models.PostLink || post.MediaID != "" {
+		t.Errorf("p1 after migrating: got kind %q and media %q", post.Kind, post.MediaID)
+	}
+	if err := s.DB.Create(&models.Media{Model: models.Model{ID: "m1"}, UploaderID: "u1", ContentType: "image/png"}).Error; err != nil {
+		t.Errorf("record an upload after migrating: %v", err)
+	}
+}
+
+// TestMigratePolls rolls back to before posts could be polls and checks
+// migrating leaves existing posts open-ended.
+func TestMigratePolls(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "poll_closes_at") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasTable(&models.PollOption{}) || s.DB.Migrator().HasTable(&models.PollVote{}) {
+		t.Error("rolling back left the poll tables")
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.IsPoll() || post.PollClosesAt != nil {
+		t.Errorf("p1 after migrating: got kind %q closing %v", post.Kind, post.PollClosesAt)
+	}
+	if err := s.DB.Create(&models.PollOption{TopicID: "golang", PostID: "p1", Position: 1, Text: "Yes"}).Error; err != nil {
+		t.Errorf("store an option after migrating: %v", err)
+	}
+	vote := models.PollVote{UserID: "u1", TopicID: "golang", PostID: "p1", Position: 1}
+	if err := s.DB.Create(&vote).Error; err != nil {
+		t.Errorf("store a vote after migrating: %v", err)
+	}
+	if err := s.DB.Create(&vote).Error; err == nil {
+		t.Error("stored a second vote by the same user")
+	}
+}
+
+// TestMigrateCrossposts rolls back to before crossposts and checks
+// migrating adds the columns and their index, leaving posts as they were.
+func TestMigrateCrossposts(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "crosspost_of") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasColumn("posts", "crosspost_topic") {
+		t.Error("rolling back left posts.crosspost_topic")
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.DB.Migrator().HasIndex(&models.Post{}, "CrosspostOf") {
+		t.Error("migrating did not index crosspost_of")
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.IsCrosspost() || post.CrosspostTopic != "" || post.CrosspostOf != "" {
+		t.Errorf("p1 after migrating: got %+v", post)
+	}
+}
+
+func TestMigrateFlairs(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "flair_id") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasTable("flairs") {
+		t.Error("rolling back left the flairs table")
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.DB.Migrator().HasTable(&models.Flair{}) || !s.DB.Migrator().HasIndex(&models.Post{}, "FlairID") {
+		t.Error("migrating did not add the flairs table and the flair_id index")
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.FlairID != "" {
+		t.Errorf("p1 after migrating: got flair %q", post.FlairID)
+	}
+}
+
+func TestMigrateUserFlairs(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasTable("user_flairs") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasColumn("flairs", "users") {
+		t.Error("rolling back left flairs.users")
+	}
+	for _, sql := range []string{
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO flairs (id, topic_id, text, color) VALUES ('f1', 'golang', 'News', '#e0e0e0')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.DB.Migrator().HasTable(&models.UserFlair{}) {
+		t.Error("migrating did not add the user_flairs table")
+	}
+	var flair models.Flair
+	if err := s.DB.Take(&flair, "id = ?", "f1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if flair.Users {
+		t.Error("an existing flair became a user flair")
+	}
+}
+
+func TestMigratePostMarks(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "nsfw") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasColumn("posts", "spoiler") {
+		t.Error("rolling back left posts.spoiler")
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.NSFW || post.Spoiler {
+		t.Errorf("p1 after migrating: got nsfw %v and spoiler %v", post.NSFW, post.Spoiler)
+	}
+}
+
+func TestMigratePinnedPosts(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "pinned") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.Pinned {
+		t.Error("p1 is pinned after migrating")
+	}
+}
+
+func TestMigrateCommentStickies(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("comments", "stickied") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasColumn("comments", "distinguished") {
+		t.Error("rolling back left comments.distinguished")
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+		"INSERT INTO comments (id, topic_id, post_id, author_id, content) VALUES ('c1', 'golang', 'p1', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var comment models.Comment
+	if err := s.DB.Take(&comment, "id = ?", "c1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if comment.Stickied || comment.Distinguished != "" {
+		t.Errorf("c1 after migrating: got stickied %v and distinguished %q", comment.Stickied, comment.Distinguished)
+	}
+}
+
+func TestMigrateLockedPosts(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "locked") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if post.Locked {
+		t.Error("p1 is locked after migrating")
+	}
+}
+
+// TestMigrateArchiveIndex checks an archive month of a topic is read off
+// the index on topic and creation time, and that rolling it back keeps the
+// index on creation time alone.
+func TestMigrateArchiveIndex(t *testing.T) {
+	s := openStore(t, "sqlite")
+	var plan []struct{ Detail string }
+	if err := s.DB.Raw("EXPLAIN QUERY PLAN SELECT * FROM posts WHERE topic_id = ? AND created_at >= ? AND created_at < ? ORDER BY created_at", "golang", time.Now(), time.Now()).Scan(&plan).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || !strings.Contains(plan[0].Detail, "idx_posts_topic_created_at (topic_id=? AND created_at>? AND created_at<?)") {
+		t.Errorf("query plan of an archive month: got %+v", plan)
+	}
+	for s.DB.Migrator().HasIndex("posts", "idx_posts_topic_created_at") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !s.DB.Migrator().HasIndex("posts", "idx_posts_created_at") {
+		t.Error("rolling back dropped the index on when posts were created")
+	}
+}
+
+// TestMigrateSettings rolls back to before the settings table and checks
+// migrating adds it.
+func TestMigrateSettings(t *testing.T) {
+	c := context.Background()
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasTable("settings") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(c, s, models.Setting{Key: "title_rules", Value: "lowercase=true"}); err != nil {
+		t.Fatal(err)
+	}
+	if setting, err := Get(c, s, models.Setting{Key: "title_rules"}); err != nil || setting.Value != "lowercase=true" {
+		t.Errorf("the setting after migrating: got %+v, %v", setting, err)
+	}
+}
+
+// TestMigrateDecayedScores rolls back to before posts kept a decayed score
+// and checks migrating adds it, indexed and zero until the server scores
+// the posts.
+func TestMigrateDecayedScores(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("posts", "decayed_score") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title, votes) VALUES ('p1', 'golang', 'u1', 'Old', 5)",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err := s.DB.Take(&post, "id = ?", "p1").Error; err != nil || post.DecayedScore != 0 {
+		t.Errorf("p1 after migrating: got %v, %v", post.DecayedScore, err)
+	}
+	if !s.DB.Migrator().HasIndex("posts", "idx_posts_decayed_score") {
+		t.Error("decayed_score is not indexed")
+	}
+}
+
+// TestRollbackKeepsIndexes rolls every migration back and applies them
+// again, which on SQLite rebuilds tables under the ones dropping columns.
+func TestRollbackKeepsIndexes(t *testing.T) {
+	s, err := Open("sqlite", filepath.Join(t.TempDir(), "test.db"), Options{SQLite: SQLiteConfig{JournalMode: "WAL", BusyTimeout: 5 * time.Second, ForeignKeys: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	indexes := func() []string {
+		var names []string
+		if err := s.DB.Raw("SELECT tbl_name || '.' || name FROM sqlite_master WHERE type = 'index' AND sql IS NOT NULL ORDER BY 1").Scan(&names).Error; err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	want := indexes()
+	for _, index := range []string{"posts.idx_posts_hot_score", "posts.idx_posts_decayed_score", "posts.idx_posts_normalized_title", "posts.idx_posts_topic_created_at", "comments.idx_comments_parent_comment_id", "mod_actions.idx_mod_actions_topic_id"} {
+		if !slices.Contains(want, index) {
+			t.Errorf("migrated database lacks %s", index)
+		}
+	}
+	for range migrations.All {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexes(); !slices.Equal(got, want) {
+		t.Errorf("indexes after rolling back and migrating again:\n got %v\nwant %v", got, want)
+	}
+	for range 5 {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := indexes(); !slices.Contains(got, "posts.idx_posts_flair_id") || !slices.Contains(got, "posts.idx_posts_created_at") {
+		t.Errorf("rolling back to 0015 lost the indexes of posts: %v", got)
+	}
+}
+
+// TestMigrateFirstRelease migrates a database laid out by the first
+// release, before migrations, whose comments point at posts(id) through a
+// foreign key SQLite cannot check, and whose posts have no normalized
+// title yet.
+func TestMigrateFirstRelease(t *testing.T) {
+	s, err := Open("sqlite", filepath.Join(t.TempDir(), "test.db"), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, sql := range []string{
+		"CREATE TABLE topics (id text, created_at datetime, updated_at datetime, deleted_at datetime, PRIMARY KEY (id))",
+		"CREATE TABLE posts (id text, created_at datetime, updated_at datetime, deleted_at datetime, topic_id text, title text, content text, votes integer, PRIMARY KEY (id, topic_id), CONSTRAINT fk_topics_posts FOREIGN KEY (topic_id) REFERENCES topics(id))",
+		"CREATE TABLE comments (id text, created_at datetime, updated_at datetime, deleted_at datetime, topic_id text, post_id text, content text, votes integer, PRIMARY KEY (id, topic_id, post_id), CONSTRAINT fk_posts_comments FOREIGN KEY (post_id) REFERENCES posts(id))",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, title) VALUES ('p1', 'golang', 'Hello,  World!')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var normalized []string
+	if err := s.DB.Table("posts").Where("id = ?", "p1").Pluck("normalized_title", &normalized).Error; err != nil || len(normalized) != 1 || normalized[0] != "hello world" {
+		t.Errorf("normalized title after migrating: got %q, %v", normalized, err)
+	}
+	var enforced bool
+	if err := s.DB.Raw("PRAGMA foreign_keys").Scan(&enforced).Error; err != nil || !enforced {
+		t.Errorf("foreign keys after migrating: got %v, %v", enforced, err)
+	}
+}
+
+func TestMigrateAutoPins(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasColumn("comments", "auto_pinned") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasColumn("topics", "auto_pin_votes") || s.DB.Migrator().HasColumn("topics", "auto_pin_margin") {
+		t.Error("rolling back left the topics' auto-pin settings")
+	}
+	for _, sql := range []string{
+		"INSERT INTO users (id, username) VALUES ('u1', 'alice')",
+		"INSERT INTO topics (id) VALUES ('golang')",
+		"INSERT INTO posts (id, topic_id, author_id, title) VALUES ('p1', 'golang', 'u1', 'Old')",
+		"INSERT INTO comments (id, topic_id, post_id, author_id, content) VALUES ('c1', 'golang', 'p1', 'u1', 'Old')",
+	} {
+		if err := s.DB.Exec(sql).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var topic models.Topic
+	if err := s.DB.Take(&topic, "id = ?", "golang").Error; err != nil || topic.AutoPinVotes != 0 || topic.AutoPinMargin != 0 {
+		t.Errorf("golang after migrating: got %+v, %v", topic, err)
+	}
+	var comment models.Comment
+	if err := s.DB.Take(&comment, "id = ?", "c1").Error; err != nil || comment.AutoPinned {
+		t.Errorf("c1 after migrating: got auto-pinned %v, %v", comment.AutoPinned, err)
+	}
+}
+
+// TestMigrateEvasionReviews rolls the evasion tables back and reapplies
+// them.
+func TestMigrateEvasionReviews(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasTable("evasion_reviews") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.DB.Migrator().HasTable("user_addresses") {
+		t.Error("rolling back left the users' addresses")
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	if err := s.Create(c, &models.UserAddress{UserID: "u1", IP: "192.0.2.1", LastSeen: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create(c, &models.UserAddress{UserID: "u1", IP: "192.0.2.1", LastSeen: time.Now()}); !errors.Is(err, ErrDuplicatedKey) {
+		t.Errorf("the same address twice: got %v, want ErrDuplicatedKey", err)
+	}
+	if err := s.Create(c, &models.EvasionReview{Model: models.Model{ID: "r1"}, UserID: "u2", BannedUserID: "u1", IP: "192.0.2.1", Status: models.EvasionOpen}); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestMigrateReportArchive rolls the report archive back and reapplies it.
+func TestMigrateReportArchive(t *testing.T) {
+	s := openStore(t, "sqlite")
+	for s.DB.Migrator().HasTable("archived_reports") {
+		if err := s.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !s.DB.Migrator().HasTable("reports") {
+		t.Error("rolling back the archive dropped the reports")
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	archived := models.ArchivedReport{Model: models.Model{ID: "r1"}, TopicID: "golang", PostID: "p1", ReporterID: "u1", Status: models.ReportApproved, ArchivedAt: time.Now()}
+	if err := s.Create(context.Background(), &archived); err != nil {
+		t.Fatal(err)
+	}
+	if !s.DB.Migrator().HasIndex(&models.ArchivedReport{}, "idx_archived_reports_topic") {
+		t.Error("no index on the archived reports' topic")
+	}
+}
@@ -0,0 +1,221 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+)
+
+var initial = Migration{
+	Version: 1,
+	Name:    "initial",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(initialTables()...); err != nil {
+			return err
+		}
+		return backfillNormalizedTitles(tx)
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(initialTables()...)
+	},
+}
+
+// initialTables is the schema as AutoMigrate last built it from the models,
+// frozen here so later model changes cannot rewrite this migration. The type
+// names match the models' so tables, indexes and foreign keys keep their
+// names. On a database AutoMigrate already built, Up only fills in gaps.
+func initialTables() []any {
+	type Model struct {
+		ID        string    `gorm:"primaryKey;size:64"`
+		CreatedAt time.Time `gorm:"index"`
+		UpdatedAt time.Time
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+	}
+	type User struct {
+		Model
+		Username     string `gorm:"uniqueIndex;size:64"`
+		PasswordHash []byte
+		PostKarma    int  `gorm:"not null;default:0"`
+		CommentKarma int  `gorm:"not null;default:0"`
+		Shadowbanned bool `gorm:"not null;default:false"`
+		Banned       bool `gorm:"not null;default:false"`
+	}
+	type Session struct {
+		Model
+		UserID    string `gorm:"index;size:64"`
+		User      *User
+		ExpiresAt time.Time `gorm:"index"`
+	}
+	type Identity struct {
+		Model
+		Provider string `gorm:"uniqueIndex:idx_identities_provider_subject;size:32"`
+		Subject  string `gorm:"uniqueIndex:idx_identities_provider_subject;size:191"`
+		UserID   string `gorm:"index;size:64"`
+	}
+	type Vote struct {
+		UserID    string `gorm:"primaryKey;size:64"`
+		TopicID   string `gorm:"primaryKey;size:64"`
+		PostID    string `gorm:"primaryKey;size:64"`
+		CommentID string `gorm:"primaryKey;size:64"`
+		Value     int
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	type Comment struct {
+		Model
+		TopicID         string `gorm:"primaryKey;size:64"`
+		PostID          string `gorm:"primaryKey;size:64"`
+		ParentCommentID string `gorm:"index;size:64"`
+		AuthorID        string `gorm:"index;size:64"`
+		Author          *User
+		Content         string
+		Votes           int
+		Shadowbanned    bool `gorm:"not null;default:false"`
+		EditedAt        *time.Time
+	}
+	type Post struct {
+		Model
+		TopicID         string `gorm:"primaryKey;size:64;index:idx_posts_normalized_title,priority:1"`
+		Title           string
+		NormalizedTitle string `gorm:"size:191;index:idx_posts_normalized_title,priority:2"`
+		AuthorID        string `gorm:"index;size:64"`
+		Author          *User
+		Content         string
+		Votes           int
+		Shadowbanned    bool `gorm:"not null;default:false"`
+		EditedAt        *time.Time
+		Comments        []Comment
+	}
+	type Topic struct {
+		Model
+		Description string
+		Posts       []Post
+	}
+	type Notification struct {
+		Model
+		UserID    string `gorm:"index;size:64"`
+		ActorID   string `gorm:"size:64"`
+		Actor     *User
+		Kind      string `gorm:"size:32"`
+		TopicID   string `gorm:"size:64"`
+		PostID    string `gorm:"size:64"`
+		CommentID string `gorm:"size:64"`
+		Unread    bool   `gorm:"index"`
+	}
+	type Message struct {
+		Model
+		SenderID    string `gorm:"index;size:64"`
+		Sender      *User
+		RecipientID string `gorm:"index;size:64"`
+		Recipient   *User
+		Content     string
+		Unread      bool `gorm:"index"`
+	}
+	type TopicModerator struct {
+		TopicID   string `gorm:"primaryKey;size:64"`
+		UserID    string `gorm:"primaryKey;size:64"`
+		User      *User
+		CreatedAt time.Time
+	}
+	type Report struct {
+		Model
+		TopicID      string `gorm:"index:idx_reports_topic_status,priority:1;uniqueIndex:idx_reports_reporter_target,priority:2;size:64"`
+		PostID       string `gorm:"uniqueIndex:idx_reports_reporter_target,priority:3;size:64"`
+		CommentID    string `gorm:"uniqueIndex:idx_reports_reporter_target,priority:4;size:64"`
+		ReporterID   string `gorm:"uniqueIndex:idx_reports_reporter_target,priority:1;size:64"`
+		Reporter     *User
+		Reason       string
+		Status       string `gorm:"index:idx_reports_topic_status,priority:2;size:16"`
+		ResolvedByID string `gorm:"size:64"`
+		Held         bool
+	}
+	type ModAction struct {
+		Model
+		TopicID      string `gorm:"index;size:64"`
+		ModeratorID  string `gorm:"size:64"`
+		Moderator    *User
+		Action       string `gorm:"size:32"`
+		TargetUserID string `gorm:"size:64"`
+		TargetUser   *User
+		PostID       string `gorm:"size:64"`
+		CommentID    string `gorm:"size:64"`
+		Details      string
+	}
+	type AutomodRule struct {
+		Model
+		TopicID        string `gorm:"index;size:64"`
+		Name           string `gorm:"size:100"`
+		Applies        string `gorm:"size:16"`
+		Field          string `gorm:"size:16"`
+		Pattern        string
+		Keywords       []string `gorm:"serializer:json"`
+		MinAccountDays int
+		MinKarma       *int
+		Action         string `gorm:"size:16"`
+	}
+	type Filter struct {
+		Model
+		TopicID string `gorm:"index;size:64"`
+		Kind    string `gorm:"size:16"`
+		Value   string `gorm:"size:255"`
+		Action  string `gorm:"size:16"`
+	}
+	type Block struct {
+		UserID    string `gorm:"primaryKey;size:64"`
+		BlockedID string `gorm:"primaryKey;size:64"`
+		Blocked   *User
+		CreatedAt time.Time
+	}
+	type Subscription struct {
+		UserID    string `gorm:"primaryKey;size:64"`
+		TopicID   string `gorm:"primaryKey;size:64"`
+		CreatedAt time.Time
+	}
+	type Collection struct {
+		Model
+		OwnerID string   `gorm:"index;size:64"`
+		Name    string   `gorm:"size:64"`
+		Topics  []string `gorm:"serializer:json"`
+	}
+	type Saved struct {
+		UserID    string    `gorm:"primaryKey;size:64"`
+		TopicID   string    `gorm:"primaryKey;size:64"`
+		PostID    string    `gorm:"primaryKey;size:64"`
+		CommentID string    `gorm:"primaryKey;size:64"`
+		CreatedAt time.Time `gorm:"index"`
+	}
+	type HiddenPost struct {
+		UserID    string    `gorm:"primaryKey;size:64"`
+		TopicID   string    `gorm:"primaryKey;size:64"`
+		PostID    string    `gorm:"primaryKey;size:64"`
+		CreatedAt time.Time `gorm:"index"`
+	}
+	type PostRevision struct {
+		Model
+		TopicID  string `gorm:"index:idx_post_revisions_post,priority:1;size:64"`
+		PostID   string `gorm:"index:idx_post_revisions_post,priority:2;size:64"`
+		EditorID string `gorm:"size:64"`
+		Editor   *User
+		Title    string
+		Content  string
+	}
+	return []any{&User{}, &Session{}, &Identity{}, &Vote{}, &Post{}, &Comment{}, &Topic{}, &Notification{}, &Message{}, &TopicModerator{}, &Report{}, &ModAction{}, &AutomodRule{}, &Filter{}, &Block{}, &Subscription{}, &Collection{}, &Saved{}, &HiddenPost{}, &PostRevision{}}
+}
+
+// backfillNormalizedTitles fills in the duplicate-detection key of posts
+// written before it existed, where adding the column left it NULL.
+func backfillNormalizedTitles(tx *gorm.DB) error {
+	var posts []struct{ ID, TopicID, Title string }
+	if err := tx.Table("posts").Where("(normalized_title IS NULL OR normalized_title = ?) AND title <> ?", "", "").Find(&posts).Error; err != nil {
+		return err
+	}
+	for _, post := range posts {
+		err := tx.Table("posts").Where("id = ? AND topic_id = ?", post.ID, post.TopicID).UpdateColumn("normalized_title", models.TitleRules.Normalize(post.Title)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// foreignKeys drops the foreign keys the initial schema declared but no
+// database could enforce, so SQLite can turn enforcement on. Comments
+// pointed at posts(id), which is not a key of posts on its own, and mod
+// actions by automod, or not against a user, leave the moderator and the
+// target empty.
+var foreignKeys = Migration{
+	Version: 2,
+	Name:    "foreign_keys",
+	Up: func(tx *gorm.DB) error {
+		for table, constraints := range unenforceableKeys {
+			for _, name := range constraints {
+				if !tx.Migrator().HasConstraint(table, name) {
+					continue
+				}
+				err := keepIndexes(tx, table, func() error { return tx.Migrator().DropConstraint(table, name) })
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+	// The keys never held, so there is nothing to put back.
+	Down: func(tx *gorm.DB) error { return nil },
+}
+
+var unenforceableKeys = map[string][]string{
+	"comments":    {"fk_posts_comments"},
+	"mod_actions": {"fk_mod_actions_moderator", "fk_mod_actions_target_user"},
+}
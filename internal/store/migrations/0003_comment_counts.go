@@ -0,0 +1,30 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// commentCounts adds the count of live comments kept on each post, so
+// listings need not count them, and fills it in for existing posts.
+var commentCounts = Migration{
+	Version: 3,
+	Name:    "comment_counts",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			CommentCount int `gorm:"not null;default:0"`
+		}
+		if !tx.Migrator().HasColumn(&Post{}, "CommentCount") {
+			if err := tx.Migrator().AddColumn(&Post{}, "CommentCount"); err != nil {
+				return err
+			}
+		}
+		live := tx.Table("comments").Select("COUNT(*)").
+			Where("comments.topic_id = posts.topic_id AND comments.post_id = posts.id").
+			Where("comments.deleted_at IS NULL AND comments.shadowbanned = ?", false)
+		return tx.Table("posts").Where("1 = 1").UpdateColumn("comment_count", live).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			CommentCount int
+		}
+		return dropColumns(tx, &Post{}, "CommentCount")
+	},
+}
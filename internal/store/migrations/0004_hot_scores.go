@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+)
+
+// hotScores adds the stored hot score posts are ranked by, and computes it
+// for existing posts.
+var hotScores = Migration{
+	Version: 4,
+	Name:    "hot_scores",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			HotScore float64 `gorm:"not null;default:0;index"`
+		}
+		if !tx.Migrator().HasColumn(&Post{}, "HotScore") {
+			if err := tx.Migrator().AddColumn(&Post{}, "HotScore"); err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasIndex(&Post{}, "HotScore") {
+			if err := tx.Migrator().CreateIndex(&Post{}, "HotScore"); err != nil {
+				return err
+			}
+		}
+		var posts []struct {
+			ID, TopicID string
+			Votes       int
+			CreatedAt   time.Time
+		}
+		if err := tx.Table("posts").Select("id", "topic_id", "votes", "created_at").Find(&posts).Error; err != nil {
+			return err
+		}
+		for _, post := range posts {
+			err := tx.Table("posts").Where("id = ? AND topic_id = ?", post.ID, post.TopicID).UpdateColumn("hot_score", models.Hot(post.Votes, post.CreatedAt)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			HotScore float64 `gorm:"index"`
+		}
+		if tx.Migrator().HasIndex(&Post{}, "HotScore") {
+			if err := tx.Migrator().DropIndex(&Post{}, "HotScore"); err != nil {
+				return err
+			}
+		}
+		return dropColumns(tx, &Post{}, "HotScore")
+	},
+}
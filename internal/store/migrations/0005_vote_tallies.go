@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+)
+
+// voteTallies splits the votes on posts and comments into upvotes and
+// downvotes, and adds the best and controversial scores comments are
+// sorted by, filling all of them in from the votes already cast.
+var voteTallies = Migration{
+	Version: 5,
+	Name:    "vote_tallies",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			Ups   int `gorm:"not null;default:0"`
+			Downs int `gorm:"not null;default:0"`
+		}
+		type Comment struct {
+			Ups         int     `gorm:"not null;default:0"`
+			Downs       int     `gorm:"not null;default:0"`
+			BestScore   float64 `gorm:"not null;default:0"`
+			Controversy float64 `gorm:"not null;default:0"`
+		}
+		for _, column := range []struct {
+			model any
+			name  string
+		}{{&Post{}, "Ups"}, {&Post{}, "Downs"}, {&Comment{}, "Ups"}, {&Comment{}, "Downs"}, {&Comment{}, "BestScore"}, {&Comment{}, "Controversy"}} {
+			if tx.Migrator().HasColumn(column.model, column.name) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(column.model, column.name); err != nil {
+				return err
+			}
+		}
+		for column, value := range map[string]int{"ups": 1, "downs": -1} {
+			onPosts := tx.Table("votes").Select("COUNT(*)").
+				Where("votes.topic_id = posts.topic_id AND votes.post_id = posts.id AND votes.comment_id = ? AND votes.value = ?", "", value)
+			if err := tx.Table("posts").Where("1 = 1").UpdateColumn(column, onPosts).Error; err != nil {
+				return err
+			}
+			onComments := tx.Table("votes").Select("COUNT(*)").
+				Where("votes.topic_id = comments.topic_id AND votes.post_id = comments.post_id AND votes.comment_id = comments.id AND votes.value = ?", value)
+			if err := tx.Table("comments").Where("1 = 1").UpdateColumn(column, onComments).Error; err != nil {
+				return err
+			}
+		}
+		var comments []struct {
+			ID, TopicID, PostID string
+			Ups, Downs          int
+		}
+		if err := tx.Table("comments").Select("id", "topic_id", "post_id", "ups", "downs").Where("ups > 0 OR downs > 0").Find(&comments).Error; err != nil {
+			return err
+		}
+		for _, comment := range comments {
+			scores := (&models.Comment{Ups: comment.Ups, Downs: comment.Downs}).Scores()
+			if err := tx.Table("comments").Where("id = ? AND topic_id = ? AND post_id = ?", comment.ID, comment.TopicID, comment.PostID).UpdateColumns(scores).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			Ups, Downs int
+		}
+		type Comment struct {
+			Ups, Downs             int
+			BestScore, Controversy float64
+		}
+		if err := dropColumns(tx, &Post{}, "Ups", "Downs"); err != nil {
+			return err
+		}
+		return dropColumns(tx, &Comment{}, "Ups", "Downs", "BestScore", "Controversy")
+	},
+}
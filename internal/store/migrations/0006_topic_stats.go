@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// topicStats adds the table the trending job keeps each topic's recent
+// activity in.
+var topicStats = Migration{
+	Version: 6,
+	Name:    "topic_stats",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(topicStatsTable())
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(topicStatsTable())
+	},
+}
+
+func topicStatsTable() any {
+	type TopicStats struct {
+		TopicID       string  `gorm:"primaryKey;size:64"`
+		Posts         int     `gorm:"not null;default:0"`
+		Votes         int     `gorm:"not null;default:0"`
+		PreviousPosts int     `gorm:"not null;default:0"`
+		PreviousVotes int     `gorm:"not null;default:0"`
+		Growth        float64 `gorm:"not null;default:0;index"`
+		CreatedAt     time.Time
+	}
+	return &TopicStats{}
+}
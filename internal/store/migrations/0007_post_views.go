@@ -0,0 +1,24 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// postViews adds the count of views to posts.
+var postViews = Migration{
+	Version: 7,
+	Name:    "post_views",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			Views int `gorm:"not null;default:0"`
+		}
+		if tx.Migrator().HasColumn(&Post{}, "Views") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&Post{}, "Views")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			Views int
+		}
+		return dropColumns(tx, &Post{}, "Views")
+	},
+}
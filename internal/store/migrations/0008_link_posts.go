@@ -0,0 +1,32 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// linkPosts adds the kind of post, text or link, and the link's URL. Every
+// post before it is a text post.
+var linkPosts = Migration{
+	Version: 8,
+	Name:    "link_posts",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			Kind string `gorm:"size:16;not null;default:self"`
+			URL  string `gorm:"size:2048"`
+		}
+		for _, column := range []string{"Kind", "URL"} {
+			if tx.Migrator().HasColumn(&Post{}, column) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&Post{}, column); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE posts SET kind = ? WHERE kind IS NULL OR kind = ''", "self").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			Kind string
+			URL  string
+		}
+		return dropColumns(tx, &Post{}, "URL", "Kind")
+	},
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// linkPreviews adds the table the previews of link posts are kept in.
+var linkPreviews = Migration{
+	Version: 9,
+	Name:    "link_previews",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasTable(linkPreviewsTable()) {
+			return nil
+		}
+		return tx.Migrator().CreateTable(linkPreviewsTable())
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(linkPreviewsTable())
+	},
+}
+
+func linkPreviewsTable() any {
+	type LinkPreview struct {
+		TopicID     string `gorm:"primaryKey;size:64"`
+		PostID      string `gorm:"primaryKey;size:64"`
+		URL         string `gorm:"size:2048"`
+		Title       string `gorm:"size:300"`
+		Description string `gorm:"size:1000"`
+		ImageURL    string `gorm:"size:2048"`
+		SiteName    string `gorm:"size:100"`
+		CreatedAt   time.Time
+	}
+	return &LinkPreview{}
+}
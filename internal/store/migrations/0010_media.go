@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// media adds the table uploaded images are recorded in and the image a
+// post shows.
+var media = Migration{
+	Version: 10,
+	Name:    "media",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			MediaID string `gorm:"size:64"`
+		}
+		if !tx.Migrator().HasTable(mediaTable()) {
+			if err := tx.Migrator().CreateTable(mediaTable()); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasColumn(&Post{}, "MediaID") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&Post{}, "MediaID")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			MediaID string
+		}
+		if err := dropColumns(tx, &Post{}, "MediaID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(mediaTable())
+	},
+}
+
+func mediaTable() any {
+	type Media struct {
+		ID          string    `gorm:"primaryKey;size:64"`
+		CreatedAt   time.Time `gorm:"index"`
+		UpdatedAt   time.Time
+		DeletedAt   gorm.DeletedAt `gorm:"index"`
+		UploaderID  string         `gorm:"index;size:64"`
+		ContentType string         `gorm:"size:32"`
+		Width       int
+		Height      int
+		Size        int64
+	}
+	return &Media{}
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// polls adds the tables poll options and votes are kept in and when each
+// poll closes.
+var polls = Migration{
+	Version: 11,
+	Name:    "polls",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			PollClosesAt *time.Time
+		}
+		for _, table := range pollTables() {
+			if tx.Migrator().HasTable(table) {
+				continue
+			}
+			if err := tx.Migrator().CreateTable(table); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasColumn(&Post{}, "PollClosesAt") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&Post{}, "PollClosesAt")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			PollClosesAt *time.Time
+		}
+		if err := dropColumns(tx, &Post{}, "PollClosesAt"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(pollTables()...)
+	},
+}
+
+func pollTables() []any {
+	type PollOption struct {
+		TopicID  string `gorm:"primaryKey;size:64"`
+		PostID   string `gorm:"primaryKey;size:64"`
+		Position int    `gorm:"primaryKey;autoIncrement:false"`
+		Text     string `gorm:"size:100"`
+		Votes    int    `gorm:"not null;default:0"`
+	}
+	type PollVote struct {
+		UserID    string `gorm:"primaryKey;size:64"`
+		TopicID   string `gorm:"primaryKey;size:64"`
+		PostID    string `gorm:"primaryKey;size:64"`
+		Position  int
+		CreatedAt time.Time
+	}
+	return []any{&PollOption{}, &PollVote{}}
+}
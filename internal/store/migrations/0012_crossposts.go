@@ -0,0 +1,40 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// crossposts adds the post a crosspost shares the content of, indexed so
+// the crossposts of a post can be found when it is deleted.
+var crossposts = Migration{
+	Version: 12,
+	Name:    "crossposts",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			CrosspostTopic string `gorm:"size:64"`
+			CrosspostOf    string `gorm:"size:64;index"`
+		}
+		for _, column := range []string{"CrosspostTopic", "CrosspostOf"} {
+			if tx.Migrator().HasColumn(&Post{}, column) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&Post{}, column); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasIndex(&Post{}, "CrosspostOf") {
+			return nil
+		}
+		return tx.Migrator().CreateIndex(&Post{}, "CrosspostOf")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			CrosspostTopic string
+			CrosspostOf    string `gorm:"index"`
+		}
+		if tx.Migrator().HasIndex(&Post{}, "CrosspostOf") {
+			if err := tx.Migrator().DropIndex(&Post{}, "CrosspostOf"); err != nil {
+				return err
+			}
+		}
+		return dropColumns(tx, &Post{}, "CrosspostOf", "CrosspostTopic")
+	},
+}
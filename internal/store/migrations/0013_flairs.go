@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// flairs adds the table of the flairs topics offer and the flair a post
+// has, indexed so listings can be narrowed to one.
+var flairs = Migration{
+	Version: 13,
+	Name:    "flairs",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			FlairID string `gorm:"size:64;index"`
+		}
+		if !tx.Migrator().HasTable(flairTable()) {
+			if err := tx.Migrator().CreateTable(flairTable()); err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasColumn(&Post{}, "FlairID") {
+			if err := tx.Migrator().AddColumn(&Post{}, "FlairID"); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasIndex(&Post{}, "FlairID") {
+			return nil
+		}
+		return tx.Migrator().CreateIndex(&Post{}, "FlairID")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			FlairID string `gorm:"index"`
+		}
+		// On SQLite, rolling back a later migration that dropped a column
+		// of posts rebuilt the table without this index.
+		if tx.Migrator().HasIndex(&Post{}, "FlairID") {
+			if err := tx.Migrator().DropIndex(&Post{}, "FlairID"); err != nil {
+				return err
+			}
+		}
+		if err := dropColumns(tx, &Post{}, "FlairID"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(flairTable())
+	},
+}
+
+func flairTable() any {
+	type Flair struct {
+		ID        string    `gorm:"primaryKey;size:64"`
+		CreatedAt time.Time `gorm:"index"`
+		UpdatedAt time.Time
+		DeletedAt gorm.DeletedAt `gorm:"index"`
+		TopicID   string         `gorm:"index;size:64"`
+		Text      string         `gorm:"size:64"`
+		Color     string         `gorm:"size:7"`
+	}
+	return &Flair{}
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// userFlairs adds the flairs users have in topics, and marks the flairs
+// topics offer users to pick from.
+var userFlairs = Migration{
+	Version: 14,
+	Name:    "user_flairs",
+	Up: func(tx *gorm.DB) error {
+		type Flair struct {
+			Users bool `gorm:"not null;default:false"`
+		}
+		if !tx.Migrator().HasTable(userFlairTable()) {
+			if err := tx.Migrator().CreateTable(userFlairTable()); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasColumn(&Flair{}, "Users") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&Flair{}, "Users")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Flair struct {
+			Users bool
+		}
+		if err := dropColumns(tx, &Flair{}, "Users"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(userFlairTable())
+	},
+}
+
+func userFlairTable() any {
+	type UserFlair struct {
+		TopicID   string `gorm:"primaryKey;size:64"`
+		UserID    string `gorm:"primaryKey;size:64"`
+		Text      string `gorm:"size:64"`
+		Color     string `gorm:"size:7"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	return &UserFlair{}
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// postMarks adds the flags that hide a post's content behind a click in
+// listings, for posts that are not safe for work or spoil something.
+var postMarks = Migration{
+	Version: 15,
+	Name:    "post_marks",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			NSFW    bool `gorm:"not null;default:false"`
+			Spoiler bool `gorm:"not null;default:false"`
+		}
+		for _, column := range []string{"NSFW", "Spoiler"} {
+			if tx.Migrator().HasColumn(&Post{}, column) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&Post{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			NSFW    bool
+			Spoiler bool
+		}
+		return dropColumns(tx, &Post{}, "Spoiler", "NSFW")
+	},
+}
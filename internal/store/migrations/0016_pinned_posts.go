@@ -0,0 +1,25 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// pinnedPosts adds the flag moderators set to keep a post at the top of
+// its topic.
+var pinnedPosts = Migration{
+	Version: 16,
+	Name:    "pinned_posts",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			Pinned bool `gorm:"not null;default:false"`
+		}
+		if tx.Migrator().HasColumn(&Post{}, "Pinned") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&Post{}, "Pinned")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			Pinned bool
+		}
+		return dropColumns(tx, &Post{}, "Pinned")
+	},
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// commentStickies adds the comment a moderator keeps at the top of a post,
+// and the marker on comments moderators and admins make as such.
+var commentStickies = Migration{
+	Version: 17,
+	Name:    "comment_stickies",
+	Up: func(tx *gorm.DB) error {
+		type Comment struct {
+			Stickied      bool   `gorm:"not null;default:false"`
+			Distinguished string `gorm:"size:16"`
+		}
+		for _, column := range []string{"Stickied", "Distinguished"} {
+			if tx.Migrator().HasColumn(&Comment{}, column) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&Comment{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		type Comment struct {
+			Stickied      bool
+			Distinguished string
+		}
+		return dropColumns(tx, &Comment{}, "Distinguished", "Stickied")
+	},
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// lockedPosts adds the flag moderators set to stop new comments and votes
+// on a post.
+var lockedPosts = Migration{
+	Version: 18,
+	Name:    "locked_posts",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			Locked bool `gorm:"not null;default:false"`
+		}
+		if tx.Migrator().HasColumn(&Post{}, "Locked") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&Post{}, "Locked")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			Locked bool
+		}
+		return dropColumns(tx, &Post{}, "Locked")
+	},
+}
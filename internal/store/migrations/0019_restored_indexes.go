@@ -0,0 +1,36 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// restoredIndexes creates the indexes earlier migrations declared that a
+// SQLite database lost when a table was rebuilt under them: the comments
+// and mod actions tables as foreign keys were dropped, and posts on every
+// rollback that dropped a column.
+var restoredIndexes = Migration{
+	Version: 19,
+	Name:    "restored_indexes",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			HotScore    float64 `gorm:"index"`
+			CrosspostOf string  `gorm:"index"`
+			FlairID     string  `gorm:"index"`
+		}
+		for _, model := range append(initialTables(), &Post{}) {
+			stmt := &gorm.Statement{DB: tx}
+			if err := stmt.Parse(model); err != nil {
+				return err
+			}
+			for name := range stmt.Schema.ParseIndexes() {
+				if tx.Migrator().HasIndex(model, name) {
+					continue
+				}
+				if err := tx.Migrator().CreateIndex(model, name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+	// The indexes belong to the migrations that declared them.
+	Down: func(tx *gorm.DB) error { return nil },
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// settings adds the values the server keeps about itself between runs.
+var settings = Migration{
+	Version: 21,
+	Name:    "settings",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasTable(settingTable()) {
+			return nil
+		}
+		return tx.Migrator().CreateTable(settingTable())
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(settingTable())
+	},
+}
+
+func settingTable() any {
+	type Setting struct {
+		Key       string `gorm:"primaryKey;size:64"`
+		Value     string
+		UpdatedAt time.Time
+	}
+	return &Setting{}
+}
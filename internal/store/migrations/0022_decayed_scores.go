@@ -0,0 +1,36 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// decayedScores adds the stored score feeds rank posts by when votes decay.
+// It depends on the configured half-life, so the server fills it in at
+// startup rather than here.
+var decayedScores = Migration{
+	Version: 22,
+	Name:    "decayed_scores",
+	Up: func(tx *gorm.DB) error {
+		type Post struct {
+			DecayedScore float64 `gorm:"not null;default:0;index"`
+		}
+		if !tx.Migrator().HasColumn(&Post{}, "DecayedScore") {
+			if err := tx.Migrator().AddColumn(&Post{}, "DecayedScore"); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasIndex(&Post{}, "DecayedScore") {
+			return nil
+		}
+		return tx.Migrator().CreateIndex(&Post{}, "DecayedScore")
+	},
+	Down: func(tx *gorm.DB) error {
+		type Post struct {
+			DecayedScore float64 `gorm:"index"`
+		}
+		if tx.Migrator().HasIndex(&Post{}, "DecayedScore") {
+			if err := tx.Migrator().DropIndex(&Post{}, "DecayedScore"); err != nil {
+				return err
+			}
+		}
+		return dropColumns(tx, &Post{}, "DecayedScore")
+	},
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// autoPins adds a topic's setting for pinning the top comment of its posts,
+// and the marker on the comment it pins.
+var autoPins = Migration{
+	Version: 23,
+	Name:    "auto_pins",
+	Up: func(tx *gorm.DB) error {
+		type Topic struct {
+			AutoPinVotes  int `gorm:"not null;default:0"`
+			AutoPinMargin int `gorm:"not null;default:0"`
+		}
+		type Comment struct {
+			AutoPinned bool `gorm:"not null;default:false"`
+		}
+		for _, column := range []struct {
+			model any
+			name  string
+		}{{&Topic{}, "AutoPinVotes"}, {&Topic{}, "AutoPinMargin"}, {&Comment{}, "AutoPinned"}} {
+			if tx.Migrator().HasColumn(column.model, column.name) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(column.model, column.name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		type Topic struct {
+			AutoPinVotes  int
+			AutoPinMargin int
+		}
+		type Comment struct {
+			AutoPinned bool
+		}
+		if err := dropColumns(tx, &Comment{}, "AutoPinned"); err != nil {
+			return err
+		}
+		return dropColumns(tx, &Topic{}, "AutoPinMargin", "AutoPinVotes")
+	},
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// evasionReviews adds the addresses users sign in from and the accounts
+// held for review for sharing one with a banned user.
+var evasionReviews = Migration{
+	Version: 24,
+	Name:    "evasion_reviews",
+	Up: func(tx *gorm.DB) error {
+		for _, table := range []any{userAddressTable(), evasionReviewTable()} {
+			if tx.Migrator().HasTable(table) {
+				continue
+			}
+			if err := tx.Migrator().CreateTable(table); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(evasionReviewTable(), userAddressTable())
+	},
+}
+
+func userAddressTable() any {
+	type UserAddress struct {
+		UserID   string `gorm:"primaryKey;size:64"`
+		IP       string `gorm:"primaryKey;size:45;index"`
+		LastSeen time.Time
+	}
+	return &UserAddress{}
+}
+
+func evasionReviewTable() any {
+	type EvasionReview struct {
+		ID           string    `gorm:"primaryKey;size:64"`
+		CreatedAt    time.Time `gorm:"index"`
+		UpdatedAt    time.Time
+		DeletedAt    gorm.DeletedAt `gorm:"index"`
+		UserID       string         `gorm:"index;size:64"`
+		BannedUserID string         `gorm:"size:64"`
+		IP           string         `gorm:"size:45"`
+		Status       string         `gorm:"index;size:16"`
+		ResolvedByID string         `gorm:"size:64"`
+	}
+	return &EvasionReview{}
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// reportArchive adds the table old resolved reports are moved to.
+var reportArchive = Migration{
+	Version: 25,
+	Name:    "report_archive",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasTable(archivedReportTable()) {
+			return nil
+		}
+		return tx.Migrator().CreateTable(archivedReportTable())
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(archivedReportTable())
+	},
+}
+
+func archivedReportTable() any {
+	type ArchivedReport struct {
+		ID           string    `gorm:"primaryKey;size:64"`
+		CreatedAt    time.Time `gorm:"index"`
+		UpdatedAt    time.Time
+		DeletedAt    gorm.DeletedAt `gorm:"index"`
+		TopicID      string         `gorm:"index:idx_archived_reports_topic,priority:1;size:64"`
+		PostID       string         `gorm:"size:64"`
+		CommentID    string         `gorm:"size:64"`
+		ReporterID   string         `gorm:"size:64"`
+		Reason       string
+		Status       string `gorm:"size:16"`
+		ResolvedByID string `gorm:"size:64"`
+		Held         bool
+		ArchivedAt   time.Time `gorm:"index:idx_archived_reports_topic,priority:2"`
+	}
+	return &ArchivedReport{}
+}
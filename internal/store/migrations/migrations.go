@@ -0,0 +1,101 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Migration moves the schema one version forward with Up and back again
+// with Down. The runner gives each its own transaction where the database
+// allows DDL in one.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// All lists the migrations in the order they apply. A new one goes at the
+// end with the next version, in a file named after both.
+var All = []Migration{
+	initial,
+	foreignKeys,
+	commentCounts,
+	hotScores,
+	voteTallies,
+	topicStats,
+	postViews,
+	linkPosts,
+	linkPreviews,
+	media,
+	polls,
+	crossposts,
+	flairs,
+	userFlairs,
+	postMarks,
+	pinnedPosts,
+	commentStickies,
+	lockedPosts,
+	restoredIndexes,
+	archiveIndex,
+	settings,
+	decayedScores,
+	autoPins,
+	evasionReviews,
+	reportArchive,
+}
+
+// dropColumns drops the columns of the model's table that are there,
+// keeping the table's other indexes.
+func dropColumns(tx *gorm.DB, model any, columns ...string) error {
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	return keepIndexes(tx, stmt.Table, func() error {
+		for _, column := range columns {
+			if !tx.Migrator().HasColumn(model, column) {
+				continue
+			}
+			if err := tx.Migrator().DropColumn(model, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// keepIndexes runs fn and then puts back the indexes of the table it lost.
+// SQLite cannot drop a column or a constraint in place, so gorm rebuilds
+// the table and every index on it goes with the old one. Indexes over a
+// column fn dropped stay gone.
+func keepIndexes(tx *gorm.DB, table string, fn func() error) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return fn()
+	}
+	var indexes []struct{ Name, SQL string }
+	if err := tx.Raw("SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).Scan(&indexes).Error; err != nil {
+		return err
+	}
+	columns := make([][]string, len(indexes))
+	for i, index := range indexes {
+		if err := tx.Raw("SELECT name FROM pragma_index_info(?)", index.Name).Scan(&columns[i]).Error; err != nil {
+			return err
+		}
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+restore:
+	for i, index := range indexes {
+		if tx.Migrator().HasIndex(table, index.Name) {
+			continue
+		}
+		for _, column := range columns[i] {
+			if !tx.Migrator().HasColumn(table, column) {
+				continue restore
+			}
+		}
+		if err := tx.Exec(index.SQL).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+)
+
+func (s *GormStore) SetupSearch() error {
+	db := s.DB
+	if db.Dialector.Name() != "sqlite" {
+		return fmt.Errorf("not supported by the %s driver", db.Dialector.Name())
+	}
+	var count int64
+	if err := db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'search_index'").Scan(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		if err := db.Exec("SELECT rowid FROM search_index LIMIT 0").Error; err != nil {
+			return err
+		}
+		*s.search = true
+		return nil
+	}
+	err := db.Exec("CREATE VIRTUAL TABLE search_index USING fts5(kind UNINDEXED, topic_id UNINDEXED, post_id UNINDEXED, comment_id UNINDEXED, title, content, tokenize = 'porter unicode61')").Error
+	if err != nil {
+		return err
+	}
+	*s.search = true
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO search_index (kind, topic_id, post_id, comment_id, title, content) SELECT 'post', topic_id, id, '', title, content FROM posts").Error; err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO search_index (kind, topic_id, post_id, comment_id, title, content) SELECT 'comment', topic_id, post_id, id, '', content FROM comments").Error
+	})
+}
+
+// index keeps the search index in sync after posts and comments are created
+// or updated. It is registered as a gorm callback by Open.
+func (s *GormStore) index(tx *gorm.DB) {
+	if tx.Error != nil || !*s.search {
+		return
+	}
+	switch obj := tx.Statement.Model.(type) {
+	case *models.Post:
+		if obj.ID != "" {
+			tx.AddError(IndexPost(tx.Session(&gorm.Session{NewDB: true}), obj.TopicID, obj.ID))
+		}
+	case *models.Comment:
+		if obj.ID != "" {
+			tx.AddError(IndexComment(tx.Session(&gorm.Session{NewDB: true}), obj.TopicID, obj.PostID, obj.ID))
+		}
+	}
+}
+func IndexPost(tx *gorm.DB, topicID string, id string) error {
+	if err := tx.Exec("DELETE FROM search_index WHERE kind = 'post' AND topic_id = ? AND post_id = ?", topicID, id).Error; err != nil {
+		return err
+	}
+	return tx.Exec("INSERT INTO search_index (kind, topic_id, post_id, comment_id, title, content) SELECT 'post', topic_id, id, '', title, content FROM posts WHERE topic_id = ? AND id = ?", topicID, id).Error
+}
+func IndexComment(tx *gorm.DB, topicID string, postID string, id string) error {
+	if err := tx.Exec("DELETE FROM search_index WHERE kind = 'comment' AND topic_id = ? AND post_id = ? AND comment_id = ?", topicID, postID, id).Error; err != nil {
+		return err
+	}
+	return tx.Exec("INSERT INTO search_index (kind, topic_id, post_id, comment_id, title, content) SELECT 'comment', topic_id, post_id, id, '', content FROM comments WHERE topic_id = ? AND post_id = ? AND id = ?", topicID, postID, id).Error
+}
+func MatchQuery(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
+func Highlight(marked string) template.HTML {
+	escaped := html.EscapeString(marked)
+	return template.HTML(strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(escaped))
+}
+func (s *GormStore) Search(c context.Context, q string, topicID string, page models.PageRequest, scopes ...Scope) (*models.ListResponse[models.SearchResult], error) {
+	page, err := offsetPage(page.Normalize())
+	if err != nil {
+		return &models.ListResponse[models.SearchResult]{Items: []models.SearchResult{}}, err
+	}
+	res := &models.ListResponse[models.SearchResult]{Items: []models.SearchResult{}, Pagination: models.Pagination{Limit: page.Limit, Offset: page.Offset}}
+	if !*s.search {
+		return res, ErrSearchUnavailable
+	}
+	match := MatchQuery(q)
+	if match == "" {
+		return res, ErrEmptyQuery
+	}
+	query := s.DB.WithContext(c).Table("search_index").
+		Joins("JOIN posts ON posts.topic_id = search_index.topic_id AND posts.id = search_index.post_id AND posts.deleted_at IS NULL").
+		Joins("LEFT JOIN comments ON search_index.kind = 'comment' AND comments.topic_id = search_index.topic_id AND comments.post_id = search_index.post_id AND comments.id = search_index.comment_id").
+		Where("search_index MATCH ?", match).
+		Where("search_index.kind = 'post' OR comments.deleted_at IS NULL")
+	if topicID != "" {
+		query = query.Where("search_index.topic_id = ?", topicID)
+	}
+	if visible := Build(scopes...); visible.Visible {
+		blocked := "(SELECT blocked_id FROM blocks WHERE user_id = ?)"
+		query = query.Where("posts.shadowbanned = ? OR posts.author_id = ?", false, visible.Viewer).
+			Where("search_index.kind = 'post' OR comments.shadowbanned = ? OR comments.author_id = ?", false, visible.Viewer).
+			Where("posts.author_id NOT IN "+blocked, visible.Viewer).
+			Where("search_index.kind = 'post' OR comments.author_id NOT IN "+blocked, visible.Viewer)
+	}
+	if err := query.Count(&res.Total).Error; err != nil {
+		return res, err
+	}
+	res.NextPageToken = offsetToken(res.Pagination)
+	var rows []struct {
+		Kind, TopicID, PostID, CommentID, PostTitle, Title, Snippet string
+	}
+	err = query.Select(
+		"search_index.kind, search_index.topic_id, search_index.post_id, search_index.comment_id, posts.title AS post_title, " +
+			"highlight(search_index, 4, char(2), char(3)) AS title, snippet(search_index, 5, char(2), char(3), '...', 24) AS snippet").
+		Order("bm25(search_index)").Limit(page.Limit).Offset(page.Offset).Scan(&rows).Error
+	for _, row := range rows {
+		title := Highlight(row.Title)
+		if row.Kind == "comment" {
+			title = template.HTML(html.EscapeString(row.PostTitle))
+		}
+		res.Items = append(res.Items, models.SearchResult{
+			Kind:      row.Kind,
+			TopicID:   row.TopicID,
+			PostID:    row.PostID,
+			CommentID: row.CommentID,
+			Title:     title,
+			Snippet:   Highlight(row.Snippet),
+		})
+	}
+	return res, err
+}
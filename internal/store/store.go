@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+
+	"reddit-clone/internal/models"
+)
+
+// Store is the persistence layer used by the handlers. Lookups take a model
+// whose non-zero fields select the matching rows, like gorm's Where(&model).
+type Store interface {
+	Get(c context.Context, dest any, id any, preloads ...string) error
+	Find(c context.Context, dest any, id any, scopes ...Scope) error
+	Count(c context.Context, model any, id any, scopes ...Scope) (int64, error)
+	// CountBy counts the matching rows in one query, grouped by the value
+	// of column.
+	CountBy(c context.Context, model any, id any, column string, scopes ...Scope) (map[string]int64, error)
+	// CountByDay counts the matching rows in one query, grouped by the UTC
+	// day of the time column, written like 2006-01-02.
+	CountByDay(c context.Context, model any, id any, column string, scopes ...Scope) (map[string]int64, error)
+	Create(c context.Context, obj any) error
+	Update(c context.Context, model any, mask any) error
+	// Increment adds n to column on the rows matching model's non-zero
+	// fields, in the database rather than by reading them first. It leaves
+	// updated_at alone.
+	Increment(c context.Context, model any, column string, n int) error
+	// UpdateColumns sets values on every row matching id's non-zero fields
+	// and the scopes, in one statement. Like Increment it leaves updated_at
+	// alone, and it skips deleted rows unless the scopes are Unscoped.
+	UpdateColumns(c context.Context, model any, id any, values map[string]any, scopes ...Scope) error
+	Delete(c context.Context, model any, id any, scopes ...Scope) error
+	Restore(c context.Context, model any, id any) error
+	Transaction(c context.Context, f func(Store) error) error
+	CastVote(c context.Context, target any, key models.Vote, direction int) (int, error)
+	Search(c context.Context, query string, topicID string, page models.PageRequest, scopes ...Scope) (*models.ListResponse[models.SearchResult], error)
+	Ping(c context.Context) error
+	Migrated(c context.Context) error
+	Close() error
+}
+
+var ErrNotFound = gorm.ErrRecordNotFound
+var ErrDuplicatedKey = gorm.ErrDuplicatedKey
+var ErrInvalidSort = errors.New("sort must be one of new, hot or top (with t=hour, day, week, month, year or all)")
+var ErrInvalidCommentSort = errors.New("sort must be one of best, top, new, old or controversial")
+var ErrSearchUnavailable = errors.New("search is unavailable, the server must use sqlite and be built with -tags sqlite_fts5")
+var ErrEmptyQuery = errors.New("search query must not be empty")
+
+// KarmaColumn is the users column a vote on the keyed post or comment
+// credits to its author.
+func KarmaColumn(key models.Vote) string {
+	if key.CommentID != "" {
+		return "comment_karma"
+	}
+	return "post_karma"
+}
+
+var TopWindows = map[string]time.Duration{
+	"":      24 * time.Hour,
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+type Query struct {
+	Preloads []string
+	Columns  []string
+	Conds    []Cond
+	Orders   []string
+	Limit    int
+	Offset   int
+	Unscoped bool
+	Deleted  bool
+	Visible  bool
+	Viewer   string
+	HiddenBy string
+	// After, when set, keeps the rows past it in creation order.
+	After     *Cursor
+	AfterDesc bool
+}
+type Cond struct {
+	Column string
+	Op     string
+	Value  any
+}
+type Scope func(*Query)
+
+func Preload(preloads ...string) Scope {
+	return func(q *Query) { q.Preloads = append(q.Preloads, preloads...) }
+}
+
+// Select loads only the named columns, leaving the other fields zero.
+func Select(columns ...string) Scope {
+	return func(q *Query) { q.Columns = append(q.Columns, columns...) }
+}
+
+// Where keeps the rows whose column compares to value with op. A nil value
+// with = or <> tests for NULL.
+func Where(column string, op string, value any) Scope {
+	return func(q *Query) { q.Conds = append(q.Conds, Cond{Column: column, Op: op, Value: value}) }
+}
+func OrderBy(orders ...string) Scope {
+	return func(q *Query) { q.Orders = append(q.Orders, orders...) }
+}
+
+// Unscoped includes soft-deleted rows, and makes Delete remove rows for good.
+func Unscoped() Scope {
+	return func(q *Query) { q.Unscoped = true }
+}
+
+// Deleted includes only soft-deleted rows.
+func Deleted() Scope {
+	return func(q *Query) { q.Unscoped, q.Deleted = true, true }
+}
+
+// VisibleTo hides posts and comments by shadowbanned users from everyone but
+// their authors, and those by users the viewer has blocked.
+func VisibleTo(viewerID string) Scope {
+	return func(q *Query) { q.Visible, q.Viewer = true, viewerID }
+}
+
+// NotHiddenBy leaves out the posts the user has hidden.
+func NotHiddenBy(userID string) Scope {
+	return func(q *Query) { q.HiddenBy = userID }
+}
+func Page(page models.PageRequest) Scope {
+	return func(q *Query) { q.Limit, q.Offset = page.Limit, page.Offset }
+}
+func Build(scopes ...Scope) Query {
+	var q Query
+	for _, scope := range scopes {
+		scope(&q)
+	}
+	return q
+}
+func PostOrder(sort models.SortRequest) (Scope, error) {
+	return postOrder(sort, "hot_score DESC", "votes DESC")
+}
+
+// DecayedPostOrder is PostOrder with hot and top both ranking by the
+// decayed score once models.Decay has a half-life. Top still keeps to its
+// window.
+func DecayedPostOrder(sort models.SortRequest) (Scope, error) {
+	if models.Decay.HalfLife <= 0 {
+		return PostOrder(sort)
+	}
+	return postOrder(sort, "decayed_score DESC", "decayed_score DESC")
+}
+func postOrder(sort models.SortRequest, hot, top string) (Scope, error) {
+	switch sort.Sort {
+	case "new":
+		return OrderBy("created_at DESC"), nil
+	case "", "hot":
+		return OrderBy(hot, "created_at DESC"), nil
+	case "top":
+		window, ok := TopWindows[sort.Window]
+		if !ok {
+			return nil, ErrInvalidSort
+		}
+		return func(q *Query) {
+			if window > 0 {
+				// A cutoff to the minute lets repeated requests share a
+				// cached result.
+				Where("created_at", ">=", time.Now().Truncate(time.Minute).Add(-window))(q)
+			}
+			OrderBy(top)(q)
+		}, nil
+	}
+	return nil, ErrInvalidSort
+}
+
+// CommentOrder orders comments best first unless another sort is asked
+// for: top by votes, new or old by age, or controversial.
+func CommentOrder(sort models.SortRequest) (Scope, error) {
+	switch sort.Sort {
+	case "", "best":
+		return OrderBy("best_score DESC", "created_at"), nil
+	case "top":
+		return OrderBy("votes DESC", "created_at"), nil
+	case "new":
+		return OrderBy("created_at DESC"), nil
+	case "old":
+		return OrderBy("created_at"), nil
+	case "controversial":
+		return OrderBy("controversy DESC", "created_at"), nil
+	}
+	return nil, ErrInvalidCommentSort
+}
+
+func Get[T any](c context.Context, s Store, id T, preloads ...string) (*T, error) {
+	var obj T
+	return &obj, s.Get(c, &obj, &id, preloads...)
+}
+func Find[T any](c context.Context, s Store, id T, scopes ...Scope) ([]T, error) {
+	items := []T{}
+	return items, s.Find(c, &items, &id, scopes...)
+}
+func Create[T any](c context.Context, s Store, obj T) (*T, error) {
+	return &obj, s.Create(c, &obj)
+}
+func Update[T any](c context.Context, s Store, model T, mask T) (*T, error) {
+	if err := s.Update(c, &model, mask); err != nil {
+		return new(T), err
+	}
+	return Get(c, s, model)
+}
+
+// List pages through the rows id selects. Lists in creation order page by
+// seeking past the row in the page token, others by its offset.
+func List[T any](c context.Context, s Store, id T, page models.PageRequest, scopes ...Scope) (*models.ListResponse[T], error) {
+	page = page.Normalize()
+	var cursor Cursor
+	if page.PageToken != "" {
+		var err error
+		if cursor, err = ParseCursor(page.PageToken); err != nil {
+			return &models.ListResponse[T]{Items: []T{}}, err
+		}
+		page.Offset = cursor.Offset
+	}
+	res := &models.ListResponse[T]{Items: []T{}, Pagination: models.Pagination{Limit: page.Limit, Offset: page.Offset}}
+	total, err := s.Count(c, new(T), &id, scopes...)
+	if err != nil {
+		return res, err
+	}
+	res.Total = total
+	seek, desc := keyset[T](Build(scopes...).Orders)
+	if !seek {
+		if cursor.ID != "" {
+			return res, ErrInvalidPageToken
+		}
+		res.NextPageToken = offsetToken(res.Pagination)
+		return res, s.Find(c, &res.Items, &id, append(scopes, OrderBy("created_at"), Page(page))...)
+	}
+	if err := s.Find(c, &res.Items, &id, append(scopes, seekPage(cursor, page, desc)...)...); err != nil {
+		return res, err
+	}
+	if len(res.Items) > page.Limit {
+		res.Items = res.Items[:page.Limit]
+		last := reflect.ValueOf(res.Items[page.Limit-1])
+		created := last.FieldByName("CreatedAt").Interface().(time.Time)
+		res.NextPageToken = Cursor{CreatedAt: &created, ID: last.FieldByName("ID").String()}.Token()
+	}
+	return res, nil
+}
+func Delete[T any](c context.Context, s Store, id T, scopes ...Scope) (*T, error) {
+	return new(T), s.Delete(c, new(T), &id, scopes...)
+}
+func Restore[T any](c context.Context, s Store, id T) (*T, error) {
+	if err := s.Restore(c, new(T), &id); err != nil {
+		return new(T), err
+	}
+	return Get(c, s, id)
+}
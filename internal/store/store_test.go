@@ -0,0 +1,291 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm/logger"
+
+	"reddit-clone/internal/logging"
+	"reddit-clone/internal/metrics"
+	"reddit-clone/internal/models"
+)
+
+var testOptions = Options{SQLite: SQLiteConfig{JournalMode: "WAL", BusyTimeout: 5 * time.Second, ForeignKeys: true}}
+
+// openStore opens a migrated GormStore on the driver. SQLite gets a new
+// database in a temporary directory. PostgreSQL and MySQL are skipped
+// unless DB_DRIVER names them and DB_DSN points at a scratch database,
+// which is rolled back to empty first.
+func openStore(t *testing.T, driver string) *GormStore {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	if driver != "sqlite" {
+		if os.Getenv("DB_DRIVER") != driver || os.Getenv("DB_DSN") == "" {
+			t.Skipf("set DB_DRIVER=%s and DB_DSN to a scratch database to run against it", driver)
+		}
+		dsn = os.Getenv("DB_DSN")
+	}
+	s, err := Open(driver, dsn, testOptions)
+	if err != nil {
+		t.Fatalf("open %s: %v", driver, err)
+	}
+	s.DB.Logger = logger.Discard
+	for s.Rollback() == nil {
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatalf("migrate %s: %v", driver, err)
+	}
+	return s
+}
+
+// eachDriver runs test against a GormStore on every database driver.
+func eachDriver(t *testing.T, test func(t *testing.T, s *GormStore)) {
+	for _, driver := range []string{"sqlite", "postgres", "mysql"} {
+		t.Run(driver, func(t *testing.T) { test(t, openStore(t, driver)) })
+	}
+}
+
+// TestOpen ranks posts on every driver by their stored hot scores, and
+// checks the queries were timed.
+func TestOpen(t *testing.T) {
+	eachDriver(t, func(t *testing.T, s *GormStore) {
+		c := context.Background()
+		for _, obj := range []any{&models.User{Model: models.Model{ID: "u1"}, Username: "alice"}, &models.Topic{Model: models.Model{ID: "golang"}}} {
+			if err := s.Create(c, obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		now := time.Now()
+		for _, post := range []models.Post{
+			{Model: models.Model{ID: "old", CreatedAt: now.Add(-48 * time.Hour)}, Votes: 10},
+			{Model: models.Model{ID: "recent", CreatedAt: now.Add(-time.Hour)}, Votes: 3},
+			{Model: models.Model{ID: "new", CreatedAt: now}},
+		} {
+			post.TopicID, post.AuthorID, post.Title = "golang", "u1", post.ID
+			if _, err := Create(c, s, post); err != nil {
+				t.Fatal(err)
+			}
+		}
+		order, err := PostOrder(models.SortRequest{Sort: "hot"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		posts, err := Find(c, s, models.Post{TopicID: "golang"}, order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, post := range posts {
+			ids = append(ids, post.ID)
+		}
+		// Three votes an hour ago beat none now, but ten two days ago are
+		// worth less than either.
+		if got := fmt.Sprint(ids); got != "[recent new old]" {
+			t.Errorf("hot order: got %s", got)
+		}
+		var scraped strings.Builder
+		metrics.Write(&scraped)
+		for _, operation := range []string{"create", "query"} {
+			if !strings.Contains(scraped.String(), `db_query_duration_seconds_count{operation="`+operation+`"}`) {
+				t.Errorf("%s queries were not timed", operation)
+			}
+		}
+		if s.DB.Dialector.Name() != "sqlite" && s.SetupSearch() == nil {
+			t.Errorf("search set up on %s", s.DB.Dialector.Name())
+		}
+	})
+	s := openStore(t, "sqlite")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err := s.DB.DB(); err != nil || db.Ping() == nil {
+		t.Error("the database still answers after Close")
+	}
+	if _, err := Open("oracle", "", Options{}); err == nil {
+		t.Error("opened an unsupported driver")
+	}
+}
+
+// TestBackfillNormalizedTitles starts from the posts table as it was before
+// normalized_title existed, so the new column is NULL for the old rows.
+func TestBackfillNormalizedTitles(t *testing.T) {
+	s, err := Open("sqlite", filepath.Join(t.TempDir(), "test.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Exec("CREATE TABLE posts (id text, created_at datetime, updated_at datetime, deleted_at datetime, topic_id text, title text, content text, votes integer, PRIMARY KEY (id, topic_id))").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Exec("INSERT INTO posts (id, topic_id, title, votes) VALUES ('p1', 'golang', 'Hello,  World!', 0)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	if err := s.DB.Model(&models.Post{}).Order("id").Pluck("normalized_title", &keys).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "hello world" {
+		t.Errorf("normalized titles after the backfill: got %q", keys)
+	}
+}
+
+// TestMigrateKarma starts from the users table as it was before karma, and
+// checks existing users start at zero.
+func TestMigrateKarma(t *testing.T) {
+	s, err := Open("sqlite", filepath.Join(t.TempDir(), "test.db"), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Exec("CREATE TABLE users (id text PRIMARY KEY, created_at datetime, updated_at datetime, deleted_at datetime, username text, password_hash blob)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Exec("INSERT INTO users (id, username) VALUES ('u1', 'alice')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	user, err := Get(context.Background(), s, models.User{Model: models.Model{ID: "u1"}})
+	if err != nil || user.PostKarma != 0 || user.CommentKarma != 0 {
+		t.Errorf("karma after the upgrade: got %+v, %v", user, err)
+	}
+}
+
+// TestTraceQueries checks that queries run for a traced request get spans
+// under it, and that other queries get none.
+func TestTraceQueries(t *testing.T) {
+	s := openStore(t, "sqlite")
+	spans := tracetest.NewInMemoryExporter()
+	// The plugin's tracer binds to the first global provider set, so the
+	// provider is not swapped back. Like the site's sampler, it records
+	// nothing that does not continue a request's trace.
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans), sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.NeverSample()))))
+	request := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled, Remote: true})
+	c := trace.ContextWithRemoteSpanContext(context.Background(), request)
+	if _, err := Get(c, s, models.Post{Model: models.Model{ID: "p1"}, TopicID: "golang"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get a missing post: %v", err)
+	}
+	if _, err := Find(context.Background(), s, models.Post{TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+	got := spans.GetSpans()
+	if len(got) != 1 {
+		t.Fatalf("spans: got %v, want one for the traced query", got)
+	}
+	query := got[0]
+	if query.Name != "gorm.Query" || query.SpanKind != trace.SpanKindClient || query.Parent.SpanID() != request.SpanID() || query.SpanContext.TraceID() != request.TraceID() {
+		t.Errorf("query span: got %+v", query)
+	}
+	attributes := map[string]any{}
+	for _, kv := range query.Attributes {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	if attributes["db.system"] != "sqlite" || attributes["db.sql.table"] != "posts" || query.Status.Code == codes.Error {
+		t.Errorf("query span attributes: got %v, %+v", attributes, query.Status)
+	}
+}
+
+// TestSlowQuery logs every query as slow and checks the line carries the
+// logger of the request the query ran for.
+func TestSlowQuery(t *testing.T) {
+	s := openStore(t, "sqlite")
+	slow := SlowQuery
+	t.Cleanup(func() { SlowQuery = slow })
+	SlowQuery = time.Nanosecond
+	var out strings.Builder
+	c := logging.WithLogger(context.Background(), slog.New(slog.NewTextHandler(&out, nil)).With("request_id", "r1"))
+	if _, err := Find(c, s, models.Post{TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, `level=WARN msg="slow query" request_id=r1 operation=query table=posts sql="SELECT * FROM`) {
+		t.Errorf("slow query log: got %q", got)
+	}
+	out.Reset()
+	SlowQuery = 0
+	if _, err := Find(c, s, models.Post{TopicID: "golang"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("logged with the slow query log off: %q", out.String())
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	for _, tc := range []struct {
+		dsn  string
+		cfg  SQLiteConfig
+		want string
+	}{
+		{"app.db", SQLiteConfig{}, "app.db?_txlock=immediate"},
+		{"app.db", testOptions.SQLite, "app.db?_busy_timeout=5000&_foreign_keys=1&_journal_mode=WAL&_txlock=immediate"},
+		{"app.db?_journal_mode=DELETE", testOptions.SQLite, "app.db?_busy_timeout=5000&_foreign_keys=1&_journal_mode=DELETE&_txlock=immediate"},
+	} {
+		if got := SQLiteDSN(tc.dsn, tc.cfg); got != tc.want {
+			t.Errorf("SQLiteDSN(%q): got %q, want %q", tc.dsn, got, tc.want)
+		}
+	}
+}
+
+// TestSQLiteOptions checks every pooled connection gets the settings, and
+// that comments and automod actions can be written with foreign keys on.
+func TestSQLiteOptions(t *testing.T) {
+	c := context.Background()
+	s, err := Open("sqlite", filepath.Join(t.TempDir(), "test.db"), Options{SQLite: testOptions.SQLite, Pool: PoolConfig{MaxOpenConns: 4, MaxIdleConns: 4, ConnMaxLifetime: time.Minute}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := s.DB.DB()
+	if got := sqlDB.Stats().MaxOpenConnections; got != 4 {
+		t.Errorf("max open connections: got %d, want 4", got)
+	}
+	// Hold connections open so the pragmas are read from more than one.
+	for i := range 3 {
+		conn, err := sqlDB.Conn(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		var mode string
+		var keys int
+		if err := conn.QueryRowContext(c, "PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+			t.Errorf("connection %d journal mode: got %q, %v", i, mode, err)
+		}
+		if err := conn.QueryRowContext(c, "PRAGMA foreign_keys").Scan(&keys); err != nil || keys != 1 {
+			t.Errorf("connection %d foreign keys: got %d, %v", i, keys, err)
+		}
+	}
+
+	seed(t, s, 1)
+	if _, err := Create(c, s, models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p0", AuthorID: "u1", Content: "hi"}); err != nil {
+		t.Errorf("create a comment: %v", err)
+	}
+	if _, err := Create(c, s, models.ModAction{TopicID: "golang", Action: "remove_post", PostID: "p0"}); err != nil {
+		t.Errorf("create an automod action: %v", err)
+	}
+	if _, err := Create(c, s, models.TopicModerator{TopicID: "golang", UserID: "nobody"}); err == nil {
+		t.Error("created a moderator for a user that does not exist")
+	}
+	var problems []map[string]any
+	if err := s.DB.Raw("PRAGMA foreign_key_check").Scan(&problems).Error; err != nil || len(problems) != 0 {
+		t.Errorf("foreign key check: got %v, %v", problems, err)
+	}
+}
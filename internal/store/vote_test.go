@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"reddit-clone/internal/models"
+)
+
+// TestCastVoteConcurrently has users vote on one post at once, each
+// up, down, or up and then down, and checks the post's total and its
+// author's karma agree with the votes left behind.
+func TestCastVoteConcurrently(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		author, _ := seed(t, s, 1)
+		const voters = 24
+		for i := range voters {
+			if _, err := Create(c, s, models.User{Model: models.Model{ID: fmt.Sprintf("v%d", i)}, Username: fmt.Sprintf("voter%d", i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		target := &models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}
+		var wg sync.WaitGroup
+		errs := make(chan error, voters*2)
+		for i := range voters {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				key := models.Vote{UserID: fmt.Sprintf("v%d", i), TopicID: "golang", PostID: "p0"}
+				directions := [][]int{{1}, {-1}, {1, -1}}[i%3]
+				for _, direction := range directions {
+					if _, err := s.CastVote(c, target, key, direction); err != nil {
+						errs <- err
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+		votes, err := Find(c, s, models.Vote{TopicID: "golang", PostID: "p0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum, ups, downs int
+		for _, vote := range votes {
+			sum += vote.Value
+			if vote.Value > 0 {
+				ups++
+			} else {
+				downs++
+			}
+		}
+		if ups != voters/3 || downs != voters*2/3 {
+			t.Errorf("vote rows: got %d up and %d down, want %d and %d", ups, downs, voters/3, voters*2/3)
+		}
+		post, err := Get(c, s, *target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.Votes != sum {
+			t.Errorf("post votes: got %d, want %d", post.Votes, sum)
+		}
+		if want := models.Hot(sum, post.CreatedAt); post.HotScore != want {
+			t.Errorf("post hot score: got %v, want %v for %d votes", post.HotScore, want, sum)
+		}
+		user, err := Get(c, s, models.User{Model: models.Model{ID: author.ID}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.PostKarma != sum {
+			t.Errorf("author karma: got %d, want %d", user.PostKarma, sum)
+		}
+	})
+}
+
+// TestKarma votes on a post and a comment by the same author, and checks
+// each vote moves the matching karma by the change in its value.
+func TestKarma(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		author, _ := seed(t, s, 1)
+		if _, err := Create(c, s, models.User{Model: models.Model{ID: "u2"}, Username: "bob"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Create(c, s, models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p0", AuthorID: author.ID, Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		post := &models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"}
+		comment := &models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p0"}
+		for _, step := range []struct {
+			target        any
+			comment       string
+			direction     int
+			post, replies int
+		}{
+			{post, "", 1, 1, 0},
+			{post, "", -1, -1, 0},
+			{comment, "c1", -1, -1, -1},
+			{post, "", -1, 0, -1},
+			{comment, "c1", 1, 0, 1},
+		} {
+			key := models.Vote{UserID: "u2", TopicID: "golang", PostID: "p0", CommentID: step.comment}
+			if _, err := s.CastVote(c, step.target, key, step.direction); err != nil {
+				t.Fatal(err)
+			}
+			user, err := Get(c, s, models.User{Model: models.Model{ID: author.ID}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.PostKarma != step.post || user.CommentKarma != step.replies {
+				t.Errorf("after %d on %T: got post karma %d and comment karma %d, want %d and %d", step.direction, step.target, user.PostKarma, user.CommentKarma, step.post, step.replies)
+			}
+		}
+	})
+}
+
+// TestVoteTallies casts, changes and takes back votes on a comment and
+// checks its upvotes, downvotes and scores follow.
+func TestVoteTallies(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Store) {
+		c := context.Background()
+		author, _ := seed(t, s, 1)
+		for _, name := range []string{"bob", "carol"} {
+			if _, err := Create(c, s, models.User{Model: models.Model{ID: name}, Username: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := Create(c, s, models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p0", AuthorID: author.ID, Content: "hi"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, step := range []struct {
+			user              string
+			direction         int
+			votes, ups, downs int
+		}{
+			{"bob", 1, 1, 1, 0},
+			{"carol", -1, 0, 1, 1},
+			{"bob", -1, -2, 0, 2},
+			{"carol", 0, -1, 0, 1},
+		} {
+			key := models.Vote{UserID: step.user, TopicID: "golang", PostID: "p0", CommentID: "c1"}
+			if _, err := s.CastVote(c, &models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p0"}, key, step.direction); err != nil {
+				t.Fatal(err)
+			}
+			comment, err := Get(c, s, models.Comment{Model: models.Model{ID: "c1"}, TopicID: "golang", PostID: "p0"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if comment.Votes != step.votes || comment.Ups != step.ups || comment.Downs != step.downs {
+				t.Errorf("after %s votes %d: got %d votes, %d up and %d down, want %d, %d and %d", step.user, step.direction, comment.Votes, comment.Ups, comment.Downs, step.votes, step.ups, step.downs)
+			}
+			if comment.BestScore != models.Wilson(step.ups, step.downs) || comment.Controversy != models.Controversy(step.ups, step.downs) {
+				t.Errorf("after %s votes %d: got best %v and controversy %v", step.user, step.direction, comment.BestScore, comment.Controversy)
+			}
+		}
+		post, err := Get(c, s, models.Post{Model: models.Model{ID: "p0"}, TopicID: "golang"})
+		if err != nil || post.Ups != 0 || post.Downs != 0 {
+			t.Errorf("the post after votes on its comment: got %+v, %v", post, err)
+		}
+	})
+}
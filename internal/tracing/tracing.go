@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config sends traces to an OTLP/HTTP collector at Endpoint, such as
+// http://localhost:4318. An empty Endpoint leaves tracing off.
+type Config struct {
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"serviceName"`
+}
+
+// Tracer starts the spans the site records itself, such as binding and
+// rendering. Until Setup runs it records nothing.
+var Tracer = otel.Tracer("reddit-clone")
+
+// Setup installs the global tracer provider, batching spans to the
+// collector, and the W3C trace context propagator, so requests continue
+// the traces of callers that send a traceparent header. It must be called
+// before serving requests; the returned function sends the spans still
+// queued and stops the exporter.
+func Setup(c context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlptracehttp.New(c, otlptracehttp.WithEndpointURL(strings.TrimSuffix(cfg.Endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(requestsOnly{})),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Error("failed to export spans", "error", err)
+	}))
+	return provider.Shutdown, nil
+}
+
+// requestsOnly starts traces at requests only, so the queries of
+// background jobs, which have no request span above them, stay out.
+type requestsOnly struct{}
+
+func (requestsOnly) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Kind != trace.SpanKindServer {
+		return sdktrace.SamplingResult{Decision: sdktrace.Drop}
+	}
+	return sdktrace.AlwaysSample().ShouldSample(p)
+}
+func (requestsOnly) Description() string {
+	return "RequestsOnly"
+}
+
+// Fail marks span as failed with err. A nil err does nothing.
+func Fail(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
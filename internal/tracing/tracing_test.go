@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestRequestsOnly checks spans are recorded under a request, but not for
+// a query run with no request above it.
+func TestRequestsOnly(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder), sdktrace.WithSampler(sdktrace.ParentBased(requestsOnly{})))
+	tracer := provider.Tracer("test")
+	c := context.Background()
+
+	_, job := tracer.Start(c, "gorm.Query", trace.WithSpanKind(trace.SpanKindClient))
+	job.End()
+	ctx, request := tracer.Start(c, "GET /topics/:topicid", trace.WithSpanKind(trace.SpanKindServer))
+	_, query := tracer.Start(ctx, "gorm.Query", trace.WithSpanKind(trace.SpanKindClient))
+	query.End()
+	request.End()
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	if len(names) != 2 || names[0] != "gorm.Query" || names[1] != "GET /topics/:topicid" {
+		t.Errorf("recorded %v, want the request's query and the request", names)
+	}
+	if spans := recorder.Ended(); len(spans) == 2 && spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Error("the query is not a child of the request")
+	}
+}
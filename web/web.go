@@ -0,0 +1,8 @@
+// Package web holds the HTML templates and static assets, embedded so the
+// binary serves them from wherever it is run.
+package web
+
+import "embed"
+
+//go:embed views/*.html static
+var FS embed.FS